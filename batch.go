@@ -0,0 +1,188 @@
+package xjson
+
+import (
+	"fmt"
+
+	"github.com/474420502/xjson/internal/engine"
+)
+
+type batchOpKind uint8
+
+const (
+	batchOpSet batchOpKind = iota + 1
+	batchOpAppend
+	batchOpDelete
+)
+
+type batchOp struct {
+	kind  batchOpKind
+	path  string
+	value interface{}
+}
+
+// Tx stages the writes of a Batch. Writes are applied to a private copy of the
+// document, so queries made through the Tx see them while the original
+// document stays untouched until the batch commits.
+type Tx struct {
+	staged Node
+	ops    []batchOp
+	done   bool
+}
+
+// Batch runs fn against a staged copy of root and applies every write made
+// through the Tx to root only when fn returns nil. When fn returns an error
+// or panics, or a write no longer applies to root because fn changed it,
+// root is left exactly as it was; a panic is re-raised after the staged copy
+// has been discarded. Nodes given as values are copied when staged.
+func Batch(root Node, fn func(tx *Tx) error) error {
+	if root == nil {
+		return fmt.Errorf("batch on nil node")
+	}
+	if err := root.Error(); err != nil {
+		return err
+	}
+	staged, err := engine.ParseWithFuncs([]byte(root.String()), root.GetFuncs())
+	if err != nil {
+		return fmt.Errorf("batch: cannot stage document: %w", err)
+	}
+
+	tx := &Tx{staged: staged}
+	defer func() { tx.done = true }()
+	if err := fn(tx); err != nil {
+		return err
+	}
+	if len(tx.ops) == 0 {
+		return nil
+	}
+
+	// fn may have written to root itself, so the log is first replayed on a
+	// fresh copy of root as it is now. Node values are copied for every
+	// replay, so root then takes every operation as the copy did.
+	check, err := engine.ParseWithFuncs([]byte(root.String()), root.GetFuncs())
+	if err != nil {
+		return fmt.Errorf("batch: cannot stage document: %w", err)
+	}
+	for _, op := range tx.ops {
+		if err := applyBatchOp(check, op); err != nil {
+			return err
+		}
+	}
+	for _, op := range tx.ops {
+		if err := applyBatchOp(root, op); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Query evaluates path against the staged document.
+func (tx *Tx) Query(path string) Node {
+	return tx.staged.Query(path)
+}
+
+// Set stages a write with the same path semantics as Node.SetByPath.
+func (tx *Tx) Set(path string, value interface{}) error {
+	return tx.stage(batchOp{kind: batchOpSet, path: path, value: value})
+}
+
+// Append stages appending value to the array found at path.
+func (tx *Tx) Append(path string, value interface{}) error {
+	return tx.stage(batchOp{kind: batchOpAppend, path: path, value: value})
+}
+
+// Delete stages removing the value at path, see Node.DeleteByPath.
+func (tx *Tx) Delete(path string) error {
+	return tx.stage(batchOp{kind: batchOpDelete, path: path})
+}
+
+func (tx *Tx) stage(op batchOp) error {
+	if tx.done {
+		return fmt.Errorf("batch already finished")
+	}
+	// Take the nodes in the value as they are now: later edits to them do
+	// not reach the batch.
+	op.value, _ = copyNodeValues(op.value)
+	if err := applyBatchOp(tx.staged, op); err != nil {
+		return err
+	}
+	tx.ops = append(tx.ops, op)
+	return nil
+}
+
+// applyBatchOp applies op to target. A node in the value has one place in a
+// document, so target is given a copy of its own.
+func applyBatchOp(target Node, op batchOp) error {
+	op.value, _ = copyNodeValues(op.value)
+	var result Node
+	switch op.kind {
+	case batchOpSet:
+		result = target.SetByPath(op.path, op.value)
+	case batchOpAppend:
+		arr := target.Query(op.path)
+		if !arr.IsValid() {
+			return fmt.Errorf("append %q: %w", op.path, arr.Error())
+		}
+		if arr.Type() != Array {
+			return fmt.Errorf("append %q: cannot append to node type %s", op.path, arr.Type())
+		}
+		result = arr.Append(op.value)
+	case batchOpDelete:
+		result = target.DeleteByPath(op.path)
+	}
+	if !result.IsValid() {
+		return fmt.Errorf("%s %q: %w", op.kind, op.path, result.Error())
+	}
+	return nil
+}
+
+// copyNodeValues returns v with every node in it, at any depth of maps and
+// slices, replaced by a detached copy, and reports whether there was one.
+// Maps and slices without a node are returned as they are.
+func copyNodeValues(v interface{}) (interface{}, bool) {
+	switch val := v.(type) {
+	case Node:
+		return val.Detach(), true
+	case map[string]interface{}:
+		var copied map[string]interface{}
+		for key, value := range val {
+			if c, ok := copyNodeValues(value); ok {
+				if copied == nil {
+					copied = make(map[string]interface{}, len(val))
+					for k, x := range val {
+						copied[k] = x
+					}
+				}
+				copied[key] = c
+			}
+		}
+		if copied != nil {
+			return copied, true
+		}
+	case []interface{}:
+		var copied []interface{}
+		for i, value := range val {
+			if c, ok := copyNodeValues(value); ok {
+				if copied == nil {
+					copied = append([]interface{}(nil), val...)
+				}
+				copied[i] = c
+			}
+		}
+		if copied != nil {
+			return copied, true
+		}
+	}
+	return v, false
+}
+
+func (k batchOpKind) String() string {
+	switch k {
+	case batchOpSet:
+		return "set"
+	case batchOpAppend:
+		return "append"
+	case batchOpDelete:
+		return "delete"
+	}
+	return "unknown"
+}
@@ -0,0 +1,215 @@
+package xjson
+
+import (
+	"errors"
+	"testing"
+)
+
+const batchDoc = `{ "user": {"name": "ann", "tags": ["a", "b"]}, "count": 1 }`
+
+func TestBatchCommitsAllOperations(t *testing.T) {
+	root, err := Parse(batchDoc)
+	if err != nil {
+		t.Fatalf("Parse failed: %v", err)
+	}
+
+	err = Batch(root, func(tx *Tx) error {
+		if err := tx.Set("/user/name", "bob"); err != nil {
+			return err
+		}
+		if err := tx.Append("/user/tags", "c"); err != nil {
+			return err
+		}
+		if err := tx.Delete("/user/tags[0]"); err != nil {
+			return err
+		}
+		if err := tx.Delete("/count"); err != nil {
+			return err
+		}
+		if got := tx.Query("/user/tags").Strings(); len(got) != 2 || got[0] != "b" || got[1] != "c" {
+			t.Fatalf("staged query should see staged writes, got %v", got)
+		}
+		if root.Get("count").Int() != 1 {
+			t.Fatalf("root must not change before commit")
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("Batch failed: %v", err)
+	}
+
+	if got := root.String(); got != `{ "user": {"name": "bob", "tags": ["b", "c"]} }` {
+		t.Fatalf("unexpected committed document: %s", got)
+	}
+}
+
+func TestBatchRollbackOnError(t *testing.T) {
+	root, err := Parse(batchDoc)
+	if err != nil {
+		t.Fatalf("Parse failed: %v", err)
+	}
+
+	sentinel := errors.New("rejected")
+	err = Batch(root, func(tx *Tx) error {
+		if err := tx.Set("/count", 2); err != nil {
+			return err
+		}
+		if err := tx.Delete("/user/name"); err != nil {
+			return err
+		}
+		return sentinel
+	})
+	if !errors.Is(err, sentinel) {
+		t.Fatalf("expected sentinel error, got %v", err)
+	}
+	if got := root.String(); got != batchDoc {
+		t.Fatalf("expected untouched bytes after rollback, got %s", got)
+	}
+
+	err = Batch(root, func(tx *Tx) error {
+		if err := tx.Set("/count", 3); err != nil {
+			return err
+		}
+		return tx.Delete("/user/missing")
+	})
+	if err == nil {
+		t.Fatalf("expected error deleting a missing key")
+	}
+	if got := root.String(); got != batchDoc {
+		t.Fatalf("expected untouched bytes after failed operation, got %s", got)
+	}
+}
+
+func TestBatchRollbackOnPanic(t *testing.T) {
+	root, err := MustParse(batchDoc)
+	if err != nil {
+		t.Fatalf("MustParse failed: %v", err)
+	}
+	root.Get("user").Set("age", 30)
+	before := root.String()
+
+	func() {
+		defer func() {
+			if r := recover(); r != "boom" {
+				t.Fatalf("expected panic to propagate, got %v", r)
+			}
+		}()
+		_ = Batch(root, func(tx *Tx) error {
+			if err := tx.Set("/user/age", 31); err != nil {
+				return err
+			}
+			panic("boom")
+		})
+	}()
+
+	if got := root.String(); got != before {
+		t.Fatalf("expected %s after panic, got %s", before, got)
+	}
+	if root.Query("/user/age").Int() != 30 {
+		t.Fatalf("expected age to stay 30")
+	}
+}
+
+func TestBatchNestedPathStaging(t *testing.T) {
+	root, err := Parse(`{"a":{"b":{"c":1},"list":[{"v":1},{"v":2}]},"z":true}`)
+	if err != nil {
+		t.Fatalf("Parse failed: %v", err)
+	}
+
+	var leaked *Tx
+	err = Batch(root, func(tx *Tx) error {
+		leaked = tx
+		if err := tx.Set("/a/b/d", "new"); err != nil {
+			return err
+		}
+		if err := tx.Set("/a/list[1]/v", 20); err != nil {
+			return err
+		}
+		if got := tx.Query("/a/b/d").String(); got != "new" {
+			t.Fatalf("expected staged nested key, got %q", got)
+		}
+		if got := tx.Query("/a/list[1]/v").Int(); got != 20 {
+			t.Fatalf("expected staged nested index write, got %d", got)
+		}
+		return tx.Append("/a/b", 1)
+	})
+	if err == nil {
+		t.Fatalf("expected append to an object to fail")
+	}
+	if root.Query("/a/b/d").IsValid() || root.Query("/a/list[1]/v").Int() != 2 {
+		t.Fatalf("expected nested writes to be rolled back, got %s", root.String())
+	}
+	if err := leaked.Set("/z", false); err == nil {
+		t.Fatalf("expected a finished batch to reject writes")
+	}
+
+	err = Batch(root, func(tx *Tx) error {
+		if err := tx.Set("/a/b/d", "new"); err != nil {
+			return err
+		}
+		return tx.Set("/a/list[1]/v", 20)
+	})
+	if err != nil {
+		t.Fatalf("Batch failed: %v", err)
+	}
+	if got := root.String(); got != `{"a":{"b":{"c":1,"d":"new"},"list":[{"v":1},{"v":20}]},"z":true}` {
+		t.Fatalf("unexpected committed document: %s", got)
+	}
+}
+
+func TestBatchNodeValues(t *testing.T) {
+	root, err := Parse(batchDoc)
+	if err != nil {
+		t.Fatalf("Parse failed: %v", err)
+	}
+	extra, err := Parse(`{"id":7}`)
+	if err != nil {
+		t.Fatalf("Parse failed: %v", err)
+	}
+	err = Batch(root, func(tx *Tx) error {
+		if err := tx.Set("/count", 5); err != nil {
+			return err
+		}
+		if err := tx.Set("/extra", extra); err != nil {
+			return err
+		}
+		return tx.Append("/user/tags", map[string]interface{}{"node": extra})
+	})
+	if err != nil {
+		t.Fatalf("Batch with node values failed: %v", err)
+	}
+	want := `{ "user": {"name": "ann", "tags": ["a", "b", {"node":{"id":7}}]}, "count": 5, "extra": {"id":7} }`
+	if got := root.String(); got != want {
+		t.Fatalf("committed document = %s, want %s", got, want)
+	}
+	extra.Set("id", 8)
+	if got := root.Query("/extra/id").Int(); got != 7 {
+		t.Errorf("edit of the node after the batch reached root: %d", got)
+	}
+}
+
+func TestBatchFailedCommitLeavesRootUnchanged(t *testing.T) {
+	root, err := Parse(batchDoc)
+	if err != nil {
+		t.Fatalf("Parse failed: %v", err)
+	}
+	var before string
+	err = Batch(root, func(tx *Tx) error {
+		if err := tx.Set("/count", 5); err != nil {
+			return err
+		}
+		if err := tx.Set("/user/name", "bob"); err != nil {
+			return err
+		}
+		// A write to root itself that the last staged op cannot follow.
+		root.Delete("user")
+		before = root.String()
+		return nil
+	})
+	if err == nil {
+		t.Fatalf("expected the commit to fail")
+	}
+	if got := root.String(); got != before {
+		t.Errorf("failed batch changed root: %s, want %s", got, before)
+	}
+}
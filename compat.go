@@ -0,0 +1,16 @@
+package xjson
+
+import "github.com/474420502/xjson/internal/engine"
+
+// GetCompat evaluates a gjson path such as "friends.#(last==\"Murphy\").first"
+// against doc, so code migrating from gjson can keep its paths. It supports
+// dot paths with \-escaped dots, array indices, # for array length and
+// iteration, and #(...) / #(...)# queries. Modifiers, pipes, multipaths,
+// wildcards in keys, JSON lines and literals return an invalid node whose
+// error names the construct; see the README for the full list. A slash path
+// such as "/friends/1/first" is read as its dot form when that is all it
+// can mean and the path as written matches nothing; otherwise it fails with
+// a Hint pointing at the path syntax.
+func GetCompat(doc Node, path string) Node {
+	return engine.GetCompat(unwrapNode(doc), path)
+}
@@ -0,0 +1,189 @@
+package xjson
+
+import (
+	"encoding/json"
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/tidwall/gjson"
+)
+
+const compatDoc = `{
+  "name": {"first": "Tom", "last": "Anderson"},
+  "age": 37,
+  "children": ["Sara", "Alex", "Jack"],
+  "fav.movie": "Deer Hunter",
+  "friends": [
+    {"first": "Dale", "last": "Murphy", "age": 44, "nets": ["ig", "fb", "tw"], "active": true},
+    {"first": "Roger", "last": "Craig", "age": 68, "nets": ["fb", "tw"], "active": false},
+    {"first": "Jane", "last": "Murphy", "age": 47, "nets": ["ig", "tw"]}
+  ],
+  "nested": {"a.b": {"c": [1, 2, 3]}},
+  "1": "key one",
+  "empty": []
+}`
+
+// assertMatchesGJSON checks that GetCompat finds the same value as gjson.Get.
+func assertMatchesGJSON(t *testing.T, doc Node, raw []byte, path string) {
+	t.Helper()
+	want := gjson.GetBytes(raw, path)
+	got := GetCompat(doc, path)
+	if !want.Exists() {
+		if got.IsValid() {
+			t.Errorf("%s: gjson found nothing, GetCompat returned %s", path, got.String())
+		}
+		return
+	}
+	if !got.IsValid() {
+		t.Errorf("%s: gjson returned %s, GetCompat failed: %v", path, want.Raw, got.Error())
+		return
+	}
+	gotBytes, err := got.Bytes()
+	if err != nil {
+		t.Errorf("%s: Bytes failed: %v", path, err)
+		return
+	}
+	var wantValue, gotValue interface{}
+	if err := json.Unmarshal([]byte(want.Raw), &wantValue); err != nil {
+		t.Fatalf("%s: gjson raw %q: %v", path, want.Raw, err)
+	}
+	if err := json.Unmarshal(gotBytes, &gotValue); err != nil {
+		t.Fatalf("%s: GetCompat bytes %q: %v", path, gotBytes, err)
+	}
+	if !reflect.DeepEqual(wantValue, gotValue) {
+		t.Errorf("%s: GetCompat = %s, gjson = %s", path, gotBytes, want.Raw)
+	}
+}
+
+func TestGetCompatMatchesGJSON(t *testing.T) {
+	paths := []string{
+		"age",
+		"name.last",
+		"children",
+		"children.#",
+		"children.1",
+		"children.5",
+		`fav\.movie`,
+		`nested.a\.b.c.#`,
+		`nested.a\.b.c.2`,
+		"1",
+		"friends.#",
+		"friends.#.first",
+		"friends.#.nets.#",
+		"friends.#.active",
+		"friends.1.last",
+		"friends.#.missing",
+		`friends.#(last=="Murphy").first`,
+		`friends.#(last="Murphy")#.first`,
+		`friends.#(last=="Nobody").first`,
+		`friends.#(last=="Nobody")#`,
+		"friends.#(age>45)#.last",
+		"friends.#(age<=44).first",
+		"friends.#(age!=47)#.first",
+		`friends.#(first%"D*").last`,
+		`friends.#(first!%"D*")#.last`,
+		`friends.#(first%"?a*")#.first`,
+		`friends.#(nets.#(=="fb"))#.first`,
+		`friends.#(active)#.first`,
+		`friends.#(active==true).first`,
+		`friends.#(active==false).first`,
+		`friends.#(age=="44").first`,
+		`children.#(=="Alex")`,
+		`children.#(>"Jack")#`,
+		"empty.#",
+		"empty.#.x",
+		"age.#",
+		"name.#",
+		"name.first.x",
+		"missing.path",
+	}
+	forEachParser(t, compatDoc, func(t *testing.T, doc Node) {
+		for _, path := range paths {
+			assertMatchesGJSON(t, doc, []byte(compatDoc), path)
+		}
+	})
+}
+
+func TestGetCompatMatchesGJSONOnBenchmarkDocument(t *testing.T) {
+	doc, err := Parse(largeJSONData)
+	if err != nil {
+		t.Fatalf("Parse failed: %v", err)
+	}
+	const users = "level1.level2.level3.level4.level5.level6.level7.level8.level9.level10.users"
+	paths := []string{
+		gjsonQueryPath,
+		users + ".#",
+		users + ".#.id",
+		users + ".#.profile.personal.name",
+		users + ".#(id==1).profile.personal.contact.address.home.city",
+		users + ".#(profile.personal.age>=30)#.id",
+		users + ".0.profile.education.degrees.#",
+		users + ".0.profile.education.degrees.#.type",
+		users + ".0.profile.education.degrees.#(gpa>3.85).field",
+		users + `.0.profile.education.degrees.#(type=="Master").institution.rankings.byField`,
+		users + `.0.profile.education.degrees.#(institution.location.campus%"N*")#.year`,
+		users + ".0.profile.education.courses.undergraduate.core.0.details.schedule.days",
+		users + ".0.profile.education.courses.undergraduate.core.#.details.schedule.days.#",
+		users + `.0.profile.personal.contact.address.home.coordinates.elevation.accuracy`,
+		users + ".0.profile.personal.contact.email",
+		users + ".9.id",
+	}
+	for _, path := range paths {
+		assertMatchesGJSON(t, doc, largeJSONData, path)
+	}
+}
+
+func TestGetCompatUnsupportedConstructs(t *testing.T) {
+	doc, err := Parse(compatDoc)
+	if err != nil {
+		t.Fatalf("Parse failed: %v", err)
+	}
+	cases := map[string]string{
+		"children.@reverse":        "modifiers",
+		"@this":                    "modifiers",
+		"children|@reverse":        "pipes",
+		"friends.#(age>40)|0":      "pipes",
+		"{name,age}":               "multipaths",
+		"[name,age]":               "multipaths",
+		"child*":                   "wildcards",
+		"c?ildren.0":               "wildcards",
+		"..0":                      "JSON lines",
+		"!true":                    "literals",
+		"friends.#(active==~true)": "truthiness",
+		"friends.#(age>40":         "unterminated",
+		"name.":                    "ends with a dot",
+		"":                         "empty path",
+	}
+	for path, want := range cases {
+		node := GetCompat(doc, path)
+		if node.IsValid() {
+			t.Errorf("%q: expected an invalid node, got %s", path, node.String())
+			continue
+		}
+		var pathErr *PathError
+		if !errors.As(node.Error(), &pathErr) || pathErr.Op != "GetCompat" {
+			t.Errorf("%q: expected a GetCompat *PathError, got %v", path, node.Error())
+			continue
+		}
+		if !strings.Contains(node.Error().Error(), want) {
+			t.Errorf("%q: error %q does not mention %q", path, node.Error(), want)
+		}
+	}
+}
+
+func TestGetCompatResultsAreDocumentNodes(t *testing.T) {
+	doc, err := Parse(compatDoc)
+	if err != nil {
+		t.Fatalf("Parse failed: %v", err)
+	}
+	GetCompat(doc, `friends.#(last=="Craig")`).Set("last", "Nettles")
+	if got := doc.Query("/friends[1]/last").String(); got != "Nettles" {
+		t.Errorf("write through the first match = %q, want Nettles", got)
+	}
+	names := GetCompat(doc, `friends.#(last=="Murphy")#`)
+	if names.Len() != 2 || names.Index(1).Path() != "/friends[2]" {
+		t.Errorf("matches = %s, second path %q", names.String(), names.Index(1).Path())
+	}
+}
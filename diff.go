@@ -0,0 +1,37 @@
+package xjson
+
+import "github.com/474420502/xjson/internal/engine"
+
+// Difference is one place where two documents differ; see Diff.
+type Difference = engine.Difference
+
+// DiffKind tells whether a Difference is a changed, added or removed value.
+type DiffKind = engine.DiffKind
+
+const (
+	DiffChanged = engine.DiffChanged
+	DiffAdded   = engine.DiffAdded
+	DiffRemoved = engine.DiffRemoved
+)
+
+// Equal reports whether a and b hold the same JSON value. Object key order is
+// ignored, arrays are order-sensitive, numbers compare by value (1 == 1.0 ==
+// 1e0) and strings compare after unescaping. Lazily parsed and fully parsed
+// documents can be compared freely.
+func Equal(a, b Node) bool {
+	return engine.Equal(unwrapNode(a), unwrapNode(b))
+}
+
+// Diff lists every place where b differs from a under the rules of Equal,
+// with the path of the difference and the values on both sides. It returns
+// nil when the documents are equal.
+func Diff(a, b Node) []Difference {
+	return engine.Diff(unwrapNode(a), unwrapNode(b))
+}
+
+func unwrapNode(node Node) Node {
+	if wrapped, ok := node.(nodeWrapper); ok {
+		return wrapped.Node
+	}
+	return node
+}
@@ -0,0 +1,36 @@
+package xjson
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestEqualAndDiffBetweenDocuments(t *testing.T) {
+	lazy, err := Parse(`{"user":{"name":"Ann","scores":[1, 2.0, 3e0]},"active":true}`)
+	if err != nil {
+		t.Fatalf("Parse failed: %v", err)
+	}
+	eager, err := MustParse(`{"active":true,"user":{"scores":[1.0,2,3],"name":"Ann"}}`)
+	if err != nil {
+		t.Fatalf("MustParse failed: %v", err)
+	}
+	if !Equal(lazy, eager) || !lazy.Equals(eager) || Diff(lazy, eager) != nil {
+		t.Fatalf("expected equal documents, got %v", Diff(lazy, eager))
+	}
+
+	eager.Query("/user/scores").Append(4)
+	eager.Set("active", false)
+	if Equal(lazy, eager) {
+		t.Fatal("expected the modified document to differ")
+	}
+	var got []string
+	for _, d := range Diff(lazy, eager) {
+		got = append(got, d.Path+" "+d.Kind.String())
+	}
+	if want := "/user/scores[3] added,/active changed"; strings.Join(got, ",") != want {
+		t.Fatalf("unexpected differences %v, want %s", got, want)
+	}
+	if d := Diff(lazy, eager)[1]; d.Kind != DiffChanged || !d.A.Bool() || d.B.Bool() {
+		t.Fatalf("unexpected change %+v", d)
+	}
+}
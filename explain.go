@@ -0,0 +1,22 @@
+package xjson
+
+import "github.com/474420502/xjson/internal/engine"
+
+// Plan is a query path broken into its steps; see Explain and QueryDebug.
+type Plan = engine.Plan
+
+// PlanStep is one step of a Plan, with its counts once traced.
+type PlanStep = engine.PlanStep
+
+// Explain returns the steps of path without running it, or the error that
+// makes the path invalid.
+func Explain(path string) (Plan, error) {
+	return engine.Explain(path)
+}
+
+// QueryDebug runs path from node like Query and returns, with the result, a
+// Plan recording for every step how many nodes entered it, how many
+// survived and the error it failed with. Plan.String formats it for a log.
+func QueryDebug(node Node, path string) (Node, Plan) {
+	return engine.QueryDebug(unwrapNode(node), path)
+}
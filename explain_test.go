@@ -0,0 +1,34 @@
+package xjson
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestQueryDebugShowsWhereMatchesAreLost(t *testing.T) {
+	root, err := Parse(`{"orders":[{"id":1,"total":20},{"id":2,"total":35}]}`)
+	if err != nil {
+		t.Fatalf("Parse failed: %v", err)
+	}
+	result, plan := QueryDebug(root, "/orders[?(@.total > 50)]/id")
+	if result.MatchCount() != 0 {
+		t.Fatalf("expected no matches, got %d", result.MatchCount())
+	}
+	want := strings.Join([]string{
+		"/orders[?(@.total > 50)]/id",
+		"  1  key     /orders            1 -> 1",
+		"  2  filter  [?(@.total > 50)]  1 -> 0",
+		"  3  key     /id                0 -> 0",
+	}, "\n")
+	if got := plan.String(); got != want {
+		t.Errorf("String() =\n%s\nwant\n%s", got, want)
+	}
+
+	plan, err = Explain("/orders[?(@.total > 50)]/id")
+	if err != nil || len(plan.Steps) != 3 || plan.Steps[1].Op != "filter" {
+		t.Fatalf("Explain = %+v, %v", plan, err)
+	}
+	if strings.Contains(plan.String(), "->") {
+		t.Errorf("an untraced plan should not show counts:\n%s", plan)
+	}
+}
@@ -0,0 +1,60 @@
+package core
+
+import "strconv"
+
+// ArgsPathFunc is a path function registered with RegisterFuncArgs. It
+// receives the literal arguments of a call such as [@below(20)].
+type ArgsPathFunc func(node Node, args ...Arg) Node
+
+// Arg is a literal argument of a path function call. Type is String,
+// Number or Bool and Value the matching string, float64 or bool.
+type Arg struct {
+	Type  NodeType
+	Value interface{}
+}
+
+// NewArg returns the Arg of a string, float64, int or bool value, and
+// false for any other value.
+func NewArg(v interface{}) (Arg, bool) {
+	switch x := v.(type) {
+	case string:
+		return Arg{Type: String, Value: x}, true
+	case float64:
+		return Arg{Type: Number, Value: x}, true
+	case int:
+		return Arg{Type: Number, Value: float64(x)}, true
+	case bool:
+		return Arg{Type: Bool, Value: x}, true
+	}
+	return Arg{}, false
+}
+
+// String returns a string argument, or the literal of any other.
+func (a Arg) String() string {
+	switch v := a.Value.(type) {
+	case string:
+		return v
+	case float64:
+		return strconv.FormatFloat(v, 'g', -1, 64)
+	case bool:
+		return strconv.FormatBool(v)
+	}
+	return ""
+}
+
+// Float returns a number argument, or 0.
+func (a Arg) Float() float64 {
+	f, _ := a.Value.(float64)
+	return f
+}
+
+// Int returns a number argument truncated to an integer, or 0.
+func (a Arg) Int() int {
+	return int(a.Float())
+}
+
+// Bool returns a bool argument, or false.
+func (a Arg) Bool() bool {
+	b, _ := a.Value.(bool)
+	return b
+}
@@ -1,7 +1,11 @@
 package core
 
 import (
+	"context"
 	"errors"
+	"fmt"
+	"io"
+	"net/url"
 	"time"
 )
 
@@ -16,6 +20,9 @@ const (
 	Number
 	Bool
 	Null
+	// MultiMatch is the ResultType of a wildcard, recursive, filter or slice
+	// result. Type never returns it.
+	MultiMatch
 )
 
 // String returns the string representation of the NodeType.
@@ -33,6 +40,8 @@ func (t NodeType) String() string {
 		return "bool"
 	case Null:
 		return "null"
+	case MultiMatch:
+		return "multimatch"
 	default:
 		return "invalid"
 	}
@@ -53,49 +62,590 @@ type TransformFunc func(node Node) interface{}
 // Node represents any element in a JSON structure.
 type Node interface {
 	Type() NodeType
+	// ResultType is Type, except that a wildcard, recursive, filter or slice
+	// result is MultiMatch whatever it matched, where Type calls it an array.
+	ResultType() NodeType
+	// IsString, IsNumber, IsBool, IsNull, IsObject and IsArray report the
+	// ResultType, so a match set is none of them and an invalid node neither.
+	IsString() bool
+	IsNumber() bool
+	IsBool() bool
+	IsNull() bool
+	IsObject() bool
+	IsArray() bool
 	IsValid() bool
+	// Exists reports whether the node, or the query that produced it,
+	// resolved without an error. A query whose wildcard, filter, recursive
+	// descent or slice matched nothing still exists: it yields an empty
+	// match set. A missing key or an index out of bounds does not, and
+	// Error says why.
+	Exists() bool
+	// HasMatches reports whether the node exists and holds something: any
+	// value, or for a match set or slice at least one element. An empty
+	// array from the document is a match of its own.
+	HasMatches() bool
 	Error() error
+	// Hint explains a result that matched nothing when its path looks
+	// written for the other path syntax, slash paths for Query and dot
+	// paths for GetCompat, and is "" otherwise. Error includes it.
+	Hint() string
 	Path() string
+	// PathSegments returns the keys and indices that Path spells out, from
+	// the root of the document to the node. It reports false where Path
+	// ends in /?, for a value whose place is unknown, such as a match set
+	// or the result of a path function.
+	PathSegments() ([]PathSegment, bool)
+	// Position reports where the node starts in the source document. It is
+	// only available for unmodified values of documents parsed with position
+	// tracking enabled.
+	Position() (Position, bool)
 	Raw() string
 	Parent() Node
 	Query(path string) Node
+	// QueryContext is like Query but stops once ctx is done; the result is
+	// then invalid and its error wraps ctx.Err().
+	QueryContext(ctx context.Context, path string) Node
+	// MustQuery is like Query but panics with a *PathError when the path
+	// does not exist or matches nothing.
+	MustQuery(path string) Node
+	// Has reports whether path matches at least one value. It agrees with
+	// Query but stops at the first match where it can.
+	Has(path string) bool
+	// QueryN is like Query but keeps only the first n matches in document
+	// order, and stops a trailing recursive, wildcard or filter step once it
+	// has them.
+	QueryN(path string, n int) Node
+	// QueryFirst returns the first match of path in document order and
+	// stops searching there; it is invalid when nothing matches.
+	QueryFirst(path string) Node
+	// QueryParams is like Query but binds each ? placeholder in the filter
+	// expressions of path to the next argument, quoted as a literal.
+	QueryParams(path string, args ...interface{}) Node
+	// QueryNamed is like QueryParams but binds :name placeholders from
+	// params.
+	QueryNamed(path string, params map[string]interface{}) Node
+	// QueryPath is like Query for a path built in code, see PathSpec. A
+	// path with an invalid step yields an invalid node with its error.
+	QueryPath(path PathSpec) Node
+	// Leaves returns every scalar below the node in document order, the
+	// same values as the query "..*" restricted to non-containers.
+	Leaves() Node
+	// Equals reports whether other holds the same JSON value: key order is
+	// ignored and numbers compare by value.
+	Equals(other Node) bool
+	// ParseEmbedded parses the value of a string node as a new, lazily
+	// parsed JSON document. The path step [@json] does the same.
+	ParseEmbedded() Node
+	// Release ends the life of a document parsed with a node pool; its
+	// nodes report ErrReleased afterwards. It is a no-op otherwise.
+	Release()
+	// Detach returns a deep copy of the node as the root of a new document,
+	// or a match set of copies of the matches. The copy holds no reference
+	// to the source buffer, the nodes or the function map of the original
+	// document, so a small value kept from a large document does not keep
+	// the document alive. It keeps the parse options of the document and the
+	// functions visible from the node. A node that was read lazily stays
+	// lazy; one that was parsed is copied parsed.
+	Detach() Node
+	// Get returns member key of an object. On a wildcard, recursive,
+	// filter or slice result it steps into the matches the way a key step
+	// of Query does: a single match stands for itself, several yield the
+	// match set of the members found, and an empty result fails with
+	// ErrNoMatches.
 	Get(key string) Node
 	Index(i int) Node
+	// HasKey reports what Get(key).IsValid() would: whether the node is an
+	// object with member key. A lazy object answers from its JSON text
+	// without building the member, and a miss allocates nothing. A match
+	// set answers whether any of its matches has the member.
+	HasKey(key string) bool
+	// HasIndex reports what Index(i).IsValid() would for an array or match
+	// set, negative indices counting from the end, without allocating on a
+	// miss.
+	HasIndex(i int) bool
+	// Filter, Map and ForEach pass the children of the node, or the matches
+	// of a match set, to fn as the nodes of the document, so that writes
+	// made through them land in the document.
 	Filter(fn PredicateFunc) Node
 	Map(fn TransformFunc) Node
 	ForEach(fn func(keyOrIndex interface{}, value Node))
+	// ForEachPath is ForEach passing the Path of each value in the
+	// document, so that the matches of /teams[*]/members[*] come with
+	// /teams[2]/members[1] rather than their place in the match set. It
+	// stops when fn returns false.
+	ForEachPath(fn func(path string, value Node) bool)
+	// ForEachSegments is ForEachPath passing the PathSegments of each value,
+	// nil for one whose place is unknown.
+	ForEachSegments(fn func(segments []PathSegment, value Node) bool)
+	// Iter steps through the elements of an array or match set, or the
+	// members of an object in document order, parsing each value only when
+	// Value is called. See Iterator.
+	Iter() Iterator
+	// Metrics counts the values of the node by type and measures its depth
+	// in one pass over its JSON text, without materializing it. Modified
+	// values are measured by their serialized form, so a document gives the
+	// same numbers before and after parsing or editing it back to the same
+	// JSON.
+	Metrics() DocMetrics
+	// Schema describes the keys and value types of the node down to depth
+	// levels below it, from its JSON text like Metrics: depth 0 gives only
+	// its type, and a negative depth has no limit. Scalars are typed by
+	// their first byte without being parsed, and arrays are described by
+	// their first DefaultSchemaSample elements.
+	Schema(depth int) Schema
+	// SchemaWith is Schema sampling arrays as opts asks.
+	SchemaWith(depth int, opts SchemaOptions) Schema
+	// FindValue returns the paths, relative to the node, of every scalar at
+	// or below it that equals value: strings after unescaping, numbers by
+	// value. The paths work with SetByPath, and with Query once prefixed
+	// with "." below the root. The result is never nil.
+	FindValue(value interface{}) []string
+	// FindValueN is FindValue stopping after limit paths; a negative limit
+	// returns all of them.
+	FindValueN(value interface{}, limit int) []string
+	// FindStringContains returns the paths of the string values at or below
+	// the node that contain substr.
+	FindStringContains(substr string) []string
 	Len() int
+	// SortBy returns the elements of an array or match set as a new match
+	// set, stably sorted by the value at the relative path of each one, or
+	// by the elements themselves for an empty path. Numbers compare
+	// numerically and strings lexicographically, whichever the first
+	// element with either has; elements missing the value or holding
+	// another type follow in their original order, also when desc is set.
+	// The document keeps its order.
+	SortBy(path string, desc bool) Node
+	// Unique returns the elements of an array or match set as a new match
+	// set, keeping the first of the elements equal under the rules of
+	// Equal: numbers by value, objects regardless of key order.
+	Unique() Node
+	// First returns the first match of a wildcard, recursive, filter or
+	// slice result. Any other node, a matched array included, is a single
+	// match and returns itself; FirstElement looks into an array. An empty
+	// result yields an invalid node wrapping ErrNoMatches.
+	First() Node
+	// Last is First for the last match.
+	Last() Node
+	// FirstElement returns the first element of an array. A result holding
+	// a single match stands for that match. No match yields an invalid node
+	// wrapping ErrNoMatches, an empty array one wrapping
+	// ErrIndexOutOfBounds, and anything else that is not one array one
+	// wrapping ErrTypeAssertion.
+	FirstElement() Node
+	// LastElement is FirstElement for the last element.
+	LastElement() Node
+	// FilterElements returns, as a new match set, the elements of the array
+	// for which fn returns true, i being the index of each in its array. On
+	// a match set it looks into every match, which must be an array, and
+	// keeps the elements found in the order of the matches; Filter on a
+	// match set keeps or drops whole matches instead. A match that is not
+	// an array yields an invalid node wrapping ErrTypeAssertion.
+	FilterElements(fn func(i int, value Node) bool) Node
+	// MapElements is FilterElements returning the values fn makes of the
+	// elements, converted as by NewNodeFromInterface.
+	MapElements(fn func(i int, value Node) interface{}) Node
+	// MatchCount returns the number of matches of a wildcard, recursive,
+	// filter or slice result. Any other valid node, a matched array
+	// included, counts as one match; an invalid node counts none.
+	MatchCount() int
+	// Value returns the Go value of a single match as Interface converts
+	// it: objects as map[string]interface{}, arrays as []interface{},
+	// strings, bools, numbers written without a fraction or exponent that
+	// fit as int64, other numbers as float64, and JSON null as nil with a
+	// nil error. Several matches yield a []interface{} of their values. An
+	// empty result fails with ErrNoMatches and an invalid node with its
+	// error, so a nil value with a nil error always means null.
+	Value() (interface{}, error)
+	// Values returns the Go value of each match, converted as by Value. The
+	// slice is never nil and its length is MatchCount().
+	Values() []interface{}
+	// MapInterface and SliceInterface convert an object and an array as
+	// Value does, recursively, for code that wants plain Go values such as
+	// text/template. A match set converts to one slice entry per match,
+	// and MapInterface takes a single match that is an object. They fail
+	// with ErrNoMatches for an empty result, the error of an invalid node
+	// or malformed value, and a *TypeError for a value of another type.
+	MapInterface() (map[string]interface{}, error)
+	SliceInterface() ([]interface{}, error)
+	// ToURLValues encodes an object, or the only match that is one, as form
+	// values: a scalar member by its text, with numbers in canonical form,
+	// an array of scalars as one value per element, and a nested object as
+	// opts asks. It fails with a *TypeError for an array holding objects or
+	// arrays and for anything that is not an object, and for several
+	// matches with an error wrapping ErrTypeAssertion.
+	ToURLValues(opts FormOptions) (url.Values, error)
+	// Limit keeps at most n elements of an array or match set.
+	Limit(n int) Node
+	// Offset skips the first n elements of an array or match set.
+	Offset(n int) Node
+	// GroupBy splits the elements of an array or match set by the value at
+	// path in each element. Elements where path matches nothing are left out.
+	GroupBy(path string) (Groups, error)
+	// NumericSummary counts, totals and ranks the numbers among the
+	// elements of an array or match set, skipping the other values.
+	NumericSummary() NumericSummary
+	// Pick keeps only the listed fields of an object, or of every object
+	// in an array or match set. Nested fields are written as "a.b".
+	Pick(fields ...string) Node
+	// Set, Delete and SetValue on the result of a multi-match query, a
+	// slice, Limit or Offset write to every match in the document, or to
+	// none if one match cannot take it.
+	// A Node given as a value to Set and the other writes is attached, and
+	// must be the root of a document of its own; the target of the write or
+	// one of its ancestors fails with ErrCycleDetected.
 	Set(key string, value interface{}) Node
 	Append(value interface{}) Node
+	// AppendAll appends values to an array, converting all of them first: if
+	// any conversion fails the array is left unchanged.
+	AppendAll(values ...interface{}) Node
+	// PrependAll inserts values at the start of an array in order,
+	// converting all of them first like AppendAll.
+	PrependAll(values ...interface{}) Node
+	// InsertAt inserts a value before index. An index equal to Len appends
+	// and a negative index counts from the end.
+	InsertAt(index int, value interface{}) Node
+	// SetIndex replaces the element at index of an array and returns the
+	// array; a negative index counts from the end. On a match set every
+	// match, which must be an array, is written.
+	SetIndex(index int, value interface{}) Node
 	SetValue(value interface{}) Node
+	// DirtyPaths lists the paths of the values written to at or below the
+	// node since parsing or ResetDirty, in the order of the first write.
+	// Each write logs its target, not its ancestors, and a logged value
+	// covers the paths inside it. The paths are in the form Query accepts.
+	DirtyPaths() []string
+	// ResetDirty forgets the writes at or below the node.
+	ResetDirty() Node
+	// RegisterFunc registers a path function in the scope of the node. On
+	// a document root every node of the document sees it; on any other
+	// node, a match set included, only the node and the nodes below it.
 	RegisterFunc(name string, fn UnaryPathFunc) Node
-	CallFunc(name string) Node
+	// RegisterFuncArgs registers a path function that takes arguments, as
+	// in [@below(20)] or [@topk('price', 3)], in the same scope. It replaces
+	// a function of the same name registered either way on the same node.
+	RegisterFuncArgs(name string, fn ArgsPathFunc) Node
+	// CallFunc calls the function registered under name, or a built-in
+	// one, with args. A function registered with RegisterFunc takes none.
+	// The name is looked up on the node, then on its parent and so on up to
+	// the root, so a registration nearer the node shadows the others.
+	CallFunc(name string, args ...Arg) Node
+	// RemoveFunc removes the function registered under name on the node,
+	// leaving those registered on other nodes.
 	RemoveFunc(name string) Node
 	Apply(fn PathFunc) Node
+	// GetFuncs returns the registry of the document, which holds the
+	// functions registered on its root.
 	GetFuncs() *map[string]UnaryPathFunc
 	String() string
+	// Bytes returns the JSON encoding of the node. A match set produced by a
+	// wildcard, recursive or filter query encodes its single match as-is and
+	// several matches as a JSON array; an empty one yields ErrNoMatches.
+	Bytes() ([]byte, error)
+	// WriteTo implements io.WriterTo: it writes the text of Bytes to w
+	// without holding all of it in memory, unmodified subtrees straight
+	// from their source, and returns the first error of w.
+	WriteTo(w io.Writer) (int64, error)
+	// BytesWith is Bytes with values redacted or replaced as opts asks. The
+	// node and its document are left as they were, unparsed parts included.
+	BytesWith(opts SerializeOptions) ([]byte, error)
+	// CanonicalBytes is Bytes in a canonical form for hashing and signing:
+	// keys sorted at every level, no whitespace, normalized numbers and
+	// strings. Nodes that Equal reports equal encode alike, however their
+	// documents were parsed, built or edited.
+	CanonicalBytes() ([]byte, error)
+	// Canonical is the text of CanonicalBytes, or "" on error.
+	Canonical() string
 	MustString() string
 	Float() float64
 	MustFloat() float64
+	// Int and MustInt convert a number that is an integer in the int64
+	// range, such as 42 or 1e3, and fail on any other: 42.7 is not
+	// truncated. IntExact returns why as a *TypeError, and IntRound and
+	// IntFloor round a fractional part half away from zero and down.
 	Int() int64
 	MustInt() int64
+	IntExact() (int64, error)
+	IntRound() int64
+	IntFloor() int64
+	// IntLenient and FloatLenient are Int and Float that also convert a
+	// string holding a JSON number, such as "12.5" or "-3".
+	IntLenient() int64
+	FloatLenient() float64
 	Bool() bool
 	MustBool() bool
+	// Truthy is a lax Bool with JavaScript rules: false, null, 0, "",
+	// "false", "0" and empty containers are false, and so is a missing
+	// path; any other value is true.
+	Truthy() bool
 	Time() time.Time
 	MustTime() time.Time
+	// Array returns the elements of an array in a new slice: changing the
+	// slice leaves the array alone, while the elements are the array's own
+	// nodes. Write with Append, SetIndex, Delete and the like.
 	Array() []Node
 	MustArray() []Node
+	// UnsafeArray is Array without the copy, for reads that cannot afford
+	// one. The slice is the array's own and must not be changed.
+	UnsafeArray() []Node
 	Interface() interface{}
 	RawFloat() (float64, bool)
 	RawString() (string, bool)
+	RawBool() (bool, bool)
+	// RawEscaped returns a string value as written in the source, escape
+	// sequences included and without quotes. It reports false for other
+	// types.
+	RawEscaped() (string, bool)
+	// The Try* accessors return the node's error, or a *TypeError when the
+	// node cannot be converted.
+	TryString() (string, error)
+	TryFloat() (float64, error)
+	TryInt() (int64, error)
+	TryBool() (bool, error)
+	TryTime() (time.Time, error)
+	// Strings returns the String of every value of an array or match set,
+	// or of the node itself. It never fails and never changes the node.
 	Strings() []string
+	// StringsStrict is Strings for values that must all be strings: it
+	// returns the *TypeError of the first one that is not instead.
+	StringsStrict() ([]string, error)
+	// StringsLossy is Strings, named for callers that want to make the
+	// conversion of numbers, bools and null explicit.
+	StringsLossy() []string
 	Keys() []string
 	Contains(value string) bool
+	// ContainsAny reports whether a string value, a string element of an
+	// array or, on a match set, of any match contains one of substrs.
+	ContainsAny(substrs ...string) bool
+	// MatchRegexp reports whether pattern matches one of the strings
+	// ContainsAny looks at; it fails only for an invalid pattern.
+	MatchRegexp(pattern string) (bool, error)
+	// FindAllMatches returns the substrings pattern matches in the strings
+	// ContainsAny looks at; it fails only for an invalid pattern.
+	FindAllMatches(pattern string) ([]string, error)
+	// AsMap returns the members of an object in a new map: changing the map
+	// leaves the object alone, while the values are the object's own nodes.
+	// Write with Set, Delete and the like.
 	AsMap() map[string]Node
 	MustAsMap() map[string]Node
-	// SetByPath sets a value at the specified path, creating intermediate nodes if needed
+	// UnsafeMap is AsMap without the copy, for reads that cannot afford
+	// one. The map is the object's own and must not be changed.
+	UnsafeMap() map[string]Node
+	// LastError returns the error of the last Must* call that failed on the
+	// node while Must* calls return zero values instead of panicking, or of
+	// the last Int or Float that returned 0 in a document parsed with
+	// StrictConversionErrors, or nil.
+	LastError() error
+	// SetByPath sets a value at the specified path. A step before the last
+	// that finds nothing fails with ErrNotFound, and a step meeting a value
+	// of the wrong type fails with ErrPathConflict.
 	SetByPath(path string, value interface{}) Node
+	// SetByPathWith is SetByPath creating missing parents as objects, with
+	// the policy of opts for a step that meets a value of the wrong type.
+	SetByPathWith(path string, value interface{}, opts SetOptions) Node
+	// SetStrict is SetByPath returning only the error, which wraps
+	// ErrNotFound when a parent on the path is missing.
+	SetStrict(path string, value interface{}) error
+	// SetIfAbsent is SetByPathWith writing only where the path finds
+	// nothing, null being something, and reporting whether it wrote.
+	SetIfAbsent(path string, value interface{}) (bool, error)
+	// Replace overwrites the value at the specified path, failing with
+	// ErrNotFound if there is none.
+	Replace(path string, value interface{}) error
+	// Delete removes a key from an object or an index from an array
+	Delete(key string) Node
+	// DeleteByPath removes the value at the specified path
+	DeleteByPath(path string) Node
+	// DeleteAll removes every value path matches, filters and wildcards
+	// included, and returns how many were removed. No match is not an error.
+	DeleteAll(path string) (int, error)
+	// AppendByPath appends values to the array at the specified path
+	AppendByPath(path string, values ...interface{}) Node
+	// InsertByPath inserts a value into the array at the specified path
+	InsertByPath(path string, index int, value interface{}) Node
 }
 
 // ErrTypeAssertion is returned when a Must* conversion fails.
 var ErrTypeAssertion = errors.New("type assertion failed")
+
+// TypeError reports a conversion the node does not support. Err holds the
+// underlying parse error, if any. A TypeError matches ErrTypeAssertion with
+// errors.Is.
+type TypeError struct {
+	Path string
+	Want string
+	Got  NodeType
+	Err  error
+}
+
+func (e *TypeError) Error() string {
+	msg := fmt.Sprintf("cannot convert %s at %s to %s", e.Got, e.Path, e.Want)
+	if e.Err != nil {
+		msg += ": " + e.Err.Error()
+	}
+	return msg
+}
+
+func (e *TypeError) Unwrap() error { return e.Err }
+
+func (e *TypeError) Is(target error) bool { return target == ErrTypeAssertion }
+
+// PathSegment is one step of the path to a value: the key of an object
+// member, or with IsIndex the index of an array element.
+type PathSegment struct {
+	Key     string
+	Index   int
+	IsIndex bool
+}
+
+// KeySegment returns the PathSegment of the member key.
+func KeySegment(key string) PathSegment { return PathSegment{Key: key} }
+
+// IndexSegment returns the PathSegment of the element at index i.
+func IndexSegment(i int) PathSegment { return PathSegment{Index: i, IsIndex: true} }
+
+// PathSpec is a query path built in code, such as the PathBuilder of
+// xjson.Path. String returns the path and Err the error of its first
+// invalid step.
+type PathSpec interface {
+	String() string
+	Err() error
+}
+
+// PathError is the panic value of MustQuery and the Must* conversions, or
+// their LastError when they return zero values instead. Path is the queried
+// path or the path of the converted node; it is empty when the node no
+// longer knows where it came from, such as an invalid node.
+type PathError struct {
+	Path string
+	Op   string
+	Err  error
+}
+
+func (e *PathError) Error() string {
+	if e.Path == "" {
+		return fmt.Sprintf("%s: %v", e.Op, e.Err)
+	}
+	return fmt.Sprintf("%s %s: %v", e.Op, e.Path, e.Err)
+}
+
+func (e *PathError) Unwrap() error { return e.Err }
+
+// Position locates a value in the source document. Line and Column are
+// 1-based and Column counts UTF-8 characters; Offset is the 0-based byte
+// offset.
+type Position struct {
+	Line   int
+	Column int
+	Offset int
+}
+
+// SyntaxError reports malformed JSON and where it was found.
+type SyntaxError struct {
+	Msg string
+	Position
+}
+
+func (e *SyntaxError) Error() string {
+	return fmt.Sprintf("%s at line %d, column %d (offset %d)", e.Msg, e.Line, e.Column, e.Offset)
+}
+
+// PanicError is a panic raised while a query or a registered function ran,
+// recovered into the error of the invalid result. Stack is the stack of the
+// goroutine at the panic.
+type PanicError struct {
+	Value interface{}
+	Stack []byte
+}
+
+func (e *PanicError) Error() string {
+	return fmt.Sprintf("panic: %v", e.Value)
+}
+
+// Unwrap returns the panic value when it is an error.
+func (e *PanicError) Unwrap() error {
+	err, _ := e.Value.(error)
+	return err
+}
+
+// Iterator is returned by Node.Iter:
+//
+//	it := node.Iter()
+//	for it.Next() {
+//		use(it.Key(), it.Value())
+//	}
+//	if err := it.Err(); err != nil { ... }
+//
+// Writing to the iterated array or object itself (Set, Delete, Append,
+// InsertAt or SetValue on one of its values) ends the iteration: Next
+// returns false and Err returns ErrModifiedDuringIteration. Writes inside
+// the values, such as it.Value().Set, are allowed.
+type Iterator interface {
+	// Next advances to the next value and reports whether there is one.
+	Next() bool
+	// Index is the position of the current value, counting from 0.
+	Index() int
+	// Key is the key of the current object member, or "" for arrays.
+	Key() string
+	// Value parses and returns the current value.
+	Value() Node
+	// Err returns the error that ended the iteration, if any: malformed
+	// source found on the way, a modification, or the node's own error.
+	Err() error
+}
+
+// ErrNotInteger is wrapped by the *TypeError of an int conversion of a
+// number with a fractional part.
+var ErrNotInteger = errors.New("number has a fractional part")
+
+// ErrNumberOverflow is wrapped by the *TypeError of a float conversion of a
+// number too large for a float64, such as 1e309, by the error of a write of
+// an infinite float, which no JSON number denotes, and by the error of
+// serializing a JSON5 Infinity or NaN.
+var ErrNumberOverflow = errors.New("number out of float64 range")
+
+// ErrNotFound is wrapped by the *PathError of SetByPath, SetStrict and
+// Replace when a step of the path finds nothing.
+var ErrNotFound = errors.New("not found")
+
+// ErrPathConflict is wrapped by the *PathError of a write by path whose step
+// meets a value of the wrong type: a key step a value that is not an object,
+// or an index step one that is not an array.
+var ErrPathConflict = errors.New("path conflict")
+
+// ErrModifiedDuringIteration is the Err of an Iterator whose array or object
+// was written to during the iteration.
+var ErrModifiedDuringIteration = errors.New("modified during iteration")
+
+// ErrNoMatches is returned by Bytes when a multi-match query matched nothing.
+var ErrNoMatches = errors.New("no matches")
+
+// ErrIndexOutOfBounds is wrapped by the error of an array access, write or
+// insert whose index is outside the array.
+var ErrIndexOutOfBounds = errors.New("index out of bounds")
+
+// ErrReleased is the error of every node of a pooled document after
+// Release.
+var ErrReleased = errors.New("document released")
+
+// ErrStaleResult is wrapped by the error of a node that Set, SetIndex,
+// SetValue or Delete replaced or removed, and of the nodes below it: a
+// handle held from before the write no longer shows the document.
+var ErrStaleResult = errors.New("stale result")
+
+// ErrInvalidParam is wrapped by the error of a QueryParams or QueryNamed
+// call whose arguments do not match the placeholders of the path.
+var ErrInvalidParam = errors.New("invalid query parameter")
+
+// ErrMaxDepthExceeded is wrapped by the error of a recursive query, such as
+// //id or //*, that would descend below the MaxRecursionDepth of its
+// document.
+var ErrMaxDepthExceeded = errors.New("maximum recursion depth exceeded")
+
+// ErrCycleDetected is wrapped by the error of a write whose value is a node
+// that is the target of the write or one of its ancestors, which would make
+// the tree contain itself.
+var ErrCycleDetected = errors.New("cycle detected")
+
+// ErrSpanningEdit is wrapped by the error of a Refresh whose edited bytes cut
+// through the source text of a value without covering it whole.
+var ErrSpanningEdit = errors.New("edit spans more than one value")
@@ -0,0 +1,26 @@
+package core
+
+// FormNesting is how Node.ToURLValues names the members of a nested object.
+type FormNesting int
+
+const (
+	// DottedKeys joins the keys of a nested member with dots: parent.child.
+	DottedKeys FormNesting = iota
+	// BracketKeys writes the key of a nested member in brackets:
+	// parent[child].
+	BracketKeys
+	// ErrorOnNested rejects nested objects.
+	ErrorOnNested
+)
+
+// FormOptions changes how Node.ToURLValues encodes an object.
+type FormOptions struct {
+	// Nesting names the members of nested objects; DottedKeys by default.
+	Nesting FormNesting
+	// IndexArrays writes the elements of an array under key[0], key[1] and
+	// so on instead of repeating key.
+	IndexArrays bool
+	// SkipNulls leaves out null values instead of writing them as empty
+	// strings. Indexed elements keep their index either way.
+	SkipNulls bool
+}
@@ -0,0 +1,120 @@
+package core
+
+import (
+	"math"
+	"sort"
+)
+
+// Groups is the result of GroupBy: the elements of each group as a match
+// set, keyed by the text of the value they were grouped by.
+type Groups map[string]Node
+
+// Keys returns the group keys in sorted order.
+func (g Groups) Keys() []string {
+	keys := make([]string, 0, len(g))
+	for key := range g {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// Count returns the number of elements in each group.
+func (g Groups) Count() map[string]int {
+	counts := make(map[string]int, len(g))
+	for key, set := range g {
+		counts[key] = set.Len()
+	}
+	return counts
+}
+
+// Sum adds up the numbers at path in the elements of each group. An empty
+// path sums the elements themselves. Missing and non-numeric values are
+// skipped, so a group without numbers sums to 0.
+func (g Groups) Sum(path string) map[string]float64 {
+	sums := make(map[string]float64, len(g))
+	for key, nums := range g.numbers(path) {
+		total := 0.0
+		for _, f := range nums {
+			total += f
+		}
+		sums[key] = total
+	}
+	return sums
+}
+
+// Avg returns the mean of the numbers at path in each group, skipping values
+// like Sum. Groups without any number are left out.
+func (g Groups) Avg(path string) map[string]float64 {
+	avgs := make(map[string]float64, len(g))
+	for key, nums := range g.numbers(path) {
+		if len(nums) == 0 {
+			continue
+		}
+		total := 0.0
+		for _, f := range nums {
+			total += f
+		}
+		avgs[key] = total / float64(len(nums))
+	}
+	return avgs
+}
+
+// Min returns the smallest number at path in each group, skipping values
+// like Sum. Groups without any number are left out.
+func (g Groups) Min(path string) map[string]float64 {
+	return g.reduce(path, math.Min)
+}
+
+// Max returns the largest number at path in each group, skipping values
+// like Sum. Groups without any number are left out.
+func (g Groups) Max(path string) map[string]float64 {
+	return g.reduce(path, math.Max)
+}
+
+func (g Groups) reduce(path string, pick func(a, b float64) float64) map[string]float64 {
+	out := make(map[string]float64, len(g))
+	for key, nums := range g.numbers(path) {
+		if len(nums) == 0 {
+			continue
+		}
+		v := nums[0]
+		for _, f := range nums[1:] {
+			v = pick(v, f)
+		}
+		out[key] = v
+	}
+	return out
+}
+
+// elementPath returns path relative to the element it is queried on. Paths
+// read from each element may start with '/', which Query would otherwise
+// evaluate from the root of the document.
+func elementPath(path string) string {
+	if path[0] == '/' && (len(path) == 1 || path[1] != '/') {
+		return "." + path
+	}
+	return path
+}
+
+// numbers collects the numbers at path in the elements of each group.
+func (g Groups) numbers(path string) map[string][]float64 {
+	out := make(map[string][]float64, len(g))
+	for key, set := range g {
+		var nums []float64
+		set.ForEach(func(_ interface{}, elem Node) {
+			value := elem
+			if path != "" {
+				value = elem.Query(elementPath(path))
+			}
+			if value.Type() != Number {
+				return
+			}
+			if f, ok := value.RawFloat(); ok {
+				nums = append(nums, f)
+			}
+		})
+		out[key] = nums
+	}
+	return out
+}
@@ -0,0 +1,28 @@
+package core
+
+// DocMetrics describes the size and shape of a JSON value, see
+// Node.Metrics.
+type DocMetrics struct {
+	// Nodes counts every value, containers included; object keys are not
+	// values.
+	Nodes int
+	// MaxDepth is the depth of the deepest value, where the value measured
+	// is at depth 1, so a scalar or an empty container has depth 1.
+	MaxDepth int
+	Objects  int
+	Arrays   int
+	Strings  int
+	Numbers  int
+	Bools    int
+	Nulls    int
+	// TotalStringBytes adds up the UTF-8 length of every string value after
+	// unescaping. Object keys are not counted.
+	TotalStringBytes int
+	// LargestArrayLen is the length of the longest array and
+	// LargestArrayPath its path relative to the measured value, in the form
+	// Node.Path uses. The first array in document order wins a tie. Both are
+	// zero when there is no array; the path is also empty when the measured
+	// value is the longest array itself.
+	LargestArrayLen  int
+	LargestArrayPath string
+}
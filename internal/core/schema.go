@@ -0,0 +1,32 @@
+package core
+
+// DefaultSchemaSample is the number of leading elements of an array that
+// Node.Schema describes.
+const DefaultSchemaSample = 16
+
+// SchemaOptions changes how Node.SchemaWith describes a value.
+type SchemaOptions struct {
+	// SampleSize is the number of leading elements of each array that are
+	// described; zero or less means DefaultSchemaSample.
+	SampleSize int
+}
+
+// Schema describes the structure of a JSON value, its keys and the types of
+// its values, without the scalar values themselves, see Node.Schema.
+type Schema struct {
+	// Key is the key of a member of an object and Index the index of an
+	// element of an array. Both are zero for the described value itself.
+	Key   string
+	Index int
+	Type  NodeType
+	// Children describes the members of an object in document order, or
+	// the sampled elements of an array, when the depth reaches them. A
+	// repeated key is listed once, with the value the document keeps.
+	Children []Schema
+	// ElementType is the type shared by the elements in Children, and
+	// Mixed is set when they have different types instead. Both are zero
+	// for an object, and for an array without elements or described
+	// without its children.
+	ElementType NodeType
+	Mixed       bool
+}
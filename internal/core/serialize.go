@@ -0,0 +1,24 @@
+package core
+
+// DefaultRedactPlaceholder is the JSON text SerializeOptions writes in place
+// of a redacted value when Placeholder is empty.
+const DefaultRedactPlaceholder = `"[REDACTED]"`
+
+// SerializeOptions changes what Node.BytesWith writes without changing the
+// document.
+type SerializeOptions struct {
+	// Redact lists query paths, relative to the serialized node, whose
+	// values are written as Placeholder. Keys, indices, slices, "*" and
+	// recursive "//key" or "//*" steps are supported, for example
+	// "//password" or "/users[*]/ssn".
+	Redact []string
+	// Placeholder is the JSON text of a redacted value; empty means
+	// DefaultRedactPlaceholder.
+	Placeholder string
+	// Transform, when set, is called for every value that Redact does not
+	// cover, parents before their children, with its path in the form
+	// Node.Path uses. Returning redact writes Placeholder; a non-nil
+	// replacement, a Node or any value Set accepts, is written instead of
+	// the value; nil keeps it. The node is a read-only copy.
+	Transform func(path string, node Node) (replacement interface{}, redact bool)
+}
@@ -0,0 +1,12 @@
+package core
+
+// SetOptions changes what Node.SetByPathWith does when a step of the path
+// meets a value of the wrong type for it.
+type SetOptions struct {
+	// OverwriteConflicts replaces a value in the way of a key step, a
+	// scalar, null or array, with an empty object to write into, instead of
+	// failing with ErrPathConflict. An index step on a value that is not an
+	// array always fails, since writes by path do not create elements, and
+	// the root of a document is never replaced.
+	OverwriteConflicts bool
+}
@@ -0,0 +1,26 @@
+package core
+
+// NumericSummary describes the numbers among the elements of an array or
+// match set, see Node.NumericSummary. Every field but SkippedCount is zero
+// when there is no number.
+type NumericSummary struct {
+	// Count is the number of numeric values summarized and SkippedCount the
+	// number of other values, including numbers outside the float64 range.
+	Count        int
+	SkippedCount int
+	// Sum may be infinite when the values are near the float64 limits; Mean
+	// and StdDev are computed so that they are not.
+	Sum  float64
+	Mean float64
+	Min  float64
+	Max  float64
+	// StdDev is the population standard deviation.
+	StdDev float64
+	// The percentiles use the nearest-rank method: Pn is the smallest value
+	// at least n% of the values are less than or equal to, always one of
+	// the values themselves.
+	P50 float64
+	P90 float64
+	P95 float64
+	P99 float64
+}
@@ -0,0 +1,138 @@
+package engine
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/474420502/xjson/internal/core"
+)
+
+const absoluteDoc = `{
+	"store": {
+		"name": "corner",
+		"books": [
+			{"title": "A", "price": 8, "meta": {"isbn": "a-1", "tags": {"shelf": 3}}},
+			{"title": "B", "price": 12, "meta": {"isbn": "b-2", "tags": {"shelf": 5}}}
+		]
+	},
+	"limits": {"max": 10}
+}`
+
+func TestAbsoluteQueryFromArrayElements(t *testing.T) {
+	for name, parse := range testParsers {
+		t.Run(name, func(t *testing.T) {
+			root, err := parse([]byte(absoluteDoc))
+			if err != nil {
+				t.Fatalf("parse failed: %v", err)
+			}
+			book := root.Get("store").Get("books").Index(1)
+			if got := book.Query("/store/name").String(); got != "corner" {
+				t.Errorf(`Query("/store/name") from an element = %q, want corner`, got)
+			}
+			if got := book.Query("/"); got != root {
+				t.Errorf(`Query("/") from an element = %v, want the root`, got.Path())
+			}
+			if got := book.Query("title").String(); got != "B" {
+				t.Errorf(`Query("title") = %q, want B`, got)
+			}
+			if got := book.Query("./meta/isbn").String(); got != "b-2" {
+				t.Errorf(`Query("./meta/isbn") = %q, want b-2`, got)
+			}
+			if got := book.Query("../[0]/title").String(); got != "A" {
+				t.Errorf(`Query("../[0]/title") = %q, want A`, got)
+			}
+			// The recursive step stays below the node.
+			if got := book.Query("//isbn").Strings(); !reflect.DeepEqual(got, []string{"b-2"}) {
+				t.Errorf(`Query("//isbn") from an element = %v, want [b-2]`, got)
+			}
+			if !book.Has("/limits/max") || book.Has("/title") {
+				t.Errorf("Has should resolve absolute paths from the root")
+			}
+			if got := book.QueryFirst("/store/books[*]/title").String(); got != "A" {
+				t.Errorf("QueryFirst from an element = %q, want A", got)
+			}
+			cq, err := CompileQuery("/limits/max")
+			if err != nil {
+				t.Fatalf("CompileQuery failed: %v", err)
+			}
+			if got := cq.Query(book).Int(); got != 10 {
+				t.Errorf("compiled absolute query from an element = %d, want 10", got)
+			}
+			// Path() is absolute, so it resolves from any node.
+			if got := book.Query(root.Get("limits").Path()).Get("max").Int(); got != 10 {
+				t.Errorf("Query(Path()) from an element = %d, want 10", got)
+			}
+		})
+	}
+}
+
+func TestAbsoluteQueryFromFilterResults(t *testing.T) {
+	root, err := Parse([]byte(absoluteDoc))
+	if err != nil {
+		t.Fatalf("Parse failed: %v", err)
+	}
+	books := root.Query("/store/books")
+	cheap := books.Filter(func(book core.Node) bool {
+		return book.Get("price").Float() < book.Query("/limits/max").Float()
+	})
+	if got := cheap.Query("title").Strings(); !reflect.DeepEqual(got, []string{"A"}) {
+		t.Fatalf("filter comparing against an absolute path = %v, want [A]", got)
+	}
+	match := root.Query("/store/books[?(@.price > 10)]")
+	if got := match.Query("/store/name").String(); got != "corner" {
+		t.Errorf("absolute query on a filter result = %q, want corner", got)
+	}
+	if got := match.Index(0).Query("/store/books[0]/title").String(); got != "A" {
+		t.Errorf("absolute query on a filter match = %q, want A", got)
+	}
+	mapped := books.Map(func(book core.Node) interface{} { return book.Get("title").String() })
+	if got := mapped.Index(0).Query("/limits/max").Int(); got != 10 {
+		t.Errorf("absolute query on a mapped value = %d, want 10", got)
+	}
+}
+
+func TestAbsoluteQueryFromLazyGrandchildren(t *testing.T) {
+	root, err := Parse([]byte(absoluteDoc))
+	if err != nil {
+		t.Fatalf("Parse failed: %v", err)
+	}
+	tags := root.Get("store").Get("books").Index(0).Get("meta").Get("tags")
+	if got := tags.Query("/limits/max").Int(); got != 10 {
+		t.Errorf("absolute query from a lazy grandchild = %d, want 10", got)
+	}
+	// Matches of a raw recursive scan sit in a temporary copy of their
+	// container, which still leads back to the document.
+	isbn := root.QueryFirst("//isbn")
+	if got := isbn.String(); got != "a-1" {
+		t.Fatalf(`QueryFirst("//isbn") = %q, want a-1`, got)
+	}
+	if got := isbn.Query("/store/name").String(); got != "corner" {
+		t.Errorf("absolute query from a recursive match = %q, want corner", got)
+	}
+	shelf := root.Query("//tags").Index(1).Get("shelf")
+	if got := shelf.Query("/store/books[1]/title").String(); got != "B" {
+		t.Errorf("absolute query below a recursive match = %q, want B", got)
+	}
+	if got := shelf.Query("//shelf"); got.IsValid() && got.Len() > 0 {
+		t.Errorf("recursive query below a scalar found %v", got.Strings())
+	}
+}
+
+func TestAbsoluteQueryOnDetachedNode(t *testing.T) {
+	node := NewNodeFromInterface(nil, map[string]interface{}{
+		"store": map[string]interface{}{"name": "standalone"},
+	}, nil)
+	store := node.Get("store")
+	if got := store.Query("/store/name").String(); got != "standalone" {
+		t.Errorf("absolute query below a detached node = %q, want standalone", got)
+	}
+	if got := node.Query("/store/name").String(); got != "standalone" {
+		t.Errorf("absolute query on a detached node = %q, want standalone", got)
+	}
+	if got := store.Query("name").String(); got != "standalone" {
+		t.Errorf("relative query below a detached node = %q, want standalone", got)
+	}
+	if got := store.Query("/name"); got.IsValid() {
+		t.Errorf(`Query("/name") should start at the detached root, got %q`, got.String())
+	}
+}
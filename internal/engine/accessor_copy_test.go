@@ -0,0 +1,80 @@
+package engine
+
+import (
+	"testing"
+
+	"github.com/474420502/xjson/internal/core"
+)
+
+func TestArrayAndAsMapReturnCopies(t *testing.T) {
+	const doc = `{"a":[1,2,3],"o":{"x":1,"y":2}}`
+	for name, parse := range testParsers {
+		root, err := parse([]byte(doc))
+		if err != nil {
+			t.Fatalf("%s: parse failed: %v", name, err)
+		}
+		arr := root.Get("a")
+		elems := arr.Array()
+		elems = append(elems, NewNodeFromInterface(nil, 4, nil))
+		elems[0], elems[2] = elems[2], elems[0]
+		arr.MustArray()[1] = nil
+
+		obj := root.Get("o")
+		members := obj.AsMap()
+		delete(members, "x")
+		members["z"] = NewNodeFromInterface(nil, 3, nil)
+		delete(obj.MustAsMap(), "y")
+
+		if got := root.String(); got != doc {
+			t.Errorf("%s: document = %s, want %s", name, got, doc)
+		}
+		if arr.Len() != 3 || obj.Len() != 2 {
+			t.Errorf("%s: Len() = %d and %d, want 3 and 2", name, arr.Len(), obj.Len())
+		}
+		if got := root.Query("/a[-1]").Int(); got != 3 {
+			t.Errorf("%s: /a[-1] = %d, want 3", name, got)
+		}
+		if got := root.Query("/a[0]").Int(); got != 1 {
+			t.Errorf("%s: /a[0] = %d, want 1", name, got)
+		}
+		if !root.Query("/o/x").IsValid() || root.Query("/o/z").IsValid() {
+			t.Errorf("%s: /o/x and /o/z should follow the object, not the copy", name)
+		}
+		var seen []int64
+		arr.ForEach(func(_ interface{}, v core.Node) { seen = append(seen, v.Int()) })
+		if len(seen) != 3 || seen[0] != 1 || seen[2] != 3 {
+			t.Errorf("%s: ForEach saw %v, want [1 2 3]", name, seen)
+		}
+		if len(root.DirtyPaths()) != 0 {
+			t.Errorf("%s: changing the copies logged %q", name, root.DirtyPaths())
+		}
+
+		// The copies share the nodes: a write through one is a write.
+		arr.Array()[1].SetValue(20)
+		obj.AsMap()["y"].SetValue(true)
+		want := `{"a":[1,20,3],"o":{"x":1,"y":true}}`
+		if got := root.String(); got != want {
+			t.Errorf("%s: after writes through the copies = %s, want %s", name, got, want)
+		}
+	}
+}
+
+func TestUnsafeAccessors(t *testing.T) {
+	root, _ := Parse([]byte(`{"a":[1,2],"o":{"x":1},"s":"v"}`))
+	elems := root.Get("a").UnsafeArray()
+	if len(elems) != 2 || &elems[0] != &root.Get("a").UnsafeArray()[0] {
+		t.Error("UnsafeArray should return the array's own slice")
+	}
+	if members := root.Get("o").UnsafeMap(); len(members) != 1 || members["x"] != root.Get("o").Get("x") {
+		t.Errorf("UnsafeMap = %v, want the object's members", members)
+	}
+	if root.Get("s").UnsafeArray() != nil || root.Get("s").UnsafeMap() != nil {
+		t.Error("UnsafeArray and UnsafeMap of a string should be nil")
+	}
+	if got := len(root.Get("a").Array()); got != 2 {
+		t.Errorf("len(Array()) = %d, want 2", got)
+	}
+	if got := NewArray().Array(); got == nil || len(got) != 0 {
+		t.Errorf("Array() of an empty array = %#v, want an empty slice", got)
+	}
+}
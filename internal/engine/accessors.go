@@ -0,0 +1,213 @@
+package engine
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+	"time"
+
+	"github.com/474420502/xjson/internal/core"
+)
+
+// typeError builds the error of a Try* accessor that cannot convert node.
+func typeError(node core.Node, want string, err error) *core.TypeError {
+	return &core.TypeError{Path: displayPath(node), Want: want, Got: node.Type(), Err: err}
+}
+
+func (n *baseNode) RawBool() (bool, bool) {
+	if b, ok := n.selfOrMe().(*boolNode); ok {
+		return b.value, true
+	}
+	return false, false
+}
+
+// StringsStrict returns the values of an array or match set of strings, or
+// of a string node. It returns the error of the node, or the *TypeError of
+// the first value that is not a string, and leaves the node as it was.
+func (n *baseNode) StringsStrict() ([]string, error) {
+	self := n.selfOrMe()
+	if err := self.Error(); err != nil {
+		return nil, err
+	}
+	if self.Type() != core.Array {
+		s, err := self.TryString()
+		if err != nil {
+			return nil, err
+		}
+		return []string{s}, nil
+	}
+	elems := self.UnsafeArray()
+	res := make([]string, 0, len(elems))
+	for _, elem := range elems {
+		s, err := elem.TryString()
+		if err != nil {
+			return nil, err
+		}
+		res = append(res, s)
+	}
+	return res, nil
+}
+
+// StringsLossy returns Strings: every value as its String, so numbers keep
+// their literal, bools are "true" or "false", null is "null" to keep the
+// positions of the values, and objects and arrays are JSON text.
+func (n *baseNode) StringsLossy() []string {
+	return n.selfOrMe().Strings()
+}
+
+func (n *baseNode) TryString() (string, error) {
+	self := n.selfOrMe()
+	if err := self.Error(); err != nil {
+		return "", err
+	}
+	if s, ok := self.(*stringNode); ok {
+		if value, ok := s.RawString(); ok {
+			return value, nil
+		}
+	}
+	return "", typeError(self, "string", nil)
+}
+
+// TryFloat returns the value of a number. One too large for a float64 fails
+// with a *core.TypeError wrapping core.ErrNumberOverflow; one too small
+// underflows to zero without an error. The non-finite numbers of JSON5, see
+// ParseOptions.AllowNonFinite, are ±Inf and NaN.
+func (n *baseNode) TryFloat() (float64, error) {
+	self := n.selfOrMe()
+	if err := self.Error(); err != nil {
+		return 0, err
+	}
+	if _, ok := self.(*numberNode); !ok {
+		return 0, typeError(self, "float", nil)
+	}
+	f, err := strconv.ParseFloat(self.Raw(), 64)
+	if math.IsInf(f, 0) && errors.Is(err, strconv.ErrRange) {
+		// The strconv range error is kept for callers that test for it.
+		return 0, typeError(self, "float", fmt.Errorf("%w: %w", core.ErrNumberOverflow, err))
+	}
+	if err != nil && !errors.Is(err, strconv.ErrRange) {
+		return 0, typeError(self, "float", err)
+	}
+	return f, nil
+}
+
+// TryInt is IntExact.
+func (n *baseNode) TryInt() (int64, error) { return n.IntExact() }
+
+// conversionFailed records the *core.TypeError of a lax conversion op of n
+// that failed, wrapping err, for LastError when the document of n was
+// parsed with StrictConversionErrors. Invalid nodes keep reporting their
+// own error.
+func (n *baseNode) conversionFailed(op, want string, err error) {
+	if n.err != nil || !rootBase(n).strictConversions {
+		return
+	}
+	self := n.selfOrMe()
+	n.lastErr.Store(mustError(self, op, typeError(self, want, err)))
+}
+
+// conversionZero calls n.conversionFailed and returns the zero value of T.
+func conversionZero[T any](n *baseNode, op, want string, err error) T {
+	n.conversionFailed(op, want, err)
+	var zero T
+	return zero
+}
+
+// numericString returns the text of a string node holding a JSON number.
+func numericString(node core.Node) (string, bool) {
+	if _, ok := node.(*stringNode); !ok || !node.IsValid() {
+		return "", false
+	}
+	s, _ := node.RawString()
+	return s, isJSONNumber(s)
+}
+
+// IntLenient is Int that also converts strings holding a JSON number, such
+// as "42" or "-7"; like a number, "12.5" has no int value.
+func (n *baseNode) IntLenient() int64 {
+	self := n.selfOrMe()
+	s, ok := numericString(self)
+	if !ok {
+		return self.Int()
+	}
+	i, err := intOf(s, intExact)
+	if err != nil {
+		n.conversionFailed("IntLenient", "int", err)
+	}
+	return i
+}
+
+// FloatLenient is Float that also converts strings holding a JSON number,
+// such as "12.5" or "-1e3".
+func (n *baseNode) FloatLenient() float64 {
+	self := n.selfOrMe()
+	s, ok := numericString(self)
+	if !ok {
+		return self.Float()
+	}
+	f, err := strconv.ParseFloat(s, 64)
+	if err != nil && !errors.Is(err, strconv.ErrRange) {
+		n.conversionFailed("FloatLenient", "float", err)
+	}
+	return f
+}
+
+// Truthy reports whether the node is true in the JavaScript sense: false,
+// null, 0, "" and empty arrays and objects are false, and so are the
+// strings "false" and "0"; everything else, "true" and "1" included, is
+// true. Other strings are true whatever they say, so "no" and "False" are
+// true. A match set is judged by its only match when it has one, and an
+// invalid node, such as a missing path, is false. Unlike Float, Truthy never
+// records a conversion error.
+func (n *baseNode) Truthy() bool {
+	self := n.selfOrMe()
+	if self.Error() != nil {
+		return false
+	}
+	if arr, ok := self.(*arrayNode); ok && arr.matchSet && len(arr.value) == 1 {
+		return arr.value[0].Truthy()
+	}
+	switch self.Type() {
+	case core.Bool:
+		return self.Bool()
+	case core.Number:
+		f, _ := strconv.ParseFloat(self.Raw(), 64)
+		return f != 0
+	case core.String:
+		s, _ := self.RawString()
+		return s != "" && s != "false" && s != "0"
+	case core.Object, core.Array:
+		return self.Len() > 0
+	}
+	return false
+}
+
+func (n *baseNode) TryBool() (bool, error) {
+	self := n.selfOrMe()
+	if err := self.Error(); err != nil {
+		return false, err
+	}
+	if b, ok := self.RawBool(); ok {
+		return b, nil
+	}
+	return false, typeError(self, "bool", nil)
+}
+
+// TryTime parses a string node as RFC 3339 like Time, without recording a
+// parse failure on the node.
+func (n *baseNode) TryTime() (time.Time, error) {
+	self := n.selfOrMe()
+	s, err := self.TryString()
+	if err != nil {
+		if _, ok := err.(*core.TypeError); ok {
+			return time.Time{}, typeError(self, "time", nil)
+		}
+		return time.Time{}, err
+	}
+	t, err := time.Parse(time.RFC3339Nano, s)
+	if err != nil {
+		return time.Time{}, typeError(self, "time", err)
+	}
+	return t, nil
+}
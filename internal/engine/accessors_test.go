@@ -0,0 +1,360 @@
+package engine
+
+import (
+	"errors"
+	"reflect"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/474420502/xjson/internal/core"
+)
+
+const accessorDoc = `{"s":"text","when":"2024-05-01T10:00:00Z","bad_when":"soon","i":42,"f":1.5,"big":1e400,"b":true,"n":null,"o":{},"a":[]}`
+
+func TestTryAccessorsPerNodeType(t *testing.T) {
+	root, err := Parse([]byte(accessorDoc))
+	if err != nil {
+		t.Fatalf("Parse failed: %v", err)
+	}
+
+	if v, err := root.Get("s").TryString(); err != nil || v != "text" {
+		t.Fatalf("TryString = %q, %v", v, err)
+	}
+	if v, err := root.Get("i").TryInt(); err != nil || v != 42 {
+		t.Fatalf("TryInt = %d, %v", v, err)
+	}
+	if v, err := root.Get("i").TryFloat(); err != nil || v != 42 {
+		t.Fatalf("TryFloat on int = %v, %v", v, err)
+	}
+	if v, err := root.Get("f").TryFloat(); err != nil || v != 1.5 {
+		t.Fatalf("TryFloat = %v, %v", v, err)
+	}
+	if v, err := root.Get("b").TryBool(); err != nil || !v {
+		t.Fatalf("TryBool = %v, %v", v, err)
+	}
+	want := time.Date(2024, 5, 1, 10, 0, 0, 0, time.UTC)
+	if v, err := root.Get("when").TryTime(); err != nil || !v.Equal(want) {
+		t.Fatalf("TryTime = %v, %v", v, err)
+	}
+	if v, ok := root.Get("b").RawBool(); !ok || !v {
+		t.Fatalf("RawBool = %v, %v", v, ok)
+	}
+	for _, key := range []string{"s", "i", "n", "o", "a"} {
+		if _, ok := root.Get(key).RawBool(); ok {
+			t.Fatalf("expected RawBool on %q to report false", key)
+		}
+	}
+
+	mismatches := []struct {
+		key  string
+		want string
+		call func(core.Node) error
+	}{
+		{"i", "string", func(n core.Node) error { _, err := n.TryString(); return err }},
+		{"s", "int", func(n core.Node) error { _, err := n.TryInt(); return err }},
+		{"b", "float", func(n core.Node) error { _, err := n.TryFloat(); return err }},
+		{"n", "bool", func(n core.Node) error { _, err := n.TryBool(); return err }},
+		{"i", "time", func(n core.Node) error { _, err := n.TryTime(); return err }},
+		{"o", "string", func(n core.Node) error { _, err := n.TryString(); return err }},
+		{"a", "int", func(n core.Node) error { _, err := n.TryInt(); return err }},
+	}
+	for _, tc := range mismatches {
+		node := root.Get(tc.key)
+		err := tc.call(node)
+		var typeErr *core.TypeError
+		if !errors.As(err, &typeErr) {
+			t.Fatalf("%s on %q: expected *core.TypeError, got %v", tc.want, tc.key, err)
+		}
+		if typeErr.Path != "/"+tc.key || typeErr.Want != tc.want || typeErr.Got != node.Type() {
+			t.Fatalf("%s on %q: unexpected error %+v", tc.want, tc.key, typeErr)
+		}
+		if !errors.Is(err, core.ErrTypeAssertion) {
+			t.Fatalf("%s on %q: expected error to match ErrTypeAssertion", tc.want, tc.key)
+		}
+	}
+}
+
+func TestTryAccessorsReportParseFailures(t *testing.T) {
+	root, err := Parse([]byte(accessorDoc))
+	if err != nil {
+		t.Fatalf("Parse failed: %v", err)
+	}
+
+	_, err = root.Get("f").TryInt()
+	if !errors.Is(err, core.ErrNotInteger) || !errors.Is(err, core.ErrTypeAssertion) {
+		t.Fatalf("expected TryInt on 1.5 to wrap ErrNotInteger, got %v", err)
+	}
+	if _, err := root.Get("big").TryFloat(); !errors.Is(err, strconv.ErrRange) {
+		t.Fatalf("expected TryFloat on 1e400 to report a range error, got %v", err)
+	}
+	bad := root.Get("bad_when")
+	var parseErr *time.ParseError
+	if _, err := bad.TryTime(); !errors.As(err, &parseErr) {
+		t.Fatalf("expected TryTime to wrap *time.ParseError, got %v", err)
+	}
+	if bad.Error() != nil {
+		t.Fatalf("expected TryTime to leave the node valid, got %v", bad.Error())
+	}
+}
+
+func TestTryAccessorsReturnNodeError(t *testing.T) {
+	root, err := Parse([]byte(accessorDoc))
+	if err != nil {
+		t.Fatalf("Parse failed: %v", err)
+	}
+	missing := root.Query("/nope/deeper")
+	checks := []func() error{
+		func() error { _, err := missing.TryString(); return err },
+		func() error { _, err := missing.TryFloat(); return err },
+		func() error { _, err := missing.TryInt(); return err },
+		func() error { _, err := missing.TryBool(); return err },
+		func() error { _, err := missing.TryTime(); return err },
+	}
+	for i, check := range checks {
+		err := check()
+		var typeErr *core.TypeError
+		if err == nil || errors.As(err, &typeErr) || err.Error() != missing.Error().Error() {
+			t.Fatalf("check %d: expected the node's own error %v, got %v", i, missing.Error(), err)
+		}
+	}
+}
+
+func TestStringsStrictAndLossy(t *testing.T) {
+	root, err := Parse([]byte(`{"tags":["a","b\n"],"mixed":["a",1.50,true,null,{"k":1},[2]],"s":"x","i":7}`))
+	if err != nil {
+		t.Fatalf("Parse failed: %v", err)
+	}
+
+	tags := root.Get("tags")
+	if got, err := tags.StringsStrict(); err != nil || !reflect.DeepEqual(got, []string{"a", "b\n"}) {
+		t.Fatalf("StringsStrict = %q, %v", got, err)
+	}
+	if got, err := root.Get("s").StringsStrict(); err != nil || !reflect.DeepEqual(got, []string{"x"}) {
+		t.Fatalf("StringsStrict on a string = %q, %v", got, err)
+	}
+
+	mixed := root.Get("mixed")
+	got, err := mixed.StringsStrict()
+	var typeErr *core.TypeError
+	if got != nil || !errors.As(err, &typeErr) || typeErr.Path != "/mixed[1]" || typeErr.Got != core.Number {
+		t.Fatalf("StringsStrict on a mixed array = %q, %v", got, err)
+	}
+	if mixed.Error() != nil || !mixed.IsValid() {
+		t.Fatalf("StringsStrict changed the error of the array: %v", mixed.Error())
+	}
+	if _, err := root.Get("i").StringsStrict(); !errors.Is(err, core.ErrTypeAssertion) {
+		t.Fatalf("StringsStrict on a number = %v", err)
+	}
+	if _, err := root.Get("missing").StringsStrict(); err == nil {
+		t.Fatal("expected the error of an invalid node")
+	}
+
+	want := []string{"a", "1.50", "true", "null", `{"k":1}`, "[2]"}
+	if got := mixed.StringsLossy(); !reflect.DeepEqual(got, want) {
+		t.Fatalf("StringsLossy = %q, want %q", got, want)
+	}
+	if got := mixed.Strings(); !reflect.DeepEqual(got, want) {
+		t.Fatalf("Strings = %q, want %q", got, want)
+	}
+	if mixed.Error() != nil || root.Error() != nil {
+		t.Fatalf("StringsLossy changed the error state: %v, %v", mixed.Error(), root.Error())
+	}
+	if got := mixed.Index(0).String(); got != "a" {
+		t.Fatalf("array unusable after the accessors: %q", got)
+	}
+	if got := root.Get("missing").StringsLossy(); got != nil {
+		t.Fatalf("StringsLossy on an invalid node = %q", got)
+	}
+
+	matches := root.Query("/tags[*]")
+	if got, err := matches.StringsStrict(); err != nil || !reflect.DeepEqual(got, []string{"a", "b\n"}) {
+		t.Fatalf("StringsStrict on a match set = %q, %v", got, err)
+	}
+}
+
+func TestLenientConversions(t *testing.T) {
+	root, err := Parse([]byte(`{"s":"12.5","i":"42","neg":"-7","negf":"-1.5e2","abc":"abc","sp":" 3","n":-3,"f":12.5,"b":true,"z":null}`))
+	if err != nil {
+		t.Fatalf("Parse failed: %v", err)
+	}
+	cases := []struct {
+		key      string
+		int      int64
+		float    float64
+		laxInt   int64
+		laxFloat float64
+	}{
+		{"s", 0, 12.5, 0, 0},
+		{"i", 42, 42, 0, 0},
+		{"neg", -7, -7, 0, 0},
+		{"negf", -150, -150, 0, 0},
+		{"abc", 0, 0, 0, 0},
+		{"sp", 0, 0, 0, 0},
+		{"n", -3, -3, -3, -3},
+		{"f", 0, 12.5, 0, 12.5},
+		{"b", 0, 0, 0, 0},
+		{"z", 0, 0, 0, 0},
+	}
+	for _, tc := range cases {
+		n := root.Get(tc.key)
+		if got := n.IntLenient(); got != tc.int {
+			t.Errorf("%s: IntLenient() = %d, want %d", tc.key, got, tc.int)
+		}
+		if got := n.FloatLenient(); got != tc.float {
+			t.Errorf("%s: FloatLenient() = %v, want %v", tc.key, got, tc.float)
+		}
+		if n.Int() != tc.laxInt || n.Float() != tc.laxFloat {
+			t.Errorf("%s: Int() = %d, Float() = %v, want %d, %v", tc.key, n.Int(), n.Float(), tc.laxInt, tc.laxFloat)
+		}
+		if err := n.LastError(); err != nil {
+			t.Errorf("%s: LastError() = %v without StrictConversionErrors", tc.key, err)
+		}
+	}
+}
+
+func TestStrictConversionErrors(t *testing.T) {
+	doc := []byte(`{"price":"12.5","name":"abc","neg":"-7","n":-3,"f":12.5,"big":99999999999999999999,"ok":true,"items":[{"p":"x"}]}`)
+	root, err := ParseWithOptions(doc, ParseOptions{StrictConversionErrors: true})
+	if err != nil {
+		t.Fatalf("ParseWithOptions failed: %v", err)
+	}
+
+	failing := []struct {
+		name string
+		node core.Node
+		call func(core.Node)
+		op   string
+	}{
+		{"Float of a numeric string", root.Get("price"), func(n core.Node) { n.Float() }, "Float"},
+		{"Int of a string", root.Get("name"), func(n core.Node) { n.Int() }, "Int"},
+		{"Int of a bool", root.Get("ok"), func(n core.Node) { n.Int() }, "Int"},
+		{"Int of a fraction", root.Get("f"), func(n core.Node) { n.Int() }, "Int"},
+		{"Int of a large number", root.Get("big"), func(n core.Node) { n.Int() }, "Int"},
+		{"IntLenient of a fraction string", root.Get("price"), func(n core.Node) { n.IntLenient() }, "IntLenient"},
+		{"FloatLenient of abc", root.Get("name"), func(n core.Node) { n.FloatLenient() }, "Float"},
+		{"Float of a nested match", root.Query("/items[*]/p"), func(n core.Node) { n.Index(0).Float() }, ""},
+	}
+	for _, tc := range failing {
+		tc.call(tc.node)
+		target := tc.node
+		if tc.op == "" {
+			target = tc.node.Index(0)
+		}
+		err := target.LastError()
+		var pathErr *core.PathError
+		var typeErr *core.TypeError
+		if !errors.As(err, &pathErr) || !errors.As(err, &typeErr) {
+			t.Errorf("%s: LastError() = %v, want a *PathError wrapping a *TypeError", tc.name, err)
+			continue
+		}
+		if tc.op != "" && pathErr.Op != tc.op {
+			t.Errorf("%s: Op = %q, want %q", tc.name, pathErr.Op, tc.op)
+		}
+	}
+	if err := root.Query("/items[*]/p").Index(0).LastError(); err == nil || !strings.Contains(err.Error(), "/items[0]/p") {
+		t.Errorf("nested error %v should name the path", err)
+	}
+
+	neg, n := root.Get("neg"), root.Get("n")
+	if neg.IntLenient() != -7 || n.Int() != -3 || n.Float() != -3 {
+		t.Errorf("negative conversions: %d, %d, %v", neg.IntLenient(), n.Int(), n.Float())
+	}
+	if neg.LastError() != nil || n.LastError() != nil {
+		t.Errorf("LastError() = %v, %v after conversions that worked", neg.LastError(), n.LastError())
+	}
+	if f := root.Get("price").FloatLenient(); f != 12.5 {
+		t.Errorf("FloatLenient() = %v, want 12.5", f)
+	}
+	if n := root.Get("missing"); n.Int() != 0 || n.LastError() != nil {
+		t.Errorf("an invalid node should keep its own error, got LastError %v", n.LastError())
+	}
+}
+
+func TestTruthy(t *testing.T) {
+	const doc = `{"t":true,"f":false,"n":null,` +
+		`"zero":0,"negzero":-0,"zerof":0.0,"zeroexp":0e5,"tiny":1e-400,"one":1,"neg":-2,"frac":0.5,"huge":1e400,` +
+		`"empty":"","strue":"true","sfalse":"false","s1":"1","s0":"0","sFalse":"False","sno":"no","sspace":" ","s00":"00","snull":"null",` +
+		`"obj":{},"fullobj":{"a":0},"arr":[],"fullarr":[0],"flags":[{"on":1},{"on":"0"}]}`
+	cases := map[string]bool{
+		"t": true, "f": false, "n": false,
+		"zero": false, "negzero": false, "zerof": false, "zeroexp": false, "tiny": false,
+		"one": true, "neg": true, "frac": true, "huge": true,
+		"empty": false, "strue": true, "sfalse": false, "s1": true, "s0": false,
+		"sFalse": true, "sno": true, "sspace": true, "s00": true, "snull": true,
+		"obj": false, "fullobj": true, "arr": false, "fullarr": true,
+	}
+	forEachParser(t, doc, func(t *testing.T, root core.Node) {
+		for key, want := range cases {
+			if got := root.Get(key).Truthy(); got != want {
+				t.Errorf("Truthy() of %s = %v, want %v", key, got, want)
+			}
+		}
+		if !root.Truthy() {
+			t.Errorf("a non-empty document should be truthy")
+		}
+
+		// A match set is judged by its only match, and is otherwise an array.
+		matchCases := map[string]bool{
+			"/flags[0]/on":         true,
+			"/flags[1]/on":         false,
+			"/flags[*]/on":         true,
+			"/flags[?(@.on == 2)]": false,
+			"/flags[*]/off":        false,
+		}
+		for path, want := range matchCases {
+			if got := root.Query(path).Truthy(); got != want {
+				t.Errorf("Truthy() of %s = %v, want %v", path, got, want)
+			}
+		}
+		if root.Query("/flags[*]/on").Filter(func(n core.Node) bool { return n.Raw() == `"0"` }).Truthy() {
+			t.Errorf("a match set of one falsy value should be falsy")
+		}
+	})
+
+	// Built values follow the same rules.
+	built := map[interface{}]bool{
+		nil: false, true: true, false: false, 0: false, 0.0: false, int64(3): true, -1.5: true,
+		"": false, "0": false, "1": true, "false": false, "true": true, "x": true,
+	}
+	for v, want := range built {
+		if got := NewNodeFromInterface(nil, v, nil).Truthy(); got != want {
+			t.Errorf("Truthy() of built %#v = %v, want %v", v, got, want)
+		}
+	}
+	if NewNodeFromInterface(nil, []interface{}{}, nil).Truthy() || NewNodeFromInterface(nil, map[string]interface{}{}, nil).Truthy() {
+		t.Error("empty built containers should be falsy")
+	}
+	if !NewNodeFromInterface(nil, []interface{}{false}, nil).Truthy() {
+		t.Error("a built array holding false should be truthy")
+	}
+}
+
+func TestTruthyOfInvalidNodes(t *testing.T) {
+	root, err := ParseWithOptions([]byte(`{"a":{"b":"true"},"s":"x"}`), ParseOptions{StrictConversionErrors: true})
+	if err != nil {
+		t.Fatalf("ParseWithOptions failed: %v", err)
+	}
+	stale := root.Get("a")
+	root.Set("a", 1)
+	invalid := map[string]core.Node{
+		"missing key":   root.Get("nope"),
+		"missing path":  root.Query("/x/y/z"),
+		"bad query":     root.Query("/a[?("),
+		"index of":      root.Get("s").Index(3),
+		"stale handle":  stale,
+		"stale child":   stale.Get("b"),
+		"invalid built": NewNodeFromInterface(nil, struct{}{}, nil),
+	}
+	for name, n := range invalid {
+		if n.Truthy() {
+			t.Errorf("%s: an invalid node should be falsy", name)
+		}
+	}
+	s := root.Get("s")
+	s.Truthy()
+	if err := s.LastError(); err != nil {
+		t.Errorf("Truthy should not record a conversion error, got %v", err)
+	}
+}
@@ -0,0 +1,89 @@
+package engine
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestArrayLenCountsRawElements(t *testing.T) {
+	testCases := []struct {
+		raw  string
+		want int
+	}{
+		{`[]`, 0},
+		{"[ \n\t]", 0},
+		{`[1]`, 1},
+		{`[1, 2 ,3]`, 3},
+		{`[[1,2],[3,[4,5]],[]]`, 3},
+		{`["a,b", "c]d", "e\"f,", "g\\", "h"]`, 5},
+		{`[{"k":[1,2],"s":"x,y}"}, {"k":{}}, null, true, -1.5e3]`, 5},
+		{"[1, 2, 3]\n  \t", 3},
+	}
+	for _, tc := range testCases {
+		root, err := Parse([]byte(`{"a":` + tc.raw + `}`))
+		if err != nil {
+			t.Fatalf("Parse(%s) failed: %v", tc.raw, err)
+		}
+		arr := root.Get("a").(*arrayNode)
+		if got := arr.Len(); got != tc.want {
+			t.Fatalf("Len(%s) = %d, want %d", tc.raw, got, tc.want)
+		}
+		if arr.parsed.Load() {
+			t.Fatalf("Len(%s) parsed the array", tc.raw)
+		}
+		if got := len(arr.Array()); got != tc.want {
+			t.Fatalf("Array(%s) has %d elements, want %d", tc.raw, got, tc.want)
+		}
+	}
+
+	if count, ok := countRawElements([]byte("[1, 2, 3]\n  ")); !ok || count != 3 {
+		t.Fatalf("expected trailing whitespace to be ignored, got %d %v", count, ok)
+	}
+	for _, raw := range []string{`[1,]`, `[,1]`, `[1 2]`, `[1,2`, `{"a":1}`, `["x]`} {
+		if _, ok := countRawElements([]byte(raw)); ok {
+			t.Fatalf("expected %s to be rejected", raw)
+		}
+	}
+}
+
+func TestArrayLenAfterPartialParseAndWrites(t *testing.T) {
+	root, err := Parse([]byte(`{"a":[{"v":1},{"v":2},{"v":3}]}`))
+	if err != nil {
+		t.Fatalf("Parse failed: %v", err)
+	}
+	arr := root.Get("a")
+	if got := arr.Index(0).Get("v").Int(); got != 1 {
+		t.Fatalf("unexpected first element %d", got)
+	}
+	if got := arr.Len(); got != 3 {
+		t.Fatalf("expected 3 after a partial parse, got %d", got)
+	}
+	arr.Append(4)
+	if got := arr.Len(); got != 4 {
+		t.Fatalf("expected 4 after Append, got %d", got)
+	}
+
+	bad, err := Parse([]byte(`{"a":[1,,2]}`))
+	if err != nil {
+		t.Fatalf("Parse failed: %v", err)
+	}
+	badArr := bad.Get("a")
+	if got := badArr.Len(); got != 0 || badArr.Error() == nil {
+		t.Fatalf("expected a malformed array to report an error, got len %d err %v", got, badArr.Error())
+	}
+}
+
+func TestArrayLenDoesNotAllocate(t *testing.T) {
+	raw := "[" + strings.Repeat(`{"id":1,"tags":["a","b"],"msg":"x, y"},`, 1000) + `{"id":2}]`
+	root, err := Parse([]byte(`{"logs":` + raw + `}`))
+	if err != nil {
+		t.Fatalf("Parse failed: %v", err)
+	}
+	logs := root.Get("logs")
+	if got := logs.Len(); got != 1001 {
+		t.Fatalf("expected 1001 elements, got %d", got)
+	}
+	if allocs := testing.AllocsPerRun(10, func() { logs.Len() }); allocs != 0 {
+		t.Fatalf("expected Len on a raw array to be allocation-free, got %v allocs", allocs)
+	}
+}
@@ -12,6 +12,14 @@ type arrayNode struct {
 	baseNode
 	value   []core.Node
 	isDirty bool
+	// mods counts writes to the elements, so iterators notice them.
+	mods uint64
+	// matchSet marks synthetic arrays holding the results of a multi-match
+	// query step rather than an array value from the document.
+	matchSet bool
+	// selection marks arrays holding a slice of the elements of another,
+	// made by a slice step, Limit or Offset.
+	selection bool
 }
 
 func (n *arrayNode) Type() core.NodeType { return core.Array }
@@ -20,10 +28,63 @@ func (n *arrayNode) Len() int {
 	if n.err != nil {
 		return 0
 	}
+	if !n.parsed.Load() && !n.isDirty && len(n.raw) > 0 {
+		if count, ok := countRawElements(n.raw); ok {
+			return count
+		}
+	}
 	n.lazyParse()
 	return len(n.value)
 }
 
+// countRawElements counts the top-level elements of a raw array without
+// creating nodes. It reports false for malformed input so the caller can
+// fall back to a full parse, which records the syntax error.
+func countRawElements(raw []byte) (int, bool) {
+	pos := skipRawWhitespace(raw, 0)
+	if pos >= len(raw) || raw[pos] != '[' {
+		return 0, false
+	}
+	pos = skipRawWhitespace(raw, pos+1)
+	if pos < len(raw) && raw[pos] == ']' {
+		return 0, skipRawWhitespace(raw, pos+1) == len(raw)
+	}
+	count := 0
+	for pos < len(raw) {
+		end := rawValueEnd(raw, pos)
+		if end < pos {
+			return 0, false
+		}
+		count++
+		pos = skipRawWhitespace(raw, end+1)
+		if pos >= len(raw) {
+			break
+		}
+		switch raw[pos] {
+		case ',':
+			pos = skipRawWhitespace(raw, pos+1)
+		case ']':
+			// Text after a root array is left to the full parse.
+			return count, skipRawWhitespace(raw, pos+1) == len(raw)
+		default:
+			return 0, false
+		}
+	}
+	return 0, false
+}
+
+func skipRawWhitespace(raw []byte, pos int) int {
+	for pos < len(raw) {
+		switch raw[pos] {
+		case ' ', '\t', '\n', '\r':
+			pos++
+		default:
+			return pos
+		}
+	}
+	return pos
+}
+
 func (n *arrayNode) Index(i int) core.Node {
 	if n.err != nil {
 		return n
@@ -35,7 +96,7 @@ func (n *arrayNode) Index(i int) core.Node {
 		if i >= 0 && i < len(n.value) {
 			return n.value[i]
 		}
-		return newInvalidNode(fmt.Errorf("index out of bounds: %d", i))
+		return n.scoped(newInvalidNode(fmt.Errorf("%w: %d", core.ErrIndexOutOfBounds, i)))
 	}
 	// 如果是负索引，先完整解析以确保长度
 	if i < 0 {
@@ -49,7 +110,76 @@ func (n *arrayNode) Index(i int) core.Node {
 	if i >= 0 && i < len(n.value) {
 		return n.value[i]
 	}
-	return newInvalidNode(fmt.Errorf("index out of bounds: %d", i))
+	return n.scoped(newInvalidNode(fmt.Errorf("%w: %d", core.ErrIndexOutOfBounds, i)))
+}
+
+// HasIndex reports whether Index(i) holds an element, parsing no further
+// than Index does.
+func (n *arrayNode) HasIndex(i int) bool {
+	if n.err != nil {
+		return false
+	}
+	if !n.parsed.Load() && len(n.raw) > 0 {
+		if i < 0 {
+			n.lazyParse()
+		} else {
+			n.lazyParseIndex(i)
+		}
+	}
+	if i < 0 {
+		i = len(n.value) + i
+	}
+	return i >= 0 && i < len(n.value)
+}
+
+// Get looks up key in the matches of a wildcard, recursive, filter or slice
+// result, the way a key step of a query does: a single match stands for
+// itself, and several yield the match set of the members found. An array
+// has no keys.
+func (n *arrayNode) Get(key string) core.Node {
+	if n.err != nil {
+		return n
+	}
+	matches, ok := matchList(n)
+	if !ok {
+		return n.baseNode.Get(key)
+	}
+	switch len(matches) {
+	case 0:
+		return n.scoped(newInvalidNode(&core.PathError{Path: n.Path(), Op: "Get", Err: core.ErrNoMatches}))
+	case 1:
+		return matches[0].Get(key)
+	}
+	var results []core.Node
+	for _, m := range matches {
+		if m.IsValid() && m.Type() == core.Object {
+			if res := m.Get(key); res.IsValid() {
+				results = append(results, res)
+			}
+		}
+	}
+	if len(results) == 0 {
+		return n.scoped(newInvalidNode(fmt.Errorf("key '%s' not found in any match", key)))
+	}
+	return newMatchSet(n, results, n.funcs)
+}
+
+// HasKey reports whether Get(key) finds a member: for a match set or slice,
+// whether any match has key. An array has no keys.
+func (n *arrayNode) HasKey(key string) bool {
+	if n.err != nil {
+		return false
+	}
+	matches, ok := matchList(n)
+	if !ok {
+		return false
+	}
+	for _, m := range matches {
+		if m.HasKey(key) {
+			return true
+		}
+	}
+	return false
 }
 
 func (n *arrayNode) lazyParseIndex(idx int) {
@@ -103,56 +233,57 @@ func (n *arrayNode) lazyParseIndex(idx int) {
 		n.value = make([]core.Node, 0)
 	}
 
-	curIndex := len(n.value)
+	// Elements before len(n.value) were materialized by an earlier call;
+	// they are skipped, not parsed again.
+	curIndex := 0
 	for pos < len(raw) {
 		skipWS()
 		if pos >= len(raw) {
 			break
 		}
 		if raw[pos] == ']' {
+			if skipRawWhitespace(raw, pos+1) < len(raw) {
+				// The full parse reports the text after the array.
+				n.mu.Unlock()
+				n.lazyParse()
+				return
+			}
 			n.parsed.Store(true)
 			n.mu.Unlock()
 			return
 		}
 
 		elemStart := pos
-		var elemEnd int
-		switch raw[pos] {
-		case '{':
-			elemEnd = findMatchingBrace(raw, pos)
-		case '[':
-			elemEnd = findMatchingBracket(raw, pos)
-		case '"':
-			elemEnd = findMatchingQuote(raw, pos)
-		default:
-			elemEnd = findValueEnd(raw, pos)
-		}
+		elemEnd := rawValueEnd(raw, pos)
 		if elemEnd == -1 {
 			n.mu.Unlock()
 			n.lazyParse()
 			return
 		}
 
-		segment := raw[elemStart : elemEnd+1]
-		p := newParser(segment, n.funcs)
-		child := p.doParse(n)
-		if child == nil || !child.IsValid() {
-			if child != nil {
-				n.err = child.Error()
-				n.mu.Unlock()
-			} else {
-				n.mu.Unlock()
-				n.lazyParse()
+		if curIndex >= len(n.value) {
+			segment := raw[elemStart : elemEnd+1]
+			p := newParser(segment, n.funcs)
+			p.arena = n.arena
+			p.lenient = documentLeniency(&n.baseNode)
+			child := p.doParse(n)
+			if child == nil || !child.IsValid() {
+				if child != nil {
+					n.err = relocateSyntaxError(&n.baseNode, segment, child.Error())
+					n.mu.Unlock()
+				} else {
+					n.mu.Unlock()
+					n.lazyParse()
+				}
+				return
 			}
-			return
-		}
-		if bn, ok := child.(*baseNode); ok {
-			bn.parent = n
-		} else if inode, ok := child.(interface{ setParent(core.Node) }); ok {
-			inode.setParent(n)
+			if bn, ok := child.(*baseNode); ok {
+				bn.parent = n
+			} else if inode, ok := child.(interface{ setParent(core.Node) }); ok {
+				inode.setParent(n)
+			}
+			n.value = append(n.value, child)
 		}
-		n.value = append(n.value, child)
-
 		if curIndex == idx {
 			n.mu.Unlock()
 			return
@@ -163,9 +294,16 @@ func (n *arrayNode) lazyParseIndex(idx int) {
 		skipWS()
 		if pos < len(raw) && raw[pos] == ',' {
 			pos++
+			skipWS()
+			if pos < len(raw) && raw[pos] == ']' && !documentLeniency(&n.baseNode).trailingCommas {
+				// The full parse reports the trailing comma.
+				n.mu.Unlock()
+				n.lazyParse()
+				return
+			}
 			continue
 		}
-		if pos < len(raw) && raw[pos] == ']' {
+		if pos < len(raw) && raw[pos] == ']' && skipRawWhitespace(raw, pos+1) == len(raw) {
 			n.parsed.Store(true)
 			n.mu.Unlock()
 			return
@@ -183,7 +321,11 @@ func (n *arrayNode) ForEach(fn func(keyOrIndex interface{}, value core.Node)) {
 		return
 	}
 	n.lazyParse()
-	for i, v := range n.value {
+	values := n.value
+	if n.matchSet {
+		values = n.documentMatches()
+	}
+	for i, v := range values {
 		fn(i, v)
 	}
 }
@@ -192,6 +334,9 @@ func (n *arrayNode) Set(key string, value interface{}) core.Node {
 	if n.err != nil {
 		return n
 	}
+	if n.matchSet || n.selection {
+		return n.setMatches(key, value)
+	}
 	n.lazyParse()
 	idx, err := strconv.Atoi(key)
 	if err != nil {
@@ -204,24 +349,148 @@ func (n *arrayNode) Set(key string, value interface{}) core.Node {
 
 	if idx >= 0 && idx < len(n.value) {
 		n.isDirty = true
+		n.mods++
+		markAncestorNodesDirty(n.parent)
 		if tryMutateScalarNode(n.value[idx], value) {
 			// Clear query cache since we're modifying the node
 			n.baseNode.clearQueryCache()
+			n.logIndexEdit(idx)
 			return n
 		}
 		child := NewNodeFromInterface(n, value, n.funcs)
 		if !child.IsValid() {
-			n.setError(child.Error())
-			return n
+			return newInvalidNode(child.Error())
 		}
+		detach(n.value[idx])
 		n.value[idx] = child
+		n.logIndexEdit(idx)
 
 		// Clear query cache since we're modifying the node
 		n.baseNode.clearQueryCache()
 	} else {
-		return newInvalidNode(fmt.Errorf("index out of bounds for set: %d", idx))
+		return newInvalidNode(fmt.Errorf("%w for set: %d", core.ErrIndexOutOfBounds, idx))
+	}
+
+	return n
+}
+
+// SetIndex replaces the element at index, counting from the end when
+// negative, and returns the array. Unlike Set, the value is converted
+// before anything is written, so an unsupported value returns an invalid
+// node and leaves the array unchanged, as an index outside it does.
+func (n *arrayNode) SetIndex(index int, value interface{}) core.Node {
+	if n.err != nil {
+		return n
+	}
+	if n.matchSet || n.selection {
+		return n.setIndexMatches(index, value)
+	}
+	n.lazyParse()
+	if n.err != nil {
+		return n
+	}
+	idx := index
+	if idx < 0 {
+		idx = len(n.value) + idx
+	}
+	if idx < 0 || idx >= len(n.value) {
+		return newInvalidNode(fmt.Errorf("%w for set: %d", core.ErrIndexOutOfBounds, index))
+	}
+	if !tryMutateScalarNode(n.value[idx], value) {
+		child := NewNodeFromInterface(n, value, n.funcs)
+		if !child.IsValid() {
+			return newInvalidNode(child.Error())
+		}
+		detach(n.value[idx])
+		n.value[idx] = child
+	}
+	n.isDirty = true
+	n.mods++
+	markAncestorNodesDirty(n.parent)
+	n.baseNode.clearQueryCache()
+	n.logIndexEdit(idx)
+	return n
+}
+
+// Limit returns the first limit elements without copying them. On a raw
+// array only those elements are parsed.
+func (n *arrayNode) Limit(limit int) core.Node {
+	if n.err != nil {
+		return n
+	}
+	if limit < 0 {
+		return newInvalidNode(fmt.Errorf("negative limit: %d", limit))
+	}
+	if limit > 0 {
+		n.lazyParseIndex(limit - 1)
+	}
+	if limit > len(n.value) {
+		limit = len(n.value)
+	}
+	return n.window(0, limit)
+}
+
+// Offset returns the elements after the first offset ones without copying
+// them. An offset past the end yields an empty result.
+func (n *arrayNode) Offset(offset int) core.Node {
+	if n.err != nil {
+		return n
+	}
+	if offset < 0 {
+		return newInvalidNode(fmt.Errorf("negative offset: %d", offset))
+	}
+	n.lazyParse()
+	if offset > len(n.value) {
+		offset = len(n.value)
+	}
+	return n.window(offset, len(n.value))
+}
+
+// window returns the elements in [start, end) sharing the underlying nodes.
+// A window over a match set is itself a match set.
+func (n *arrayNode) window(start, end int) core.Node {
+	out := NewArrayNode(n, nil, n.funcs).(*arrayNode)
+	out.value = n.value[start:end:end]
+	out.isDirty = true
+	out.matchSet = n.matchSet
+	out.selection = true
+	return out
+}
+
+// Delete removes the element at the index given by key; negative indices count
+// from the end. Later elements shift down by one. On a match set, or on the
+// result of a slice step, Limit or Offset, key is deleted from every match
+// instead.
+func (n *arrayNode) Delete(key string) core.Node {
+	if n.err != nil {
+		return n
+	}
+	if n.matchSet || n.selection {
+		return n.deleteMatches(key)
+	}
+	n.lazyParse()
+	idx, err := strconv.Atoi(key)
+	if err != nil {
+		return newInvalidNode(fmt.Errorf("invalid index for array delete: %s", key))
+	}
+	if idx < 0 {
+		idx = len(n.value) + idx
+	}
+	if idx < 0 || idx >= len(n.value) {
+		return newInvalidNode(fmt.Errorf("%w for delete: %d", core.ErrIndexOutOfBounds, idx))
+	}
+	n.isDirty = true
+	n.mods++
+	markAncestorNodesDirty(n.parent)
+	n.baseNode.clearQueryCache()
+	if idx == len(n.value)-1 {
+		n.logIndexEdit(idx)
+	} else {
+		n.logSelfEdit()
 	}
 
+	detach(n.value[idx])
+	n.value = append(n.value[:idx:idx], n.value[idx+1:]...)
 	return n
 }
 
@@ -234,80 +503,247 @@ func (n *arrayNode) Append(value interface{}) core.Node {
 	if n.err != nil {
 		return n
 	}
+	if ok, err := n.spliceRaw("append", []interface{}{value}, false); ok {
+		if err != nil {
+			return newInvalidNode(err)
+		}
+		return n
+	}
 	n.lazyParse()
 	n.isDirty = true // Mark as dirty so String() will regenerate
+	n.mods++
 
 	// Also mark all ancestors as dirty to ensure String() regeneration
-	current := n.parent
-	for current != nil {
-		if obj, ok := current.(*objectNode); ok {
-			obj.isDirty = true
-			current = obj.parent
-		} else if arr, ok := current.(*arrayNode); ok {
-			arr.isDirty = true
-			current = arr.parent
-		} else {
-			break
-		}
-	}
+	markAncestorNodesDirty(n.parent)
 
 	// Clear query cache since we're modifying the node
 	n.baseNode.clearQueryCache()
 
 	child := NewNodeFromInterface(n, value, n.funcs)
 	if !child.IsValid() {
-		n.setError(child.Error())
-		return n
+		return newInvalidNode(child.Error())
 	}
 	n.value = append(n.value, child)
+	n.logIndexEdit(len(n.value) - 1)
+	return n
+}
+
+// AppendAll appends values in order with a single grow of the backing slice.
+// An array that has not been parsed takes them into its source and stays
+// unparsed, see spliceRaw.
+// Every value is converted before the array is touched, so one that cannot be
+// converted leaves the array unchanged and the error is returned instead.
+func (n *arrayNode) AppendAll(values ...interface{}) core.Node {
+	if n.err != nil {
+		return n
+	}
+	if ok, err := n.spliceRaw("append", values, false); ok {
+		if err != nil {
+			return newInvalidNode(err)
+		}
+		return n
+	}
+	children := make([]core.Node, len(values))
+	for i, value := range values {
+		child := NewNodeFromInterface(n, value, n.funcs)
+		if !child.IsValid() {
+			return newInvalidNode(fmt.Errorf("append value %d: %w", i, child.Error()))
+		}
+		children[i] = child
+	}
+	n.lazyParse()
+	if n.err != nil {
+		return n
+	}
+	n.isDirty = true
+	n.mods++
+	markAncestorNodesDirty(n.parent)
+	n.baseNode.clearQueryCache()
+
+	for i := range children {
+		n.logIndexEdit(len(n.value) + i)
+	}
+	n.value = append(n.value, children...)
 	return n
 }
 
+// InsertAt inserts value before the element at index; later elements shift up
+// by one. An index equal to Len appends and a negative index counts from the
+// end. An index outside the array returns ErrIndexOutOfBounds and leaves the
+// array unchanged.
+func (n *arrayNode) InsertAt(index int, value interface{}) core.Node {
+	if n.err != nil {
+		return n
+	}
+	n.lazyParse()
+	if n.err != nil {
+		return n
+	}
+	idx := index
+	if idx < 0 {
+		idx = len(n.value) + idx
+	}
+	if idx < 0 || idx > len(n.value) {
+		return newInvalidNode(fmt.Errorf("%w for insert: %d", core.ErrIndexOutOfBounds, index))
+	}
+	child := NewNodeFromInterface(n, value, n.funcs)
+	if !child.IsValid() {
+		return newInvalidNode(child.Error())
+	}
+	n.isDirty = true
+	n.mods++
+	markAncestorNodesDirty(n.parent)
+	n.baseNode.clearQueryCache()
+	if idx == len(n.value) {
+		n.logIndexEdit(idx)
+	} else {
+		n.logSelfEdit()
+	}
+
+	n.value = append(n.value, nil)
+	copy(n.value[idx+1:], n.value[idx:])
+	n.value[idx] = child
+	return n
+}
+
+// Array returns a copy of the elements, so that a caller appending to or
+// reordering the slice cannot put it out of step with the array.
 func (n *arrayNode) Array() []core.Node {
 	if n.err != nil {
 		return nil
 	}
 	n.lazyParse()
-	if n.value == nil {
-		return []core.Node{}
-	}
-	return n.value
+	return append([]core.Node{}, n.value...)
 }
 
 func (n *arrayNode) MustArray() []core.Node {
 	if n.err != nil {
-		panic(n.err)
+		n.mustFail(mustError(n, "MustArray", n.err))
+		return nil
+	}
+	n.lazyParse()
+	return append([]core.Node{}, n.value...)
+}
+
+// UnsafeArray returns the elements without copying them.
+func (n *arrayNode) UnsafeArray() []core.Node {
+	if n.err != nil {
+		return nil
 	}
 	n.lazyParse()
+	if n.value == nil {
+		return []core.Node{}
+	}
 	return n.value
 }
 
 func (n *arrayNode) String() string {
+	n.checkMatches()
 	if n.err != nil {
 		return ""
 	}
-	n.lazyParse()
-	// 如果未修改并且存在原始数据，则返回原始数据
-	if !n.isDirty && n.Raw() != "" {
-		return n.Raw()
+	if n.matchSet {
+		// A match set renders like Bytes: one match stands for itself and an
+		// empty set has no text.
+		switch len(n.value) {
+		case 0:
+			return ""
+		case 1:
+			return n.value[0].String()
+		}
 	}
+	data, err := n.text()
+	if err != nil || finiteText(&n.baseNode, data) != nil {
+		return ""
+	}
+	return string(data)
+}
 
-	var buf bytes.Buffer
-	buf.WriteByte('[')
-	for i, v := range n.value {
-		if i > 0 {
-			// 在每个元素之间插入逗号
-			buf.WriteByte(',')
+// text returns the encoding of the array, which is its source while it is
+// unmodified and must then not be changed. Unlike Bytes it keeps the
+// non-finite numbers of a document parsed with AllowNonFinite, and it
+// encodes a match set of one or no matches as an array.
+func (n *arrayNode) text() ([]byte, error) {
+	if n.err != nil {
+		return nil, n.err
+	}
+	// 如果未修改并且存在原始数据，则直接返回原始数据，无需解析
+	if n.isPristine() {
+		return n.RawBytes(), nil
+	}
+	buf := newSpliceBuffer(n.RawBytes())
+	n.writeJSON(buf)
+	if n.err != nil {
+		return nil, n.err
+	}
+	return buf.Bytes(), nil
+}
+
+// isPristine reports whether the array still matches its source bytes: it
+// has not been written to and none of its cached elements has been either.
+func (n *arrayNode) isPristine() bool {
+	if n.err != nil || n.isDirty || len(n.raw) == 0 {
+		return false
+	}
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	for _, child := range n.value {
+		if isDirtyContainer(child) {
+			return false
 		}
-		// 将每个元素转换为字符串并添加到缓冲区
-		buf.WriteString(v.String())
 	}
-	buf.WriteByte(']')
-	// 返回构建好的字符串表示
-	return buf.String()
+	return true
+}
+
+// isEmptyMatchSet reports whether node is a wildcard, recursive or filter
+// result that matched nothing.
+func isEmptyMatchSet(node core.Node) bool {
+	arr, ok := node.(*arrayNode)
+	return ok && arr.matchSet && len(arr.value) == 0
+}
+
+// HasMatches reports whether a match set or a slice holds any element; an
+// array from the document is a match of its own even when it is empty.
+func (n *arrayNode) HasMatches() bool {
+	n.checkMatches()
+	if n.err != nil {
+		return false
+	}
+	if n.matchSet || n.selection {
+		return n.Len() > 0
+	}
+	return true
+}
+
+// Bytes encodes the array. For a match set a single match is encoded on its
+// own and an empty set reports core.ErrNoMatches. An unmodified array returns
+// a copy of its source bytes without parsing them; a modified one keeps the
+// source text of everything that was not written to.
+func (n *arrayNode) Bytes() ([]byte, error) {
+	n.checkMatches()
+	if n.err != nil {
+		return nil, n.err
+	}
+	if n.matchSet {
+		switch len(n.value) {
+		case 0:
+			return nil, core.ErrNoMatches
+		case 1:
+			return n.value[0].Bytes()
+		}
+	}
+	data, err := n.text()
+	if err == nil {
+		err = finiteText(&n.baseNode, data)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return bytes.Clone(data), nil
 }
 
 func (n *arrayNode) Interface() interface{} {
+	n.checkMatches()
 	if n.err != nil {
 		return nil
 	}
@@ -337,8 +773,10 @@ func (n *arrayNode) lazyParse() {
 	defer n.parsed.Store(true)
 
 	p := newParser(n.raw, n.funcs)
-	// start from the beginning of raw to parse the array
-	p.pos = 0
+	p.arena = n.arena
+	p.lenient = documentLeniency(&n.baseNode)
+	// start at the bracket; a root keeps the space around it in raw
+	p.pos = skipSpace(n.raw, 0)
 	// For root node, pass nil as parent to avoid setting root as its own parent
 	var parent core.Node
 	if n.parent != nil {
@@ -346,6 +784,10 @@ func (n *arrayNode) lazyParse() {
 	}
 	parsedNode := p.parseArray(parent)
 	if err := parsedNode.Error(); err != nil {
+		n.err = relocateSyntaxError(&n.baseNode, n.raw, err)
+		return
+	}
+	if err := p.checkEnd(); err != nil {
 		n.err = err
 		return
 	}
@@ -353,7 +795,13 @@ func (n *arrayNode) lazyParse() {
 	// copy values and reparent children to this node
 	if cast, ok := parsedNode.(*arrayNode); ok {
 		vals := make([]core.Node, 0, len(cast.value))
-		for _, child := range cast.value {
+		for i, child := range cast.value {
+			// Keep elements handed out before the full parse; they may have
+			// been modified already.
+			if i < len(n.value) {
+				vals = append(vals, n.value[i])
+				continue
+			}
 			if bn, ok := child.(*baseNode); ok {
 				bn.parent = n
 			} else if inode, ok := child.(interface{ setParent(core.Node) }); ok {
@@ -435,7 +883,9 @@ func (n *arrayNode) lazyParsePath(path []string) {
 		n.value = make([]core.Node, 0)
 	}
 
-	curIndex := len(n.value)
+	// Elements before len(n.value) were materialized by an earlier call;
+	// they are skipped, not parsed again.
+	curIndex := 0
 	for pos < len(raw) {
 		skipWS()
 		if pos >= len(raw) {
@@ -443,6 +893,12 @@ func (n *arrayNode) lazyParsePath(path []string) {
 		}
 		if raw[pos] == ']' {
 			// end of array
+			if skipRawWhitespace(raw, pos+1) < len(raw) {
+				// The full parse reports the text after the array.
+				n.mu.Unlock()
+				n.lazyParse()
+				return
+			}
 			n.parsed.Store(true)
 			n.mu.Unlock()
 			return
@@ -450,45 +906,38 @@ func (n *arrayNode) lazyParsePath(path []string) {
 
 		// determine element end
 		elemStart := pos
-		var elemEnd int
-		switch raw[pos] {
-		case '{':
-			elemEnd = findMatchingBrace(raw, pos)
-		case '[':
-			elemEnd = findMatchingBracket(raw, pos)
-		case '"':
-			elemEnd = findMatchingQuote(raw, pos)
-		default:
-			elemEnd = findValueEnd(raw, pos)
-		}
+		elemEnd := rawValueEnd(raw, pos)
 		if elemEnd == -1 {
 			n.mu.Unlock()
 			n.lazyParse()
 			return
 		}
 
-		// parse this element
-		segment := raw[elemStart : elemEnd+1]
-		p := newParser(segment, n.funcs)
-		child := p.doParse(n)
-		if child == nil || !child.IsValid() {
-			if child != nil {
-				n.err = child.Error()
-				n.mu.Unlock()
-			} else {
-				n.mu.Unlock()
-				n.lazyParse()
+		if curIndex >= len(n.value) {
+			// parse this element
+			segment := raw[elemStart : elemEnd+1]
+			p := newParser(segment, n.funcs)
+			p.arena = n.arena
+			p.lenient = documentLeniency(&n.baseNode)
+			child := p.doParse(n)
+			if child == nil || !child.IsValid() {
+				if child != nil {
+					n.err = relocateSyntaxError(&n.baseNode, segment, child.Error())
+					n.mu.Unlock()
+				} else {
+					n.mu.Unlock()
+					n.lazyParse()
+				}
+				return
 			}
-			return
-		}
-		// set proper parent
-		if bn, ok := child.(*baseNode); ok {
-			bn.parent = n
-		} else if inode, ok := child.(interface{ setParent(core.Node) }); ok {
-			inode.setParent(n)
+			// set proper parent
+			if bn, ok := child.(*baseNode); ok {
+				bn.parent = n
+			} else if inode, ok := child.(interface{ setParent(core.Node) }); ok {
+				inode.setParent(n)
+			}
+			n.value = append(n.value, child)
 		}
-		n.value = append(n.value, child)
-
 		// if we've reached the requested index, stop parsing further
 		if curIndex == idx {
 			n.mu.Unlock()
@@ -501,9 +950,16 @@ func (n *arrayNode) lazyParsePath(path []string) {
 		skipWS()
 		if pos < len(raw) && raw[pos] == ',' {
 			pos++
+			skipWS()
+			if pos < len(raw) && raw[pos] == ']' && !documentLeniency(&n.baseNode).trailingCommas {
+				// The full parse reports the trailing comma.
+				n.mu.Unlock()
+				n.lazyParse()
+				return
+			}
 			continue
 		}
-		if pos < len(raw) && raw[pos] == ']' {
+		if pos < len(raw) && raw[pos] == ']' && skipRawWhitespace(raw, pos+1) == len(raw) {
 			n.parsed.Store(true)
 			n.mu.Unlock()
 			return
@@ -552,14 +1008,17 @@ func (n *arrayNode) Filter(fn core.PredicateFunc) core.Node {
 		return n
 	}
 	n.lazyParse()
-	out := NewArrayNode(n, nil, n.funcs)
-	arr := out.(*arrayNode)
-	for _, v := range n.value {
+	values := n.value
+	if n.matchSet {
+		values = n.documentMatches()
+	}
+	results := make([]core.Node, 0)
+	for _, v := range values {
 		if fn(v) {
-			arr.value = append(arr.value, v)
+			results = append(results, v)
 		}
 	}
-	return out
+	return newMatchSet(n, results, n.funcs)
 }
 
 func (n *arrayNode) Map(fn core.TransformFunc) core.Node {
@@ -569,7 +1028,11 @@ func (n *arrayNode) Map(fn core.TransformFunc) core.Node {
 	n.lazyParse()
 	out := NewArrayNode(n, nil, n.funcs)
 	arr := out.(*arrayNode)
-	for _, v := range n.value {
+	values := n.value
+	if n.matchSet {
+		values = n.documentMatches()
+	}
+	for _, v := range values {
 		arr.value = append(arr.value, NewNodeFromInterface(arr, fn(v), n.funcs))
 	}
 	return out
@@ -0,0 +1,195 @@
+package engine
+
+import (
+	"bytes"
+	"fmt"
+
+	"github.com/474420502/xjson/internal/core"
+)
+
+// arrayLayout locates the elements of a raw array for splicing values in
+// without parsing it.
+type arrayLayout struct {
+	open    int // past '[' and the space after it
+	first   int // start of the first element
+	lastEnd int // end of the last element
+	count   int
+	// sep separates the last two elements, and is "," for fewer of them.
+	sep []byte
+}
+
+// scanArrayLayout reads the layout of the array in src, checking only its
+// brackets, strings and commas. It reports false for anything else, which
+// is left to a full parse to report.
+func scanArrayLayout(src []byte) (arrayLayout, bool) {
+	pos := skipSpace(src, 0)
+	if pos >= len(src) || src[pos] != '[' {
+		return arrayLayout{}, false
+	}
+	pos = skipSpace(src, pos+1)
+	l := arrayLayout{open: pos, first: pos, sep: []byte{','}}
+	prevEnd := -1
+	for pos < len(src) && src[pos] != ']' {
+		if prevEnd >= 0 {
+			l.sep = src[prevEnd:pos]
+		}
+		end := rawValueEnd(src, pos) + 1
+		if end <= pos {
+			return arrayLayout{}, false
+		}
+		l.count++
+		prevEnd = end
+		pos = skipSpace(src, end)
+		if pos < len(src) && src[pos] == ',' {
+			if pos = skipSpace(src, pos+1); pos < len(src) && src[pos] == ']' {
+				return arrayLayout{}, false
+			}
+		} else if pos < len(src) && src[pos] != ']' {
+			return arrayLayout{}, false
+		}
+	}
+	if pos >= len(src) || skipSpace(src, pos+1) != len(src) {
+		return arrayLayout{}, false
+	}
+	l.lastEnd = prevEnd
+	return l, true
+}
+
+// spliceRaw adds values to an array that has not been parsed by writing
+// them into its source, at the end or, with prepend, at the start, the way
+// serialization would separate them. The array stays unparsed, so adding to
+// a long array costs a scan and a copy of its text rather than a node for
+// every element. It reports false, having done nothing, when the array is
+// parsed, written to or not readable as an array, or when a value holds a
+// node, which is attached rather than written as text; a value that cannot
+// be converted fails without changing the array.
+func (n *arrayNode) spliceRaw(op string, values []interface{}, prepend bool) (bool, error) {
+	if n.err != nil || n.parsed.Load() || n.isDirty || len(n.value) > 0 || len(n.raw) == 0 ||
+		n.matchSet || n.selection || rootBase(&n.baseNode).trackPositions {
+		return false, nil
+	}
+	for _, value := range values {
+		if holdsNode(value) {
+			return false, nil
+		}
+	}
+	src := n.RawBytes()
+	l, ok := scanArrayLayout(src)
+	if !ok {
+		return false, nil
+	}
+	var enc bytes.Buffer
+	for i, value := range values {
+		child := NewNodeFromInterface(n, value, n.funcs)
+		if !child.IsValid() {
+			return true, fmt.Errorf("%s value %d: %w", op, i, child.Error())
+		}
+		if i > 0 {
+			if prepend || l.count == 0 {
+				enc.WriteByte(',')
+			} else {
+				enc.Write(l.sep)
+			}
+		}
+		writeJSONValue(&enc, child)
+	}
+	if len(values) == 0 {
+		return true, nil
+	}
+
+	raw := make([]byte, 0, len(src)+enc.Len()+len(l.sep))
+	switch {
+	case l.count == 0:
+		raw = append(append(append(raw, src[:l.open]...), enc.Bytes()...), src[l.open:]...)
+	case prepend:
+		raw = append(append(raw, src[:l.first]...), enc.Bytes()...)
+		raw = append(append(raw, ','), src[l.first:]...)
+	default:
+		raw = append(append(raw, src[:l.lastEnd]...), l.sep...)
+		raw = append(append(raw, enc.Bytes()...), src[l.lastEnd:]...)
+	}
+	n.raw, n.start, n.end = raw, 0, 0
+	n.mods++
+	markAncestorNodesDirty(n.parent)
+	n.baseNode.clearQueryCache()
+	if prepend && l.count > 0 {
+		n.logSelfEdit()
+	} else {
+		for i := range values {
+			n.logIndexEdit(l.count + i)
+		}
+	}
+	return true, nil
+}
+
+// PrependAll inserts values at the start of the array in order, converting
+// all of them first like AppendAll. An array that has not been parsed stays
+// unparsed.
+func (n *arrayNode) PrependAll(values ...interface{}) core.Node {
+	if n.err != nil {
+		return n
+	}
+	if ok, err := n.spliceRaw("prepend", values, true); ok {
+		if err != nil {
+			return newInvalidNode(err)
+		}
+		return n
+	}
+	children := make([]core.Node, len(values))
+	for i, value := range values {
+		child := NewNodeFromInterface(n, value, n.funcs)
+		if !child.IsValid() {
+			return newInvalidNode(fmt.Errorf("prepend value %d: %w", i, child.Error()))
+		}
+		children[i] = child
+	}
+	n.lazyParse()
+	if n.err != nil || len(children) == 0 {
+		return n
+	}
+	n.isDirty = true
+	n.mods++
+	markAncestorNodesDirty(n.parent)
+	n.baseNode.clearQueryCache()
+	if len(n.value) == 0 {
+		for i := range children {
+			n.logIndexEdit(i)
+		}
+	} else {
+		n.logSelfEdit()
+	}
+	n.value = append(children, n.value...)
+	return n
+}
+
+// ExtendArray adds values to the array at path below node, a path of key
+// and index steps as for SetByPath: at its end, or with prepend at its
+// start. With create, a missing array is made of the values, along with the
+// objects leading to it as SetByPath makes them. Otherwise a missing path
+// fails with a *core.PathError wrapping core.ErrNotFound; a value that is not
+// an array fails with one wrapping core.ErrTypeAssertion.
+func ExtendArray(node core.Node, op, path string, values []interface{}, prepend, create bool) error {
+	if err := node.Error(); err != nil {
+		return err
+	}
+	if create {
+		elems := append([]interface{}{}, values...)
+		if wrote, err := node.SetIfAbsent(path, elems); wrote || err != nil {
+			return err
+		}
+	}
+	target, err := followPath(node, op, path)
+	if err != nil {
+		return err
+	}
+	if _, isMatchSet := matchList(target); target.Type() != core.Array || isMatchSet {
+		return &core.PathError{Op: op, Path: path, Err: fmt.Errorf("%w: %s is not an array", core.ErrTypeAssertion, target.Type())}
+	}
+	var result core.Node
+	if prepend {
+		result = target.PrependAll(values...)
+	} else {
+		result = target.AppendAll(values...)
+	}
+	return result.Error()
+}
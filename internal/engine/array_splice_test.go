@@ -0,0 +1,205 @@
+package engine
+
+import (
+	"errors"
+	"reflect"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/474420502/xjson/internal/core"
+)
+
+// spliceDocs are documents with an array at /a of every layout.
+var spliceDocs = []string{
+	`{"a":[]}`,
+	`{"a":[ ]}`,
+	`{"a":[1]}`,
+	`{"a":[1,2]}`,
+	`{"a": [ 1, 2 ] }`,
+	"{\"a\":[\n  {\"x\":1},\n  \"s,]\"\n]}",
+	`{"a":[[1,[2]],{"b":"]"}]}`,
+}
+
+func TestSpliceMatchesParsedWrites(t *testing.T) {
+	writes := map[string]func(core.Node) core.Node{
+		"append":      func(n core.Node) core.Node { return n.Append("v") },
+		"append all":  func(n core.Node) core.Node { return n.AppendAll(1, map[string]interface{}{"k": []interface{}{true}}) },
+		"prepend":     func(n core.Node) core.Node { return n.PrependAll("v") },
+		"prepend all": func(n core.Node) core.Node { return n.PrependAll(1, nil, "x") },
+		"append none": func(n core.Node) core.Node { return n.AppendAll() },
+	}
+	for _, doc := range spliceDocs {
+		for name, write := range writes {
+			lazy, err := Parse([]byte(doc))
+			if err != nil {
+				t.Fatalf("Parse(%s) failed: %v", doc, err)
+			}
+			eager, err := MustParse([]byte(doc))
+			if err != nil {
+				t.Fatalf("MustParse(%s) failed: %v", doc, err)
+			}
+			arr := lazy.Get("a")
+			if res := write(arr); res.Error() != nil {
+				t.Fatalf("%s on %s failed: %v", name, doc, res.Error())
+			}
+			write(eager.Get("a"))
+			if arr.(*arrayNode).parsed.Load() {
+				t.Errorf("%s on %s parsed the array", name, doc)
+			}
+			if got, want := lazy.String(), eager.String(); got != want {
+				t.Errorf("%s on %s = %s, parsed gives %s", name, doc, got, want)
+			}
+			if got, want := lazy.Get("a").Len(), eager.Get("a").Len(); got != want {
+				t.Errorf("%s on %s: Len() = %d, want %d", name, doc, got, want)
+			}
+			if got, want := describeResult(lazy.Query("/a[-1]")), describeResult(eager.Query("/a[-1]")); got != want {
+				t.Errorf("%s on %s: /a[-1] = %s, want %s", name, doc, got, want)
+			}
+			if got, want := lazy.DirtyPaths(), eager.DirtyPaths(); !reflect.DeepEqual(got, want) {
+				t.Errorf("%s on %s: DirtyPaths() = %q, want %q", name, doc, got, want)
+			}
+			if !Equal(lazy, eager) {
+				t.Errorf("%s on %s: documents differ", name, doc)
+			}
+		}
+	}
+}
+
+func TestSpliceOnRootAndAfterReads(t *testing.T) {
+	root, _ := Parse([]byte(" [1, 2] "))
+	root.AppendAll(3, 4)
+	root.PrependAll(0)
+	if got := root.String(); got != " [0,1, 2, 3, 4] " {
+		t.Errorf("root array = %q", got)
+	}
+	if got := root.Index(4).Int(); got != 4 {
+		t.Errorf("Index(4) = %d, want 4", got)
+	}
+
+	// The objects above the array parse only their own members.
+	nested, _ := Parse([]byte(`{"u":{"posts":[1],"tags":["a"]},"log":[2]}`))
+	nested.Query("/u/posts").Append(2)
+	for _, path := range []string{"/u/tags", "/log"} {
+		if nested.Query(path).(*arrayNode).parsed.Load() {
+			t.Errorf("%s was parsed by an append to /u/posts", path)
+		}
+	}
+	if got := nested.String(); got != `{"u":{"posts":[1,2],"tags":["a"]},"log":[2]}` {
+		t.Errorf("nested append = %s", got)
+	}
+
+	// An array with elements handed out is parsed as before.
+	doc, _ := Parse([]byte(`{"a":[1, 2]}`))
+	first := doc.Query("/a[0]")
+	doc.Get("a").Append(3)
+	first.SetValue(10)
+	if got := doc.String(); got != `{"a":[10, 2, 3]}` {
+		t.Errorf("append after a read = %s", got)
+	}
+}
+
+func TestSpliceErrors(t *testing.T) {
+	root, _ := Parse([]byte(`{"a":[1]}`))
+	if res := root.Get("a").AppendAll(2, make(chan int)); res.IsValid() {
+		t.Error("AppendAll of a channel should fail")
+	}
+	if res := root.Get("a").PrependAll(make(chan int)); res.IsValid() {
+		t.Error("PrependAll of a channel should fail")
+	}
+	if got := root.String(); got != `{"a":[1]}` || len(root.DirtyPaths()) != 0 {
+		t.Errorf("failed writes changed the document: %s, %q", got, root.DirtyPaths())
+	}
+
+	// A layout the scan does not accept is left to the parsed write, which
+	// rejects a trailing comma unless the document allows them.
+	strict, _ := Parse([]byte(`{"a":[1,]}`))
+	if res := strict.Get("a").Append(2); res.IsValid() {
+		t.Errorf("append to [1,] = %s, want a syntax error", res)
+	}
+	lenient, _ := ParseWithOptions([]byte(`{"a":[1,]}`), ParseOptions{AllowTrailingCommas: true})
+	arr := lenient.Get("a")
+	if res := arr.Append(2); !res.IsValid() || arr.Len() != 2 || arr.Index(1).Int() != 2 {
+		t.Errorf("append to [1,] with trailing commas allowed = %s", lenient)
+	}
+}
+
+func TestExtendArray(t *testing.T) {
+	for name, parse := range testParsers {
+		root, err := parse([]byte(`{"user":{"posts":[],"name":"ann"},"tags":[["a"]]}`))
+		if err != nil {
+			t.Fatalf("%s: parse failed: %v", name, err)
+		}
+		if err := ExtendArray(root, "Append", "/user/posts", []interface{}{1, 2}, false, false); err != nil {
+			t.Errorf("%s: append failed: %v", name, err)
+		}
+		if err := ExtendArray(root, "Prepend", "/user/posts", []interface{}{0}, true, false); err != nil {
+			t.Errorf("%s: prepend failed: %v", name, err)
+		}
+		if err := ExtendArray(root, "Append", "/tags/0", []interface{}{"b"}, false, false); err != nil {
+			t.Errorf("%s: append through an index failed: %v", name, err)
+		}
+
+		err = ExtendArray(root, "Append", "/user/drafts", []interface{}{1}, false, false)
+		var pathErr *core.PathError
+		if !errors.Is(err, core.ErrNotFound) || !errors.As(err, &pathErr) || pathErr.Op != "Append" {
+			t.Errorf("%s: append to a missing array = %v, want a *PathError wrapping ErrNotFound", name, err)
+		}
+		if err := ExtendArray(root, "Append", "/user", []interface{}{1}, false, false); !errors.Is(err, core.ErrTypeAssertion) || !strings.Contains(err.Error(), "object is not an array") {
+			t.Errorf("%s: append to an object = %v, want ErrTypeAssertion", name, err)
+		}
+		if err := ExtendArray(root, "Append", "/user/name", []interface{}{1}, false, true); !errors.Is(err, core.ErrTypeAssertion) {
+			t.Errorf("%s: append to a string with create = %v, want ErrTypeAssertion", name, err)
+		}
+		if err := ExtendArray(root, "Append", "/user/drafts", []interface{}{1, 2}, false, true); err != nil {
+			t.Errorf("%s: append creating the array failed: %v", name, err)
+		}
+		if err := ExtendArray(root, "Prepend", "/meta/log", nil, true, true); err != nil {
+			t.Errorf("%s: prepend creating the parents failed: %v", name, err)
+		}
+		if err := ExtendArray(root, "Append", "/user/posts[*]", []interface{}{1}, false, false); err == nil {
+			t.Errorf("%s: append through a wildcard should fail", name)
+		}
+
+		want := `{"user":{"posts":[0,1,2],"name":"ann","drafts":[1,2]},"tags":[["a","b"]],"meta":{"log":[]}}`
+		if got := root.String(); got != want {
+			t.Errorf("%s: document = %s, want %s", name, got, want)
+		}
+	}
+}
+
+func BenchmarkAppendToLongArray(b *testing.B) {
+	var sb strings.Builder
+	sb.WriteString(`{"posts":[`)
+	for i := 0; i < 100000; i++ {
+		if i > 0 {
+			sb.WriteByte(',')
+		}
+		sb.WriteString(`{"id":` + strconv.Itoa(i) + `,"title":"post"}`)
+	}
+	sb.WriteString(`]}`)
+	data := []byte(sb.String())
+	post := map[string]interface{}{"id": 100000, "title": "new"}
+
+	b.Run("splice", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			root, _ := Parse(data)
+			root.Get("posts").Append(post)
+			if _, err := root.Bytes(); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+	b.Run("parsed", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			root, _ := Parse(data)
+			posts := root.Get("posts")
+			posts.Len()
+			posts.Array()
+			posts.Append(post)
+			if _, err := root.Bytes(); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+}
@@ -0,0 +1,108 @@
+package engine
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/474420502/xjson/internal/core"
+)
+
+const predicateDoc = `{"store":{"books":[
+	{"title":"Moby Dick","category":"fiction","price":8.5,"stock":2,"used":false},
+	{"title":"Sapiens","category":"history","price":25,"stock":0,"used":true},
+	{"title":"Dune","category":"fiction","price":12,"stock":"5","used":null},
+	{"title":"Ulysses","price":30,"first-edition":true}
+],"owner":{"name":"ann","city":"Oslo"}}}`
+
+func TestAttributePredicates(t *testing.T) {
+	testCases := []struct {
+		path, filter string
+		want         []string
+	}{
+		{`/store/books[title='Moby Dick']/price`, `/store/books[?(@.title == 'Moby Dick')]/price`, []string{"8.5"}},
+		{`/store/books[@category='fiction']/title`, `/store/books[?(@.category == 'fiction')]/title`, []string{"Moby Dick", "Dune"}},
+		{`/store/books[category == "fiction"]/title`, `/store/books[?(@.category == "fiction")]/title`, []string{"Moby Dick", "Dune"}},
+		{`/store/books[category!='fiction']/title`, `/store/books[?(@.category != 'fiction')]/title`, []string{"Sapiens"}},
+		{`/store/books[price<12]/title`, `/store/books[?(@.price < 12)]/title`, []string{"Moby Dick"}},
+		{`/store/books[price<=12]/title`, `/store/books[?(@.price <= 12)]/title`, []string{"Moby Dick", "Dune"}},
+		{`/store/books[price>12]/title`, `/store/books[?(@.price > 12)]/title`, []string{"Sapiens", "Ulysses"}},
+		{`/store/books[price >= 25]/title`, `/store/books[?(@.price >= 25)]/title`, []string{"Sapiens", "Ulysses"}},
+		{`/store/books[price>-1]/title`, `/store/books[?(@.price > -1)]/title`, []string{"Moby Dick", "Sapiens", "Dune", "Ulysses"}},
+		{`/store/books[stock>1]/title`, `/store/books[?(@.stock > 1)]/title`, []string{"Moby Dick"}},
+		{`/store/books[used=true]/title`, `/store/books[?(@.used == true)]/title`, []string{"Sapiens"}},
+		{`/store/books[used=null]/title`, `/store/books[?(@.used == null)]/title`, []string{"Dune"}},
+		{`/store/books['first-edition'=true]/title`, `/store/books[?(@['first-edition'] == true)]/title`, []string{"Ulysses"}},
+		{`/store/books[first-edition=true]/title`, `/store/books[?(@['first-edition'] == true)]/title`, []string{"Ulysses"}},
+		{`/store/books[title='Dune'][0]/price`, `/store/books[?(@.title == 'Dune')][0]/price`, []string{"12"}},
+		{`/store/books[category='fiction'][-1]/title`, `/store/books[?(@.category == 'fiction')][-1]/title`, []string{"Dune"}},
+		{`/store/books[category='fiction'][price>10]/title`, `/store/books[?(@.category == 'fiction' && @.price > 10)]/title`, []string{"Dune"}},
+		{`//*[title='Sapiens']/price`, `//*[?(@.title == 'Sapiens')]/price`, []string{"25"}},
+		{`/store/owner[city='Oslo']/name`, `/store/owner[?(@.city == 'Oslo')]/name`, []string{"ann"}},
+		{`/store/books[title='Nope']/title`, `/store/books[?(@.title == 'Nope')]/title`, []string{}},
+	}
+	for name, parse := range testParsers {
+		root, err := parse([]byte(predicateDoc))
+		if err != nil {
+			t.Fatalf("%s: parse failed: %v", name, err)
+		}
+		for _, tc := range testCases {
+			result := root.Query(tc.path)
+			if !result.IsValid() {
+				t.Fatalf("%s: query %q failed: %v", name, tc.path, result.Error())
+			}
+			got := result.Strings()
+			if len(tc.want) == 0 {
+				if result.Len() != 0 {
+					t.Errorf("%s: query %q = %v, want no matches", name, tc.path, got)
+				}
+			} else if !reflect.DeepEqual(got, tc.want) {
+				t.Errorf("%s: query %q = %v, want %v", name, tc.path, got, tc.want)
+			}
+			if filtered := root.Query(tc.filter); describeResult(filtered) != describeResult(result) {
+				t.Errorf("%s: query %q = %s, but %q = %s", name, tc.path, describeResult(result), tc.filter, describeResult(filtered))
+			}
+		}
+		if got := root.Query(`/store/owner[city='Bergen']`); !got.IsValid() || got.Len() != 0 {
+			t.Errorf("%s: predicate dropping the object = %s (%v)", name, got.String(), got.Error())
+		}
+	}
+}
+
+func TestAttributePredicatesWithFunctions(t *testing.T) {
+	root, err := Parse([]byte(predicateDoc))
+	if err != nil {
+		t.Fatalf("Parse failed: %v", err)
+	}
+	root.RegisterFunc("cheap", func(n core.Node) core.Node {
+		return n.Filter(func(book core.Node) bool { return book.Get("price").Float() < 20 })
+	})
+	if got := root.Query(`/store/books[@cheap][category='fiction']/title`).Strings(); !reflect.DeepEqual(got, []string{"Moby Dick", "Dune"}) {
+		t.Errorf("function then predicate = %v", got)
+	}
+	if got := root.Query(`/store/books[category='fiction'][@cheap][0]/title`).Strings(); !reflect.DeepEqual(got, []string{"Moby Dick"}) {
+		t.Errorf("predicate then function = %v", got)
+	}
+	// A bracket naming a function without a comparison is still a call.
+	if got := root.Query(`/store/books[@cheap]`).Len(); got != 2 {
+		t.Errorf("[@cheap] matched %d books, want 2", got)
+	}
+}
+
+func TestAttributePredicateSyntaxErrors(t *testing.T) {
+	root, err := Parse([]byte(predicateDoc))
+	if err != nil {
+		t.Fatalf("Parse failed: %v", err)
+	}
+	for _, path := range []string{
+		`/store/books[title=]`,
+		`/store/books[title='x'`,
+		`/store/books[title='x' 1]`,
+		`/store/books[title=other]`,
+		`/store/books[title=@.category]`,
+		`/store/books[@title=='x' && 1]`,
+	} {
+		if got := root.Query(path); got.IsValid() {
+			t.Errorf("expected a syntax error for %q, got %s", path, got.String())
+		}
+	}
+}
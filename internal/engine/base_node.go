@@ -1,6 +1,7 @@
 package engine
 
 import (
+	"bytes"
 	"fmt"
 	"strconv"
 	"sync"
@@ -18,6 +19,10 @@ type baseNode struct {
 	funcs  *map[string]core.UnaryPathFunc
 	err    error
 
+	// localFuncs holds the functions registered on a node that is not a
+	// document root, see funcScope.
+	localFuncs map[string]core.UnaryPathFunc
+
 	// lazy parse helpers for composite nodes
 	parsed atomic.Bool
 	mu     sync.Mutex
@@ -30,6 +35,43 @@ type baseNode struct {
 	queryCache    map[string]core.Node
 	cacheMutex    sync.RWMutex
 	hasQueryCache atomic.Bool
+
+	// trackPositions is only set on document roots, see ParseOptions.
+	trackPositions bool
+	// duplicateKeys is only set on document roots, see ParseOptions.
+	duplicateKeys DuplicateKeyPolicy
+	// strictConversions is only set on document roots, see ParseOptions.
+	strictConversions bool
+	// leniency is only set on document roots, see ParseOptions.
+	leniency leniency
+	// maxRecursionDepth is only set on document roots, see ParseOptions.
+	maxRecursionDepth int
+
+	// lastErr is the LastError of the node, see SetMustBehavior and
+	// ParseOptions.StrictConversionErrors.
+	lastErr atomic.Pointer[core.PathError]
+	// mustBehavior is only set on document roots, see
+	// SetDocumentMustBehavior: the MustBehavior plus one, or zero for the
+	// package default.
+	mustBehavior atomic.Uint32
+	// mustScope is only set on invalid nodes a lookup returned from a
+	// document with a MustBehavior of its own: the base of its root.
+	mustScope *baseNode
+
+	// arena is the pooled document the node belongs to, if any.
+	arena *nodeArena
+
+	// edits is only set on document roots once written to, see DirtyPaths.
+	edits *editLog
+
+	// origin is only set on the temporary copies a recursive scan makes of
+	// the containers of its matches: it is the root of the scanned
+	// document, see documentRoot.
+	origin core.Node
+
+	// owner is only set on the nodes a caller made roots of its own
+	// documents, see SetOwner.
+	owner interface{}
 }
 
 const maxQueryCacheEntries = 128
@@ -170,87 +212,121 @@ func (n *baseNode) setError(err error) {
 	}
 }
 
-// SetByPath sets a value at the specified path, creating intermediate nodes if needed
+// SetByPath sets a value at the specified path. Every step before the last
+// must find a value: a missing one fails with a *core.PathError wrapping
+// core.ErrNotFound.
 func (n *baseNode) SetByPath(path string, value interface{}) core.Node {
+	result, _ := n.setPath("SetByPath", path, value, writeStrict, false)
+	return result
+}
+
+// DeleteByPath removes the value at the specified path. Like SetByPath it
+// never creates intermediate nodes.
+func (n *baseNode) DeleteByPath(path string) core.Node {
 	if n.err != nil {
 		return n.selfOrMe()
 	}
 
-	// Parse the path into tokens
 	tokens, err := ParseQuery(path)
 	if err != nil {
 		return newInvalidNode(fmt.Errorf("invalid path: %v", err))
 	}
+	if len(tokens) == 0 {
+		return newInvalidNode(fmt.Errorf("empty path"))
+	}
 
-	// Navigate to the parent of the target node
 	current := n.selfOrMe()
-	for i := 0; i < len(tokens)-1; i++ {
-		token := tokens[i]
+	for _, token := range tokens[:len(tokens)-1] {
 		switch token.Op {
 		case OpKey:
-			if obj, ok := current.(interface{ Get(string) core.Node }); ok {
-				next := obj.Get(token.Value.(string))
-				if !next.IsValid() {
-					// Try to create intermediate object node
-					if _, ok := current.(interface {
-						Set(string, interface{}) core.Node
-					}); ok {
-						newObj := NewObjectNode(current, []byte("{}"), nil)
-						current = current.Set(token.Value.(string), newObj)
-						if !current.IsValid() {
-							return current
-						}
-					} else {
-						return newInvalidNode(fmt.Errorf("cannot create key in non-object node"))
-					}
-				} else {
-					current = next
-				}
-			} else {
-				return newInvalidNode(fmt.Errorf("key operation not supported on node type %s", current.Type()))
-			}
+			current = current.Get(token.Value.(string))
 		case OpIndex:
-			if arr, ok := current.(interface{ Index(int) core.Node }); ok {
-				index := token.Value.(int)
-				next := arr.Index(index)
-				if !next.IsValid() {
-					return newInvalidNode(fmt.Errorf("index %d out of bounds", index))
-				}
-				current = next
-			} else {
-				return newInvalidNode(fmt.Errorf("index operation not supported on node type %s", current.Type()))
-			}
+			current = stepIndex(current, token.Value.(int))
 		default:
-			return newInvalidNode(fmt.Errorf("operation %v not supported in SetByPath", token.Op))
+			return newInvalidNode(fmt.Errorf("operation %v not supported in DeleteByPath", token.Op))
 		}
+		if !current.IsValid() {
+			return current
+		}
+	}
+
+	lastToken := tokens[len(tokens)-1]
+	switch lastToken.Op {
+	case OpKey:
+		return current.Delete(lastToken.Value.(string))
+	case OpIndex:
+		if _, isMatchSet := matchList(current); current.Type() != core.Array && (current.Type() != core.Object || isMatchSet) {
+			return newInvalidNode(fmt.Errorf("cannot delete index on node type %s", current.Type()))
+		}
+		// Delete reads the step as a key of an object and an index of an
+		// array, like stepIndex.
+		return current.Delete(strconv.Itoa(lastToken.Value.(int)))
+	default:
+		return newInvalidNode(fmt.Errorf("operation %v not supported for deleting value", lastToken.Op))
+	}
+}
+
+// AppendByPath appends values to the array at the specified path. Like
+// DeleteByPath it never creates intermediate nodes.
+func (n *baseNode) AppendByPath(path string, values ...interface{}) core.Node {
+	if n.err != nil {
+		return n.selfOrMe()
+	}
+	target := n.resolveArrayPath(path, "AppendByPath")
+	if !target.IsValid() {
+		return target
+	}
+	return target.AppendAll(values...)
+}
+
+// InsertByPath inserts a value before index in the array at the specified
+// path, with the same index rules as InsertAt.
+func (n *baseNode) InsertByPath(path string, index int, value interface{}) core.Node {
+	if n.err != nil {
+		return n.selfOrMe()
 	}
+	target := n.resolveArrayPath(path, "InsertByPath")
+	if !target.IsValid() {
+		return target
+	}
+	return target.InsertAt(index, value)
+}
 
-	// Set the value at the final token
-	if len(tokens) > 0 {
-		lastToken := tokens[len(tokens)-1]
-		switch lastToken.Op {
+// resolveArrayPath follows the key and index steps of path and returns the
+// array it names.
+func (n *baseNode) resolveArrayPath(path string, op string) core.Node {
+	tokens, err := ParseQuery(path)
+	if err != nil {
+		return newInvalidNode(fmt.Errorf("invalid path: %v", err))
+	}
+	current := n.selfOrMe()
+	for _, token := range tokens {
+		switch token.Op {
 		case OpKey:
-			if obj, ok := current.(interface {
-				Set(string, interface{}) core.Node
-			}); ok {
-				return obj.Set(lastToken.Value.(string), value)
-			} else {
-				return newInvalidNode(fmt.Errorf("cannot set key on node type %s", current.Type()))
-			}
+			current = current.Get(token.Value.(string))
 		case OpIndex:
-			if arr, ok := current.(interface {
-				Set(string, interface{}) core.Node
-			}); ok {
-				return arr.Set(strconv.Itoa(lastToken.Value.(int)), value)
-			} else {
-				return newInvalidNode(fmt.Errorf("cannot set index on node type %s", current.Type()))
-			}
+			current = stepIndex(current, token.Value.(int))
 		default:
-			return newInvalidNode(fmt.Errorf("operation %v not supported for setting value", lastToken.Op))
+			return newInvalidNode(fmt.Errorf("operation %v not supported in %s", token.Op, op))
+		}
+		if !current.IsValid() {
+			return current
 		}
 	}
+	if current.Type() != core.Array {
+		return newInvalidNode(fmt.Errorf("%s: node at %q is %s, not an array", op, path, current.Type()))
+	}
+	return current
+}
 
-	return newInvalidNode(fmt.Errorf("empty path"))
+// stepIndex takes a numeric step of a path, such as /0 or [0], from node:
+// the member of that name of an object, and the element at that index of
+// an array or match set. The quoted form ['0'] always names a key.
+func stepIndex(node core.Node, i int) core.Node {
+	if o, ok := node.(*objectNode); ok {
+		return o.Get(strconv.Itoa(i))
+	}
+	return node.Index(i)
 }
 
 func (n *baseNode) Path() string {
@@ -258,6 +334,13 @@ func (n *baseNode) Path() string {
 	if n.parent == nil || self == nil {
 		return ""
 	}
+	// A match of a recursive scan hangs off a temporary copy of its
+	// container; its place is that of the document node at its bytes.
+	if top := nodeBase(topNode(self)); top != nil && top.origin != nil {
+		if segs, ok := (&locator{}).locate(self); ok {
+			return formatSegments(segs)
+		}
+	}
 
 	basePath := n.parent.Path()
 	switch parent := n.parent.(type) {
@@ -284,44 +367,89 @@ func (n *baseNode) Query(path string) core.Node {
 	if n.err != nil {
 		return newInvalidNode(n.err)
 	}
-	start := n.selfOrMe()
-	return applySimpleQuery(start, path)
+	result := applySimpleQuery(queryStart(n.selfOrMe(), path), path)
+	if !result.IsValid() && looksLikeDotPath(path) {
+		return n.scoped(withHint(result, dotSyntaxHint))
+	}
+	return n.scoped(result)
 }
 
+func (n *baseNode) MustQuery(path string) core.Node {
+	result := n.selfOrMe().Query(path)
+	err := result.Error()
+	if err == nil && isEmptyMatchSet(result) {
+		err = core.ErrNoMatches
+	}
+	if err != nil {
+		pathErr := &core.PathError{Path: path, Op: "MustQuery", Err: err}
+		n.mustFail(pathErr)
+		return n.scoped(newInvalidNode(pathErr))
+	}
+	return result
+}
+
+// Leaves returns a match set with every scalar below the node, in document
+// order. A scalar node has no leaves below it.
+func (n *baseNode) Leaves() core.Node {
+	if n.err != nil {
+		return newInvalidNode(n.err)
+	}
+	return descendants(n.selfOrMe(), true)
+}
+
+// RegisterFunc registers fn as name in the scope of the node: for every
+// node of the document on a root, else for the node and the nodes below it.
 func (n *baseNode) RegisterFunc(name string, fn core.UnaryPathFunc) core.Node {
 	if n.err != nil {
 		return n.selfOrMe()
 	}
-	if n.funcs == nil {
-		newFuncs := make(map[string]core.UnaryPathFunc)
-		n.funcs = &newFuncs
-	}
-	(*n.funcs)[name] = fn
+	scope := n.funcScope(true)
+	delete(scope, argsFuncKey(name))
+	scope[name] = fn
 	return n.selfOrMe()
 }
 
+// RemoveFunc removes the function registered as name in the scope of the
+// node. A function of the same name registered on another node stays.
 func (n *baseNode) RemoveFunc(name string) core.Node {
 	if n.err != nil {
 		return n.selfOrMe()
 	}
-	if n.funcs != nil {
-		delete(*n.funcs, name)
-	}
+	scope := n.funcScope(false)
+	delete(scope, name)
+	delete(scope, argsFuncKey(name))
 	return n.selfOrMe()
 }
 
-func (n *baseNode) CallFunc(name string) core.Node {
+// CallFunc runs the function registered as name on the node or its nearest
+// ancestor, see funcScope, or a builtin. A panic in the function becomes
+// the error of the result.
+func (n *baseNode) CallFunc(name string, args ...core.Arg) (result core.Node) {
 	if n.err != nil {
 		return n.selfOrMe()
 	}
-	if n.funcs != nil {
-		if fn, ok := (*n.funcs)[name]; ok {
-			// Always call with the concrete node
-			if n.self != nil {
-				return fn(n.self)
-			}
+	defer recoverPanic("CallFunc", name, &result)
+	if fn, withArgs, ok := n.lookupFunc(name); ok {
+		// Always call with the concrete node
+		if n.self == nil {
 			return newInvalidNode(fmt.Errorf("function '%s' not found", name))
 		}
+		if withArgs {
+			return fn(&argsCall{Node: n.self, args: args})
+		}
+		if len(args) > 0 {
+			return newInvalidNode(fmt.Errorf("function '%s' takes no arguments, got %d", name, len(args)))
+		}
+		return fn(n.self)
+	}
+	if fn, ok := builtinArgsFuncs[name]; ok {
+		return fn(n.selfOrMe(), args...)
+	}
+	if name == embeddedJSONFunc {
+		if len(args) > 0 {
+			return newInvalidNode(fmt.Errorf("function '%s' takes no arguments, got %d", name, len(args)))
+		}
+		return n.ParseEmbedded()
 	}
 	return newInvalidNode(fmt.Errorf("function '%s' not found", name))
 }
@@ -332,16 +460,64 @@ func (n *baseNode) CallFunc(name string) core.Node {
 func (n *baseNode) Type() core.NodeType { return core.Invalid }
 func (n *baseNode) Len() int            { return 1 }
 func (n *baseNode) Get(key string) core.Node {
-	return newInvalidNode(fmt.Errorf("get not supported on type %s", n.Type()))
+	return n.scoped(newInvalidNode(fmt.Errorf("get not supported on type %s: %w", n.selfOrMe().Type(), core.ErrTypeAssertion)))
 }
 func (n *baseNode) Index(i int) core.Node {
-	return newInvalidNode(fmt.Errorf("index not supported on type %s", n.Type()))
+	return n.scoped(newInvalidNode(fmt.Errorf("index not supported on type %s: %w", n.selfOrMe().Type(), core.ErrTypeAssertion)))
 }
+func (n *baseNode) HasKey(key string) bool { return false }
+func (n *baseNode) HasIndex(i int) bool    { return false }
 func (n *baseNode) Set(key string, value interface{}) core.Node {
-	return newInvalidNode(fmt.Errorf("set not supported on type %s", n.Type()))
+	return newInvalidNode(fmt.Errorf("set not supported on type %s", n.selfOrMe().Type()))
 }
 func (n *baseNode) Append(value interface{}) core.Node {
-	return newInvalidNode(fmt.Errorf("append not supported on type %s", n.Type()))
+	return newInvalidNode(fmt.Errorf("append not supported on type %s", n.selfOrMe().Type()))
+}
+func (n *baseNode) AppendAll(values ...interface{}) core.Node {
+	return newInvalidNode(fmt.Errorf("append not supported on type %s", n.selfOrMe().Type()))
+}
+func (n *baseNode) PrependAll(values ...interface{}) core.Node {
+	return newInvalidNode(fmt.Errorf("prepend not supported on type %s", n.selfOrMe().Type()))
+}
+func (n *baseNode) InsertAt(index int, value interface{}) core.Node {
+	return newInvalidNode(fmt.Errorf("insert not supported on type %s", n.selfOrMe().Type()))
+}
+func (n *baseNode) SetIndex(index int, value interface{}) core.Node {
+	if n.err != nil {
+		return n.selfOrMe()
+	}
+	return newInvalidNode(fmt.Errorf("%w: set index not supported on type %s", core.ErrTypeAssertion, n.selfOrMe().Type()))
+}
+
+// Limit treats a non-array node as a single match.
+func (n *baseNode) Limit(limit int) core.Node {
+	if n.err != nil {
+		return n.selfOrMe()
+	}
+	if limit < 0 {
+		return newInvalidNode(fmt.Errorf("negative limit: %d", limit))
+	}
+	if limit == 0 {
+		return newMatchSet(n.parent, nil, n.funcs)
+	}
+	return n.selfOrMe()
+}
+
+// Offset treats a non-array node as a single match.
+func (n *baseNode) Offset(offset int) core.Node {
+	if n.err != nil {
+		return n.selfOrMe()
+	}
+	if offset < 0 {
+		return newInvalidNode(fmt.Errorf("negative offset: %d", offset))
+	}
+	if offset > 0 {
+		return newMatchSet(n.parent, nil, n.funcs)
+	}
+	return n.selfOrMe()
+}
+func (n *baseNode) Delete(key string) core.Node {
+	return newInvalidNode(fmt.Errorf("delete not supported on type %s", n.Type()))
 }
 
 func (n *baseNode) Filter(fn core.PredicateFunc) core.Node {
@@ -369,21 +545,32 @@ func (n *baseNode) SetValue(v interface{}) core.Node {
 		return replacement
 	}
 
+	// The parent is parsed in full before it is marked dirty, or its members
+	// not read yet would be left out of its encoding. Children already
+	// handed out are kept by the parse.
 	switch parent := n.parent.(type) {
 	case *objectNode:
+		parent.lazyParse()
 		if key, ok := findObjectChildKey(parent, n.selfOrMe()); ok {
 			parent.isDirty = true
+			parent.mods++
 			markAncestorNodesDirty(parent.parent)
 			parent.baseNode.clearQueryCache()
+			parent.logKeyEdit(key)
+			detach(parent.value[key])
 			parent.value[key] = replacement
 			parent.rebuildInlineEntries()
 			return replacement
 		}
 	case *arrayNode:
+		parent.lazyParse()
 		if idx, ok := findArrayChildIndex(parent, n.selfOrMe()); ok {
 			parent.isDirty = true
+			parent.mods++
 			markAncestorNodesDirty(parent.parent)
 			parent.baseNode.clearQueryCache()
+			parent.logIndexEdit(idx)
+			detach(parent.value[idx])
 			parent.value[idx] = replacement
 			return replacement
 		}
@@ -392,10 +579,12 @@ func (n *baseNode) SetValue(v interface{}) core.Node {
 	return newInvalidNode(fmt.Errorf("setValue could not locate current node in parent"))
 }
 
-func (n *baseNode) Apply(fn core.PathFunc) core.Node {
+// Apply runs fn on the node; a panic in fn becomes the error of the result.
+func (n *baseNode) Apply(fn core.PathFunc) (result core.Node) {
 	if n.err != nil {
 		return n.selfOrMe()
 	}
+	defer recoverPanic("Apply", "", &result)
 	self := n.selfOrMe()
 	switch typed := fn.(type) {
 	case core.UnaryPathFunc:
@@ -407,9 +596,7 @@ func (n *baseNode) Apply(fn core.PathFunc) core.Node {
 		if typed(self) {
 			return self
 		}
-		out := NewArrayNode(n.parent, nil, n.funcs)
-		out.(*arrayNode).isDirty = true
-		return out
+		return newMatchSet(n.parent, nil, n.funcs)
 	case core.TransformFunc:
 		if result := self.Map(typed); result.IsValid() {
 			return result
@@ -420,18 +607,33 @@ func (n *baseNode) Apply(fn core.PathFunc) core.Node {
 	}
 }
 
-func (n *baseNode) String() string         { return n.Raw() }
-func (n *baseNode) MustString() string     { panic(core.ErrTypeAssertion) }
-func (n *baseNode) Float() float64         { return 0 }
-func (n *baseNode) MustFloat() float64     { panic(core.ErrTypeAssertion) }
-func (n *baseNode) Int() int64             { return 0 }
-func (n *baseNode) MustInt() int64         { panic(core.ErrTypeAssertion) }
-func (n *baseNode) Bool() bool             { return false }
-func (n *baseNode) MustBool() bool         { panic(core.ErrTypeAssertion) }
-func (n *baseNode) Time() time.Time        { return time.Time{} }
-func (n *baseNode) MustTime() time.Time    { panic(core.ErrTypeAssertion) }
-func (n *baseNode) Array() []core.Node     { return nil }
-func (n *baseNode) MustArray() []core.Node { panic(core.ErrTypeAssertion) }
+// Bytes encodes the node as JSON.
+func (n *baseNode) Bytes() ([]byte, error) {
+	if n.err != nil {
+		return nil, n.err
+	}
+	var buf bytes.Buffer
+	writeJSONValue(&buf, n.selfOrMe())
+	if err := finiteText(n, buf.Bytes()); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func (n *baseNode) String() string      { return n.Raw() }
+func (n *baseNode) MustString() string  { return mustZero[string](n, n.typeMismatch("MustString")) }
+func (n *baseNode) Float() float64      { return conversionZero[float64](n, "Float", "float", nil) }
+func (n *baseNode) MustFloat() float64  { return mustZero[float64](n, n.typeMismatch("MustFloat")) }
+func (n *baseNode) Int() int64          { return conversionZero[int64](n, "Int", "int", nil) }
+func (n *baseNode) MustInt() int64      { return mustZero[int64](n, n.typeMismatch("MustInt")) }
+func (n *baseNode) Bool() bool          { return false }
+func (n *baseNode) MustBool() bool      { return mustZero[bool](n, n.typeMismatch("MustBool")) }
+func (n *baseNode) Time() time.Time     { return time.Time{} }
+func (n *baseNode) MustTime() time.Time { return mustZero[time.Time](n, n.typeMismatch("MustTime")) }
+func (n *baseNode) Array() []core.Node  { return nil }
+func (n *baseNode) MustArray() []core.Node {
+	return mustZero[[]core.Node](n, n.typeMismatch("MustArray"))
+}
 func (n *baseNode) Interface() interface{} { return nil }
 func (n *baseNode) RawFloat() (float64, bool) {
 	self := n.selfOrMe()
@@ -471,11 +673,24 @@ func (n *baseNode) RawString() (string, bool) {
 	// Default: return raw string representation and mark as available
 	return n.Raw(), true
 }
-func (n *baseNode) Strings() []string               { return []string{n.String()} }
-func (n *baseNode) Keys() []string                  { return nil }
-func (n *baseNode) Contains(value string) bool      { return n.String() == value }
-func (n *baseNode) AsMap() map[string]core.Node     { return nil }
-func (n *baseNode) MustAsMap() map[string]core.Node { panic(core.ErrTypeAssertion) }
+func (n *baseNode) RawEscaped() (string, bool) {
+	if sn, ok := n.selfOrMe().(*stringNode); ok {
+		return sn.RawEscaped()
+	}
+	return "", false
+}
+func (n *baseNode) Strings() []string           { return []string{n.String()} }
+func (n *baseNode) Keys() []string              { return nil }
+func (n *baseNode) Contains(value string) bool  { return n.String() == value }
+func (n *baseNode) AsMap() map[string]core.Node { return nil }
+func (n *baseNode) MustAsMap() map[string]core.Node {
+	return mustZero[map[string]core.Node](n, n.typeMismatch("MustAsMap"))
+}
+
+// UnsafeArray and UnsafeMap are Array and AsMap without the copy; only
+// arrays and objects have elements or members.
+func (n *baseNode) UnsafeArray() []core.Node        { return nil }
+func (n *baseNode) UnsafeMap() map[string]core.Node { return nil }
 
 func (n *baseNode) GetFuncs() *map[string]core.UnaryPathFunc {
 	return n.funcs
@@ -485,13 +700,42 @@ func (n *baseNode) IsValid() bool {
 	return n.err == nil
 }
 
+// Exists reports whether the node resolved without an error; see
+// HasMatches for whether a query result holds anything.
+func (n *baseNode) Exists() bool {
+	return n.selfOrMe().IsValid()
+}
+
+// HasMatches reports whether the node is valid and, for the result of a
+// wildcard, filter, recursive descent or slice, holds at least one match.
+func (n *baseNode) HasMatches() bool {
+	return n.err == nil
+}
+
+// markAncestorNodesDirty flags current and its ancestors for re-serialization.
+// Each container is materialized first so that siblings which were never
+// accessed are not dropped once the raw bytes stop being used.
+// isDirtyContainer reports whether node is an object or array that has been
+// written to since it was parsed.
+func isDirtyContainer(node core.Node) bool {
+	switch typed := node.(type) {
+	case *objectNode:
+		return typed.isDirty
+	case *arrayNode:
+		return typed.isDirty
+	}
+	return false
+}
+
 func markAncestorNodesDirty(current core.Node) {
 	for current != nil {
 		switch typed := current.(type) {
 		case *objectNode:
+			typed.parseRaw(true)
 			typed.isDirty = true
 			current = typed.parent
 		case *arrayNode:
+			typed.lazyParse()
 			typed.isDirty = true
 			current = typed.parent
 		default:
@@ -500,6 +744,29 @@ func markAncestorNodesDirty(current core.Node) {
 	}
 }
 
+// mustError builds the panic value of a failed Must* conversion on node.
+func mustError(node core.Node, op string, err error) *core.PathError {
+	path := ""
+	if node.IsValid() {
+		path = displayPath(node)
+	}
+	return &core.PathError{Path: path, Op: op, Err: err}
+}
+
+// displayPath returns the path of node for error messages, "/" for a root.
+func displayPath(node core.Node) string {
+	if path := node.Path(); path != "" {
+		return path
+	}
+	return "/"
+}
+
+// typeMismatch is the panic value of a Must* conversion the node's type does
+// not support.
+func (n *baseNode) typeMismatch(op string) *core.PathError {
+	return mustError(n.selfOrMe(), op, core.ErrTypeAssertion)
+}
+
 func formatPathKey(key string) string {
 	if key == "" {
 		return "['']"
@@ -527,10 +794,18 @@ func isSimplePathKey(key string) bool {
 func escapeQuotedPathKey(key string) string {
 	escaped := make([]byte, 0, len(key))
 	for i := 0; i < len(key); i++ {
-		if key[i] == '\\' || key[i] == '\'' {
-			escaped = append(escaped, '\\')
+		switch c := key[i]; c {
+		case '\\', '\'':
+			escaped = append(escaped, '\\', c)
+		case '\n':
+			escaped = append(escaped, '\\', 'n')
+		case '\r':
+			escaped = append(escaped, '\\', 'r')
+		case '\t':
+			escaped = append(escaped, '\\', 't')
+		default:
+			escaped = append(escaped, c)
 		}
-		escaped = append(escaped, key[i])
 	}
 	return string(escaped)
 }
@@ -0,0 +1,208 @@
+package engine
+
+import (
+	"bytes"
+	"fmt"
+	"math"
+	"math/big"
+	"sort"
+	"strconv"
+	"unicode/utf8"
+
+	"github.com/474420502/xjson/internal/core"
+)
+
+// CanonicalBytes encodes the node in a canonical form modeled on RFC 8785
+// (JCS): object keys sorted by their UTF-16 code units at every level, no
+// whitespace, strings with the minimal escapes and numbers in the form of
+// canonicalNumber. The result depends only on the value, not on how the
+// document was parsed, built or edited, so nodes for which Equal holds
+// encode alike. A match set encodes like Bytes does: a single match on its
+// own, and no matches as core.ErrNoMatches.
+func (n *baseNode) CanonicalBytes() ([]byte, error) {
+	self := n.selfOrMe()
+	if err := self.Error(); err != nil {
+		return nil, err
+	}
+	if arr, ok := self.(*arrayNode); ok && arr.matchSet {
+		switch len(arr.value) {
+		case 0:
+			return nil, core.ErrNoMatches
+		case 1:
+			self = arr.value[0]
+		}
+	}
+	var buf bytes.Buffer
+	if err := writeCanonical(&buf, self); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// Canonical returns the text of CanonicalBytes, or "" when the node has an
+// error.
+func (n *baseNode) Canonical() string {
+	b, err := n.CanonicalBytes()
+	if err != nil {
+		return ""
+	}
+	return string(b)
+}
+
+// writeCanonical writes the canonical form of node. It returns the error of
+// a lazy object or array inside node whose raw text turns out to be
+// malformed once it is read.
+func writeCanonical(buf *bytes.Buffer, node core.Node) error {
+	switch node.Type() {
+	case core.Object:
+		keys := append([]string(nil), node.Keys()...)
+		if err := node.Error(); err != nil {
+			return err
+		}
+		sort.Slice(keys, func(i, j int) bool { return utf16Less(keys[i], keys[j]) })
+		buf.WriteByte('{')
+		for i, key := range keys {
+			if i > 0 {
+				buf.WriteByte(',')
+			}
+			writeCanonicalString(buf, key)
+			buf.WriteByte(':')
+			if err := writeCanonical(buf, node.Get(key)); err != nil {
+				return err
+			}
+		}
+		buf.WriteByte('}')
+	case core.Array:
+		elems := node.UnsafeArray()
+		if err := node.Error(); err != nil {
+			return err
+		}
+		buf.WriteByte('[')
+		for i, elem := range elems {
+			if i > 0 {
+				buf.WriteByte(',')
+			}
+			if err := writeCanonical(buf, elem); err != nil {
+				return err
+			}
+		}
+		buf.WriteByte(']')
+	case core.String:
+		s, _ := node.RawString()
+		writeCanonicalString(buf, s)
+	case core.Number:
+		raw := node.Raw()
+		if end := nonFiniteEnd([]byte(raw), 0); end == len(raw) {
+			return fmt.Errorf("%w: JSON has no text for %s", core.ErrNumberOverflow, raw)
+		}
+		buf.WriteString(canonicalNumber(raw))
+	case core.Bool:
+		buf.WriteString(strconv.FormatBool(node.Bool()))
+	case core.Null:
+		buf.WriteString("null")
+	}
+	return nil
+}
+
+// canonicalNumber returns the canonical text of the JSON number raw. An
+// integer that fits an int64 is written exactly, also when written as 1.0
+// or 1e2; any other number is written like JavaScript does, in the shortest
+// form that reads back as the same float64, with -0 as 0. Equal compares
+// such numbers the same way, except that it also takes an int64 and a float
+// beyond 2^53 to be equal when the int64 rounds to the float.
+func canonicalNumber(raw string) string {
+	if i, err := strconv.ParseInt(raw, 10, 64); err == nil {
+		return strconv.FormatInt(i, 10)
+	}
+	f, err := strconv.ParseFloat(raw, 64)
+	if err != nil {
+		return raw
+	}
+	if f == 0 {
+		return "0"
+	}
+	if f == math.Trunc(f) && math.Abs(f) >= 1<<53 && math.Abs(f) <= 1<<63 {
+		// Above 2^53 the float64 may have rounded the integer the text
+		// spells out; keep its exact digits when they fit an int64.
+		if r, ok := new(big.Rat).SetString(raw); ok && r.IsInt() && r.Num().IsInt64() {
+			return r.Num().String()
+		}
+	}
+	return string(appendJSONFloat(nil, f, 64))
+}
+
+// utf16Less orders strings by their UTF-16 code units, as JCS sorts keys.
+// That is the order of their runes, except that a rune above U+FFFF, whose
+// first unit is a surrogate, sorts before the runes U+E000 to U+FFFF.
+func utf16Less(a, b string) bool {
+	for a != "" && b != "" {
+		ra, na := utf8.DecodeRuneInString(a)
+		rb, nb := utf8.DecodeRuneInString(b)
+		if ra != rb {
+			ua, ub := utf16Unit(ra), utf16Unit(rb)
+			if ua != ub {
+				return ua < ub
+			}
+			return ra < rb
+		}
+		a, b = a[na:], b[nb:]
+	}
+	return len(a) < len(b)
+}
+
+// utf16Unit returns the first UTF-16 code unit of r.
+func utf16Unit(r rune) rune {
+	if r >= 0x10000 {
+		return 0xD800 + (r-0x10000)>>10
+	}
+	return r
+}
+
+// writeCanonicalString writes s as a JSON string with only the escapes JCS
+// allows: \" and \\, the short forms \b \f \n \r \t, and \u00XX for the
+// other control characters. Invalid UTF-8 is written as U+FFFD.
+func writeCanonicalString(buf *bytes.Buffer, s string) {
+	buf.WriteByte('"')
+	start := 0
+	for i := 0; i < len(s); {
+		c := s[i]
+		if c >= utf8.RuneSelf {
+			r, size := utf8.DecodeRuneInString(s[i:])
+			if r == utf8.RuneError && size == 1 {
+				buf.WriteString(s[start:i])
+				buf.WriteRune(utf8.RuneError)
+				start = i + size
+			}
+			i += size
+			continue
+		}
+		if c >= 0x20 && c != '"' && c != '\\' {
+			i++
+			continue
+		}
+		buf.WriteString(s[start:i])
+		switch c {
+		case '"', '\\':
+			buf.WriteByte('\\')
+			buf.WriteByte(c)
+		case '\b':
+			buf.WriteString(`\b`)
+		case '\f':
+			buf.WriteString(`\f`)
+		case '\n':
+			buf.WriteString(`\n`)
+		case '\r':
+			buf.WriteString(`\r`)
+		case '\t':
+			buf.WriteString(`\t`)
+		default:
+			buf.WriteString(`\u00`)
+			buf.WriteByte(hexDigits[c>>4])
+			buf.WriteByte(hexDigits[c&0xf])
+		}
+		i++
+		start = i
+	}
+	buf.WriteString(s[start:])
+	buf.WriteByte('"')
+}
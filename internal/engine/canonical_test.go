@@ -0,0 +1,134 @@
+package engine
+
+import (
+	"crypto/sha256"
+	"errors"
+	"testing"
+
+	"github.com/474420502/xjson/internal/core"
+)
+
+func TestCanonicalBytes(t *testing.T) {
+	cases := map[string]string{
+		`{"b": 1, "a": [1.0, 1e2, -0.0, 0.1, 1e21, 1e-7, -2.50], " ": null}`: `{" ":null,"a":[1,100,0,0.1,1e+21,1e-7,-2.5],"b":1}`,
+		`{"z": {"y": true, "x": false}, "a": {}}`:                            `{"a":{},"z":{"x":false,"y":true}}`,
+		`"\u0008\f\n\u001f\"\\\/é😀\u2028"`:                                   "\"\\b\\f\\n\\u001f\\\"\\\\/é😀\u2028\"",
+		`{"\ue000": 1, "😀": 2, "é": 3, "e": 4}`:                              `{"e":4,"é":3,"😀":2,"` + "\ue000" + `":1}`,
+		`[9007199254740993.0, 9.007199254740993e15, 12345678901234567890]`:   `[9007199254740993,9007199254740993,12345678901234567000]`,
+		`[ ]`: `[]`,
+	}
+	for doc, want := range cases {
+		for name, parse := range testParsers {
+			root, err := parse([]byte(doc))
+			if err != nil {
+				t.Fatalf("%s: parse %s: %v", name, doc, err)
+			}
+			got, err := root.CanonicalBytes()
+			if err != nil || string(got) != want {
+				t.Errorf("%s: CanonicalBytes(%s) = %s, %v, want %s", name, doc, got, err, want)
+			}
+		}
+	}
+}
+
+func TestCanonicalDigestIgnoresHowTheDocumentWasBuilt(t *testing.T) {
+	const doc = `{"id": 7, "name": "ann", "tags": ["a", "b"], "score": 1.50, "meta": {"ok": true, "none": null}}`
+	digest := func(n core.Node) [32]byte {
+		t.Helper()
+		b, err := n.CanonicalBytes()
+		if err != nil {
+			t.Fatalf("CanonicalBytes failed: %v", err)
+		}
+		return sha256.Sum256(b)
+	}
+
+	parsed, err := Parse([]byte(doc))
+	if err != nil {
+		t.Fatalf("Parse failed: %v", err)
+	}
+	want := digest(parsed)
+
+	// Parse, then write every value back, moving keys to the end.
+	edited, err := Parse([]byte(doc))
+	if err != nil {
+		t.Fatalf("Parse failed: %v", err)
+	}
+	edited.Delete("id")
+	edited.Set("id", 7)
+	edited.Set("score", 1.5)
+	edited.Get("tags").SetIndex(0, "a")
+	edited.Get("meta").Delete("ok")
+	edited.Get("meta").Set("ok", true)
+	if got := edited.String(); got == parsed.String() {
+		t.Fatalf("the edits should change the serialized key order, got %s", got)
+	}
+
+	built := NewNodeFromInterface(nil, map[string]interface{}{
+		"tags":  []interface{}{"a", "b"},
+		"meta":  map[string]interface{}{"none": nil, "ok": true},
+		"score": float32(1.5),
+		"name":  "ann",
+		"id":    int64(7),
+	}, nil)
+
+	full, err := MustParse([]byte(doc))
+	if err != nil {
+		t.Fatalf("MustParse failed: %v", err)
+	}
+	forceParseTree(full)
+
+	for name, n := range map[string]core.Node{"edited": edited, "built": built, "materialized": full} {
+		if got := digest(n); got != want {
+			t.Errorf("%s: digest differs: %s vs %s", name, n.Canonical(), parsed.Canonical())
+		}
+	}
+}
+
+func TestCanonicalAgreesWithEqual(t *testing.T) {
+	pairs := [][2]string{
+		{`{"a":1,"b":[1,2]}`, `{"b":[1.0,2e0],"a":1}`},
+		{`"café"`, `"café"`},
+		{`-0`, `0.0`},
+		{`1e400`, `1e400`},
+		{`9007199254740993`, `9007199254740993.0`},
+	}
+	for _, p := range pairs {
+		a, errA := Parse([]byte(p[0]))
+		b, errB := MustParse([]byte(p[1]))
+		if errA != nil || errB != nil {
+			t.Fatalf("parse %q: %v, %v", p, errA, errB)
+		}
+		if !Equal(a, b) {
+			t.Fatalf("%s and %s should be equal", p[0], p[1])
+		}
+		if a.Canonical() != b.Canonical() {
+			t.Errorf("Canonical(%s) = %s, Canonical(%s) = %s", p[0], a.Canonical(), p[1], b.Canonical())
+		}
+	}
+
+	a, _ := Parse([]byte(`{"a":1}`))
+	b, _ := Parse([]byte(`{"a":2}`))
+	if a.Canonical() == b.Canonical() {
+		t.Error("different values should encode differently")
+	}
+}
+
+func TestCanonicalMatchSetsAndErrors(t *testing.T) {
+	root, err := Parse([]byte(`{"items":[{"b":1,"a":2},{"b":3}]}`))
+	if err != nil {
+		t.Fatalf("Parse failed: %v", err)
+	}
+	if got := root.Query("/items[*]").Canonical(); got != `[{"a":2,"b":1},{"b":3}]` {
+		t.Errorf("match set = %s", got)
+	}
+	if got := root.Query("/items[?(@.a)]").Canonical(); got != `{"a":2,"b":1}` {
+		t.Errorf("single match = %s", got)
+	}
+	if _, err := root.Query("/items[?(@.c)]").CanonicalBytes(); !errors.Is(err, core.ErrNoMatches) {
+		t.Errorf("empty match set error = %v", err)
+	}
+	missing := root.Query("/missing")
+	if _, err := missing.CanonicalBytes(); err == nil || missing.Canonical() != "" {
+		t.Error("an invalid node should have no canonical form")
+	}
+}
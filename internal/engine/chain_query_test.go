@@ -0,0 +1,129 @@
+package engine
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+
+	"github.com/474420502/xjson/internal/core"
+)
+
+const chainDoc = `{
+	"stores": [
+		{"name": "north", "book": [
+			{"title": "A", "price": 8, "tags": ["x", "y"]},
+			{"title": "B", "price": 15, "tags": ["z"]}
+		]},
+		{"name": "south", "book": [
+			{"title": "C", "price": 4, "tags": []}
+		]}
+	],
+	"store": {"book": [
+		{"title": "D", "price": 9, "tags": ["w"]},
+		{"title": "E", "price": 30, "tags": ["v"]}
+	]}
+}`
+
+func TestQueryGetQueryChains(t *testing.T) {
+	testCases := []struct {
+		name  string
+		chain func(root core.Node) core.Node
+		want  []string
+	}{
+		{"filter", func(root core.Node) core.Node {
+			return root.Query("store").Get("book").Query("[?(@.price < 10)]/title")
+		}, []string{"D"}},
+		{"wildcard", func(root core.Node) core.Node {
+			return root.Query("store").Get("book").Query("[*]/title")
+		}, []string{"D", "E"}},
+		{"slice", func(root core.Node) core.Node {
+			return root.Query("store").Get("book").Query("[1:]/title")
+		}, []string{"E"}},
+		{"index", func(root core.Node) core.Node {
+			return root.Query("store").Get("book").Query("[-1]/title")
+		}, []string{"E"}},
+		{"recursive", func(root core.Node) core.Node {
+			return root.Query("store").Get("book").Query("//title")
+		}, []string{"D", "E"}},
+		{"function", func(root core.Node) core.Node {
+			return root.Query("store").Get("book").Query("[@cheap]/title")
+		}, []string{"D"}},
+		{"get on a single recursive match", func(root core.Node) core.Node {
+			return root.Query("//store").Get("book").Query("[?(@.price > 10)]/title")
+		}, []string{"E"}},
+		{"get on a single filter match", func(root core.Node) core.Node {
+			return root.Query("/stores[?(@.name == 'south')]").Get("book").Query("[*]/title")
+		}, []string{"C"}},
+		{"get on several matches", func(root core.Node) core.Node {
+			return root.Query("/stores[*]").Get("name")
+		}, []string{"north", "south"}},
+		{"get on a slice", func(root core.Node) core.Node {
+			return root.Query("/stores[0:1]").Get("book").Query("//title")
+		}, []string{"A", "B"}},
+		{"query per match", func(root core.Node) core.Node {
+			return root.Query("/stores[*]").Query("name")
+		}, []string{"north", "south"}},
+		{"recursive per match", func(root core.Node) core.Node {
+			return root.Query("/stores[*]").Query("//title")
+		}, []string{"A", "B", "C"}},
+		{"function on several matches", func(root core.Node) core.Node {
+			return root.Query("/store/book[*]").Query("[@cheap]").Get("title")
+		}, []string{"D"}},
+	}
+	cheap := func(n core.Node) core.Node {
+		return n.Filter(func(book core.Node) bool { return book.Get("price").Float() < 10 })
+	}
+	for _, tc := range testCases {
+		for name, parse := range testParsers {
+			t.Run(tc.name+"/"+name, func(t *testing.T) {
+				root, err := parse([]byte(chainDoc))
+				if err != nil {
+					t.Fatalf("parse failed: %v", err)
+				}
+				root.RegisterFunc("cheap", cheap)
+				result := tc.chain(root)
+				if !result.IsValid() {
+					t.Fatalf("chain failed: %v", result.Error())
+				}
+				var got []string
+				for _, v := range result.Values() {
+					s, _ := v.(string)
+					got = append(got, s)
+				}
+				if !reflect.DeepEqual(got, tc.want) {
+					t.Fatalf("chain = %v, want %v", got, tc.want)
+				}
+			})
+		}
+	}
+}
+
+func TestGetOnMatchSets(t *testing.T) {
+	root, err := Parse([]byte(chainDoc))
+	if err != nil {
+		t.Fatalf("Parse failed: %v", err)
+	}
+	// A single match stands for itself, so writes reach the document.
+	root.Query("/stores[?(@.name == 'south')]").Get("book").Index(0).Set("price", 1)
+	if got := root.Query("/stores[1]/book[0]/price").Int(); got != 1 {
+		t.Errorf("write through Get on a match = %d, want 1", got)
+	}
+	if res := root.Query("/stores[*]").Get("missing"); res.IsValid() {
+		t.Errorf("Get of a key no match has = %s, want an invalid node", res.Raw())
+	}
+	if res := root.Query("/stores[?(@.name == 'east')]").Get("book"); !errors.Is(res.Error(), core.ErrNoMatches) {
+		t.Errorf("Get on an empty result = %v, want ErrNoMatches", res.Error())
+	}
+	if res := root.Query("//title").Get("x"); res.IsValid() {
+		t.Errorf("Get on scalar matches = %s, want an invalid node", res.Raw())
+	}
+	if res := root.Get("stores").Get("name"); res.IsValid() {
+		t.Errorf("Get on a document array = %s, want an invalid node", res.Raw())
+	}
+	many := root.Query("/stores[*]")
+	for _, key := range []string{"name", "book", "missing"} {
+		if got, want := many.HasKey(key), many.Get(key).IsValid(); got != want {
+			t.Errorf("HasKey(%q) = %v, Get says %v", key, got, want)
+		}
+	}
+}
@@ -0,0 +1,474 @@
+package engine
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/474420502/xjson/internal/core"
+)
+
+// GetCompat evaluates a gjson path against doc, so code migrating from gjson
+// can keep its paths while it moves to xjson queries. Supported are dot
+// paths with \-escaped dots, numeric components as array indices, # for the
+// length of an array, # followed by a path to collect that path from every
+// element, #(...) for the first element matching a query and #(...)# for all
+// of them. Queries compare with ==, =, !=, <, <=, >, >=, % and !% (pattern
+// match with * and ?) against a string, number, true or false, or test
+// that a path exists, and may nest.
+//
+// Modifiers (@reverse), pipes (|), multipaths ({...} and [...]), wildcards
+// in keys (* and ?), JSON lines (..), literals (!true) and ~ truthiness in
+// queries are not supported; such paths return an invalid node whose error
+// names the construct. A path that exists in no value returns an invalid
+// node as well. Collected values are returned as an array that holds the
+// nodes of doc. A slash path is read as the dot path compatSlashAlias makes
+// of it when the path as written matches nothing, and one that still
+// matches nothing gets the slash syntax hint.
+func GetCompat(doc core.Node, path string) core.Node {
+	if doc == nil {
+		return newInvalidNode(&core.PathError{Path: path, Op: "GetCompat", Err: fmt.Errorf("nil document")})
+	}
+	if !doc.IsValid() {
+		return doc
+	}
+	var funcs *map[string]core.UnaryPathFunc
+	if bn := nodeBase(doc); bn != nil {
+		funcs = bn.funcs
+	}
+	steps, err := parseCompatPath(path)
+	if err == nil {
+		if result, ok := evalCompat(doc, steps, funcs); ok {
+			return result
+		}
+		err = fmt.Errorf("no value at path")
+	}
+	// A slash path such as /a/b/0 is read as a.b.0 when that is all it can
+	// mean; the path as written wins when it matches.
+	if alias, ok := compatSlashAlias(path); ok {
+		if aliasSteps, aliasErr := parseCompatPath(alias); aliasErr == nil {
+			if result, ok := evalCompat(doc, aliasSteps, funcs); ok {
+				return result
+			}
+		}
+	}
+	failed := newInvalidNode(&core.PathError{Path: path, Op: "GetCompat", Err: err})
+	if looksLikeSlashPath(path) {
+		return withHint(failed, slashSyntaxHint)
+	}
+	return failed
+}
+
+type compatKind int
+
+const (
+	compatKey compatKind = iota
+	compatCount
+	compatQuery
+)
+
+// compatStep is one dot-separated component of a gjson path.
+type compatStep struct {
+	kind  compatKind
+	key   string
+	query *compatCond
+	all   bool
+}
+
+// compatCond is the condition of a #(...) query. An empty path tests the
+// element itself; an empty op only tests that the path exists. A quoted
+// value is stored unquoted and unescaped.
+type compatCond struct {
+	path  []compatStep
+	op    string
+	value string
+}
+
+func parseCompatPath(path string) ([]compatStep, error) {
+	switch {
+	case path == "":
+		return nil, fmt.Errorf("empty path")
+	case strings.HasPrefix(path, ".."):
+		return nil, fmt.Errorf("JSON lines (..) are not supported")
+	case path[0] == '{' || path[0] == '[':
+		return nil, fmt.Errorf("multipaths are not supported")
+	case path[0] == '!':
+		return nil, fmt.Errorf("literals (!) are not supported")
+	}
+
+	var steps []compatStep
+	for i := 0; ; {
+		step, next, err := parseCompatStep(path, i)
+		if err != nil {
+			return nil, err
+		}
+		steps = append(steps, step)
+		if next == len(path) {
+			return steps, nil
+		}
+		i = next + 1
+		if i == len(path) {
+			return nil, fmt.Errorf("path ends with a dot")
+		}
+	}
+}
+
+// parseCompatStep parses the component starting at path[i] and returns the
+// index of the dot that ends it, or len(path).
+func parseCompatStep(path string, i int) (compatStep, int, error) {
+	if path[i] == '@' {
+		return compatStep{}, 0, fmt.Errorf("modifiers (@) are not supported")
+	}
+	if strings.HasPrefix(path[i:], "#(") {
+		return parseCompatQuery(path, i)
+	}
+
+	var key []byte
+	escaped := false
+	j := i
+scan:
+	for ; j < len(path); j++ {
+		switch c := path[j]; c {
+		case '\\':
+			j++
+			if j == len(path) {
+				return compatStep{}, 0, fmt.Errorf("path ends with an escape")
+			}
+			key = append(key, path[j])
+			escaped = true
+		case '.':
+			break scan
+		case '|':
+			return compatStep{}, 0, fmt.Errorf("pipes (|) are not supported")
+		case '*', '?':
+			return compatStep{}, 0, fmt.Errorf("wildcards (%c) in keys are not supported", c)
+		default:
+			key = append(key, c)
+		}
+	}
+	if len(key) == 0 {
+		return compatStep{}, 0, fmt.Errorf("empty path component at offset %d", i)
+	}
+	if !escaped && string(key) == "#" {
+		return compatStep{kind: compatCount}, j, nil
+	}
+	return compatStep{kind: compatKey, key: string(key)}, j, nil
+}
+
+// parseCompatQuery parses a #(...) or #(...)# component at path[i].
+func parseCompatQuery(path string, i int) (compatStep, int, error) {
+	depth := 0
+	inString := false
+	end := -1
+scan:
+	for j := i + 1; j < len(path); j++ {
+		c := path[j]
+		switch {
+		case inString && c == '\\':
+			j++
+		case c == '"':
+			inString = !inString
+		case inString:
+		case c == '(':
+			depth++
+		case c == ')':
+			depth--
+			if depth == 0 {
+				end = j
+				break scan
+			}
+		}
+	}
+	if end < 0 {
+		return compatStep{}, 0, fmt.Errorf("unterminated query at offset %d", i)
+	}
+	cond, err := parseCompatCond(path[i+2 : end])
+	if err != nil {
+		return compatStep{}, 0, err
+	}
+	step := compatStep{kind: compatQuery, query: cond}
+	next := end + 1
+	if next < len(path) && path[next] == '#' {
+		step.all = true
+		next++
+	}
+	if next < len(path) {
+		switch path[next] {
+		case '.':
+		case '|':
+			return compatStep{}, 0, fmt.Errorf("pipes (|) are not supported")
+		default:
+			return compatStep{}, 0, fmt.Errorf("unexpected %q after query at offset %d", path[next], next)
+		}
+	}
+	return step, next, nil
+}
+
+var compatOps = []string{"==", "!=", "<=", ">=", "!%", "=", "<", ">", "%"}
+
+func parseCompatCond(expr string) (*compatCond, error) {
+	depth := 0
+	inString := false
+	opAt := -1
+scan:
+	for j := 0; j < len(expr); j++ {
+		c := expr[j]
+		switch {
+		case inString && c == '\\':
+			j++
+		case c == '"':
+			inString = !inString
+		case inString:
+		case c == '\\':
+			j++
+		case c == '(':
+			depth++
+		case c == ')':
+			depth--
+		case depth == 0 && strings.IndexByte("=!<>%", c) >= 0:
+			opAt = j
+			break scan
+		}
+	}
+
+	cond := &compatCond{}
+	lhs := expr
+	if opAt >= 0 {
+		lhs = expr[:opAt]
+		rest := expr[opAt:]
+		for _, op := range compatOps {
+			if strings.HasPrefix(rest, op) {
+				cond.op = op
+				break
+			}
+		}
+		if cond.op == "" {
+			return nil, fmt.Errorf("invalid query operator in %q", expr)
+		}
+		cond.value = strings.TrimSpace(rest[len(cond.op):])
+		if cond.value == "" {
+			return nil, fmt.Errorf("query %q has no value", expr)
+		}
+		if cond.value[0] == '~' {
+			return nil, fmt.Errorf("truthiness (~) in queries is not supported")
+		}
+		if v := cond.value; len(v) >= 2 && v[0] == '"' && v[len(v)-1] == '"' {
+			decoded, err := appendUnescaped(nil, []byte(v[1:len(v)-1]))
+			if err != nil {
+				return nil, fmt.Errorf("invalid query value %s: %v", v, err)
+			}
+			cond.value = string(decoded)
+		}
+		if cond.op == "=" {
+			cond.op = "=="
+		}
+	}
+	lhs = strings.TrimSpace(lhs)
+	if lhs == "" {
+		if cond.op == "" {
+			return nil, fmt.Errorf("empty query")
+		}
+		return cond, nil
+	}
+	path, err := parseCompatPath(lhs)
+	if err != nil {
+		return nil, err
+	}
+	cond.path = path
+	return cond, nil
+}
+
+// evalCompat applies steps to node and reports whether a value was found.
+func evalCompat(node core.Node, steps []compatStep, funcs *map[string]core.UnaryPathFunc) (core.Node, bool) {
+	for i, step := range steps {
+		rest := steps[i+1:]
+		switch step.kind {
+		case compatKey:
+			switch node.Type() {
+			case core.Object:
+				node = node.Get(step.key)
+			case core.Array:
+				idx, err := strconv.Atoi(step.key)
+				if err != nil || idx < 0 {
+					return nil, false
+				}
+				node = node.Index(idx)
+			default:
+				return nil, false
+			}
+			if !node.IsValid() {
+				return nil, false
+			}
+		case compatCount:
+			if node.Type() != core.Array {
+				return nil, false
+			}
+			if len(rest) == 0 {
+				return NewNumberNode(nil, strconv.AppendInt(nil, int64(node.Len()), 10), funcs), true
+			}
+			return collectCompat(compatElements(node), rest, funcs), true
+		case compatQuery:
+			if node.Type() != core.Array {
+				return nil, false
+			}
+			var matches []core.Node
+			for _, elem := range compatElements(node) {
+				if step.query.matches(elem, funcs) {
+					matches = append(matches, elem)
+					if !step.all {
+						break
+					}
+				}
+			}
+			if step.all {
+				return collectCompat(matches, rest, funcs), true
+			}
+			if len(matches) == 0 {
+				return nil, false
+			}
+			node = matches[0]
+		}
+	}
+	return node, true
+}
+
+func compatElements(array core.Node) []core.Node {
+	elems := make([]core.Node, array.Len())
+	for i := range elems {
+		elems[i] = array.Index(i)
+	}
+	return elems
+}
+
+// collectCompat applies steps to every node and gathers the values found
+// into an array, the way gjson answers # and #(...)# paths.
+func collectCompat(nodes []core.Node, steps []compatStep, funcs *map[string]core.UnaryPathFunc) core.Node {
+	values := make([]core.Node, 0, len(nodes))
+	for _, node := range nodes {
+		if value, ok := evalCompat(node, steps, funcs); ok {
+			values = append(values, value)
+		}
+	}
+	n := NewArrayNode(nil, nil, funcs).(*arrayNode)
+	n.value = values
+	n.isDirty = true
+	return n
+}
+
+// matches reports whether elem satisfies the condition, comparing the way
+// gjson does: strings as text, numbers as floats (a value that is not a
+// number counts as 0), booleans against true and false, and never null.
+func (c *compatCond) matches(elem core.Node, funcs *map[string]core.UnaryPathFunc) bool {
+	value := elem
+	if len(c.path) > 0 {
+		var ok bool
+		if value, ok = evalCompat(elem, c.path, funcs); !ok {
+			return false
+		}
+	}
+	if c.op == "" {
+		return true
+	}
+
+	switch value.Type() {
+	case core.String:
+		want := c.value
+		got := value.String()
+		switch c.op {
+		case "==":
+			return got == want
+		case "!=":
+			return got != want
+		case "<":
+			return got < want
+		case "<=":
+			return got <= want
+		case ">":
+			return got > want
+		case ">=":
+			return got >= want
+		case "%":
+			return matchCompatPattern(got, want)
+		case "!%":
+			return !matchCompatPattern(got, want)
+		}
+	case core.Number:
+		want, _ := strconv.ParseFloat(c.value, 64)
+		got := value.Float()
+		switch c.op {
+		case "==":
+			return got == want
+		case "!=":
+			return got != want
+		case "<":
+			return got < want
+		case "<=":
+			return got <= want
+		case ">":
+			return got > want
+		case ">=":
+			return got >= want
+		}
+	case core.Bool:
+		if value.Bool() {
+			switch c.op {
+			case "==":
+				return c.value == "true"
+			case "!=":
+				return c.value != "true"
+			case ">":
+				return c.value == "false"
+			case ">=":
+				return true
+			}
+		} else {
+			switch c.op {
+			case "==":
+				return c.value == "false"
+			case "!=":
+				return c.value != "false"
+			case "<":
+				return c.value == "true"
+			case "<=":
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// matchCompatPattern matches s against a gjson pattern, where * matches any
+// run of characters, ? any single character and \ escapes the next one.
+func matchCompatPattern(s, pattern string) bool {
+	if pattern == "" {
+		return s == ""
+	}
+	switch pattern[0] {
+	case '*':
+		for i := 0; ; {
+			if matchCompatPattern(s[i:], pattern[1:]) {
+				return true
+			}
+			if i == len(s) {
+				return false
+			}
+			_, size := utf8.DecodeRuneInString(s[i:])
+			i += size
+		}
+	case '?':
+		if s == "" {
+			return false
+		}
+		_, size := utf8.DecodeRuneInString(s)
+		return matchCompatPattern(s[size:], pattern[1:])
+	case '\\':
+		if len(pattern) > 1 {
+			pattern = pattern[1:]
+		}
+	}
+	if s == "" || s[0] != pattern[0] {
+		return false
+	}
+	return matchCompatPattern(s[1:], pattern[1:])
+}
@@ -0,0 +1,50 @@
+package engine
+
+import "testing"
+
+func TestMatchCompatPattern(t *testing.T) {
+	cases := []struct {
+		s, pattern string
+		want       bool
+	}{
+		{"Dale", "D*", true},
+		{"Dale", "*e", true},
+		{"Dale", "?ale", true},
+		{"Dale", "?le", false},
+		{"héllo", "h?llo", true},
+		{"a*b", `a\*b`, true},
+		{"axb", `a\*b`, false},
+		{"", "*", true},
+		{"", "?", false},
+		{"abc", "", false},
+		{"abcabd", "*ab?", true},
+	}
+	for _, tc := range cases {
+		if got := matchCompatPattern(tc.s, tc.pattern); got != tc.want {
+			t.Errorf("matchCompatPattern(%q, %q) = %v, want %v", tc.s, tc.pattern, got, tc.want)
+		}
+	}
+}
+
+func TestParseCompatPath(t *testing.T) {
+	steps, err := parseCompatPath(`a\.b.#(nets.#(=="f\"b"))#.#`)
+	if err != nil {
+		t.Fatalf("parse failed: %v", err)
+	}
+	if len(steps) != 3 || steps[0].key != "a.b" || steps[1].kind != compatQuery || !steps[1].all || steps[2].kind != compatCount {
+		t.Fatalf("unexpected steps %+v", steps)
+	}
+	inner := steps[1].query.path
+	if len(inner) != 2 || inner[0].key != "nets" || inner[1].query.value != `f"b` || inner[1].query.op != "==" {
+		t.Errorf("unexpected nested query %+v", inner)
+	}
+
+	if steps, err := parseCompatPath(`\#.x`); err != nil || steps[0].kind != compatKey || steps[0].key != "#" {
+		t.Errorf("escaped # should be a key, got %+v, %v", steps, err)
+	}
+	for _, path := range []string{"a..b", `a\`, "#(a==1)x", "#()", "#(a>)"} {
+		if _, err := parseCompatPath(path); err == nil {
+			t.Errorf("%q: expected an error", path)
+		}
+	}
+}
@@ -0,0 +1,213 @@
+package engine
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/474420502/xjson/internal/core"
+)
+
+// The files in testdata/jsontestsuite are the parsing cases of
+// JSONTestSuite (https://github.com/nst/JSONTestSuite): y_ files must be
+// accepted, n_ files rejected, and i_ files are left to the parser. The two
+// n_ cases made of a long run of one pattern are built by
+// suiteGeneratedCases instead of being shipped.
+
+// suiteImplementationDefined records what is decided for each i_ case:
+// whether it is accepted, and whether ParseOptions.ValidateUTF8 rejects it.
+// Numbers out of the float64 range are kept as text, see ErrNumberOverflow;
+// strings with lone surrogate escapes or invalid UTF-8 are accepted unless
+// ValidateUTF8 is set; byte order marks and UTF-16 are rejected.
+var suiteImplementationDefined = map[string]struct{ accept, validateUTF8 bool }{
+	"i_number_double_huge_neg_exp":                   {true, true},
+	"i_number_huge_exp":                              {true, true},
+	"i_number_neg_int_huge_exp":                      {true, true},
+	"i_number_pos_double_huge_exp":                   {true, true},
+	"i_number_real_neg_overflow":                     {true, true},
+	"i_number_real_pos_overflow":                     {true, true},
+	"i_number_real_underflow":                        {true, true},
+	"i_number_too_big_neg_int":                       {true, true},
+	"i_number_too_big_pos_int":                       {true, true},
+	"i_number_very_big_negative_int":                 {true, true},
+	"i_object_key_lone_2nd_surrogate":                {true, false},
+	"i_string_1st_surrogate_but_2nd_missing":         {true, false},
+	"i_string_1st_valid_surrogate_2nd_invalid":       {true, false},
+	"i_string_UTF-16LE_with_BOM":                     {false, false},
+	"i_string_UTF-8_invalid_sequence":                {true, false},
+	"i_string_UTF8_surrogate_U+D800":                 {true, false},
+	"i_string_incomplete_surrogate_and_escape_valid": {true, false},
+	"i_string_incomplete_surrogate_pair":             {true, false},
+	"i_string_incomplete_surrogates_escape_valid":    {true, false},
+	"i_string_invalid_lonely_surrogate":              {true, false},
+	"i_string_invalid_surrogate":                     {true, false},
+	"i_string_invalid_utf-8":                         {true, false},
+	"i_string_inverted_surrogates_U+1D11E":           {true, false},
+	"i_string_iso_latin_1":                           {true, false},
+	"i_string_lone_second_surrogate":                 {true, false},
+	"i_string_lone_utf8_continuation_byte":           {true, false},
+	"i_string_not_in_unicode_range":                  {true, false},
+	"i_string_overlong_sequence_2_bytes":             {true, false},
+	"i_string_overlong_sequence_6_bytes":             {true, false},
+	"i_string_overlong_sequence_6_bytes_null":        {true, false},
+	"i_string_truncated-utf-8":                       {true, false},
+	"i_string_utf16BE_no_BOM":                        {false, false},
+	"i_string_utf16LE_no_BOM":                        {false, false},
+	"i_structure_500_nested_arrays":                  {true, true},
+	"i_structure_UTF-8_BOM_empty_object":             {false, false},
+}
+
+func suiteGeneratedCases() map[string][]byte {
+	return map[string][]byte{
+		"n_structure_100000_opening_arrays": []byte(strings.Repeat("[", 100000)),
+		"n_structure_open_array_object":     []byte(strings.Repeat(`[{"":`, 50000) + "\n"),
+	}
+}
+
+func loadSuite(t *testing.T) map[string][]byte {
+	t.Helper()
+	files, err := filepath.Glob(filepath.Join("testdata", "jsontestsuite", "*.json"))
+	if err != nil || len(files) == 0 {
+		t.Fatalf("no JSONTestSuite files: %v", err)
+	}
+	cases := suiteGeneratedCases()
+	for _, file := range files {
+		data, err := os.ReadFile(file)
+		if err != nil {
+			t.Fatal(err)
+		}
+		cases[strings.TrimSuffix(filepath.Base(file), ".json")] = data
+	}
+	return cases
+}
+
+// readAll reads every value of a lazily parsed document, returning the
+// first error met.
+func readAll(n core.Node) error {
+	if err := n.Error(); err != nil {
+		return err
+	}
+	switch n.Type() {
+	case core.Object:
+		keys := n.Keys()
+		if err := n.Error(); err != nil {
+			return err
+		}
+		for _, key := range keys {
+			if err := readAll(n.Get(key)); err != nil {
+				return err
+			}
+		}
+	case core.Array:
+		l := n.Len()
+		if err := n.Error(); err != nil {
+			return err
+		}
+		for i := 0; i < l; i++ {
+			if err := readAll(n.Index(i)); err != nil {
+				return err
+			}
+		}
+	case core.String:
+		if _, err := n.TryString(); err != nil {
+			return err
+		}
+	}
+	return n.Error()
+}
+
+// suiteResults parses data every way a document can be read and reports
+// which of them failed.
+func suiteResults(data []byte) map[string]error {
+	results := map[string]error{}
+	_, results["MustParse"] = MustParse(data)
+	results["Scan"] = Scan(data, NopVisitor{})
+	results["ValidateBytes"] = ValidateBytes(data)
+	root, err := Parse(data)
+	if err == nil {
+		err = readAll(root)
+	}
+	results["Parse"] = err
+	return results
+}
+
+func TestJSONTestSuite(t *testing.T) {
+	cases := loadSuite(t)
+	counts := map[byte]int{}
+	for name, data := range cases {
+		counts[name[0]]++
+		results := suiteResults(data)
+		switch name[0] {
+		case 'y':
+			for how, err := range results {
+				if err != nil {
+					t.Errorf("%s: %s rejected it: %v", name, how, err)
+				}
+			}
+		case 'n':
+			for how, err := range results {
+				if err == nil {
+					t.Errorf("%s: %s accepted it", name, how)
+				}
+			}
+		case 'i':
+			decision, ok := suiteImplementationDefined[name]
+			if !ok {
+				t.Errorf("%s: no decision recorded", name)
+				continue
+			}
+			for how, err := range results {
+				if (err == nil) != decision.accept {
+					t.Errorf("%s: %s error %v, want accepted %v", name, how, err, decision.accept)
+				}
+			}
+			_, err := ParseWithOptions(data, ParseOptions{ValidateUTF8: true})
+			if (err == nil) != decision.validateUTF8 {
+				t.Errorf("%s: with ValidateUTF8 error %v, want accepted %v", name, err, decision.validateUTF8)
+			}
+		default:
+			t.Errorf("%s: unknown kind of case", name)
+		}
+	}
+	if counts['y'] != 95 || counts['n'] != 188 || counts['i'] != 35 {
+		t.Errorf("suite has %d y_, %d n_ and %d i_ cases, want 95, 188 and 35", counts['y'], counts['n'], counts['i'])
+	}
+}
+
+func TestLeniencyOptions(t *testing.T) {
+	docs := map[string]ParseOptions{
+		`{"a":[1,2,],"b":{"c":1,},}`: {AllowTrailingCommas: true},
+		`[[1,],{"a":[],},]`:          {AllowTrailingCommas: true},
+		`{"a":[1]} {"a":[2]}`:        {AllowTrailingData: true},
+		`[1] x`:                      {AllowTrailingData: true},
+		`"s" "t"`:                    {AllowTrailingData: true},
+	}
+	for doc, opts := range docs {
+		if _, err := MustParse([]byte(doc)); err == nil {
+			t.Errorf("MustParse(%s) should fail", doc)
+		}
+		strict, err := Parse([]byte(doc))
+		if err == nil {
+			err = readAll(strict)
+		}
+		if err == nil {
+			t.Errorf("reading %s without the option should fail", doc)
+		}
+		root, err := ParseWithOptions([]byte(doc), opts)
+		if err != nil {
+			t.Errorf("ParseWithOptions(%s) failed: %v", doc, err)
+			continue
+		}
+		if err := readAll(root); err != nil {
+			t.Errorf("reading %s with %+v failed: %v", doc, opts, err)
+		}
+		// Recursive scans and copies follow the document's options.
+		if res := root.Query("//*"); res.Error() != nil {
+			t.Errorf("//* on %s failed: %v", doc, res.Error())
+		}
+		if copied := NewNodeFromInterface(nil, root, root.GetFuncs()); copied.Error() != nil {
+			t.Errorf("copying %s failed: %v", doc, copied.Error())
+		}
+	}
+}
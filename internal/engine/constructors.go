@@ -1,7 +1,10 @@
 package engine
 
 import (
+	"encoding/json"
+	"errors"
 	"fmt"
+	"math"
 	"strconv"
 	"unsafe"
 
@@ -15,31 +18,42 @@ func newInvalidNode(err error) core.Node {
 }
 
 func NewObjectNode(parent core.Node, raw []byte, funcs *map[string]core.UnaryPathFunc) core.Node {
-	n := &objectNode{
-		baseNode: baseNode{
-			raw:    raw,
-			parent: parent,
-			funcs:  funcs,
-		},
-		// Don't pre-allocate map - allocate only when needed to reduce memory pressure
-	}
+	return initObjectNode(&objectNode{}, parent, raw, funcs)
+}
+
+// initObjectNode sets up a zero objectNode. The init* helpers let the parser
+// place nodes in a pool's blocks instead of allocating each one.
+func initObjectNode(n *objectNode, parent core.Node, raw []byte, funcs *map[string]core.UnaryPathFunc) *objectNode {
+	n.raw = raw
+	n.parent = parent
+	n.funcs = funcs
+	// Don't pre-allocate map - allocate only when needed to reduce memory pressure
 	n.baseNode.self = n
 	return n
 }
 
 func NewArrayNode(parent core.Node, raw []byte, funcs *map[string]core.UnaryPathFunc) core.Node {
-	n := &arrayNode{
-		baseNode: baseNode{
-			raw:    raw,
-			parent: parent,
-			funcs:  funcs,
-		},
-		value: make([]core.Node, 0),
-	}
+	return initArrayNode(&arrayNode{}, parent, raw, funcs)
+}
+
+func initArrayNode(n *arrayNode, parent core.Node, raw []byte, funcs *map[string]core.UnaryPathFunc) *arrayNode {
+	n.raw = raw
+	n.parent = parent
+	n.funcs = funcs
+	n.value = make([]core.Node, 0)
 	n.baseNode.self = n
 	return n
 }
 
+// newMatchSet wraps the nodes selected by a multi-match query step.
+func newMatchSet(parent core.Node, results []core.Node, funcs *map[string]core.UnaryPathFunc) core.Node {
+	n := NewArrayNode(parent, nil, funcs).(*arrayNode)
+	n.value = results
+	n.isDirty = true
+	n.matchSet = true
+	return n
+}
+
 func NewStringNode(parent core.Node, val string, funcs *map[string]core.UnaryPathFunc) core.Node {
 	n := &stringNode{
 		baseNode: baseNode{
@@ -59,18 +73,16 @@ func NewStringNode(parent core.Node, val string, funcs *map[string]core.UnaryPat
 // start/end are indexes into raw for the unquoted value (start inclusive, end exclusive).
 // needsUnescape indicates whether the value contains escape sequences and must be unescaped when requested.
 func NewRawStringNode(parent core.Node, raw []byte, start int, end int, needsUnescape bool, funcs *map[string]core.UnaryPathFunc) core.Node {
-	n := &stringNode{
-		baseNode: baseNode{
-			raw:    raw,
-			parent: parent,
-			funcs:  funcs,
-			start:  start,
-			end:    end,
-		},
-		value:         "",
-		decoded:       false,
-		needsUnescape: needsUnescape,
-	}
+	return initRawStringNode(&stringNode{}, parent, raw, start, end, needsUnescape, funcs)
+}
+
+func initRawStringNode(n *stringNode, parent core.Node, raw []byte, start int, end int, needsUnescape bool, funcs *map[string]core.UnaryPathFunc) *stringNode {
+	n.raw = raw
+	n.parent = parent
+	n.funcs = funcs
+	n.start = start
+	n.end = end
+	n.needsUnescape = needsUnescape
 	n.baseNode.self = n
 	return n
 }
@@ -78,19 +90,14 @@ func NewRawStringNode(parent core.Node, raw []byte, start int, end int, needsUne
 // NewDecodedStringNode creates a string node from an already-unescaped byte slice.
 // The provided bytes will be owned by the node (caller should not mutate it).
 func NewDecodedStringNode(parent core.Node, decoded []byte, funcs *map[string]core.UnaryPathFunc) core.Node {
-	n := &stringNode{
-		baseNode: baseNode{
-			raw:    nil,
-			parent: parent,
-			funcs:  funcs,
-			start:  0,
-			end:    0,
-		},
-		value:         "",
-		decoded:       true,
-		needsUnescape: false,
-		cachedDecoded: decoded,
-	}
+	return initDecodedStringNode(&stringNode{}, parent, decoded, funcs)
+}
+
+func initDecodedStringNode(n *stringNode, parent core.Node, decoded []byte, funcs *map[string]core.UnaryPathFunc) *stringNode {
+	n.parent = parent
+	n.funcs = funcs
+	n.decoded = true
+	n.cachedDecoded = decoded
 	if len(decoded) > 0 {
 		n.value = unsafe.String(&decoded[0], len(decoded))
 	} else {
@@ -101,42 +108,54 @@ func NewDecodedStringNode(parent core.Node, decoded []byte, funcs *map[string]co
 }
 
 func NewNumberNode(parent core.Node, raw []byte, funcs *map[string]core.UnaryPathFunc) core.Node {
-	n := &numberNode{
-		baseNode: baseNode{
-			raw:    raw,
-			parent: parent,
-			funcs:  funcs,
-		},
-	}
+	return initNumberNode(&numberNode{}, parent, raw, funcs)
+}
+
+func initNumberNode(n *numberNode, parent core.Node, raw []byte, funcs *map[string]core.UnaryPathFunc) *numberNode {
+	n.raw = raw
+	n.parent = parent
+	n.funcs = funcs
 	n.baseNode.self = n
 	return n
 }
 
+// newFloatNumberNode formats f the way encoding/json does. NaN and infinities
+// have no JSON representation and yield an invalid node, an infinity's error
+// wrapping core.ErrNumberOverflow.
+func newFloatNumberNode(parent core.Node, f float64, bits int, funcs *map[string]core.UnaryPathFunc) core.Node {
+	if math.IsInf(f, 0) {
+		return newInvalidNode(fmt.Errorf("unsupported number value %v: %w", f, core.ErrNumberOverflow))
+	}
+	if math.IsNaN(f) {
+		return newInvalidNode(fmt.Errorf("unsupported number value %v: JSON has no NaN", f))
+	}
+	return NewNumberNode(parent, appendJSONFloat(nil, f, bits), funcs)
+}
+
 func NewBoolNode(parent core.Node, val bool, funcs *map[string]core.UnaryPathFunc) core.Node {
-	raw := falseRawBytes
+	return initBoolNode(&boolNode{}, parent, val, funcs)
+}
+
+func initBoolNode(n *boolNode, parent core.Node, val bool, funcs *map[string]core.UnaryPathFunc) *boolNode {
+	n.raw = falseRawBytes
 	if val {
-		raw = trueRawBytes
-	}
-	n := &boolNode{
-		baseNode: baseNode{
-			raw:    raw,
-			parent: parent,
-			funcs:  funcs,
-		},
-		value: val,
+		n.raw = trueRawBytes
 	}
+	n.parent = parent
+	n.funcs = funcs
+	n.value = val
 	n.baseNode.self = n
 	return n
 }
 
 func NewNullNode(parent core.Node, funcs *map[string]core.UnaryPathFunc) core.Node {
-	n := &nullNode{
-		baseNode: baseNode{
-			raw:    []byte("null"),
-			parent: parent,
-			funcs:  funcs,
-		},
-	}
+	return initNullNode(&nullNode{}, parent, funcs)
+}
+
+func initNullNode(n *nullNode, parent core.Node, funcs *map[string]core.UnaryPathFunc) *nullNode {
+	n.raw = []byte("null")
+	n.parent = parent
+	n.funcs = funcs
 	n.baseNode.self = n
 	return n
 }
@@ -158,6 +177,10 @@ func NewNodeFromInterface(parent core.Node, v interface{}, funcs *map[string]cor
 			}
 			node.value[key] = child
 		}
+		// A Go map has no order: its keys come sorted, before any key
+		// added later.
+		node.ensureSortedKeys()
+		node.keyOrder = append([]string(nil), node.sortedKeys...)
 		return node
 	case []interface{}:
 		node := NewArrayNode(parent, nil, funcs).(*arrayNode)
@@ -174,16 +197,103 @@ func NewNodeFromInterface(parent core.Node, v interface{}, funcs *map[string]cor
 	case string:
 		return NewStringNode(parent, val, funcs)
 	case float64:
-		return NewNumberNode(parent, []byte(strconv.FormatFloat(val, 'f', -1, 64)), funcs)
+		return newFloatNumberNode(parent, val, 64, funcs)
+	case float32:
+		return newFloatNumberNode(parent, float64(val), 32, funcs)
 	case int:
-		return NewNumberNode(parent, []byte(strconv.Itoa(val)), funcs)
+		return NewNumberNode(parent, strconv.AppendInt(nil, int64(val), 10), funcs)
+	case int8:
+		return NewNumberNode(parent, strconv.AppendInt(nil, int64(val), 10), funcs)
+	case int16:
+		return NewNumberNode(parent, strconv.AppendInt(nil, int64(val), 10), funcs)
+	case int32:
+		return NewNumberNode(parent, strconv.AppendInt(nil, int64(val), 10), funcs)
 	case int64:
-		return NewNumberNode(parent, []byte(strconv.FormatInt(val, 10)), funcs)
+		return NewNumberNode(parent, strconv.AppendInt(nil, val, 10), funcs)
+	case uint:
+		return NewNumberNode(parent, strconv.AppendUint(nil, uint64(val), 10), funcs)
+	case uint8:
+		return NewNumberNode(parent, strconv.AppendUint(nil, uint64(val), 10), funcs)
+	case uint16:
+		return NewNumberNode(parent, strconv.AppendUint(nil, uint64(val), 10), funcs)
+	case uint32:
+		return NewNumberNode(parent, strconv.AppendUint(nil, uint64(val), 10), funcs)
+	case uint64:
+		return NewNumberNode(parent, strconv.AppendUint(nil, val, 10), funcs)
+	case json.Number:
+		if !isJSONNumber(string(val)) {
+			return newInvalidNode(fmt.Errorf("invalid json.Number %q", string(val)))
+		}
+		return NewNumberNode(parent, []byte(val), funcs)
 	case bool:
 		return NewBoolNode(parent, val, funcs)
 	case nil:
 		return NewNullNode(parent, funcs)
+	case core.Node:
+		return attachNodeValue(parent, val)
 	default:
 		return newInvalidNode(fmt.Errorf("unsupported type %T for NewNodeFromInterface", v))
 	}
 }
+
+// attachNodeValue makes node, given as a value, a child of parent. A node
+// has one parent, so it must be the root of a document of its own, such as
+// one that Parse, NewObject, FromValue or Detach returned; only a match set
+// takes the nodes of its document as they are. The target or one of its
+// ancestors would make the tree cyclic and fails with core.ErrCycleDetected.
+func attachNodeValue(parent core.Node, node core.Node) core.Node {
+	if wrapped, ok := node.(interface{ Unwrap() core.Node }); ok {
+		node = wrapped.Unwrap()
+	}
+	if !node.IsValid() {
+		return newInvalidNode(fmt.Errorf("invalid node as value: %w", node.Error()))
+	}
+	bn := nodeBase(node)
+	if bn == nil {
+		return newInvalidNode(fmt.Errorf("unsupported type %T for NewNodeFromInterface", node))
+	}
+	if set, ok := parent.(*arrayNode); ok && set.matchSet {
+		return node
+	}
+	for ancestor := nodeBase(parent); ancestor != nil; {
+		if ancestor == bn {
+			return newInvalidNode(fmt.Errorf("node value is the target or one of its ancestors: %w", core.ErrCycleDetected))
+		}
+		next := nodeBase(ancestor.parent)
+		if next == ancestor {
+			break
+		}
+		ancestor = next
+	}
+	if set, ok := node.(*arrayNode); ok && set.matchSet {
+		return newInvalidNode(errors.New("a match set cannot be a value: write its Interface() or Detach() it"))
+	}
+	if bn.parent != nil {
+		return newInvalidNode(fmt.Errorf("node value at %s belongs to a document: Detach() it to write a copy", node.Path()))
+	}
+	bn.clearQueryCache()
+	bn.parent = parent
+	return node
+}
+
+// holdsNode reports whether v is a node or a map or slice with one inside,
+// which a write attaches rather than encodes.
+func holdsNode(v interface{}) bool {
+	switch val := v.(type) {
+	case core.Node:
+		return true
+	case map[string]interface{}:
+		for _, value := range val {
+			if holdsNode(value) {
+				return true
+			}
+		}
+	case []interface{}:
+		for _, value := range val {
+			if holdsNode(value) {
+				return true
+			}
+		}
+	}
+	return false
+}
@@ -0,0 +1,64 @@
+package engine
+
+import (
+	"context"
+
+	"github.com/474420502/xjson/internal/core"
+)
+
+// cancelCheck lets a long query step stop once its context is done. The
+// steps that visit many values call stop once per value; a nil check never
+// stops, so the plain query methods pay nothing for it.
+type cancelCheck struct {
+	ctx  context.Context
+	done <-chan struct{}
+	err  error
+}
+
+func newCancelCheck(ctx context.Context) *cancelCheck {
+	return &cancelCheck{ctx: ctx, done: ctx.Done()}
+}
+
+// stop reports whether the query must stop, recording the context error.
+func (c *cancelCheck) stop() bool {
+	if c == nil {
+		return false
+	}
+	if c.err != nil {
+		return true
+	}
+	select {
+	case <-c.done:
+		c.err = c.ctx.Err()
+		return true
+	default:
+		return false
+	}
+}
+
+// Err returns the context error once stop has reported true.
+func (c *cancelCheck) Err() error {
+	if c == nil {
+		return nil
+	}
+	return c.err
+}
+
+// QueryContext is like Query but gives up once ctx is done, which bounds
+// recursive descent, wildcard expansion and filters over large documents.
+// The result is then invalid and its error wraps ctx.Err(). Results of a
+// cancelled query are never cached.
+func (n *baseNode) QueryContext(ctx context.Context, path string) core.Node {
+	if n.err != nil {
+		return newInvalidNode(n.err)
+	}
+	cc := newCancelCheck(ctx)
+	if cc.stop() {
+		return newInvalidNode(&core.PathError{Path: path, Op: "QueryContext", Err: cc.Err()})
+	}
+	result := applyQuery(queryStart(n.selfOrMe(), path), path, cc)
+	if err := cc.Err(); err != nil {
+		return newInvalidNode(&core.PathError{Path: path, Op: "QueryContext", Err: err})
+	}
+	return result
+}
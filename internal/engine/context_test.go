@@ -0,0 +1,91 @@
+package engine
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/474420502/xjson/internal/core"
+)
+
+// deepDocument nests depth objects, which makes a recursive search scan the
+// source quadratically.
+func deepDocument(depth int) []byte {
+	return []byte(strings.Repeat(`{"a":`, depth) + "1" + strings.Repeat("}", depth))
+}
+
+func TestQueryContextDeadlineStopsRecursiveDescent(t *testing.T) {
+	root, err := Parse(deepDocument(40000))
+	if err != nil {
+		t.Fatalf("parse failed: %v", err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+
+	begin := time.Now()
+	res := root.QueryContext(ctx, "//missing")
+	elapsed := time.Since(begin)
+
+	if res.IsValid() {
+		t.Fatal("expected the query to be cut short")
+	}
+	if !errors.Is(res.Error(), context.DeadlineExceeded) {
+		t.Fatalf("expected DeadlineExceeded, got %v", res.Error())
+	}
+	var pathErr *core.PathError
+	if !errors.As(res.Error(), &pathErr) || pathErr.Path != "//missing" {
+		t.Fatalf("expected a *core.PathError for the path, got %v", res.Error())
+	}
+	if elapsed > 500*time.Millisecond {
+		t.Fatalf("query took %v after a 10ms deadline", elapsed)
+	}
+	if _, cached := root.(*objectNode).getCachedQueryResult("//missing"); cached {
+		t.Fatal("the result of a cancelled query was cached")
+	}
+}
+
+func TestQueryContextCanceled(t *testing.T) {
+	doc := `{"items":[{"n":1},{"n":2},{"n":3}],"meta":{"n":4}}`
+	root, err := Parse([]byte(doc))
+	if err != nil {
+		t.Fatalf("parse failed: %v", err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	for _, path := range []string{"//n", "/items/*", "/items[?(@.n > 1)]", "/items/n", "/meta/n", "//*"} {
+		res := root.QueryContext(ctx, path)
+		if !errors.Is(res.Error(), context.Canceled) {
+			t.Errorf("%s: expected context.Canceled, got %v", path, res.Error())
+		}
+		// The same path without a context still runs and is not poisoned by
+		// the cancelled attempt.
+		if plain := root.Query(path); !plain.IsValid() || plain.Len() == 0 {
+			t.Errorf("%s: plain query failed after cancellation: %v", path, plain.Error())
+		}
+	}
+}
+
+func TestQueryContextMatchesQuery(t *testing.T) {
+	doc := `{"store":{"book":[{"title":"A","price":8},{"title":"B","price":22}],"bicycle":{"price":19}}}`
+	root, err := Parse([]byte(doc))
+	if err != nil {
+		t.Fatalf("parse failed: %v", err)
+	}
+	for _, path := range []string{"//price", "/store/book[?(@.price < 10)]/title", "/store/*", "/store/book/title", "/store/bicycle/price", "..*"} {
+		want := root.Query(path).String()
+		got := root.QueryContext(context.Background(), path)
+		if !got.IsValid() || got.String() != want {
+			t.Errorf("%s: QueryContext = %q (%v), Query = %q", path, got.String(), got.Error(), want)
+		}
+	}
+}
+
+func TestCancelCheckNil(t *testing.T) {
+	var cc *cancelCheck
+	if cc.stop() || cc.Err() != nil {
+		t.Fatal("a nil cancelCheck must never stop")
+	}
+}
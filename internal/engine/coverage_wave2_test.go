@@ -134,7 +134,7 @@ func TestGetWithPathAndIteratorBranches(t *testing.T) {
 		t.Fatal("expected missing object child to be invalid")
 	}
 
-	objIter := obj.Iter()
+	objIter := obj.rawIter()
 	for objIter.Next() {
 		_ = objIter.KeyRaw()
 		_ = objIter.ValueRaw()
@@ -145,7 +145,7 @@ func TestGetWithPathAndIteratorBranches(t *testing.T) {
 	}
 
 	arr := root.Query("/arr").(*arrayNode)
-	arrIter := arr.Iter()
+	arrIter := arr.rawIter()
 	for arrIter.Next() {
 		_ = arrIter.Index()
 		_ = arrIter.ValueRaw()
@@ -155,11 +155,11 @@ func TestGetWithPathAndIteratorBranches(t *testing.T) {
 		t.Fatalf("unexpected array iterator error: %v", arrIter.Err())
 	}
 
-	nilObjIter := (*objectNode)(nil).Iter()
+	nilObjIter := (*objectNode)(nil).rawIter()
 	if nilObjIter.Err() == nil {
 		t.Fatal("expected nil object iterator error")
 	}
-	nilArrIter := (*arrayNode)(nil).Iter()
+	nilArrIter := (*arrayNode)(nil).rawIter()
 	if nilArrIter.Err() == nil {
 		t.Fatal("expected nil array iterator error")
 	}
@@ -0,0 +1,139 @@
+package engine
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+
+	"github.com/474420502/xjson/internal/core"
+)
+
+// DeleteAll removes every value path matches, with the full query grammar
+// of Query: wildcards, filters and recursive steps included. Matched array
+// elements are removed and later elements shift down; matched object
+// members are removed by key. A match inside another match is removed with
+// it and not counted again. DeleteAll returns the number of values removed;
+// a path that matches nothing removes nothing and is not an error.
+func (n *baseNode) DeleteAll(path string) (int, error) {
+	if n.err != nil {
+		return 0, n.err
+	}
+	tokens, err := ParseQuery(path)
+	if err != nil {
+		return 0, &core.PathError{Path: path, Op: "DeleteAll", Err: err}
+	}
+	if len(tokens) == 0 {
+		return 0, &core.PathError{Path: path, Op: "DeleteAll", Err: fmt.Errorf("cannot delete the root")}
+	}
+
+	root := topNode(n.selfOrMe())
+	result := executeQueryTokens(n.selfOrMe(), tokens)
+	if !result.IsValid() {
+		return 0, nil
+	}
+	matches := []core.Node{result}
+	if set, ok := result.(*arrayNode); ok && (set.matchSet || set.selection) {
+		matches = set.value
+	}
+
+	targets, err := deletionTargets(root, matches)
+	if err != nil {
+		return 0, &core.PathError{Path: path, Op: "DeleteAll", Err: err}
+	}
+
+	count := 0
+	for _, target := range targets {
+		switch parent := target.parent.(type) {
+		case *objectNode:
+			for _, key := range target.keys {
+				parent.Delete(key)
+			}
+			count += len(target.keys)
+		case *arrayNode:
+			// Highest index first, so the remaining indices stay valid.
+			sort.Sort(sort.Reverse(sort.IntSlice(target.indices)))
+			for _, idx := range target.indices {
+				parent.Delete(strconv.Itoa(idx))
+			}
+			count += len(target.indices)
+		}
+	}
+	return count, nil
+}
+
+// deletionTarget lists what DeleteAll removes from one container.
+type deletionTarget struct {
+	parent  core.Node
+	keys    []string
+	indices []int
+}
+
+// deletionTargets resolves every match to its position in its parent before
+// anything is removed, dropping duplicates and matches below other matches.
+func deletionTargets(root core.Node, matches []core.Node) ([]*deletionTarget, error) {
+	attached := make([]core.Node, 0, len(matches))
+	selected := make(map[core.Node]bool, len(matches))
+	for i, match := range matches {
+		if topNode(match) != root || !isChildOf(match) {
+			node, ok := findBySource(root, match)
+			if !ok {
+				return nil, fmt.Errorf("match %d is not part of the document", i)
+			}
+			match = node
+		}
+		if match.Parent() == nil {
+			return nil, fmt.Errorf("cannot delete the root")
+		}
+		if !selected[match] {
+			selected[match] = true
+			attached = append(attached, match)
+		}
+	}
+
+	var targets []*deletionTarget
+	byParent := make(map[core.Node]*deletionTarget)
+	for _, match := range attached {
+		if hasSelectedAncestor(match, selected) {
+			continue
+		}
+		parent := match.Parent()
+		target := byParent[parent]
+		if target == nil {
+			target = &deletionTarget{parent: parent}
+			byParent[parent] = target
+			targets = append(targets, target)
+		}
+		switch p := parent.(type) {
+		case *objectNode:
+			key, _ := findObjectChildKey(p, match)
+			target.keys = append(target.keys, key)
+		case *arrayNode:
+			idx, _ := findArrayChildIndex(p, match)
+			target.indices = append(target.indices, idx)
+		}
+	}
+	return targets, nil
+}
+
+// isChildOf reports whether node is held by its parent container, rather
+// than being a copy made by a fast query path.
+func isChildOf(node core.Node) bool {
+	switch p := node.Parent().(type) {
+	case *objectNode:
+		_, ok := findObjectChildKey(p, node)
+		return ok
+	case *arrayNode:
+		_, ok := findArrayChildIndex(p, node)
+		return ok
+	}
+	return node.Parent() == nil
+}
+
+func hasSelectedAncestor(node core.Node, selected map[core.Node]bool) bool {
+	for p := node.Parent(); p != nil; p = p.Parent() {
+		if selected[p] {
+			return true
+		}
+	}
+	return false
+}
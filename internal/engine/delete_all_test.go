@@ -0,0 +1,129 @@
+package engine
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/474420502/xjson/internal/core"
+)
+
+const deleteDoc = `{"store":{"book":[
+	{"title":"A","available":true,"tags":["x","y"]},
+	{"title":"B","available":false,"tags":["x"]},
+	{"title":"C","available":false,"tags":[]},
+	{"title":"D","available":true,"tags":["y","x","x"]}
+]},"users":[{"name":"u1","password":"p1"},{"name":"u2"},{"name":"u3","password":"p3"}]}`
+
+func TestDeleteAllFilterCompactsArray(t *testing.T) {
+	forEachParser(t, deleteDoc, func(t *testing.T, root core.Node) {
+		n, err := root.DeleteAll("/store/book[?(@.available == false)]")
+		if err != nil || n != 2 {
+			t.Fatalf("DeleteAll = %d, %v; want 2, nil", n, err)
+		}
+		titles := root.Query("/store/book/*/title").Strings()
+		if len(titles) != 2 || titles[0] != "A" || titles[1] != "D" {
+			t.Fatalf("remaining titles = %v", titles)
+		}
+		if got := root.Query("/store/book[1]/title").String(); got != "D" {
+			t.Fatalf("indices not compacted, book[1] = %q", got)
+		}
+
+		reparsed, err := Parse([]byte(root.String()))
+		if err != nil {
+			t.Fatalf("reparse failed: %v", err)
+		}
+		if reparsed.Query("/store/book").Len() != 2 {
+			t.Fatalf("unexpected serialization: %s", root.String())
+		}
+	})
+}
+
+func TestDeleteAllWildcardStripsField(t *testing.T) {
+	for name, parse := range testParsers {
+		t.Run(name, func(t *testing.T) {
+			root, err := parse([]byte(deleteDoc))
+			if err != nil {
+				t.Fatalf("parse failed: %v", err)
+			}
+			n, err := root.DeleteAll("/users[*]/password")
+			if err != nil || n != 2 {
+				t.Fatalf("DeleteAll = %d, %v; want 2, nil", n, err)
+			}
+			if root.Has("//password") {
+				t.Fatalf("password left in %s", root.Query("/users").String())
+			}
+			if got := root.Query("/users").String(); got != `[{"name":"u1"},{"name":"u2"},{"name":"u3"}]` {
+				t.Fatalf("users = %s", got)
+			}
+		})
+	}
+}
+
+func TestDeleteAllNested(t *testing.T) {
+	root, err := Parse([]byte(deleteDoc))
+	if err != nil {
+		t.Fatalf("parse failed: %v", err)
+	}
+	// Several indices of the same array go highest first.
+	n, err := root.DeleteAll("/store/book[3]/tags[?(@ == 'x')]")
+	if err != nil || n != 2 {
+		t.Fatalf("DeleteAll = %d, %v; want 2, nil", n, err)
+	}
+	if got := root.Query("/store/book[3]/tags").String(); got != `["y"]` {
+		t.Fatalf("tags = %s", got)
+	}
+
+	// A field of the elements a filter selects.
+	n, err = root.DeleteAll("/store/book[?(@.available == false)]/tags")
+	if err != nil || n != 2 {
+		t.Fatalf("DeleteAll = %d, %v; want 2, nil", n, err)
+	}
+	if got := root.Query("/store/book/*/tags").String(); got != `[["x","y"],["y"]]` {
+		t.Fatalf("tags = %s", got)
+	}
+
+	// Recursive matches on a lazily parsed document.
+	root, _ = Parse([]byte(deleteDoc))
+	if n, err := root.DeleteAll("//tags"); err != nil || n != 4 {
+		t.Fatalf("DeleteAll(//tags) = %d, %v", n, err)
+	}
+	if root.Has("//tags") {
+		t.Fatal("tags left after recursive delete")
+	}
+
+	// A match inside another match is removed with it.
+	root, _ = Parse([]byte(`{"a":{"b":{"c":1}},"d":2}`))
+	if n, err := root.DeleteAll("//*"); err != nil || n != 2 {
+		t.Fatalf("DeleteAll(//*) = %d, %v; want 2", n, err)
+	}
+	if got := root.String(); got != `{}` {
+		t.Fatalf("root = %s", got)
+	}
+}
+
+func TestDeleteAllNoMatchesAndErrors(t *testing.T) {
+	root, err := Parse([]byte(deleteDoc))
+	if err != nil {
+		t.Fatalf("parse failed: %v", err)
+	}
+	before := root.String()
+	for _, path := range []string{"/store/book[?(@.price > 100)]", "/missing", "/users/*/email"} {
+		if n, err := root.DeleteAll(path); err != nil || n != 0 {
+			t.Errorf("%s: DeleteAll = %d, %v; want 0, nil", path, n, err)
+		}
+	}
+	if root.String() != before {
+		t.Fatal("document changed by deletes that matched nothing")
+	}
+
+	var pathErr *core.PathError
+	if _, err := root.DeleteAll("/store/book[?("); !errors.As(err, &pathErr) {
+		t.Fatalf("expected a *core.PathError for a bad path, got %v", err)
+	}
+	if _, err := root.DeleteAll(""); err == nil {
+		t.Fatal("expected an error when deleting the root")
+	}
+	if _, err := root.Get("missing").DeleteAll("/a"); err == nil {
+		t.Fatal("expected the error of an invalid node")
+	}
+}
@@ -0,0 +1,91 @@
+package engine
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/474420502/xjson/internal/core"
+)
+
+const descendantsDoc = `{"a":{"b":1,"c":[2,{"d":"x"}]},"e":[],"f":null,"g":[[true],{}]}`
+
+func nodeStrings(n core.Node) []string {
+	out := make([]string, 0)
+	for _, v := range n.Array() {
+		out = append(out, v.String())
+	}
+	return out
+}
+
+func TestDescendantsRawAndParsedAgree(t *testing.T) {
+	cases := []struct {
+		path string
+		want []string
+	}{
+		{"//*", []string{
+			`{"b":1,"c":[2,{"d":"x"}]}`, "1", `[2,{"d":"x"}]`, "2", `{"d":"x"}`, "x",
+			"[]", "null", `[[true],{}]`, "[true]", "true", "{}",
+		}},
+		{"/a//*", []string{"1", `[2,{"d":"x"}]`, "2", `{"d":"x"}`, "x"}},
+		{"/g..*", []string{"[true]", "true", "{}"}},
+		{"/a/b//*", []string{}},
+	}
+	for _, tc := range cases {
+		lazy, err := Parse([]byte(descendantsDoc))
+		if err != nil {
+			t.Fatalf("Parse failed: %v", err)
+		}
+		eager, err := MustParse([]byte(descendantsDoc))
+		if err != nil {
+			t.Fatalf("MustParse failed: %v", err)
+		}
+		raw := nodeStrings(lazy.Query(tc.path))
+		walked := nodeStrings(eager.Query(tc.path))
+		if !reflect.DeepEqual(raw, tc.want) {
+			t.Fatalf("raw %s = %v, want %v", tc.path, raw, tc.want)
+		}
+		if !reflect.DeepEqual(walked, tc.want) {
+			t.Fatalf("parsed %s = %v, want %v", tc.path, walked, tc.want)
+		}
+	}
+}
+
+func TestDotDotStarMatchesSlashSlashStar(t *testing.T) {
+	root, _ := Parse([]byte(descendantsDoc))
+	other, _ := Parse([]byte(descendantsDoc))
+	if got, want := nodeStrings(root.Query("..*")), nodeStrings(other.Query("//*")); !reflect.DeepEqual(got, want) {
+		t.Fatalf("..* = %v, //* = %v", got, want)
+	}
+	// ".." followed by anything else is still parent navigation.
+	if got := root.Query("/a/b/..").Get("b").Int(); got != 1 {
+		t.Fatalf("parent navigation = %d, want 1", got)
+	}
+}
+
+func TestLeaves(t *testing.T) {
+	want := []string{"1", "2", "x", "null", "true"}
+	lazy, _ := Parse([]byte(descendantsDoc))
+	eager, _ := MustParse([]byte(descendantsDoc))
+	if got := nodeStrings(lazy.Leaves()); !reflect.DeepEqual(got, want) {
+		t.Fatalf("raw Leaves = %v, want %v", got, want)
+	}
+	if got := nodeStrings(eager.Leaves()); !reflect.DeepEqual(got, want) {
+		t.Fatalf("parsed Leaves = %v, want %v", got, want)
+	}
+	if got := lazy.Get("a").Get("b").Leaves().Len(); got != 0 {
+		t.Fatalf("scalar Leaves len = %d, want 0", got)
+	}
+	if lazy.Get("missing").Leaves().IsValid() {
+		t.Fatal("expected Leaves of an invalid node to be invalid")
+	}
+}
+
+func TestDescendantsAfterMutation(t *testing.T) {
+	root, _ := Parse([]byte(`{"a":[1],"b":{"c":2}}`))
+	root.Get("a").Append(3)
+	root.Get("b").Set("d", "y")
+	want := []string{"1", "3", "2", "y"}
+	if got := nodeStrings(root.Leaves()); !reflect.DeepEqual(got, want) {
+		t.Fatalf("Leaves after writes = %v, want %v", got, want)
+	}
+}
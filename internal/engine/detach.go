@@ -0,0 +1,85 @@
+package engine
+
+import (
+	"bytes"
+	"fmt"
+
+	"github.com/474420502/xjson/internal/core"
+)
+
+// Detach copies the node, or each match of a match set, into a document of
+// its own. The copy is made from the serialized text of the node in a new
+// buffer, so nothing of the original document is reachable from it.
+func (n *baseNode) Detach() core.Node {
+	self := n.selfOrMe()
+	if n.err != nil {
+		return self
+	}
+	if matches, ok := matchList(self); ok {
+		copies := make([]core.Node, len(matches))
+		for i, match := range matches {
+			if copies[i] = match.Detach(); !copies[i].IsValid() {
+				return copies[i]
+			}
+		}
+		set := newMatchSet(nil, copies, detachedFuncs(n))
+		nodeBase(set).mustBehavior.Store(n.mustRoot().mustBehavior.Load())
+		return set
+	}
+
+	data, err := nodeText(self)
+	if err != nil {
+		return newInvalidNode(&core.PathError{Path: self.Path(), Op: "Detach", Err: err})
+	}
+	data = bytes.Clone(data)
+	root := rootBase(n)
+	funcs := detachedFuncs(n)
+	var copied core.Node
+	if n.parsed.Load() {
+		p := newParser(bytes.TrimSpace(data), funcs)
+		p.lenient = root.leniency
+		copied, err = p.ParseFull()
+	} else {
+		copied, err = parseLazy(data, funcs, nil, root.leniency)
+	}
+	if err != nil {
+		return newInvalidNode(&core.PathError{Path: self.Path(), Op: "Detach", Err: fmt.Errorf("reparse: %w", err)})
+	}
+	bn := nodeBase(copied)
+	bn.parent = nil
+	bn.leniency = root.leniency
+	bn.trackPositions = root.trackPositions
+	bn.duplicateKeys = root.duplicateKeys
+	bn.strictConversions = root.strictConversions
+	bn.mustBehavior.Store(n.mustRoot().mustBehavior.Load())
+	bn.maxRecursionDepth = root.maxRecursionDepth
+	return copied
+}
+
+// detachedFuncs returns a new function map holding the functions visible
+// from n: those of its document, overridden by those registered on n and
+// its ancestors, the nearest first.
+func detachedFuncs(n *baseNode) *map[string]core.UnaryPathFunc {
+	var scopes []*baseNode
+	scope := n
+	for {
+		scopes = append(scopes, scope)
+		parent := nodeBase(scope.parent)
+		if parent == nil || parent == scope {
+			break
+		}
+		scope = parent
+	}
+	funcs := make(map[string]core.UnaryPathFunc)
+	if scope.funcs != nil {
+		for name, fn := range *scope.funcs {
+			funcs[name] = fn
+		}
+	}
+	for i := len(scopes) - 1; i >= 0; i-- {
+		for name, fn := range scopes[i].localFuncs {
+			funcs[name] = fn
+		}
+	}
+	return &funcs
+}
@@ -0,0 +1,154 @@
+package engine
+
+import (
+	"bytes"
+	"fmt"
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/474420502/xjson/internal/core"
+)
+
+// bigSource is a buffer large enough to tell apart on its own, holding a
+// document with one small value worth keeping.
+type bigSource [1 << 20]byte
+
+func newBigDocument(t *testing.T) (*bigSource, []byte) {
+	t.Helper()
+	var sb strings.Builder
+	sb.WriteString(`{"keep":{"id":7,"tags":["a","b"]},"rows":[`)
+	for i := 0; sb.Len() < len(bigSource{})-64; i++ {
+		if i > 0 {
+			sb.WriteByte(',')
+		}
+		fmt.Fprintf(&sb, `{"n":%d}`, i)
+	}
+	sb.WriteString(`]}`)
+	src := new(bigSource)
+	return src, src[:copy(src[:], sb.String())]
+}
+
+// collected reports whether src is garbage collected once the caller drops
+// it, while keep stays reachable.
+func collected(src *bigSource, keep func()) bool {
+	done := make(chan struct{})
+	runtime.SetFinalizer(src, func(*bigSource) { close(done) })
+	for i := 0; i < 20; i++ {
+		runtime.GC()
+		select {
+		case <-done:
+			keep()
+			return true
+		case <-time.After(10 * time.Millisecond):
+		}
+	}
+	keep()
+	return false
+}
+
+func TestDetachReleasesSource(t *testing.T) {
+	src, data := newBigDocument(t)
+	root, err := Parse(data)
+	if err != nil {
+		t.Fatalf("Parse failed: %v", err)
+	}
+	kept := root.Query("/keep").Detach()
+	root, data = nil, nil
+	if !collected(src, func() { runtime.KeepAlive(kept) }) {
+		t.Fatal("the source buffer is still reachable from a detached value")
+	}
+	if got := kept.Query("/tags[1]").String(); got != "b" {
+		t.Errorf("/tags[1] of the detached value = %q, want b", got)
+	}
+	if got := kept.String(); got != `{"id":7,"tags":["a","b"]}` {
+		t.Errorf("detached value = %s", got)
+	}
+}
+
+func TestUndetachedValueKeepsSource(t *testing.T) {
+	src, data := newBigDocument(t)
+	root, err := Parse(data)
+	if err != nil {
+		t.Fatalf("Parse failed: %v", err)
+	}
+	kept := root.Query("/keep")
+	root, data = nil, nil
+	if collected(src, func() { runtime.KeepAlive(kept) }) {
+		t.Fatal("a value read lazily should keep its source buffer")
+	}
+}
+
+func TestDetachCopies(t *testing.T) {
+	const src = ` {"user": {"name": "ann", "tags": ["x", "y"], "n": 1.50}, "list": [1, 2, 3]} `
+	for name, parse := range testParsers {
+		data := []byte(src)
+		root, err := parse(data)
+		if err != nil {
+			t.Fatalf("%s: parse failed: %v", name, err)
+		}
+		user := root.Query("/user")
+		want, _ := user.Bytes()
+		copied := user.Detach()
+		if got, err := copied.Bytes(); err != nil || !bytes.Equal(got, want) {
+			t.Errorf("%s: Detach() = %s, %v, want %s", name, got, err, want)
+		}
+		if copied.Parent() != nil || copied.Path() != "" {
+			t.Errorf("%s: the copy should be a root, path %q", name, copied.Path())
+		}
+		if got := copied.Query("/n").Raw(); got != "1.50" {
+			t.Errorf("%s: /n = %s, want the source text 1.50", name, got)
+		}
+
+		// The two are independent.
+		copied.Set("name", "bob")
+		if got := root.Query("/user/name").String(); got != "ann" {
+			t.Errorf("%s: writing the copy changed the document: %q", name, got)
+		}
+		root.Query("/user/tags").Append("z")
+		if got := copied.Query("/tags").Len(); got != 2 {
+			t.Errorf("%s: writing the document changed the copy: %d tags", name, got)
+		}
+		copy(data, bytes.Repeat([]byte{'#'}, len(data)))
+		if got := copied.Query("/tags[0]").String(); got != "x" {
+			t.Errorf("%s: the copy reads the source buffer: %q", name, got)
+		}
+	}
+}
+
+func TestDetachMatchSetsAndSettings(t *testing.T) {
+	root, err := ParseWithOptions([]byte(`{"a":[{"v":1},{"v":2},{"v":3}],}`), ParseOptions{AllowTrailingCommas: true, StrictConversionErrors: true})
+	if err != nil {
+		t.Fatalf("ParseWithOptions failed: %v", err)
+	}
+	root.RegisterFunc("odd", func(n core.Node) core.Node {
+		return n.Filter(func(v core.Node) bool { return v.Get("v").Int()%2 == 1 })
+	})
+	root.Query("/a").RegisterFunc("last", func(n core.Node) core.Node { return n.Index(-1) })
+	matches := root.Query("/a[*]/v").Detach()
+	if matches.MatchCount() != 3 || matches.String() != "[1,2,3]" {
+		t.Errorf("Detach() of a match set = %s, want [1,2,3]", matches.String())
+	}
+	if m := matches.First(); m.Parent() != nil {
+		t.Error("each match should be copied into a document of its own")
+	}
+
+	arr := root.Query("/a").Detach()
+	if got := arr.Query("[@odd]").String(); got != `[{"v":1},{"v":3}]` {
+		t.Errorf("the copy should keep the functions of its document: %s", got)
+	}
+	if got := arr.Query("[@last]/v").Int(); got != 3 {
+		t.Errorf("the copy should keep the functions registered on the node: %d", got)
+	}
+	if !rootBase(nodeBase(arr)).strictConversions {
+		t.Error("the copy should keep the parse options of its document")
+	}
+
+	if n := root.Get("missing").Detach(); n.IsValid() {
+		t.Error("Detach() of an invalid node should stay invalid")
+	}
+	if n := root.Query("/a[0]/v").Detach(); n.Int() != 1 || n.Parent() != nil {
+		t.Errorf("Detach() of a number = %s", n.String())
+	}
+}
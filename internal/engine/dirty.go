@@ -0,0 +1,171 @@
+package engine
+
+import (
+	"strconv"
+
+	"github.com/474420502/xjson/internal/core"
+)
+
+// editLog holds the DirtyPaths of a document on its root. A path is only
+// logged when neither it nor one of its ancestors is, and logging a path
+// drops the ones below it, so the log never holds a path and its ancestor.
+type editLog struct {
+	paths  []string
+	logged map[string]bool
+	// below counts the logged paths strictly below each path.
+	below map[string]int
+}
+
+func (l *editLog) add(path string) {
+	if l.logged[path] || l.covers(path) {
+		return
+	}
+	if l.below[path] > 0 {
+		kept := l.paths[:0]
+		for _, p := range l.paths {
+			if isPathBelow(p, path) {
+				l.forget(p)
+				continue
+			}
+			kept = append(kept, p)
+		}
+		clear(l.paths[len(kept):])
+		l.paths = kept
+	}
+	l.paths = append(l.paths, path)
+	l.logged[path] = true
+	eachPathAncestor(path, func(a string) bool {
+		l.below[a]++
+		return true
+	})
+}
+
+// forget drops the counts of a logged path, but not the path itself.
+func (l *editLog) forget(path string) {
+	delete(l.logged, path)
+	eachPathAncestor(path, func(a string) bool {
+		if l.below[a]--; l.below[a] == 0 {
+			delete(l.below, a)
+		}
+		return true
+	})
+}
+
+// covers reports whether an ancestor of path is logged.
+func (l *editLog) covers(path string) bool {
+	covered := false
+	eachPathAncestor(path, func(a string) bool {
+		covered = l.logged[a]
+		return !covered
+	})
+	return covered
+}
+
+// eachPathAncestor calls fn with each ancestor of path, nearest first and
+// ending with "/" for the root, until fn returns false. A quoted key may
+// contain '/' or '[', which only adds candidates that are never logged.
+func eachPathAncestor(path string, fn func(ancestor string) bool) {
+	if path == "/" {
+		return
+	}
+	for i := len(path) - 1; i > 0; i-- {
+		if (path[i] == '/' || path[i] == '[') && !fn(path[:i]) {
+			return
+		}
+	}
+	fn("/")
+}
+
+// isPathBelow reports whether path names a value inside the one at
+// ancestor.
+func isPathBelow(path, ancestor string) bool {
+	if ancestor == "/" {
+		return path != "/"
+	}
+	return len(path) > len(ancestor) && path[:len(ancestor)] == ancestor &&
+		(path[len(ancestor)] == '/' || path[len(ancestor)] == '[')
+}
+
+// logEdit records on the root of the document that the value at path was
+// written to.
+func (n *baseNode) logEdit(path string) {
+	root := rootBase(n)
+	if root.edits == nil {
+		root.edits = &editLog{logged: map[string]bool{}, below: map[string]int{}}
+	}
+	root.edits.add(path)
+}
+
+// logKeyEdit records a write to the member key of the object.
+func (n *baseNode) logKeyEdit(key string) {
+	n.logEdit(n.selfOrMe().Path() + "/" + formatPathKey(key))
+}
+
+// logIndexEdit records a write to the element at index of the array.
+func (n *baseNode) logIndexEdit(index int) {
+	n.logEdit(n.selfOrMe().Path() + "[" + strconv.Itoa(index) + "]")
+}
+
+// logSelfEdit records a write that moved elements of the array, so that
+// every index after the edit names another value than before.
+func (n *baseNode) logSelfEdit() {
+	n.logEdit(displayPath(n.selfOrMe()))
+}
+
+// DirtyPaths lists the paths of the values written to at or below the node
+// since the document was parsed or ResetDirty was called, in the order they
+// were first written. Each write logs its target: the member or element Set,
+// SetIndex, SetValue or Delete replaced or removed, and each element Append
+// added; removing or inserting an element before the end of an array logs
+// the array, since the later elements move. A path inside a logged value is
+// not logged again, and logging a value drops the paths inside it. When the
+// node itself lies inside a logged value, its own path is returned.
+func (n *baseNode) DirtyPaths() []string {
+	self := n.selfOrMe()
+	if n.err != nil {
+		return nil
+	}
+	log := rootBase(n).edits
+	if log == nil {
+		return []string{}
+	}
+	path := displayPath(self)
+	if log.logged[path] || log.covers(path) {
+		return []string{path}
+	}
+	out := []string{}
+	if log.below[path] > 0 {
+		for _, p := range log.paths {
+			if isPathBelow(p, path) {
+				out = append(out, p)
+			}
+		}
+	}
+	return out
+}
+
+// ResetDirty forgets the writes at or below the node, so that DirtyPaths
+// starts over from the current state. Called on a node inside a logged
+// value, it leaves that value logged.
+func (n *baseNode) ResetDirty() core.Node {
+	self := n.selfOrMe()
+	if n.err != nil {
+		return self
+	}
+	log := rootBase(n).edits
+	if log == nil {
+		return self
+	}
+	path := displayPath(self)
+	kept := log.paths[:0]
+	for _, p := range log.paths {
+		if p == path || isPathBelow(p, path) {
+			log.forget(p)
+			continue
+		}
+		kept = append(kept, p)
+	}
+	clear(log.paths[len(kept):])
+	log.paths = kept
+	return self
+}
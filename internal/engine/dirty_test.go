@@ -0,0 +1,125 @@
+package engine
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/474420502/xjson/internal/core"
+)
+
+const dirtyDoc = `{"user":{"name":"ann","tags":["a","b","c"],"address":{"city":"x","zip":"1"}},"items":[{"id":1},{"id":2}],"a.b":1}`
+
+func assertDirty(t *testing.T, n core.Node, want ...string) {
+	t.Helper()
+	if want == nil {
+		want = []string{}
+	}
+	if got := n.DirtyPaths(); !reflect.DeepEqual(got, want) {
+		t.Errorf("DirtyPaths() = %q, want %q", got, want)
+	}
+}
+
+func TestDirtyPathsLogsWriteTargets(t *testing.T) {
+	forEachParser(t, dirtyDoc, func(t *testing.T, root core.Node) {
+		assertDirty(t, root)
+
+		root.SetByPath("/user/name", "bob")                           // a scalar updated in place
+		root.Get("user").Get("tags").Append("d")                      // a new element
+		root.Query("/items[1]").Set("qty", 3)                         // a new key
+		root.Get("user").Get("address").Delete("zip")                 // a removed key
+		root.Query("/items[0]/id").SetValue(map[string]interface{}{}) // a deep replacement
+		root.Set("a.b", 2)                                            // a key that needs quoting
+		root.Get("user").Get("tags").SetIndex(0, "z")
+		assertDirty(t, root,
+			"/user/name", "/user/tags[3]", "/items[1]/qty", "/user/address/zip", "/items[0]/id", "/['a.b']", "/user/tags[0]")
+
+		// The paths are in the form Query accepts.
+		for _, path := range []string{"/user/name", "/user/tags[3]", "/items[1]/qty", "/items[0]/id", "/['a.b']"} {
+			if !root.Query(path).IsValid() {
+				t.Errorf("Query(%q) should find the written value", path)
+			}
+		}
+
+		// Writing the same value again logs nothing new.
+		root.SetByPath("/user/name", "cid")
+		if got := len(root.DirtyPaths()); got != 7 {
+			t.Errorf("%d paths after writing a logged path again", got)
+		}
+	})
+}
+
+func TestDirtyPathsCollapseOverlappingEdits(t *testing.T) {
+	forEachParser(t, dirtyDoc, func(t *testing.T, root core.Node) {
+		root.SetByPath("/user/address/city", "y")
+		root.SetByPath("/user/tags[1]", "q")
+		root.SetByPath("/items[0]/id", 5)
+		// Replacing a parent drops the paths below it.
+		root.Set("user", map[string]interface{}{"name": "new"})
+		assertDirty(t, root, "/items[0]/id", "/user")
+
+		// Writes inside a logged value are covered by it.
+		root.SetByPath("/user/name", "newer")
+		root.Get("user").Set("age", 3)
+		assertDirty(t, root, "/items[0]/id", "/user")
+	})
+}
+
+func TestDirtyPathsForShiftingArrayEdits(t *testing.T) {
+	forEachParser(t, dirtyDoc, func(t *testing.T, root core.Node) {
+		tags := root.Query("/user/tags")
+		tags.Delete("2") // the last element: nothing moves
+		assertDirty(t, root, "/user/tags[2]")
+
+		root.SetByPath("/items[1]/id", 7)
+		root.Get("items").Delete("0") // later elements move down
+		assertDirty(t, root, "/user/tags[2]", "/items")
+
+		tags.InsertAt(2, "end") // at the end: nothing moves
+		tags.AppendAll("e", "f")
+		assertDirty(t, root, "/user/tags[2]", "/items", "/user/tags[3]", "/user/tags[4]")
+		tags.InsertAt(0, "first")
+		assertDirty(t, root, "/items", "/user/tags")
+	})
+}
+
+func TestDirtyPathsPerSubtreeAndReset(t *testing.T) {
+	forEachParser(t, dirtyDoc, func(t *testing.T, root core.Node) {
+		user := root.Get("user")
+		root.SetByPath("/user/name", "bob")
+		root.SetByPath("/user/address/city", "y")
+		root.SetByPath("/items[0]/id", 5)
+
+		assertDirty(t, user, "/user/name", "/user/address/city")
+		assertDirty(t, root.Query("/user/address"), "/user/address/city")
+		assertDirty(t, root.Query("/items[1]"))
+		// A node inside a logged value reports its own path.
+		assertDirty(t, root.Query("/user/address/city"), "/user/address/city")
+
+		user.ResetDirty()
+		assertDirty(t, root, "/items[0]/id")
+		root.ResetDirty()
+		assertDirty(t, root)
+
+		root.Get("items").Append(3)
+		assertDirty(t, root, "/items[2]")
+		if root.Query("/missing").DirtyPaths() != nil {
+			t.Error("an invalid node should have no dirty paths")
+		}
+	})
+}
+
+func TestDirtyPathsOnRootArrays(t *testing.T) {
+	root, err := Parse([]byte(`[{"a":1},{"a":2},{"a":3}]`))
+	if err != nil {
+		t.Fatalf("Parse failed: %v", err)
+	}
+	root.Index(1).Set("a", 20)
+	root.Append(4)
+	assertDirty(t, root, "[1]/a", "[3]")
+	if root.Query("[1]/a").Int() != 20 {
+		t.Error("a root array path should be queryable")
+	}
+	root.Delete("0")
+	assertDirty(t, root, "/")
+	assertDirty(t, root.Index(0), "[0]")
+}
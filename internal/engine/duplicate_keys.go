@@ -0,0 +1,210 @@
+package engine
+
+import (
+	"strconv"
+	"unsafe"
+)
+
+// DuplicateKeyPolicy decides which member of an object counts when its key
+// appears more than once, see ParseOptions.DuplicateKeys.
+type DuplicateKeyPolicy uint8
+
+const (
+	// LastWins keeps the last member with a key, like encoding/json.
+	LastWins DuplicateKeyPolicy = iota
+	// FirstWins keeps the first member with a key.
+	FirstWins
+	// ErrorOnDuplicate rejects documents with a repeated key.
+	ErrorOnDuplicate
+)
+
+// duplicateKeyPolicy returns the policy of the document n belongs to. Like
+// trackPositions it is only stored on the root.
+func duplicateKeyPolicy(n *baseNode) DuplicateKeyPolicy {
+	return rootBase(n).duplicateKeys
+}
+
+// rawMember is a member of a raw object: its unescaped key and the offset
+// of its value.
+type rawMember struct {
+	key      string
+	valStart int
+}
+
+// scanRawMembers calls visit for each member of the object starting at
+// data[start] with the offset of its key and value. It stops at the closing
+// brace, when visit returns false, or at malformed input, which it reports
+// as false. The ends of values are taken from ends when it has them.
+func scanRawMembers(data []byte, start int, ends knownEnds, visit func(key string, keyStart, valStart, valEnd int) bool) bool {
+	pos := start + 1
+	skipWS := func() {
+		for pos < len(data) {
+			c := data[pos]
+			if c != ' ' && c != '\n' && c != '\r' && c != '\t' {
+				return
+			}
+			pos++
+		}
+	}
+	for {
+		skipWS()
+		if pos >= len(data) {
+			return false
+		}
+		if data[pos] == '}' {
+			return true
+		}
+		if data[pos] != '"' {
+			return false
+		}
+		keyStart := pos
+		keyEnd := findMatchingQuote(data, pos)
+		if keyEnd == -1 {
+			return false
+		}
+		key, ok := rawKeyString(data[pos+1 : keyEnd])
+		if !ok {
+			return false
+		}
+		pos = keyEnd + 1
+		skipWS()
+		if pos >= len(data) || data[pos] != ':' {
+			return false
+		}
+		pos++
+		skipWS()
+		if pos >= len(data) {
+			return false
+		}
+		valEnd := ends.valueEnd(data, pos)
+		if valEnd < pos {
+			return false
+		}
+		if !visit(key, keyStart, pos, valEnd) {
+			return true
+		}
+		pos = valEnd + 1
+		skipWS()
+		if pos < len(data) && data[pos] == ',' {
+			pos++
+		}
+	}
+}
+
+// rawKeyString returns the unescaped key, sharing the source bytes when the
+// key has no escapes.
+func rawKeyString(keyRaw []byte) (string, bool) {
+	if len(keyRaw) == 0 {
+		return "", true
+	}
+	for _, c := range keyRaw {
+		if c == '\\' {
+			decoded, err := unescape(keyRaw)
+			if err != nil {
+				return "", false
+			}
+			return string(decoded), true
+		}
+	}
+	return unsafe.String(&keyRaw[0], len(keyRaw)), true
+}
+
+// shadowedMembers returns the value offsets of the members of the object at
+// data[start] that policy hides behind another member with the same key, or
+// nil when no key repeats, which is the usual case. ends is passed on to
+// scanRawMembers.
+func shadowedMembers(data []byte, start int, policy DuplicateKeyPolicy, ends knownEnds) map[int]bool {
+	if policy == ErrorOnDuplicate {
+		// Such documents were checked for repeated keys when parsed.
+		return nil
+	}
+	var small [16]rawMember
+	members := small[:0]
+	var index map[string]int
+	var shadowed map[int]bool
+	scanRawMembers(data, start, ends, func(key string, _, valStart, _ int) bool {
+		prev := -1
+		if index != nil {
+			if i, ok := index[key]; ok {
+				prev = i
+			}
+		} else {
+			for i := range members {
+				if members[i].key == key {
+					prev = i
+				}
+			}
+		}
+		if prev >= 0 {
+			if shadowed == nil {
+				shadowed = make(map[int]bool)
+			}
+			if policy == FirstWins {
+				shadowed[valStart] = true
+				return true
+			}
+			shadowed[members[prev].valStart] = true
+		}
+		members = append(members, rawMember{key: key, valStart: valStart})
+		if index != nil {
+			index[key] = len(members) - 1
+		} else if len(members) > len(small) {
+			index = make(map[string]int, 2*len(members))
+			for i, m := range members {
+				index[m.key] = i
+			}
+		}
+		return true
+	})
+	return shadowed
+}
+
+// checkDuplicateKeys reports the first object member of data, in document
+// order, whose key was already used in the same object, for ParseOptions
+// DuplicateKeys ErrorOnDuplicate. Structural errors are left to the parser.
+func checkDuplicateKeys(data []byte) error {
+	type frame struct {
+		object    bool
+		expectKey bool
+		seen      map[string]struct{}
+	}
+	var stack []frame
+	for i := 0; i < len(data); i++ {
+		switch data[i] {
+		case '{':
+			stack = append(stack, frame{object: true, expectKey: true})
+		case '[':
+			stack = append(stack, frame{})
+		case '}', ']':
+			if len(stack) > 0 {
+				stack = stack[:len(stack)-1]
+			}
+		case ',':
+			if len(stack) > 0 && stack[len(stack)-1].object {
+				stack[len(stack)-1].expectKey = true
+			}
+		case '"':
+			end := findMatchingQuote(data, i)
+			if end < 0 {
+				return nil
+			}
+			if len(stack) > 0 && stack[len(stack)-1].expectKey {
+				top := &stack[len(stack)-1]
+				top.expectKey = false
+				key, ok := rawKeyString(data[i+1 : end])
+				if !ok {
+					return nil
+				}
+				if _, dup := top.seen[key]; dup {
+					return newSyntaxError(data, i, "duplicate object key "+strconv.Quote(key))
+				}
+				if top.seen == nil {
+					top.seen = make(map[string]struct{})
+				}
+				top.seen[key] = struct{}{}
+			}
+			i = end
+		}
+	}
+	return nil
+}
@@ -0,0 +1,159 @@
+package engine
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/474420502/xjson/internal/core"
+)
+
+const duplicateDoc = `{"a":1,"b":{"k":"first","n":{"x":1},"k":"second"},"a":2,` +
+	`"list":[{"id":1,"id":2}],"deep":{"k":{"v":"one"},"k":{"v":"two"}}}`
+
+// duplicateAccess reads the document one way; every way must agree.
+var duplicateAccess = map[string]func(root core.Node) string{
+	"fast path": func(root core.Node) string {
+		return root.Query("/b/k").String() + "," + root.Query("/a").String()
+	},
+	"get chain": func(root core.Node) string {
+		return root.Get("b").Get("k").String() + "," + root.Get("a").String()
+	},
+	"full parse": func(root core.Node) string {
+		b := root.Get("b")
+		b.Len()
+		root.Len()
+		return b.Get("k").String() + "," + root.Get("a").String()
+	},
+	"compiled": func(root core.Node) string {
+		q, err := CompileQuery("/deep/k/v")
+		if err != nil {
+			return err.Error()
+		}
+		return q.Query(root).String() + "," + root.Query("/list[0]/id").String()
+	},
+	"recursive": func(root core.Node) string {
+		var parts []string
+		for _, v := range root.Query("//v").Array() {
+			parts = append(parts, v.String())
+		}
+		for _, v := range root.Query("//id").Array() {
+			parts = append(parts, v.String())
+		}
+		return strings.Join(parts, ",")
+	},
+	"wildcard": func(root core.Node) string {
+		var parts []string
+		for _, v := range root.Query("/b/*").Array() {
+			parts = append(parts, v.String())
+		}
+		return strings.Join(parts, ",")
+	},
+}
+
+func TestDuplicateKeyPolicyIsTheSameOnEveryPath(t *testing.T) {
+	want := map[DuplicateKeyPolicy]map[string]string{
+		LastWins: {
+			"fast path":  "second,2",
+			"get chain":  "second,2",
+			"full parse": "second,2",
+			"compiled":   "two,2",
+			"recursive":  "two,2",
+			"wildcard":   `{"x":1},second`,
+		},
+		FirstWins: {
+			"fast path":  "first,1",
+			"get chain":  "first,1",
+			"full parse": "first,1",
+			"compiled":   "one,1",
+			"recursive":  "one,1",
+			"wildcard":   `first,{"x":1}`,
+		},
+	}
+	for policy, answers := range want {
+		for name, access := range duplicateAccess {
+			for _, pooled := range []bool{false, true} {
+				opts := ParseOptions{DuplicateKeys: policy}
+				if pooled {
+					opts.Pool = NewNodePool()
+				}
+				root, err := ParseWithOptions([]byte(duplicateDoc), opts)
+				if err != nil {
+					t.Fatalf("parse failed: %v", err)
+				}
+				if got := access(root); got != answers[name] {
+					t.Errorf("policy %d, %s (pooled %v): got %q, want %q", policy, name, pooled, got, answers[name])
+				}
+			}
+		}
+	}
+
+	// The default matches LastWins, eager parsing included.
+	for _, parse := range []func([]byte) (core.Node, error){Parse, MustParse} {
+		root, err := parse([]byte(duplicateDoc))
+		if err != nil {
+			t.Fatalf("parse failed: %v", err)
+		}
+		if got := root.Query("/b/k").String(); got != "second" {
+			t.Errorf("default policy: got %q, want second", got)
+		}
+	}
+}
+
+func TestDuplicateKeysError(t *testing.T) {
+	cases := []struct {
+		doc    string
+		key    string
+		offset int
+	}{
+		{`{"a":1,"a":2}`, "a", 7},
+		{`{"x":[{"id":1},{"id":2,"id":3}]}`, "id", 23},
+		{`{"a":1,"\u0061":2}`, "a", 7},
+		{"{\n  \"o\": {\"k\": {}, \"k\": []}\n}", "k", 19},
+	}
+	for _, tc := range cases {
+		_, err := ParseWithOptions([]byte(tc.doc), ParseOptions{DuplicateKeys: ErrorOnDuplicate})
+		var syntaxErr *core.SyntaxError
+		if !errors.As(err, &syntaxErr) {
+			t.Errorf("%s: expected *core.SyntaxError, got %v", tc.doc, err)
+			continue
+		}
+		if syntaxErr.Offset != tc.offset || !strings.Contains(syntaxErr.Msg, `"`+tc.key+`"`) {
+			t.Errorf("%s: got %v, want key %q at offset %d", tc.doc, err, tc.key, tc.offset)
+		}
+	}
+
+	valid := []string{
+		`{"a":"{\"a\":1,\"a\":2}","b":{"a":1},"c":[{"a":1},{"a":2}]}`,
+		`[{"k":1},{"k":2}]`,
+	}
+	for _, doc := range valid {
+		root, err := ParseWithOptions([]byte(doc), ParseOptions{DuplicateKeys: ErrorOnDuplicate})
+		if err != nil || !root.IsValid() {
+			t.Errorf("%s: unexpected error %v", doc, err)
+		}
+	}
+}
+
+func TestShadowedMembers(t *testing.T) {
+	var b strings.Builder
+	b.WriteString("{")
+	for i := 0; i < 40; i++ {
+		b.WriteString(`"k` + string(rune('a'+i%26)) + `":` + "1,")
+	}
+	b.WriteString(`"ka":2}`)
+	doc := []byte(b.String())
+
+	last := shadowedMembers(doc, 0, LastWins, nil)
+	first := shadowedMembers(doc, 0, FirstWins, nil)
+	// "ka" appears three times, each of kb..kn twice.
+	if len(last) != 15 || len(first) != 15 {
+		t.Fatalf("got %d and %d shadowed members, want 15", len(last), len(first))
+	}
+	if last[len(doc)-2] || !first[len(doc)-2] {
+		t.Errorf("the final \"ka\" should win under LastWins only")
+	}
+	if shadowedMembers([]byte(`{"a":1,"b":2}`), 0, LastWins, nil) != nil {
+		t.Errorf("expected nil without repeated keys")
+	}
+}
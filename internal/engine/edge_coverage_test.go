@@ -300,7 +300,7 @@ func TestObjectIteratorKeyRawEdge(t *testing.T) {
 	}
 	
 	obj := root.(*objectNode)
-	iter := obj.Iter()
+	iter := obj.rawIter()
 	
 	// Iterate to first element
 	if iter.Next() {
@@ -319,7 +319,7 @@ func TestObjectIteratorValueRawEdge(t *testing.T) {
 	}
 	
 	obj := root.(*objectNode)
-	iter := obj.Iter()
+	iter := obj.rawIter()
 	
 	// Iterate to first element
 	if iter.Next() {
@@ -338,7 +338,7 @@ func TestArrayIteratorIndexEdge(t *testing.T) {
 	}
 	
 	arr := root.(*arrayNode)
-	iter := arr.Iter()
+	iter := arr.rawIter()
 	
 	// Iterate and check index
 	if iter.Next() {
@@ -364,7 +364,7 @@ func TestArrayIteratorValueRawEdge(t *testing.T) {
 	}
 	
 	arr := root.(*arrayNode)
-	iter := arr.Iter()
+	iter := arr.rawIter()
 	
 	// Iterate and check value raw
 	if iter.Next() {
@@ -998,7 +998,7 @@ func TestObjectIteratorParsedMode(t *testing.T) {
 	// Force dirty state to trigger parsed mode
 	obj.isDirty = true
 	
-	iter := obj.Iter()
+	iter := obj.rawIter()
 	count := 0
 	for iter.Next() {
 		count++
@@ -1028,7 +1028,7 @@ func TestArrayIteratorParsedMode(t *testing.T) {
 	// Force dirty state to trigger parsed mode
 	arr.isDirty = true
 	
-	iter := arr.Iter()
+	iter := arr.rawIter()
 	count := 0
 	for iter.Next() {
 		count++
@@ -0,0 +1,72 @@
+package engine
+
+import (
+	"fmt"
+
+	"github.com/474420502/xjson/internal/core"
+)
+
+// FilterElements returns the elements of the array, or of each array a
+// match set holds, for which fn returns true.
+func (n *baseNode) FilterElements(fn func(i int, value core.Node) bool) core.Node {
+	self := n.selfOrMe()
+	var out []core.Node
+	if err := eachElement(self, "FilterElements", func(i int, elem core.Node) error {
+		if fn(i, elem) {
+			out = append(out, elem)
+		}
+		return nil
+	}); err != nil {
+		return newInvalidNode(err)
+	}
+	return newMatchSet(self, out, n.funcs)
+}
+
+// MapElements returns the values fn makes of the elements of the array, or
+// of each array a match set holds.
+func (n *baseNode) MapElements(fn func(i int, value core.Node) interface{}) core.Node {
+	self := n.selfOrMe()
+	set := newMatchSet(self, nil, n.funcs).(*arrayNode)
+	if err := eachElement(self, "MapElements", func(i int, elem core.Node) error {
+		mapped := NewNodeFromInterface(set, fn(i, elem), n.funcs)
+		if !mapped.IsValid() {
+			return &core.PathError{Path: elem.Path(), Op: "MapElements", Err: mapped.Error()}
+		}
+		set.value = append(set.value, mapped)
+		return nil
+	}); err != nil {
+		return newInvalidNode(err)
+	}
+	return set
+}
+
+// eachElement calls fn with the elements of the array node is, or of each
+// match when it is a match set, stopping at the first error. Anything that
+// is not an array fails with ErrTypeAssertion before fn is called.
+func eachElement(node core.Node, op string, fn func(i int, elem core.Node) error) error {
+	if err := node.Error(); err != nil {
+		return err
+	}
+	arrays, ok := matchList(node)
+	if !ok {
+		arrays = []core.Node{node}
+	} else if set := node.(*arrayNode); set.matchSet {
+		arrays = set.documentMatches()
+	}
+	for _, arr := range arrays {
+		if err := arr.Error(); err != nil {
+			return err
+		}
+		if arr.Type() != core.Array {
+			return &core.PathError{Path: arr.Path(), Op: op, Err: fmt.Errorf("%w: %s is not an array", core.ErrTypeAssertion, arr.Type())}
+		}
+	}
+	for _, arr := range arrays {
+		for i, elem := range arr.UnsafeArray() {
+			if err := fn(i, elem); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,115 @@
+package engine
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/474420502/xjson/internal/core"
+)
+
+func TestFilterElementsVersusFilter(t *testing.T) {
+	root, err := Parse([]byte(`{"a":{"numbers":[1,5,7]},"b":{"numbers":[2,9]},"c":{"numbers":[4]}}`))
+	if err != nil {
+		t.Fatalf("Parse failed: %v", err)
+	}
+	big := func(v core.Node) bool { return v.Type() == core.Number && v.Int() > 3 }
+
+	// One matched array: Filter keeps or drops the match, FilterElements
+	// looks into it.
+	single := root.Query("//a/numbers")
+	if n := single.Filter(big); !n.IsValid() || n.MatchCount() != 0 {
+		t.Errorf("Filter on one matched array = %s, want no matches", n.String())
+	}
+	if n := single.FilterElements(func(_ int, v core.Node) bool { return big(v) }); n.String() != "[5,7]" {
+		t.Errorf("FilterElements on one matched array = %s, want [5,7]", n.String())
+	}
+
+	// Several matched arrays are flattened in document order.
+	all := root.Query("/*/numbers")
+	if n := all.Filter(func(v core.Node) bool { return v.Len() > 1 }); n.String() != "[[1,5,7],[2,9]]" {
+		t.Errorf("Filter on the matches = %s, want the two longer arrays", n.String())
+	}
+	got := all.FilterElements(func(_ int, v core.Node) bool { return big(v) })
+	if got.String() != "[5,7,9,4]" || got.MatchCount() != 4 {
+		t.Errorf("FilterElements = %s (%d matches), want [5,7,9,4]", got.String(), got.MatchCount())
+	}
+	var paths []string
+	got.ForEachPath(func(path string, _ core.Node) bool {
+		paths = append(paths, path)
+		return true
+	})
+	if want := []string{"/a/numbers[1]", "/a/numbers[2]", "/b/numbers[1]", "/c/numbers[0]"}; len(paths) != len(want) ||
+		paths[0] != want[0] || paths[1] != want[1] || paths[2] != want[2] || paths[3] != want[3] {
+		t.Errorf("paths = %v, want %v", paths, want)
+	}
+	if b, err := got.Bytes(); err != nil || string(b) != "[5,7,9,4]" {
+		t.Errorf("Bytes() = %s, %v", b, err)
+	}
+	if n := got.FilterElements(func(int, core.Node) bool { return true }); n.IsValid() {
+		t.Error("FilterElements on a match set of numbers should fail")
+	}
+	if n := got.Filter(func(v core.Node) bool { return v.Int() > 5 }); n.String() != "[7,9]" {
+		t.Errorf("chained Filter = %s, want [7,9]", n.String())
+	}
+
+	// The index is the place of the element in its own array.
+	firsts := all.FilterElements(func(i int, _ core.Node) bool { return i == 0 })
+	if firsts.String() != "[1,2,4]" {
+		t.Errorf("first elements = %s, want [1,2,4]", firsts.String())
+	}
+	// A plain array works like its single match.
+	if n := root.Query("/a/numbers").FilterElements(func(_ int, v core.Node) bool { return big(v) }); n.String() != "[5,7]" {
+		t.Errorf("FilterElements on an array = %s, want [5,7]", n.String())
+	}
+}
+
+func TestMapElements(t *testing.T) {
+	root, err := Parse([]byte(`{"a":{"numbers":[1,5]},"b":{"numbers":[2]}}`))
+	if err != nil {
+		t.Fatalf("Parse failed: %v", err)
+	}
+	all := root.Query("/*/numbers")
+	if n := all.Map(func(v core.Node) interface{} { return v.Len() }); n.String() != "[2,1]" {
+		t.Errorf("Map on the matches = %s, want [2,1]", n.String())
+	}
+	doubled := all.MapElements(func(i int, v core.Node) interface{} { return v.Int()*2 + int64(i) })
+	if doubled.String() != "[2,11,4]" || doubled.MatchCount() != 3 {
+		t.Errorf("MapElements = %s, want [2,11,4]", doubled.String())
+	}
+	if n := doubled.First(); n.Int() != 2 {
+		t.Errorf("First() of the mapped set = %s, want 2", n.String())
+	}
+	if root.Query("/a/numbers").String() != "[1,5]" {
+		t.Error("MapElements changed the document")
+	}
+
+	bad := all.MapElements(func(int, core.Node) interface{} { return make(chan int) })
+	var pathErr *core.PathError
+	if !errors.As(bad.Error(), &pathErr) || pathErr.Path != "/a/numbers[0]" {
+		t.Errorf("MapElements to an unsupported value = %v, want a *PathError at /a/numbers[0]", bad.Error())
+	}
+}
+
+func TestElementsOnOtherNodes(t *testing.T) {
+	root, err := Parse([]byte(`{"n":5,"list":[1],"objs":{"x":{}}}`))
+	if err != nil {
+		t.Fatalf("Parse failed: %v", err)
+	}
+	keep := func(int, core.Node) bool { return true }
+	for _, n := range []core.Node{root, root.Get("n"), root.Query("/objs/*")} {
+		if got := n.FilterElements(keep); !errors.Is(got.Error(), core.ErrTypeAssertion) {
+			t.Errorf("FilterElements on %s = %v, want ErrTypeAssertion", n.String(), got.Error())
+		}
+	}
+	called := false
+	mixed := root.Query("/*")
+	if got := mixed.MapElements(func(int, core.Node) interface{} { called = true; return 1 }); got.IsValid() || called {
+		t.Error("MapElements on matches that are not all arrays should fail before calling fn")
+	}
+	if got := root.Get("missing").FilterElements(keep); got.IsValid() {
+		t.Error("FilterElements on an invalid node should stay invalid")
+	}
+	if got := root.Query("//missing").FilterElements(keep); !got.IsValid() || got.MatchCount() != 0 {
+		t.Errorf("FilterElements on no matches = %v, want an empty match set", got.Error())
+	}
+}
@@ -0,0 +1,44 @@
+package engine
+
+import (
+	"encoding/json"
+	"errors"
+
+	"github.com/474420502/xjson/internal/core"
+)
+
+// embeddedJSONFunc is the built-in path function for ParseEmbedded:
+// `/payload[@json]/user/id`. A function registered under the same name
+// takes precedence.
+const embeddedJSONFunc = "json"
+
+// ParseEmbedded parses the value of a string node as a JSON document and
+// returns its lazily parsed root, so double-encoded payloads can be queried
+// like any other value. The new document is independent of the outer one:
+// its paths start at its own root and it shares the outer document's
+// registered functions. A string that is not valid JSON yields an invalid
+// node whose *core.PathError names the outer path and wraps the parse
+// error; any other node type yields a *core.TypeError.
+func (n *baseNode) ParseEmbedded() core.Node {
+	self := n.selfOrMe()
+	if n.err != nil {
+		return self
+	}
+	if self.Type() != core.String {
+		return newInvalidNode(&core.TypeError{Path: self.Path(), Want: "embedded JSON", Got: self.Type()})
+	}
+	data := []byte(self.String())
+	if !json.Valid(data) {
+		// Reparse with the engine parser for a positioned *SyntaxError.
+		_, err := MustParseWithFuncs(data, n.funcs)
+		if err == nil {
+			err = errors.New("invalid JSON")
+		}
+		return newInvalidNode(&core.PathError{Path: self.Path(), Op: "ParseEmbedded", Err: err})
+	}
+	root, err := ParseWithFuncs(data, n.funcs)
+	if err != nil {
+		return newInvalidNode(&core.PathError{Path: self.Path(), Op: "ParseEmbedded", Err: err})
+	}
+	return root
+}
@@ -0,0 +1,77 @@
+package engine
+
+import (
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/474420502/xjson/internal/core"
+)
+
+// embed returns v encoded as a JSON string literal.
+func embed(v string) string {
+	b, _ := json.Marshal(v)
+	return string(b)
+}
+
+func TestParseEmbeddedTwoLevels(t *testing.T) {
+	inner := `{"user":{"id":5,"tags":["a","b"]}}`
+	middle := `{"kind":"wrapped","payload":` + embed(inner) + `}`
+	doc := `{"envelope":` + embed(middle) + `}`
+
+	forEachParser(t, doc, func(t *testing.T, root core.Node) {
+		got := root.Get("envelope").ParseEmbedded().Get("payload").ParseEmbedded().Query("/user/id")
+		if got.Int() != 5 {
+			t.Fatalf("accessor form = %v (err %v), want 5", got, got.Error())
+		}
+		if got := root.Query("/envelope[@json]/payload[@json]/user/tags[1]"); got.String() != "b" {
+			t.Fatalf("path form = %v (err %v), want b", got, got.Error())
+		}
+		if got := root.Query("/envelope[@json]/kind"); got.String() != "wrapped" {
+			t.Fatalf("path form = %v, want wrapped", got)
+		}
+	})
+}
+
+func TestParseEmbeddedInvalidContent(t *testing.T) {
+	root, _ := Parse([]byte(`{"data":{"payload":` + embed(`{"user":{"id":5}`) + `,"n":1}}`))
+	got := root.Query("/data/payload[@json]")
+	if got.IsValid() {
+		t.Fatalf("expected invalid embedded JSON to fail, got %v", got)
+	}
+	var pathErr *core.PathError
+	if !errors.As(got.Error(), &pathErr) || pathErr.Path != "/data/payload" {
+		t.Fatalf("expected a *PathError naming /data/payload, got %v", got.Error())
+	}
+	var syntaxErr *core.SyntaxError
+	if !errors.As(got.Error(), &syntaxErr) {
+		t.Fatalf("expected the parse error to be wrapped, got %v", got.Error())
+	}
+	if !strings.Contains(got.Error().Error(), "/data/payload") {
+		t.Fatalf("expected the message to name the outer path, got %q", got.Error())
+	}
+
+	if got := root.Query("/data/n").ParseEmbedded(); got.IsValid() || !errors.Is(got.Error(), core.ErrTypeAssertion) {
+		t.Fatalf("ParseEmbedded on a number = %v (err %v), want ErrTypeAssertion", got, got.Error())
+	}
+	missing := root.Get("missing")
+	if got := missing.ParseEmbedded(); got.Error() != missing.Error() {
+		t.Fatalf("ParseEmbedded on an invalid node = %v, want its own error", got.Error())
+	}
+}
+
+func TestParseEmbeddedScalarAndRegisteredFunc(t *testing.T) {
+	root, _ := Parse([]byte(`{"n":"42","s":"\"hi\""}`))
+	if got := root.Query("/n[@json]"); got.Type() != core.Number || got.Int() != 42 {
+		t.Fatalf("embedded number = %v, want 42", got)
+	}
+	if got := root.Query("/s[@json]"); got.Type() != core.String || got.String() != "hi" {
+		t.Fatalf("embedded string = %v, want hi", got)
+	}
+
+	root.RegisterFunc("json", func(n core.Node) core.Node { return NewStringNode(nil, "custom", nil) })
+	if got := root.Query("/n[@json]"); got.String() != "custom" {
+		t.Fatalf("registered json func = %v, want it to take precedence", got)
+	}
+}
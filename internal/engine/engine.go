@@ -40,25 +40,64 @@ func ParseWithFuncs(data []byte, funcs *map[string]core.UnaryPathFunc) (core.Nod
 	if funcs == nil {
 		funcs = &map[string]core.UnaryPathFunc{}
 	}
-	
-	// Check first non-whitespace character to determine root node type
-	firstChar := getFirstNonWhitespaceChar(data)
-	
+	return parseLazy(data, funcs, nil, leniency{})
+}
+
+// NewObject returns the root of a new document holding an empty object, to
+// be built up with Set and the other writes.
+func NewObject() core.Node {
+	n := NewObjectNode(nil, nil, &map[string]core.UnaryPathFunc{}).(*objectNode)
+	n.value = make(map[string]core.Node)
+	n.parsed.Store(true)
+	return n
+}
+
+// NewArray returns the root of a new document holding an empty array, to be
+// built up with Append and the other writes.
+func NewArray() core.Node {
+	n := NewArrayNode(nil, nil, &map[string]core.UnaryPathFunc{}).(*arrayNode)
+	n.parsed.Store(true)
+	return n
+}
+
+// FromValue returns the root of a new document holding v, which may be any
+// value Set accepts: maps with string keys, slices of interface{}, strings,
+// numbers, bools, json.Number, nil and nodes of documents of their own,
+// nested to any depth.
+func FromValue(v interface{}) (core.Node, error) {
+	node := NewNodeFromInterface(nil, v, &map[string]core.UnaryPathFunc{})
+	if err := node.Error(); err != nil {
+		return nil, err
+	}
+	return node, nil
+}
+
+// parseLazy creates the root node of a lazily parsed document, placing it
+// and its descendants in arena when one is given, with the given leniency.
+func parseLazy(data []byte, funcs *map[string]core.UnaryPathFunc, arena *nodeArena, lenient leniency) (core.Node, error) {
+	p := newParser(data, funcs)
+	p.arena = arena
+	p.lenient = lenient
+
 	// Create appropriate root node with the raw data but don't parse it yet
 	// The parsing will happen on-demand when nodes are accessed
-	var node core.Node
-	switch firstChar {
+	var root core.Node
+	switch getFirstNonWhitespaceChar(data) {
 	case '{':
-		node = NewObjectNode(nil, data, funcs)
+		root = p.newObjectNode(nil, data)
 	case '[':
-		node = NewArrayNode(nil, data, funcs)
+		node := p.newArrayNode(nil)
+		node.raw = data
+		root = node
 	default:
 		// For non-object/array root values, parse immediately
-		p := newParser(data, funcs)
-		return p.Parse()
+		var err error
+		if root, err = p.Parse(); err != nil {
+			return nil, err
+		}
 	}
-	
-	return node, nil
+	nodeBase(root).leniency = lenient
+	return root, nil
 }
 
 // getFirstNonWhitespaceChar returns the first non-whitespace character in the data
@@ -0,0 +1,207 @@
+package engine
+
+import (
+	"fmt"
+	"strconv"
+
+	"github.com/474420502/xjson/internal/core"
+)
+
+// DiffKind classifies a Difference.
+type DiffKind uint8
+
+const (
+	// DiffChanged marks a value present on both sides that differs.
+	DiffChanged DiffKind = iota
+	// DiffAdded marks a value present only in the second node.
+	DiffAdded
+	// DiffRemoved marks a value present only in the first node.
+	DiffRemoved
+)
+
+func (k DiffKind) String() string {
+	switch k {
+	case DiffChanged:
+		return "changed"
+	case DiffAdded:
+		return "added"
+	case DiffRemoved:
+		return "removed"
+	}
+	return fmt.Sprintf("DiffKind(%d)", uint8(k))
+}
+
+// Difference is one place where two JSON values differ. A is nil for an added
+// value and B is nil for a removed one.
+type Difference struct {
+	Path string
+	Kind DiffKind
+	A    core.Node
+	B    core.Node
+}
+
+func (d Difference) String() string {
+	switch d.Kind {
+	case DiffAdded:
+		return fmt.Sprintf("%s: added %s", d.Path, diffValueString(d.B))
+	case DiffRemoved:
+		return fmt.Sprintf("%s: removed %s", d.Path, diffValueString(d.A))
+	}
+	return fmt.Sprintf("%s: changed %s -> %s", d.Path, diffValueString(d.A), diffValueString(d.B))
+}
+
+func diffValueString(n core.Node) string {
+	if n == nil || !n.IsValid() {
+		return "invalid"
+	}
+	if n.Type() == core.String {
+		return strconv.Quote(n.String())
+	}
+	return n.String()
+}
+
+// Equals reports whether the node and other hold the same JSON value. See
+// Equal.
+func (n *baseNode) Equals(other core.Node) bool {
+	return Equal(n.selfOrMe(), other)
+}
+
+// Equal reports whether a and b hold the same JSON value: object key order is
+// ignored, arrays compare element by element, numbers compare by value (1,
+// 1.0 and 1e0 are equal) and strings compare after unescaping. Integers that
+// fit in an int64 compare exactly. Invalid nodes are never equal.
+func Equal(a, b core.Node) bool {
+	if a == nil || b == nil || !a.IsValid() || !b.IsValid() {
+		return false
+	}
+	if a.Type() != b.Type() {
+		return false
+	}
+	switch a.Type() {
+	case core.Object:
+		aKeys, bKeys := a.Keys(), b.Keys()
+		if len(aKeys) != len(bKeys) {
+			return false
+		}
+		for i, key := range aKeys {
+			if bKeys[i] != key || !Equal(a.Get(key), b.Get(key)) {
+				return false
+			}
+		}
+		return true
+	case core.Array:
+		aElems, bElems := a.UnsafeArray(), b.UnsafeArray()
+		if len(aElems) != len(bElems) {
+			return false
+		}
+		for i := range aElems {
+			if !Equal(aElems[i], bElems[i]) {
+				return false
+			}
+		}
+		return true
+	}
+	return scalarEqual(a, b)
+}
+
+// scalarEqual compares two valid scalar nodes of the same type.
+func scalarEqual(a, b core.Node) bool {
+	switch a.Type() {
+	case core.String:
+		as, _ := a.RawString()
+		bs, _ := b.RawString()
+		return as == bs
+	case core.Bool:
+		return a.Bool() == b.Bool()
+	case core.Null:
+		return true
+	case core.Number:
+		return numberTextEqual(a.Raw(), b.Raw())
+	}
+	return false
+}
+
+// numberTextEqual compares two JSON numbers by value: exactly when both are
+// integers that fit an int64, as float64 otherwise.
+func numberTextEqual(a, b string) bool {
+	if a == b {
+		return true
+	}
+	ai, aerr := strconv.ParseInt(a, 10, 64)
+	bi, berr := strconv.ParseInt(b, 10, 64)
+	if aerr == nil && berr == nil {
+		return ai == bi
+	}
+	af, aerr := strconv.ParseFloat(a, 64)
+	bf, berr := strconv.ParseFloat(b, 64)
+	return aerr == nil && berr == nil && af == bf
+}
+
+// Diff lists where b differs from a, using the semantics of Equal. Objects
+// and arrays are compared member by member; any other mismatch, including a
+// change of type, is reported once at the path where it occurs. Members are
+// reported in a's document order followed by members only present in b. The
+// result is empty when Equal(a, b) holds.
+func Diff(a, b core.Node) []Difference {
+	var diffs []Difference
+	diffNodes("", a, b, &diffs)
+	return diffs
+}
+
+func diffNodes(path string, a, b core.Node, diffs *[]Difference) {
+	at := func(p string) string {
+		if p == "" {
+			return "/"
+		}
+		return p
+	}
+	if a == nil || b == nil || !a.IsValid() || !b.IsValid() || a.Type() != b.Type() {
+		*diffs = append(*diffs, Difference{Path: at(path), Kind: DiffChanged, A: a, B: b})
+		return
+	}
+	switch a.Type() {
+	case core.Object:
+		aKeys := diffKeys(a)
+		for _, key := range aKeys {
+			child := path + "/" + formatPathKey(key)
+			bv := b.Get(key)
+			if !bv.IsValid() {
+				*diffs = append(*diffs, Difference{Path: child, Kind: DiffRemoved, A: a.Get(key)})
+				continue
+			}
+			diffNodes(child, a.Get(key), bv, diffs)
+		}
+		for _, key := range diffKeys(b) {
+			if !a.Get(key).IsValid() {
+				child := path + "/" + formatPathKey(key)
+				*diffs = append(*diffs, Difference{Path: child, Kind: DiffAdded, B: b.Get(key)})
+			}
+		}
+	case core.Array:
+		aElems, bElems := a.UnsafeArray(), b.UnsafeArray()
+		for i := 0; i < len(aElems) || i < len(bElems); i++ {
+			child := fmt.Sprintf("%s[%d]", path, i)
+			switch {
+			case i >= len(bElems):
+				*diffs = append(*diffs, Difference{Path: child, Kind: DiffRemoved, A: aElems[i]})
+			case i >= len(aElems):
+				*diffs = append(*diffs, Difference{Path: child, Kind: DiffAdded, B: bElems[i]})
+			default:
+				diffNodes(child, aElems[i], bElems[i], diffs)
+			}
+		}
+	default:
+		if !scalarEqual(a, b) {
+			*diffs = append(*diffs, Difference{Path: at(path), Kind: DiffChanged, A: a, B: b})
+		}
+	}
+}
+
+// diffKeys returns the keys of an object in document order when the node
+// tracks it, and sorted otherwise.
+func diffKeys(n core.Node) []string {
+	if o, ok := n.(*objectNode); ok {
+		return o.documentKeys()
+	}
+	return n.Keys()
+}
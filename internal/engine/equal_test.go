@@ -0,0 +1,99 @@
+package engine
+
+import (
+	"testing"
+
+	"github.com/474420502/xjson/internal/core"
+)
+
+func TestEqualSemantics(t *testing.T) {
+	testCases := []struct {
+		a, b string
+		want bool
+	}{
+		{`{"a":1,"b":[1,2,{"c":"x"}]}`, `{"b":[1,2,{"c":"x"}],"a":1}`, true},
+		{`{"n":1}`, `{"n":1.0}`, true},
+		{`{"n":1e2}`, `{"n":100}`, true},
+		{`{"n":-0}`, `{"n":0}`, true},
+		{`{"n":9007199254740993}`, `{"n":9007199254740992}`, false},
+		{`{"s":"A\n"}`, `{"s":"A\n"}`, true},
+		{`[1,2]`, `[2,1]`, false},
+		{`[1,2]`, `[1,2,3]`, false},
+		{`{"a":null}`, `{"a":null}`, true},
+		{`{"a":null}`, `{}`, false},
+		{`{"a":true}`, `{"a":"true"}`, false},
+		{`{"a":{"b":{"c":[true,false]}}}`, `{"a":{"b":{"c":[true,true]}}}`, false},
+		{`"x"`, `"x"`, true},
+	}
+	for _, tc := range testCases {
+		lazy, err := Parse([]byte(tc.a))
+		if err != nil {
+			t.Fatalf("Parse(%s) failed: %v", tc.a, err)
+		}
+		eager, err := MustParse([]byte(tc.b))
+		if err != nil {
+			t.Fatalf("MustParse(%s) failed: %v", tc.b, err)
+		}
+		if got := lazy.Equals(eager); got != tc.want {
+			t.Fatalf("%s Equals %s = %v, want %v", tc.a, tc.b, got, tc.want)
+		}
+		if got := Equal(eager, lazy); got != tc.want {
+			t.Fatalf("Equal(%s, %s) = %v, want %v", tc.b, tc.a, got, tc.want)
+		}
+		if got := len(Diff(lazy, eager)) == 0; got != tc.want {
+			t.Fatalf("Diff(%s, %s) = %v, want equal=%v", tc.a, tc.b, Diff(lazy, eager), tc.want)
+		}
+	}
+
+	root, _ := Parse([]byte(`{"a":1}`))
+	if root.Get("missing").Equals(root.Get("missing")) || Equal(root, nil) {
+		t.Fatal("expected invalid nodes never to be equal")
+	}
+	built := NewObjectNode(nil, nil, nil)
+	built.Set("a", 1)
+	if !root.Equals(built) {
+		t.Fatal("expected a constructed object to equal the parsed one")
+	}
+}
+
+func TestDiffReportsPathsAndKinds(t *testing.T) {
+	a, err := Parse([]byte(`{"name":"x","tags":["a","b","c"],"meta":{"v":1,"old":true},"n":1.0,"id":7}`))
+	if err != nil {
+		t.Fatalf("Parse failed: %v", err)
+	}
+	b, err := MustParse([]byte(`{"id":"7","n":1,"meta":{"v":2,"new":null},"tags":["a","B"],"name":"x","extra":[]}`))
+	if err != nil {
+		t.Fatalf("MustParse failed: %v", err)
+	}
+
+	want := []string{
+		`/tags[1]: changed "b" -> "B"`,
+		`/tags[2]: removed "c"`,
+		`/meta/v: changed 1 -> 2`,
+		`/meta/old: removed true`,
+		`/meta/new: added null`,
+		`/id: changed 7 -> "7"`,
+		`/extra: added []`,
+	}
+	diffs := Diff(a, b)
+	if len(diffs) != len(want) {
+		t.Fatalf("expected %d differences, got %v", len(want), diffs)
+	}
+	for i, d := range diffs {
+		if got := d.String(); got != want[i] {
+			t.Fatalf("difference %d = %s, want %s", i, got, want[i])
+		}
+	}
+	if diffs[3].Kind != DiffRemoved || diffs[3].B != nil || diffs[3].A.Type() != core.Bool {
+		t.Fatalf("unexpected removed difference %+v", diffs[3])
+	}
+	if diffs[4].Kind.String() != "added" || diffs[4].A != nil {
+		t.Fatalf("unexpected added difference %+v", diffs[4])
+	}
+
+	x, _ := Parse([]byte(`[1]`))
+	y, _ := Parse([]byte(`{"a":1}`))
+	if got := Diff(x, y); len(got) != 1 || got[0].Path != "/" || got[0].Kind != DiffChanged {
+		t.Fatalf("expected a single root change, got %v", got)
+	}
+}
@@ -0,0 +1,79 @@
+package engine
+
+import "testing"
+
+func TestExistsAndHasMatches(t *testing.T) {
+	root, err := Parse([]byte(`{
+		"products": [{"name": "pen", "price": 2}, {"name": "ink", "price": 30}],
+		"empty": [],
+		"shop": {"open": true, "tags": {}},
+		"note": null
+	}`))
+	if err != nil {
+		t.Fatalf("Parse failed: %v", err)
+	}
+	testCases := []struct {
+		name       string
+		path       string
+		exists     bool
+		hasMatches bool
+		len        int
+	}{
+		{"key", "/shop/open", true, true, 0},
+		{"null value", "/note", true, true, 0},
+		{"empty array value", "/empty", true, true, 0},
+		{"empty object value", "/shop/tags", true, true, 0},
+		{"missing key", "/shop/closed", false, false, 0},
+		{"typo in path", "/prodcts/name", false, false, 0},
+		{"index", "/products[1]", true, true, 0},
+		{"index out of bounds", "/products[5]", false, false, 0},
+		{"index on an object", "/shop[0]", false, false, 0},
+
+		{"filter with matches", "/products[?(@.price > 10)]", true, true, 1},
+		{"filter without matches", "/products[?(@.price > 99999)]", true, false, 0},
+		{"key after empty filter", "/products[?(@.price > 99999)]/name", true, false, 0},
+		{"filter on empty array", "/empty[?(@.price > 1)]", true, false, 0},
+		{"index after empty filter", "/products[?(@.price > 99999)][0]", false, false, 0},
+
+		{"wildcard with matches", "/products[*]", true, true, 2},
+		{"wildcard over empty array", "/empty[*]", true, false, 0},
+		{"wildcard over empty object", "/shop/tags/*", true, false, 0},
+		{"key after empty wildcard", "/empty[*]/name", true, false, 0},
+		{"missing key after wildcard", "/products[*]/nope", false, false, 0},
+
+		{"slice with matches", "/products[0:1]", true, true, 1},
+		{"slice past the end", "/products[5:9]", true, false, 0},
+		{"slice of empty array", "/empty[0:2]", true, false, 0},
+		{"key after empty slice", "/products[5:9]/name", true, false, 0},
+		{"slice of an object", "/shop[0:1]", false, false, 0},
+
+		{"recursive with matches", "//price", true, true, 2},
+		{"recursive without matches", "//nothing", true, false, 0},
+		{"key after empty recursive", "//nothing/name", true, false, 0},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			n := root.Query(tc.path)
+			if n.Exists() != tc.exists || n.HasMatches() != tc.hasMatches {
+				t.Fatalf("Query(%q): Exists() = %v, HasMatches() = %v, want %v, %v (error %v)",
+					tc.path, n.Exists(), n.HasMatches(), tc.exists, tc.hasMatches, n.Error())
+			}
+			if n.IsValid() != tc.exists || (n.Error() == nil) != tc.exists {
+				t.Fatalf("Query(%q): IsValid() = %v, Error() = %v, want them to agree with Exists()",
+					tc.path, n.IsValid(), n.Error())
+			}
+			if tc.len > 0 || !tc.hasMatches {
+				if got := n.Len(); got != tc.len {
+					t.Fatalf("Query(%q).Len() = %d, want %d", tc.path, got, tc.len)
+				}
+			}
+		})
+	}
+
+	if n := root.Query("/products").Offset(2); !n.Exists() || n.HasMatches() {
+		t.Errorf("Offset past the end: Exists() = %v, HasMatches() = %v, want true, false", n.Exists(), n.HasMatches())
+	}
+	if n := root.Query("/products[*]").Limit(1); !n.HasMatches() {
+		t.Error("Limit(1) of two matches should have matches")
+	}
+}
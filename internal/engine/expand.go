@@ -0,0 +1,81 @@
+package engine
+
+import (
+	"fmt"
+	"strconv"
+
+	"github.com/474420502/xjson/internal/core"
+)
+
+// PathMatch is one concrete location produced by ExpandPath.
+type PathMatch struct {
+	// Path is the canonical path of the location, e.g. "/items[2]/id".
+	Path string
+	// Node is the value at Path, or an invalid node when nothing exists there.
+	Node core.Node
+}
+
+// ExpandPath resolves path from start into concrete locations. Unlike Query,
+// wildcards keep one entry per visited child and locations that do not exist
+// are reported as invalid nodes instead of being dropped, which lets callers
+// tell which element is missing a field. Only key, index and wildcard steps
+// are supported.
+func ExpandPath(start core.Node, path string) ([]PathMatch, error) {
+	tokens, err := ParseQuery(path)
+	if err != nil {
+		return nil, err
+	}
+	matches := []PathMatch{{Node: start}}
+	for _, t := range tokens {
+		next := make([]PathMatch, 0, len(matches))
+		for _, m := range matches {
+			switch t.Op {
+			case OpKey:
+				key := t.Value.(string)
+				child := sharedInvalidNode()
+				if m.Node.IsValid() && m.Node.Type() == core.Object {
+					child = m.Node.Get(key)
+				}
+				next = append(next, PathMatch{Path: m.Path + "/" + formatPathKey(key), Node: child})
+			case OpIndex:
+				idx := t.Value.(int)
+				if m.Node.IsValid() && m.Node.Type() == core.Object {
+					// A numeric step names a member of an object.
+					key := strconv.Itoa(idx)
+					next = append(next, PathMatch{Path: m.Path + "/" + formatPathKey(key), Node: m.Node.Get(key)})
+					break
+				}
+				child := sharedInvalidNode()
+				if m.Node.IsValid() && m.Node.Type() == core.Array {
+					child = m.Node.Index(idx)
+				}
+				next = append(next, PathMatch{Path: m.Path + "[" + strconv.Itoa(idx) + "]", Node: child})
+			case OpWildcard:
+				next = appendWildcardMatches(next, m)
+			default:
+				return nil, fmt.Errorf("operation %v not supported in ExpandPath", t.Op)
+			}
+		}
+		matches = next
+	}
+	return matches, nil
+}
+
+func appendWildcardMatches(dst []PathMatch, m PathMatch) []PathMatch {
+	if !m.Node.IsValid() {
+		return append(dst, PathMatch{Path: m.Path + "/*", Node: m.Node})
+	}
+	switch m.Node.Type() {
+	case core.Object:
+		for _, key := range m.Node.Keys() {
+			dst = append(dst, PathMatch{Path: m.Path + "/" + formatPathKey(key), Node: m.Node.Get(key)})
+		}
+	case core.Array:
+		for i, child := range m.Node.UnsafeArray() {
+			dst = append(dst, PathMatch{Path: m.Path + "[" + strconv.Itoa(i) + "]", Node: child})
+		}
+	default:
+		dst = append(dst, PathMatch{Path: m.Path + "/*", Node: sharedInvalidNode()})
+	}
+	return dst
+}
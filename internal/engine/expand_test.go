@@ -0,0 +1,49 @@
+package engine
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestExpandPathKeepsMissingLocations(t *testing.T) {
+	root, err := Parse([]byte(`{"items":[{"id":1},{"name":"x"},{"id":3}],"meta":{"b":2,"a":1},"n":5}`))
+	if err != nil {
+		t.Fatalf("Parse failed: %v", err)
+	}
+
+	testCases := []struct {
+		path  string
+		paths []string
+		valid []bool
+	}{
+		{"/items[*]/id", []string{"/items[0]/id", "/items[1]/id", "/items[2]/id"}, []bool{true, false, true}},
+		{"/items/*/id", []string{"/items[0]/id", "/items[1]/id", "/items[2]/id"}, []bool{true, false, true}},
+		{"/meta/*", []string{"/meta/a", "/meta/b"}, []bool{true, true}},
+		{"/items[-1]/id", []string{"/items[-1]/id"}, []bool{true}},
+		{"/missing[*]/id", []string{"/missing/*/id"}, []bool{false}},
+		{"/n/*", []string{"/n/*"}, []bool{false}},
+		{"/n/x", []string{"/n/x"}, []bool{false}},
+		{"/items[5]", []string{"/items[5]"}, []bool{false}},
+	}
+	for _, tc := range testCases {
+		matches, err := ExpandPath(root, tc.path)
+		if err != nil {
+			t.Fatalf("ExpandPath(%q) failed: %v", tc.path, err)
+		}
+		var paths []string
+		var valid []bool
+		for _, m := range matches {
+			paths = append(paths, m.Path)
+			valid = append(valid, m.Node.IsValid())
+		}
+		if !reflect.DeepEqual(paths, tc.paths) || !reflect.DeepEqual(valid, tc.valid) {
+			t.Fatalf("ExpandPath(%q) = %v %v, want %v %v", tc.path, paths, valid, tc.paths, tc.valid)
+		}
+	}
+
+	for _, path := range []string{"//id", "/items[0:1]", "/items[", "/items[@fn]"} {
+		if _, err := ExpandPath(root, path); err == nil {
+			t.Fatalf("expected ExpandPath(%q) to fail", path)
+		}
+	}
+}
@@ -0,0 +1,138 @@
+package engine
+
+import (
+	"fmt"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/474420502/xjson/internal/core"
+	internalquery "github.com/474420502/xjson/internal/query"
+)
+
+// Plan is a query path broken into the steps the evaluator runs, for
+// debugging a query that finds less than expected. Explain returns the
+// steps of a path; QueryDebug also records what each step did.
+type Plan struct {
+	Path  string
+	Steps []PlanStep
+	// Traced is set on the plans of QueryDebug.
+	Traced bool
+	// Err is the error the traced query failed with, if any.
+	Err error
+}
+
+// PlanStep is one step of a Plan. Op names the operation: "key", "index",
+// "slice", "wildcard", "recursive", "all", "filter", "func", "pick" or
+// "parent". Text is the step written as a path, such as "/name" or
+// "[?(@.price > 10)]". The other fields are set by QueryDebug: whether the
+// step ran, how many nodes it started from and ended with, counting each
+// match of a match set, and the error it ended with.
+type PlanStep struct {
+	Op   string
+	Text string
+	Ran  bool
+	In   int
+	Out  int
+	Err  error
+}
+
+// Explain returns the steps of path without running it, or the error that
+// makes it invalid.
+func Explain(path string) (Plan, error) {
+	tokens, err := internalquery.NewParser(path).Parse()
+	if err != nil {
+		return Plan{Path: path}, err
+	}
+	plan := Plan{Path: path, Steps: make([]PlanStep, len(tokens))}
+	for i, t := range tokens {
+		plan.Steps[i] = PlanStep{Op: t.Type.String(), Text: internalquery.FormatToken(t)}
+	}
+	return plan, nil
+}
+
+// QueryDebug runs path from node like Query, recording for each step the
+// number of nodes that entered it and survived it and the error it failed
+// with. Only counts are kept, so the trace costs no more than the query.
+// The query runs on the general evaluator, without the query cache or the
+// fast paths, which give the same results.
+func QueryDebug(node core.Node, path string) (result core.Node, plan Plan) {
+	plan, err := Explain(path)
+	plan.Traced = true
+	if err != nil {
+		plan.Err = err
+		return newInvalidNode(err), plan
+	}
+	if node == nil {
+		plan.Err = fmt.Errorf("nil start node")
+		return newInvalidNode(plan.Err), plan
+	}
+	defer func() { plan.finish(result) }()
+	defer recoverPanic("Query", path, &result)
+	tokens, _ := ParseQuery(path)
+	return traceQueryTokens(queryStart(node, path), tokens, nil, -1, &plan), plan
+}
+
+// enter records that step i starts from in nodes.
+func (p *Plan) enter(i, in int) {
+	p.Steps[i].Ran = true
+	p.Steps[i].In = in
+}
+
+// leave records that step i ended with out nodes and err.
+func (p *Plan) leave(i, out int, err error) {
+	p.Steps[i].Out = out
+	p.Steps[i].Err = err
+}
+
+// finish records the result of the query. A step that failed without
+// leaving, by returning early or panicking, ends with its error.
+func (p *Plan) finish(result core.Node) {
+	p.Err = result.Error()
+	if p.Err == nil {
+		return
+	}
+	for i := len(p.Steps) - 1; i >= 0; i-- {
+		if step := &p.Steps[i]; step.Ran {
+			if step.Err == nil {
+				step.Out, step.Err = 0, p.Err
+			}
+			return
+		}
+	}
+}
+
+// String formats the plan for a log, one step per line, with the counts
+// and errors of a traced plan:
+//
+//	/items[?(@.v > 5)]/id
+//	  1  key     /items        1 -> 1
+//	  2  filter  [?(@.v > 5)]  1 -> 0
+//	  3  key     /id           0 -> 0
+func (p Plan) String() string {
+	var b strings.Builder
+	b.WriteString(p.Path)
+	if len(p.Steps) == 0 {
+		b.WriteString("\n  (no steps)")
+	}
+	b.WriteByte('\n')
+	w := tabwriter.NewWriter(&b, 0, 0, 2, ' ', 0)
+	for i, step := range p.Steps {
+		fmt.Fprintf(w, "  %d\t%s\t%s", i+1, step.Op, step.Text)
+		switch {
+		case !p.Traced:
+		case !step.Ran:
+			fmt.Fprint(w, "\tnot run")
+		default:
+			fmt.Fprintf(w, "\t%d -> %d", step.In, step.Out)
+			if step.Err != nil {
+				fmt.Fprintf(w, "\terror: %v", step.Err)
+			}
+		}
+		fmt.Fprint(w, "\n")
+	}
+	w.Flush()
+	if p.Traced && p.Err != nil && (len(p.Steps) == 0 || !p.Steps[0].Ran) {
+		fmt.Fprintf(&b, "  error: %v\n", p.Err)
+	}
+	return strings.TrimSuffix(b.String(), "\n")
+}
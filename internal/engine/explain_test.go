@@ -0,0 +1,120 @@
+package engine
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/474420502/xjson/internal/core"
+)
+
+const explainDoc = `{"store":{"book":[
+	{"title":"A","price":8,"tags":["x"]},
+	{"title":"B","price":12},
+	{"title":"C","price":30,"tags":["y","z"]}
+]}}`
+
+func TestExplain(t *testing.T) {
+	plan, err := Explain(`/store/book[?(@.price>10)][0:1]//title`)
+	if err != nil {
+		t.Fatalf("Explain failed: %v", err)
+	}
+	var got []string
+	for _, step := range plan.Steps {
+		got = append(got, step.Op+" "+step.Text)
+	}
+	want := []string{"key /store", "key /book", "filter [?(@.price > 10)]", "slice [0:1]", "recursive //title"}
+	if strings.Join(got, ", ") != strings.Join(want, ", ") {
+		t.Errorf("steps = %q, want %q", got, want)
+	}
+	if plan.Traced || plan.Steps[0].Ran {
+		t.Error("Explain should not run the query")
+	}
+	if _, err := Explain(`/store/book[?(@.price >`); err == nil {
+		t.Error("Explain of a broken path should fail")
+	}
+}
+
+func TestQueryDebugCountsEachStep(t *testing.T) {
+	for name, parse := range testParsers {
+		root, err := parse([]byte(explainDoc))
+		if err != nil {
+			t.Fatalf("%s: parse failed: %v", name, err)
+		}
+		path := `/store/book[?(@.price > 100)]/title`
+		result, plan := QueryDebug(root, path)
+		if got, want := describeResult(result), describeResult(root.Query(path)); got != want {
+			t.Errorf("%s: QueryDebug result = %s, Query gives %s", name, got, want)
+		}
+		counts := [][2]int{}
+		for _, step := range plan.Steps {
+			if !step.Ran {
+				t.Fatalf("%s: step %s did not run", name, step.Text)
+			}
+			counts = append(counts, [2]int{step.In, step.Out})
+		}
+		// The filter is the third step, after /store and /book.
+		want := [][2]int{{1, 1}, {1, 1}, {1, 0}, {0, 0}}
+		if len(counts) != len(want) || counts[2] != want[2] || counts[3] != want[3] {
+			t.Errorf("%s: counts = %v, want %v", name, counts, want)
+		}
+		if !strings.Contains(plan.String(), "filter  [?(@.price > 100)]  1 -> 0") {
+			t.Errorf("%s: String() = \n%s", name, plan.String())
+		}
+	}
+}
+
+func TestQueryDebugTracesRunsAndErrors(t *testing.T) {
+	root, err := Parse([]byte(explainDoc))
+	if err != nil {
+		t.Fatalf("Parse failed: %v", err)
+	}
+	testCases := []struct {
+		path   string
+		counts [][2]int
+		failed int
+	}{
+		// A wildcard over matches that are arrays steps into their elements.
+		{`/store/book[*]/tags[*]`, [][2]int{{1, 1}, {1, 1}, {1, 3}, {3, 2}, {2, 3}}, -1},
+		{`/store/book/title`, [][2]int{{1, 1}, {1, 1}, {1, 3}}, -1},
+		{`//price`, [][2]int{{1, 3}}, -1},
+		{`/store/book[1:]/price`, [][2]int{{1, 1}, {1, 1}, {1, 2}, {2, 2}}, -1},
+		{`/store/missing/title`, [][2]int{{1, 1}, {1, 0}}, 1},
+		{`/store/book[7]/title`, [][2]int{{1, 1}, {1, 1}, {1, 0}}, 2},
+		{`/store/book/0/x`, [][2]int{{1, 1}, {1, 1}, {1, 1}, {1, 0}}, 3},
+	}
+	for _, tc := range testCases {
+		result, plan := QueryDebug(root, tc.path)
+		if got, want := describeResult(result), describeResult(root.Query(tc.path)); got != want {
+			t.Errorf("%s: QueryDebug result = %s, Query gives %s", tc.path, got, want)
+		}
+		var counts [][2]int
+		for i, step := range plan.Steps {
+			if step.Ran {
+				counts = append(counts, [2]int{step.In, step.Out})
+			}
+			if (step.Err != nil) != (i == tc.failed) {
+				t.Errorf("%s: step %d error = %v", tc.path, i+1, step.Err)
+			}
+		}
+		if fmt.Sprint(counts) != fmt.Sprint(tc.counts) {
+			t.Errorf("%s: counts = %v, want %v\n%s", tc.path, counts, tc.counts, plan)
+		}
+		if (plan.Err != nil) != (tc.failed >= 0) || (plan.Err != nil && plan.Err.Error() != result.Error().Error()) {
+			t.Errorf("%s: plan error = %v, result error %v", tc.path, plan.Err, result.Error())
+		}
+		if tc.failed >= 0 && !strings.Contains(plan.String(), "not run") && tc.failed < len(plan.Steps)-1 {
+			t.Errorf("%s: String() should show the steps that did not run:\n%s", tc.path, plan)
+		}
+	}
+
+	if _, plan := QueryDebug(root, `/store[`); plan.Err == nil || !plan.Traced || !strings.Contains(plan.String(), "error:") {
+		t.Errorf("QueryDebug of a broken path = %+v", plan)
+	}
+	panicking, _ := MustParse([]byte(`{"a":[1]}`))
+	panicking.RegisterFunc("boom", func(core.Node) core.Node { panic("boom") })
+	if result, plan := QueryDebug(panicking, `/a[@boom]`); result.IsValid() || plan.Steps[1].Err == nil || !errors.Is(plan.Err, result.Error()) {
+		t.Errorf("a panicking step = %v, %+v", result.Error(), plan)
+	}
+}
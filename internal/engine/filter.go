@@ -0,0 +1,368 @@
+package engine
+
+import (
+	"math"
+	"strconv"
+	"time"
+
+	"github.com/474420502/xjson/internal/core"
+	internalquery "github.com/474420502/xjson/internal/query"
+)
+
+// filterValue is an evaluated operand of a filter expression.
+type filterValue struct {
+	kind core.NodeType
+	num  float64
+	str  string
+	b    bool
+	t    time.Time
+	node core.Node
+}
+
+// timeKind is the kind of an instant made by time(). It is no JSON type, so
+// instants only compare with instants.
+const timeKind core.NodeType = -1
+
+// applyFilter evaluates a `[?(...)]` step. Array elements are kept when the
+// predicate holds, position() being their index in the array; any other node
+// is tested as a single candidate at position 0. The result
+// is always a match set holding the surviving (canonical) children. A
+// non-negative limit stops the evaluation once that many matches are found,
+// and a stop of cc ends it with cc's error.
+func applyFilter(cur core.Node, expr internalquery.Expression, limit int, cc *cancelCheck) core.Node {
+	results := make([]core.Node, 0)
+	if limit == 0 {
+		return newMatchSet(cur, results, cur.GetFuncs())
+	}
+	if a, ok := cur.(*arrayNode); ok {
+		it := a.rawIter()
+		for i := 0; (limit < 0 || len(results) < limit) && !cc.stop() && it.Next(); i++ {
+			if elem := it.ParseValue(); elem.IsValid() && evalFilterPredicate(expr, elem, i) {
+				results = append(results, elem)
+			}
+		}
+		if err := it.Err(); err != nil {
+			return newInvalidNode(err)
+		}
+		if err := cc.Err(); err != nil {
+			return newInvalidNode(err)
+		}
+	} else if evalFilterPredicate(expr, cur, 0) {
+		results = append(results, cur)
+	}
+	return newMatchSet(cur, results, cur.GetFuncs())
+}
+
+// evalFilterPredicate reports whether expr holds for the current element,
+// found at index of the filtered array.
+func evalFilterPredicate(expr internalquery.Expression, current core.Node, index int) bool {
+	switch e := expr.(type) {
+	case internalquery.ExpressionBinary:
+		switch e.Op {
+		case "&&":
+			return evalFilterPredicate(e.Left, current, index) && evalFilterPredicate(e.Right, current, index)
+		case "||":
+			return evalFilterPredicate(e.Left, current, index) || evalFilterPredicate(e.Right, current, index)
+		}
+	case internalquery.ExpressionUnary:
+		if e.Op == "!" {
+			return !evalFilterPredicate(e.Operand, current, index)
+		}
+	case internalquery.ExpressionPath:
+		// A bare path is an existence test.
+		return resolveFilterPath(current, e).IsValid()
+	case internalquery.ExpressionCall:
+		if !isValueCall(e) {
+			return evalFilterCall(e, current)
+		}
+	}
+	v, ok := evalFilterOperand(expr, current, index)
+	if !ok {
+		return false
+	}
+	switch v.kind {
+	case core.Bool:
+		return v.b
+	case core.Number:
+		return v.num != 0
+	case core.Null:
+		return false
+	}
+	return true
+}
+
+// evalFilterOperand evaluates expr to a value. The boolean result is false
+// when the operand is missing or cannot be computed (for example arithmetic
+// on non-numbers), which makes every comparison involving it a no-match.
+func evalFilterOperand(expr internalquery.Expression, current core.Node, index int) (filterValue, bool) {
+	switch e := expr.(type) {
+	case internalquery.ExpressionLiteral:
+		return literalFilterValue(e.Value), true
+	case internalquery.ExpressionCall:
+		switch e.Name {
+		case "position", "index":
+			return filterValue{kind: core.Number, num: float64(index)}, true
+		case "time", "datetime":
+			return evalFilterTime(e.Args[0], current, index)
+		}
+		return filterValue{kind: core.Bool, b: evalFilterCall(e, current)}, true
+	case internalquery.ExpressionPath:
+		node := resolveFilterPath(current, e)
+		if !node.IsValid() {
+			return filterValue{}, false
+		}
+		return nodeFilterValue(node)
+	case internalquery.ExpressionUnary:
+		switch e.Op {
+		case "!":
+			return filterValue{kind: core.Bool, b: !evalFilterPredicate(e.Operand, current, index)}, true
+		case "-":
+			v, ok := evalFilterOperand(e.Operand, current, index)
+			if !ok || v.kind != core.Number {
+				return filterValue{}, false
+			}
+			return filterValue{kind: core.Number, num: -v.num}, true
+		}
+	case internalquery.ExpressionBinary:
+		switch e.Op {
+		case "&&", "||":
+			return filterValue{kind: core.Bool, b: evalFilterPredicate(e, current, index)}, true
+		case "+", "-", "*", "/", "%":
+			return evalFilterArithmetic(e, current, index)
+		}
+		left, lok := evalFilterOperand(e.Left, current, index)
+		right, rok := evalFilterOperand(e.Right, current, index)
+		if !lok || !rok {
+			return filterValue{kind: core.Bool, b: false}, true
+		}
+		return filterValue{kind: core.Bool, b: compareFilterValues(e.Op, left, right)}, true
+	}
+	return filterValue{}, false
+}
+
+// evalFilterCall evaluates a built-in filter function. The type tests and
+// the set tests are false for a missing path, which only is_missing
+// accepts.
+func evalFilterCall(e internalquery.ExpressionCall, current core.Node) bool {
+	path, ok := e.Args[0].(internalquery.ExpressionPath)
+	if !ok {
+		return false
+	}
+	node := resolveFilterPath(current, path)
+	if e.Name == "is_missing" {
+		return !node.IsValid()
+	}
+	if !node.IsValid() {
+		return false
+	}
+	switch e.Name {
+	case "is_string":
+		return node.Type() == core.String
+	case "is_number":
+		return node.Type() == core.Number
+	case "is_bool":
+		return node.Type() == core.Bool
+	case "is_null":
+		return node.Type() == core.Null
+	case "is_array":
+		return node.Type() == core.Array
+	case "is_object":
+		return node.Type() == core.Object
+	case "contains_all", "contains_any":
+		return evalFilterContains(e.Name == "contains_all", node, e.Args[1:])
+	}
+	return false
+}
+
+// evalFilterContains reports whether the array node holds every literal,
+// for all, or at least one of them. Elements equal a literal as == compares
+// them, so 1 matches 1.0 but not "1". A value that is not an array holds
+// none; with no literals, contains_all holds and contains_any does not.
+func evalFilterContains(all bool, node core.Node, literals []internalquery.Expression) bool {
+	if node.Type() != core.Array {
+		return false
+	}
+	elems := node.UnsafeArray()
+	for _, arg := range literals {
+		want := literalFilterValue(arg.(internalquery.ExpressionLiteral).Value)
+		found := false
+		for _, elem := range elems {
+			if v, ok := nodeFilterValue(elem); ok && compareFilterValues("==", v, want) {
+				found = true
+				break
+			}
+		}
+		if found != all {
+			return found
+		}
+	}
+	return all
+}
+
+// isValueCall reports whether e computes a value, as position() and time()
+// do, rather than testing one.
+func isValueCall(e internalquery.ExpressionCall) bool {
+	switch e.Name {
+	case "position", "index", "time", "datetime":
+		return true
+	}
+	return false
+}
+
+// evalFilterTime evaluates the argument of time() to an instant. A missing
+// value, a non-string or a string that is no time is missing too, so
+// comparisons with it do not match.
+func evalFilterTime(arg internalquery.Expression, current core.Node, index int) (filterValue, bool) {
+	v, ok := evalFilterOperand(arg, current, index)
+	if !ok || v.kind != core.String {
+		return filterValue{}, false
+	}
+	t, ok := internalquery.ParseFilterTime(v.str)
+	if !ok {
+		return filterValue{}, false
+	}
+	return filterValue{kind: timeKind, t: t}, true
+}
+
+func evalFilterArithmetic(e internalquery.ExpressionBinary, current core.Node, index int) (filterValue, bool) {
+	left, lok := evalFilterOperand(e.Left, current, index)
+	right, rok := evalFilterOperand(e.Right, current, index)
+	if !lok || !rok || left.kind != core.Number || right.kind != core.Number {
+		return filterValue{}, false
+	}
+	var result float64
+	switch e.Op {
+	case "+":
+		result = left.num + right.num
+	case "-":
+		result = left.num - right.num
+	case "*":
+		result = left.num * right.num
+	case "/":
+		if right.num == 0 {
+			return filterValue{}, false
+		}
+		result = left.num / right.num
+	case "%":
+		if right.num == 0 {
+			return filterValue{}, false
+		}
+		result = math.Mod(left.num, right.num)
+	}
+	return filterValue{kind: core.Number, num: result}, true
+}
+
+// compareFilterValues applies a comparison operator. Operands of different
+// types never match, not even for "!=".
+func compareFilterValues(op string, left, right filterValue) bool {
+	if left.kind != right.kind {
+		return false
+	}
+	switch left.kind {
+	case core.Number:
+		return compareOrdered(op, left.num, right.num)
+	case core.String:
+		return compareOrdered(op, left.str, right.str)
+	case core.Bool:
+		switch op {
+		case "==":
+			return left.b == right.b
+		case "!=":
+			return left.b != right.b
+		}
+	case core.Null:
+		return op == "=="
+	case timeKind:
+		return compareOrdered(op, left.t.Compare(right.t), 0)
+	}
+	return false
+}
+
+func compareOrdered[T int | float64 | string](op string, left, right T) bool {
+	switch op {
+	case "==":
+		return left == right
+	case "!=":
+		return left != right
+	case "<":
+		return left < right
+	case "<=":
+		return left <= right
+	case ">":
+		return left > right
+	case ">=":
+		return left >= right
+	}
+	return false
+}
+
+func literalFilterValue(value interface{}) filterValue {
+	switch v := value.(type) {
+	case float64:
+		return filterValue{kind: core.Number, num: v}
+	case string:
+		return filterValue{kind: core.String, str: v}
+	case bool:
+		return filterValue{kind: core.Bool, b: v}
+	}
+	return filterValue{kind: core.Null}
+}
+
+func nodeFilterValue(node core.Node) (filterValue, bool) {
+	switch node.Type() {
+	case core.Number:
+		f, ok := node.RawFloat()
+		if !ok {
+			return filterValue{}, false
+		}
+		return filterValue{kind: core.Number, num: f, node: node}, true
+	case core.String:
+		s, ok := node.RawString()
+		if !ok {
+			return filterValue{}, false
+		}
+		return filterValue{kind: core.String, str: s, node: node}, true
+	case core.Bool:
+		return filterValue{kind: core.Bool, b: node.Bool(), node: node}, true
+	case core.Null:
+		return filterValue{kind: core.Null, node: node}, true
+	case core.Object, core.Array:
+		return filterValue{kind: node.Type(), node: node}, true
+	}
+	return filterValue{}, false
+}
+
+// resolveFilterPath walks the key/index segments of an @-path starting at
+// the current element, or of a $-path starting at the root of its document.
+func resolveFilterPath(current core.Node, path internalquery.ExpressionPath) core.Node {
+	cur := current
+	if path.Root {
+		for parent := cur.Parent(); parent != nil && parent != cur; parent = cur.Parent() {
+			cur = parent
+		}
+	}
+	for _, seg := range path.Segments {
+		if !cur.IsValid() {
+			return cur
+		}
+		switch seg.Type {
+		case internalquery.OpKey:
+			if cur.Type() != core.Object {
+				return sharedInvalidNode()
+			}
+			cur = cur.Get(seg.Value.(string))
+		case internalquery.OpIndex:
+			switch cur.Type() {
+			case core.Object:
+				cur = cur.Get(strconv.Itoa(seg.Value.(int)))
+			case core.Array:
+				cur = cur.Index(seg.Value.(int))
+			default:
+				return sharedInvalidNode()
+			}
+		default:
+			return sharedInvalidNode()
+		}
+	}
+	return cur
+}
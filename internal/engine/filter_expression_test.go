@@ -0,0 +1,460 @@
+package engine
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestFilterPathVersusPathComparison(t *testing.T) {
+	data := []byte(`{
+		"orders": [
+			{"id": "a", "shipped_qty": 1, "ordered_qty": 3, "from": "x", "to": "y", "paid": true, "due": true},
+			{"id": "b", "shipped_qty": 3, "ordered_qty": 3, "from": "m", "to": "m", "paid": false, "due": true},
+			{"id": "c", "shipped_qty": 5, "ordered_qty": 2, "from": "z", "to": "b", "paid": true, "due": false},
+			{"id": "d", "shipped_qty": "4", "ordered_qty": 9},
+			{"id": "e", "ordered_qty": 7}
+		]
+	}`)
+
+	testCases := []struct {
+		name string
+		path string
+		want []string
+	}{
+		{name: "numbers less", path: `/orders[?(@.shipped_qty < @.ordered_qty)]/id`, want: []string{"a"}},
+		{name: "numbers equal", path: `/orders[?(@.shipped_qty == @.ordered_qty)]/id`, want: []string{"b"}},
+		{name: "numbers greater or equal", path: `/orders[?(@.shipped_qty >= @.ordered_qty)]/id`, want: []string{"b", "c"}},
+		{name: "strings equal", path: `/orders[?(@.from == @.to)]/id`, want: []string{"b"}},
+		{name: "strings ordered", path: `/orders[?(@.from < @.to)]/id`, want: []string{"a"}},
+		{name: "bools equal", path: `/orders[?(@.paid == @.due)]/id`, want: []string{"a"}},
+		{name: "bools not equal", path: `/orders[?(@.paid != @.due)]/id`, want: []string{"b", "c"}},
+		{name: "arithmetic", path: `/orders[?(@.ordered_qty - @.shipped_qty > 0)]/id`, want: []string{"a"}},
+		{name: "arithmetic both sides", path: `/orders[?(@.shipped_qty * 2 >= @.ordered_qty + 1)]/id`, want: []string{"b", "c"}},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			root, err := Parse(data)
+			if err != nil {
+				t.Fatalf("Parse failed: %v", err)
+			}
+			result := root.Query(tc.path)
+			if !result.IsValid() {
+				t.Fatalf("query %q failed: %v", tc.path, result.Error())
+			}
+			if got := result.Strings(); !reflect.DeepEqual(got, tc.want) {
+				t.Fatalf("query %q = %v, want %v", tc.path, got, tc.want)
+			}
+		})
+	}
+}
+
+func TestFilterMismatchedAndMissingFieldsNeverMatch(t *testing.T) {
+	root, err := Parse([]byte(`{"items":[
+		{"id":1,"a":"4","b":9},
+		{"id":2,"b":7},
+		{"id":3,"a":null,"b":null},
+		{"id":4,"a":true,"b":1}
+	]}`))
+	if err != nil {
+		t.Fatalf("Parse failed: %v", err)
+	}
+
+	for _, path := range []string{
+		`/items[?(@.a < @.b)]`,
+		`/items[?(@.a != @.b && @.id < 3)]`,
+		`/items[?(@.a - @.b < 0)]`,
+		`/items[?(@.missing == @.missing)]`,
+	} {
+		result := root.Query(path)
+		if !result.IsValid() {
+			t.Fatalf("query %q failed: %v", path, result.Error())
+		}
+		if result.Len() != 0 {
+			t.Fatalf("query %q expected no matches, got %s", path, result.String())
+		}
+	}
+
+	if got := root.Query(`/items[?(@.a == @.b)]/id`).Strings(); !reflect.DeepEqual(got, []string{"3"}) {
+		t.Fatalf("expected null == null to match id 3, got %v", got)
+	}
+}
+
+func TestFilterLiteralsLogicAndExistence(t *testing.T) {
+	root, err := MustParse([]byte(`{"books":[
+		{"title":"A","price":8.5,"tags":["x"],"meta":{"stock":2}},
+		{"title":"B","price":25,"meta":{"stock":0}},
+		{"title":"C","price":12,"tags":[],"meta":{"stock":5}}
+	],"nums":[1,5,2,7]}`))
+	if err != nil {
+		t.Fatalf("MustParse failed: %v", err)
+	}
+
+	testCases := []struct {
+		path string
+		want []string
+	}{
+		{`/books[?(@.price < 10 || @.title == 'B')]/title`, []string{"A", "B"}},
+		{`/books[?(@.tags)]/title`, []string{"A", "C"}},
+		{`/books[?(!@.tags)]/title`, []string{"B"}},
+		{`/books[?(@.meta.stock > 1 && !(@.price > 10))]/title`, []string{"A"}},
+		{`/books[?(@['title'] == "C")]/title`, []string{"C"}},
+		{`/books[?(@.tags[0] == 'x')]/title`, []string{"A"}},
+		{`/books[?(@.price > -1e3)]/title`, []string{"A", "B", "C"}},
+		{`/nums[?(@ > 2)]`, []string{"5", "7"}},
+		{`/nums[?(@ % 2 == 1)]`, []string{"1", "5", "7"}},
+	}
+	for _, tc := range testCases {
+		result := root.Query(tc.path)
+		if !result.IsValid() {
+			t.Fatalf("query %q failed: %v", tc.path, result.Error())
+		}
+		if got := result.Strings(); !reflect.DeepEqual(got, tc.want) {
+			t.Fatalf("query %q = %v, want %v", tc.path, got, tc.want)
+		}
+	}
+
+	if got := root.Query(`/books[0][?(@.price < 10)]/title`).Strings(); !reflect.DeepEqual(got, []string{"A"}) {
+		t.Fatalf("expected object filter to keep the object, got %v", got)
+	}
+	if got := root.Query(`/books[1][?(@.price < 10)]`); !got.IsValid() || got.Len() != 0 {
+		t.Fatalf("expected object filter to drop the object, got %s (%v)", got.String(), got.Error())
+	}
+	if got := root.Query(`/books[?(@.price / 0 > 1)]`); !got.IsValid() || got.Len() != 0 {
+		t.Fatalf("expected division by zero to never match, got %s", got.String())
+	}
+}
+
+func TestFilterSyntaxErrors(t *testing.T) {
+	root, err := Parse([]byte(`{"a":[1,2]}`))
+	if err != nil {
+		t.Fatalf("Parse failed: %v", err)
+	}
+	for _, path := range []string{
+		`/a[?@ > 1]`,
+		`/a[?(@ > 1]`,
+		`/a[?(@ > 1)`,
+		`/a[?(@ > )]`,
+		`/a[?(@ > bogus)]`,
+		`/a[?(@.)]`,
+		`/a[?(@[x] == 1)]`,
+	} {
+		if got := root.Query(path); got.IsValid() {
+			t.Fatalf("expected syntax error for %q", path)
+		}
+	}
+}
+
+func TestFilterStringLiteralsAreUnescaped(t *testing.T) {
+	root, err := Parse([]byte(`{"notes":[
+		{"id":1,"text":"say \"hi\"\nbye"},
+		{"id":2,"text":"it's\ttabbed"},
+		{"id":3,"text":"say \\\"hi\\\"\\nbye"}
+	],"odd keys":{"a\"b\nc":"found"}}`))
+	if err != nil {
+		t.Fatalf("Parse failed: %v", err)
+	}
+
+	testCases := []struct {
+		path string
+		want []string
+	}{
+		{`/notes[?(@.text == "say \"hi\"\nbye")]/id`, []string{"1"}},
+		{`/notes[?(@.text == 'say "hi"\nbye')]/id`, []string{"1"}},
+		{`/notes[?(@.text == 'it\'s\ttabbed')]/id`, []string{"2"}},
+		{`/notes[?(@.text == "it\u0027s\u0009tabbed")]/id`, []string{"2"}},
+		{`/notes[?(@.text == 'say \\"hi\\"\\nbye')]/id`, []string{"3"}},
+		{`/notes[?(@['text'] == "say \"hi\"\nbye")]/id`, []string{"1"}},
+	}
+	for _, tc := range testCases {
+		result := root.Query(tc.path)
+		if !result.IsValid() {
+			t.Fatalf("query %q failed: %v", tc.path, result.Error())
+		}
+		if got := result.Strings(); !reflect.DeepEqual(got, tc.want) {
+			t.Fatalf("query %q = %v, want %v", tc.path, got, tc.want)
+		}
+	}
+
+	for _, path := range []string{`/['odd keys']['a"b\nc']`, `/["odd keys"]["a\"b\nc"]`} {
+		if got := root.Query(path).String(); got != "found" {
+			t.Fatalf("query %q = %q, want found", path, got)
+		}
+	}
+	node := root.Query(`/['odd keys']["a\"b\nc"]`)
+	if got := root.Query(node.Path()).String(); got != "found" {
+		t.Fatalf("path %q does not round-trip, got %q", node.Path(), got)
+	}
+}
+
+func TestFilterTypeTests(t *testing.T) {
+	root, err := Parse([]byte(`{"items":[
+		{"id":"s","v":"12.5"},
+		{"id":"n","v":12.5},
+		{"id":"b","v":true},
+		{"id":"z","v":null},
+		{"id":"a","v":[1]},
+		{"id":"o","v":{"x":1}},
+		{"id":"m"}
+	]}`))
+	if err != nil {
+		t.Fatalf("Parse failed: %v", err)
+	}
+
+	testCases := []struct {
+		path string
+		want []string
+	}{
+		{`/items[?(is_string(@.v))]/id`, []string{"s"}},
+		{`/items[?(is_number(@.v))]/id`, []string{"n"}},
+		{`/items[?(is_bool(@.v))]/id`, []string{"b"}},
+		{`/items[?(is_null(@.v))]/id`, []string{"z"}},
+		{`/items[?(is_array(@.v))]/id`, []string{"a"}},
+		{`/items[?(is_object(@.v))]/id`, []string{"o"}},
+		{`/items[?(is_missing(@.v))]/id`, []string{"m"}},
+		{`/items[?(is_missing(@.v.x))]/id`, []string{"s", "n", "b", "z", "a", "m"}},
+		{`/items[?(is_number(@.v.x))]/id`, []string{"o"}},
+		{`/items[?(is_number(@.v[0]))]/id`, []string{"a"}},
+		{`/items[?(is_string(@.v) || is_number(@.v))]/id`, []string{"s", "n"}},
+		{`/items[?(!is_missing(@.v) && !is_null(@.v) && !is_string(@.v))]/id`, []string{"n", "b", "a", "o"}},
+		{`/items[?(is_string(@.id) == true && is_bool(@.v) != false)]/id`, []string{"b"}},
+		{`/items[?(is_object(@))]/id`, []string{"s", "n", "b", "z", "a", "o", "m"}},
+	}
+	for _, tc := range testCases {
+		result := root.Query(tc.path)
+		if !result.IsValid() {
+			t.Fatalf("query %q failed: %v", tc.path, result.Error())
+		}
+		if got := result.Strings(); !reflect.DeepEqual(got, tc.want) {
+			t.Fatalf("query %q = %v, want %v", tc.path, got, tc.want)
+		}
+	}
+
+	if got := root.Query(`/items[?(is_string(@))]`); !got.IsValid() || got.Len() != 0 {
+		t.Fatalf("expected no element to be a string, got %s (%v)", got.String(), got.Error())
+	}
+	if got := root.Query(`/items[?(is_string(@.v))]{id,v}`).String(); got != `{"id":"s","v":"12.5"}` {
+		t.Fatalf("expected the offending element to be picked, got %s", got)
+	}
+	if !root.Has(`/items[?(is_object(@.v))]`) || root.Has(`/items[?(is_array(@.id))]`) {
+		t.Fatal("expected Has to agree with the type tests")
+	}
+}
+
+func TestFilterRootPaths(t *testing.T) {
+	data := []byte(`{
+		"limits": {"price": 10, "tags": ["go"]},
+		"store": {"book": [
+			{"t": "a", "price": 8, "tag": "go"},
+			{"t": "b", "price": 12, "tag": "go"},
+			{"t": "c", "price": 10, "tag": "rust"}
+		]}
+	}`)
+	testCases := []struct {
+		name string
+		path string
+		want []string
+	}{
+		{name: "compare with root value", path: `/store/book[?(@.price < $.limits.price)]/t`, want: []string{"a"}},
+		{name: "quoted keys and indices", path: `/store/book[?(@.tag == $['limits'].tags[0])]/t`, want: []string{"a", "b"}},
+		{name: "combined with &&", path: `/store/book[?(@.price <= $.limits.price && @.tag != $.limits.tags[0])]/t`, want: []string{"c"}},
+		{name: "function predicate", path: `/store/book[?(is_number($.limits.price) && @.price > 9)]/t`, want: []string{"b", "c"}},
+		{name: "arithmetic", path: `/store/book[?(@.price * 2 > $.limits.price + 5)]/t`, want: []string{"a", "b", "c"}},
+		{name: "missing root path", path: `/store/book[?(@.price < $.limits.nope)]/t`, want: []string{}},
+		{name: "negated missing root path", path: `/store/book[?(!($.nope == 1))]/t`, want: []string{"a", "b", "c"}},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			root, err := Parse(data)
+			if err != nil {
+				t.Fatalf("Parse failed: %v", err)
+			}
+			if got := root.Query(tc.path).Strings(); !reflect.DeepEqual(got, tc.want) {
+				t.Fatalf("query %q = %v, want %v", tc.path, got, tc.want)
+			}
+		})
+	}
+
+	root, err := Parse(data)
+	if err != nil {
+		t.Fatalf("Parse failed: %v", err)
+	}
+	// $ is the document root even when querying below it.
+	if got := root.Get("store").Query(`book[?(@.price < $.limits.price)]/t`).Strings(); !reflect.DeepEqual(got, []string{"a"}) {
+		t.Errorf("subtree query = %v, want [a]", got)
+	}
+	if got := root.QueryParams(`/store/book[?(@.price <= $.limits.price && @.tag == ?)]/t`, "rust").Strings(); !reflect.DeepEqual(got, []string{"c"}) {
+		t.Errorf("QueryParams = %v, want [c]", got)
+	}
+	if got := root.QueryNamed(`/store/book[?(@.price > $.limits.price - :d)]/t`, map[string]interface{}{"d": 3}).Strings(); !reflect.DeepEqual(got, []string{"a", "b", "c"}) {
+		t.Errorf("QueryNamed = %v, want [a b c]", got)
+	}
+}
+
+func TestFilterPosition(t *testing.T) {
+	root, err := Parse([]byte(`{
+		"items": [
+			{"id": "a", "active": false},
+			{"id": "b", "active": true},
+			{"id": "c", "active": true},
+			{"id": "d", "active": false},
+			{"id": "e", "active": true}
+		],
+		"empty": [],
+		"config": {"id": "cfg", "active": true}
+	}`))
+	if err != nil {
+		t.Fatalf("Parse failed: %v", err)
+	}
+
+	testCases := []struct {
+		path string
+		want []string
+	}{
+		{`/items[?(position() < 3 && @.active == true)]/id`, []string{"b", "c"}},
+		{`/items[?(@.active == true && index() >= 2)]/id`, []string{"c", "e"}},
+		{`/items[?(position() % 2 == 0)]/id`, []string{"a", "c", "e"}},
+		{`/items[?(index() % 100 == 0)]/id`, []string{"a"}},
+		{`/items[?(position() == 0)]/id`, []string{"a"}},
+		{`/items[?(position() == 4)]/id`, []string{"e"}},
+		{`/items[?(position() >= 5)]/id`, []string{}},
+		{`/items[?(position() < 0)]/id`, []string{}},
+		{`/items[?(position())]/id`, []string{"b", "c", "d", "e"}},
+		{`/items[?(!position())]/id`, []string{"a"}},
+		{`/items[?(position() + 1 == 2 || position() * 2 == 6)]/id`, []string{"b", "d"}},
+		{`/items[?(position() == '1')]/id`, []string{}},
+		{`/empty[?(position() == 0)]`, []string{}},
+		// An object is the only candidate, at position 0.
+		{`/config[?(position() == 0)]/id`, []string{"cfg"}},
+		{`/config[?(position() > 0)]/id`, []string{}},
+		// After a recursive step the position is the one in the match set.
+		{`//id[?(position() > 2)]`, []string{"d", "e", "cfg"}},
+		// A second filter numbers the matches of the first.
+		{`/items[?(@.active == true)][?(position() == 1)]/id`, []string{"c"}},
+		// Positions count every element, not just the earlier matches.
+		{`/items[?(@.active == true && position() > 0)][0:1]/id`, []string{"b"}},
+	}
+	for _, tc := range testCases {
+		result := root.Query(tc.path)
+		if !result.IsValid() {
+			t.Fatalf("query %q failed: %v", tc.path, result.Error())
+		}
+		if got := result.Strings(); !reflect.DeepEqual(got, tc.want) {
+			t.Errorf("query %q = %v, want %v", tc.path, got, tc.want)
+		}
+	}
+
+	if !root.Has(`/items[?(position() == 4)]`) || root.Has(`/items[?(position() == 5)]`) {
+		t.Error("expected Has to agree with position()")
+	}
+	if got := root.QueryFirst(`/items[?(position() > 1 && @.active == true)]/id`).String(); got != "c" {
+		t.Errorf("QueryFirst = %q, want c", got)
+	}
+}
+
+func TestFilterTimeComparison(t *testing.T) {
+	root, err := Parse([]byte(`{"events": [
+		{"id": "new-year-utc", "ts": "2024-01-01T00:00:00Z"},
+		{"id": "new-year-tokyo", "ts": "2024-01-01T09:00:00+09:00"},
+		{"id": "late-dec-ny", "ts": "2023-12-31T19:00:00-05:00"},
+		{"id": "mid-jan", "ts": "2024-01-15T12:30:00.123456789Z"},
+		{"id": "feb", "ts": "2024-02-01T00:00:00Z"},
+		{"id": "number", "ts": 1704067200},
+		{"id": "garbage", "ts": "yesterday"},
+		{"id": "missing"}
+	], "since": "2024-01-01T01:00:00+01:00"}`))
+	if err != nil {
+		t.Fatalf("Parse failed: %v", err)
+	}
+
+	testCases := []struct {
+		path string
+		want []string
+	}{
+		// Lexicographic comparison is only right for one offset: the New
+		// York spelling of midnight UTC sorts before it.
+		{`/events[?(@.ts >= '2024-01-01T00:00:00Z' && @.ts < '2024-02-01T00:00:00Z')]/id`,
+			[]string{"new-year-utc", "new-year-tokyo", "mid-jan"}},
+		{`/events[?(@.ts < '2024-01-01T00:00:00Z')]/id`, []string{"late-dec-ny"}},
+		// time() compares instants.
+		{`/events[?(time(@.ts) >= time('2024-01-01T00:00:00Z') && time(@.ts) < datetime('2024-02-01T00:00:00Z'))]/id`,
+			[]string{"new-year-utc", "new-year-tokyo", "late-dec-ny", "mid-jan"}},
+		{`/events[?(time(@.ts) == time('2024-01-01T00:00:00Z'))]/id`,
+			[]string{"new-year-utc", "new-year-tokyo", "late-dec-ny"}},
+		{`/events[?(time(@.ts) != time('2024-01-01T00:00:00Z'))]/id`, []string{"mid-jan", "feb"}},
+		{`/events[?(time(@.ts) > time('2024-01-15T12:30:00.123456788Z'))]/id`, []string{"mid-jan", "feb"}},
+		{`/events[?(time(@.ts) < time('2024-01-01'))]/id`, []string{}},
+		{`/events[?(time(@.ts) >= time('2024-02-01'))]/id`, []string{"feb"}},
+		{`/events[?(time(@.ts) >= time($.since))]/id`, []string{"new-year-utc", "new-year-tokyo", "late-dec-ny", "mid-jan", "feb"}},
+		// A value that is no time is missing: it matches no comparison.
+		{`/events[?(!(time(@.ts) < time('2100-01-01')))]/id`, []string{"number", "garbage", "missing"}},
+		{`/events[?(time(@.ts))]/id`, []string{"new-year-utc", "new-year-tokyo", "late-dec-ny", "mid-jan", "feb"}},
+		// Instants only compare with instants.
+		{`/events[?(time(@.ts) == @.ts)]/id`, []string{}},
+		{`/events[?(time(@.ts) > 0)]/id`, []string{}},
+	}
+	for _, tc := range testCases {
+		result := root.Query(tc.path)
+		if !result.IsValid() {
+			t.Fatalf("query %q failed: %v", tc.path, result.Error())
+		}
+		if got := result.Strings(); !reflect.DeepEqual(got, tc.want) {
+			t.Errorf("query %q = %v, want %v", tc.path, got, tc.want)
+		}
+	}
+}
+
+func TestFilterSetPredicates(t *testing.T) {
+	root, err := Parse([]byte(`{"items":[
+		{"id":"a","tags":["go","json","db"],"nums":[1,2.5,-3]},
+		{"id":"b","tags":["go"],"nums":["1",null]},
+		{"id":"c","tags":[],"nums":[1.0,true]},
+		{"id":"d","tags":"go"},
+		{"id":"e"}
+	]}`))
+	if err != nil {
+		t.Fatalf("Parse failed: %v", err)
+	}
+
+	testCases := []struct {
+		filter string
+		want   []string
+	}{
+		{`contains_all(@.tags, 'go', 'json')`, []string{"a"}},
+		{`contains_all(@.tags, "go")`, []string{"a", "b"}},
+		{`contains_any(@.tags, 'db', 'go')`, []string{"a", "b"}},
+		{`contains_any(@.tags, 'rust')`, nil},
+		{`contains_all(@.tags)`, []string{"a", "b", "c"}},
+		{`contains_any(@.tags)`, nil},
+		{`contains_all(@.nums, 1)`, []string{"a", "c"}},
+		{`contains_any(@.nums, '1')`, []string{"b"}},
+		{`contains_all(@.nums, 2.5, -3)`, []string{"a"}},
+		{`contains_any(@.nums, null, true)`, []string{"b", "c"}},
+		{`!contains_any(@.tags, 'go')`, []string{"c", "d", "e"}},
+		{`contains_any(@.tags, 'go') && !contains_all(@.tags, 'go', 'db')`, []string{"b"}},
+		{`contains_all(@.tags, 'db') || contains_any(@.nums, true)`, []string{"a", "c"}},
+		{`contains_all(@.tags, 'go') == true`, []string{"a", "b"}},
+		{`contains_all($.items[0].tags, 'db') && @.id == 'e'`, []string{"e"}},
+	}
+	for _, tc := range testCases {
+		path := "/items[?(" + tc.filter + ")]/id"
+		result := root.Query(path)
+		if !result.IsValid() {
+			t.Fatalf("query %q failed: %v", path, result.Error())
+		}
+		if got := result.Strings(); len(got) != len(tc.want) || len(got) > 0 && !reflect.DeepEqual(got, tc.want) {
+			t.Errorf("query %q = %v, want %v", path, got, tc.want)
+		}
+	}
+
+	for _, path := range []string{
+		`/items[?(contains_all())]`,
+		`/items[?(contains_all('go', @.tags))]`,
+		`/items[?(contains_any(@.tags, @.id))]`,
+		`/items[?(contains_any(@.tags, 'a' + 'b'))]`,
+	} {
+		if got := root.Query(path); got.IsValid() {
+			t.Errorf("expected syntax error for %q", path)
+		}
+	}
+}
@@ -0,0 +1,152 @@
+package engine
+
+import (
+	"bytes"
+	"strings"
+
+	"github.com/474420502/xjson/internal/core"
+)
+
+// FindValue returns the paths of the scalars at or below the node that
+// equal value, see FindValueN.
+func (n *baseNode) FindValue(value interface{}) []string {
+	return n.FindValueN(value, -1)
+}
+
+// FindValueN returns the paths, relative to the node, of the first limit
+// scalars that equal value, in document order; a negative limit returns
+// all of them. value is a string, bool, nil, a Go or json.Number number,
+// or a scalar Node. Strings compare after unescaping and numbers by value,
+// as Equal does, so 2 finds 2.0 too. The JSON text of the node is scanned
+// like Metrics does, without materializing it.
+func (n *baseNode) FindValueN(value interface{}, limit int) []string {
+	target, ok := value.(core.Node)
+	if !ok {
+		target = NewNodeFromInterface(nil, value, nil)
+	}
+	if n.err != nil || !target.IsValid() {
+		return []string{}
+	}
+	var match func(kind byte, raw []byte) bool
+	switch target.Type() {
+	case core.String:
+		s, _ := target.RawString()
+		match = func(kind byte, raw []byte) bool {
+			return kind == '"' && string(unescapedBody(raw)) == s
+		}
+	case core.Number:
+		s := target.Raw()
+		match = func(kind byte, raw []byte) bool {
+			return kind == '0' && numberTextEqual(string(raw), s)
+		}
+	case core.Bool:
+		kind := byte('f')
+		if target.Bool() {
+			kind = 't'
+		}
+		match = func(k byte, raw []byte) bool { return k == kind }
+	case core.Null:
+		match = func(kind byte, raw []byte) bool { return kind == 'n' }
+	default:
+		return []string{}
+	}
+	return findScalars(n.jsonText(), match, limit)
+}
+
+// FindStringContains returns the paths, relative to the node, of the
+// string values at or below it that contain substr once unescaped, in
+// document order.
+func (n *baseNode) FindStringContains(substr string) []string {
+	if n.err != nil {
+		return []string{}
+	}
+	return findScalars(n.jsonText(), func(kind byte, raw []byte) bool {
+		return kind == '"' && strings.Contains(string(unescapedBody(raw)), substr)
+	}, -1)
+}
+
+// unescapedBody returns the string body raw with its escapes decoded; a
+// malformed escape leaves it as written.
+func unescapedBody(raw []byte) []byte {
+	if bytes.IndexByte(raw, '\\') < 0 {
+		return raw
+	}
+	decoded, err := unescape(raw)
+	if err != nil {
+		return raw
+	}
+	return decoded
+}
+
+// findScalars returns the paths of the first limit scalars of the JSON
+// value in data that match accepts, or all of them for a negative limit.
+// match is called with '"' and the body of a string, with '0' and the text
+// of a number, and with 't', 'f' or 'n' for the literals. Like scanMetrics
+// it keeps one frame per open container.
+func findScalars(data []byte, match func(kind byte, raw []byte) bool, limit int) []string {
+	paths := []string{}
+	var stack []metricsFrame
+
+	// value records a value below the open containers, and its path when
+	// it is a scalar that matches; kind is 0 for a container.
+	value := func(kind byte, raw []byte) {
+		if len(stack) > 0 {
+			if top := &stack[len(stack)-1]; !top.object {
+				top.index = top.count
+				top.count++
+			}
+		}
+		if kind != 0 && match(kind, raw) {
+			paths = append(paths, metricsPath(stack))
+		}
+	}
+
+	for pos := 0; pos < len(data) && len(paths) != limit; {
+		switch c := data[pos]; c {
+		case '{', '[':
+			value(0, nil)
+			stack = append(stack, metricsFrame{object: c == '{', expectKey: c == '{'})
+			pos++
+		case '}', ']':
+			if len(stack) > 0 {
+				stack = stack[:len(stack)-1]
+			}
+			pos++
+		case ',':
+			if len(stack) > 0 && stack[len(stack)-1].object {
+				stack[len(stack)-1].expectKey = true
+			}
+			pos++
+		case '"':
+			end := findMatchingQuote(data, pos)
+			if end < 0 {
+				end = len(data) - 1
+			}
+			if len(stack) > 0 && stack[len(stack)-1].expectKey {
+				top := &stack[len(stack)-1]
+				top.key = data[pos+1 : end]
+				top.expectKey = false
+			} else {
+				value('"', data[pos+1:end])
+			}
+			pos = end + 1
+		case 't', 'f', 'n':
+			value(c, nil)
+			switch c {
+			case 't':
+				pos += len("true")
+			case 'f':
+				pos += len("false")
+			default:
+				pos += len("null")
+			}
+		case '-', '0', '1', '2', '3', '4', '5', '6', '7', '8', '9', 'I', 'N':
+			end := findValueEnd(data, pos) + 1
+			value('0', data[pos:end])
+			pos = end
+		default:
+			pos++
+		}
+	}
+	return paths
+}
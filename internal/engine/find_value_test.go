@@ -0,0 +1,109 @@
+package engine
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+
+	"github.com/474420502/xjson/internal/core"
+)
+
+func TestFindValue(t *testing.T) {
+	doc := `{"orders":[{"id":"ORD-12345","qty":2,"lines":[[2.0,"x"],{"ref":"ORD-12345"}]},{"id":"ORD-9","qty":20e-1,"paid":true}],` +
+		`"note":"see ORD-12345 and ORD-9","esc":"ORD-\u0031\u00323","a b":null,"ok":false,"n":-0.5}`
+	root, err := Parse([]byte(doc))
+	if err != nil {
+		t.Fatalf("Parse failed: %v", err)
+	}
+
+	cases := []struct {
+		value interface{}
+		want  []string
+	}{
+		{"ORD-12345", []string{"/orders[0]/id", "/orders[0]/lines[1]/ref"}},
+		{"ORD-123", []string{"/esc"}},
+		{2, []string{"/orders[0]/qty", "/orders[0]/lines[0][0]", "/orders[1]/qty"}},
+		{2.0, []string{"/orders[0]/qty", "/orders[0]/lines[0][0]", "/orders[1]/qty"}},
+		{json.Number("2e0"), []string{"/orders[0]/qty", "/orders[0]/lines[0][0]", "/orders[1]/qty"}},
+		{-0.5, []string{"/n"}},
+		{true, []string{"/orders[1]/paid"}},
+		{false, []string{"/ok"}},
+		{nil, []string{"/['a b']"}},
+		{NewStringNode(nil, "x", nil), []string{"/orders[0]/lines[0][1]"}},
+		{"2", []string{}},
+		{"missing", []string{}},
+		{[]interface{}{1}, []string{}},
+		{struct{}{}, []string{}},
+	}
+	for _, tc := range cases {
+		got := root.FindValue(tc.value)
+		if got == nil || !reflect.DeepEqual(got, tc.want) {
+			t.Errorf("FindValue(%v) = %#v, want %#v", tc.value, got, tc.want)
+		}
+		want, ok := tc.value.(core.Node)
+		if !ok {
+			want = NewNodeFromInterface(nil, tc.value, nil)
+		}
+		for _, path := range got {
+			if !Equal(root.Query(path), want) {
+				t.Errorf("FindValue(%v): %s resolves to %v", tc.value, path, root.Query(path))
+			}
+		}
+	}
+
+	if got, want := root.FindStringContains("ORD-9"), []string{"/orders[1]/id", "/note"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("FindStringContains = %#v, want %#v", got, want)
+	}
+	if got, want := root.FindStringContains("D-12"), []string{"/orders[0]/id", "/orders[0]/lines[1]/ref", "/note", "/esc"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("FindStringContains = %#v, want %#v", got, want)
+	}
+	if got := root.FindStringContains("absent"); got == nil || len(got) != 0 {
+		t.Errorf("expected an empty non-nil slice, got %#v", got)
+	}
+}
+
+func TestFindValueN(t *testing.T) {
+	root, err := Parse([]byte(`[1,[1,{"k":1}],1]`))
+	if err != nil {
+		t.Fatalf("Parse failed: %v", err)
+	}
+	for limit, want := range map[int][]string{
+		-1: {"[0]", "[1][0]", "[1][1]/k", "[2]"},
+		0:  {},
+		2:  {"[0]", "[1][0]"},
+		9:  {"[0]", "[1][0]", "[1][1]/k", "[2]"},
+	} {
+		if got := root.FindValueN(1, limit); !reflect.DeepEqual(got, want) {
+			t.Errorf("FindValueN(1, %d) = %#v, want %#v", limit, got, want)
+		}
+	}
+}
+
+func TestFindValueOnEditedSubtreesAndScalars(t *testing.T) {
+	root, err := Parse([]byte(`{"a":{"x":"v","y":[3]},"b":"v"}`))
+	if err != nil {
+		t.Fatalf("Parse failed: %v", err)
+	}
+	root.Query("/a/y").Append("v")
+	root.Query("/a").Set("z", "v")
+
+	if got, want := root.Get("a").FindValue("v"), []string{"/x", "/y[1]", "/z"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("subtree FindValue = %#v, want %#v", got, want)
+	}
+	for _, path := range root.FindValue("v") {
+		if got := root.Query(path).String(); got != "v" {
+			t.Errorf("%s resolves to %q", path, got)
+		}
+		root.SetByPath(path, "w")
+	}
+	if got := root.FindValue("v"); len(got) != 0 {
+		t.Errorf("expected every match to be replaced, got %#v", got)
+	}
+
+	if got, want := root.Get("b").FindValue("w"), []string{""}; !reflect.DeepEqual(got, want) {
+		t.Errorf("scalar FindValue = %#v, want %#v", got, want)
+	}
+	if got := root.Get("missing").FindValue("w"); got == nil || len(got) != 0 {
+		t.Errorf("invalid node FindValue = %#v, want empty", got)
+	}
+}
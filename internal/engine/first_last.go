@@ -0,0 +1,87 @@
+package engine
+
+import (
+	"fmt"
+
+	"github.com/474420502/xjson/internal/core"
+)
+
+// First returns the first match of a match set or slice. Any other node is a
+// single match and returns itself.
+func (n *baseNode) First() core.Node {
+	return pickMatch(n.selfOrMe(), "First", 0)
+}
+
+// Last returns the last match of a match set or slice. Any other node is a
+// single match and returns itself.
+func (n *baseNode) Last() core.Node {
+	return pickMatch(n.selfOrMe(), "Last", -1)
+}
+
+// FirstElement returns the first element of an array, a match set standing
+// for its single match.
+func (n *baseNode) FirstElement() core.Node {
+	return pickElement(n.selfOrMe(), "FirstElement", 0)
+}
+
+// LastElement returns the last element of an array, a match set standing
+// for its single match.
+func (n *baseNode) LastElement() core.Node {
+	return pickElement(n.selfOrMe(), "LastElement", -1)
+}
+
+// matchList returns the matches of a wildcard, recursive, filter or slice
+// result. It reports false for any other node, which is a single match.
+func matchList(node core.Node) ([]core.Node, bool) {
+	arr, ok := node.(*arrayNode)
+	if !ok || !(arr.matchSet || arr.selection) {
+		return nil, false
+	}
+	return arr.value, true
+}
+
+// pickMatch returns match i of node, counting from the end when i is
+// negative.
+func pickMatch(node core.Node, op string, i int) core.Node {
+	if !node.IsValid() {
+		return node
+	}
+	matches, ok := matchList(node)
+	if !ok {
+		return node
+	}
+	if len(matches) == 0 {
+		return newInvalidNode(&core.PathError{Op: op, Err: core.ErrNoMatches})
+	}
+	if i < 0 {
+		i += len(matches)
+	}
+	return matches[i]
+}
+
+// pickElement returns element i of the array node is or stands for,
+// counting from the end when i is negative. No match, an empty array and
+// anything but an array fail with ErrNoMatches, ErrIndexOutOfBounds and
+// ErrTypeAssertion.
+func pickElement(node core.Node, op string, i int) core.Node {
+	if !node.IsValid() {
+		return node
+	}
+	if matches, ok := matchList(node); ok {
+		switch len(matches) {
+		case 0:
+			return newInvalidNode(&core.PathError{Op: op, Err: core.ErrNoMatches})
+		case 1:
+			node = matches[0]
+		default:
+			return newInvalidNode(&core.PathError{Op: op, Err: fmt.Errorf("%w: %d matches are not one array", core.ErrTypeAssertion, len(matches))})
+		}
+	}
+	if node.Type() != core.Array {
+		return newInvalidNode(&core.PathError{Path: node.Path(), Op: op, Err: fmt.Errorf("%w: %s is not an array", core.ErrTypeAssertion, node.Type())})
+	}
+	if node.Len() == 0 {
+		return newInvalidNode(&core.PathError{Path: node.Path(), Op: op, Err: fmt.Errorf("%w: empty array", core.ErrIndexOutOfBounds)})
+	}
+	return node.Index(i)
+}
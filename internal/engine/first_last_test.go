@@ -0,0 +1,135 @@
+package engine
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/474420502/xjson/internal/core"
+)
+
+// TestFirstLastSemantics documents First/Last, which pick among matches,
+// against FirstElement/LastElement, which look into an array.
+func TestFirstLastSemantics(t *testing.T) {
+	root, err := Parse([]byte(`{"tags":["a","b","c"],"empty":[],"name":"x","items":[{"v":1},{"v":2}]}`))
+	if err != nil {
+		t.Fatalf("Parse failed: %v", err)
+	}
+	// want is the Raw text of the result, the error it must wrap, or, with
+	// same, the queried result itself.
+	type want struct {
+		raw  string
+		err  error
+		same bool
+	}
+	testCases := []struct {
+		name                                   string
+		path                                   string
+		first, last, firstElement, lastElement want
+	}{
+		{
+			name:         "multi-match set",
+			path:         "/items[*]/v",
+			first:        want{raw: "1"},
+			last:         want{raw: "2"},
+			firstElement: want{err: core.ErrTypeAssertion},
+			lastElement:  want{err: core.ErrTypeAssertion},
+		},
+		{
+			name:         "single array match",
+			path:         "/tags",
+			first:        want{raw: `["a","b","c"]`},
+			last:         want{raw: `["a","b","c"]`},
+			firstElement: want{raw: "a"},
+			lastElement:  want{raw: "c"},
+		},
+		{
+			name:         "array as the one match of a set",
+			path:         "//tags",
+			first:        want{raw: `["a","b","c"]`},
+			last:         want{raw: `["a","b","c"]`},
+			firstElement: want{raw: "a"},
+			lastElement:  want{raw: "c"},
+		},
+		{
+			name:         "single scalar match",
+			path:         "/name",
+			first:        want{raw: "x"},
+			last:         want{raw: "x"},
+			firstElement: want{err: core.ErrTypeAssertion},
+			lastElement:  want{err: core.ErrTypeAssertion},
+		},
+		{
+			name:         "slice",
+			path:         "/tags[1:]",
+			first:        want{raw: "b"},
+			last:         want{raw: "c"},
+			firstElement: want{err: core.ErrTypeAssertion},
+			lastElement:  want{err: core.ErrTypeAssertion},
+		},
+		{
+			name:         "empty array",
+			path:         "/empty",
+			first:        want{raw: `[]`},
+			last:         want{raw: `[]`},
+			firstElement: want{err: core.ErrIndexOutOfBounds},
+			lastElement:  want{err: core.ErrIndexOutOfBounds},
+		},
+		{
+			name:         "no match",
+			path:         "/items[?(@.v > 5)]",
+			first:        want{err: core.ErrNoMatches},
+			last:         want{err: core.ErrNoMatches},
+			firstElement: want{err: core.ErrNoMatches},
+			lastElement:  want{err: core.ErrNoMatches},
+		},
+		{
+			name:         "missing path",
+			path:         "/missing",
+			first:        want{same: true},
+			last:         want{same: true},
+			firstElement: want{same: true},
+			lastElement:  want{same: true},
+		},
+	}
+	check := func(t *testing.T, method string, result, got core.Node, w want) {
+		t.Helper()
+		if w.same {
+			if got != result {
+				t.Errorf("%s = %s (%v), want the result itself", method, got.Raw(), got.Error())
+			}
+			return
+		}
+		if w.err != nil {
+			if got.IsValid() || !errors.Is(got.Error(), w.err) {
+				t.Errorf("%s = %s (%v), want an error wrapping %v", method, got.Raw(), got.Error(), w.err)
+			}
+			return
+		}
+		if !got.IsValid() || got.Raw() != w.raw {
+			t.Errorf("%s = %s (%v), want %s", method, got.Raw(), got.Error(), w.raw)
+		}
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			result := root.Query(tc.path)
+			check(t, "First", result, result.First(), tc.first)
+			check(t, "Last", result, result.Last(), tc.last)
+			check(t, "FirstElement", result, result.FirstElement(), tc.firstElement)
+			check(t, "LastElement", result, result.LastElement(), tc.lastElement)
+		})
+	}
+}
+
+func TestFirstElementIsTheDocumentNode(t *testing.T) {
+	root, err := Parse([]byte(`{"items":[{"v":1},{"v":2}]}`))
+	if err != nil {
+		t.Fatalf("Parse failed: %v", err)
+	}
+	root.Query("/items").LastElement().Set("v", 3)
+	if got := root.Query("/items[1]/v").Int(); got != 3 {
+		t.Fatalf("write through LastElement = %d, want 3", got)
+	}
+	if got := root.Query("/items[*]").First(); got != root.Get("items").Index(0) {
+		t.Fatalf("First should return the matched node itself")
+	}
+}
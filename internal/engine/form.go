@@ -0,0 +1,115 @@
+package engine
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"strconv"
+
+	"github.com/474420502/xjson/internal/core"
+)
+
+// ToURLValues encodes an object, or the only match that is one, as form
+// values for a form-encoded request body or query string. Members are
+// visited in document order, so repeated keys keep the order of the array
+// elements.
+func (n *baseNode) ToURLValues(opts core.FormOptions) (url.Values, error) {
+	self := n.selfOrMe()
+	if !self.IsValid() {
+		return nil, self.Error()
+	}
+	if matches, ok := matchList(self); ok {
+		switch len(matches) {
+		case 0:
+			return nil, &core.PathError{Op: "ToURLValues", Err: core.ErrNoMatches}
+		case 1:
+			return matches[0].ToURLValues(opts)
+		}
+		return nil, &core.PathError{Op: "ToURLValues", Err: fmt.Errorf("%w: %d matches where one object is needed; use First() to encode the first", core.ErrTypeAssertion, len(matches))}
+	}
+	obj, ok := self.(*objectNode)
+	if !ok {
+		return nil, typeError(self, "object", nil)
+	}
+	values := url.Values{}
+	if err := appendFormMembers(values, "", obj, opts); err != nil {
+		return nil, err
+	}
+	return values, nil
+}
+
+// appendFormMembers adds the members of obj to values, named below prefix
+// unless it is empty.
+func appendFormMembers(values url.Values, prefix string, obj *objectNode, opts core.FormOptions) error {
+	keys := obj.documentKeys()
+	if err := obj.Error(); err != nil {
+		return err
+	}
+	for _, key := range keys {
+		name := key
+		switch {
+		case prefix == "":
+		case opts.Nesting == core.BracketKeys:
+			name = prefix + "[" + key + "]"
+		default:
+			name = prefix + "." + key
+		}
+		if err := appendFormValue(values, name, obj.value[key], opts); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// appendFormValue adds node to values under name.
+func appendFormValue(values url.Values, name string, node core.Node, opts core.FormOptions) error {
+	if err := node.Error(); err != nil {
+		return err
+	}
+	switch node.Type() {
+	case core.Object:
+		if opts.Nesting == core.ErrorOnNested {
+			return typeError(node, "form value", errors.New("nested objects are rejected by ErrorOnNested"))
+		}
+		return appendFormMembers(values, name, node.(*objectNode), opts)
+	case core.Array:
+		elems := node.UnsafeArray()
+		if err := node.Error(); err != nil {
+			return err
+		}
+		for i, elem := range elems {
+			if err := elem.Error(); err != nil {
+				return err
+			}
+			if t := elem.Type(); t == core.Object || t == core.Array {
+				return typeError(elem, "form value", nil)
+			}
+			key := name
+			if opts.IndexArrays {
+				key = name + "[" + strconv.Itoa(i) + "]"
+			}
+			appendFormScalar(values, key, elem, opts)
+		}
+		return nil
+	}
+	appendFormScalar(values, name, node, opts)
+	return nil
+}
+
+// appendFormScalar adds the text of a string, number, bool or null to
+// values under name.
+func appendFormScalar(values url.Values, name string, node core.Node, opts core.FormOptions) {
+	switch node.Type() {
+	case core.String:
+		s, _ := node.RawString()
+		values.Add(name, s)
+	case core.Number:
+		values.Add(name, canonicalNumber(node.Raw()))
+	case core.Bool:
+		values.Add(name, strconv.FormatBool(node.Bool()))
+	case core.Null:
+		if !opts.SkipNulls {
+			values.Add(name, "")
+		}
+	}
+}
@@ -0,0 +1,209 @@
+package engine
+
+import (
+	"errors"
+	"net/url"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/474420502/xjson/internal/core"
+)
+
+func TestToURLValues(t *testing.T) {
+	cases := []struct {
+		name string
+		doc  string
+		opts core.FormOptions
+		want url.Values
+		err  string
+	}{
+		{
+			name: "scalars",
+			doc:  `{"s":"a b&c=d","i":42,"f":1.50,"e":1e2,"neg":-0,"t":true,"no":false}`,
+			want: url.Values{"s": {"a b&c=d"}, "i": {"42"}, "f": {"1.5"}, "e": {"100"}, "neg": {"0"}, "t": {"true"}, "no": {"false"}},
+		},
+		{
+			name: "escaped strings",
+			doc:  `{"q":"say \"hi\"\n","u":"é😀"}`,
+			want: url.Values{"q": {"say \"hi\"\n"}, "u": {"é😀"}},
+		},
+		{
+			name: "unicode keys",
+			doc:  `{"näme":"x","キー":"y","a&b":"z"}`,
+			want: url.Values{"näme": {"x"}, "キー": {"y"}, "a&b": {"z"}},
+		},
+		{
+			name: "null as empty",
+			doc:  `{"a":null,"b":[1,null,2]}`,
+			want: url.Values{"a": {""}, "b": {"1", "", "2"}},
+		},
+		{
+			name: "null skipped",
+			doc:  `{"a":null,"b":[1,null,2]}`,
+			opts: core.FormOptions{SkipNulls: true},
+			want: url.Values{"b": {"1", "2"}},
+		},
+		{
+			name: "repeated keys",
+			doc:  `{"tag":["x","y","x"],"n":[3,1]}`,
+			want: url.Values{"tag": {"x", "y", "x"}, "n": {"3", "1"}},
+		},
+		{
+			name: "indexed keys",
+			doc:  `{"tag":["x","y"],"skip":[null,true]}`,
+			opts: core.FormOptions{IndexArrays: true, SkipNulls: true},
+			want: url.Values{"tag[0]": {"x"}, "tag[1]": {"y"}, "skip[1]": {"true"}},
+		},
+		{
+			name: "empty containers",
+			doc:  `{"a":[],"o":{},"k":"v"}`,
+			want: url.Values{"k": {"v"}},
+		},
+		{
+			name: "dotted nesting",
+			doc:  `{"user":{"name":"bob","addr":{"city":"x"},"tags":["a","b"]},"id":1}`,
+			want: url.Values{"user.name": {"bob"}, "user.addr.city": {"x"}, "user.tags": {"a", "b"}, "id": {"1"}},
+		},
+		{
+			name: "bracket nesting",
+			doc:  `{"user":{"name":"bob","addr":{"city":"x"},"tags":["a","b"]}}`,
+			opts: core.FormOptions{Nesting: core.BracketKeys, IndexArrays: true},
+			want: url.Values{"user[name]": {"bob"}, "user[addr][city]": {"x"}, "user[tags][0]": {"a"}, "user[tags][1]": {"b"}},
+		},
+		{
+			name: "strict nesting",
+			doc:  `{"id":1,"user":{"name":"bob"}}`,
+			opts: core.FormOptions{Nesting: core.ErrorOnNested},
+			err:  "cannot convert object at /user to form value",
+		},
+		{
+			name: "strict flat",
+			doc:  `{"id":1,"tags":["a"]}`,
+			opts: core.FormOptions{Nesting: core.ErrorOnNested},
+			want: url.Values{"id": {"1"}, "tags": {"a"}},
+		},
+		{
+			name: "array of objects",
+			doc:  `{"items":[{"id":1}]}`,
+			err:  "cannot convert object at /items[0] to form value",
+		},
+		{
+			name: "array of arrays",
+			doc:  `{"m":[[1,2]]}`,
+			opts: core.FormOptions{IndexArrays: true},
+			err:  "cannot convert array at /m[0] to form value",
+		},
+		{
+			name: "not an object",
+			doc:  `[1,2]`,
+			err:  "cannot convert array at / to object",
+		},
+	}
+	for _, tc := range cases {
+		for _, parse := range []func([]byte) (core.Node, error){Parse, MustParse} {
+			root, err := parse([]byte(tc.doc))
+			if err != nil {
+				t.Fatalf("%s: parse failed: %v", tc.name, err)
+			}
+			got, err := root.ToURLValues(tc.opts)
+			if tc.err != "" {
+				var typeErr *core.TypeError
+				if !errors.As(err, &typeErr) || !strings.Contains(err.Error(), tc.err) {
+					t.Errorf("%s: error %v, want %q", tc.name, err, tc.err)
+				}
+				continue
+			}
+			if err != nil || !reflect.DeepEqual(got, tc.want) {
+				t.Errorf("%s: ToURLValues = %v, %v, want %v", tc.name, got, err, tc.want)
+			}
+		}
+	}
+}
+
+func TestToURLValuesMatches(t *testing.T) {
+	root, err := Parse([]byte(`{"orders":[{"id":1,"state":"open"},{"id":2,"state":"paid"}]}`))
+	if err != nil {
+		t.Fatalf("Parse failed: %v", err)
+	}
+	got, err := root.Query("/orders[?(@.id == 2)]").ToURLValues(core.FormOptions{})
+	if err != nil || got.Get("state") != "paid" {
+		t.Errorf("single match = %v, %v", got, err)
+	}
+
+	_, err = root.Query("/orders[*]").ToURLValues(core.FormOptions{})
+	if !errors.Is(err, core.ErrTypeAssertion) || !strings.Contains(err.Error(), "First()") {
+		t.Errorf("several matches = %v, want an error suggesting First()", err)
+	}
+	if got, err := root.Query("/orders[*]").First().ToURLValues(core.FormOptions{}); err != nil || got.Get("id") != "1" {
+		t.Errorf("First = %v, %v", got, err)
+	}
+	if _, err := root.Query("/orders[?(@.id == 9)]").ToURLValues(core.FormOptions{}); !errors.Is(err, core.ErrNoMatches) {
+		t.Errorf("no match = %v, want ErrNoMatches", err)
+	}
+	if _, err := root.Query("/missing").ToURLValues(core.FormOptions{}); err == nil {
+		t.Error("ToURLValues of a missing value succeeded")
+	}
+}
+
+func TestToURLValuesSyntaxError(t *testing.T) {
+	root, err := Parse([]byte(`{"a":{"b":tru}}`))
+	if err != nil {
+		t.Fatalf("Parse failed: %v", err)
+	}
+	var syntaxErr *core.SyntaxError
+	if _, err := root.ToURLValues(core.FormOptions{}); !errors.As(err, &syntaxErr) {
+		t.Errorf("ToURLValues = %v, want a syntax error", err)
+	}
+}
+
+// The encoded body reads back to the same values, and a flat document
+// rebuilt from them encodes to the same body again.
+func TestToURLValuesRoundTrip(t *testing.T) {
+	docs := []struct {
+		doc  string
+		opts core.FormOptions
+		body string
+	}{
+		{`{"q":"a b","tag":["x","y"]}`, core.FormOptions{}, "q=a+b&tag=x&tag=y"},
+		{`{"名前":"山田","mail":"a+b@c.d"}`, core.FormOptions{}, "mail=a%2Bb%40c.d&%E5%90%8D%E5%89%8D=%E5%B1%B1%E7%94%B0"},
+		{`{"user":{"id":7,"tags":["a"]}}`, core.FormOptions{Nesting: core.BracketKeys, IndexArrays: true}, "user%5Bid%5D=7&user%5Btags%5D%5B0%5D=a"},
+		{`{"n":null,"f":0.1}`, core.FormOptions{}, "f=0.1&n="},
+	}
+	for _, tc := range docs {
+		root, err := Parse([]byte(tc.doc))
+		if err != nil {
+			t.Fatalf("Parse failed: %v", err)
+		}
+		values, err := root.ToURLValues(tc.opts)
+		if err != nil {
+			t.Fatalf("%s: ToURLValues failed: %v", tc.doc, err)
+		}
+		body := values.Encode()
+		if body != tc.body {
+			t.Errorf("%s: body %q, want %q", tc.doc, body, tc.body)
+		}
+		back, err := url.ParseQuery(body)
+		if err != nil || !reflect.DeepEqual(back, values) {
+			t.Errorf("%s: ParseQuery = %v, %v, want %v", tc.doc, back, err, values)
+		}
+	}
+
+	flat := NewObject()
+	values, _ := url.ParseQuery("name=%C3%A9t%C3%A9&tag=a&tag=b")
+	for key, vals := range values {
+		if len(vals) == 1 {
+			flat.Set(key, vals[0])
+			continue
+		}
+		elems := make([]interface{}, len(vals))
+		for i, v := range vals {
+			elems[i] = v
+		}
+		flat.Set(key, elems)
+	}
+	again, err := flat.ToURLValues(core.FormOptions{})
+	if err != nil || again.Encode() != values.Encode() {
+		t.Errorf("rebuilt document encodes to %v, %v, want %v", again, err, values)
+	}
+}
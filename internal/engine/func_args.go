@@ -0,0 +1,125 @@
+package engine
+
+import (
+	"fmt"
+
+	"github.com/474420502/xjson/internal/core"
+)
+
+// argsFuncKey is the registry key of a function registered with
+// RegisterFuncArgs. The registry only holds UnaryPathFuncs, so such a
+// function is kept as an adapter under a key no path can call directly.
+func argsFuncKey(name string) string {
+	return name + "(...)"
+}
+
+// argsCall is the node CallFunc passes to the adapter of a function
+// registered with RegisterFuncArgs: the node it is called on and the
+// arguments of the call.
+type argsCall struct {
+	core.Node
+	args []core.Arg
+}
+
+func (n *baseNode) RegisterFuncArgs(name string, fn core.ArgsPathFunc) core.Node {
+	if n.err != nil {
+		return n.selfOrMe()
+	}
+	scope := n.funcScope(true)
+	delete(scope, name)
+	scope[argsFuncKey(name)] = func(node core.Node) core.Node {
+		if call, ok := node.(*argsCall); ok {
+			return fn(call.Node, call.args...)
+		}
+		return fn(node)
+	}
+	return n.selfOrMe()
+}
+
+// builtinArgsFuncs are the path functions every node can call. A function
+// registered under the same name takes precedence.
+var builtinArgsFuncs = map[string]core.ArgsPathFunc{
+	"distinct": builtinDistinct,
+	"entries":  builtinEntries,
+	"keys":     builtinKeys,
+	"reverse":  builtinReverse,
+	"sortBy":   builtinSortBy,
+	"topk":     builtinTopK,
+	"values":   builtinValues,
+}
+
+// builtinDistinct implements [@distinct]: the elements of an array or match
+// set without duplicates, see Unique.
+func builtinDistinct(node core.Node, args ...core.Arg) core.Node {
+	if _, err := funcElems("distinct", node, args, 0); err != nil {
+		return newInvalidNode(err)
+	}
+	return node.Unique()
+}
+
+// builtinReverse implements [@reverse]: the elements of an array or match
+// set in reverse order.
+func builtinReverse(node core.Node, args ...core.Arg) core.Node {
+	elems, err := funcElems("reverse", node, args, 0)
+	if err != nil {
+		return newInvalidNode(err)
+	}
+	out := make([]core.Node, len(elems))
+	for i, elem := range elems {
+		out[len(elems)-1-i] = elem
+	}
+	return newMatchSet(node, out, node.GetFuncs())
+}
+
+// builtinSortBy implements [@sortBy(path)] and [@sortBy(path, desc)]: the
+// elements of an array or match set sorted by the value at path, see
+// sortByPath.
+func builtinSortBy(node core.Node, args ...core.Arg) core.Node {
+	elems, err := funcElems("sortBy", node, args, 1, core.String, core.Bool)
+	if err != nil {
+		return newInvalidNode(err)
+	}
+	desc := len(args) > 1 && args[1].Bool()
+	return newMatchSet(node, sortByPath(elems, args[0].String(), desc), node.GetFuncs())
+}
+
+// builtinTopK implements [@topk(path, k)]: the k elements of an array or
+// match set with the largest values at path, largest first.
+func builtinTopK(node core.Node, args ...core.Arg) core.Node {
+	elems, err := funcElems("topk", node, args, 2, core.String, core.Number)
+	if err != nil {
+		return newInvalidNode(err)
+	}
+	k := args[1].Int()
+	if k < 0 {
+		return newInvalidNode(fmt.Errorf("function 'topk' needs a count of at least 0, got %d", k))
+	}
+	sorted := sortByPath(elems, args[0].String(), true)
+	if k < len(sorted) {
+		sorted = sorted[:k]
+	}
+	return newMatchSet(node, sorted, node.GetFuncs())
+}
+
+// funcElems checks the arguments of a call to the built-in function name,
+// whose parameters have the types params and of which the first required
+// ones must be given, and returns the elements of the array or match set
+// node.
+func funcElems(name string, node core.Node, args []core.Arg, required int, params ...core.NodeType) ([]core.Node, error) {
+	if len(args) < required || len(args) > len(params) {
+		want := fmt.Sprint(len(params))
+		if required < len(params) {
+			want = fmt.Sprintf("%d to %d", required, len(params))
+		}
+		return nil, fmt.Errorf("function '%s' takes %s arguments, got %d", name, want, len(args))
+	}
+	for i, arg := range args {
+		if arg.Type != params[i] {
+			return nil, fmt.Errorf("argument %d of function '%s' must be a %s, got %s", i+1, name, params[i], arg.Type)
+		}
+	}
+	if node.Type() != core.Array {
+		return nil, fmt.Errorf("function '%s' needs an array, got %s", name, node.Type())
+	}
+	return node.Array(), nil
+}
@@ -0,0 +1,118 @@
+package engine
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/474420502/xjson/internal/core"
+)
+
+const funcArgsDoc = `{"books":[{"title":"A","price":25},{"title":"B","price":8},{"title":"C","price":15},{"title":"D"},{"title":"E","price":8}]}`
+
+func TestRegisterFuncArgs(t *testing.T) {
+	root, err := Parse([]byte(funcArgsDoc))
+	if err != nil {
+		t.Fatalf("Parse failed: %v", err)
+	}
+	root.RegisterFuncArgs("below", func(n core.Node, args ...core.Arg) core.Node {
+		if len(args) != 1 || args[0].Type != core.Number {
+			return newInvalidNode(nil)
+		}
+		limit := args[0].Float()
+		return n.Filter(func(book core.Node) bool {
+			price := book.Get("price")
+			return price.IsValid() && price.Float() < limit
+		})
+	})
+	root.RegisterFunc("cheap", func(n core.Node) core.Node {
+		return n.Filter(func(book core.Node) bool { return book.Get("price").Float() < 10 })
+	})
+
+	if got := root.Query("/books[@below(20)]/title").Strings(); !reflect.DeepEqual(got, []string{"B", "C", "E"}) {
+		t.Errorf("[@below(20)] = %q", got)
+	}
+	if got := root.Query("/books[@below(10)]/title").Strings(); !reflect.DeepEqual(got, []string{"B", "E"}) {
+		t.Errorf("[@below(10)] = %q", got)
+	}
+	if got := root.Query("/books[@cheap]/title").Strings(); !reflect.DeepEqual(got, []string{"B", "D", "E"}) {
+		t.Errorf("[@cheap] = %q", got)
+	}
+	if got := root.Query("/books[@cheap()]/title").Strings(); !reflect.DeepEqual(got, []string{"B", "D", "E"}) {
+		t.Errorf("[@cheap()] = %q", got)
+	}
+	if got := root.Get("books").CallFunc("below", core.Arg{Type: core.Number, Value: 9.0}).Len(); got != 2 {
+		t.Errorf("CallFunc with an argument matched %d books", got)
+	}
+
+	errorCases := map[string]string{
+		"/books[@cheap(1)]":          "function 'cheap' takes no arguments, got 1",
+		"/books[@missing(1)]":        "function 'missing' not found",
+		"/books[@json(1)]":           "function 'json' takes no arguments",
+		"/books[@topk('price')]":     "function 'topk' takes 2 arguments, got 1",
+		"/books[@topk(3, 'price')]":  "argument 1 of function 'topk' must be a string, got number",
+		"/books[@sortBy()]":          "function 'sortBy' takes 1 to 2 arguments, got 0",
+		"/books[@reverse(true)]":     "function 'reverse' takes 0 arguments, got 1",
+		"/books[0][@reverse]":        "function 'reverse' needs an array, got object",
+		"/books[@topk('price', -1)]": "needs a count of at least 0",
+	}
+	for path, want := range errorCases {
+		result := root.Query(path)
+		if result.IsValid() || !strings.Contains(result.Error().Error(), want) {
+			t.Errorf("%s: expected an invalid node with %q, got %v", path, want, result.Error())
+		}
+	}
+
+	// Registering a name either way replaces the other registration.
+	root.RegisterFunc("below", func(n core.Node) core.Node { return n })
+	if result := root.Query("/books[@below(20)]"); result.IsValid() {
+		t.Error("expected RegisterFunc to replace the function with arguments")
+	}
+	root.RegisterFuncArgs("cheap", func(n core.Node, args ...core.Arg) core.Node {
+		return NewNumberNode(nil, []byte("7"), nil)
+	})
+	if got := root.Query("/books[@cheap(1, 'x')]").Int(); got != 7 {
+		t.Errorf("expected the function with arguments, got %d", got)
+	}
+	root.RemoveFunc("cheap")
+	if root.Query("/books[@cheap]").IsValid() || root.Query("/books[@cheap(1)]").IsValid() {
+		t.Error("expected RemoveFunc to remove the function with arguments")
+	}
+}
+
+func TestBuiltinArgsFuncs(t *testing.T) {
+	root, err := Parse([]byte(funcArgsDoc))
+	if err != nil {
+		t.Fatalf("Parse failed: %v", err)
+	}
+	testCases := map[string][]string{
+		"/books[@reverse]/title":                   {"E", "D", "C", "B", "A"},
+		"/books[@reverse()]/title":                 {"E", "D", "C", "B", "A"},
+		"/books[@sortBy('price')]/title":           {"B", "E", "C", "A", "D"},
+		"/books[@sortBy('price', true)]/title":     {"A", "C", "B", "E", "D"},
+		"/books[@sortBy('title', true)]/title":     {"E", "D", "C", "B", "A"},
+		"/books[@topk('price', 2)]/title":          {"A", "C"},
+		"/books[@topk('price', 9)]/title":          {"A", "C", "B", "E", "D"},
+		"/books[*]/price[@sortBy('')]":             {"8", "8", "15", "25"},
+		"/books[@sortBy('price')][@reverse]/title": {"D", "A", "C", "E", "B"},
+	}
+	for path, want := range testCases {
+		if got := root.Query(path).Strings(); !reflect.DeepEqual(got, want) {
+			t.Errorf("%s = %q, want %q", path, got, want)
+		}
+	}
+	if got := root.Query("/books[@topk('price', 0)]"); !got.IsValid() || got.Len() != 0 {
+		t.Errorf("topk 0 = %v", got)
+	}
+
+	// The built-ins do not reorder the document.
+	if got := root.Query("/books[*]/title").Strings(); !reflect.DeepEqual(got, []string{"A", "B", "C", "D", "E"}) {
+		t.Errorf("document order changed: %q", got)
+	}
+
+	// A registered function shadows a built-in one.
+	root.RegisterFunc("reverse", func(n core.Node) core.Node { return n })
+	if got := root.Query("/books[@reverse]/title").Strings(); got[0] != "A" {
+		t.Errorf("expected the registered reverse, got %q", got)
+	}
+}
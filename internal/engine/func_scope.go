@@ -0,0 +1,69 @@
+package engine
+
+import "github.com/474420502/xjson/internal/core"
+
+// Registered functions live in scopes. A document root writes to the
+// registry its nodes share, funcs; any other node, match sets included,
+// writes to a registry of its own, localFuncs, which only it and the nodes
+// below it see. CallFunc looks a name up in the registry of the node, then
+// of its parent and so on up to the root, whose funcs come last, so the
+// nearest registration wins. A name found nowhere may be a builtin.
+
+// funcScope returns the registry RegisterFunc and RemoveFunc on n change,
+// making it first if create is set, or nil.
+func (n *baseNode) funcScope(create bool) map[string]core.UnaryPathFunc {
+	if !n.isDocumentScope() {
+		if n.localFuncs == nil && create {
+			n.localFuncs = make(map[string]core.UnaryPathFunc)
+		}
+		return n.localFuncs
+	}
+	if n.funcs == nil {
+		if !create {
+			return nil
+		}
+		funcs := make(map[string]core.UnaryPathFunc)
+		n.funcs = &funcs
+	}
+	return *n.funcs
+}
+
+// isDocumentScope reports whether n is a document root, whose functions
+// every node of the document sees. A match set or selection without a
+// parent is not one.
+func (n *baseNode) isDocumentScope() bool {
+	if n.parent != nil {
+		return false
+	}
+	arr, ok := n.selfOrMe().(*arrayNode)
+	return !ok || !(arr.matchSet || arr.selection)
+}
+
+// lookupFunc finds the function name resolves to on n and whether it was
+// registered with RegisterFuncArgs.
+func (n *baseNode) lookupFunc(name string) (fn core.UnaryPathFunc, withArgs, ok bool) {
+	argsKey := argsFuncKey(name)
+	scope := n
+	for {
+		if fn, ok := scope.localFuncs[argsKey]; ok {
+			return fn, true, true
+		}
+		if fn, ok := scope.localFuncs[name]; ok {
+			return fn, false, true
+		}
+		parent := nodeBase(scope.parent)
+		if parent == nil || parent == scope {
+			break
+		}
+		scope = parent
+	}
+	if scope.funcs != nil {
+		if fn, ok := (*scope.funcs)[argsKey]; ok {
+			return fn, true, true
+		}
+		if fn, ok := (*scope.funcs)[name]; ok {
+			return fn, false, true
+		}
+	}
+	return nil, false, false
+}
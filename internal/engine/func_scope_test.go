@@ -0,0 +1,125 @@
+package engine
+
+import (
+	"testing"
+
+	"github.com/474420502/xjson/internal/core"
+)
+
+const funcScopeDoc = `{"eu":{"items":[{"p":10},{"p":20}]},"us":{"items":[{"p":30}]}}`
+
+// constFunc returns a function that answers with the string s.
+func constFunc(s string) core.UnaryPathFunc {
+	return func(core.Node) core.Node { return NewNodeFromInterface(nil, s, nil) }
+}
+
+func TestFuncScopes(t *testing.T) {
+	for name, parse := range testParsers {
+		root, err := parse([]byte(funcScopeDoc))
+		if err != nil {
+			t.Fatalf("%s: parse failed: %v", name, err)
+		}
+		root.RegisterFunc("tag", constFunc("root"))
+		eu := root.Get("eu")
+		eu.RegisterFunc("tag", constFunc("eu"))
+
+		check := func(when string, want map[string]string) {
+			t.Helper()
+			for path, w := range want {
+				if got := root.Query(path).String(); got != w {
+					t.Errorf("%s: %s: Query(%s) = %s, want %s", name, when, path, got, w)
+				}
+			}
+		}
+		check("shadowed", map[string]string{
+			"[@tag]":             "root",
+			"/eu[@tag]":          "eu",
+			"/eu/items[0][@tag]": "eu",
+			"/us/items[0][@tag]": "root",
+		})
+		if got := eu.Query("items[1]").CallFunc("tag").String(); got != "eu" {
+			t.Errorf("%s: CallFunc below the subtree = %s, want eu", name, got)
+		}
+
+		// Removing on a node without its own registration changes nothing.
+		root.Get("us").RemoveFunc("tag")
+		root.Query("/eu/items").RemoveFunc("tag")
+		check("removed below", map[string]string{"/us[@tag]": "root", "/eu/items[0][@tag]": "eu"})
+
+		eu.RemoveFunc("tag")
+		check("removed on the subtree", map[string]string{"[@tag]": "root", "/eu/items[0][@tag]": "root"})
+
+		root.RemoveFunc("tag")
+		if root.Query("/eu[@tag]").IsValid() || root.CallFunc("tag").IsValid() {
+			t.Errorf("%s: tag should be gone everywhere", name)
+		}
+	}
+}
+
+func TestFuncScopeOfDerivedNodes(t *testing.T) {
+	root, err := Parse([]byte(funcScopeDoc))
+	if err != nil {
+		t.Fatalf("Parse failed: %v", err)
+	}
+	root.RegisterFunc("tag", constFunc("root"))
+
+	cheap := root.Query("/eu/items").Filter(func(n core.Node) bool { return n.Get("p").Int() < 15 })
+	cheap.RegisterFunc("only", constFunc("cheap"))
+	cheap.RegisterFunc("tag", constFunc("cheap"))
+	if got := cheap.CallFunc("only").String(); got != "cheap" {
+		t.Errorf("CallFunc on the filter result = %s, want cheap", got)
+	}
+	if got := cheap.CallFunc("tag").String(); got != "cheap" {
+		t.Errorf("the filter result should shadow tag, got %s", got)
+	}
+	for _, n := range []core.Node{root, root.Get("eu"), root.Query("/eu/items"), root.Query("/eu/items[0]")} {
+		if n.CallFunc("only").IsValid() {
+			t.Errorf("%s sees a function registered on a filter result", n.Path())
+		}
+		if got := n.CallFunc("tag").String(); got != "root" {
+			t.Errorf("%s: tag = %s, want root", n.Path(), got)
+		}
+	}
+	if _, ok := (*root.GetFuncs())["only"]; ok {
+		t.Error("the document registry holds a function of a filter result")
+	}
+
+	joined := JoinMatches(Matches(root.Query("//p")), root.GetFuncs())
+	joined.RegisterFunc("joined", constFunc("joined"))
+	if got := joined.CallFunc("tag").String(); got != "root" {
+		t.Errorf("a joined match set should see the functions of the document, tag = %s", got)
+	}
+	if root.CallFunc("joined").IsValid() {
+		t.Error("a function registered on a joined match set leaked into the document")
+	}
+}
+
+func TestFuncScopeWithArgs(t *testing.T) {
+	root, err := Parse([]byte(funcScopeDoc))
+	if err != nil {
+		t.Fatalf("Parse failed: %v", err)
+	}
+	root.RegisterFuncArgs("tag", func(n core.Node, args ...core.Arg) core.Node {
+		return NewNodeFromInterface(nil, "root args", nil)
+	})
+	us := root.Get("us")
+	us.RegisterFunc("tag", constFunc("us"))
+	if got := root.Query("/us/items[@tag]").String(); got != "us" {
+		t.Errorf("a unary function on a subtree should shadow the root's, got %s", got)
+	}
+	if root.Query("/us/items[@tag(1)]").IsValid() {
+		t.Error("the shadowing unary function takes no arguments")
+	}
+	if got := root.Query("/eu/items[@tag(1)]").String(); got != "root args" {
+		t.Errorf("outside the subtree tag(1) = %s, want root args", got)
+	}
+	us.RegisterFuncArgs("tag", func(n core.Node, args ...core.Arg) core.Node {
+		return NewNodeFromInterface(nil, "us args", nil)
+	})
+	if got := root.Query("/us[@tag('x')]").String(); got != "us args" {
+		t.Errorf("RegisterFuncArgs should replace the unary function of the same node, got %s", got)
+	}
+	if got := root.Query("[@tag]").String(); got != "root args" {
+		t.Errorf("the root's tag = %s, want root args", got)
+	}
+}
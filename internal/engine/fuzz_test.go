@@ -0,0 +1,301 @@
+package engine
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strconv"
+	"testing"
+	"unicode/utf8"
+
+	"github.com/474420502/xjson/internal/core"
+)
+
+// The fuzz targets below run as plain tests over their seeds; explore with
+//
+//	go test ./internal/engine -run '^$' -fuzz FuzzQuery -fuzztime 30s
+//
+// and likewise for FuzzParse and FuzzSet.
+
+// fuzzDocs returns the documents the fuzz targets are seeded with: the
+// adversarial scanner corpus, a small document and inputs that must fail.
+func fuzzDocs() []string {
+	docs := []string{
+		recoverDoc,
+		`{"a":[1,2.5,-0,1e3,"x",true,false,null,{},[]],"b":{"c":{"d":"e"}}}`,
+		`[[[[[]]]],{"":{"":[]}},"\u0000",12345678901234567890]`,
+		`"just a string"`, `-12.5e-3`, `null`, ` [ ] `,
+		`{"a":1,"a":2}`,
+		`{"a":`, `[1,2`, `{"a" 1}`, `{'a':1}`, `[1,]`, `"\x"`, `01`, "",
+	}
+	for _, doc := range adversarialDocs {
+		docs = append(docs, doc)
+	}
+	return docs
+}
+
+// decodeOracle decodes data with encoding/json, keeping numbers as written.
+// It reports false for input the oracle does not speak for: invalid JSON
+// and text that is not UTF-8, which encoding/json would rewrite.
+func decodeOracle(data []byte) (interface{}, bool) {
+	if !json.Valid(data) || !utf8.Valid(data) {
+		return nil, false
+	}
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+	var v interface{}
+	if err := dec.Decode(&v); err != nil {
+		return nil, false
+	}
+	return v, true
+}
+
+// oracleLookup follows a path of key and index steps through a decoded
+// value. It reports false, with ok, for a step that finds nothing, and
+// false, without ok, for a path using any other step, which it does not
+// model.
+func oracleLookup(v interface{}, path string) (value interface{}, found, ok bool) {
+	tokens, err := ParseQuery(path)
+	if err != nil {
+		return nil, false, false
+	}
+	for _, t := range tokens {
+		switch t.Op {
+		case OpKey:
+			obj, isObj := v.(map[string]interface{})
+			if _, isArr := v.([]interface{}); isArr {
+				// A key step projects over array elements.
+				return nil, false, false
+			}
+			if !isObj {
+				return nil, false, true
+			}
+			if v, found = obj[t.Value.(string)]; !found {
+				return nil, false, true
+			}
+		case OpIndex:
+			if obj, isObj := v.(map[string]interface{}); isObj {
+				// A numeric segment names a member of an object.
+				if v, found = obj[strconv.Itoa(t.Value.(int))]; !found {
+					return nil, false, true
+				}
+				continue
+			}
+			arr, isArr := v.([]interface{})
+			if !isArr {
+				return nil, false, true
+			}
+			i := t.Value.(int)
+			if i < 0 {
+				i += len(arr)
+			}
+			if i < 0 || i >= len(arr) {
+				return nil, false, true
+			}
+			v = arr[i]
+		default:
+			return nil, false, false
+		}
+	}
+	return v, true, true
+}
+
+// matchBag is describeResult regardless of the order of the matches.
+func matchBag(n core.Node) string {
+	if !n.IsValid() {
+		return "invalid"
+	}
+	var out []string
+	for _, m := range Matches(n) {
+		out = append(out, m.Canonical())
+	}
+	sort.Strings(out)
+	return fmt.Sprint(out)
+}
+
+func FuzzParse(f *testing.F) {
+	for _, doc := range fuzzDocs() {
+		f.Add([]byte(doc))
+	}
+	f.Fuzz(func(t *testing.T, data []byte) {
+		root, err := Parse(data)
+		full, fullErr := MustParse(data)
+		if err != nil || fullErr != nil {
+			return
+		}
+		out, err := root.Bytes()
+		if err != nil {
+			t.Fatalf("Bytes failed: %v", err)
+		}
+		reparsed, err := MustParse(out)
+		if err != nil {
+			t.Fatalf("output %q does not parse: %v", out, err)
+		}
+		// Bytes that are not UTF-8 are written as U+FFFD.
+		if utf8.Valid(data) && !Equal(reparsed, full) {
+			t.Fatalf("output %q reads back as %s, want %s", out, reparsed.Canonical(), full.Canonical())
+		}
+		if v, ok := decodeOracle(data); ok {
+			if got, want := full.Canonical(), NewNodeFromInterface(nil, v, nil).Canonical(); got != want {
+				t.Fatalf("full parse = %s, encoding/json gives %s", got, want)
+			}
+		}
+	})
+}
+
+func FuzzQuery(f *testing.F) {
+	paths := append([]string{"/items[0]/id", "/items[?(@.id > 1)]", "//id", "/items[-1:]", "/items[@distinct]", "[", "/a[?(@.", `/"`}, segmentQueries...)
+	for _, doc := range fuzzDocs() {
+		for _, path := range paths {
+			f.Add([]byte(doc), []byte(path))
+		}
+	}
+	f.Fuzz(func(t *testing.T, data, pathBytes []byte) {
+		path := string(pathBytes)
+		lazy, err := Parse(data)
+		if err != nil {
+			return
+		}
+		queryNoPanic(t, lazy, path)
+		full, err := MustParse(data)
+		if err != nil {
+			return
+		}
+		queryNoPanic(t, full, path)
+
+		want := describeResult(full.Query(path))
+		fresh, _ := Parse(data)
+		if got := describeResult(fresh.Query(path)); got != want {
+			t.Fatalf("lazy Query(%q) = %s, full parse gives %s", path, got, want)
+		}
+		if got := describeResult(lazy.Query(path)); got != want {
+			t.Fatalf("lazy Query(%q) after other queries = %s, full parse gives %s", path, got, want)
+		}
+		if untouched, _ := Parse(data); untouched.Has(path) != nodeExists(full.Query(path)) {
+			t.Fatalf("Has(%q) = %v, full parse gives %s", path, !nodeExists(full.Query(path)), want)
+		}
+		v, ok := decodeOracle(data)
+		if !ok {
+			return
+		}
+		// The decoded value has no key order, so its matches may come in
+		// another order.
+		built := NewNodeFromInterface(nil, v, nil)
+		if got, want := matchBag(built.Query(path)), matchBag(full.Query(path)); got != want {
+			t.Fatalf("Query(%q) on the decoded value = %s, full parse gives %s", path, got, want)
+		}
+		value, found, modeled := oracleLookup(v, path)
+		if !modeled {
+			return
+		}
+		result := full.Query(path)
+		if result.IsValid() != found {
+			t.Fatalf("Query(%q) valid = %v, encoding/json finds %v", path, result.IsValid(), found)
+		}
+		if found {
+			if got, want := result.Canonical(), NewNodeFromInterface(nil, value, nil).Canonical(); got != want {
+				t.Fatalf("Query(%q) = %s, encoding/json gives %s", path, got, want)
+			}
+		}
+	})
+}
+
+func FuzzSet(f *testing.F) {
+	for _, doc := range fuzzDocs() {
+		f.Add([]byte(doc), "/a", "x")
+		f.Add([]byte(doc), "/items/0/id", `"}]`)
+		f.Add([]byte(doc), "/new/deep", `\`)
+	}
+	f.Fuzz(func(t *testing.T, data []byte, path, value string) {
+		if !json.Valid(data) {
+			return
+		}
+		root, err := Parse(data)
+		if err != nil {
+			return
+		}
+		root.SetByPath(path, value)
+		if root.Type() == core.Object {
+			root.Set(path, value)
+		}
+		for _, child := range Matches(root.Query("/*")) {
+			switch child.Type() {
+			case core.Object:
+				child.Set(value, path)
+			case core.Array:
+				child.Append(value)
+			}
+		}
+		out, err := root.Bytes()
+		if err != nil {
+			t.Fatalf("Bytes failed: %v", err)
+		}
+		if !json.Valid(out) {
+			t.Fatalf("output is not JSON: %q", out)
+		}
+		reparsed, err := MustParse(out)
+		if err != nil {
+			t.Fatalf("output %q does not parse: %v", out, err)
+		}
+		// Bytes that are not UTF-8 are written as U+FFFD.
+		if utf8.Valid(data) && utf8.ValidString(path) && utf8.ValidString(value) && !Equal(reparsed, root) {
+			t.Fatalf("output %q reads back as %s, want %s", out, reparsed.Canonical(), root.Canonical())
+		}
+	})
+}
+
+// TestFuzzFindings keeps the inputs the fuzz targets found problems with.
+func TestFuzzFindings(t *testing.T) {
+	t.Run("space around a lazy root", func(t *testing.T) {
+		root, err := Parse([]byte(" [1] "))
+		if err != nil {
+			t.Fatalf("Parse failed: %v", err)
+		}
+		root.SetByPath("/0", 5)
+		if got := root.String(); got != " [5] " {
+			t.Errorf("String() = %q, want %q", got, " [5] ")
+		}
+		obj, _ := Parse([]byte(" {\"a\":1} "))
+		if obj.Len() != 1 || obj.Error() != nil {
+			t.Errorf("Len() = %d, %v, want 1", obj.Len(), obj.Error())
+		}
+	})
+	t.Run("absolute query on a root that fails to parse", func(t *testing.T) {
+		root, err := Parse([]byte(`{"a":`))
+		if err != nil {
+			t.Fatalf("Parse failed: %v", err)
+		}
+		if root.Query("/a").IsValid() || root.Query("/items[0]/id").IsValid() {
+			t.Error("queries on a broken document should fail")
+		}
+	})
+	t.Run("empty recursive step", func(t *testing.T) {
+		root, _ := MustParse([]byte(`{}`))
+		if _, err := CompileQuery("//"); err == nil {
+			t.Error(`CompileQuery("//") should fail`)
+		}
+		if root.Query("//").IsValid() {
+			t.Error(`Query("//") should fail`)
+		}
+	})
+	t.Run("unquoted key", func(t *testing.T) {
+		if _, err := MustParse([]byte(`{0":0}`)); err == nil {
+			t.Error("MustParse should reject a key without its opening quote")
+		}
+	})
+	t.Run("keys a parsed and a built document agree on", func(t *testing.T) {
+		doc := `{"web server":{"port":80},"user-id":7,"0":"zero"," a":"space","café":1}`
+		parsed, _ := Parse([]byte(doc))
+		v, _ := decodeOracle([]byte(doc))
+		built := NewNodeFromInterface(nil, v, nil)
+		for _, path := range []string{"/web server/port", "/user-id", "/0", " a", "/café", "/a b", " "} {
+			if got, want := describeResult(built.Query(path)), describeResult(parsed.Query(path)); got != want {
+				t.Errorf("Query(%q) on a built document = %s, parsed gives %s", path, got, want)
+			}
+		}
+		if got := parsed.Query("/web server/port").Int(); got != 80 {
+			t.Errorf("/web server/port = %d, want 80", got)
+		}
+	})
+}
@@ -0,0 +1,171 @@
+package engine
+
+import (
+	"bytes"
+	"fmt"
+
+	"github.com/474420502/xjson/internal/core"
+)
+
+// leniency lists the departures from RFC 8259 a document accepts, see
+// ParseOptions. The zero value is strict.
+type leniency struct {
+	trailingCommas bool
+	trailingData   bool
+	// nonFinite takes the literals Infinity, -Infinity and NaN for numbers.
+	// Only JSON5 documents parsed with AllowNonFinite hold them.
+	nonFinite bool
+}
+
+// documentLeniency returns the leniency of the document n belongs to. Like
+// trackPositions it is only stored on the root.
+func documentLeniency(n *baseNode) leniency {
+	return rootBase(n).leniency
+}
+
+// numberEnd returns the index past the number at data[start], read by the
+// grammar of RFC 8259: an optional minus, an integer part without leading
+// zeros, an optional fraction and an optional exponent, each with at least
+// one digit. When the grammar breaks it returns the index of the offending
+// byte, or len(data), and false.
+func numberEnd(data []byte, start int) (int, bool) {
+	i := start
+	if i < len(data) && data[i] == '-' {
+		i++
+	}
+	switch {
+	case i < len(data) && data[i] == '0':
+		i++
+	case i < len(data) && data[i] >= '1' && data[i] <= '9':
+		i = digitsEnd(data, i)
+	default:
+		return i, false
+	}
+	if i < len(data) && data[i] == '.' {
+		if i++; i >= len(data) || data[i] < '0' || data[i] > '9' {
+			return i, false
+		}
+		i = digitsEnd(data, i)
+	}
+	if i < len(data) && (data[i] == 'e' || data[i] == 'E') {
+		if i++; i < len(data) && (data[i] == '+' || data[i] == '-') {
+			i++
+		}
+		if i >= len(data) || data[i] < '0' || data[i] > '9' {
+			return i, false
+		}
+		i = digitsEnd(data, i)
+	}
+	return i, true
+}
+
+// nonFiniteEnd returns the index past the literal Infinity, -Infinity or
+// NaN at data[start], or -1 when there is none there.
+func nonFiniteEnd(data []byte, start int) int {
+	rest := data[start:]
+	for _, word := range [...]string{"Infinity", "-Infinity", "NaN"} {
+		if bytes.HasPrefix(rest, []byte(word)) {
+			return start + len(word)
+		}
+	}
+	return -1
+}
+
+// finiteText fails with an error wrapping core.ErrNumberOverflow when data,
+// the encoding of n, holds a non-finite number, which only a document parsed
+// with AllowNonFinite can: JSON has no text for it, and the serializers emit
+// nothing but JSON.
+func finiteText(n *baseNode, data []byte) error {
+	if !documentLeniency(n).nonFinite {
+		return nil
+	}
+	for i := 0; i < len(data); i++ {
+		switch data[i] {
+		case '"':
+			if i = findMatchingQuote(data, i); i < 0 {
+				return nil
+			}
+		case 'I', 'N':
+			if end := nonFiniteEnd(data, i); end > 0 {
+				return fmt.Errorf("%w: JSON has no text for %s", core.ErrNumberOverflow, data[i:end])
+			}
+		}
+	}
+	return nil
+}
+
+// nodeText returns the encoding of node like Bytes, keeping the non-finite
+// numbers of a document parsed with AllowNonFinite, for callers that read
+// the text rather than emit it. The text of an unmodified container is its
+// source and must not be changed. A match set is encoded as Bytes does it.
+func nodeText(node core.Node) ([]byte, error) {
+	switch typed := node.(type) {
+	case *objectNode:
+		return typed.text()
+	case *arrayNode:
+		typed.checkMatches()
+		if typed.matchSet && typed.err == nil {
+			switch len(typed.value) {
+			case 0:
+				return nil, core.ErrNoMatches
+			case 1:
+				return nodeText(typed.value[0])
+			}
+		}
+		return typed.text()
+	}
+	if err := node.Error(); err != nil {
+		return nil, err
+	}
+	var buf bytes.Buffer
+	writeJSONValue(&buf, node)
+	return buf.Bytes(), nil
+}
+
+func digitsEnd(data []byte, i int) int {
+	for i < len(data) && data[i] >= '0' && data[i] <= '9' {
+		i++
+	}
+	return i
+}
+
+// endsValue reports whether a number or literal ending at data[i] is
+// properly delimited: by whitespace, a comma, a closing bracket or the end
+// of the data.
+func endsValue(data []byte, i int) bool {
+	if i >= len(data) {
+		return true
+	}
+	switch data[i] {
+	case ' ', '\t', '\n', '\r', ',', ']', '}':
+		return true
+	}
+	return false
+}
+
+// wellFormedScalar reports whether segment, a string, number or literal
+// cut out by rawValueEnd, can be made a node without parsing it: a number
+// that follows the grammar, an exact literal, or a string without control
+// characters. Escapes are checked when a string is decoded.
+func wellFormedScalar(segment []byte) bool {
+	if len(segment) == 0 {
+		return false
+	}
+	switch segment[0] {
+	case '"':
+		for _, c := range segment {
+			if c < 0x20 {
+				return false
+			}
+		}
+		return len(segment) >= 2 && segment[len(segment)-1] == '"'
+	case 't':
+		return string(segment) == "true"
+	case 'f':
+		return string(segment) == "false"
+	case 'n':
+		return string(segment) == "null"
+	}
+	end, ok := numberEnd(segment, 0)
+	return ok && end == len(segment)
+}
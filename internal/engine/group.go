@@ -0,0 +1,79 @@
+package engine
+
+import (
+	"fmt"
+	"strconv"
+
+	"github.com/474420502/xjson/internal/core"
+)
+
+// GroupBy splits the elements of an array or match set by the value at path
+// in each element, a query relative to the element; an empty path groups by
+// the element itself. Keys are the text of the value: strings as they are,
+// numbers in canonical form so that 1 and 1.0 share a group, "true",
+// "false" and "null", and JSON text for objects and arrays. Elements where
+// path matches nothing are left out. Each group is a match set holding its
+// elements in document order.
+func (n *baseNode) GroupBy(path string) (core.Groups, error) {
+	if n.err != nil {
+		return nil, n.err
+	}
+	self := n.selfOrMe()
+	if self.Type() != core.Array {
+		return nil, &core.TypeError{Path: displayPath(self), Want: "array", Got: self.Type()}
+	}
+	if path != "" {
+		if _, err := ParseQuery(path); err != nil {
+			return nil, &core.PathError{Path: path, Op: "GroupBy", Err: err}
+		}
+	}
+
+	members := make(map[string][]core.Node)
+	for i, elem := range self.UnsafeArray() {
+		value := elem
+		if path != "" {
+			value = applySimpleQuery(elem, path)
+		}
+		if !value.IsValid() || isEmptyMatchSet(value) {
+			continue
+		}
+		if set, ok := value.(*arrayNode); ok && set.matchSet {
+			if len(set.value) > 1 {
+				return nil, &core.PathError{Path: path, Op: "GroupBy",
+					Err: fmt.Errorf("element %d: %d values match the key path", i, len(set.value))}
+			}
+			value = set.value[0]
+		}
+		key := groupKey(value)
+		members[key] = append(members[key], elem)
+	}
+
+	groups := make(core.Groups, len(members))
+	for key, elems := range members {
+		groups[key] = newMatchSet(self, elems, n.funcs)
+	}
+	return groups, nil
+}
+
+// groupKey returns the text GroupBy files value under.
+func groupKey(value core.Node) string {
+	switch value.Type() {
+	case core.String:
+		s, _ := value.RawString()
+		return s
+	case core.Number:
+		raw := value.Raw()
+		if i, err := strconv.ParseInt(raw, 10, 64); err == nil {
+			return strconv.FormatInt(i, 10)
+		}
+		if f, ok := value.RawFloat(); ok {
+			return string(appendJSONFloat(nil, f, 64))
+		}
+		return raw
+	case core.Bool:
+		return strconv.FormatBool(value.Bool())
+	case core.Null:
+		return "null"
+	}
+	return value.String()
+}
@@ -0,0 +1,144 @@
+package engine
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+
+	"github.com/474420502/xjson/internal/core"
+)
+
+const groupStoreDoc = `{"store":{"book":[
+	{"title":"A","category":"fiction","price":8,"available":true},
+	{"title":"B","category":"reference","price":22,"available":false},
+	{"title":"C","category":"fiction","price":12,"available":true},
+	{"title":"D","price":5},
+	{"title":"E","category":"fiction","price":"n/a","available":false}
+]}}`
+
+func groupTitles(t *testing.T, groups core.Groups, key string) []string {
+	t.Helper()
+	set, ok := groups[key]
+	if !ok {
+		t.Fatalf("missing group %q in %v", key, groups.Keys())
+	}
+	return set.Query("title").Strings()
+}
+
+func TestGroupByCategoryWithAggregates(t *testing.T) {
+	forEachParser(t, groupStoreDoc, func(t *testing.T, root core.Node) {
+		groups, err := root.Query("/store/book").GroupBy("category")
+		if err != nil {
+			t.Fatalf("GroupBy failed: %v", err)
+		}
+		if keys := groups.Keys(); !reflect.DeepEqual(keys, []string{"fiction", "reference"}) {
+			t.Fatalf("keys = %v", keys)
+		}
+		if got := groupTitles(t, groups, "fiction"); !reflect.DeepEqual(got, []string{"A", "C", "E"}) {
+			t.Fatalf("fiction titles = %v", got)
+		}
+		if got := groups.Count(); !reflect.DeepEqual(got, map[string]int{"fiction": 3, "reference": 1}) {
+			t.Fatalf("Count = %v", got)
+		}
+		// "n/a" is not a number and is skipped.
+		if got := groups.Avg("price"); !reflect.DeepEqual(got, map[string]float64{"fiction": 10, "reference": 22}) {
+			t.Fatalf("Avg = %v", got)
+		}
+		if got := groups.Sum("/price"); !reflect.DeepEqual(got, map[string]float64{"fiction": 20, "reference": 22}) {
+			t.Fatalf("Sum = %v", got)
+		}
+		if got := groups.Min("price"); got["fiction"] != 8 {
+			t.Fatalf("Min = %v", got)
+		}
+		if got := groups.Max("price"); got["fiction"] != 12 {
+			t.Fatalf("Max = %v", got)
+		}
+		if got := groups.Avg("missing"); len(got) != 0 {
+			t.Fatalf("Avg of a missing field = %v", got)
+		}
+	})
+}
+
+func TestGroupByBoolAndNumericKeys(t *testing.T) {
+	root, err := Parse([]byte(groupStoreDoc))
+	if err != nil {
+		t.Fatalf("parse failed: %v", err)
+	}
+	groups, err := root.Query("/store/book").GroupBy("available")
+	if err != nil {
+		t.Fatalf("GroupBy failed: %v", err)
+	}
+	if got := groupTitles(t, groups, "true"); !reflect.DeepEqual(got, []string{"A", "C"}) {
+		t.Fatalf("true titles = %v", got)
+	}
+	if got := groupTitles(t, groups, "false"); !reflect.DeepEqual(got, []string{"B", "E"}) {
+		t.Fatalf("false titles = %v", got)
+	}
+	if len(groups) != 2 {
+		t.Fatalf("book without the field should be left out, got keys %v", groups.Keys())
+	}
+
+	nums, err := Parse([]byte(`[{"n":1},{"n":1.0},{"n":1e0},{"n":2.50},{"n":-0.5},{"n":9007199254740993},{"n":"1"},{"n":null}]`))
+	if err != nil {
+		t.Fatalf("parse failed: %v", err)
+	}
+	groups, err = nums.GroupBy("n")
+	if err != nil {
+		t.Fatalf("GroupBy failed: %v", err)
+	}
+	want := map[string]int{"1": 4, "2.5": 1, "-0.5": 1, "9007199254740993": 1, "null": 1}
+	if got := groups.Count(); !reflect.DeepEqual(got, want) {
+		t.Fatalf("Count = %v, want %v", got, want)
+	}
+}
+
+func TestGroupByScalarsAndMatchSets(t *testing.T) {
+	root, err := Parse([]byte(`{"tags":["a","b","a"],` + groupStoreDoc[1:]))
+	if err != nil {
+		t.Fatalf("parse failed: %v", err)
+	}
+	groups, err := root.Query("/tags").GroupBy("")
+	if err != nil {
+		t.Fatalf("GroupBy failed: %v", err)
+	}
+	if got := groups.Count(); !reflect.DeepEqual(got, map[string]int{"a": 2, "b": 1}) {
+		t.Fatalf("Count = %v", got)
+	}
+
+	available, err := root.Query("/store/book[?(@.available == true)]").GroupBy("category")
+	if err != nil {
+		t.Fatalf("GroupBy on a match set failed: %v", err)
+	}
+	if got := available.Count(); !reflect.DeepEqual(got, map[string]int{"fiction": 2}) {
+		t.Fatalf("Count = %v", got)
+	}
+	// Groups are match sets, so writes go through to the document.
+	available["fiction"].Set("featured", true)
+	if n := root.Query("/store/book[?(@.featured == true)]").Len(); n != 2 {
+		t.Fatalf("expected 2 featured books, got %d", n)
+	}
+}
+
+func TestGroupByErrors(t *testing.T) {
+	root, err := Parse([]byte(`{"o":{"a":1},"arr":[{"x":[1,2]},{"x":[3]}],"objs":[{"k":{"a":1}},{"k":{"a":1}}]}`))
+	if err != nil {
+		t.Fatalf("parse failed: %v", err)
+	}
+	if _, err := root.Get("o").GroupBy("a"); !errors.Is(err, core.ErrTypeAssertion) {
+		t.Fatalf("expected ErrTypeAssertion on an object, got %v", err)
+	}
+	if _, err := root.Get("arr").GroupBy("[?("); err == nil {
+		t.Fatal("expected a path syntax error")
+	}
+	if _, err := root.Get("arr").GroupBy("x/*"); err == nil {
+		t.Fatal("expected an error for a key path matching several values")
+	}
+	if _, err := root.Get("missing").GroupBy("a"); err == nil {
+		t.Fatal("expected the error of an invalid node")
+	}
+
+	groups, err := root.Get("objs").GroupBy("k")
+	if err != nil || groups.Count()[`{"a":1}`] != 2 {
+		t.Fatalf("object keys: %v, %v", groups.Keys(), err)
+	}
+}
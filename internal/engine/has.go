@@ -0,0 +1,221 @@
+package engine
+
+import (
+	"strings"
+
+	"github.com/474420502/xjson/internal/core"
+	internalquery "github.com/474420502/xjson/internal/query"
+)
+
+// Has reports whether path matches at least one value, exactly as a valid,
+// non-empty Query(path) result would, null values included. On a document
+// that is still raw, a path of keys is answered from the bytes in one pass
+// without building a node; when the last step is a recursive descent, a
+// filter or a key lookup across an array, evaluation stops at the first
+// match instead of collecting every result.
+//
+// Under FirstWins and ErrorOnDuplicate, where a later duplicate cannot
+// change the answer, a key path stops reading at the last key, so a value
+// that is malformed past that point is only reported once it is accessed.
+func (n *baseNode) Has(path string) bool {
+	if n.err != nil {
+		return false
+	}
+	return hasQuery(queryStart(n.selfOrMe(), path), path)
+}
+
+// nodeExists reports whether a query result counts as a match, which is
+// what HasMatches tells: an empty match set or slice holds nothing.
+func nodeExists(node core.Node) bool {
+	return node != nil && node.HasMatches()
+}
+
+func hasQuery(start core.Node, path string) bool {
+	if enableQueryCache {
+		if bn, ok := start.(interface {
+			getCachedQueryResult(string) (core.Node, bool)
+		}); ok {
+			if cachedResult, exists := bn.getCachedQueryResult(path); exists {
+				return nodeExists(cachedResult)
+			}
+		}
+	}
+	if found, ok := hasRawKeyPath(start, path); ok {
+		return found
+	}
+	if res := tryFastBracketQuery(start, path); res != nil {
+		return nodeExists(res)
+	}
+	if res := tryFastSlashQuery(start, path); res != nil {
+		return nodeExists(res)
+	}
+
+	tokens, err := ParseQuery(path)
+	if err != nil {
+		return false
+	}
+	if len(tokens) == 0 {
+		return nodeExists(start)
+	}
+	last := len(tokens) - 1
+	cur := executeQueryTokens(start, tokens[:last])
+	if !cur.IsValid() {
+		return false
+	}
+
+	t := tokens[last]
+	switch t.Op {
+	case OpRecursive, OpAll:
+		m := recursiveMatch{all: true}
+		if t.Op == OpRecursive {
+			m = recursiveMatch{key: t.Value.(string)}
+		}
+		found := false
+		walkRecursive(cur, m, nil, func(core.Node) bool {
+			found = true
+			return false
+		})
+		return found
+	case OpFilter:
+		return filterExists(cur, t.Value.(internalquery.Expression))
+	case OpKey:
+		if a, ok := cur.(*arrayNode); ok {
+			key := t.Value.(string)
+			it := a.rawIter()
+			for it.Next() {
+				if elem := it.ParseValue(); elem.IsValid() && elem.Type() == core.Object && elem.Get(key).IsValid() {
+					return true
+				}
+			}
+			return false
+		}
+	}
+	return nodeExists(executeQueryTokens(cur, tokens[last:]))
+}
+
+// filterExists reports whether applyFilter(cur, expr, -1) would match
+// anything. After the first match the rest of the array is only scanned, so
+// a malformed tail still fails the check the way it fails the full filter.
+func filterExists(cur core.Node, expr internalquery.Expression) bool {
+	a, ok := cur.(*arrayNode)
+	if !ok {
+		return evalFilterPredicate(expr, cur, 0)
+	}
+	it := a.rawIter()
+	found := false
+	for i := 0; it.Next(); i++ {
+		if found {
+			continue
+		}
+		if elem := it.ParseValue(); elem.IsValid() && evalFilterPredicate(expr, elem, i) {
+			found = true
+		}
+	}
+	return found && it.Err() == nil
+}
+
+// hasRawKeyPath answers Has for a slash-separated path of keys on an object
+// that has not been parsed or written to, reading its raw text once instead
+// of building a node per step. It reports false, without ok, for any other
+// path or start, and for text the raw scan cannot follow.
+func hasRawKeyPath(start core.Node, path string) (found, ok bool) {
+	o, isObj := start.(*objectNode)
+	if !isObj || o.isDirty || o.parsed.Load() || len(o.raw) == 0 {
+		return false, false
+	}
+	if strings.ContainsAny(path, "[]*@.{()") || strings.Contains(path, "//") {
+		return false, false
+	}
+	keys := strings.Split(strings.Trim(path, "/"), "/")
+	for _, key := range keys {
+		if isBlank(key) {
+			return false, false
+		}
+	}
+	pos := skipSpace(o.raw, 0)
+	if pos >= len(o.raw) || o.raw[pos] != '{' {
+		return false, false
+	}
+	stopAtMatch := duplicateKeyPolicy(&o.baseNode) != LastWins
+	found, _, ok = hasRawKeys(o.raw, pos, keys, stopAtMatch)
+	return found, ok
+}
+
+// hasRawKeys reports whether keys lead to a member of the raw object at
+// raw[pos], and the offset of its closing brace. Under LastWins, where the
+// last of several members with a key counts, the whole object is read;
+// with stopAtMatch the first one counts and it returns there, without an
+// end.
+// The third result is false for text it cannot follow, and for a step into
+// an array, which it leaves to Query.
+func hasRawKeys(raw []byte, pos int, keys []string, stopAtMatch bool) (found bool, end int, ok bool) {
+	pos++
+	for {
+		pos = skipSpace(raw, pos)
+		if pos >= len(raw) {
+			return false, 0, false
+		}
+		if raw[pos] == '}' {
+			return found, pos, true
+		}
+		if raw[pos] != '"' {
+			return false, 0, false
+		}
+		keyEnd := findMatchingQuote(raw, pos)
+		if keyEnd == -1 {
+			return false, 0, false
+		}
+		match, _, err := matchObjectKey(keys[0], raw[pos+1:keyEnd])
+		if err != nil {
+			return false, 0, false
+		}
+		pos = skipSpace(raw, keyEnd+1)
+		if pos >= len(raw) || raw[pos] != ':' {
+			return false, 0, false
+		}
+		pos = skipSpace(raw, pos+1)
+		if pos >= len(raw) {
+			return false, 0, false
+		}
+
+		valEnd := -1
+		switch {
+		case !match:
+			valEnd = rawValueEnd(raw, pos)
+		case len(keys) == 1:
+			// The value is not read: null and malformed values exist too.
+			if found = true; stopAtMatch {
+				return true, 0, true
+			}
+			valEnd = rawValueEnd(raw, pos)
+		case raw[pos] == '{':
+			var inner bool
+			if inner, valEnd, ok = hasRawKeys(raw, pos, keys[1:], stopAtMatch); !ok {
+				return false, 0, false
+			}
+			if found = inner; stopAtMatch {
+				return found, 0, true
+			}
+		case raw[pos] == '[':
+			return false, 0, false
+		default:
+			if found = false; stopAtMatch {
+				return false, 0, true
+			}
+			valEnd = rawValueEnd(raw, pos)
+		}
+		if valEnd == -1 {
+			return false, 0, false
+		}
+
+		pos = skipSpace(raw, valEnd+1)
+		if pos < len(raw) && raw[pos] == ',' {
+			pos++
+			continue
+		}
+		if pos < len(raw) && raw[pos] == '}' {
+			return found, pos, true
+		}
+		return false, 0, false
+	}
+}
@@ -0,0 +1,305 @@
+package engine
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/474420502/xjson/internal/core"
+)
+
+const hasDoc = `{"store":{
+	"book":[
+		{"title":"A","price":8,"isbn":null,"tags":["x","y"]},
+		{"title":"B","price":12,"author":{"name":"Ann"}},
+		{"title":"C","price":30}
+	],
+	"bicycle":{"color":"red","price":19.95},
+	"empty":[],
+	"note":null
+}}`
+
+func TestHasMatchesQuery(t *testing.T) {
+	paths := []string{
+		"/store", "/store/note", "/store/missing", "/store/book[0]/isbn", "/store/book[5]",
+		"/store/book[-1]/title", "/store/book[1:]", "/store/book[3:]", "/store/empty[*]",
+		"/store/book/title", "/store/book/author", "/store/book/missing", "/store/*",
+		"/store/book[*]/tags[0]", "//isbn", "//name", "//nothing", "/store//price",
+		"/store/book[?(@.price > 10)]", "/store/book[?(@.price > 100)]", "/store/book[?(@.isbn)]",
+		"/store/book[?(@.price > 10)]/title", "/store/bicycle[?(@.color == 'red')]",
+		"/store/book[0]/..", "/..", "/store/book{title}", "/store[", "", "//*", "..*",
+		"/store/empty//*", "/store/note..*",
+		"/store/book[0:1]", "/store/book[5:9]", "/store/book[5:9]/title", "/store/empty[0:2]",
+		"/store/book[2:1]", "/store/book[-9:0]",
+	}
+	for name, parse := range testParsers {
+		for _, path := range paths {
+			// Use separate trees so neither call sees the other's cached result.
+			hasRoot, err := parse([]byte(hasDoc))
+			if err != nil {
+				t.Fatalf("%s parse failed: %v", name, err)
+			}
+			queryRoot, _ := parse([]byte(hasDoc))
+			want := queryRoot.Query(path).HasMatches()
+			if got := hasRoot.Has(path); got != want {
+				t.Fatalf("%s Has(%q) = %v, Query says %v", name, path, got, want)
+			}
+			if got := queryRoot.Has(path); got != want {
+				t.Fatalf("%s Has(%q) after Query = %v, want %v", name, path, got, want)
+			}
+		}
+	}
+
+	root, _ := Parse([]byte(hasDoc))
+	if !root.Get("store").Has("book[0]/isbn") {
+		t.Fatal("expected a relative path to match")
+	}
+	if root.Get("missing").Has("/store") {
+		t.Fatal("expected an invalid node to match nothing")
+	}
+}
+
+func TestHasFilterSeesMalformedTail(t *testing.T) {
+	data := []byte(`{"a":[{"v":1},{"v":2},,{"v":3}]}`)
+	root, err := Parse(data)
+	if err != nil {
+		t.Fatalf("Parse failed: %v", err)
+	}
+	if got := root.Query("/a[?(@.v == 1)]"); got.IsValid() {
+		t.Fatalf("expected the filter to report the malformed array, got %s", got.String())
+	}
+	fresh, _ := Parse(data)
+	if fresh.Has("/a[?(@.v == 1)]") {
+		t.Fatal("expected Has to agree with Query on a malformed array")
+	}
+}
+
+func TestHasStopsRecursiveSearchEarly(t *testing.T) {
+	var b strings.Builder
+	b.WriteString(`{"items":[`)
+	for i := 0; i < 2000; i++ {
+		if i > 0 {
+			b.WriteByte(',')
+		}
+		b.WriteString(`{"id":1,"meta":{"id":2}}`)
+	}
+	b.WriteString(`]}`)
+	root, err := Parse([]byte(b.String()))
+	if err != nil {
+		t.Fatalf("Parse failed: %v", err)
+	}
+	items := root.Get("items")
+
+	hasAllocs := testing.AllocsPerRun(5, func() { items.Has("//id") })
+	queryAllocs := testing.AllocsPerRun(5, func() {
+		ResetQueryCache(items)
+		items.Query("//id")
+	})
+	if hasAllocs*100 > queryAllocs {
+		t.Fatalf("expected Has to stop at the first hit, got %v allocs vs %v for Query", hasAllocs, queryAllocs)
+	}
+}
+
+func TestHasKeyPathOnRawText(t *testing.T) {
+	docs := []string{
+		hasDoc,
+		`{"a":{"b":{"c":null}},"a":{"b":{}}}`,
+		`{"a":{"b":{}},"a":{"b":{"c":null}}}`,
+		`{"a":{"b":1},"a":2}`,
+		`{"a":"x","b":[{"c":1}],"0":{"1":true},"q\"k":{"caf\u00e9":0}," a":{"b c":1}}`,
+		` { "a" : { "b" : [ ] , "c" : { } } } `,
+		`{"a":{"b":{"c":1}},"x":[1,,2]}`,
+	}
+	paths := []string{
+		"/a", "/a/b", "/a/b/c", "a/b/c/", "/a/b/c/d", "/a/c", "/b/c", "/0/1", "/0/2",
+		`/q"k/café`, "/ a/b c", "/a /b", "/store/book/title", "/store/bicycle/color",
+		"/store/note", "/store/note/x", "/a(b)", "/ ", "/",
+	}
+	for _, policy := range []DuplicateKeyPolicy{LastWins, FirstWins} {
+		for _, doc := range docs {
+			for _, path := range paths {
+				hasRoot, err := ParseWithOptions([]byte(doc), ParseOptions{DuplicateKeys: policy})
+				if err != nil {
+					t.Fatalf("Parse(%s) failed: %v", doc, err)
+				}
+				queryRoot, _ := ParseWithOptions([]byte(doc), ParseOptions{DuplicateKeys: policy})
+				want := nodeExists(queryRoot.Query(path))
+				if got := hasRoot.Has(path); got != want {
+					t.Errorf("policy %v: Has(%q) on %s = %v, Query says %v", policy, path, doc, got, want)
+				}
+			}
+		}
+	}
+}
+
+func TestHasKeyPathStopsAtTheLastKey(t *testing.T) {
+	// The value of b is cut short. Under LastWins the rest of the document
+	// must be read, which finds the damage; otherwise it is not read.
+	data := []byte(`{"a":{"b":{"c":[1,2}}}`)
+	lastWins, _ := Parse(data)
+	if lastWins.Has("/a/b") {
+		t.Error("Has under LastWins should see the malformed value like Query")
+	}
+	firstWins, err := ParseWithOptions(data, ParseOptions{DuplicateKeys: FirstWins})
+	if err != nil {
+		t.Fatalf("ParseWithOptions failed: %v", err)
+	}
+	if !firstWins.Has("/a/b") {
+		t.Error("Has under FirstWins should stop at the key b")
+	}
+	if firstWins.Query("/a/b/c").IsValid() {
+		t.Error("the malformed value should be reported once accessed")
+	}
+}
+
+func BenchmarkHasKeyPath(b *testing.B) {
+	var leaf strings.Builder
+	for i := 0; leaf.Len() < 4<<20; i++ {
+		fmt.Fprintf(&leaf, `"k%d":[1,2.5,{"z":"abc"}],`, i)
+	}
+	data := []byte(`{"a":{"b":{"c":{"d":{"e":{` + leaf.String() + `"last":0},"f":1}}}}}`)
+	for name, policy := range map[string]DuplicateKeyPolicy{"LastWins": LastWins, "FirstWins": FirstWins} {
+		b.Run("Has/"+name, func(b *testing.B) {
+			b.SetBytes(int64(len(data)))
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				root, _ := ParseWithOptions(data, ParseOptions{DuplicateKeys: policy})
+				if !root.Has("/a/b/c/d/e") {
+					b.Fatal("Has(/a/b/c/d/e) = false")
+				}
+			}
+		})
+		b.Run("Query/"+name, func(b *testing.B) {
+			b.SetBytes(int64(len(data)))
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				root, _ := ParseWithOptions(data, ParseOptions{DuplicateKeys: policy})
+				if !root.Query("/a/b/c/d/e").Exists() {
+					b.Fatal("Query(/a/b/c/d/e) does not exist")
+				}
+			}
+		})
+	}
+}
+
+const hasKeyDoc = `{"a":1,"n":null,"caf\u00e9":"escaped","q\"k":true,"":0,"obj":{"x":[1,2]},"arr":[10,null,{"k":1}],"s":"str"}`
+
+func TestHasKeyMatchesGet(t *testing.T) {
+	keys := []string{"a", "n", "café", "caf\\u00e9", `q"k`, `q\"k`, "", "obj", "x", "arr", "s", "missing", "A"}
+	for name, parse := range testParsers {
+		for _, key := range keys {
+			// Use separate trees so HasKey cannot rely on Get's cached child.
+			hasRoot, err := parse([]byte(hasKeyDoc))
+			if err != nil {
+				t.Fatalf("%s parse failed: %v", name, err)
+			}
+			getRoot, _ := parse([]byte(hasKeyDoc))
+			want := getRoot.Get(key).IsValid()
+			if got := hasRoot.HasKey(key); got != want {
+				t.Errorf("%s HasKey(%q) = %v, Get says %v", name, key, got, want)
+			}
+			if got := getRoot.HasKey(key); got != want {
+				t.Errorf("%s HasKey(%q) after Get = %v, want %v", name, key, got, want)
+			}
+		}
+	}
+
+	root, _ := Parse([]byte(hasKeyDoc))
+	for _, node := range []core.Node{root.Get("a"), root.Get("n"), root.Get("s"), root.Get("arr"), root.Get("missing")} {
+		if node.HasKey("a") || node.HasKey("") {
+			t.Errorf("HasKey on %v should be false", node.Type())
+		}
+	}
+	if !root.Get("arr").Index(2).HasKey("k") {
+		t.Error("expected HasKey on an array element")
+	}
+
+	root.Set("added", 1)
+	root.Delete("a")
+	if !root.HasKey("added") || root.HasKey("a") {
+		t.Error("HasKey does not see edits")
+	}
+}
+
+func TestHasKeyWithDuplicateKeys(t *testing.T) {
+	for _, policy := range []DuplicateKeyPolicy{LastWins, FirstWins} {
+		root, err := ParseWithOptions([]byte(`{"a":1,"b":2,"a":3}`), ParseOptions{DuplicateKeys: policy})
+		if err != nil {
+			t.Fatalf("Parse failed: %v", err)
+		}
+		if !root.HasKey("a") || !root.HasKey("b") || root.HasKey("c") {
+			t.Errorf("policy %v: unexpected HasKey results", policy)
+		}
+		if got, want := root.Get("a").Int(), map[DuplicateKeyPolicy]int64{LastWins: 3, FirstWins: 1}[policy]; got != want {
+			t.Errorf("policy %v: Get after HasKey = %d, want %d", policy, got, want)
+		}
+	}
+}
+
+func TestHasIndexMatchesIndex(t *testing.T) {
+	indices := []int{0, 1, 2, 3, 100, -1, -3, -4, -100}
+	for name, parse := range testParsers {
+		for _, i := range indices {
+			hasRoot, err := parse([]byte(hasKeyDoc))
+			if err != nil {
+				t.Fatalf("%s parse failed: %v", name, err)
+			}
+			indexRoot, _ := parse([]byte(hasKeyDoc))
+			want := indexRoot.Get("arr").Index(i).IsValid()
+			if got := hasRoot.Get("arr").HasIndex(i); got != want {
+				t.Errorf("%s HasIndex(%d) = %v, Index says %v", name, i, got, want)
+			}
+		}
+	}
+
+	root, _ := Parse([]byte(hasKeyDoc))
+	if root.HasIndex(0) || root.Get("s").HasIndex(0) || root.Get("missing").HasIndex(0) {
+		t.Error("HasIndex on a non-array should be false")
+	}
+	if empty, _ := Parse([]byte(`[]`)); empty.HasIndex(0) || empty.HasIndex(-1) {
+		t.Error("HasIndex on an empty array should be false")
+	}
+}
+
+func TestHasKeyOnQueryResults(t *testing.T) {
+	root, _ := Parse([]byte(hasDoc))
+	if one := root.Query("/store/book[?(@.price > 10 && @.price < 20)]"); !one.HasKey("author") || one.HasKey("isbn") {
+		t.Error("a single match should answer HasKey for itself")
+	}
+	if many := root.Query("/store/book[*]"); !many.HasKey("title") || many.HasKey("color") {
+		t.Error("a match set of several matches should answer HasKey for any of them")
+	}
+	if none := root.Query("/store/book[?(@.price > 100)]"); none.HasKey("title") || none.HasIndex(0) {
+		t.Error("an empty result has no keys or indices")
+	}
+	if scalar := root.Query("//color"); scalar.HasKey("color") {
+		t.Error("a single scalar match has no keys")
+	}
+	if !root.Query("/store/book[*]").HasIndex(2) || root.Query("/store/book[*]").HasIndex(3) {
+		t.Error("HasIndex should count the matches of a match set")
+	}
+}
+
+func TestHasKeyMissesDoNotAllocate(t *testing.T) {
+	for name, parse := range testParsers {
+		root, err := parse([]byte(hasKeyDoc))
+		if err != nil {
+			t.Fatalf("%s parse failed: %v", name, err)
+		}
+		arr := root.Get("arr")
+		checks := map[string]func(){
+			"missing key":   func() { root.HasKey("missing") },
+			"present key":   func() { root.HasKey("obj") },
+			"escaped key":   func() { root.HasKey("café") },
+			"key of scalar": func() { root.Get("a").HasKey("a") },
+			"index too big": func() { arr.HasIndex(10) },
+			"negative":      func() { arr.HasIndex(-10) },
+			"array key":     func() { arr.HasKey("a") },
+		}
+		for check, fn := range checks {
+			if allocs := testing.AllocsPerRun(20, fn); allocs != 0 {
+				t.Errorf("%s %s: %v allocations per call", name, check, allocs)
+			}
+		}
+	}
+}
@@ -0,0 +1,220 @@
+package engine
+
+import (
+	"errors"
+	"math"
+	"testing"
+
+	"github.com/474420502/xjson/internal/core"
+)
+
+func TestInsertAtLazyArray(t *testing.T) {
+	testCases := []struct {
+		index int
+		want  string
+	}{
+		{0, `[0,1, 2, 3]`},
+		{1, `[1, 0, 2, 3]`},
+		{3, `[1, 2, 3, 0]`},
+		{-1, `[1, 2, 0, 3]`},
+		{-3, `[0,1, 2, 3]`},
+	}
+	for _, tc := range testCases {
+		root, err := Parse([]byte(`{"list":[1, 2, 3],"other":true}`))
+		if err != nil {
+			t.Fatalf("Parse failed: %v", err)
+		}
+		list := root.Get("list")
+		if res := list.InsertAt(tc.index, 0); !res.IsValid() {
+			t.Fatalf("InsertAt(%d) failed: %v", tc.index, res.Error())
+		}
+		if got := list.String(); got != tc.want {
+			t.Fatalf("InsertAt(%d) = %s, want %s", tc.index, got, tc.want)
+		}
+		if got := root.String(); got != `{"list":`+tc.want+`,"other":true}` {
+			t.Fatalf("InsertAt(%d) serialized the document as %s", tc.index, got)
+		}
+	}
+
+	// An array that was only partly parsed by an index access.
+	root, err := Parse([]byte(`{"list":[{"id":1},{"id":2},{"id":3}]}`))
+	if err != nil {
+		t.Fatalf("Parse failed: %v", err)
+	}
+	list := root.Get("list")
+	if got := list.Index(0).Get("id").Int(); got != 1 {
+		t.Fatalf("unexpected first id %d", got)
+	}
+	list.InsertAt(1, map[string]interface{}{"id": 9})
+	if got := root.Query("/list[*]/id").Strings(); len(got) != 4 || got[0] != "1" || got[1] != "9" || got[2] != "2" || got[3] != "3" {
+		t.Fatalf("unexpected ids after insert: %v", got)
+	}
+	if got := root.Query("/list[1]").Parent(); got != list {
+		t.Fatal("expected the inserted element to belong to the array")
+	}
+}
+
+func TestInsertAtOutOfRangeLeavesArrayUnchanged(t *testing.T) {
+	root, err := Parse([]byte(`{"list":[1,2,3]}`))
+	if err != nil {
+		t.Fatalf("Parse failed: %v", err)
+	}
+	list := root.Get("list")
+	for _, index := range []int{4, -4, 100} {
+		res := list.InsertAt(index, 0)
+		if res.IsValid() || !errors.Is(res.Error(), core.ErrIndexOutOfBounds) {
+			t.Fatalf("InsertAt(%d): expected ErrIndexOutOfBounds, got %v", index, res.Error())
+		}
+	}
+	if got := root.String(); got != `{"list":[1,2,3]}` || list.Error() != nil {
+		t.Fatalf("expected the array to be unchanged, got %s (%v)", got, list.Error())
+	}
+	if res := list.Index(7); !errors.Is(res.Error(), core.ErrIndexOutOfBounds) {
+		t.Fatalf("expected Index to report ErrIndexOutOfBounds, got %v", res.Error())
+	}
+	if res := root.Get("list").InsertAt(0, make(chan int)); res.IsValid() || root.Get("list").Len() != 3 {
+		t.Fatalf("expected an unconvertible value to be rejected, got %v", res.Error())
+	}
+	if res := root.InsertAt(0, 1); res.IsValid() {
+		t.Fatal("expected InsertAt on an object to fail")
+	}
+}
+
+func TestAppendAllIsAtomic(t *testing.T) {
+	root, err := Parse([]byte(`{"list":["a"]}`))
+	if err != nil {
+		t.Fatalf("Parse failed: %v", err)
+	}
+	list := root.Get("list")
+	list.AppendAll("b", 3, map[string]interface{}{"c": true}, nil)
+	if got := root.String(); got != `{"list":["a","b",3,{"c":true},null]}` {
+		t.Fatalf("unexpected document after AppendAll: %s", got)
+	}
+	if got := list.AppendAll().Len(); got != 5 {
+		t.Fatalf("expected an empty AppendAll to keep 5 elements, got %d", got)
+	}
+
+	res := list.AppendAll("d", make(chan int), "e")
+	if res.IsValid() {
+		t.Fatal("expected AppendAll with an unconvertible value to fail")
+	}
+	if got := root.String(); got != `{"list":["a","b",3,{"c":true},null]}` || list.Error() != nil {
+		t.Fatalf("expected the array to be unchanged, got %s (%v)", got, list.Error())
+	}
+
+	values := make([]interface{}, 1000)
+	for i := range values {
+		values[i] = i
+	}
+	if got := NewArrayNode(nil, nil, nil).AppendAll(values...).Len(); got != 1000 {
+		t.Fatalf("expected 1000 elements, got %d", got)
+	}
+}
+
+func TestAppendAndInsertByPath(t *testing.T) {
+	root, err := Parse([]byte(`{"a":{"list":[1,2]},"rows":[[1],[2]]}`))
+	if err != nil {
+		t.Fatalf("Parse failed: %v", err)
+	}
+	if res := root.AppendByPath("/a/list", 3, 4); !res.IsValid() {
+		t.Fatalf("AppendByPath failed: %v", res.Error())
+	}
+	if res := root.InsertByPath("/a/list", 0, 0); !res.IsValid() {
+		t.Fatalf("InsertByPath failed: %v", res.Error())
+	}
+	root.InsertByPath("/rows[1]", -1, 9)
+	if got := root.String(); got != `{"a":{"list":[0,1,2,3,4]},"rows":[[1],[9,2]]}` {
+		t.Fatalf("unexpected document %s", got)
+	}
+
+	for _, res := range []core.Node{
+		root.AppendByPath("/a/missing", 1),
+		root.AppendByPath("/a", 1),
+		root.AppendByPath("/a/list[*]", 1),
+		root.InsertByPath("/a/list", 9, 1),
+	} {
+		if res.IsValid() {
+			t.Fatalf("expected an error, got %s", res.String())
+		}
+	}
+	if got := root.Query("/a/list").String(); got != `[0,1,2,3,4]` {
+		t.Fatalf("expected failed calls to leave the array alone, got %s", got)
+	}
+}
+
+func TestSetIndexLazyArray(t *testing.T) {
+	testCases := []struct {
+		index int
+		value interface{}
+		want  string
+	}{
+		{0, 9, `[9,"b",{"c":3}]`},
+		{1, 2.5, `[1,2.5,{"c":3}]`},
+		{-1, []interface{}{"x", nil}, `[1,"b",["x",null]]`},
+		{-3, map[string]interface{}{"k": true}, `[{"k":true},"b",{"c":3}]`},
+		{2, "s", `[1,"b","s"]`},
+	}
+	for _, tc := range testCases {
+		root, err := Parse([]byte(`{"list":[1,"b",{"c":3}],"other":true}`))
+		if err != nil {
+			t.Fatalf("Parse failed: %v", err)
+		}
+		list := root.Get("list")
+		if res := list.SetIndex(tc.index, tc.value); res != list {
+			t.Fatalf("SetIndex(%d) = %v, want the array", tc.index, res.Error())
+		}
+		if got := root.Query("/list").String(); got != tc.want {
+			t.Fatalf("SetIndex(%d) = %s, want %s", tc.index, got, tc.want)
+		}
+		if got := root.String(); got != `{"list":`+tc.want+`,"other":true}` {
+			t.Fatalf("SetIndex(%d) serialized the document as %s", tc.index, got)
+		}
+		idx := tc.index
+		if idx < 0 {
+			idx += 3
+		}
+		if elem := root.Query("/list").Index(idx); elem.Parent() != list {
+			t.Fatalf("SetIndex(%d): the new element does not belong to the array", tc.index)
+		}
+	}
+
+	// An element that was already parsed is replaced, and queries cached
+	// before the write see the new value.
+	root, err := Parse([]byte(`{"list":[{"id":1},{"id":2}]}`))
+	if err != nil {
+		t.Fatalf("Parse failed: %v", err)
+	}
+	if got := root.Query("/list[1]/id").Int(); got != 2 {
+		t.Fatalf("unexpected id %d", got)
+	}
+	root.Get("list").SetIndex(1, map[string]interface{}{"id": 7}).SetIndex(0, map[string]interface{}{"id": 6})
+	if got := root.Query("/list[*]/id").Strings(); len(got) != 2 || got[0] != "6" || got[1] != "7" {
+		t.Fatalf("unexpected ids after SetIndex: %v", got)
+	}
+}
+
+func TestSetIndexFailuresLeaveArrayUnchanged(t *testing.T) {
+	root, err := Parse([]byte(`{"list":[1,2,3],"obj":{"a":1}}`))
+	if err != nil {
+		t.Fatalf("Parse failed: %v", err)
+	}
+	list := root.Get("list")
+	for _, index := range []int{3, -4, 100} {
+		res := list.SetIndex(index, 0)
+		if res.IsValid() || !errors.Is(res.Error(), core.ErrIndexOutOfBounds) {
+			t.Fatalf("SetIndex(%d): expected ErrIndexOutOfBounds, got %v", index, res.Error())
+		}
+	}
+	if res := list.SetIndex(0, make(chan int)); res.IsValid() {
+		t.Fatal("expected an unconvertible value to be rejected")
+	}
+	if res := list.SetIndex(1, math.NaN()); res.IsValid() {
+		t.Fatal("expected NaN to be rejected")
+	}
+	if got := root.String(); got != `{"list":[1,2,3],"obj":{"a":1}}` || list.Error() != nil {
+		t.Fatalf("expected the document to be unchanged, got %s (%v)", got, list.Error())
+	}
+	if res := root.Get("obj").SetIndex(0, 1); !errors.Is(res.Error(), core.ErrTypeAssertion) {
+		t.Fatalf("SetIndex on an object: got %v, want ErrTypeAssertion", res.Error())
+	}
+}
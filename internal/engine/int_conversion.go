@@ -0,0 +1,150 @@
+package engine
+
+import (
+	"errors"
+	"math"
+	"strconv"
+	"strings"
+
+	"github.com/474420502/xjson/internal/core"
+)
+
+// intMode says what intOf does with the fractional part of a number.
+type intMode int
+
+const (
+	intExact intMode = iota // fail
+	intRound                // round half away from zero
+	intFloor                // round towards negative infinity
+)
+
+// maxExponent bounds the exponents intOf works with. Any number with a
+// larger one is either 0 or out of range long before.
+const maxExponent = 1 << 30
+
+// intOf converts the JSON number raw to an int64 digit by digit, never
+// through a float64, so 9007199254740993 and 1e3 convert exactly. It fails
+// with core.ErrNotInteger for a fractional part in intExact mode and with
+// strconv.ErrRange for a value outside the int64 range.
+func intOf(raw string, mode intMode) (int64, error) {
+	if i, err := strconv.ParseInt(raw, 10, 64); err == nil {
+		return i, nil
+	} else if errors.Is(err, strconv.ErrRange) {
+		return 0, strconv.ErrRange
+	}
+	neg := strings.HasPrefix(raw, "-")
+	s := strings.TrimPrefix(raw, "-")
+	exp := 0
+	if i := strings.IndexAny(s, "eE"); i >= 0 {
+		e, err := strconv.ParseInt(s[i+1:], 10, 64)
+		if err != nil && !errors.Is(err, strconv.ErrRange) {
+			return 0, err
+		}
+		exp = int(max(-maxExponent, min(e, maxExponent)))
+		s = s[:i]
+	}
+	whole, frac, _ := strings.Cut(s, ".")
+	if !isDigits(whole) || !isDigits(frac) || whole == "" {
+		return 0, strconv.ErrSyntax
+	}
+	digits := strings.TrimLeft(whole+frac, "0")
+	// The value is 0.digits times 10^point.
+	point := len(whole) + exp - (len(whole) + len(frac) - len(digits))
+	digits = strings.TrimRight(digits, "0")
+	if digits == "" {
+		return 0, nil
+	}
+
+	var intDigits string
+	fraction, roundUp := true, false
+	switch {
+	case point <= 0:
+		intDigits = "0"
+		roundUp = point == 0 && digits[0] >= '5'
+	case point < len(digits):
+		intDigits = digits[:point]
+		roundUp = digits[point] >= '5'
+	case point > 20:
+		return 0, strconv.ErrRange
+	default:
+		intDigits = digits + strings.Repeat("0", point-len(digits))
+		fraction = false
+	}
+	if fraction {
+		switch mode {
+		case intExact:
+			return 0, core.ErrNotInteger
+		case intFloor:
+			roundUp = neg
+		}
+	}
+
+	u, err := strconv.ParseUint(intDigits, 10, 64)
+	if err != nil {
+		return 0, strconv.ErrRange
+	}
+	if roundUp {
+		if u == math.MaxUint64 {
+			return 0, strconv.ErrRange
+		}
+		u++
+	}
+	switch {
+	case neg && u <= 1<<63:
+		return int64(-u), nil
+	case !neg && u <= math.MaxInt64:
+		return int64(u), nil
+	}
+	return 0, strconv.ErrRange
+}
+
+// isDigits reports whether s holds ASCII digits only.
+func isDigits(s string) bool {
+	for i := 0; i < len(s); i++ {
+		if s[i] < '0' || s[i] > '9' {
+			return false
+		}
+	}
+	return true
+}
+
+// IntExact returns the value of a number that is an integer in the int64
+// range, however it is written: 1e3 and 1000.0 are 1000. It returns the
+// error of the node, or a *core.TypeError wrapping core.ErrNotInteger for a
+// fractional part and strconv.ErrRange for a value out of range.
+func (n *baseNode) IntExact() (int64, error) {
+	self := n.selfOrMe()
+	if err := self.Error(); err != nil {
+		return 0, err
+	}
+	if _, ok := self.(*numberNode); !ok {
+		return 0, typeError(self, "int", nil)
+	}
+	i, err := intOf(self.Raw(), intExact)
+	if err != nil {
+		return 0, typeError(self, "int", err)
+	}
+	return i, nil
+}
+
+// IntRound is Int rounding a fractional part half away from zero, so 42.5
+// is 43 and -42.5 is -43.
+func (n *baseNode) IntRound() int64 { return n.roundedInt("IntRound", intRound) }
+
+// IntFloor is Int rounding a fractional part down, so 42.7 is 42 and -42.7
+// is -43.
+func (n *baseNode) IntFloor() int64 { return n.roundedInt("IntFloor", intFloor) }
+
+// roundedInt converts a number in mode for op, returning 0 like Int for
+// anything else or a value out of range.
+func (n *baseNode) roundedInt(op string, mode intMode) int64 {
+	self := n.selfOrMe()
+	if _, ok := self.(*numberNode); !ok || self.Error() != nil {
+		return conversionZero[int64](n, op, "int", nil)
+	}
+	i, err := intOf(self.Raw(), mode)
+	if err != nil {
+		n.conversionFailed(op, "int", err)
+	}
+	return i
+}
@@ -0,0 +1,110 @@
+package engine
+
+import (
+	"errors"
+	"strconv"
+	"testing"
+
+	"github.com/474420502/xjson/internal/core"
+)
+
+func TestIntConversions(t *testing.T) {
+	cases := []struct {
+		raw          string
+		exact        int64
+		exactErr     error
+		round, floor int64
+	}{
+		{"42", 42, nil, 42, 42},
+		{"42.7", 0, core.ErrNotInteger, 43, 42},
+		{"-42.7", 0, core.ErrNotInteger, -43, -43},
+		{"42.5", 0, core.ErrNotInteger, 43, 42},
+		{"-42.5", 0, core.ErrNotInteger, -43, -43},
+		{"42.49999999999999999999", 0, core.ErrNotInteger, 42, 42},
+		{"0.5", 0, core.ErrNotInteger, 1, 0},
+		{"-0.2", 0, core.ErrNotInteger, 0, -1},
+		{"1e-400", 0, core.ErrNotInteger, 0, 0},
+		{"1e20", 0, strconv.ErrRange, 0, 0},
+		{"-1e-999999999999", 0, core.ErrNotInteger, 0, -1},
+		{"1e999999999999", 0, strconv.ErrRange, 0, 0},
+		{"9007199254740993", 9007199254740993, nil, 9007199254740993, 9007199254740993},
+		{"9007199254740993.0", 9007199254740993, nil, 9007199254740993, 9007199254740993},
+		{"9223372036854775807", 9223372036854775807, nil, 9223372036854775807, 9223372036854775807},
+		{"9223372036854775808", 0, strconv.ErrRange, 0, 0},
+		{"-9223372036854775808", -9223372036854775808, nil, -9223372036854775808, -9223372036854775808},
+		{"-9223372036854775808.5", 0, core.ErrNotInteger, 0, 0},
+		{"9223372036854775807.5", 0, core.ErrNotInteger, 0, 9223372036854775807},
+		{"1e3", 1000, nil, 1000, 1000},
+		{"1E+3", 1000, nil, 1000, 1000},
+		{"-2.5e1", -25, nil, -25, -25},
+		{"1250e-2", 0, core.ErrNotInteger, 13, 12},
+		{"1200e-2", 12, nil, 12, 12},
+		{"0.0e5", 0, nil, 0, 0},
+		{"-0", 0, nil, 0, 0},
+	}
+	for _, tc := range cases {
+		for name, parse := range testParsers {
+			root, err := parse([]byte(`{"v":` + tc.raw + `}`))
+			if err != nil {
+				t.Fatalf("%s: parse %s failed: %v", name, tc.raw, err)
+			}
+			v := root.Get("v")
+			got, err := v.IntExact()
+			if tc.exactErr == nil && (err != nil || got != tc.exact) {
+				t.Errorf("%s: IntExact(%s) = %d, %v, want %d", name, tc.raw, got, err, tc.exact)
+			}
+			var typeErr *core.TypeError
+			if tc.exactErr != nil && (got != 0 || !errors.Is(err, tc.exactErr) || !errors.As(err, &typeErr)) {
+				t.Errorf("%s: IntExact(%s) = %d, %v, want a *TypeError wrapping %v", name, tc.raw, got, err, tc.exactErr)
+			}
+			if tryGot, tryErr := v.TryInt(); tryGot != got || (tryErr == nil) != (err == nil) {
+				t.Errorf("%s: TryInt(%s) = %d, %v, IntExact gives %d, %v", name, tc.raw, tryGot, tryErr, got, err)
+			}
+			if i := v.Int(); i != tc.exact {
+				t.Errorf("%s: Int(%s) = %d, want %d", name, tc.raw, i, tc.exact)
+			}
+			if i := v.IntRound(); i != tc.round {
+				t.Errorf("%s: IntRound(%s) = %d, want %d", name, tc.raw, i, tc.round)
+			}
+			if i := v.IntFloor(); i != tc.floor {
+				t.Errorf("%s: IntFloor(%s) = %d, want %d", name, tc.raw, i, tc.floor)
+			}
+			if i := root.Query("/v").IntRound(); i != tc.round {
+				t.Errorf("%s: Query(/v).IntRound(%s) = %d, want %d", name, tc.raw, i, tc.round)
+			}
+		}
+	}
+}
+
+func TestIntConversionsOfOtherValues(t *testing.T) {
+	root, err := ParseWithOptions([]byte(`{"s":"42","f":42.7,"big":1e20}`), ParseOptions{StrictConversionErrors: true})
+	if err != nil {
+		t.Fatalf("ParseWithOptions failed: %v", err)
+	}
+	for _, n := range []core.Node{root.Get("s"), root.Get("missing"), root, NewNodeFromInterface(nil, "42", nil)} {
+		if n.IntRound() != 0 || n.IntFloor() != 0 {
+			t.Errorf("IntRound, IntFloor of %s = %d, %d, want 0", n.Raw(), n.IntRound(), n.IntFloor())
+		}
+		if _, err := n.IntExact(); err == nil {
+			t.Errorf("IntExact of %s should fail", n.Raw())
+		}
+	}
+	if _, err := root.Get("missing").IntExact(); !errors.Is(err, root.Get("missing").Error()) {
+		t.Errorf("IntExact of a missing key = %v, want the error of the node", err)
+	}
+
+	f := root.Get("f")
+	if f.Int() != 0 || !errors.Is(f.LastError(), core.ErrNotInteger) {
+		t.Errorf("Int of 42.7 = %d, LastError() = %v, want 0 and ErrNotInteger", f.Int(), f.LastError())
+	}
+	big := root.Get("big")
+	if big.IntRound() != 0 || !errors.Is(big.LastError(), strconv.ErrRange) {
+		t.Errorf("IntRound of 1e20 = %d, LastError() = %v, want 0 and ErrRange", big.IntRound(), big.LastError())
+	}
+	if n := NewNodeFromInterface(nil, 42.7, nil); n.Int() != 0 || n.IntRound() != 43 || n.IntFloor() != 42 {
+		t.Errorf("built 42.7: Int, IntRound, IntFloor = %d, %d, %d", n.Int(), n.IntRound(), n.IntFloor())
+	}
+	if n := NewNodeFromInterface(nil, 1e3, nil); n.Int() != 1000 {
+		t.Errorf("built 1e3: Int() = %d, want 1000", n.Int())
+	}
+}
@@ -38,6 +38,17 @@ func (n *invalidNode) IsValid() bool
 func (n *invalidNode) Query(path string) core.Node                              { return n }
 func (n *invalidNode) Get(key string) core.Node                                 { return n }
 func (n *invalidNode) Index(i int) core.Node                                    { return n }
+func (n *invalidNode) HasKey(key string) bool                                   { return false }
+func (n *invalidNode) HasIndex(i int) bool                                      { return false }
+func (n *invalidNode) First() core.Node                                         { return n }
+func (n *invalidNode) Last() core.Node                                          { return n }
+func (n *invalidNode) FirstElement() core.Node                                  { return n }
+func (n *invalidNode) LastElement() core.Node                                   { return n }
+func (n *invalidNode) MatchCount() int                                          { return 0 }
+func (n *invalidNode) Value() (interface{}, error)                              { return nil, n.err }
+func (n *invalidNode) Values() []interface{}                                    { return []interface{}{} }
+func (n *invalidNode) MapInterface() (map[string]interface{}, error)            { return nil, n.err }
+func (n *invalidNode) SliceInterface() ([]interface{}, error)                   { return nil, n.err }
 func (n *invalidNode) ForEach(fn func(keyOrIndex interface{}, value core.Node)) {}
 func (n *invalidNode) Len() int                                                 { return 0 }
 func (n *invalidNode) Set(key string, value interface{}) core.Node {
@@ -51,22 +62,64 @@ func (n *invalidNode) SetByPath(path string, value interface{}) core.Node {
 
 func (n *invalidNode) Append(value interface{}) core.Node { return n }
 
-func (n *invalidNode) String() string                  { return "invalid" }
-func (n *invalidNode) MustString() string              { panic(n.err) }
-func (n *invalidNode) Float() float64                  { return 0 }
-func (n *invalidNode) MustFloat() float64              { panic(n.err) }
-func (n *invalidNode) Int() int64                      { return 0 }
-func (n *invalidNode) MustInt() int64                  { panic(n.err) }
-func (n *invalidNode) Bool() bool                      { return false }
-func (n *invalidNode) MustBool() bool                  { panic(n.err) }
-func (n *invalidNode) Time() time.Time                 { return time.Time{} }
-func (n *invalidNode) MustTime() time.Time             { panic(n.err) }
-func (n *invalidNode) Array() []core.Node              { return nil }
-func (n *invalidNode) MustArray() []core.Node          { panic(n.err) }
-func (n *invalidNode) Interface() interface{}          { return nil }
-func (n *invalidNode) RawString() (string, bool)       { return "", false }
-func (n *invalidNode) Strings() []string               { return nil }
-func (n *invalidNode) Keys() []string                  { return nil }
-func (n *invalidNode) Contains(value string) bool      { return false }
-func (n *invalidNode) AsMap() map[string]core.Node     { return nil }
-func (n *invalidNode) MustAsMap() map[string]core.Node { panic(n.err) }
+func (n *invalidNode) AppendAll(values ...interface{}) core.Node { return n }
+
+func (n *invalidNode) PrependAll(values ...interface{}) core.Node { return n }
+
+func (n *invalidNode) InsertAt(index int, value interface{}) core.Node { return n }
+
+func (n *invalidNode) SetIndex(index int, value interface{}) core.Node { return n }
+
+func (n *invalidNode) Delete(key string) core.Node { return n }
+
+// DeleteByPath implements the DeleteByPath method for invalidNode
+func (n *invalidNode) DeleteByPath(path string) core.Node {
+	return n
+}
+
+func (n *invalidNode) AppendByPath(path string, values ...interface{}) core.Node { return n }
+
+func (n *invalidNode) InsertByPath(path string, index int, value interface{}) core.Node {
+	return n
+}
+
+func (n *invalidNode) String() string { return "invalid" }
+func (n *invalidNode) MustString() string {
+	return mustZero[string](&n.baseNode, mustError(n, "MustString", n.err))
+}
+func (n *invalidNode) Float() float64 { return 0 }
+func (n *invalidNode) MustFloat() float64 {
+	return mustZero[float64](&n.baseNode, mustError(n, "MustFloat", n.err))
+}
+func (n *invalidNode) Int() int64 { return 0 }
+func (n *invalidNode) MustInt() int64 {
+	return mustZero[int64](&n.baseNode, mustError(n, "MustInt", n.err))
+}
+func (n *invalidNode) Bool() bool { return false }
+func (n *invalidNode) MustBool() bool {
+	return mustZero[bool](&n.baseNode, mustError(n, "MustBool", n.err))
+}
+func (n *invalidNode) Truthy() bool    { return false }
+func (n *invalidNode) Time() time.Time { return time.Time{} }
+func (n *invalidNode) MustTime() time.Time {
+	return mustZero[time.Time](&n.baseNode, mustError(n, "MustTime", n.err))
+}
+func (n *invalidNode) Array() []core.Node { return nil }
+func (n *invalidNode) MustArray() []core.Node {
+	return mustZero[[]core.Node](&n.baseNode, mustError(n, "MustArray", n.err))
+}
+func (n *invalidNode) Interface() interface{}      { return nil }
+func (n *invalidNode) RawString() (string, bool)   { return "", false }
+func (n *invalidNode) RawEscaped() (string, bool)  { return "", false }
+func (n *invalidNode) Strings() []string           { return nil }
+func (n *invalidNode) Keys() []string              { return nil }
+func (n *invalidNode) Contains(value string) bool  { return false }
+func (n *invalidNode) AsMap() map[string]core.Node { return nil }
+func (n *invalidNode) MustAsMap() map[string]core.Node {
+	return mustZero[map[string]core.Node](&n.baseNode, mustError(n, "MustAsMap", n.err))
+}
+
+func (n *invalidNode) GroupBy(path string) (core.Groups, error) { return nil, n.err }
+func (n *invalidNode) DeleteAll(path string) (int, error)       { return 0, n.err }
+
+func (n *invalidNode) Iter() core.Iterator { return &nodeIterator{err: n.err, index: -1} }
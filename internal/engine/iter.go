@@ -0,0 +1,120 @@
+package engine
+
+import (
+	"fmt"
+
+	"github.com/474420502/xjson/internal/core"
+)
+
+// Iter steps through an array, match set or object without materializing
+// it: the source of an unparsed container is scanned one value at a time
+// and a value is only parsed when Value asks for it. Other types yield a
+// *core.TypeError from Err.
+func (n *baseNode) Iter() core.Iterator {
+	if n.err != nil {
+		return &nodeIterator{err: n.err, index: -1}
+	}
+	switch self := n.selfOrMe().(type) {
+	case *arrayNode:
+		return &nodeIterator{array: self, elems: self.rawIter().(*arrayIterator), mods: self.mods, index: -1}
+	case *objectNode:
+		return &nodeIterator{object: self, members: self.rawIter().(*objectIterator), mods: self.mods, index: -1}
+	default:
+		return &nodeIterator{err: &core.TypeError{Path: displayPath(self), Want: "array or object", Got: self.Type()}, index: -1}
+	}
+}
+
+// nodeIterator implements core.Iterator over the raw iterators of an array
+// or object node.
+type nodeIterator struct {
+	array   *arrayNode
+	object  *objectNode
+	elems   *arrayIterator
+	members *objectIterator
+	// mods is the container's write count when the iteration started.
+	mods uint64
+
+	index   int
+	key     string
+	value   core.Node
+	current bool
+	err     error
+}
+
+// check ends the iteration when the container was written to or failed
+// since the iteration started.
+func (it *nodeIterator) check() bool {
+	var base *baseNode
+	var mods uint64
+	if it.array != nil {
+		base, mods = &it.array.baseNode, it.array.mods
+	} else {
+		base, mods = &it.object.baseNode, it.object.mods
+	}
+	switch {
+	case base.err != nil:
+		it.err = base.err
+	case mods != it.mods:
+		it.err = core.ErrModifiedDuringIteration
+	default:
+		return true
+	}
+	it.current = false
+	return false
+}
+
+func (it *nodeIterator) Next() bool {
+	it.current = false
+	it.value = nil
+	if it.err != nil || !it.check() {
+		return false
+	}
+	if it.array != nil {
+		if !it.elems.Next() {
+			it.err = it.elems.Err()
+			return false
+		}
+		it.index = it.elems.Index()
+	} else {
+		if !it.members.Next() {
+			it.err = it.members.Err()
+			return false
+		}
+		it.index++
+		it.key = it.members.curKey
+	}
+	it.current = true
+	return true
+}
+
+func (it *nodeIterator) Index() int { return it.index }
+
+func (it *nodeIterator) Key() string { return it.key }
+
+// Value parses the current value on first use. A value that fails to parse
+// also ends the iteration with its error.
+func (it *nodeIterator) Value() core.Node {
+	if it.value != nil {
+		return it.value
+	}
+	if it.current && !it.check() {
+		return newInvalidNode(it.err)
+	}
+	if !it.current {
+		if it.err != nil {
+			return newInvalidNode(it.err)
+		}
+		return newInvalidNode(fmt.Errorf("iterator has no current value"))
+	}
+	if it.array != nil {
+		it.value = it.elems.ParseValue()
+	} else {
+		it.value = it.members.ParseValue()
+	}
+	if err := it.value.Error(); err != nil {
+		it.err = err
+	}
+	return it.value
+}
+
+func (it *nodeIterator) Err() error { return it.err }
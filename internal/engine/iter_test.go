@@ -0,0 +1,168 @@
+package engine
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/474420502/xjson/internal/core"
+)
+
+func TestIterEarlyBreakLeavesTheRestUnparsed(t *testing.T) {
+	root, err := Parse([]byte(`{"items":[{"id":1},{"id":2},{"id":3},{"id":4}]}`))
+	if err != nil {
+		t.Fatalf("parse failed: %v", err)
+	}
+	items := root.Get("items").(*arrayNode)
+	it := items.Iter()
+	var seen []int64
+	for it.Next() {
+		seen = append(seen, it.Value().Get("id").Int())
+		if it.Index() == 1 {
+			break
+		}
+	}
+	if len(seen) != 2 || seen[0] != 1 || seen[1] != 2 {
+		t.Fatalf("seen = %v", seen)
+	}
+	if items.parsed.Load() {
+		t.Error("breaking early should not parse the whole array")
+	}
+	if len(items.value) != 2 {
+		t.Errorf("expected only the visited elements to be parsed, got %d", len(items.value))
+	}
+	if it.Err() != nil {
+		t.Errorf("unexpected error %v", it.Err())
+	}
+	// Values handed out by the iterator are the elements of the document.
+	it = items.Iter()
+	it.Next()
+	it.Value().Set("id", 10)
+	if got := root.Query("/items[0]/id").Int(); got != 10 {
+		t.Errorf("write through the iterated value: got %d", got)
+	}
+}
+
+func TestIterRawObjectAndArray(t *testing.T) {
+	root, err := Parse([]byte(`{"b":[1,"two",null],"a":{"z":1,"y":[2]}}`))
+	if err != nil {
+		t.Fatalf("parse failed: %v", err)
+	}
+	var keys []string
+	var indices []int
+	for it := root.Iter(); it.Next(); {
+		keys = append(keys, it.Key())
+		indices = append(indices, it.Index())
+	}
+	if len(keys) != 2 || keys[0] != "b" || keys[1] != "a" || indices[1] != 1 {
+		t.Errorf("keys = %v, indices = %v, want document order", keys, indices)
+	}
+
+	var got []string
+	it := root.Get("b").Iter()
+	for it.Next() {
+		if it.Key() != "" {
+			t.Errorf("array iterator key = %q", it.Key())
+		}
+		got = append(got, it.Value().String())
+	}
+	if it.Err() != nil || len(got) != 3 || got[1] != "two" || got[2] != "null" {
+		t.Errorf("got %v, err %v", got, it.Err())
+	}
+}
+
+func TestIterAfterAppendAndMatchSets(t *testing.T) {
+	root, err := Parse([]byte(`{"tags":["a","b"],"users":[{"n":"x"},{"n":"y"}]}`))
+	if err != nil {
+		t.Fatalf("parse failed: %v", err)
+	}
+	tags := root.Get("tags")
+	tags.Append("c")
+	var got []string
+	it := tags.Iter()
+	for it.Next() {
+		got = append(got, it.Value().String())
+	}
+	if it.Err() != nil || len(got) != 3 || got[2] != "c" {
+		t.Errorf("after Append: got %v, err %v", got, it.Err())
+	}
+
+	root.Get("users").Index(0).Set("m", 1)
+	it = root.Query("/users/*/n").Iter()
+	got = got[:0]
+	for it.Next() {
+		got = append(got, it.Value().String())
+	}
+	if len(got) != 2 || got[0] != "x" || got[1] != "y" {
+		t.Errorf("match set: got %v", got)
+	}
+}
+
+func TestIterModificationEndsIteration(t *testing.T) {
+	for _, doc := range []string{`[1,2,3]`, `{"a":1,"b":2,"c":3}`} {
+		root, err := Parse([]byte(doc))
+		if err != nil {
+			t.Fatalf("parse failed: %v", err)
+		}
+		it := root.Iter()
+		if !it.Next() {
+			t.Fatalf("%s: expected a first value", doc)
+		}
+		if root.Type() == core.Array {
+			root.Append(4)
+		} else {
+			root.Delete("c")
+		}
+		if it.Next() {
+			t.Errorf("%s: Next after a write should report false", doc)
+		}
+		if !errors.Is(it.Err(), core.ErrModifiedDuringIteration) {
+			t.Errorf("%s: Err = %v", doc, it.Err())
+		}
+		if it.Value().IsValid() {
+			t.Errorf("%s: Value after the iteration ended should be invalid", doc)
+		}
+	}
+
+	// Writes inside the values are fine.
+	root, _ := Parse([]byte(`[{"a":1},{"a":2}]`))
+	count := 0
+	it := root.Iter()
+	for it.Next() {
+		it.Value().Set("a", 0)
+		count++
+	}
+	if count != 2 || it.Err() != nil {
+		t.Errorf("count = %d, err = %v", count, it.Err())
+	}
+}
+
+func TestIterErrors(t *testing.T) {
+	root, err := Parse([]byte(`{"a":[1,2 3],"b":[1,tru],"s":"x"}`))
+	if err != nil {
+		t.Fatalf("parse failed: %v", err)
+	}
+	it := root.Get("a").Iter()
+	count := 0
+	for it.Next() {
+		count++
+	}
+	if count != 1 || it.Err() == nil {
+		t.Errorf("malformed separator: count %d, err %v", count, it.Err())
+	}
+
+	it = root.Get("b").Iter()
+	for it.Next() {
+		it.Value()
+	}
+	if it.Err() == nil {
+		t.Error("a value that fails to parse should end the iteration with its error")
+	}
+
+	var typeErr *core.TypeError
+	if it := root.Get("s").Iter(); it.Next() || !errors.As(it.Err(), &typeErr) {
+		t.Errorf("string iterator: err %v", it.Err())
+	}
+	if it := root.Get("missing").Iter(); it.Next() || it.Err() == nil || it.Value().IsValid() {
+		t.Errorf("invalid node iterator: err %v", it.Err())
+	}
+}
@@ -2,7 +2,6 @@ package engine
 
 import (
 	"fmt"
-	"sort"
 
 	"github.com/474420502/xjson/internal/core"
 )
@@ -40,6 +39,9 @@ type objectIterator struct {
 	valStart int
 	valEnd   int
 	err      error
+	// shadowed marks the values hidden by a repeated key, see
+	// shadowedMembers.
+	shadowed map[int]bool
 }
 
 // arrayIterator scans an array's raw bytes without creating child nodes.
@@ -57,28 +59,26 @@ type arrayIterator struct {
 	err      error
 }
 
-// Iter returns an ObjectIter for the objectNode.
-func (n *objectNode) Iter() ObjectIter {
+// rawIter returns an ObjectIter for the objectNode.
+func (n *objectNode) rawIter() ObjectIter {
+	it := n.iterValue()
+	return &it
+}
+
+// iterValue is rawIter as a value, for loops that keep it on the stack.
+func (n *objectNode) iterValue() objectIterator {
 	if n == nil {
-		return &objectIterator{err: fmt.Errorf("nil node")}
+		return objectIterator{err: fmt.Errorf("nil node")}
 	}
 	if n.err != nil {
-		return &objectIterator{err: n.err}
+		return objectIterator{err: n.err}
 	}
-	// If node is dirty or has no raw, fall back to parsed mode
+	// If node is dirty or has no raw, fall back to parsed mode, which
+	// yields keys in the same document order as raw scanning.
 	if n.isDirty || len(n.raw) == 0 {
-		// prepare keys sorted
-		if n.sortedKeys == nil {
-			keys := make([]string, 0, len(n.value))
-			for k := range n.value {
-				keys = append(keys, k)
-			}
-			sort.Strings(keys)
-			n.sortedKeys = keys
-		}
-		return &objectIterator{node: n, rawMode: false, keys: n.sortedKeys, idx: -1}
+		return objectIterator{node: n, rawMode: false, keys: n.documentKeys(), idx: -1}
 	}
-	return &objectIterator{node: n, rawMode: true, raw: n.raw, pos: 0, idx: -1}
+	return objectIterator{node: n, rawMode: true, raw: n.raw, pos: 0, idx: -1}
 }
 
 // Next advances the object iterator to the next key/value pair.
@@ -107,6 +107,7 @@ func (it *objectIterator) Next() bool {
 			it.err = fmt.Errorf("malformed object")
 			return false
 		}
+		it.shadowed = shadowedMembers(raw, pos, duplicateKeyPolicy(&it.node.baseNode), nil)
 		pos++ // skip '{'
 	} else {
 		pos = it.pos
@@ -161,30 +162,36 @@ func (it *objectIterator) Next() bool {
 			it.err = fmt.Errorf("unexpected end after ':'")
 			return false
 		}
-		var valEnd int
-		switch raw[pos] {
-		case '{':
-			valEnd = findMatchingBrace(raw, pos)
-		case '[':
-			valEnd = findMatchingBracket(raw, pos)
-		case '"':
-			valEnd = findMatchingQuote(raw, pos)
-		default:
-			valEnd = findValueEnd(raw, pos)
-		}
+		valEnd := rawValueEnd(raw, pos)
 		if valEnd == -1 {
 			it.err = fmt.Errorf("unterminated value for key %s", keyStr)
 			return false
 		}
-		it.curKey = keyStr
-		it.valStart = pos
-		it.valEnd = valEnd
-		// advance pos to after value and optional comma
+		if valEnd < pos {
+			it.err = fmt.Errorf("missing value for key %s", keyStr)
+			return false
+		}
+		valStart := pos
+		// advance pos to after value and comma
 		pos = valEnd + 1
 		skipWS()
 		if pos < len(raw) && raw[pos] == ',' {
 			pos++
+			skipWS()
+			if pos < len(raw) && raw[pos] == '}' && !documentLeniency(&it.node.baseNode).trailingCommas {
+				it.err = fmt.Errorf("trailing comma in object")
+				return false
+			}
+		} else if pos >= len(raw) || raw[pos] != '}' {
+			it.err = fmt.Errorf("missing ',' after value for key %s", keyStr)
+			return false
 		}
+		if it.shadowed[valStart] {
+			continue
+		}
+		it.curKey = keyStr
+		it.valStart = valStart
+		it.valEnd = valEnd
 		it.pos = pos
 		return true
 	}
@@ -237,8 +244,18 @@ func (it *objectIterator) ParseValue() core.Node {
 		}
 		return newInvalidNode(fmt.Errorf("key not found: %s", it.curKey))
 	}
+	// Hand out the cached child when there is one, so writes through it
+	// reach the tree.
+	it.node.mu.Lock()
+	cached, ok := it.node.value[it.curKey]
+	it.node.mu.Unlock()
+	if ok {
+		return cached
+	}
 	segment := it.raw[it.valStart : it.valEnd+1]
 	p := newParser(segment, it.node.GetFuncs())
+	p.arena = it.node.arena
+	p.lenient = documentLeniency(&it.node.baseNode)
 	child := p.doParse(it.node)
 	if child == nil || !child.IsValid() {
 		if child != nil {
@@ -267,17 +284,23 @@ func (it *objectIterator) ParseValue() core.Node {
 func (it *objectIterator) Err() error { return it.err }
 
 // Array iterator implementation
-func (n *arrayNode) Iter() ArrayIter {
+func (n *arrayNode) rawIter() ArrayIter {
+	it := n.iterValue()
+	return &it
+}
+
+// iterValue is rawIter as a value, for loops that keep it on the stack.
+func (n *arrayNode) iterValue() arrayIterator {
 	if n == nil {
-		return &arrayIterator{err: fmt.Errorf("nil node")}
+		return arrayIterator{err: fmt.Errorf("nil node")}
 	}
 	if n.err != nil {
-		return &arrayIterator{err: n.err}
+		return arrayIterator{err: n.err}
 	}
 	if n.isDirty || len(n.raw) == 0 {
-		return &arrayIterator{node: n, rawMode: false, idx: -1, curIndex: -1}
+		return arrayIterator{node: n, rawMode: false, idx: -1, curIndex: -1}
 	}
-	return &arrayIterator{node: n, raw: n.raw, pos: 0, rawMode: true, idx: -1, curIndex: -1}
+	return arrayIterator{node: n, raw: n.raw, pos: 0, rawMode: true, idx: -1, curIndex: -1}
 }
 
 func (it *arrayIterator) Next() bool {
@@ -334,21 +357,15 @@ func (it *arrayIterator) Next() bool {
 			return false
 		}
 		elemStart := pos
-		var elemEnd int
-		switch raw[pos] {
-		case '{':
-			elemEnd = findMatchingBrace(raw, pos)
-		case '[':
-			elemEnd = findMatchingBracket(raw, pos)
-		case '"':
-			elemEnd = findMatchingQuote(raw, pos)
-		default:
-			elemEnd = findValueEnd(raw, pos)
-		}
+		elemEnd := rawValueEnd(raw, pos)
 		if elemEnd == -1 {
 			it.err = fmt.Errorf("unterminated array element")
 			return false
 		}
+		if elemEnd < elemStart {
+			it.err = fmt.Errorf("missing array element")
+			return false
+		}
 		it.valStart = elemStart
 		it.valEnd = elemEnd
 		it.curIndex = curIndex
@@ -357,6 +374,14 @@ func (it *arrayIterator) Next() bool {
 		skipWS()
 		if pos < len(raw) && raw[pos] == ',' {
 			pos++
+			skipWS()
+			if pos < len(raw) && raw[pos] == ']' && !documentLeniency(&it.node.baseNode).trailingCommas {
+				it.err = fmt.Errorf("trailing comma in array")
+				return false
+			}
+		} else if pos >= len(raw) || raw[pos] != ']' {
+			it.err = fmt.Errorf("missing ',' after array element %d", curIndex)
+			return false
 		}
 		it.pos = pos
 		return true
@@ -396,8 +421,21 @@ func (it *arrayIterator) ParseValue() core.Node {
 		}
 		return it.node.value[it.curIndex]
 	}
+	// Hand out the cached element when there is one, so writes through it
+	// reach the tree.
+	it.node.mu.Lock()
+	var cached core.Node
+	if it.curIndex < len(it.node.value) {
+		cached = it.node.value[it.curIndex]
+	}
+	it.node.mu.Unlock()
+	if cached != nil {
+		return cached
+	}
 	segment := it.raw[it.valStart : it.valEnd+1]
 	p := newParser(segment, it.node.GetFuncs())
+	p.arena = it.node.arena
+	p.lenient = documentLeniency(&it.node.baseNode)
 	child := p.doParse(it.node)
 	if child == nil || !child.IsValid() {
 		if child != nil {
@@ -0,0 +1,25 @@
+package engine
+
+import "github.com/474420502/xjson/internal/core"
+
+// Matches returns the matches of a query result: the elements of a match
+// set or a slice, or result itself for any other valid node. An invalid
+// result has no matches.
+func Matches(result core.Node) []core.Node {
+	if result == nil || !result.IsValid() {
+		return nil
+	}
+	if arr, ok := result.(*arrayNode); ok && (arr.matchSet || arr.selection) {
+		return append([]core.Node(nil), arr.value...)
+	}
+	return []core.Node{result}
+}
+
+// JoinMatches wraps matches, which may come from different documents, in a
+// match set with no parent that calls the functions in funcs.
+func JoinMatches(matches []core.Node, funcs *map[string]core.UnaryPathFunc) core.Node {
+	if matches == nil {
+		matches = []core.Node{}
+	}
+	return newMatchSet(nil, matches, funcs)
+}
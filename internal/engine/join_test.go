@@ -0,0 +1,52 @@
+package engine
+
+import (
+	"testing"
+
+	"github.com/474420502/xjson/internal/core"
+)
+
+func TestMatchesAndJoinMatches(t *testing.T) {
+	a, err := Parse([]byte(`{"items":[{"id":1},{"id":2}],"n":3}`))
+	if err != nil {
+		t.Fatalf("Parse failed: %v", err)
+	}
+	b, err := MustParse([]byte(`{"items":[{"id":4}],"n":5}`))
+	if err != nil {
+		t.Fatalf("MustParse failed: %v", err)
+	}
+
+	cases := []struct {
+		result core.Node
+		want   int
+	}{
+		{a.Query("/items[*]/id"), 2},
+		{a.Query("/items[0:1]"), 1},
+		{a.Query("/items"), 1},
+		{a.Query("/n"), 1},
+		{a.Query("/missing"), 0},
+		{a.Query("/items[?(@.id > 9)]"), 0},
+		{nil, 0},
+	}
+	for i, tc := range cases {
+		if got := len(Matches(tc.result)); got != tc.want {
+			t.Errorf("case %d: %d matches, want %d", i, got, tc.want)
+		}
+	}
+
+	var matches []core.Node
+	matches = append(matches, Matches(a.Query("/items[*]/id"))...)
+	matches = append(matches, Matches(b.Query("/items[*]/id"))...)
+	joined := JoinMatches(matches, a.GetFuncs())
+	if joined.String() != "[1,2,4]" || joined.Len() != 3 || !joined.HasMatches() {
+		t.Errorf("joined = %s (Len %d)", joined.String(), joined.Len())
+	}
+	if got := joined.Index(2).Path(); got != "/items[0]/id" {
+		t.Errorf("a match keeps the path in its own document, got %q", got)
+	}
+
+	empty := JoinMatches(nil, nil)
+	if !empty.IsValid() || empty.HasMatches() || empty.Len() != 0 {
+		t.Errorf("empty join: IsValid %v, HasMatches %v, Len %d", empty.IsValid(), empty.HasMatches(), empty.Len())
+	}
+}
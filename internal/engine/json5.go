@@ -0,0 +1,510 @@
+package engine
+
+import (
+	"bytes"
+	"fmt"
+	"math/big"
+	"strconv"
+	"unicode"
+	"unicode/utf8"
+)
+
+// Dialect selects the syntax ParseOptions accepts.
+type Dialect uint8
+
+const (
+	// StandardJSON accepts RFC 8259 JSON only.
+	StandardJSON Dialect = iota
+	// JSON5 additionally accepts unquoted identifier keys, single-quoted
+	// strings, hexadecimal numbers, numbers with a leading or trailing
+	// decimal point or a plus sign, Infinity and NaN (see
+	// ParseOptions.AllowNonFinite), comments and trailing commas.
+	JSON5
+)
+
+// transcodeJSON5 validates the JSON5 document data and returns it rewritten
+// as standard JSON, so the lazy scanners never meet the extended syntax.
+// Errors are *core.SyntaxError positioned in data.
+func transcodeJSON5(data []byte, allowNonFinite bool) ([]byte, error) {
+	t := json5Transcoder{data: data, allowNonFinite: allowNonFinite}
+	t.out.Grow(len(data))
+	if err := t.skipSpace(); err != nil {
+		return nil, err
+	}
+	if err := t.value(); err != nil {
+		return nil, err
+	}
+	if err := t.skipSpace(); err != nil {
+		return nil, err
+	}
+	if t.pos < len(t.data) {
+		return nil, t.errorf("invalid character %s after top-level value", t.quoteChar())
+	}
+	return t.out.Bytes(), nil
+}
+
+type json5Transcoder struct {
+	data           []byte
+	pos            int
+	out            bytes.Buffer
+	allowNonFinite bool
+}
+
+func (t *json5Transcoder) errorf(format string, args ...interface{}) error {
+	return t.errorAt(t.pos, format, args...)
+}
+
+func (t *json5Transcoder) errorAt(offset int, format string, args ...interface{}) error {
+	return newSyntaxError(t.data, offset, fmt.Sprintf(format, args...))
+}
+
+// quoteChar describes the character at pos for error messages.
+func (t *json5Transcoder) quoteChar() string {
+	r, _ := utf8.DecodeRune(t.data[t.pos:])
+	return strconv.QuoteRune(r)
+}
+
+// skipSpace skips JSON5 white space, line terminators and comments.
+func (t *json5Transcoder) skipSpace() error {
+	for t.pos < len(t.data) {
+		c := t.data[t.pos]
+		switch c {
+		case ' ', '\t', '\n', '\r', '\v', '\f':
+			t.pos++
+			continue
+		case '/':
+			if t.pos+1 >= len(t.data) {
+				return t.errorf("invalid character '/' looking for beginning of value")
+			}
+			switch t.data[t.pos+1] {
+			case '/':
+				t.pos += 2
+				for t.pos < len(t.data) && !t.lineTerminator() {
+					t.pos++
+				}
+			case '*':
+				end := bytes.Index(t.data[t.pos+2:], []byte("*/"))
+				if end < 0 {
+					return t.errorf("unterminated comment")
+				}
+				t.pos += 2 + end + 2
+			default:
+				return t.errorf("invalid character '/' looking for beginning of value")
+			}
+			continue
+		}
+		if c < utf8.RuneSelf {
+			return nil
+		}
+		r, size := utf8.DecodeRune(t.data[t.pos:])
+		if r != '\u00a0' && r != '\ufeff' && r != '\u2028' && r != '\u2029' && !unicode.Is(unicode.Zs, r) {
+			return nil
+		}
+		t.pos += size
+	}
+	return nil
+}
+
+// lineTerminator reports whether a JSON5 line terminator starts at pos.
+func (t *json5Transcoder) lineTerminator() bool {
+	switch t.data[t.pos] {
+	case '\n', '\r':
+		return true
+	case 0xe2:
+		return bytes.HasPrefix(t.data[t.pos:], []byte("\u2028")) || bytes.HasPrefix(t.data[t.pos:], []byte("\u2029"))
+	}
+	return false
+}
+
+func (t *json5Transcoder) value() error {
+	if t.pos >= len(t.data) {
+		return t.errorf("unexpected end of json")
+	}
+	switch c := t.data[t.pos]; {
+	case c == '{':
+		return t.object()
+	case c == '[':
+		return t.array()
+	case c == '"' || c == '\'':
+		return t.str()
+	case c == '-' || c == '+' || c == '.' || c == 'I' || c == 'N' || c >= '0' && c <= '9':
+		return t.number()
+	}
+	for _, lit := range [...]string{"true", "false", "null"} {
+		if bytes.HasPrefix(t.data[t.pos:], []byte(lit)) && !t.identPartAt(t.pos+len(lit)) {
+			t.out.WriteString(lit)
+			t.pos += len(lit)
+			return nil
+		}
+	}
+	return t.errorf("invalid character %s looking for beginning of value", t.quoteChar())
+}
+
+func (t *json5Transcoder) object() error {
+	t.pos++
+	t.out.WriteByte('{')
+	for first := true; ; first = false {
+		if err := t.skipSpace(); err != nil {
+			return err
+		}
+		if t.pos >= len(t.data) {
+			return t.errorf("unexpected end of json")
+		}
+		if t.data[t.pos] == '}' {
+			t.pos++
+			t.out.WriteByte('}')
+			return nil
+		}
+		if !first {
+			t.out.WriteByte(',')
+		}
+		if err := t.key(); err != nil {
+			return err
+		}
+		if err := t.skipSpace(); err != nil {
+			return err
+		}
+		if t.pos >= len(t.data) || t.data[t.pos] != ':' {
+			if t.pos >= len(t.data) {
+				return t.errorf("unexpected end of json")
+			}
+			return t.errorf("invalid character %s after object key", t.quoteChar())
+		}
+		t.pos++
+		t.out.WriteByte(':')
+		if err := t.skipSpace(); err != nil {
+			return err
+		}
+		if err := t.value(); err != nil {
+			return err
+		}
+		if err := t.skipSpace(); err != nil {
+			return err
+		}
+		if t.pos < len(t.data) && t.data[t.pos] == ',' {
+			t.pos++
+			continue
+		}
+		if t.pos < len(t.data) && t.data[t.pos] == '}' {
+			continue
+		}
+		if t.pos >= len(t.data) {
+			return t.errorf("unexpected end of json")
+		}
+		return t.errorf("invalid character %s after object key:value pair", t.quoteChar())
+	}
+}
+
+func (t *json5Transcoder) array() error {
+	t.pos++
+	t.out.WriteByte('[')
+	for first := true; ; first = false {
+		if err := t.skipSpace(); err != nil {
+			return err
+		}
+		if t.pos >= len(t.data) {
+			return t.errorf("unexpected end of json")
+		}
+		if t.data[t.pos] == ']' {
+			t.pos++
+			t.out.WriteByte(']')
+			return nil
+		}
+		if !first {
+			t.out.WriteByte(',')
+		}
+		if err := t.value(); err != nil {
+			return err
+		}
+		if err := t.skipSpace(); err != nil {
+			return err
+		}
+		if t.pos < len(t.data) && t.data[t.pos] == ',' {
+			t.pos++
+			continue
+		}
+		if t.pos < len(t.data) && t.data[t.pos] == ']' {
+			continue
+		}
+		if t.pos >= len(t.data) {
+			return t.errorf("unexpected end of json")
+		}
+		return t.errorf("invalid character %s after array element", t.quoteChar())
+	}
+}
+
+// key transcodes a quoted key or an ECMAScript identifier name.
+func (t *json5Transcoder) key() error {
+	if c := t.data[t.pos]; c == '"' || c == '\'' {
+		return t.str()
+	}
+	start := t.pos
+	var name []rune
+	for t.pos < len(t.data) {
+		r, size := utf8.DecodeRune(t.data[t.pos:])
+		if r == '\\' {
+			if t.pos+1 >= len(t.data) || t.data[t.pos+1] != 'u' {
+				return t.errorf("invalid escape in unquoted key")
+			}
+			var ok bool
+			if r, ok = parseHex4(t.data, t.pos+2); !ok {
+				return t.errorf("invalid unicode escape")
+			}
+			size = 6
+		}
+		if !identStart(r) && (len(name) == 0 || !identPart(r)) {
+			break
+		}
+		name = append(name, r)
+		t.pos += size
+	}
+	if len(name) == 0 {
+		return t.errorAt(start, "invalid character %s looking for beginning of object key", t.quoteChar())
+	}
+	writeJSONString(&t.out, string(name))
+	return nil
+}
+
+func identStart(r rune) bool {
+	return r == '$' || r == '_' || unicode.IsLetter(r) || unicode.Is(unicode.Nl, r)
+}
+
+func identPart(r rune) bool {
+	return identStart(r) || unicode.In(r, unicode.Mn, unicode.Mc, unicode.Nd, unicode.Pc) ||
+		r == '\u200c' || r == '\u200d'
+}
+
+// identPartAt reports whether an identifier character starts at i, which
+// would make a literal like null the prefix of a longer word.
+func (t *json5Transcoder) identPartAt(i int) bool {
+	if i >= len(t.data) {
+		return false
+	}
+	r, _ := utf8.DecodeRune(t.data[i:])
+	return identPart(r)
+}
+
+// str transcodes a single- or double-quoted string. Escapes JSON also has
+// are kept as they are; the others are replaced by what they stand for.
+func (t *json5Transcoder) str() error {
+	quote := t.data[t.pos]
+	start := t.pos
+	t.pos++
+	t.out.WriteByte('"')
+	for t.pos < len(t.data) {
+		c := t.data[t.pos]
+		switch {
+		case c == quote:
+			t.pos++
+			t.out.WriteByte('"')
+			return nil
+		case c == '\n' || c == '\r':
+			return t.errorf("invalid line break in string")
+		case c == '"':
+			t.out.WriteString(`\"`)
+			t.pos++
+		case c == '\\':
+			if err := t.escape(); err != nil {
+				return err
+			}
+		case c < 0x20:
+			t.out.WriteString(`\u00`)
+			t.out.WriteByte(hexDigits[c>>4])
+			t.out.WriteByte(hexDigits[c&0xf])
+			t.pos++
+		default:
+			t.out.WriteByte(c)
+			t.pos++
+		}
+	}
+	return t.errorAt(start, "unterminated string")
+}
+
+// escape transcodes the escape sequence at pos.
+func (t *json5Transcoder) escape() error {
+	if t.pos+1 >= len(t.data) {
+		return t.errorf("invalid escape at end of string")
+	}
+	c := t.data[t.pos+1]
+	switch c {
+	case '"', '\\', '/', 'b', 'f', 'n', 'r', 't':
+		t.out.Write(t.data[t.pos : t.pos+2])
+		t.pos += 2
+	case 'u':
+		if _, ok := parseHex4(t.data, t.pos+2); !ok {
+			return t.errorf("invalid unicode escape")
+		}
+		t.out.Write(t.data[t.pos : t.pos+6])
+		t.pos += 6
+	case 'x':
+		_, ok1 := hexDigit(t.data, t.pos+2)
+		_, ok2 := hexDigit(t.data, t.pos+3)
+		if !ok1 || !ok2 {
+			return t.errorf("invalid hexadecimal escape")
+		}
+		t.out.WriteString(`\u00`)
+		t.out.Write(t.data[t.pos+2 : t.pos+4])
+		t.pos += 4
+	case 'v':
+		t.out.WriteString(`\u000b`)
+		t.pos += 2
+	case '0':
+		if t.pos+2 < len(t.data) && t.data[t.pos+2] >= '0' && t.data[t.pos+2] <= '9' {
+			return t.errorf("invalid escape character: %c", t.data[t.pos+2])
+		}
+		t.out.WriteString(`\u0000`)
+		t.pos += 2
+	case '1', '2', '3', '4', '5', '6', '7', '8', '9':
+		return t.errorf("invalid escape character: %c", c)
+	case '\r':
+		// A line continuation: the escaped line break is dropped.
+		t.pos += 2
+		if t.pos < len(t.data) && t.data[t.pos] == '\n' {
+			t.pos++
+		}
+	case '\n':
+		t.pos += 2
+	default:
+		if bytes.HasPrefix(t.data[t.pos+1:], []byte("\u2028")) || bytes.HasPrefix(t.data[t.pos+1:], []byte("\u2029")) {
+			t.pos += 1 + len("\u2028")
+			return nil
+		}
+		// Any other character stands for itself.
+		t.pos++
+		if c < 0x20 {
+			t.out.WriteString(`\u00`)
+			t.out.WriteByte(hexDigits[c>>4])
+			t.out.WriteByte(hexDigits[c&0xf])
+			t.pos++
+			return nil
+		}
+		_, size := utf8.DecodeRune(t.data[t.pos:])
+		t.out.Write(t.data[t.pos : t.pos+size])
+		t.pos += size
+	}
+	return nil
+}
+
+func hexDigit(b []byte, i int) (byte, bool) {
+	if i >= len(b) {
+		return 0, false
+	}
+	switch c := b[i]; {
+	case c >= '0' && c <= '9':
+		return c - '0', true
+	case c >= 'a' && c <= 'f':
+		return c - 'a' + 10, true
+	case c >= 'A' && c <= 'F':
+		return c - 'A' + 10, true
+	}
+	return 0, false
+}
+
+// number transcodes a JSON5 number into the JSON number with the same
+// value: hexadecimal integers become decimal, a missing integer or fraction
+// part around the decimal point is filled in or dropped and a plus sign is
+// dropped. Infinity and NaN need allowNonFinite and, having no JSON number,
+// are kept as the literals Infinity, -Infinity and NaN, which the parser
+// then takes for numbers and the serializers refuse.
+func (t *json5Transcoder) number() error {
+	start := t.pos
+	neg := false
+	if c := t.data[t.pos]; c == '-' || c == '+' {
+		neg = c == '-'
+		t.pos++
+	}
+	rest := t.data[t.pos:]
+	for _, word := range [...]string{"Infinity", "NaN"} {
+		if !bytes.HasPrefix(rest, []byte(word)) || t.identPartAt(t.pos+len(word)) {
+			continue
+		}
+		if !t.allowNonFinite {
+			return t.errorAt(start, "non-finite number %s requires AllowNonFinite", t.data[start:t.pos+len(word)])
+		}
+		if neg && word == "Infinity" {
+			t.out.WriteByte('-')
+		}
+		t.out.WriteString(word)
+		t.pos += len(word)
+		return nil
+	}
+
+	if neg {
+		t.out.WriteByte('-')
+	}
+	if len(rest) >= 2 && rest[0] == '0' && (rest[1] == 'x' || rest[1] == 'X') {
+		t.pos += 2
+		digits := t.pos
+		for t.pos < len(t.data) {
+			if _, ok := hexDigit(t.data, t.pos); !ok {
+				break
+			}
+			t.pos++
+		}
+		hex := string(t.data[digits:t.pos])
+		if hex == "" {
+			return t.errorAt(start, "invalid hexadecimal number")
+		}
+		if v, err := strconv.ParseUint(hex, 16, 64); err == nil {
+			t.out.Write(strconv.AppendUint(t.out.AvailableBuffer(), v, 10))
+		} else {
+			v, _ := new(big.Int).SetString(hex, 16)
+			t.out.WriteString(v.String())
+		}
+		return t.numberEnd(start)
+	}
+
+	intStart := t.pos
+	t.skipDigits()
+	intPart := t.data[intStart:t.pos]
+	if len(intPart) > 1 && intPart[0] == '0' {
+		return t.errorAt(start, "invalid number: leading zero")
+	}
+	var frac []byte
+	if t.pos < len(t.data) && t.data[t.pos] == '.' {
+		t.pos++
+		fracStart := t.pos
+		t.skipDigits()
+		frac = t.data[fracStart:t.pos]
+	}
+	if len(intPart) == 0 && len(frac) == 0 {
+		return t.errorAt(start, "invalid number")
+	}
+	if len(intPart) == 0 {
+		t.out.WriteByte('0')
+	}
+	t.out.Write(intPart)
+	if len(frac) > 0 {
+		t.out.WriteByte('.')
+		t.out.Write(frac)
+	}
+	if t.pos < len(t.data) && (t.data[t.pos] == 'e' || t.data[t.pos] == 'E') {
+		expStart := t.pos
+		t.pos++
+		if t.pos < len(t.data) && (t.data[t.pos] == '+' || t.data[t.pos] == '-') {
+			t.pos++
+		}
+		digits := t.pos
+		t.skipDigits()
+		if t.pos == digits {
+			return t.errorAt(start, "invalid number: missing exponent digits")
+		}
+		t.out.Write(t.data[expStart:t.pos])
+	}
+	return t.numberEnd(start)
+}
+
+func (t *json5Transcoder) skipDigits() {
+	for t.pos < len(t.data) && t.data[t.pos] >= '0' && t.data[t.pos] <= '9' {
+		t.pos++
+	}
+}
+
+// numberEnd rejects numbers running into letters or digits, like 0x1G or
+// 1.5.2.
+func (t *json5Transcoder) numberEnd(start int) error {
+	if t.pos < len(t.data) && (t.data[t.pos] == '.' || t.identPartAt(t.pos)) {
+		return t.errorAt(start, "invalid number")
+	}
+	return nil
+}
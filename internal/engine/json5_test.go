@@ -0,0 +1,241 @@
+package engine
+
+import (
+	"encoding/json"
+	"errors"
+	"math"
+	"strings"
+	"testing"
+
+	"github.com/474420502/xjson/internal/core"
+)
+
+func TestTranscodeJSON5(t *testing.T) {
+	cases := []struct {
+		in, want string
+	}{
+		{`{a: 1, $b_2: 'x', "c": "y",}`, `{"a":1,"$b_2":"x","c":"y"}`},
+		{`[0x1F, -0X10, +7, .5, 5., -.25e2, 1.e3, 0]`, `[31,-16,7,0.5,5,-0.25e2,1e3,0]`},
+		{`[0xFFFFFFFFFFFFFFFFFF]`, `[4722366482869645213695]`},
+		{`'it\'s "quoted"'`, `"it's \"quoted\""`},
+		{`'\x41\v\0\q\/é'`, `"\u0041\u000b\u0000q\/é"`},
+		{"'line\\\ncontinued\\\r\nhere'", `"linecontinuedhere"`},
+		{"'tab\there'", `"tab\u0009here"`},
+		{"// leading\n{/* inline */ a /* key */ : [1, /* two */ 2,], // trailing\n}", `{"a":[1,2]}`},
+		{"\ufeff\u00a0{\u2028café: true\u2029}", `{"café":true}`},
+		{`{ab: null}`, `{"ab":null}`},
+		{`{true: false, null: 1}`, `{"true":false,"null":1}`},
+		{`"plain"`, `"plain"`},
+	}
+	for _, tc := range cases {
+		got, err := transcodeJSON5([]byte(tc.in), false)
+		if err != nil {
+			t.Errorf("transcodeJSON5(%q) error: %v", tc.in, err)
+			continue
+		}
+		if string(got) != tc.want {
+			t.Errorf("transcodeJSON5(%q) = %s, want %s", tc.in, got, tc.want)
+		}
+		if !json.Valid(got) {
+			t.Errorf("transcodeJSON5(%q) = %s is not valid JSON", tc.in, got)
+		}
+	}
+}
+
+func TestTranscodeJSON5Errors(t *testing.T) {
+	cases := []struct {
+		in     string
+		offset int
+		msg    string
+	}{
+		{`{a: Infinity}`, 4, "non-finite number Infinity requires AllowNonFinite"},
+		{`[-Infinity]`, 1, "non-finite number -Infinity requires AllowNonFinite"},
+		{`[NaN]`, 1, "non-finite number NaN requires AllowNonFinite"},
+		{`[01]`, 1, "leading zero"},
+		{`[0x]`, 1, "invalid hexadecimal number"},
+		{`[0x1G]`, 1, "invalid number"},
+		{`[.]`, 1, "invalid number"},
+		{`[1e]`, 1, "missing exponent digits"},
+		{`{1a: 1}`, 1, "beginning of object key"},
+		{`{a 1}`, 3, "after object key"},
+		{`[1 2]`, 3, "after array element"},
+		{`[1,,2]`, 3, "beginning of value"},
+		{`{a: 'x`, 4, "unterminated string"},
+		{"['a\nb']", 3, "invalid line break in string"},
+		{`['\1']`, 2, "invalid escape character: 1"},
+		{`['\x4']`, 2, "invalid hexadecimal escape"},
+		{`[1] /* open`, 4, "unterminated comment"},
+		{`[1] 2`, 4, "after top-level value"},
+		{`[nul]`, 1, "beginning of value"},
+		{``, 0, "unexpected end of json"},
+	}
+	for _, tc := range cases {
+		_, err := transcodeJSON5([]byte(tc.in), false)
+		var syntaxErr *core.SyntaxError
+		if !errors.As(err, &syntaxErr) {
+			t.Errorf("transcodeJSON5(%q) error = %v, want *core.SyntaxError", tc.in, err)
+			continue
+		}
+		if syntaxErr.Offset != tc.offset || !strings.Contains(syntaxErr.Msg, tc.msg) {
+			t.Errorf("transcodeJSON5(%q) error = %v (offset %d), want %q at offset %d", tc.in, err, syntaxErr.Offset, tc.msg, tc.offset)
+		}
+	}
+}
+
+func TestParseJSON5NonFinite(t *testing.T) {
+	root, err := ParseWithOptions([]byte(`{pos: Infinity, neg: -Infinity, plus: +Infinity, nan: NaN}`), ParseOptions{Dialect: JSON5, AllowNonFinite: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if f := root.Query("/pos").Float(); !math.IsInf(f, 1) {
+		t.Errorf("pos = %v, want +Inf", f)
+	}
+	if f := root.Query("/neg").Float(); !math.IsInf(f, -1) {
+		t.Errorf("neg = %v, want -Inf", f)
+	}
+	if f := root.Get("plus").Float(); !math.IsInf(f, 1) {
+		t.Errorf("plus = %v, want +Inf", f)
+	}
+	if nan := root.Get("nan"); nan.Type() != core.Number || !math.IsNaN(nan.Float()) {
+		t.Errorf("nan = %v %v, want the number NaN", nan.Type(), nan.Float())
+	}
+	// JSON has no text for them, so serializing them fails.
+	if _, err := root.Bytes(); !errors.Is(err, core.ErrNumberOverflow) {
+		t.Errorf("Bytes() error = %v, want ErrNumberOverflow", err)
+	}
+	if got := root.String(); got != "" {
+		t.Errorf("String() = %s, want no text", got)
+	}
+	for _, key := range []string{"pos", "neg", "plus", "nan"} {
+		root.Set(key, 0)
+	}
+	if got, want := root.String(), `{"pos":0,"neg":0,"plus":0,"nan":0}`; got != want {
+		t.Errorf("String() after replacing them = %s, want %s", got, want)
+	}
+}
+
+// TestParseJSON5NonFiniteRoundTrip checks that the non-finite numbers of
+// JSON5 read back as themselves through every accessor and in a copy, and
+// that every serializer refuses them, while a number too large for a
+// float64 keeps failing TryFloat with ErrNumberOverflow.
+func TestParseJSON5NonFiniteRoundTrip(t *testing.T) {
+	opts := ParseOptions{Dialect: JSON5, AllowNonFinite: true}
+	src := `{pos: Infinity, neg: -Infinity, nan: NaN, big: 1e999, list: [NaN, -Infinity]}`
+	check := func(t *testing.T, root core.Node, values int) {
+		t.Helper()
+		for path, want := range map[string]float64{"/pos": math.Inf(1), "/neg": math.Inf(-1), "/nan": math.NaN(), "/list[1]": math.Inf(-1)} {
+			n := root.Query(path)
+			same := func(f float64) bool { return f == want || math.IsNaN(f) && math.IsNaN(want) }
+			if f, err := n.TryFloat(); err != nil || !same(f) {
+				t.Errorf("%s TryFloat() = %v, %v, want %v", path, f, err, want)
+			}
+			if f := n.Float(); !same(f) {
+				t.Errorf("%s Float() = %v, want %v", path, f, want)
+			}
+			if f, ok := n.Interface().(float64); !ok || !same(f) {
+				t.Errorf("%s Interface() = %#v, want %v", path, n.Interface(), want)
+			}
+		}
+		big := root.Get("big")
+		if f, err := big.TryFloat(); !errors.Is(err, core.ErrNumberOverflow) {
+			t.Errorf("1e999 TryFloat() = %v, %v, want ErrNumberOverflow", f, err)
+		}
+		if f := big.Float(); !math.IsInf(f, 1) {
+			t.Errorf("1e999 Float() = %v, want +Inf", f)
+		}
+		if got := root.Query("//*").MatchCount(); got != values {
+			t.Errorf("//* found %d values, want %d", got, values)
+		}
+	}
+	for _, edited := range []bool{false, true} {
+		root, err := ParseWithOptions([]byte(src), opts)
+		if err != nil {
+			t.Fatal(err)
+		}
+		values := 7
+		if edited {
+			root.Get("list").Append(1)
+			values = 8
+		}
+		check(t, root, values)
+		if _, err := root.Bytes(); !errors.Is(err, core.ErrNumberOverflow) {
+			t.Errorf("edited %v: Bytes() error = %v, want ErrNumberOverflow", edited, err)
+		}
+		var buf strings.Builder
+		if n, err := root.WriteTo(&buf); !errors.Is(err, core.ErrNumberOverflow) || n != 0 || buf.Len() != 0 {
+			t.Errorf("edited %v: WriteTo() = %d, %v, wrote %q", edited, n, err, buf.String())
+		}
+		if _, err := root.CanonicalBytes(); !errors.Is(err, core.ErrNumberOverflow) {
+			t.Errorf("edited %v: CanonicalBytes() error = %v, want ErrNumberOverflow", edited, err)
+		}
+		if root.String() != "" || root.Get("list").String() != "" {
+			t.Errorf("edited %v: String() = %s, want no text", edited, root.String())
+		}
+		if data, err := root.Get("big").Bytes(); err != nil || string(data) != "1e999" {
+			t.Errorf("edited %v: 1e999 Bytes() = %s, %v", edited, data, err)
+		}
+		// A copy keeps the values.
+		check(t, root.Detach(), values)
+		// Writes keep rejecting non-finite floats.
+		if res := root.Set("pos", math.Inf(1)); res.IsValid() {
+			t.Errorf("edited %v: Set(+Inf) should fail", edited)
+		}
+	}
+
+	// Standard JSON and JSON5 without the option do not read the literals.
+	for _, doc := range []string{`{"a":NaN}`, `[Infinity]`, `{"a":-Infinity}`} {
+		root, err := Parse([]byte(doc))
+		if err == nil && (root.Get("a").IsValid() || root.Index(0).IsValid()) {
+			t.Errorf("Parse(%s) read a non-finite number", doc)
+		}
+		if _, err := ParseWithOptions([]byte(doc), ParseOptions{Dialect: JSON5}); err == nil {
+			t.Errorf("JSON5 without AllowNonFinite accepted %s", doc)
+		}
+	}
+}
+
+func TestParseJSON5LazyAccess(t *testing.T) {
+	doc := `{
+		// services by name
+		'web server': {port: 0x1F90, hosts: ['a', "b",], ratio: .5},
+		db: {port: 5432., tags: {primary: 'it\'s "main"'}},
+	}`
+	root, err := ParseWithOptions([]byte(doc), ParseOptions{Dialect: JSON5, DuplicateKeys: ErrorOnDuplicate})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := root.Query("/web server/port").Int(); got != 8080 {
+		t.Errorf("port = %d, want 8080", got)
+	}
+	if got := root.Query("/web server/hosts[1]").String(); got != "b" {
+		t.Errorf("hosts[1] = %q, want b", got)
+	}
+	if got := root.Query("//primary").Array(); len(got) != 1 || got[0].String() != `it's "main"` {
+		t.Errorf("//primary = %v", got)
+	}
+	if got := root.Get("db").Get("port").Float(); got != 5432 {
+		t.Errorf("db port = %v, want 5432", got)
+	}
+	if got := root.Query("/web server/ratio").Float(); got != 0.5 {
+		t.Errorf("ratio = %v, want 0.5", got)
+	}
+	if !json.Valid([]byte(root.String())) {
+		t.Errorf("String() = %s is not valid JSON", root.String())
+	}
+
+	if _, err := ParseWithOptions([]byte(`{a: 1, 'a': 2}`), ParseOptions{Dialect: JSON5, DuplicateKeys: ErrorOnDuplicate}); err == nil {
+		t.Error("duplicate keys spelled differently were not rejected")
+	}
+}
+
+func TestParseStandardRejectsJSON5(t *testing.T) {
+	for _, doc := range []string{`{a: 1}`, `{"a": 'x'}`} {
+		root, err := ParseWithOptions([]byte(doc), ParseOptions{})
+		if err != nil {
+			continue
+		}
+		if v := root.Get("a"); v.IsValid() {
+			t.Errorf("standard parse of %q read a = %v", doc, v)
+		}
+	}
+}
@@ -0,0 +1,105 @@
+package engine
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/474420502/xjson/internal/core"
+)
+
+func TestMaxRecursionDepthStopsDeepDocuments(t *testing.T) {
+	// The error gives the same depth however deep the document goes.
+	for _, depth := range []int{100, 10000, 20000} {
+		doc, err := ParseWithOptions(deepDocument(depth), ParseOptions{MaxRecursionDepth: 64})
+		if err != nil {
+			t.Fatalf("ParseWithOptions failed: %v", err)
+		}
+		for _, path := range []string{"//missing", "//a", "//*", "/a//a"} {
+			res := doc.Query(path)
+			if res.IsValid() || !errors.Is(res.Error(), core.ErrMaxDepthExceeded) {
+				t.Fatalf("depth %d: %s = %v, want ErrMaxDepthExceeded", depth, path, res.Error())
+			}
+			if !strings.Contains(res.Error().Error(), "depth 65, limit 64") {
+				t.Errorf("depth %d: %s: error %q should give the depth reached", depth, path, res.Error())
+			}
+		}
+	}
+	root, err := ParseWithOptions(deepDocument(10000), ParseOptions{MaxRecursionDepth: 64})
+	if err != nil {
+		t.Fatalf("ParseWithOptions failed: %v", err)
+	}
+	if root.Leaves().IsValid() {
+		t.Error("Leaves should fail on the deep document")
+	}
+	if root.Has("//missing") {
+		t.Error("Has should not report a match past the limit")
+	}
+	// A search that finds what it needs first does not go deeper.
+	if got := root.QueryFirst("//a"); !got.IsValid() || got.Parent() == nil {
+		t.Errorf("QueryFirst(//a) = %v", got.Error())
+	}
+
+	// Matches above the limit are whole values, also when the chain down
+	// to it runs through arrays and objects with several members.
+	deepMixed := []byte(strings.Repeat(`{"x":1,"a":[`, 100) + "1" + strings.Repeat(`],"y":2}`, 100))
+	mixed, err := ParseWithOptions(deepMixed, ParseOptions{MaxRecursionDepth: 64})
+	if err != nil {
+		t.Fatalf("ParseWithOptions failed: %v", err)
+	}
+	if res := mixed.Query("//y"); !errors.Is(res.Error(), core.ErrMaxDepthExceeded) {
+		t.Errorf("//y on nested arrays = %v, want ErrMaxDepthExceeded", res.Error())
+	}
+	if got := mixed.QueryFirst("//a"); string(got.Raw()) != string(deepMixed[11:len(deepMixed)-7]) {
+		t.Errorf("QueryFirst(//a) = %.20s..., want the whole array", got.Raw())
+	}
+	if got := mixed.QueryFirst("/a[0]//a"); got.Index(0).Get("y").Int() != 2 {
+		t.Errorf("QueryFirst(/a[0]//a) = %.20s..., want the whole array", got.Raw())
+	}
+
+	// The parsed tree is walked with the same limit.
+	root.Set("b", 1)
+	if res := root.Query("//missing"); !errors.Is(res.Error(), core.ErrMaxDepthExceeded) {
+		t.Errorf("//missing on the modified document = %v, want ErrMaxDepthExceeded", res.Error())
+	}
+}
+
+func TestMaxRecursionDepthKeepsShallowResults(t *testing.T) {
+	src := []byte(`{"id":0,"list":[{"id":1,"kids":[{"id":2},{"x":{"y":{"z":{"w":{"v":{"id":3}}}}}}]}],` +
+		`"tags":["a",["b",["c"]]],"empty":{}}`)
+	queries := []string{"//id", "//*", "/list//id", "/list[*]//id", "//kids/*", "//z//id", "//tags//*"}
+	for _, modified := range []bool{false, true} {
+		plain, _ := Parse(append([]byte(nil), src...))
+		capped, err := ParseWithOptions(append([]byte(nil), src...), ParseOptions{MaxRecursionDepth: 10})
+		if err != nil {
+			t.Fatalf("ParseWithOptions failed: %v", err)
+		}
+		if modified {
+			plain.Set("n", 1)
+			capped.Set("n", 1)
+		}
+		for _, path := range queries {
+			want, err := plain.Query(path).Bytes()
+			if err != nil {
+				t.Fatalf("%s without a limit failed: %v", path, err)
+			}
+			got, err := capped.Query(path).Bytes()
+			if err != nil || string(got) != string(want) {
+				t.Errorf("modified %v: %s = %s, %v, want %s", modified, path, got, err, want)
+			}
+		}
+		if got, want := capped.Leaves().String(), plain.Leaves().String(); got != want {
+			t.Errorf("modified %v: Leaves() = %s, want %s", modified, got, want)
+		}
+	}
+
+	// The limit counts from the start of the query: the deepest value of
+	// the document is at depth 10, and at 9 below /list.
+	exact, _ := ParseWithOptions(src, ParseOptions{MaxRecursionDepth: 9})
+	if res := exact.Query("//id"); !errors.Is(res.Error(), core.ErrMaxDepthExceeded) {
+		t.Errorf("//id with a limit of 9 = %v, want ErrMaxDepthExceeded", res.Error())
+	}
+	if res := exact.Query("/list//id"); res.MatchCount() != 3 {
+		t.Errorf("/list//id with a limit of 9 = %v, want 3 matches", res.Error())
+	}
+}
@@ -0,0 +1,184 @@
+package engine
+
+import (
+	"strconv"
+	"strings"
+	"unicode/utf16"
+	"unicode/utf8"
+
+	"github.com/474420502/xjson/internal/core"
+)
+
+// Metrics measures the JSON text of the node, see jsonText.
+func (n *baseNode) Metrics() core.DocMetrics {
+	if n.err != nil {
+		return core.DocMetrics{}
+	}
+	return scanMetrics(n.jsonText())
+}
+
+// jsonText returns the JSON text of the node: the source bytes of an
+// unmodified container, which can be scanned without parsing them, or the
+// serialized form of anything else.
+func (n *baseNode) jsonText() []byte {
+	data, _ := nodeText(n.selfOrMe())
+	return data
+}
+
+// metricsFrame is an open container during scanMetrics. key is the raw key
+// of the current member of an object and index the current element of an
+// array, which locate the values below it.
+type metricsFrame struct {
+	object    bool
+	expectKey bool
+	key       []byte
+	index     int
+	count     int
+	start     int
+}
+
+// scanMetrics computes the metrics of the JSON value in data in a single
+// pass, keeping one frame per open container. Malformed input is skipped
+// over rather than reported.
+func scanMetrics(data []byte) core.DocMetrics {
+	var m core.DocMetrics
+	var stack []metricsFrame
+	bestStart := -1
+
+	// value records a value below the open containers.
+	value := func() {
+		m.Nodes++
+		if depth := len(stack) + 1; depth > m.MaxDepth {
+			m.MaxDepth = depth
+		}
+		if len(stack) > 0 {
+			if top := &stack[len(stack)-1]; !top.object {
+				top.index = top.count
+				top.count++
+			}
+		}
+	}
+
+	for pos := 0; pos < len(data); {
+		switch c := data[pos]; c {
+		case '{', '[':
+			value()
+			if c == '{' {
+				m.Objects++
+			} else {
+				m.Arrays++
+			}
+			stack = append(stack, metricsFrame{object: c == '{', expectKey: c == '{', start: pos})
+			pos++
+		case '}', ']':
+			if len(stack) > 0 {
+				top := stack[len(stack)-1]
+				stack = stack[:len(stack)-1]
+				if !top.object && (top.count > m.LargestArrayLen || top.count == m.LargestArrayLen && top.start < bestStart) {
+					m.LargestArrayLen = top.count
+					m.LargestArrayPath = metricsPath(stack)
+					bestStart = top.start
+				}
+			}
+			pos++
+		case ',':
+			if len(stack) > 0 && stack[len(stack)-1].object {
+				stack[len(stack)-1].expectKey = true
+			}
+			pos++
+		case '"':
+			end := findMatchingQuote(data, pos)
+			if end < 0 {
+				end = len(data) - 1
+			}
+			if len(stack) > 0 && stack[len(stack)-1].expectKey {
+				top := &stack[len(stack)-1]
+				top.key = data[pos+1 : end]
+				top.expectKey = false
+			} else {
+				value()
+				m.Strings++
+				m.TotalStringBytes += unescapedLen(data[pos+1 : end])
+			}
+			pos = end + 1
+		case 't', 'f', 'n':
+			value()
+			switch c {
+			case 't':
+				m.Bools++
+				pos += len("true")
+			case 'f':
+				m.Bools++
+				pos += len("false")
+			default:
+				m.Nulls++
+				pos += len("null")
+			}
+		case '-', '0', '1', '2', '3', '4', '5', '6', '7', '8', '9', 'I', 'N':
+			value()
+			m.Numbers++
+			pos = findValueEnd(data, pos) + 1
+		default:
+			pos++
+		}
+	}
+	return m
+}
+
+// metricsPath formats the path of the value the open containers of stack
+// currently lead to.
+func metricsPath(stack []metricsFrame) string {
+	var b strings.Builder
+	for _, f := range stack {
+		if f.object {
+			key, _ := rawKeyString(f.key)
+			b.WriteString("/" + formatPathKey(key))
+		} else {
+			b.WriteString("[" + strconv.Itoa(f.index) + "]")
+		}
+	}
+	return b.String()
+}
+
+// unescapedLen returns the length of the string body raw once unescaped.
+// An unpaired surrogate escape counts as U+FFFD, which unescape decodes it
+// to, and so does a malformed \u escape.
+func unescapedLen(raw []byte) int {
+	n := 0
+	for i := 0; i < len(raw); i++ {
+		if raw[i] != '\\' {
+			n++
+			continue
+		}
+		if i+1 >= len(raw) {
+			n++
+			break
+		}
+		if raw[i+1] != 'u' {
+			n++
+			i++
+			continue
+		}
+		r, ok := parseHex4(raw, i+2)
+		if !ok {
+			n += utf8.RuneLen(utf8.RuneError)
+			i++
+			continue
+		}
+		i += 5
+		if utf16.IsSurrogate(r) && i+6 < len(raw) && raw[i+1] == '\\' && raw[i+2] == 'u' {
+			if low, ok := parseHex4(raw, i+3); ok {
+				if pair := utf16.DecodeRune(r, low); pair != utf8.RuneError {
+					n += utf8.RuneLen(pair)
+					i += 6
+					continue
+				}
+			}
+		}
+		if utf16.IsSurrogate(r) {
+			r = utf8.RuneError
+		}
+		n += utf8.RuneLen(r)
+	}
+	return n
+}
@@ -0,0 +1,188 @@
+package engine
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/474420502/xjson/internal/core"
+)
+
+func TestMetrics(t *testing.T) {
+	cases := []struct {
+		doc  string
+		want core.DocMetrics
+	}{
+		{`{}`, core.DocMetrics{Nodes: 1, MaxDepth: 1, Objects: 1}},
+		{`[]`, core.DocMetrics{Nodes: 1, MaxDepth: 1, Arrays: 1}},
+		{`"héllo"`, core.DocMetrics{Nodes: 1, MaxDepth: 1, Strings: 1, TotalStringBytes: 6}},
+		{`-1.5e3`, core.DocMetrics{Nodes: 1, MaxDepth: 1, Numbers: 1}},
+		{`{"a":[1,2,3],"b":{"c d":[true,false,null,"x",[1,2,3,4]]}}`, core.DocMetrics{
+			Nodes: 16, MaxDepth: 5, Objects: 2, Arrays: 3, Strings: 1, Numbers: 7, Bools: 2, Nulls: 1,
+			TotalStringBytes: 1, LargestArrayLen: 5, LargestArrayPath: "/b/['c d']",
+		}},
+		{`[[1,2],[3,4]]`, core.DocMetrics{
+			Nodes: 7, MaxDepth: 3, Arrays: 3, Numbers: 4, LargestArrayLen: 2, LargestArrayPath: "",
+		}},
+		{`{"x":[[1,2],[3,4]],"k\"ey":{"]":"[,{","s":"😀\n"}}`, core.DocMetrics{
+			Nodes: 11, MaxDepth: 4, Objects: 2, Arrays: 3, Strings: 2, Numbers: 4,
+			TotalStringBytes: 3 + 5, LargestArrayLen: 2, LargestArrayPath: "/x",
+		}},
+	}
+	for _, tc := range cases {
+		root, err := ParseWithOptions([]byte(tc.doc), ParseOptions{})
+		if err != nil {
+			t.Fatalf("parse %s: %v", tc.doc, err)
+		}
+		if got := root.Metrics(); got != tc.want {
+			t.Errorf("Metrics(%s) =\n%+v, want\n%+v", tc.doc, got, tc.want)
+		}
+	}
+}
+
+// referenceMetrics counts the values of doc decoded by encoding/json.
+func referenceMetrics(t *testing.T, doc string) core.DocMetrics {
+	var v interface{}
+	if err := json.Unmarshal([]byte(doc), &v); err != nil {
+		t.Fatal(err)
+	}
+	var m core.DocMetrics
+	var walk func(v interface{}, depth int)
+	walk = func(v interface{}, depth int) {
+		m.Nodes++
+		if depth > m.MaxDepth {
+			m.MaxDepth = depth
+		}
+		switch x := v.(type) {
+		case map[string]interface{}:
+			m.Objects++
+			for _, child := range x {
+				walk(child, depth+1)
+			}
+		case []interface{}:
+			m.Arrays++
+			if len(x) > m.LargestArrayLen {
+				m.LargestArrayLen = len(x)
+			}
+			for _, child := range x {
+				walk(child, depth+1)
+			}
+		case string:
+			m.Strings++
+			m.TotalStringBytes += len(x)
+		case float64:
+			m.Numbers++
+		case bool:
+			m.Bools++
+		case nil:
+			m.Nulls++
+		}
+	}
+	walk(v, 1)
+	return m
+}
+
+func TestMetricsMatchesDecodedValueInEveryState(t *testing.T) {
+	docs := []string{
+		`{"store":{"book":[{"title":"Go \"in\" Action","price":8.5,"tags":["go","lang"]},{"title":"naïve","price":12,"tags":[]}],"open":true,"owner":null}}`,
+		deepChain(200),
+		`[1,[2,[3,[4,[5,[6]]]]],{"a":{"b":{"c":[]}}}]`,
+	}
+	for _, doc := range docs {
+		want := referenceMetrics(t, doc)
+
+		root, err := ParseWithOptions([]byte(doc), ParseOptions{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		lazy := root.Metrics()
+		if path := lazy.LargestArrayPath; lazy.LargestArrayLen > 0 && !root.Query(path).IsValid() && path != "" {
+			t.Errorf("LargestArrayPath %q does not resolve", path)
+		}
+		lazy.LargestArrayPath = ""
+		if lazy != want {
+			t.Errorf("unparsed Metrics =\n%+v, want\n%+v", lazy, want)
+		}
+
+		// Fully parse every value.
+		root.Query("..*").Len()
+		full := root.Metrics()
+		full.LargestArrayPath = ""
+		if full != want {
+			t.Errorf("materialized Metrics =\n%+v, want\n%+v", full, want)
+		}
+
+		// Edit the document and restore it, so it is reserialized.
+		edited, err := ParseWithOptions([]byte(doc), ParseOptions{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		switch edited.Type() {
+		case core.Object:
+			edited.Set("tmp", 1)
+			edited.Delete("tmp")
+		case core.Array:
+			edited.Append(1)
+			edited.Delete(fmt.Sprint(edited.Len() - 1))
+		}
+		if got := edited.Metrics(); got != root.Metrics() {
+			t.Errorf("edited Metrics =\n%+v, want\n%+v", got, root.Metrics())
+		}
+	}
+}
+
+func TestMetricsOfSubtreesAndInvalidNodes(t *testing.T) {
+	root, err := ParseWithOptions([]byte(`{"a":{"list":[1,2,3]},"b":"xy"}`), ParseOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := core.DocMetrics{Nodes: 5, MaxDepth: 3, Objects: 1, Arrays: 1, Numbers: 3, LargestArrayLen: 3, LargestArrayPath: "/list"}
+	if got := root.Get("a").Metrics(); got != want {
+		t.Errorf("subtree Metrics = %+v, want %+v", got, want)
+	}
+	if got := root.Get("b").Metrics(); got.Strings != 1 || got.TotalStringBytes != 2 {
+		t.Errorf("string Metrics = %+v", got)
+	}
+	if got := root.Get("missing").Metrics(); got != (core.DocMetrics{}) {
+		t.Errorf("invalid node Metrics = %+v, want zero", got)
+	}
+}
+
+// deepChain returns depth nested single-key objects around a number.
+func deepChain(depth int) string {
+	return strings.Repeat(`{"k":`, depth) + "1" + strings.Repeat("}", depth)
+}
+
+// BenchmarkMetrics measures the pass over documents of growing size; ns/op
+// grows linearly with the input, MB/s stays flat, and allocations only
+// depend on the nesting depth.
+func BenchmarkMetrics(b *testing.B) {
+	item := `{"id":1,"name":"item","tags":["a","b","c"],"price":9.5,"ok":true,"meta":{"x":null}},`
+	for _, n := range []int{100, 1000, 10000} {
+		doc := []byte("[" + strings.Repeat(item, n) + "1]")
+		root, err := ParseWithOptions(doc, ParseOptions{})
+		if err != nil {
+			b.Fatal(err)
+		}
+		b.Run(fmt.Sprintf("items=%d", n), func(b *testing.B) {
+			b.SetBytes(int64(len(doc)))
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				root.Metrics()
+			}
+		})
+	}
+	for _, depth := range []int{10, 100, 1000} {
+		root, err := ParseWithOptions([]byte(deepChain(depth)), ParseOptions{})
+		if err != nil {
+			b.Fatal(err)
+		}
+		b.Run(fmt.Sprintf("depth=%d", depth), func(b *testing.B) {
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				root.Metrics()
+			}
+		})
+	}
+}
@@ -0,0 +1,128 @@
+package engine
+
+import (
+	"sync/atomic"
+
+	"github.com/474420502/xjson/internal/core"
+)
+
+// MustBehavior selects what MustQuery and the Must* conversions do when they
+// fail.
+type MustBehavior uint32
+
+const (
+	// MustPanics panics with the *core.PathError. It is the default.
+	MustPanics MustBehavior = iota
+	// MustReturnsZero returns the zero value of the result, or an invalid
+	// node for MustQuery, and records the *core.PathError as the LastError
+	// of the node the call was made on.
+	MustReturnsZero
+)
+
+// mustBehavior holds the MustBehavior of the nodes of every document that
+// has none of its own, see SetDocumentMustBehavior.
+var mustBehavior atomic.Uint32
+
+// SetMustBehavior sets the behavior of the Must* methods of the nodes of
+// every document without a behavior of its own and returns the previous
+// one. It is safe to call while nodes are in use.
+func SetMustBehavior(b MustBehavior) MustBehavior {
+	return MustBehavior(mustBehavior.Swap(uint32(b)))
+}
+
+// CurrentMustBehavior returns the behavior set by SetMustBehavior.
+func CurrentMustBehavior() MustBehavior {
+	return MustBehavior(mustBehavior.Load())
+}
+
+// SetDocumentMustBehavior sets the behavior of the Must* methods of the
+// document node belongs to, in place of the one set by SetMustBehavior, and
+// returns the previous behavior of the document. Its nodes, the nodes
+// derived from them and the invalid nodes their Get, Index and Query
+// lookups return all follow it, as does a Detach copy. An invalid node
+// belongs to no document and keeps the behavior it has.
+func SetDocumentMustBehavior(node core.Node, b MustBehavior) MustBehavior {
+	bn := nodeBase(node)
+	if bn == nil || bn.err != nil {
+		return MustBehaviorOf(node)
+	}
+	root := bn.mustRoot()
+	if prev := root.mustBehavior.Swap(uint32(b) + 1); prev != 0 {
+		return MustBehavior(prev - 1)
+	}
+	return CurrentMustBehavior()
+}
+
+// MustBehaviorOf returns the behavior the Must* methods of node follow: that
+// of its document, or the one set by SetMustBehavior.
+func MustBehaviorOf(node core.Node) MustBehavior {
+	if bn := nodeBase(node); bn != nil {
+		return bn.currentMustBehavior()
+	}
+	return CurrentMustBehavior()
+}
+
+// mustRoot returns the base of the root of the document n belongs to, which
+// holds its MustBehavior, or of the document an invalid node was looked up
+// in.
+func (n *baseNode) mustRoot() *baseNode {
+	if n.mustScope != nil {
+		return n.mustScope
+	}
+	if n.self != nil {
+		if root := nodeBase(documentRoot(n.self)); root != nil {
+			return root
+		}
+	}
+	return n
+}
+
+// currentMustBehavior returns the behavior of the document of n, or the one
+// set by SetMustBehavior.
+func (n *baseNode) currentMustBehavior() MustBehavior {
+	if b := n.mustRoot().mustBehavior.Load(); b != 0 {
+		return MustBehavior(b - 1)
+	}
+	return CurrentMustBehavior()
+}
+
+// scoped returns result, the result of a lookup on n. When that is an
+// invalid node and the document of n has a MustBehavior of its own, it is
+// an invalid node with the same error that follows that behavior instead:
+// invalid nodes may be shared, so result itself is left alone.
+func (n *baseNode) scoped(result core.Node) core.Node {
+	inv, ok := result.(*invalidNode)
+	if !ok || inv.mustScope != nil || n.err != nil {
+		return result
+	}
+	root := n.mustRoot()
+	if root.mustBehavior.Load() == 0 {
+		return result
+	}
+	scopedInv := newInvalidNode(inv.err).(*invalidNode)
+	scopedInv.mustScope = root
+	return scopedInv
+}
+
+// mustFail reports err from a Must* method of n: it panics, or records err
+// for LastError when the Must* methods return zero values.
+func (n *baseNode) mustFail(err *core.PathError) {
+	if n.currentMustBehavior() == MustPanics {
+		panic(err)
+	}
+	n.lastErr.Store(err)
+}
+
+// mustZero calls n.mustFail with err and returns the zero value of T.
+func mustZero[T any](n *baseNode, err *core.PathError) T {
+	n.mustFail(err)
+	var zero T
+	return zero
+}
+
+func (n *baseNode) LastError() error {
+	if err := n.lastErr.Load(); err != nil {
+		return err
+	}
+	return nil
+}
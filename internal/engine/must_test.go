@@ -0,0 +1,292 @@
+package engine
+
+import (
+	"errors"
+	"reflect"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/474420502/xjson/internal/core"
+)
+
+// runMustModes runs test once for each MustBehavior.
+func runMustModes(t *testing.T, test func(t *testing.T, mode MustBehavior)) {
+	for _, mode := range []MustBehavior{MustPanics, MustReturnsZero} {
+		name := "panics"
+		if mode == MustReturnsZero {
+			name = "returns-zero"
+		}
+		t.Run(name, func(t *testing.T) {
+			defer SetMustBehavior(SetMustBehavior(mode))
+			test(t, mode)
+		})
+	}
+}
+
+// mustFailure runs call, a Must* method of node that fails, and returns
+// the *core.PathError it panics with, or under MustReturnsZero the one it
+// records as the LastError of node after checking it returned the zero
+// value, an invalid node for MustQuery.
+func mustFailure(t *testing.T, mode MustBehavior, node core.Node, call func() interface{}) (pathErr *core.PathError) {
+	t.Helper()
+	if mode == MustPanics {
+		defer func() {
+			r := recover()
+			if r == nil {
+				t.Fatal("expected a panic")
+			}
+			err, ok := r.(error)
+			if !ok || !errors.As(err, &pathErr) {
+				t.Fatalf("expected a *core.PathError panic, got %T: %v", r, r)
+			}
+		}()
+		call()
+		return nil
+	}
+
+	got := call()
+	if result, ok := got.(core.Node); ok {
+		if result.IsValid() || !errors.As(result.Error(), &pathErr) {
+			t.Fatalf("expected an invalid node with a *core.PathError, got %v", result)
+		}
+	} else if v := reflect.ValueOf(got); v.IsValid() && !v.IsZero() {
+		t.Fatalf("expected the zero value, got %v", got)
+	}
+	err := node.LastError()
+	if err == nil {
+		t.Fatal("expected LastError to be set")
+	}
+	if !errors.As(err, &pathErr) {
+		t.Fatalf("expected a *core.PathError LastError, got %T: %v", err, err)
+	}
+	return pathErr
+}
+
+func TestMustQueryPanicsWithPath(t *testing.T) {
+	runMustModes(t, testMustQueryPanicsWithPath)
+}
+
+func testMustQueryPanicsWithPath(t *testing.T, mode MustBehavior) {
+	root, err := Parse([]byte(`{"server":{"port":8080,"host":"local","tags":[1,2]}}`))
+	if err != nil {
+		t.Fatalf("Parse failed: %v", err)
+	}
+
+	if got := root.MustQuery("/server/port").MustInt(); got != 8080 {
+		t.Fatalf("expected 8080, got %d", got)
+	}
+
+	pathErr := mustFailure(t, mode, root, func() interface{} { return root.MustQuery("/server/missing") })
+	if pathErr.Path != "/server/missing" || pathErr.Op != "MustQuery" {
+		t.Fatalf("unexpected panic value: %+v", pathErr)
+	}
+	if !strings.Contains(pathErr.Error(), "/server/missing") {
+		t.Fatalf("expected path in panic message, got %q", pathErr.Error())
+	}
+
+	pathErr = mustFailure(t, mode, root, func() interface{} { return root.MustQuery("/server/tags[?(@ > 5)]") })
+	if !errors.Is(pathErr, core.ErrNoMatches) {
+		t.Fatalf("expected ErrNoMatches for an empty filter, got %v", pathErr)
+	}
+
+	pathErr = mustFailure(t, mode, root, func() interface{} { return root.MustQuery("/server[") })
+	if pathErr.Path != "/server[" {
+		t.Fatalf("unexpected panic value for a bad path: %+v", pathErr)
+	}
+}
+
+func TestMustConversionsReportPathAndOp(t *testing.T) {
+	runMustModes(t, testMustConversionsReportPathAndOp)
+}
+
+func testMustConversionsReportPathAndOp(t *testing.T, mode MustBehavior) {
+	root, err := Parse([]byte(`{"server":{"port":"8080","ratio":1.5,"when":"soon","list":[{"n":1}]}}`))
+	if err != nil {
+		t.Fatalf("Parse failed: %v", err)
+	}
+
+	testCases := []struct {
+		op   string
+		path string
+		call func(core.Node) interface{}
+		want error
+	}{
+		{"MustInt", "/server/port", func(n core.Node) interface{} { return n.MustInt() }, core.ErrTypeAssertion},
+		{"MustFloat", "/server/port", func(n core.Node) interface{} { return n.MustFloat() }, core.ErrTypeAssertion},
+		{"MustBool", "/server/ratio", func(n core.Node) interface{} { return n.MustBool() }, core.ErrTypeAssertion},
+		{"MustString", "/server/list[0]/n", func(n core.Node) interface{} { return n.MustString() }, core.ErrTypeAssertion},
+		{"MustArray", "/server/list[0]", func(n core.Node) interface{} { return n.MustArray() }, core.ErrTypeAssertion},
+		{"MustAsMap", "/server/list", func(n core.Node) interface{} { return n.MustAsMap() }, core.ErrTypeAssertion},
+		{"MustInt", "/server/ratio", func(n core.Node) interface{} { return n.MustInt() }, core.ErrNotInteger},
+		{"MustTime", "/server/when", func(n core.Node) interface{} { return n.MustTime() }, nil},
+	}
+	for _, tc := range testCases {
+		node := root.Query(tc.path)
+		pathErr := mustFailure(t, mode, node, func() interface{} { return tc.call(node) })
+		if pathErr.Op != tc.op || pathErr.Path != tc.path {
+			t.Fatalf("%s on %s: unexpected panic value %+v", tc.op, tc.path, pathErr)
+		}
+		if !strings.Contains(pathErr.Error(), tc.path) || !strings.Contains(pathErr.Error(), tc.op) {
+			t.Fatalf("%s on %s: panic message %q lacks context", tc.op, tc.path, pathErr.Error())
+		}
+		if tc.want != nil && !errors.Is(pathErr, tc.want) {
+			t.Fatalf("%s on %s: expected %v, got %v", tc.op, tc.path, tc.want, pathErr.Err)
+		}
+	}
+
+	pathErr := mustFailure(t, mode, root, func() interface{} { return root.MustInt() })
+	if pathErr.Path != "/" {
+		t.Fatalf("expected root path, got %+v", pathErr)
+	}
+	missing := root.Get("missing")
+	pathErr = mustFailure(t, mode, missing, func() interface{} { return missing.MustInt() })
+	if pathErr.Path != "" || pathErr.Op != "MustInt" || pathErr.Err == nil {
+		t.Fatalf("unexpected panic value for an invalid node: %+v", pathErr)
+	}
+}
+
+func TestMustFailuresOnEveryNodeType(t *testing.T) {
+	runMustModes(t, testMustFailuresOnEveryNodeType)
+}
+
+func testMustFailuresOnEveryNodeType(t *testing.T, mode MustBehavior) {
+	root, err := Parse([]byte(`{"s":"text","n":1.5,"b":true,"z":null,"o":{"k":1},"a":[1,2]}`))
+	if err != nil {
+		t.Fatalf("Parse failed: %v", err)
+	}
+	broken := errors.New("broken")
+
+	ops := map[string]func(core.Node) interface{}{
+		"MustString": func(n core.Node) interface{} { return n.MustString() },
+		"MustFloat":  func(n core.Node) interface{} { return n.MustFloat() },
+		"MustInt":    func(n core.Node) interface{} { return n.MustInt() },
+		"MustBool":   func(n core.Node) interface{} { return n.MustBool() },
+		"MustTime":   func(n core.Node) interface{} { return n.MustTime() },
+		"MustArray":  func(n core.Node) interface{} { return n.MustArray() },
+		"MustAsMap":  func(n core.Node) interface{} { return n.MustAsMap() },
+	}
+	nodes := []struct {
+		name string
+		node core.Node
+		ok   []string
+	}{
+		{"string", root.Get("s"), []string{"MustString"}},
+		{"number", root.Get("n"), []string{"MustFloat"}},
+		{"bool", root.Get("b"), []string{"MustBool"}},
+		{"null", root.Get("z"), nil},
+		{"object", root.Get("o"), []string{"MustAsMap"}},
+		{"array", root.Get("a"), []string{"MustArray"}},
+		{"invalid", root.Get("missing"), nil},
+		{"shared invalid", sharedInvalidNode(), nil},
+		{"errored object", &objectNode{baseNode: baseNode{err: broken}}, nil},
+		{"errored array", &arrayNode{baseNode: baseNode{err: broken}}, nil},
+		{"errored string", &stringNode{baseNode: baseNode{err: broken}}, nil},
+	}
+	for _, tc := range nodes {
+		for op, call := range ops {
+			node := tc.node
+			if slices.Contains(tc.ok, op) {
+				call(node)
+				continue
+			}
+			pathErr := mustFailure(t, mode, node, func() interface{} { return call(node) })
+			if pathErr.Op != op {
+				t.Errorf("%s %s: unexpected error %+v", tc.name, op, pathErr)
+			}
+		}
+	}
+
+	fresh, err := Parse([]byte(`{"n":1}`))
+	if err != nil {
+		t.Fatalf("Parse failed: %v", err)
+	}
+	if fresh.Get("n").MustInt() != 1 || fresh.MustQuery("/n").MustFloat() != 1 {
+		t.Fatal("unexpected values")
+	}
+	if err := fresh.LastError(); err != nil {
+		t.Fatalf("expected no LastError after successful calls, got %v", err)
+	}
+	if err := fresh.Get("n").LastError(); err != nil {
+		t.Fatalf("expected no LastError after successful calls, got %v", err)
+	}
+}
+
+func TestMustReturnsZeroConcurrently(t *testing.T) {
+	defer SetMustBehavior(SetMustBehavior(MustReturnsZero))
+	root, err := Parse([]byte(`{"n":"x"}`))
+	if err != nil {
+		t.Fatalf("Parse failed: %v", err)
+	}
+	node := root.Get("n")
+
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 100; j++ {
+				SetMustBehavior(MustReturnsZero)
+				if node.MustInt() != 0 || node.LastError() == nil {
+					t.Error("expected a zero value and a LastError")
+					return
+				}
+			}
+		}()
+	}
+	wg.Wait()
+}
+
+func TestDocumentMustBehavior(t *testing.T) {
+	defer SetMustBehavior(SetMustBehavior(MustPanics))
+	quiet, _ := Parse([]byte(`{"a":{"n":"x"},"list":[1,{"n":2}]}`))
+	loud, _ := Parse([]byte(`{"a":{"n":"x"}}`))
+	if prev := SetDocumentMustBehavior(quiet.Get("a"), MustReturnsZero); prev != MustPanics {
+		t.Fatalf("previous behavior = %d, want the default MustPanics", prev)
+	}
+
+	lookups := map[string]core.Node{
+		"node":          quiet.Query("/a/n"),
+		"missing key":   quiet.Get("missing"),
+		"chained":       quiet.Get("missing").Get("deeper"),
+		"missing index": quiet.Get("list").Index(9),
+		"index":         quiet.Index(0),
+		"query":         quiet.Query("/a/missing"),
+		"query first":   quiet.QueryFirst("//missing"),
+		"must query":    quiet.MustQuery("/nowhere"),
+		"match set":     quiet.Query("//n"),
+		"match set key": quiet.Query("/list[*]").Get("missing"),
+		"detached":      quiet.Get("a").Detach().Get("n"),
+	}
+	for name, node := range lookups {
+		if got := MustBehaviorOf(node); got != MustReturnsZero {
+			t.Errorf("%s: behavior = %d, want MustReturnsZero", name, got)
+		}
+		if got := node.MustInt(); got != 0 || node.LastError() == nil {
+			t.Errorf("%s: MustInt = %d with LastError %v, want 0 and an error", name, got, node.LastError())
+		}
+	}
+
+	// The other document and the invalid nodes it returns keep the default.
+	for name, node := range map[string]core.Node{"node": loud.Query("/a/n"), "missing key": loud.Get("missing")} {
+		if got := MustBehaviorOf(node); got != MustPanics {
+			t.Errorf("other document %s: behavior = %d, want MustPanics", name, got)
+		}
+		mustFailure(t, MustPanics, node, func() interface{} { return node.MustInt() })
+	}
+	if prev := SetDocumentMustBehavior(quiet.Get("missing"), MustPanics); prev != MustReturnsZero {
+		t.Errorf("SetDocumentMustBehavior on an invalid node = %d, want the behavior it follows", prev)
+	}
+
+	// A document setting wins over the default either way.
+	SetMustBehavior(MustReturnsZero)
+	if prev := SetDocumentMustBehavior(loud, MustPanics); prev != MustReturnsZero {
+		t.Fatalf("previous behavior = %d, want the default MustReturnsZero", prev)
+	}
+	missing := loud.Get("missing")
+	mustFailure(t, MustPanics, missing, func() interface{} { return missing.MustString() })
+	if got := quiet.Get("missing").MustInt(); got != 0 {
+		t.Errorf("MustInt under MustReturnsZero = %d, want 0", got)
+	}
+}
@@ -0,0 +1,165 @@
+package engine
+
+import (
+	"encoding/json"
+	"math"
+	"testing"
+
+	"github.com/474420502/xjson/internal/core"
+)
+
+func TestDeleteObjectKeysAndArrayElements(t *testing.T) {
+	root, err := Parse([]byte(`{"a":{"x":1,"y":2},"b":[1,2,3],"c":"keep"}`))
+	if err != nil {
+		t.Fatalf("Parse failed: %v", err)
+	}
+
+	if res := root.Get("a").Delete("x"); !res.IsValid() {
+		t.Fatalf("Delete failed: %v", res.Error())
+	}
+	if res := root.Get("b").Delete("-1"); !res.IsValid() {
+		t.Fatalf("Delete with negative index failed: %v", res.Error())
+	}
+	if got := root.String(); got != `{"a":{"y":2},"b":[1,2],"c":"keep"}` {
+		t.Fatalf("unexpected document after deletes: %s", got)
+	}
+	if got := root.Get("a").Keys(); len(got) != 1 || got[0] != "y" {
+		t.Fatalf("unexpected keys after delete: %v", got)
+	}
+	if root.Query("/a/x").IsValid() {
+		t.Fatalf("deleted key must not be found by cached queries")
+	}
+
+	if res := root.Get("a").Delete("missing"); res.IsValid() {
+		t.Fatalf("expected error deleting a missing key")
+	}
+	if res := root.Get("b").Delete("5"); res.IsValid() {
+		t.Fatalf("expected error deleting out of range")
+	}
+	if res := root.Get("b").Delete("x"); res.IsValid() {
+		t.Fatalf("expected error for a non-numeric array index")
+	}
+	if res := root.Get("c").Delete("x"); res.IsValid() {
+		t.Fatalf("expected error deleting from a string")
+	}
+}
+
+func TestDeleteByPath(t *testing.T) {
+	root, err := Parse([]byte(`{"a":{"list":[{"id":1},{"id":2}]},"b":1}`))
+	if err != nil {
+		t.Fatalf("Parse failed: %v", err)
+	}
+
+	if res := root.DeleteByPath("/a/list[0]/id"); !res.IsValid() {
+		t.Fatalf("DeleteByPath failed: %v", res.Error())
+	}
+	if res := root.DeleteByPath("/a/list[1]"); !res.IsValid() {
+		t.Fatalf("DeleteByPath on index failed: %v", res.Error())
+	}
+	if got := root.String(); got != `{"a":{"list":[{}]},"b":1}` {
+		t.Fatalf("unexpected document: %s", got)
+	}
+
+	for _, path := range []string{"", "/missing/key", "/b[0]", "/a/list[*]", "/a/list[0:1]"} {
+		if res := root.DeleteByPath(path); res.IsValid() {
+			t.Fatalf("expected DeleteByPath(%q) to fail", path)
+		}
+	}
+	if got := root.String(); got != `{"a":{"list":[{}]},"b":1}` {
+		t.Fatalf("failed deletes must not modify the document: %s", got)
+	}
+}
+
+func TestMutationKeepsUnvisitedSiblings(t *testing.T) {
+	root, err := Parse([]byte(`{"a":{"x":1},"b":"two","c":[1,{"d":"q\"uote"}]}`))
+	if err != nil {
+		t.Fatalf("Parse failed: %v", err)
+	}
+
+	root.Get("a").Set("y", "new\nline")
+	root.Query("/c[1]").Set("e", true)
+	root.SetByPath("/c[0]", 9)
+
+	want := `{"a":{"x":1,"y":"new\nline"},"b":"two","c":[9,{"d":"q\"uote","e":true}]}`
+	if got := root.String(); got != want {
+		t.Fatalf("unexpected document:\n got %s\nwant %s", got, want)
+	}
+	reparsed, err := Parse([]byte(root.String()))
+	if err != nil {
+		t.Fatalf("serialized document must parse again: %v", err)
+	}
+	if got := reparsed.Query("/a/y").String(); got != "new\nline" {
+		t.Fatalf("unexpected round-tripped string: %q", got)
+	}
+}
+
+func TestWrittenNumbersKeepTheirSourceType(t *testing.T) {
+	testCases := []struct {
+		name  string
+		value interface{}
+		want  string
+	}{
+		{name: "int", value: 25, want: "25"},
+		{name: "int8", value: int8(-8), want: "-8"},
+		{name: "int32", value: int32(1 << 30), want: "1073741824"},
+		{name: "int64", value: int64(9007199254740993), want: "9007199254740993"},
+		{name: "uint64", value: uint64(18446744073709551615), want: "18446744073709551615"},
+		{name: "integral float", value: 25.0, want: "25"},
+		{name: "fractional float", value: 2.5, want: "2.5"},
+		{name: "float32", value: float32(0.1), want: "0.1"},
+		{name: "large float", value: 1e21, want: "1e+21"},
+		{name: "small float", value: 1e-7, want: "1e-7"},
+		{name: "json.Number", value: json.Number("12345678901234567890.50"), want: "12345678901234567890.50"},
+		{name: "json.Number exponent", value: json.Number("1E+400"), want: "1E+400"},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			root, err := Parse([]byte(`{"user":{"age":1},"scores":[1]}`))
+			if err != nil {
+				t.Fatalf("Parse failed: %v", err)
+			}
+			root.Get("user").Set("age", tc.value)
+			root.Get("user").Set("fresh", tc.value)
+			root.Get("scores").Append(tc.value)
+			root.Get("scores").Set("0", tc.value)
+
+			want := `{"user":{"age":` + tc.want + `,"fresh":` + tc.want + `},"scores":[` + tc.want + `,` + tc.want + `]}`
+			if got := root.String(); got != want {
+				t.Fatalf("got %s, want %s", got, want)
+			}
+			reparsed, err := Parse([]byte(root.String()))
+			if err != nil || reparsed.Query("/user/age").Raw() != tc.want {
+				t.Fatalf("expected %s to survive a round trip, got %v", tc.want, err)
+			}
+		})
+	}
+}
+
+func TestWrittenNumbersIntegerAccessAndRejects(t *testing.T) {
+	root, err := Parse([]byte(`{"scores":[]}`))
+	if err != nil {
+		t.Fatalf("Parse failed: %v", err)
+	}
+	root.Get("scores").Append(100)
+	if got := root.Query("/scores[0]"); got.Int() != 100 || got.Raw() != "100" {
+		t.Fatalf("expected integral storage, got %s", got.Raw())
+	}
+
+	mapped := root.Get("scores").Map(func(n core.Node) interface{} { return n.Float() / 4 })
+	if got := mapped.String(); got != "[25]" {
+		t.Fatalf("expected Map results to drop the decimal point when integral, got %s", got)
+	}
+
+	for _, bad := range []interface{}{json.Number("01"), json.Number("1."), json.Number("abc"), math.NaN(), math.Inf(1)} {
+		if res := NewNodeFromInterface(nil, bad, nil); res.IsValid() {
+			t.Fatalf("expected %v to be rejected, got %s", bad, res.String())
+		}
+	}
+	if res := root.Query("/scores").Set("0", math.NaN()); res.IsValid() {
+		t.Fatalf("expected NaN to be rejected on write")
+	}
+	if got := root.String(); !root.Query("/scores").IsValid() || got != `{"scores":[100]}` {
+		t.Fatalf("a rejected write changed the document: %s", got)
+	}
+}
@@ -0,0 +1,107 @@
+package engine
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+
+	"github.com/474420502/xjson/internal/core"
+)
+
+func TestBuildDocumentFromScratch(t *testing.T) {
+	root := NewObject()
+	root.Set("name", "shop")
+	root.Set("open", true)
+	root.Set("owner", nil)
+	root.Set("books", []interface{}{})
+	books := root.Get("books")
+	books.Append(map[string]interface{}{"title": "Go", "price": 30})
+	books.Append(map[string]interface{}{"title": "JSON", "price": 12.5})
+	books.Index(1).Set("tags", []interface{}{"data"})
+	books.Index(1).Get("tags").Append("text")
+	books.InsertAt(0, map[string]interface{}{"title": "Intro", "price": 5})
+	root.Set("address", map[string]interface{}{})
+	root.Get("address").Set("city", "Oslo")
+	root.Set("draft", 1)
+	root.Delete("draft")
+
+	want := `{"name":"shop","open":true,"owner":null,"books":[{"price":5,"title":"Intro"},{"price":30,"title":"Go"},{"price":12.5,"title":"JSON","tags":["data","text"]}],"address":{"city":"Oslo"}}`
+	got, err := root.Bytes()
+	if err != nil {
+		t.Fatalf("Bytes failed: %v", err)
+	}
+	if string(got) != want {
+		t.Fatalf("got  %s\nwant %s", got, want)
+	}
+	if !json.Valid(got) {
+		t.Fatalf("output is not valid JSON")
+	}
+
+	if got := root.Query("/books[?(@.price < 20)]/title").Strings(); !reflect.DeepEqual(got, []string{"Intro", "JSON"}) {
+		t.Errorf("filter on a built document = %v", got)
+	}
+	if got := root.Query("//title").Strings(); !reflect.DeepEqual(got, []string{"Intro", "Go", "JSON"}) {
+		t.Errorf("//title = %v", got)
+	}
+	tags := root.Query("/books[2]/tags")
+	if tags.Path() != "/books[2]/tags" || tags.Parent().Parent().Parent() != root {
+		t.Errorf("built nodes are not linked to their parents: %q", tags.Path())
+	}
+	if got := tags.Query("/address/city").String(); got != "Oslo" {
+		t.Errorf("absolute query from a built node = %q, want Oslo", got)
+	}
+
+	root.RegisterFunc("cheap", func(n core.Node) core.Node {
+		return n.Filter(func(b core.Node) bool { return b.Get("price").Float() < 10 })
+	})
+	if got := root.Query("/books[@cheap]/title").Strings(); !reflect.DeepEqual(got, []string{"Intro"}) {
+		t.Errorf("func on a built document = %v", got)
+	}
+	reparsed, err := Parse(got)
+	if err != nil {
+		t.Fatalf("Parse failed: %v", err)
+	}
+	if !Equal(reparsed, root) {
+		t.Errorf("the output reads back as %s", reparsed.Canonical())
+	}
+}
+
+func TestNewArrayAndFromValue(t *testing.T) {
+	arr := NewArray()
+	if got := arr.String(); got != "[]" || arr.Len() != 0 || arr.Type() != core.Array {
+		t.Fatalf("NewArray() = %s", got)
+	}
+	arr.Append(1)
+	arr.AppendAll("two", map[string]interface{}{"three": 3.0})
+	arr.SetIndex(0, 0)
+	if got := arr.String(); got != `[0,"two",{"three":3}]` {
+		t.Fatalf("built array = %s", got)
+	}
+	if got := arr.Query("/[2]/three").Int(); got != 3 {
+		t.Errorf("query on a built array = %d", got)
+	}
+	if got := NewObject().String(); got != "{}" {
+		t.Errorf("NewObject() = %s", got)
+	}
+
+	doc, err := FromValue(map[string]interface{}{
+		"id":    json.Number("12345678901234567890"),
+		"items": []interface{}{map[string]interface{}{"n": int64(1)}, "x", nil},
+	})
+	if err != nil {
+		t.Fatalf("FromValue failed: %v", err)
+	}
+	if got := doc.String(); got != `{"id":12345678901234567890,"items":[{"n":1},"x",null]}` {
+		t.Errorf("FromValue document = %s", got)
+	}
+	doc.Get("items").Index(0).Set("n", 2)
+	if got := doc.Query("/items[0]/n").Int(); got != 2 {
+		t.Errorf("write to a FromValue document = %d", got)
+	}
+	if scalar, err := FromValue("text"); err != nil || scalar.String() != "text" {
+		t.Errorf("FromValue(scalar) = %v, %v", scalar, err)
+	}
+	if _, err := FromValue(map[string]interface{}{"bad": struct{}{}}); err == nil {
+		t.Error("expected an error for an unsupported nested value")
+	}
+}
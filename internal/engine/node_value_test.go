@@ -0,0 +1,118 @@
+package engine
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/474420502/xjson/internal/core"
+)
+
+func TestNodeValueCycleDetected(t *testing.T) {
+	const doc = `{"a":{"b":{"v":1}},"list":[1,2]}`
+	writes := map[string]func(root core.Node) core.Node{
+		"Set self": func(root core.Node) core.Node {
+			a := root.Get("a")
+			return a.Set("self", a)
+		},
+		"Set root below": func(root core.Node) core.Node { return root.Query("/a/b").Set("loop", root) },
+		"Set through a map": func(root core.Node) core.Node {
+			return root.Query("/a/b").Set("loop", map[string]interface{}{"root": root})
+		},
+		"Set through a slice": func(root core.Node) core.Node {
+			return root.Query("/a/b").Set("loop", []interface{}{1, root.Get("a")})
+		},
+		"SetByPath":   func(root core.Node) core.Node { return root.SetByPath("/a/b/loop", root.Get("a")) },
+		"Append self": func(root core.Node) core.Node { return root.Get("list").Append(root.Get("list")) },
+		"AppendAll":   func(root core.Node) core.Node { return root.Get("list").AppendAll(3, root) },
+		"PrependAll":  func(root core.Node) core.Node { return root.Get("list").PrependAll(root) },
+		"InsertAt":    func(root core.Node) core.Node { return root.Get("list").InsertAt(1, root.Get("list")) },
+		"SetIndex":    func(root core.Node) core.Node { return root.Get("list").SetIndex(0, root) },
+		"SetValue ancestor": func(root core.Node) core.Node {
+			return root.Query("/list[0]").SetValue(root.Get("list"))
+		},
+		"SetValue root": func(root core.Node) core.Node { return root.Query("/a/b/v").SetValue(root) },
+	}
+	for name, write := range writes {
+		for parser, parse := range testParsers {
+			t.Run(name+"/"+parser, func(t *testing.T) {
+				root, err := parse([]byte(doc))
+				if err != nil {
+					t.Fatalf("parse failed: %v", err)
+				}
+				res := write(root)
+				if res.IsValid() || !errors.Is(res.Error(), core.ErrCycleDetected) {
+					t.Fatalf("write = %v, want ErrCycleDetected", res.Error())
+				}
+				if !root.IsValid() || root.String() != doc {
+					t.Errorf("document after the failed write = %s (%v), want %s", root.String(), root.Error(), doc)
+				}
+				if got := root.Query("/a/b/v").Int(); got != 1 {
+					t.Errorf("query after the failed write = %d, want 1", got)
+				}
+			})
+		}
+	}
+}
+
+func TestNodeValueIsAttached(t *testing.T) {
+	root, err := Parse([]byte(`{"user":{"name":"ann"},"items":[{},{}]}`))
+	if err != nil {
+		t.Fatalf("Parse failed: %v", err)
+	}
+	extra := NewObject()
+	extra.Set("k", 1)
+	if res := root.Set("extra", extra); !res.IsValid() {
+		t.Fatalf("Set(free node) failed: %v", res.Error())
+	}
+	extra.Set("k", 2)
+	if got := root.Query("/extra/k").Int(); got != 2 {
+		t.Errorf("edit of the written node shows %d in the document, want 2", got)
+	}
+	if extra.Path() != "/extra" || extra.Query("/user/name").String() != "ann" {
+		t.Errorf("written node is not linked into the tree: %q", extra.Path())
+	}
+
+	// A node has one place: one already in a document is written as a copy.
+	before := root.String()
+	for name, value := range map[string]interface{}{
+		"written node":  extra,
+		"document node": root.Get("user"),
+		"match set":     root.Query("//name"),
+		"invalid node":  root.Get("missing"),
+	} {
+		if res := root.Set("again", value); res.IsValid() {
+			t.Errorf("Set(%s) should fail", name)
+		}
+	}
+	if res := root.Query("/items[*]").Set("x", NewObject()); res.IsValid() {
+		t.Errorf("Set of a node on two matches should fail")
+	}
+	if got := root.String(); got != before {
+		t.Errorf("document after failed writes = %s, want %s", got, before)
+	}
+	if res := root.Set("again", root.Get("user").Detach()); !res.IsValid() {
+		t.Fatalf("Set(Detach()) failed: %v", res.Error())
+	}
+	root.Query("/again/name").SetValue("bob")
+	if got := root.Query("/user/name").String(); got != "ann" {
+		t.Errorf("copy edit changed the original: %q", got)
+	}
+}
+
+func TestNodeValueInMapAndFromValue(t *testing.T) {
+	src, _ := Parse([]byte(`{"id":7,"big":12345678901234567890}`))
+	doc, err := FromValue(map[string]interface{}{"src": src, "items": []interface{}{src.Get("big").Detach()}})
+	if err != nil {
+		t.Fatalf("FromValue failed: %v", err)
+	}
+	if got := doc.String(); got != `{"items":[12345678901234567890],"src":{"id":7,"big":12345678901234567890}}` {
+		t.Errorf("FromValue with nodes = %s", got)
+	}
+	if doc.Get("src") != src {
+		t.Errorf("FromValue did not attach the node")
+	}
+	mapped := doc.Get("items").MapElements(func(i int, elem core.Node) interface{} { return elem })
+	if got := mapped.String(); got != `12345678901234567890` {
+		t.Errorf("MapElements returning the element = %s", got)
+	}
+}
@@ -0,0 +1,104 @@
+package engine
+
+import (
+	"encoding/json"
+	"errors"
+	"math"
+	"testing"
+
+	"github.com/474420502/xjson/internal/core"
+)
+
+const overflowDoc = `{"big":1e309,"neg":-1e309,"tiny":1e-400,"ok":1.5}`
+
+func TestNumberOverflowKeepsText(t *testing.T) {
+	for name, parse := range testParsers {
+		root, err := parse([]byte(overflowDoc))
+		if err != nil {
+			t.Fatalf("%s: parse failed: %v", name, err)
+		}
+		root.Set("ok", 2.5)
+		want := `{"big":1e309,"neg":-1e309,"tiny":1e-400,"ok":2.5}`
+		if got := root.String(); got != want {
+			t.Errorf("%s: document = %s, want %s", name, got, want)
+		}
+		if b, err := root.Bytes(); err != nil || string(b) != want {
+			t.Errorf("%s: Bytes() = %s, %v, want %s", name, b, err, want)
+		}
+
+		for key, sign := range map[string]int{"big": 1, "neg": -1} {
+			n := root.Get(key)
+			if got := n.Float(); !math.IsInf(got, sign) {
+				t.Errorf("%s: %s Float() = %v, want the infinity of its sign", name, key, got)
+			}
+			if got := n.MustFloat(); !math.IsInf(got, sign) {
+				t.Errorf("%s: %s MustFloat() = %v, want the infinity of its sign", name, key, got)
+			}
+			var typeErr *core.TypeError
+			if f, err := n.TryFloat(); f != 0 || !errors.Is(err, core.ErrNumberOverflow) || !errors.As(err, &typeErr) {
+				t.Errorf("%s: %s TryFloat() = %v, %v, want a *TypeError wrapping ErrNumberOverflow", name, key, f, err)
+			}
+			if _, ok := n.RawFloat(); ok {
+				t.Errorf("%s: %s RawFloat() should report false", name, key)
+			}
+			if got, ok := n.Interface().(json.Number); !ok || string(got) != n.Raw() {
+				t.Errorf("%s: %s Interface() = %#v, want json.Number(%q)", name, key, n.Interface(), n.Raw())
+			}
+		}
+
+		tiny := root.Get("tiny")
+		if f, err := tiny.TryFloat(); f != 0 || err != nil {
+			t.Errorf("%s: 1e-400 TryFloat() = %v, %v, want 0 and no error", name, f, err)
+		}
+
+		// Values read out of the document go back in unchanged.
+		out, err := json.Marshal(root.Interface())
+		if err != nil {
+			t.Fatalf("%s: json.Marshal(Interface()) failed: %v", name, err)
+		}
+		copied, err := FromValue(root.Interface())
+		if err != nil || !Equal(copied, root) {
+			t.Errorf("%s: FromValue(Interface()) = %v, %v, from %s", name, copied, err, out)
+		}
+		root.Set("again", root.Get("big").Interface())
+		root.Set("copy", root.Get("neg").Detach())
+		if got := root.Query("/again").Raw() + " " + root.Query("/copy").Raw(); got != "1e309 -1e309" {
+			t.Errorf("%s: written back = %s, want 1e309 -1e309", name, got)
+		}
+	}
+}
+
+func TestNonFiniteWritesRejected(t *testing.T) {
+	writes := map[string]func(root core.Node, v interface{}) core.Node{
+		"Set":        func(root core.Node, v interface{}) core.Node { return root.Set("x", v) },
+		"Set new":    func(root core.Node, v interface{}) core.Node { return root.Set("new", v) },
+		"SetByPath":  func(root core.Node, v interface{}) core.Node { return root.SetByPath("/o/x", v) },
+		"SetValue":   func(root core.Node, v interface{}) core.Node { return root.Get("x").SetValue(v) },
+		"Append":     func(root core.Node, v interface{}) core.Node { return root.Get("a").Append(v) },
+		"array Set":  func(root core.Node, v interface{}) core.Node { return root.Get("a").Set("0", v) },
+		"SetIndex":   func(root core.Node, v interface{}) core.Node { return root.Get("a").SetIndex(0, v) },
+		"nested map": func(root core.Node, v interface{}) core.Node { return root.Set("m", map[string]interface{}{"v": v}) },
+		"nested arr": func(root core.Node, v interface{}) core.Node { return root.Get("a").Append([]interface{}{1, v}) },
+	}
+	values := []interface{}{math.Inf(1), math.Inf(-1), math.NaN(), float32(math.Inf(1))}
+	const doc = `{"x":1,"a":[1],"o":{}}`
+	for name, parse := range testParsers {
+		for op, write := range writes {
+			for _, v := range values {
+				root, err := parse([]byte(doc))
+				if err != nil {
+					t.Fatalf("%s: parse failed: %v", name, err)
+				}
+				res := write(root, v)
+				if res.IsValid() {
+					t.Errorf("%s: %s of %v should fail", name, op, v)
+				} else if f, _ := v.(float64); math.IsInf(f, 0) && !errors.Is(res.Error(), core.ErrNumberOverflow) {
+					t.Errorf("%s: %s of %v = %v, want ErrNumberOverflow", name, op, v, res.Error())
+				}
+				if got, err := root.Bytes(); err != nil || string(got) != doc {
+					t.Errorf("%s: %s of %v left %s, %v, want %s", name, op, v, got, err, doc)
+				}
+			}
+		}
+	}
+}
@@ -0,0 +1,157 @@
+package engine
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/474420502/xjson/internal/core"
+)
+
+const numericKeysDoc = `{"0":"zero","1":"one","2":[[1,2],[3,4]],"list":[{"2":"two"},["a","b","c"]],"m":{"10":{"0":[7]}}}`
+
+func TestNumericSegmentsFollowTheValueType(t *testing.T) {
+	lazy, err := Parse([]byte(numericKeysDoc))
+	if err != nil {
+		t.Fatalf("Parse failed: %v", err)
+	}
+	eager, err := MustParse([]byte(numericKeysDoc))
+	if err != nil {
+		t.Fatalf("MustParse failed: %v", err)
+	}
+	cases := []struct{ path, want string }{
+		{"/0", "zero"},
+		{"/1", "one"},
+		{"[0]", "zero"},
+		{"/['0']", "zero"},
+		{"/2/1/0", "3"},
+		{"/2[1][0]", "3"},
+		{"/['2'][1]/1", "4"},
+		{"/list/0/2", "two"},
+		{"/list/1/2", "c"},
+		{"/list[1][-1]", "c"},
+		{"/m/10/0/0", "7"},
+		{"/m/10/0/0/..", "[7]"},
+		{"/2/1[1:]", "[4]"},
+	}
+	for _, tc := range cases {
+		for name, root := range map[string]core.Node{"lazy": lazy, "eager": eager} {
+			if got := root.Query(tc.path); got.String() != tc.want {
+				t.Errorf("%s: %s = %q (%v), want %q", name, tc.path, got.String(), got.Error(), tc.want)
+			}
+			compiled, err := CompileQuery(tc.path)
+			if err != nil {
+				t.Fatalf("CompileQuery(%s) failed: %v", tc.path, err)
+			}
+			if got := compiled.Query(root); got.String() != tc.want {
+				t.Errorf("%s: compiled %s = %q (%v), want %q", name, tc.path, got.String(), got.Error(), tc.want)
+			}
+		}
+	}
+
+	// Out of range and missing keys still fail.
+	for _, path := range []string{"/3", "/list/2", "/2/5", "/list/0/0"} {
+		if got := lazy.Query(path); got.IsValid() {
+			t.Errorf("%s = %s, want an invalid node", path, got.String())
+		}
+	}
+	if got := lazy.Query("/0/0"); !errors.Is(got.Error(), core.ErrTypeAssertion) {
+		t.Errorf("/0/0 on a string = %v, want ErrTypeAssertion", got.Error())
+	}
+	// On a match set an index picks a match, as always.
+	if got := lazy.Query("/list/*/1").String(); got != `["a","b","c"]` {
+		t.Errorf("/list/*/1 = %s, want the second match", got)
+	}
+}
+
+func TestNumericPathsRoundTrip(t *testing.T) {
+	root, err := Parse([]byte(numericKeysDoc))
+	if err != nil {
+		t.Fatalf("Parse failed: %v", err)
+	}
+	var paths []string
+	root.Query("//*").ForEachPath(func(path string, value core.Node) bool {
+		paths = append(paths, path)
+		if got := root.Query(path); got.Raw() != value.Raw() {
+			t.Errorf("Query(%s) = %s, want %s", path, got.Raw(), value.Raw())
+		}
+		return true
+	})
+	if len(paths) != 20 {
+		t.Fatalf("//* found %d paths: %v", len(paths), paths)
+	}
+
+	// Every path written with slashes, as ScanPaths and logs spell them,
+	// reaches the same value.
+	var slashedPaths []string
+	for _, path := range paths {
+		slashed := strings.NewReplacer("/['", "/", "['", "/", "']", "", "[", "/", "]", "").Replace(path)
+		if got, want := root.Query(slashed).Raw(), root.Query(path).Raw(); got != want {
+			t.Errorf("Query(%s) = %s, want %s as for %s", slashed, got, want, path)
+		}
+		slashedPaths = append(slashedPaths, slashed)
+	}
+
+	for _, path := range append(paths, slashedPaths...) {
+		doc, _ := Parse([]byte(numericKeysDoc))
+		if res := doc.SetByPath(path, "x"); !res.IsValid() {
+			t.Errorf("SetByPath(%s) failed: %v", path, res.Error())
+		} else if got := doc.Query(path).String(); got != "x" {
+			t.Errorf("after SetByPath(%s) the value is %s", path, got)
+		}
+		doc, _ = MustParse([]byte(numericKeysDoc))
+		before := doc.Query(path).Parent().Len()
+		if res := doc.DeleteByPath(path); !res.IsValid() {
+			t.Errorf("DeleteByPath(%s) failed: %v", path, res.Error())
+		} else if parent := doc.Query(path + "/.."); parent.IsValid() && parent.Len() != before-1 {
+			t.Errorf("DeleteByPath(%s) left %d values in the parent, want %d", path, parent.Len(), before-1)
+		}
+	}
+
+	doc, _ := Parse([]byte(numericKeysDoc))
+	if res := doc.DeleteByPath("/1"); !res.IsValid() || doc.Get("1").IsValid() {
+		t.Errorf("DeleteByPath(/1) = %v, want the key \"1\" removed", res.Error())
+	}
+	if res := doc.DeleteByPath("/0/0"); res.IsValid() {
+		t.Error("DeleteByPath(/0/0) on a string should fail")
+	}
+	if res := doc.AppendByPath("/m/10/0", 8); !res.IsValid() || doc.Query("/m/10/0").String() != "[7,8]" {
+		t.Errorf("AppendByPath(/m/10/0) = %v, %s", res.Error(), doc.Query("/m/10/0").String())
+	}
+	if err := ExtendArray(doc, "Append", "/2/0", []interface{}{9}, false, false); err != nil || doc.Query("/2/0").String() != "[1,2,9]" {
+		t.Errorf("ExtendArray(/2/0) = %v, %s", err, doc.Query("/2/0").String())
+	}
+	if _, err := followPath(doc, "Append", "/m/11"); !errors.Is(err, core.ErrNotFound) || !strings.Contains(err.Error(), `key "11"`) {
+		t.Errorf("followPath(/m/11) = %v, want a missing key \"11\"", err)
+	}
+}
+
+func TestNumericStepsElsewhere(t *testing.T) {
+	root, err := Parse([]byte(numericKeysDoc))
+	if err != nil {
+		t.Fatalf("Parse failed: %v", err)
+	}
+	matches, err := ExpandPath(root, "/m/10/0/0")
+	if err != nil || len(matches) != 1 || matches[0].Path != "/m/['10']/['0'][0]" || matches[0].Node.Int() != 7 {
+		t.Errorf("ExpandPath(/m/10/0/0) = %+v, %v", matches, err)
+	}
+	if got := root.Query("/list[?(@[2] == 'two' || @[2] == 'c')]").MatchCount(); got != 2 {
+		t.Errorf("filter on @[2] matched %d elements, want 2", got)
+	}
+
+	out, err := root.BytesWith(core.SerializeOptions{Redact: []string{"/1", "/list/1/0", "/m/10/0"}})
+	want := `{"0":"zero","1":"[REDACTED]","2":[[1,2],[3,4]],"list":[{"2":"two"},["[REDACTED]","b","c"]],"m":{"10":{"0":"[REDACTED]"}}}`
+	if err != nil || string(out) != want {
+		t.Errorf("BytesWith = %s, %v, want %s", out, err, want)
+	}
+
+	var found []string
+	if err := ScanPaths([]byte(numericKeysDoc), []string{"1", "2.1.0", "list.1.2", "list[0].2", "m.10.0.0", "list.01"}, func(path string, raw []byte) {
+		found = append(found, path+"="+string(raw))
+	}); err != nil {
+		t.Fatalf("ScanPaths failed: %v", err)
+	}
+	if got, want := strings.Join(found, " "), `1="one" 2.1.0=3 list[0].2="two" list.1.2="c" m.10.0.0=7`; got != want {
+		t.Errorf("ScanPaths found %s, want %s", got, want)
+	}
+}
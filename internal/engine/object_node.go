@@ -31,7 +31,10 @@ type objectNode struct {
 	rawScanPos  int
 	rawDone     bool
 	sortedKeys  []string
+	keyOrder    []string
 	isDirty     bool
+	// mods counts writes to the members, so iterators notice them.
+	mods uint64
 }
 
 func (n *objectNode) rebuildInlineEntries() {
@@ -81,7 +84,7 @@ func (n *objectNode) Get(key string) core.Node {
 		if child, ok := n.value[key]; ok {
 			return child
 		}
-		return sharedInvalidNode()
+		return n.scoped(sharedInvalidNode())
 	}
 	n.mu.Lock()
 	child, found, ok := fastScanObjectChildLocked(n, key)
@@ -90,13 +93,37 @@ func (n *objectNode) Get(key string) core.Node {
 		if found {
 			return child
 		}
-		return sharedInvalidNode()
+		return n.scoped(sharedInvalidNode())
 	}
 	n.lazyParsePath([]string{key})
 	if child, ok := n.value[key]; ok {
 		return child
 	}
-	return sharedInvalidNode()
+	return n.scoped(sharedInvalidNode())
+}
+
+// HasKey reports whether key is a member, scanning the raw members like Get
+// does but without building the value.
+func (n *objectNode) HasKey(key string) bool {
+	if n.err != nil {
+		return false
+	}
+	if n.parsed.Load() || len(n.raw) == 0 {
+		if _, ok := n.lookupInlineChild(key); ok {
+			return true
+		}
+		_, ok := n.value[key]
+		return ok
+	}
+	n.mu.Lock()
+	found, ok := scanObjectKeyLocked(n, key)
+	n.mu.Unlock()
+	if ok {
+		return found
+	}
+	n.lazyParsePath([]string{key})
+	_, found = n.value[key]
+	return found
 }
 
 // GetWithPath gets a child node with path information for lazy loading
@@ -128,105 +155,12 @@ func (n *objectNode) LazyGet(key string) core.Node {
 	return sharedInvalidNode()
 }
 
-// 辅助函数：查找匹配的大括号
-func findMatchingBrace(data []byte, start int) int {
-	if start >= len(data) || data[start] != '{' {
-		return -1
-	}
-
-	level := 1
-	for i := start + 1; i < len(data); i++ {
-		switch data[i] {
-		case '{':
-			level++
-		case '}':
-			level--
-			if level == 0 {
-				return i
-			}
-		case '"':
-			// 跳过字符串中的内容
-			for j := i + 1; j < len(data); j++ {
-				if data[j] == '"' && (j == 0 || data[j-1] != '\\') {
-					i = j
-					break
-				}
-			}
-		}
-	}
-
-	return -1
-}
-
-// 辅助函数：查找匹配的方括号
-func findMatchingBracket(data []byte, start int) int {
-	if start >= len(data) || data[start] != '[' {
-		return -1
-	}
-
-	level := 1
-	for i := start + 1; i < len(data); i++ {
-		switch data[i] {
-		case '[':
-			level++
-		case ']':
-			level--
-			if level == 0 {
-				return i
-			}
-		case '"':
-			// 跳过字符串中的内容
-			for j := i + 1; j < len(data); j++ {
-				if data[j] == '"' && (j == 0 || data[j-1] != '\\') {
-					i = j
-					break
-				}
-			}
-		}
-	}
-
-	return -1
-}
-
-// 辅助函数：查找匹配的引号
-func findMatchingQuote(data []byte, start int) int {
-	if start >= len(data) || data[start] != '"' {
-		return -1
-	}
-
-	for i := start + 1; i < len(data); i++ {
-		if data[i] == '"' && data[i-1] != '\\' {
-			return i
-		}
-	}
-
-	return -1
-}
-
-// 辅助函数：查找值的结束位置
-func findValueEnd(data []byte, start int) int {
-	for i := start; i < len(data); i++ {
-		switch data[i] {
-		case ' ', '\t', '\n', '\r', ',', '}', ']':
-			return i - 1
-		}
-	}
-	return len(data) - 1
-}
-
 func (n *objectNode) ForEach(fn func(keyOrIndex interface{}, value core.Node)) {
 	if n.err != nil {
 		return
 	}
 	n.lazyParse()
-	if n.sortedKeys == nil {
-		keys := make([]string, 0, len(n.value))
-		for k := range n.value {
-			keys = append(keys, k)
-		}
-		sort.Strings(keys)
-		n.sortedKeys = keys
-	}
+	n.ensureSortedKeys()
 
 	for _, k := range n.sortedKeys {
 		fn(k, n.value[k])
@@ -241,51 +175,75 @@ func (n *objectNode) Set(key string, value interface{}) core.Node {
 	if n.value == nil {
 		n.value = make(map[string]core.Node)
 	}
+	n.ensureSortedKeys()
 	n.isDirty = true // Mark as dirty so String() will regenerate
+	n.mods++
 
 	// Also mark all ancestors as dirty to ensure String() regeneration
-	current := n.parent
-	for current != nil {
-		if obj, ok := current.(*objectNode); ok {
-			obj.isDirty = true
-			current = obj.parent
-		} else if arr, ok := current.(*arrayNode); ok {
-			arr.isDirty = true
-			current = arr.parent
-		} else {
-			break
-		}
-	}
+	markAncestorNodesDirty(n.parent)
 
 	// Clear query cache since we're modifying the node
 	n.baseNode.clearQueryCache()
 
-	// Update sorted keys
-	found := false
-	for _, k := range n.sortedKeys {
-		if k == key {
-			found = true
-			break
-		}
-	}
-	if !found {
-		n.sortedKeys = append(n.sortedKeys, key)
-		sort.Strings(n.sortedKeys)
-	}
-
-	if existing, exists := n.value[key]; exists && tryMutateScalarNode(existing, value) {
+	existing, exists := n.value[key]
+	if exists && tryMutateScalarNode(existing, value) {
 		n.rebuildInlineEntries()
+		n.logKeyEdit(key)
 		return n
 	}
 
+	// Convert before touching the keys, so that a value that cannot be
+	// written, such as this object or one of its ancestors, leaves them as
+	// they were.
 	child := NewNodeFromInterface(n, value, n.funcs)
 	if !child.IsValid() {
-		n.setError(child.Error())
-		return n
+		return newInvalidNode(child.Error())
+	}
+	if exists {
+		detach(existing)
+	} else {
+		n.sortedKeys = append(n.sortedKeys, key)
+		sort.Strings(n.sortedKeys)
+		n.keyOrder = append(n.keyOrder, key)
 	}
 	n.value[key] = child
 	n.rebuildInlineEntries()
+	n.logKeyEdit(key)
+
+	return n
+}
+
+// Delete removes key from the object. Deleting a missing key yields an
+// invalid node and leaves the object untouched.
+func (n *objectNode) Delete(key string) core.Node {
+	if n.err != nil {
+		return n
+	}
+	n.lazyParse()
+	if _, exists := n.value[key]; !exists {
+		return newInvalidNode(fmt.Errorf("key not found: %s", key))
+	}
+	n.isDirty = true
+	n.mods++
+	markAncestorNodesDirty(n.parent)
+	n.baseNode.clearQueryCache()
+	n.logKeyEdit(key)
 
+	detach(n.value[key])
+	delete(n.value, key)
+	for i, k := range n.sortedKeys {
+		if k == key {
+			n.sortedKeys = append(n.sortedKeys[:i:i], n.sortedKeys[i+1:]...)
+			break
+		}
+	}
+	for i, k := range n.keyOrder {
+		if k == key {
+			n.keyOrder = append(n.keyOrder[:i:i], n.keyOrder[i+1:]...)
+			break
+		}
+	}
+	n.rebuildInlineEntries()
 	return n
 }
 
@@ -294,6 +252,43 @@ func (n *objectNode) SetByPath(path string, value interface{}) core.Node {
 	return n.baseNode.SetByPath(path, value)
 }
 
+// ensureSortedKeys builds the sorted key list from the materialized children
+// when it is missing or out of step with them.
+func (n *objectNode) ensureSortedKeys() {
+	if n.sortedKeys != nil && len(n.sortedKeys) == len(n.value) {
+		return
+	}
+	keys := make([]string, 0, len(n.value))
+	for k := range n.value {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	n.sortedKeys = keys
+}
+
+// documentKeys returns the keys in document order: parsed keys in source
+// order followed by keys added later with Set. Objects without a source,
+// such as ones built from a Go map, list their keys sorted.
+func (n *objectNode) documentKeys() []string {
+	n.lazyParse()
+	if len(n.keyOrder) == len(n.value) {
+		return n.keyOrder
+	}
+	n.ensureSortedKeys()
+	keys := make([]string, 0, len(n.value))
+	seen := make(map[string]bool, len(n.value))
+	for _, list := range [][]string{n.keyOrder, n.sortedKeys} {
+		for _, k := range list {
+			if _, ok := n.value[k]; ok && !seen[k] {
+				seen[k] = true
+				keys = append(keys, k)
+			}
+		}
+	}
+	n.keyOrder = keys
+	return keys
+}
+
 // 新增辅助方法来避免重复代码
 func (n *objectNode) containsKey(key string) bool {
 	if n.sortedKeys == nil {
@@ -307,70 +302,98 @@ func (n *objectNode) containsKey(key string) bool {
 	return false
 }
 
+// AsMap returns a copy of the members, so that a caller adding or deleting
+// keys cannot put the map out of step with the object.
 func (n *objectNode) AsMap() map[string]core.Node {
 	if n.err != nil {
 		return nil
 	}
-	n.lazyParse()
-	n.rebuildInlineEntries()
-	return n.value
+	return copyMembers(n.UnsafeMap())
 }
 
 func (n *objectNode) MustAsMap() map[string]core.Node {
 	if n.err != nil {
-		panic(n.err)
+		n.mustFail(mustError(n, "MustAsMap", n.err))
+		return nil
+	}
+	return copyMembers(n.UnsafeMap())
+}
+
+// UnsafeMap returns the members without copying them.
+func (n *objectNode) UnsafeMap() map[string]core.Node {
+	if n.err != nil {
+		return nil
 	}
 	n.lazyParse()
 	n.rebuildInlineEntries()
 	return n.value
 }
 
-func (n *objectNode) String() string {
-	if n.err != nil {
-		return ""
+func copyMembers(members map[string]core.Node) map[string]core.Node {
+	if members == nil {
+		return nil
 	}
-	n.lazyParse()
-	if !n.isDirty && n.Raw() != "" {
-		// Check if any child node is dirty
-		hasDirtyChild := false
-		for _, child := range n.value {
-			switch c := child.(type) {
-			case *objectNode:
-				if c.isDirty {
-					hasDirtyChild = true
-					break
-				}
-			case *arrayNode:
-				if c.isDirty {
-					hasDirtyChild = true
-					break
-				}
-			}
-		}
+	out := make(map[string]core.Node, len(members))
+	for k, v := range members {
+		out[k] = v
+	}
+	return out
+}
 
-		if !hasDirtyChild {
-			return n.Raw()
+// isPristine reports whether the object still matches its source bytes: it
+// has not been written to and none of its cached children has been either.
+func (n *objectNode) isPristine() bool {
+	if n.err != nil || n.isDirty || len(n.raw) == 0 {
+		return false
+	}
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	for _, child := range n.value {
+		if isDirtyContainer(child) {
+			return false
 		}
 	}
+	return true
+}
 
-	var buf bytes.Buffer
-	buf.WriteByte('{')
-	if n.sortedKeys == nil {
-		keys := make([]string, 0, len(n.value))
-		for k := range n.value {
-			keys = append(keys, k)
-		}
-		sort.Strings(keys)
-		n.sortedKeys = keys
+// Bytes encodes the object. An unmodified object returns a copy of its
+// source bytes without parsing them; a modified one keeps the source text of
+// everything that was not written to.
+func (n *objectNode) Bytes() ([]byte, error) {
+	data, err := n.text()
+	if err == nil {
+		err = finiteText(&n.baseNode, data)
 	}
-	for i, k := range n.sortedKeys {
-		if i > 0 {
-			buf.WriteByte(',')
-		}
-		buf.WriteString(fmt.Sprintf("%q:%s", k, n.value[k].String()))
+	if err != nil {
+		return nil, err
 	}
-	buf.WriteByte('}')
-	return buf.String()
+	return bytes.Clone(data), nil
+}
+
+func (n *objectNode) String() string {
+	data, err := n.text()
+	if err != nil || finiteText(&n.baseNode, data) != nil {
+		return ""
+	}
+	return string(data)
+}
+
+// text returns the encoding of the object, which is its source while it is
+// unmodified and must then not be changed. Unlike Bytes it keeps the
+// non-finite numbers of a document parsed with AllowNonFinite.
+func (n *objectNode) text() ([]byte, error) {
+	if n.err != nil {
+		return nil, n.err
+	}
+	if n.isPristine() {
+		return n.RawBytes(), nil
+	}
+	buf := newSpliceBuffer(n.RawBytes())
+	n.writeJSON(buf)
+	if n.err != nil {
+		return nil, n.err
+	}
+	return buf.Bytes(), nil
 }
 
 func (n *objectNode) Keys() []string {
@@ -378,14 +401,7 @@ func (n *objectNode) Keys() []string {
 		return nil
 	}
 	n.lazyParse()
-	if n.sortedKeys == nil {
-		keys := make([]string, 0, len(n.value))
-		for k := range n.value {
-			keys = append(keys, k)
-		}
-		sort.Strings(keys)
-		n.sortedKeys = keys
-	}
+	n.ensureSortedKeys()
 	return n.sortedKeys
 }
 
@@ -403,6 +419,12 @@ func (n *objectNode) Interface() interface{} {
 
 // lazyParse parses the entire object and sets up children with correct parents
 func (n *objectNode) lazyParse() {
+	n.parseRaw(false)
+}
+
+// parseRaw parses the raw object, with shallow only its own members, leaving
+// the objects and arrays among them to parse when they are read.
+func (n *objectNode) parseRaw(shallow bool) {
 	if n.parsed.Load() || n.isDirty {
 		return
 	}
@@ -420,13 +442,22 @@ func (n *objectNode) lazyParse() {
 	defer n.parsed.Store(true)
 
 	p := newParser(n.raw, n.funcs)
-	p.pos = 0
+	p.arena = n.arena
+	p.duplicateKeys = duplicateKeyPolicy(&n.baseNode)
+	p.lenient = documentLeniency(&n.baseNode)
+	p.shallow = shallow
+	// A root keeps the space around it in raw.
+	p.pos = skipSpace(n.raw, 0)
 	var parent core.Node
 	if n.parent != nil {
 		parent = n
 	}
 	parsedNode := p.parseObjectFull(parent)
 	if err := parsedNode.Error(); err != nil {
+		n.err = relocateSyntaxError(&n.baseNode, n.raw, err)
+		return
+	}
+	if err := p.checkEnd(); err != nil {
 		n.err = err
 		return
 	}
@@ -434,6 +465,12 @@ func (n *objectNode) lazyParse() {
 	if cast, ok := parsedNode.(*objectNode); ok {
 		m := make(map[string]core.Node, len(cast.value))
 		for k, child := range cast.value {
+			// Children handed out before the full parse may already have been
+			// modified; keep them instead of the freshly parsed copies.
+			if existing, ok := n.value[k]; ok {
+				m[k] = existing
+				continue
+			}
 			if bn, ok := child.(*baseNode); ok {
 				bn.parent = n
 			} else if inode, ok := child.(interface{ setParent(core.Node) }); ok {
@@ -443,6 +480,7 @@ func (n *objectNode) lazyParse() {
 		}
 		n.value = m
 		n.sortedKeys = cast.sortedKeys
+		n.keyOrder = cast.keyOrder
 		n.rebuildInlineEntries()
 	}
 }
@@ -0,0 +1,46 @@
+package engine
+
+import "github.com/474420502/xjson/internal/core"
+
+// SetOwner records owner, a value of the caller's such as the document
+// holding root, on root, to be found from any node below it with Owner. A
+// nil owner clears it. Invalid nodes, which may be shared, take no owner.
+func SetOwner(root core.Node, owner interface{}) {
+	b := nodeBase(root)
+	if b == nil || b.err != nil {
+		return
+	}
+	b.owner = owner
+}
+
+// Owner returns the owner of the nearest node from node up to the root of
+// its document that has one, along with that node, or nil and nil. A match
+// of a recursive scan is looked up as the document node at the same bytes,
+// as PathSegments does; a match set joined from several documents has no
+// parent and so no owner.
+func Owner(node core.Node) (interface{}, core.Node) {
+	if node == nil {
+		return nil, nil
+	}
+	if top := nodeBase(topNode(node)); top != nil && top.origin != nil {
+		if attached, ok := findBySource(top.origin, node); ok {
+			node = attached
+		} else {
+			node = top.origin
+		}
+	}
+	for {
+		b := nodeBase(node)
+		if b == nil || b.err != nil {
+			return nil, nil
+		}
+		if b.owner != nil {
+			return b.owner, node
+		}
+		parent := node.Parent()
+		if parent == nil || parent == node {
+			return nil, nil
+		}
+		node = parent
+	}
+}
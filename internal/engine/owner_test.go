@@ -0,0 +1,35 @@
+package engine
+
+import "testing"
+
+func TestOwner(t *testing.T) {
+	root, _ := Parse([]byte(`{"a":{"b":[1,{"c":2}]}}`))
+	if owner, at := Owner(root.Query("/a/b[1]/c")); owner != nil || at != nil {
+		t.Errorf("Owner without one = %v, %v", owner, at)
+	}
+	SetOwner(root, "doc")
+	sub := root.Query("/a/b")
+	SetOwner(sub, "sub")
+	for path, want := range map[string]string{"/a": "doc", "/a/b[1]/c": "sub", "//c": "doc"} {
+		owner, at := Owner(root.Query(path))
+		if owner != want {
+			t.Errorf("Owner(%s) = %v, want %s", path, owner, want)
+		}
+		if wantAt := map[string]interface{}{"doc": root, "sub": sub}[want]; at != wantAt {
+			t.Errorf("Owner(%s) found at %v, want %v", path, at, wantAt)
+		}
+	}
+	if owner, _ := Owner(root.Query("//c").Index(0)); owner != "sub" {
+		t.Errorf("Owner of a recursive match = %v, want sub", owner)
+	}
+
+	SetOwner(sub, nil)
+	if owner, _ := Owner(root.Query("/a/b[0]")); owner != "doc" {
+		t.Errorf("Owner after clearing = %v, want doc", owner)
+	}
+	invalid := root.Query("/missing")
+	SetOwner(invalid, "x")
+	if owner, _ := Owner(invalid); owner != nil {
+		t.Errorf("an invalid node took owner %v", owner)
+	}
+}
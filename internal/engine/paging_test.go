@@ -0,0 +1,122 @@
+package engine
+
+import (
+	"reflect"
+	"testing"
+)
+
+const pagingDoc = `{"logs":[
+	{"id":0,"level":"error"},{"id":1,"level":"info"},{"id":2,"level":"error"},
+	{"id":3,"level":"error"},{"id":4,"level":"warn"},{"id":5,"level":"error"}
+]}`
+
+func TestSliceAfterFilter(t *testing.T) {
+	root, err := Parse([]byte(pagingDoc))
+	if err != nil {
+		t.Fatalf("Parse failed: %v", err)
+	}
+
+	testCases := []struct {
+		path string
+		want []string
+	}{
+		{`/logs[?(@.level == 'error')][1:3]/id`, []string{"2", "3"}},
+		{`/logs[?(@.level == 'error')][2:]/id`, []string{"3", "5"}},
+		{`/logs[?(@.level == 'error')][:1]/id`, []string{"0"}},
+		{`/logs[?(@.level == 'error')][-1:]/id`, []string{"5"}},
+		{`/logs[?(@.level == 'error')][0:0]`, []string{}},
+		{`/logs[?(@.level == 'error')][10:20]`, []string{}},
+	}
+	for _, tc := range testCases {
+		result := root.Query(tc.path)
+		if !result.IsValid() {
+			t.Fatalf("query %q failed: %v", tc.path, result.Error())
+		}
+		if got := result.Strings(); !reflect.DeepEqual(got, tc.want) {
+			t.Fatalf("query %q = %v, want %v", tc.path, got, tc.want)
+		}
+	}
+
+	if got, _ := root.Query(`/logs[?(@.level == 'error')][1:2]`).Bytes(); string(got) != `{"id":2,"level":"error"}` {
+		t.Fatalf("a window over a match set should remain a match set, got %s", got)
+	}
+}
+
+func TestLimitAndOffset(t *testing.T) {
+	root, err := Parse([]byte(pagingDoc))
+	if err != nil {
+		t.Fatalf("Parse failed: %v", err)
+	}
+	errors := root.Query(`/logs[?(@.level == 'error')]`)
+
+	if got := errors.Offset(1).Limit(2).Query("id").Strings(); !reflect.DeepEqual(got, []string{"2", "3"}) {
+		t.Fatalf("unexpected page: %v", got)
+	}
+	if page := errors.Offset(10); !page.IsValid() || page.Len() != 0 {
+		t.Fatalf("expected an empty page past the end, got %s (%v)", page.String(), page.Error())
+	}
+	if page := errors.Limit(0); !page.IsValid() || page.Len() != 0 {
+		t.Fatalf("expected limit 0 to be empty, got %s", page.String())
+	}
+	if page := errors.Limit(100); page.Len() != 4 {
+		t.Fatalf("expected a large limit to keep every match, got %d", page.Len())
+	}
+	if errors.Limit(-1).IsValid() || errors.Offset(-1).IsValid() {
+		t.Fatalf("expected negative limit and offset to be rejected")
+	}
+	if got := errors.Len(); got != 4 {
+		t.Fatalf("windowing must not modify the source match set, got %d", got)
+	}
+
+	logs := root.Get("logs")
+	if got := logs.Limit(2).Query("id").Strings(); !reflect.DeepEqual(got, []string{"0", "1"}) {
+		t.Fatalf("unexpected limit on an array value: %v", got)
+	}
+	if got := logs.Limit(1).String(); got != `[{"id":0,"level":"error"}]` {
+		t.Fatalf("a window over an array value should stay an array, got %s", got)
+	}
+
+	name := root.Query(`/logs[0]/level`)
+	if name.Limit(1) != name || name.Offset(0) != name {
+		t.Fatalf("expected a single value to behave as one match")
+	}
+	if name.Limit(0).Len() != 0 || name.Offset(1).Len() != 0 {
+		t.Fatalf("expected a single value to be windowed away")
+	}
+}
+
+func TestLimitStopsEvaluationEarly(t *testing.T) {
+	root, err := Parse([]byte(`{"logs":[{"level":"error"},{"level":"error"},{"level":"error"},{"level":"info"}]}`))
+	if err != nil {
+		t.Fatalf("Parse failed: %v", err)
+	}
+	logs := root.Get("logs").(*arrayNode)
+	if got := root.Query(`/logs[?(@.level == 'error')][0:2]`); !got.IsValid() || got.Len() != 2 {
+		t.Fatalf("unexpected bounded filter result: %s (%v)", got.String(), got.Error())
+	}
+	if logs.parsed.Load() || len(logs.value) != 2 {
+		t.Fatalf("expected the bounded filter to visit only two elements, visited %d", len(logs.value))
+	}
+	if got := logs.Limit(3); !got.IsValid() || got.Len() != 3 || logs.parsed.Load() {
+		t.Fatalf("expected Limit to parse only the leading elements, got %v", got.Error())
+	}
+}
+
+func TestIndexAfterPartialParse(t *testing.T) {
+	root, err := Parse([]byte(`{"s":{"b":[{"t":"A"},{"t":"B"},{"t":"C"}]}}`))
+	if err != nil {
+		t.Fatalf("Parse failed: %v", err)
+	}
+	for i, want := range []string{"A", "B", "C", "A"} {
+		path := "/s/b[" + string(rune('0'+i%3)) + "]/t"
+		if got := root.Query(path).String(); got != want {
+			t.Fatalf("query %q = %q, want %q", path, got, want)
+		}
+	}
+	if got := root.Query("/s/b").Len(); got != 3 {
+		t.Fatalf("expected 3 elements after incremental parsing, got %d", got)
+	}
+	if got := root.Query("/s/b").Limit(2).Strings(); len(got) != 2 {
+		t.Fatalf("unexpected limit result %v", got)
+	}
+}
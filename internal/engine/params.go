@@ -0,0 +1,193 @@
+package engine
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"reflect"
+	"strconv"
+	"strings"
+
+	"github.com/474420502/xjson/internal/core"
+)
+
+// QueryParams evaluates path after binding every ? placeholder inside its
+// filter expressions to the next argument. Strings are bound as quoted
+// literals, so a value can never end the predicate early; numbers, bools
+// and nil are bound as literals, and any other value is rejected with an
+// error wrapping ErrInvalidParam.
+func (n *baseNode) QueryParams(path string, args ...interface{}) core.Node {
+	if n.err != nil {
+		return newInvalidNode(n.err)
+	}
+	bound, used, err := bindQueryParams(path, func(name string, index int) (interface{}, error) {
+		if index >= len(args) {
+			return nil, fmt.Errorf("%w: missing argument for placeholder %d", core.ErrInvalidParam, index+1)
+		}
+		return args[index], nil
+	}, false)
+	if err == nil && used != len(args) {
+		err = fmt.Errorf("%w: %d arguments for %d placeholders", core.ErrInvalidParam, len(args), used)
+	}
+	if err != nil {
+		return newInvalidNode(err)
+	}
+	return applySimpleQuery(queryStart(n.selfOrMe(), bound), bound)
+}
+
+// QueryNamed is like QueryParams but binds :name placeholders from params.
+// A placeholder without an entry in params is an error; unused entries are
+// ignored.
+func (n *baseNode) QueryNamed(path string, params map[string]interface{}) core.Node {
+	if n.err != nil {
+		return newInvalidNode(n.err)
+	}
+	bound, _, err := bindQueryParams(path, func(name string, _ int) (interface{}, error) {
+		v, ok := params[name]
+		if !ok {
+			return nil, fmt.Errorf("%w: no value for :%s", core.ErrInvalidParam, name)
+		}
+		return v, nil
+	}, true)
+	if err != nil {
+		return newInvalidNode(err)
+	}
+	return applySimpleQuery(queryStart(n.selfOrMe(), bound), bound)
+}
+
+// bindQueryParams replaces the placeholders of path with the literals of the
+// values lookup returns. Placeholders are only recognized inside `[?(...)]`
+// filters and outside quoted strings: ? in positional mode, :name in named
+// mode. index counts the placeholders seen so far; the total is returned
+// with the bound path.
+func bindQueryParams(path string, lookup func(name string, index int) (interface{}, error), named bool) (string, int, error) {
+	var b strings.Builder
+	depth := 0 // parenthesis depth inside the current filter, 0 outside
+	index := 0
+	for i := 0; i < len(path); {
+		c := path[i]
+		switch {
+		case c == '\'' || c == '"':
+			end := skipQuoted(path, i)
+			b.WriteString(path[i:end])
+			i = end
+			continue
+		case depth == 0:
+			if strings.HasPrefix(path[i:], "[?(") {
+				b.WriteString("[?(")
+				depth = 1
+				i += 3
+				continue
+			}
+		case c == '(':
+			depth++
+		case c == ')':
+			depth--
+		case !named && c == '?', named && c == ':' && i+1 < len(path) && isParamNameStart(path[i+1]):
+			name := ""
+			next := i + 1
+			if named {
+				for next < len(path) && (isParamNameStart(path[next]) || path[next] >= '0' && path[next] <= '9') {
+					next++
+				}
+				name = path[i+1 : next]
+			}
+			v, err := lookup(name, index)
+			if err != nil {
+				return "", index, err
+			}
+			lit, err := formatParamLiteral(v)
+			if err != nil {
+				if named {
+					return "", index, fmt.Errorf("%w: :%s: %v", core.ErrInvalidParam, name, err)
+				}
+				return "", index, fmt.Errorf("%w: argument %d: %v", core.ErrInvalidParam, index+1, err)
+			}
+			b.WriteString(lit)
+			index++
+			i = next
+			continue
+		}
+		b.WriteByte(c)
+		i++
+	}
+	return b.String(), index, nil
+}
+
+// skipQuoted returns the position after the string literal starting at
+// path[start], or len(path) when it is not terminated.
+func skipQuoted(path string, start int) int {
+	quote := path[start]
+	for i := start + 1; i < len(path); i++ {
+		switch path[i] {
+		case '\\':
+			i++
+		case quote:
+			return i + 1
+		}
+	}
+	return len(path)
+}
+
+func isParamNameStart(c byte) bool {
+	return (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z') || c == '_'
+}
+
+// formatParamLiteral renders v as a filter expression literal.
+func formatParamLiteral(v interface{}) (string, error) {
+	if num, ok := v.(json.Number); ok {
+		f, err := strconv.ParseFloat(string(num), 64)
+		if err != nil {
+			return "", fmt.Errorf("invalid number %q", string(num))
+		}
+		return formatParamLiteral(f)
+	}
+	rv := reflect.ValueOf(v)
+	for rv.Kind() == reflect.Ptr {
+		if rv.IsNil() {
+			return "null", nil
+		}
+		rv = rv.Elem()
+	}
+	switch rv.Kind() {
+	case reflect.Invalid:
+		return "null", nil
+	case reflect.String:
+		return quoteParamString(rv.String()), nil
+	case reflect.Bool:
+		return strconv.FormatBool(rv.Bool()), nil
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return strconv.FormatInt(rv.Int(), 10), nil
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return strconv.FormatUint(rv.Uint(), 10), nil
+	case reflect.Float32, reflect.Float64:
+		f := rv.Float()
+		if math.IsNaN(f) || math.IsInf(f, 0) {
+			return "", fmt.Errorf("%v has no JSON representation", f)
+		}
+		return strconv.FormatFloat(f, 'g', -1, rv.Type().Bits()), nil
+	}
+	return "", fmt.Errorf("cannot bind a value of type %T", v)
+}
+
+// quoteParamString quotes s as a single-quoted filter string. Quotes,
+// backslashes and control characters are escaped; everything else is kept
+// byte for byte.
+func quoteParamString(s string) string {
+	var b strings.Builder
+	b.Grow(len(s) + 2)
+	b.WriteByte('\'')
+	for i := 0; i < len(s); i++ {
+		switch c := s[i]; {
+		case c == '\'' || c == '\\':
+			b.WriteByte('\\')
+			b.WriteByte(c)
+		case c < 0x20:
+			fmt.Fprintf(&b, "\\u%04x", c)
+		default:
+			b.WriteByte(c)
+		}
+	}
+	b.WriteByte('\'')
+	return b.String()
+}
@@ -0,0 +1,112 @@
+package engine
+
+import (
+	"encoding/json"
+	"errors"
+	"math"
+	"reflect"
+	"testing"
+
+	"github.com/474420502/xjson/internal/core"
+)
+
+const paramsDoc = `{"store":{"book":[
+	{"title":"A","category":"it's","price":8},
+	{"title":"B","category":"back\\slash","price":12},
+	{"title":"C","category":"[x] (y)","price":30},
+	{"title":"D","category":"fiction","price":5,"used":true,"note":null},
+	{"title":"E","category":"fiction","price":25,"used":false,"note":"?"}
+]}}`
+
+func TestQueryParamsBindsLiterals(t *testing.T) {
+	root, err := Parse([]byte(paramsDoc))
+	if err != nil {
+		t.Fatalf("Parse failed: %v", err)
+	}
+	cases := []struct {
+		path string
+		args []interface{}
+		want []string
+	}{
+		{"/store/book[?(@.category == ? && @.price < ?)]/title", []interface{}{"it's", 20}, []string{"A"}},
+		{"/store/book[?(@.category == ?)]/title", []interface{}{`back\slash`}, []string{"B"}},
+		{"/store/book[?(@.category == ?)]/title", []interface{}{"[x] (y)"}, []string{"C"}},
+		{"/store/book[?(@.price >= ? && @.price <= ?)]/title", []interface{}{int64(8), 12.0}, []string{"A", "B"}},
+		{"/store/book[?(@.price > ?)]/title", []interface{}{json.Number("2.5e1")}, []string{"C"}},
+		{"/store/book[?(@.used == ?)]/title", []interface{}{true}, []string{"D"}},
+		{"/store/book[?(@.note == ?)]/title", []interface{}{nil}, []string{"D"}},
+		{"/store/book[?(@.note == '?' && @.price > ?)]/title", []interface{}{uint8(20)}, []string{"E"}},
+		{"/store/book[?(@.price == -?)]/title", []interface{}{-8}, []string{"A"}},
+	}
+	for _, tc := range cases {
+		got := root.QueryParams(tc.path, tc.args...)
+		if err := got.Error(); err != nil {
+			t.Fatalf("QueryParams(%q, %v) failed: %v", tc.path, tc.args, err)
+		}
+		if strs := got.Strings(); !reflect.DeepEqual(strs, tc.want) {
+			t.Fatalf("QueryParams(%q, %v) = %v, want %v", tc.path, tc.args, strs, tc.want)
+		}
+	}
+}
+
+func TestQueryParamsCannotEscapeTheLiteral(t *testing.T) {
+	root, _ := Parse([]byte(paramsDoc))
+	attacks := []string{
+		`' || @.price > 0 || @.title == '`,
+		`") || (true`,
+		`\') || (true`,
+		`x')] /store/book[?(@.price > 0`,
+		"fiction\x00",
+	}
+	for _, attack := range attacks {
+		got := root.QueryParams("/store/book[?(@.category == ?)]", attack)
+		if err := got.Error(); err != nil {
+			t.Fatalf("QueryParams(%q) failed: %v", attack, err)
+		}
+		if got.Len() != 0 {
+			t.Fatalf("QueryParams(%q) matched %v, want nothing", attack, got.Strings())
+		}
+	}
+}
+
+func TestQueryNamed(t *testing.T) {
+	root, _ := Parse([]byte(paramsDoc))
+	got := root.QueryNamed("/store/book[?(@.category == :cat && @.price < :max || @.title == :cat)]/title", map[string]interface{}{
+		"cat":    "fiction",
+		"max":    10,
+		"unused": struct{}{},
+	})
+	if strs := got.Strings(); !reflect.DeepEqual(strs, []string{"D"}) {
+		t.Fatalf("QueryNamed = %v, want [D]", strs)
+	}
+	s := "it's"
+	if got := root.QueryNamed("/store/book[?(@.category == :c)]/title", map[string]interface{}{"c": &s}); got.String() != "A" {
+		t.Fatalf("QueryNamed with pointer = %v, want A", got.Strings())
+	}
+}
+
+func TestQueryParamsErrors(t *testing.T) {
+	root, _ := Parse([]byte(paramsDoc))
+	type point struct{ X int }
+	cases := []core.Node{
+		root.QueryParams("/store/book[?(@.price < ?)]", point{1}),
+		root.QueryParams("/store/book[?(@.price < ?)]", []int{1}),
+		root.QueryParams("/store/book[?(@.price < ?)]", math.NaN()),
+		root.QueryParams("/store/book[?(@.price < ?)]"),
+		root.QueryParams("/store/book[?(@.price < ?)]", 1, 2),
+		root.QueryNamed("/store/book[?(@.price < :max)]", map[string]interface{}{"min": 1}),
+		root.QueryNamed("/store/book[?(@.price < :max)]", map[string]interface{}{"max": map[string]int{}}),
+	}
+	for i, got := range cases {
+		if got.IsValid() || !errors.Is(got.Error(), core.ErrInvalidParam) {
+			t.Fatalf("case %d: got %v (err %v), want ErrInvalidParam", i, got, got.Error())
+		}
+	}
+	// Placeholders are only recognized inside filters and outside strings.
+	if got := root.QueryParams("/store/book[?(@.note == '?')]/title"); got.String() != "E" {
+		t.Fatalf("quoted ? = %v, want E", got.Strings())
+	}
+	if got := root.Get("missing").QueryParams("/store"); got.IsValid() {
+		t.Fatal("expected an invalid node to stay invalid")
+	}
+}
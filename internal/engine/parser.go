@@ -3,7 +3,8 @@ package engine
 import (
 	"bytes"
 	"fmt"
-	"strconv"
+	"unicode/utf16"
+	"unicode/utf8"
 
 	"github.com/474420502/xjson/internal/core"
 )
@@ -12,7 +13,17 @@ type parser struct {
 	data  []byte
 	pos   int
 	funcs *map[string]core.UnaryPathFunc
-	buf   []byte // reusable buffer for unescape operations
+	buf   []byte // spare capacity that unescaped strings are carved from
+	// arena places new nodes in a NodePool's blocks when set.
+	arena *nodeArena
+	// members holds the members of the objects a pooled parse is reading.
+	members []parsedMember
+	// duplicateKeys is the policy of the document being parsed.
+	duplicateKeys DuplicateKeyPolicy
+	// shallow makes parseObjectFull leave the member values unparsed.
+	shallow bool
+	// lenient is the leniency of the document being parsed.
+	lenient leniency
 }
 
 func newParser(data []byte, funcs *map[string]core.UnaryPathFunc) *parser {
@@ -28,6 +39,9 @@ func (p *parser) Parse() (core.Node, error) {
 	if !n.IsValid() {
 		return nil, n.Error()
 	}
+	if err := p.checkEnd(); err != nil {
+		return nil, err
+	}
 	return n, nil
 }
 
@@ -40,13 +54,32 @@ func (p *parser) ParseFull() (core.Node, error) {
 	if !n.IsValid() {
 		return nil, n.Error()
 	}
+	if err := p.checkEnd(); err != nil {
+		return nil, err
+	}
 	return n, nil
 }
 
+// checkEnd fails when anything but whitespace follows the top-level value,
+// unless the document allows trailing data.
+func (p *parser) checkEnd() error {
+	p.skipWhitespace()
+	if p.pos >= len(p.data) || p.lenient.trailingData {
+		return nil
+	}
+	return newSyntaxError(p.data, p.pos, fmt.Sprintf("invalid character '%c' after top-level value", p.data[p.pos]))
+}
+
+// syntaxError returns an invalid node carrying a *core.SyntaxError located at
+// the current parse position.
+func (p *parser) syntaxError(format string, args ...interface{}) core.Node {
+	return newInvalidNode(newSyntaxError(p.data, p.pos, fmt.Sprintf(format, args...)))
+}
+
 func (p *parser) parseValue(parent core.Node) core.Node {
 	p.skipWhitespace()
 	if p.pos >= len(p.data) {
-		return newInvalidNode(fmt.Errorf("unexpected end of json"))
+		return p.syntaxError("unexpected end of json")
 	}
 	return p.doParse(parent)
 }
@@ -54,11 +87,25 @@ func (p *parser) parseValue(parent core.Node) core.Node {
 func (p *parser) parseValueFull(parent core.Node) core.Node {
 	p.skipWhitespace()
 	if p.pos >= len(p.data) {
-		return newInvalidNode(fmt.Errorf("unexpected end of json"))
+		return p.syntaxError("unexpected end of json")
 	}
 	return p.doParseFull(parent)
 }
 
+// parseValueShallow is parseValue leaving an array unparsed, where
+// parseArray would make a node of every element.
+func (p *parser) parseValueShallow(parent core.Node) core.Node {
+	p.skipWhitespace()
+	if p.arena == nil && p.pos < len(p.data) && p.data[p.pos] == '[' {
+		if end := rawValueEnd(p.data, p.pos) + 1; end > p.pos {
+			node := NewArrayNode(parent, p.data[p.pos:end], p.funcs)
+			p.pos = end
+			return node
+		}
+	}
+	return p.parseValue(parent)
+}
+
 func (p *parser) doParse(parent core.Node) core.Node {
 	switch p.data[p.pos] {
 	case '{':
@@ -73,8 +120,12 @@ func (p *parser) doParse(parent core.Node) core.Node {
 		return p.parseNull(parent)
 	case '-', '0', '1', '2', '3', '4', '5', '6', '7', '8', '9':
 		return p.parseNumber(parent)
+	case 'I', 'N':
+		if p.lenient.nonFinite {
+			return p.parseNumber(parent)
+		}
 	}
-	return newInvalidNode(fmt.Errorf("invalid character '%c' looking for beginning of value", p.data[p.pos]))
+	return p.syntaxError("invalid character '%c' looking for beginning of value", p.data[p.pos])
 }
 
 func (p *parser) doParseFull(parent core.Node) core.Node {
@@ -91,8 +142,12 @@ func (p *parser) doParseFull(parent core.Node) core.Node {
 		return p.parseNull(parent)
 	case '-', '0', '1', '2', '3', '4', '5', '6', '7', '8', '9':
 		return p.parseNumber(parent)
+	case 'I', 'N':
+		if p.lenient.nonFinite {
+			return p.parseNumber(parent)
+		}
 	}
-	return newInvalidNode(fmt.Errorf("invalid character '%c' looking for beginning of value", p.data[p.pos]))
+	return p.syntaxError("invalid character '%c' looking for beginning of value", p.data[p.pos])
 }
 
 func (p *parser) parseObject(parent core.Node) core.Node {
@@ -129,11 +184,11 @@ func (p *parser) parseObject(parent core.Node) core.Node {
 	}
 
 	if braceCount > 0 {
-		return newInvalidNode(fmt.Errorf("unterminated object"))
+		return p.syntaxError("unterminated object")
 	}
 
 	raw := p.data[start:p.pos]
-	node := NewObjectNode(parent, raw, p.funcs).(*objectNode)
+	node := p.newObjectNode(parent, raw)
 	node.start = 0
 	node.end = len(raw)
 	// Mark as not yet parsed for lazy evaluation
@@ -148,8 +203,9 @@ func (p *parser) parseObjectFull(parent core.Node) core.Node {
 	p.pos++ // skip '{'
 	p.skipWhitespace()
 
-	node := NewObjectNode(parent, nil, p.funcs).(*objectNode)
+	node := p.newObjectNode(parent, nil)
 	node.isDirty = false
+	base := len(p.members)
 
 	for p.pos < len(p.data) {
 		if p.data[p.pos] == '}' {
@@ -161,6 +217,9 @@ func (p *parser) parseObjectFull(parent core.Node) core.Node {
 			return node
 		}
 
+		if p.data[p.pos] != '"' {
+			return p.syntaxError("object key must be a string")
+		}
 		keyNode := p.parseString(node)
 		if !keyNode.IsValid() {
 			return keyNode
@@ -169,23 +228,43 @@ func (p *parser) parseObjectFull(parent core.Node) core.Node {
 
 		p.skipWhitespace()
 		if p.pos >= len(p.data) || p.data[p.pos] != ':' {
-			return newInvalidNode(fmt.Errorf("missing ':' after object key"))
+			return p.syntaxError("missing ':' after object key")
 		}
 		p.pos++ // skip ':'
 
-		valueNode := p.parseValueFull(node)
+		var valueNode core.Node
+		if p.shallow {
+			valueNode = p.parseValueShallow(node)
+		} else {
+			valueNode = p.parseValueFull(node)
+		}
 		if !valueNode.IsValid() {
 			return valueNode
 		}
 
-		if node.value == nil {
-			node.value = make(map[string]core.Node)
+		if p.arena != nil {
+			p.members = append(p.members, parsedMember{key: key, value: valueNode})
+		} else {
+			if node.value == nil {
+				node.value = make(map[string]core.Node)
+			}
+			if _, dup := node.value[key]; !dup {
+				node.keyOrder = append(node.keyOrder, key)
+				node.value[key] = valueNode
+			} else if p.duplicateKeys != FirstWins {
+				node.value[key] = valueNode
+			}
 		}
-		node.value[key] = valueNode
 
 		p.skipWhitespace()
+		if p.pos >= len(p.data) {
+			break
+		}
 		if p.data[p.pos] == '}' {
 			p.pos++
+			if p.arena != nil {
+				p.finishMembers(node, base)
+			}
 			node.raw = p.data[start:p.pos]
 			node.start = 0
 			node.end = len(node.raw)
@@ -195,13 +274,16 @@ func (p *parser) parseObjectFull(parent core.Node) core.Node {
 		}
 
 		if p.data[p.pos] != ',' {
-			return newInvalidNode(fmt.Errorf("missing ',' after object value"))
+			return p.syntaxError("missing ',' after object value")
 		}
 		p.pos++ // skip ','
 		p.skipWhitespace()
+		if p.pos < len(p.data) && p.data[p.pos] == '}' && !p.lenient.trailingCommas {
+			return p.syntaxError("trailing comma in object")
+		}
 	}
 
-	return newInvalidNode(fmt.Errorf("unterminated object"))
+	return p.syntaxError("unterminated object")
 }
 
 func (p *parser) parseArray(parent core.Node) core.Node {
@@ -209,7 +291,7 @@ func (p *parser) parseArray(parent core.Node) core.Node {
 	p.pos++ // skip '['
 	p.skipWhitespace()
 
-	node := NewArrayNode(parent, nil, p.funcs).(*arrayNode)
+	node := p.newArrayNode(parent)
 	node.isDirty = false
 
 	for p.pos < len(p.data) {
@@ -229,7 +311,7 @@ func (p *parser) parseArray(parent core.Node) core.Node {
 
 		p.skipWhitespace()
 		if p.pos >= len(p.data) {
-			return newInvalidNode(fmt.Errorf("unterminated array"))
+			return p.syntaxError("unterminated array")
 		}
 		if p.data[p.pos] == ']' {
 			p.pos++
@@ -240,12 +322,15 @@ func (p *parser) parseArray(parent core.Node) core.Node {
 		}
 
 		if p.data[p.pos] != ',' {
-			return newInvalidNode(fmt.Errorf("missing ',' after array value"))
+			return p.syntaxError("missing ',' after array value")
 		}
 		p.pos++ // skip ','
 		p.skipWhitespace()
+		if p.pos < len(p.data) && p.data[p.pos] == ']' && !p.lenient.trailingCommas {
+			return p.syntaxError("trailing comma in array")
+		}
 	}
-	return newInvalidNode(fmt.Errorf("unterminated array"))
+	return p.syntaxError("unterminated array")
 }
 
 func (p *parser) parseArrayFull(parent core.Node) core.Node {
@@ -253,7 +338,7 @@ func (p *parser) parseArrayFull(parent core.Node) core.Node {
 	p.pos++ // skip '['
 	p.skipWhitespace()
 
-	node := NewArrayNode(parent, nil, p.funcs).(*arrayNode)
+	node := p.newArrayNode(parent)
 	node.isDirty = false
 
 	for p.pos < len(p.data) {
@@ -274,7 +359,7 @@ func (p *parser) parseArrayFull(parent core.Node) core.Node {
 
 		p.skipWhitespace()
 		if p.pos >= len(p.data) {
-			return newInvalidNode(fmt.Errorf("unterminated array"))
+			return p.syntaxError("unterminated array")
 		}
 		if p.data[p.pos] == ']' {
 			p.pos++
@@ -286,12 +371,15 @@ func (p *parser) parseArrayFull(parent core.Node) core.Node {
 		}
 
 		if p.data[p.pos] != ',' {
-			return newInvalidNode(fmt.Errorf("missing ',' after array value"))
+			return p.syntaxError("missing ',' after array value")
 		}
 		p.pos++ // skip ','
 		p.skipWhitespace()
+		if p.pos < len(p.data) && p.data[p.pos] == ']' && !p.lenient.trailingCommas {
+			return p.syntaxError("trailing comma in array")
+		}
 	}
-	return newInvalidNode(fmt.Errorf("unterminated array"))
+	return p.syntaxError("unterminated array")
 }
 
 func (p *parser) parseString(parent core.Node) core.Node {
@@ -299,17 +387,22 @@ func (p *parser) parseString(parent core.Node) core.Node {
 	p.pos++ // skip '"'
 	end := -1
 	for i := p.pos; i < len(p.data); i++ {
+		if p.data[i] == '\\' {
+			i++
+			continue
+		}
 		if p.data[i] == '"' {
-			isEscaped := i > 0 && p.data[i-1] == '\\'
-			if !isEscaped {
-				end = i
-				break
-			}
+			end = i
+			break
+		}
+		if p.data[i] < 0x20 {
+			p.pos = i
+			return p.syntaxError("invalid control character %q in string literal", p.data[i])
 		}
 	}
 
 	if end == -1 {
-		return newInvalidNode(fmt.Errorf("unterminated string"))
+		return p.syntaxError("unterminated string")
 	}
 	p.pos = end + 1
 	raw := p.data[start:p.pos]
@@ -319,30 +412,40 @@ func (p *parser) parseString(parent core.Node) core.Node {
 	if needsUnescape {
 		unesc, err := unescapeWithBuffer(p.data[start+1:end], &p.buf)
 		if err != nil {
-			return newInvalidNode(err)
+			return newInvalidNode(newSyntaxError(p.data, start, err.Error()))
 		}
 		// create string node from unescaped bytes without allocating a separate string
-		node := NewDecodedStringNode(parent, unesc, p.funcs).(*stringNode)
+		node := p.newDecodedStringNode(parent, unesc)
+		// keep the escaped source so the node can still report its position
+		node.raw = raw
+		node.start = 1
+		node.end = len(raw) - 1
 		return node
 	}
 
 	// start/end for unquoted region relative to raw slice
 	// raw[0] == '"', so unquoted starts at 1 and ends at len(raw)-1
-	node := NewRawStringNode(parent, raw, 1, len(raw)-1, false, p.funcs).(*stringNode)
+	node := p.newRawStringNode(parent, raw)
 	return node
 }
 
 func (p *parser) parseNumber(parent core.Node) core.Node {
 	start := p.pos
-	for p.pos < len(p.data) {
-		c := p.data[p.pos]
-		if (c < '0' || c > '9') && c != '.' && c != 'e' && c != 'E' && c != '+' && c != '-' {
-			break
+	end, ok := numberEnd(p.data, start)
+	if p.lenient.nonFinite && !ok {
+		if literal := nonFiniteEnd(p.data, start); literal > 0 {
+			end, ok = literal, true
 		}
-		p.pos++
+	}
+	p.pos = end
+	if end >= len(p.data) && !ok {
+		return p.syntaxError("unexpected end of number")
+	}
+	if !ok || !endsValue(p.data, end) {
+		return p.syntaxError("invalid character '%c' in numeric literal", p.data[end])
 	}
 	raw := p.data[start:p.pos]
-	n := NewNumberNode(parent, raw, p.funcs).(*numberNode)
+	n := p.newNumberNode(parent, raw)
 	n.start = 0
 	n.end = len(raw)
 	return n
@@ -352,7 +455,10 @@ func (p *parser) parseBool(parent core.Node) core.Node {
 	if bytes.HasPrefix(p.data[p.pos:], []byte("true")) {
 		raw := p.data[p.pos : p.pos+4]
 		p.pos += 4
-		node := NewBoolNode(parent, true, p.funcs).(*boolNode)
+		if !endsValue(p.data, p.pos) {
+			return p.syntaxError("invalid character '%c' in literal true", p.data[p.pos])
+		}
+		node := p.newBoolNode(parent, true)
 		node.raw = raw
 		node.start = 0
 		node.end = len(raw)
@@ -361,26 +467,32 @@ func (p *parser) parseBool(parent core.Node) core.Node {
 	if bytes.HasPrefix(p.data[p.pos:], []byte("false")) {
 		raw := p.data[p.pos : p.pos+5]
 		p.pos += 5
-		node := NewBoolNode(parent, false, p.funcs).(*boolNode)
+		if !endsValue(p.data, p.pos) {
+			return p.syntaxError("invalid character '%c' in literal false", p.data[p.pos])
+		}
+		node := p.newBoolNode(parent, false)
 		node.raw = raw
 		node.start = 0
 		node.end = len(raw)
 		return node
 	}
-	return newInvalidNode(fmt.Errorf("invalid boolean"))
+	return p.syntaxError("invalid boolean")
 }
 
 func (p *parser) parseNull(parent core.Node) core.Node {
 	if bytes.HasPrefix(p.data[p.pos:], []byte("null")) {
 		raw := p.data[p.pos : p.pos+4]
 		p.pos += 4
-		node := NewNullNode(parent, p.funcs).(*nullNode)
+		if !endsValue(p.data, p.pos) {
+			return p.syntaxError("invalid character '%c' in literal null", p.data[p.pos])
+		}
+		node := p.newNullNode(parent)
 		node.raw = raw
 		node.start = 0
 		node.end = len(raw)
 		return node
 	}
-	return newInvalidNode(fmt.Errorf("invalid null"))
+	return p.syntaxError("invalid null")
 }
 
 func (p *parser) skipWhitespace() {
@@ -398,134 +510,136 @@ func unescape(data []byte) ([]byte, error) {
 	if bytes.IndexByte(data, '\\') == -1 {
 		return data, nil
 	}
-
-	// Pre-allocate result slice to avoid reallocations
 	// In most cases, unescaped string will be same or shorter length
-	result := make([]byte, 0, len(data))
-	i := 0
-	for i < len(data) {
-		if data[i] == '\\' {
-			i++
-			if i >= len(data) {
-				return nil, fmt.Errorf("invalid escape sequence at end of string")
-			}
-			switch data[i] {
-			case '"', '\\', '/':
-				result = append(result, data[i])
-			case 'b':
-				result = append(result, '\b')
-			case 'f':
-				result = append(result, '\f')
-			case 'n':
-				result = append(result, '\n')
-			case 'r':
-				result = append(result, '\r')
-			case 't':
-				result = append(result, '\t')
-			case 'u':
-				if i+4 >= len(data) {
-					return nil, fmt.Errorf("invalid unicode escape sequence: not enough digits")
-				}
-				val, err := strconv.ParseInt(string(data[i+1:i+5]), 16, 32)
-				if err != nil {
-					return nil, fmt.Errorf("invalid unicode escape sequence: %w", err)
-				}
-				// Handle Unicode properly
-				r := rune(val)
-				if r <= 127 {
-					result = append(result, byte(r))
-				} else {
-					// Convert rune to UTF-8 bytes
-					utf8Bytes := make([]byte, 4)
-					n := copy(utf8Bytes, string(r))
-					result = append(result, utf8Bytes[:n]...)
-				}
-				i += 4
-			default:
-				return nil, fmt.Errorf("invalid escape character: %c", data[i])
-			}
-		} else {
-			result = append(result, data[i])
-		}
-		i++
-	}
-	return result, nil
+	return appendUnescaped(make([]byte, 0, len(data)), data)
 }
 
-// unescapeWithBuffer is an optimized version using provided buffer
+// unescapeWithBuffer unescapes b into the spare capacity of *bufPtr. The
+// returned slice is handed over to the caller: the buffer is advanced past
+// it, so later calls never overwrite strings decoded earlier.
 func unescapeWithBuffer(b []byte, bufPtr *[]byte) ([]byte, error) {
-	buf := *bufPtr
-
-	// Early exit if no escape sequences
-	if bytes.IndexByte(b, '\\') == -1 {
-		// No escapes - extend buffer and copy
-		if cap(buf) < len(b) {
-			buf = make([]byte, len(b))
-			*bufPtr = buf
-		} else {
-			buf = buf[:len(b)]
+	buf := (*bufPtr)[:0]
+	if cap(buf) < len(b) {
+		size := len(b)
+		if size < minUnescapeChunk {
+			size = minUnescapeChunk
 		}
-		copy(buf, b)
-		return buf, nil
+		buf = make([]byte, 0, size)
 	}
 
-	// Ensure buffer has sufficient capacity
-	if cap(buf) < len(b) {
-		buf = make([]byte, 0, len(b))
-		*bufPtr = buf
+	out, err := appendUnescaped(buf, b)
+	if err != nil {
+		return nil, err
+	}
+	out = out[:len(out):len(out)]
+	if len(out) <= cap(buf) {
+		*bufPtr = buf[len(out):len(out)]
 	} else {
-		buf = buf[:0]
+		*bufPtr = nil
 	}
+	return out, nil
+}
+
+// minUnescapeChunk is the smallest buffer unescapeWithBuffer allocates, so
+// that a document with many short escaped strings shares a few chunks.
+const minUnescapeChunk = 512
 
+// escapeError reports a malformed escape sequence at byte offset off of the
+// string contents being decoded.
+type escapeError struct {
+	off int
+	msg string
+}
+
+func (e *escapeError) Error() string { return e.msg }
+
+// appendUnescaped appends the decoded form of the string contents b to dst.
+// UTF-16 surrogate pairs are combined into one code point; a lone surrogate
+// decodes to U+FFFD like encoding/json does.
+func appendUnescaped(dst, b []byte) ([]byte, error) {
 	for i := 0; i < len(b); i++ {
 		if b[i] != '\\' {
-			buf = append(buf, b[i])
+			dst = append(dst, b[i])
 			continue
 		}
 		if i == len(b)-1 {
-			return nil, fmt.Errorf("invalid escape at end of string")
+			return nil, &escapeError{off: i, msg: "invalid escape at end of string"}
 		}
 
 		switch b[i+1] {
 		case '"':
-			buf = append(buf, '"')
+			dst = append(dst, '"')
 		case '\\':
-			buf = append(buf, '\\')
+			dst = append(dst, '\\')
 		case '/':
-			buf = append(buf, '/')
+			dst = append(dst, '/')
 		case 'b':
-			buf = append(buf, '\b')
+			dst = append(dst, '\b')
 		case 'f':
-			buf = append(buf, '\f')
+			dst = append(dst, '\f')
 		case 'n':
-			buf = append(buf, '\n')
+			dst = append(dst, '\n')
 		case 'r':
-			buf = append(buf, '\r')
+			dst = append(dst, '\r')
 		case 't':
-			buf = append(buf, '\t')
+			dst = append(dst, '\t')
 		case 'u':
-			if i+5 >= len(b) {
-				return nil, fmt.Errorf("invalid unicode escape")
-			}
-			hex := string(b[i+2 : i+6])
-			codePoint, err := strconv.ParseUint(hex, 16, 16)
+			r, n, err := decodeUnicodeEscape(b, i)
 			if err != nil {
-				return nil, fmt.Errorf("invalid unicode escape: %s", hex)
-			}
-			if codePoint < 128 {
-				buf = append(buf, byte(codePoint))
-			} else {
-				buf = append(buf, []byte(string(rune(codePoint)))...)
+				return nil, err
 			}
-			i += 4
+			dst = utf8.AppendRune(dst, r)
+			i += n - 2
 		default:
-			return nil, fmt.Errorf("invalid escape character: %c", b[i+1])
+			return nil, &escapeError{off: i, msg: fmt.Sprintf("invalid escape character: %c", b[i+1])}
 		}
 		i++
 	}
+	return dst, nil
+}
 
-	*bufPtr = buf
-	return buf, nil
+// decodeUnicodeEscape decodes the \uXXXX escape at b[i:], combining it with
+// a following low surrogate escape when it is a high surrogate. It returns
+// the rune and the number of bytes consumed. Lone surrogates yield
+// utf8.RuneError.
+func decodeUnicodeEscape(b []byte, i int) (rune, int, error) {
+	r, ok := parseHex4(b, i+2)
+	if !ok {
+		return 0, 0, &escapeError{off: i, msg: "invalid unicode escape"}
+	}
+	if !utf16.IsSurrogate(r) {
+		return r, 6, nil
+	}
+	if r < 0xDC00 && i+7 < len(b) && b[i+6] == '\\' && b[i+7] == 'u' {
+		if lo, ok := parseHex4(b, i+8); ok {
+			if pair := utf16.DecodeRune(r, lo); pair != utf8.RuneError {
+				return pair, 12, nil
+			}
+		}
+	}
+	return utf8.RuneError, 6, nil
+}
+
+// parseHex4 parses the four hex digits at b[i:].
+func parseHex4(b []byte, i int) (rune, bool) {
+	if i+4 > len(b) {
+		return 0, false
+	}
+	var r rune
+	for _, c := range b[i : i+4] {
+		switch {
+		case c >= '0' && c <= '9':
+			c -= '0'
+		case c >= 'a' && c <= 'f':
+			c -= 'a' - 10
+		case c >= 'A' && c <= 'F':
+			c -= 'A' - 10
+		default:
+			return 0, false
+		}
+		r = r<<4 | rune(c)
+	}
+	return r, true
 }
 
 // countObjectFields returns an estimated number of top-level fields for the object
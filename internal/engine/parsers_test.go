@@ -0,0 +1,40 @@
+package engine
+
+import (
+	"testing"
+
+	"github.com/474420502/xjson/internal/core"
+)
+
+// testParsers are the ways a test parses a document: lazily, fully, lazily
+// with every value then materialized, and into a pool's blocks. A test that
+// runs on each sees the same document on either side of the lazy parse.
+var testParsers = map[string]func([]byte) (core.Node, error){
+	"lazy":  Parse,
+	"eager": MustParse,
+	"materialized": func(data []byte) (core.Node, error) {
+		root, err := Parse(data)
+		if err == nil {
+			forceParseTree(root)
+		}
+		return root, err
+	},
+	"pooled": func(data []byte) (core.Node, error) {
+		return ParseWithOptions(data, ParseOptions{Pool: NewNodePool()})
+	},
+}
+
+// forEachParser runs fn in a subtest for each of testParsers on doc parsed
+// by it.
+func forEachParser(t *testing.T, doc string, fn func(t *testing.T, root core.Node)) {
+	t.Helper()
+	for name, parse := range testParsers {
+		t.Run(name, func(t *testing.T) {
+			root, err := parse([]byte(doc))
+			if err != nil {
+				t.Fatalf("parse failed: %v", err)
+			}
+			fn(t, root)
+		})
+	}
+}
@@ -0,0 +1,488 @@
+package engine
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/474420502/xjson/internal/core"
+	internalquery "github.com/474420502/xjson/internal/query"
+)
+
+// PathBuilder builds a query path step by step and writes it out with every
+// key escaped. Each method returns a new PathBuilder and leaves the receiver
+// unchanged, so a path can be shared and extended from several places. The
+// first invalid step is kept as Err; the steps after it are ignored.
+type PathBuilder struct {
+	steps []pathStep
+	err   error
+}
+
+type pathStep struct {
+	op     Op
+	key    string
+	index  int
+	end    int
+	fields []string
+	args   []interface{}
+}
+
+// NewPath returns an empty path.
+func NewPath() PathBuilder {
+	return PathBuilder{}
+}
+
+// ParsePath parses a query path into a PathBuilder, so a path from user
+// input can be extended or rewritten safely. Filter expressions are kept in
+// canonical form.
+func ParsePath(path string) (PathBuilder, error) {
+	tokens, err := internalquery.NewParser(path).Parse()
+	if err != nil {
+		return PathBuilder{}, err
+	}
+	var p PathBuilder
+	for _, token := range tokens {
+		step := pathStep{op: token.Type}
+		switch token.Type {
+		case OpKey, OpRecursive:
+			step.key = token.Value.(string)
+		case OpFunc:
+			call := token.Value.(internalquery.FuncCall)
+			step.key, step.args = call.Name, call.Args
+		case OpIndex:
+			step.index = token.Value.(int)
+		case OpSlice:
+			bounds := token.Value.([2]int)
+			step.index, step.end = bounds[0], bounds[1]
+		case OpFilter:
+			step.key = formatFilterExpression(token.Value.(internalquery.Expression))
+		case OpPick:
+			step.fields = token.Value.([]string)
+		}
+		p.steps = append(p.steps, step)
+	}
+	return p, nil
+}
+
+func (p PathBuilder) with(step pathStep) PathBuilder {
+	if p.err != nil {
+		return p
+	}
+	return PathBuilder{steps: append(p.steps[:len(p.steps):len(p.steps)], step)}
+}
+
+func (p PathBuilder) withError(err error) PathBuilder {
+	if p.err != nil {
+		return p
+	}
+	return PathBuilder{steps: p.steps, err: err}
+}
+
+// Key selects the member key of an object. Any key can be written.
+func (p PathBuilder) Key(key string) PathBuilder {
+	return p.with(pathStep{op: OpKey, key: key})
+}
+
+// Index selects an array element; negative indices count from the end.
+func (p PathBuilder) Index(i int) PathBuilder {
+	return p.with(pathStep{op: OpIndex, index: i})
+}
+
+// Slice selects the array elements from start up to but not including end.
+// An end of -1 runs to the end of the array.
+func (p PathBuilder) Slice(start, end int) PathBuilder {
+	return p.with(pathStep{op: OpSlice, index: start, end: end})
+}
+
+// Wildcard selects every element of an array or value of an object.
+func (p PathBuilder) Wildcard() PathBuilder {
+	return p.with(pathStep{op: OpWildcard})
+}
+
+// Recursive selects the values of every member named key at any depth.
+// The path syntax has no quoting here, so key cannot contain '/', '[',
+// ']', '.', '{' or white space.
+func (p PathBuilder) Recursive(key string) PathBuilder {
+	if key == "" || key == "*" || strings.ContainsAny(key, "/[].{ \t\n\r") {
+		return p.withError(fmt.Errorf("recursive key %q cannot be written in a path", key))
+	}
+	return p.with(pathStep{op: OpRecursive, key: key})
+}
+
+// RecursiveAll selects every value below the current one.
+func (p PathBuilder) RecursiveAll() PathBuilder {
+	return p.with(pathStep{op: OpAll})
+}
+
+// Parent steps up to the parent of the current value.
+func (p PathBuilder) Parent() PathBuilder {
+	return p.with(pathStep{op: OpParent})
+}
+
+// Func calls the path function registered under name with args, each a
+// string, number or bool.
+func (p PathBuilder) Func(name string, args ...interface{}) PathBuilder {
+	if name == "" || !isSimplePathKey(name) {
+		return p.withError(fmt.Errorf("invalid function name %q", name))
+	}
+	step := pathStep{op: OpFunc, key: name}
+	for _, v := range args {
+		arg, ok := core.NewArg(v)
+		if !ok {
+			return p.withError(fmt.Errorf("invalid argument %v of type %T to function %q", v, v, name))
+		}
+		step.args = append(step.args, arg.Value)
+	}
+	return p.with(step)
+}
+
+// Filter keeps the array elements for which expr, a filter expression such
+// as "@.price < 10", holds. Use Where to build the expression instead.
+func (p PathBuilder) Filter(expr string) PathBuilder {
+	parsed, err := parseFilterText(expr)
+	if err != nil {
+		return p.withError(err)
+	}
+	return p.with(pathStep{op: OpFilter, key: formatFilterExpression(parsed)})
+}
+
+// Where keeps the array elements for which cond holds.
+func (p PathBuilder) Where(cond FilterCond) PathBuilder {
+	if cond.err != nil {
+		return p.withError(cond.err)
+	}
+	return p.with(pathStep{op: OpFilter, key: formatFilterExpression(cond.expr)})
+}
+
+// Pick keeps only the listed fields of each object. A field may be a dotted
+// path such as "author.name".
+func (p PathBuilder) Pick(fields ...string) PathBuilder {
+	if len(fields) == 0 {
+		return p.withError(fmt.Errorf("pick needs at least one field"))
+	}
+	for _, field := range fields {
+		if field == "" || strings.ContainsAny(field, "{}[]/, \t\n\r") {
+			return p.withError(fmt.Errorf("invalid field %q in field list", field))
+		}
+	}
+	return p.with(pathStep{op: OpPick, fields: append([]string(nil), fields...)})
+}
+
+// Err returns the error of the first invalid step.
+func (p PathBuilder) Err() error { return p.err }
+
+// String returns the canonical form of the path, the form Node.Path uses:
+// keys are separated by slashes and indices, slices, filters and function
+// calls follow their value in brackets, as in /store/book[2]/title.
+func (p PathBuilder) String() string {
+	return p.format(false)
+}
+
+// SlashString returns the path with every step after a slash, as in
+// /store/book/2/title. It selects the same values as String.
+func (p PathBuilder) SlashString() string {
+	return p.format(true)
+}
+
+func (p PathBuilder) format(slashes bool) string {
+	var b strings.Builder
+	for i, step := range p.steps {
+		switch step.op {
+		case OpKey, OpWildcard, OpParent:
+			if step.op != OpParent || i > 0 || slashes {
+				b.WriteByte('/')
+			}
+		case OpRecursive, OpAll:
+			b.WriteString("//")
+		default:
+			if slashes {
+				b.WriteByte('/')
+			}
+		}
+		switch step.op {
+		case OpKey:
+			b.WriteString(formatPathKey(step.key))
+		case OpIndex:
+			if slashes {
+				b.WriteString(strconv.Itoa(step.index))
+			} else {
+				fmt.Fprintf(&b, "[%d]", step.index)
+			}
+		case OpSlice:
+			if step.end == -1 {
+				fmt.Fprintf(&b, "[%d:]", step.index)
+			} else {
+				fmt.Fprintf(&b, "[%d:%d]", step.index, step.end)
+			}
+		case OpWildcard, OpAll:
+			b.WriteByte('*')
+		case OpRecursive:
+			b.WriteString(step.key)
+		case OpParent:
+			b.WriteString("..")
+		case OpFunc:
+			b.WriteString("[@" + step.key)
+			if len(step.args) > 0 {
+				b.WriteByte('(')
+				for i, arg := range step.args {
+					if i > 0 {
+						b.WriteString(", ")
+					}
+					writeFilterExpression(&b, internalquery.ExpressionLiteral{Value: arg}, false)
+				}
+				b.WriteByte(')')
+			}
+			b.WriteByte(']')
+		case OpFilter:
+			b.WriteString("[?(" + step.key + ")]")
+		case OpPick:
+			b.WriteString("{" + strings.Join(step.fields, ",") + "}")
+		}
+	}
+	return b.String()
+}
+
+// QueryPath evaluates a path built with NewPath or ParsePath. A path with an
+// invalid step yields an invalid node carrying its error.
+func (n *baseNode) QueryPath(path core.PathSpec) core.Node {
+	if n.err != nil {
+		return newInvalidNode(n.err)
+	}
+	if path == nil {
+		return newInvalidNode(&core.PathError{Op: "QueryPath", Err: fmt.Errorf("nil path")})
+	}
+	if err := path.Err(); err != nil {
+		return newInvalidNode(&core.PathError{Path: path.String(), Op: "QueryPath", Err: err})
+	}
+	return n.selfOrMe().Query(path.String())
+}
+
+// FilterCond is a condition for PathBuilder.Where, built from a FilterField
+// as in Field("price").Lt(10).And(Field("tags", 0).Eq("go")).
+type FilterCond struct {
+	expr internalquery.Expression
+	err  error
+}
+
+// FilterField is a value of the element being filtered or of the document
+// root, see Field and RootField.
+type FilterField struct {
+	path internalquery.ExpressionPath
+	err  error
+}
+
+// Field refers to the value below the element being filtered that steps,
+// string keys and int indices, lead to; without steps it is the element
+// itself.
+func Field(steps ...interface{}) FilterField {
+	return filterField(internalquery.ExpressionPath{}, steps)
+}
+
+// RootField is like Field but starts at the root of the document ($), so
+// elements can be compared with document-level values.
+func RootField(steps ...interface{}) FilterField {
+	return filterField(internalquery.ExpressionPath{Root: true}, steps)
+}
+
+func filterField(path internalquery.ExpressionPath, steps []interface{}) FilterField {
+	f := FilterField{path: path}
+	for _, step := range steps {
+		switch s := step.(type) {
+		case string:
+			f.path.Segments = append(f.path.Segments, internalquery.QueryToken{Type: OpKey, Value: s})
+		case int:
+			f.path.Segments = append(f.path.Segments, internalquery.QueryToken{Type: OpIndex, Value: s})
+		default:
+			return FilterField{err: fmt.Errorf("filter field step %v is %T, not a string key or int index", step, step)}
+		}
+	}
+	return f
+}
+
+func (f FilterField) compare(op string, v interface{}) FilterCond {
+	if f.err != nil {
+		return FilterCond{err: f.err}
+	}
+	if other, ok := v.(FilterField); ok {
+		if other.err != nil {
+			return FilterCond{err: other.err}
+		}
+		return FilterCond{expr: internalquery.ExpressionBinary{Op: op, Left: f.path, Right: other.path}}
+	}
+	literal, err := formatParamLiteral(v)
+	if err != nil {
+		return FilterCond{err: fmt.Errorf("%w: %v", core.ErrInvalidParam, err)}
+	}
+	value, err := parseFilterText(literal)
+	if err != nil {
+		return FilterCond{err: err}
+	}
+	return FilterCond{expr: internalquery.ExpressionBinary{Op: op, Left: f.path, Right: value}}
+}
+
+// Eq holds when the field equals v, a literal or another FilterField.
+func (f FilterField) Eq(v interface{}) FilterCond { return f.compare("==", v) }
+
+// Ne holds when the field does not equal v.
+func (f FilterField) Ne(v interface{}) FilterCond { return f.compare("!=", v) }
+
+// Lt holds when the field is less than v.
+func (f FilterField) Lt(v interface{}) FilterCond { return f.compare("<", v) }
+
+// Le holds when the field is less than or equal to v.
+func (f FilterField) Le(v interface{}) FilterCond { return f.compare("<=", v) }
+
+// Gt holds when the field is greater than v.
+func (f FilterField) Gt(v interface{}) FilterCond { return f.compare(">", v) }
+
+// Ge holds when the field is greater than or equal to v.
+func (f FilterField) Ge(v interface{}) FilterCond { return f.compare(">=", v) }
+
+// Exists holds when the field is present.
+func (f FilterField) Exists() FilterCond {
+	if f.err != nil {
+		return FilterCond{err: f.err}
+	}
+	missing := internalquery.ExpressionCall{Name: "is_missing", Args: []internalquery.Expression{f.path}}
+	return FilterCond{expr: internalquery.ExpressionUnary{Op: "!", Operand: missing}}
+}
+
+// ContainsAll holds when the field is an array holding every one of values,
+// literals as Eq takes them.
+func (f FilterField) ContainsAll(values ...interface{}) FilterCond {
+	return f.contains("contains_all", values)
+}
+
+// ContainsAny holds when the field is an array holding at least one of
+// values.
+func (f FilterField) ContainsAny(values ...interface{}) FilterCond {
+	return f.contains("contains_any", values)
+}
+
+func (f FilterField) contains(name string, values []interface{}) FilterCond {
+	if f.err != nil {
+		return FilterCond{err: f.err}
+	}
+	args := []string{formatFilterExpression(f.path)}
+	for _, v := range values {
+		literal, err := formatParamLiteral(v)
+		if err != nil {
+			return FilterCond{err: fmt.Errorf("%w: %v", core.ErrInvalidParam, err)}
+		}
+		args = append(args, literal)
+	}
+	expr, err := parseFilterText(name + "(" + strings.Join(args, ", ") + ")")
+	if err != nil {
+		return FilterCond{err: err}
+	}
+	return FilterCond{expr: expr}
+}
+
+func (c FilterCond) combine(op string, other FilterCond) FilterCond {
+	if c.err != nil {
+		return c
+	}
+	if other.err != nil {
+		return other
+	}
+	return FilterCond{expr: internalquery.ExpressionBinary{Op: op, Left: c.expr, Right: other.expr}}
+}
+
+// And holds when both conditions hold.
+func (c FilterCond) And(other FilterCond) FilterCond { return c.combine("&&", other) }
+
+// Or holds when either condition holds.
+func (c FilterCond) Or(other FilterCond) FilterCond { return c.combine("||", other) }
+
+// Not holds when c does not.
+func (c FilterCond) Not() FilterCond {
+	if c.err != nil {
+		return c
+	}
+	return FilterCond{expr: internalquery.ExpressionUnary{Op: "!", Operand: c.expr}}
+}
+
+// Err returns the error of the first invalid part of the condition.
+func (c FilterCond) Err() error { return c.err }
+
+// String returns the condition as a filter expression.
+func (c FilterCond) String() string {
+	if c.err != nil {
+		return ""
+	}
+	return formatFilterExpression(c.expr)
+}
+
+// parseFilterText parses a filter expression given without its [?( )].
+func parseFilterText(expr string) (internalquery.Expression, error) {
+	tokens, err := internalquery.NewParser("[?(" + expr + ")]").Parse()
+	if err != nil {
+		return nil, err
+	}
+	if len(tokens) != 1 || tokens[0].Type != OpFilter {
+		return nil, fmt.Errorf("invalid filter expression %q", expr)
+	}
+	return tokens[0].Value.(internalquery.Expression), nil
+}
+
+// formatFilterExpression writes expr in canonical form: single spaces
+// around binary operators, nested operations in parentheses, strings single
+// quoted.
+func formatFilterExpression(expr internalquery.Expression) string {
+	var b strings.Builder
+	writeFilterExpression(&b, expr, false)
+	return b.String()
+}
+
+func writeFilterExpression(b *strings.Builder, expr internalquery.Expression, nested bool) {
+	switch e := expr.(type) {
+	case internalquery.ExpressionLiteral:
+		switch v := e.Value.(type) {
+		case string:
+			b.WriteString(quoteParamString(v))
+		case float64:
+			b.WriteString(strconv.FormatFloat(v, 'g', -1, 64))
+		case bool:
+			b.WriteString(strconv.FormatBool(v))
+		default:
+			b.WriteString("null")
+		}
+	case internalquery.ExpressionPath:
+		if e.Root {
+			b.WriteByte('$')
+		} else {
+			b.WriteByte('@')
+		}
+		for _, seg := range e.Segments {
+			if seg.Type == OpIndex {
+				fmt.Fprintf(b, "[%d]", seg.Value.(int))
+			} else if key := seg.Value.(string); key != "" && isSimplePathKey(key) {
+				b.WriteString("." + key)
+			} else {
+				b.WriteString("[" + quoteParamString(key) + "]")
+			}
+		}
+	case internalquery.ExpressionUnary:
+		b.WriteString(e.Op)
+		writeFilterExpression(b, e.Operand, true)
+	case internalquery.ExpressionBinary:
+		if nested {
+			b.WriteByte('(')
+		}
+		writeFilterExpression(b, e.Left, true)
+		b.WriteString(" " + e.Op + " ")
+		writeFilterExpression(b, e.Right, true)
+		if nested {
+			b.WriteByte(')')
+		}
+	case internalquery.ExpressionCall:
+		b.WriteString(e.Name + "(")
+		for i, arg := range e.Args {
+			if i > 0 {
+				b.WriteString(", ")
+			}
+			writeFilterExpression(b, arg, false)
+		}
+		b.WriteByte(')')
+	}
+}
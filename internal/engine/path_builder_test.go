@@ -0,0 +1,127 @@
+package engine
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+
+	"github.com/474420502/xjson/internal/core"
+)
+
+func TestPathBuilderStrings(t *testing.T) {
+	cases := []struct {
+		path        PathBuilder
+		canonical   string
+		slashSyntax string
+	}{
+		{NewPath().Key("store").Key("book").Index(2).Key("title"), "/store/book[2]/title", "/store/book/2/title"},
+		{NewPath().Key("a.b").Key(`it's`).Key("[x]").Key(""), `/['a.b']/['it\'s']/['[x]']/['']`, `/['a.b']/['it\'s']/['[x]']/['']`},
+		{NewPath().Key("2").Key(`back\slash`).Key("a/b"), `/['2']/['back\\slash']/['a/b']`, `/['2']/['back\\slash']/['a/b']`},
+		{NewPath().Index(-1).Slice(1, 3).Slice(2, -1), "[-1][1:3][2:]", "/-1/[1:3]/[2:]"},
+		{NewPath().Key("items").Wildcard().Key("id"), "/items/*/id", "/items/*/id"},
+		{NewPath().Recursive("name").RecursiveAll(), "//name//*", "//name//*"},
+		{NewPath().Parent().Parent().Key("meta"), "../../meta", "/../../meta"},
+		{NewPath().Key("books").Func("cheap").Pick("title", "author.name"), "/books[@cheap]{title,author.name}", "/books/[@cheap]/{title,author.name}"},
+		{NewPath().Key("books").Func("topk", "it's", 3).Func("below", -1.5, true), `/books[@topk('it\'s', 3)][@below(-1.5, true)]`, `/books/[@topk('it\'s', 3)]/[@below(-1.5, true)]`},
+		{NewPath().Key("books").Where(Field("price").Lt(RootField("limits", 0)).And(RootField("on").Exists())), "/books[?((@.price < $.limits[0]) && !is_missing($.on))]", "/books/[?((@.price < $.limits[0]) && !is_missing($.on))]"},
+		{NewPath().Key("books").Where(Field("tags").ContainsAll("go", "it's").Or(Field("nums").ContainsAny(-1.5, nil, true).Not())), "/books[?(contains_all(@.tags, 'go', 'it\\'s') || !contains_any(@.nums, -1.5, null, true))]", "/books/[?(contains_all(@.tags, 'go', 'it\\'s') || !contains_any(@.nums, -1.5, null, true))]"},
+		{NewPath().Key("books").Filter("@.price<10&&@['a.b']=='x'"), "/books[?((@.price < 10) && (@['a.b'] == 'x'))]", "/books/[?((@.price < 10) && (@['a.b'] == 'x'))]"},
+	}
+	for _, tc := range cases {
+		if err := tc.path.Err(); err != nil {
+			t.Errorf("%s: unexpected error %v", tc.canonical, err)
+		}
+		if got := tc.path.String(); got != tc.canonical {
+			t.Errorf("String() = %s, want %s", got, tc.canonical)
+		}
+		if got := tc.path.SlashString(); got != tc.slashSyntax {
+			t.Errorf("SlashString() = %s, want %s", got, tc.slashSyntax)
+		}
+		for _, s := range []string{tc.canonical, tc.slashSyntax} {
+			parsed, err := ParsePath(s)
+			if err != nil {
+				t.Errorf("ParsePath(%s) error: %v", s, err)
+				continue
+			}
+			if !reflect.DeepEqual(parsed.steps, tc.path.steps) {
+				t.Errorf("ParsePath(%s) = %+v, want %+v", s, parsed.steps, tc.path.steps)
+			}
+		}
+	}
+}
+
+func TestPathBuilderQueries(t *testing.T) {
+	root, err := ParseWithOptions([]byte(`{
+		"store": {"book": [
+			{"title": "A", "price": 8, "tags": ["go"]},
+			{"title": "B", "price": 12, "tags": ["rust"]},
+			{"title": "C", "price": 5}
+		]},
+		"a.b": {"it's": {"[x]": {"": 1}}}
+	}`), ParseOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	base := NewPath().Key("store").Key("book")
+	if got := root.QueryPath(base.Index(2).Key("title")).String(); got != "C" {
+		t.Errorf("title = %q, want C", got)
+	}
+	if got := root.QueryPath(NewPath().Key("a.b").Key("it's").Key("[x]").Key("")).Int(); got != 1 {
+		t.Errorf("special keys = %d, want 1", got)
+	}
+
+	cheap := base.Where(Field("price").Lt(10).And(Field("tags", 0).Eq("go").Or(Field("tags").Exists().Not()))).Key("title")
+	if got, want := cheap.String(), "/store/book[?((@.price < 10) && ((@.tags[0] == 'go') || !!is_missing(@.tags)))]/title"; got != want {
+		t.Errorf("String() = %s, want %s", got, want)
+	}
+	var titles []string
+	for _, n := range root.QueryPath(cheap).Array() {
+		titles = append(titles, n.String())
+	}
+	if !reflect.DeepEqual(titles, []string{"A", "C"}) {
+		t.Errorf("cheap titles = %v, want [A C]", titles)
+	}
+	if got := root.Query(cheap.SlashString()).Len(); got != 2 {
+		t.Errorf("SlashString query matched %d, want 2", got)
+	}
+
+	// Extending a shared prefix never changes it or its other extensions.
+	first := base.Index(0)
+	second := base.Index(1)
+	if first.String() != "/store/book[0]" || second.String() != "/store/book[1]" || base.String() != "/store/book" {
+		t.Errorf("shared prefix changed: %s %s %s", base, first, second)
+	}
+}
+
+func TestPathBuilderErrors(t *testing.T) {
+	for name, p := range map[string]PathBuilder{
+		"recursive dot":  NewPath().Recursive("a.b"),
+		"recursive star": NewPath().Recursive("*"),
+		"function":       NewPath().Func("a-b"),
+		"function arg":   NewPath().Func("f", []int{1}),
+		"filter":         NewPath().Filter("@.a =="),
+		"pick":           NewPath().Pick("a,b"),
+		"field step":     NewPath().Where(Field(1.5).Eq(1)),
+		"literal":        NewPath().Where(Field("a").Eq(struct{}{})),
+		"set literal":    NewPath().Where(Field("a").ContainsAny(1, []int{2})),
+	} {
+		if p.Err() == nil {
+			t.Errorf("%s: expected an error", name)
+			continue
+		}
+		if again := p.Key("x"); again.Err() != p.Err() || again.String() != p.String() {
+			t.Errorf("%s: steps after an error were not ignored", name)
+		}
+		root, _ := ParseWithOptions([]byte(`{}`), ParseOptions{})
+		var pathErr *core.PathError
+		if result := root.QueryPath(p); result.IsValid() || !errors.As(result.Error(), &pathErr) || pathErr.Op != "QueryPath" {
+			t.Errorf("%s: QueryPath = %v, want a QueryPath *core.PathError", name, result.Error())
+		}
+	}
+	if !errors.Is(NewPath().Where(Field("a").Eq(struct{}{})).Err(), core.ErrInvalidParam) {
+		t.Error("unsupported literal does not wrap ErrInvalidParam")
+	}
+	if _, err := ParsePath("/a/["); err == nil {
+		t.Error("ParsePath accepted an unterminated bracket")
+	}
+}
@@ -0,0 +1,172 @@
+package engine
+
+import (
+	"strconv"
+	"strings"
+
+	"github.com/474420502/xjson/internal/core"
+)
+
+// locator finds where nodes of a document are. Finding the key or index of
+// one node means searching its parent's children; with index set, each
+// parent's children are indexed on first use instead, and the segments of
+// each parent remembered, so that locating every match of a large result
+// costs one pass over the containers involved.
+type locator struct {
+	index   bool
+	segs    map[core.Node][]core.PathSegment
+	keys    map[*objectNode]map[core.Node]string
+	indices map[*arrayNode]map[core.Node]int
+}
+
+// locate returns the segments from the root of the document to node, or
+// false for a node that is not in it. A match of a recursive scan, parsed
+// on its own from the source, is located as the document node at the same
+// bytes.
+func (l *locator) locate(node core.Node) ([]core.PathSegment, bool) {
+	if top := nodeBase(topNode(node)); top != nil && top.origin != nil {
+		attached, ok := findBySource(top.origin, node)
+		if !ok {
+			return nil, false
+		}
+		node = attached
+	}
+	return l.walk(node)
+}
+
+// walk returns the segments of node found through its parents.
+func (l *locator) walk(node core.Node) ([]core.PathSegment, bool) {
+	b := nodeBase(node)
+	if b == nil || b.err != nil {
+		return nil, false
+	}
+	if b.parent == nil {
+		return []core.PathSegment{}, true
+	}
+	if segs, ok := l.segs[node]; ok {
+		return segs, true
+	}
+	seg, ok := l.step(b.parent, node)
+	if !ok {
+		return nil, false
+	}
+	parentSegs, ok := l.walk(b.parent)
+	if !ok {
+		return nil, false
+	}
+	// Cap the parent's segments so siblings do not share a backing array.
+	segs := append(parentSegs[:len(parentSegs):len(parentSegs)], seg)
+	if l.index && (node.Type() == core.Object || node.Type() == core.Array) {
+		if l.segs == nil {
+			l.segs = make(map[core.Node][]core.PathSegment)
+		}
+		l.segs[node] = segs
+	}
+	return segs, true
+}
+
+// step returns the segment from parent to child.
+func (l *locator) step(parent, child core.Node) (core.PathSegment, bool) {
+	switch p := parent.(type) {
+	case *objectNode:
+		if !l.index {
+			key, ok := findObjectChildKey(p, child)
+			return core.KeySegment(key), ok
+		}
+		keys, ok := l.keys[p]
+		if !ok {
+			if !p.parsed.Load() {
+				p.lazyParse()
+			}
+			keys = make(map[core.Node]string, len(p.value))
+			for k, v := range p.value {
+				keys[v] = k
+			}
+			if l.keys == nil {
+				l.keys = make(map[*objectNode]map[core.Node]string)
+			}
+			l.keys[p] = keys
+		}
+		key, ok := keys[child]
+		return core.KeySegment(key), ok
+	case *arrayNode:
+		if p.matchSet || p.selection {
+			return core.PathSegment{}, false
+		}
+		if !l.index {
+			i, ok := findArrayChildIndex(p, child)
+			return core.IndexSegment(i), ok
+		}
+		indices, ok := l.indices[p]
+		if !ok {
+			if !p.parsed.Load() {
+				p.lazyParse()
+			}
+			indices = make(map[core.Node]int, len(p.value))
+			for i, v := range p.value {
+				indices[v] = i
+			}
+			if l.indices == nil {
+				l.indices = make(map[*arrayNode]map[core.Node]int)
+			}
+			l.indices[p] = indices
+		}
+		i, ok := indices[child]
+		return core.IndexSegment(i), ok
+	}
+	return core.PathSegment{}, false
+}
+
+// formatSegments spells segments out the way Path does.
+func formatSegments(segs []core.PathSegment) string {
+	var sb strings.Builder
+	for _, seg := range segs {
+		if seg.IsIndex {
+			sb.WriteByte('[')
+			sb.WriteString(strconv.Itoa(seg.Index))
+			sb.WriteByte(']')
+		} else {
+			sb.WriteByte('/')
+			sb.WriteString(formatPathKey(seg.Key))
+		}
+	}
+	return sb.String()
+}
+
+// PathSegments returns the keys and indices from the root to the node.
+func (n *baseNode) PathSegments() ([]core.PathSegment, bool) {
+	var l locator
+	return l.locate(n.selfOrMe())
+}
+
+// ForEachPath calls fn with the path in the document of each value ForEach
+// visits, until fn returns false.
+func (n *baseNode) ForEachPath(fn func(path string, value core.Node) bool) {
+	n.ForEachSegments(func(segs []core.PathSegment, value core.Node) bool {
+		if segs == nil {
+			return fn(value.Path(), value)
+		}
+		return fn(formatSegments(segs), value)
+	})
+}
+
+// ForEachSegments calls fn with the path segments of each value ForEach
+// visits, until fn returns false.
+func (n *baseNode) ForEachSegments(fn func(segments []core.PathSegment, value core.Node) bool) {
+	l := locator{index: true}
+	stopped := false
+	n.selfOrMe().ForEach(func(_ interface{}, value core.Node) {
+		if stopped {
+			return
+		}
+		segs, ok := l.locate(value)
+		if !ok {
+			segs = nil
+		} else if t := value.Type(); t == core.Object || t == core.Array {
+			// The segments of a container are kept to locate what is
+			// below it; fn gets a copy.
+			segs = append([]core.PathSegment(nil), segs...)
+		}
+		stopped = !fn(segs, value)
+	})
+}
@@ -0,0 +1,160 @@
+package engine
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/474420502/xjson/internal/core"
+)
+
+const teamsDoc = `{"teams":[
+	{"name":"a","active":true,"members":[{"id":1},{"id":2}]},
+	{"name":"b","active":false,"members":[{"id":3}]},
+	{"name":"c","active":true,"members":[{"id":4},{"id":5,"lead":{"id":6}}]}
+],"odd key":{"id":7}}`
+
+type segmentsVisit struct {
+	path string
+	segs []core.PathSegment
+}
+
+func collectSegments(node core.Node) []segmentsVisit {
+	var out []segmentsVisit
+	node.ForEachSegments(func(segs []core.PathSegment, _ core.Node) bool {
+		out = append(out, segmentsVisit{segs: segs})
+		return true
+	})
+	i := 0
+	node.ForEachPath(func(path string, _ core.Node) bool {
+		out[i].path = path
+		i++
+		return true
+	})
+	return out
+}
+
+func TestForEachSegments(t *testing.T) {
+	key, index := core.KeySegment, core.IndexSegment
+	tests := []struct {
+		query string
+		want  []segmentsVisit
+	}{
+		{"/teams[*]/members//id", []segmentsVisit{
+			{"/teams[0]/members[0]/id", []core.PathSegment{key("teams"), index(0), key("members"), index(0), key("id")}},
+			{"/teams[0]/members[1]/id", []core.PathSegment{key("teams"), index(0), key("members"), index(1), key("id")}},
+			{"/teams[1]/members[0]/id", []core.PathSegment{key("teams"), index(1), key("members"), index(0), key("id")}},
+			{"/teams[2]/members[0]/id", []core.PathSegment{key("teams"), index(2), key("members"), index(0), key("id")}},
+			{"/teams[2]/members[1]/id", []core.PathSegment{key("teams"), index(2), key("members"), index(1), key("id")}},
+			{"/teams[2]/members[1]/lead/id", []core.PathSegment{key("teams"), index(2), key("members"), index(1), key("lead"), key("id")}},
+		}},
+		{"/teams[?(@.active == true)]/name", []segmentsVisit{
+			{"/teams[0]/name", []core.PathSegment{key("teams"), index(0), key("name")}},
+			{"/teams[2]/name", []core.PathSegment{key("teams"), index(2), key("name")}},
+		}},
+		{"//lead", []segmentsVisit{
+			{"/teams[2]/members[1]/lead", []core.PathSegment{key("teams"), index(2), key("members"), index(1), key("lead")}},
+		}},
+		{"/teams[1:3]/name", []segmentsVisit{
+			{"/teams[1]/name", []core.PathSegment{key("teams"), index(1), key("name")}},
+			{"/teams[2]/name", []core.PathSegment{key("teams"), index(2), key("name")}},
+		}},
+		{"/odd key", []segmentsVisit{
+			{"/['odd key']/id", []core.PathSegment{key("odd key"), key("id")}},
+		}},
+	}
+	for name, parse := range testParsers {
+		root, err := parse([]byte(teamsDoc))
+		if err != nil {
+			t.Fatalf("%s: parse failed: %v", name, err)
+		}
+		for _, tt := range tests {
+			if got := collectSegments(root.Query(tt.query)); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("%s: %s visits %v, want %v", name, tt.query, got, tt.want)
+			}
+		}
+
+		// A wildcard after a wildcard or a filter steps into every match,
+		// so each member comes with its own path.
+		members := collectSegments(root.Query("/teams[?(@.active == true)]/members[*]"))
+		want := []segmentsVisit{
+			{"/teams[0]/members[0]", []core.PathSegment{key("teams"), index(0), key("members"), index(0)}},
+			{"/teams[0]/members[1]", []core.PathSegment{key("teams"), index(0), key("members"), index(1)}},
+			{"/teams[2]/members[0]", []core.PathSegment{key("teams"), index(2), key("members"), index(0)}},
+			{"/teams[2]/members[1]", []core.PathSegment{key("teams"), index(2), key("members"), index(1)}},
+		}
+		if !reflect.DeepEqual(members, want) {
+			t.Errorf("%s: members of active teams visit %v, want %v", name, members, want)
+		}
+
+		var paths []string
+		root.Query("/teams[*]/members[*]").ForEachPath(func(path string, member core.Node) bool {
+			paths = append(paths, path)
+			if got := root.Query(path); got.Raw() != member.Raw() {
+				t.Errorf("%s: %s holds %s, visited %s", name, path, got.Raw(), member.Raw())
+			}
+			return true
+		})
+		if wantPaths := []string{"/teams[0]/members[0]", "/teams[0]/members[1]", "/teams[1]/members[0]", "/teams[2]/members[0]", "/teams[2]/members[1]"}; !reflect.DeepEqual(paths, wantPaths) {
+			t.Errorf("%s: /teams[*]/members[*] visits %v, want %v", name, paths, wantPaths)
+		}
+
+		root.Query("//id").ForEachPath(func(path string, value core.Node) bool {
+			if got := root.Query(path); got.Int() != value.Int() {
+				t.Errorf("%s: %s holds %s, visited %s", name, path, got.Raw(), value.Raw())
+			}
+			return true
+		})
+	}
+}
+
+func TestPathSegments(t *testing.T) {
+	root, _ := Parse([]byte(teamsDoc))
+	segs, ok := root.Query("/teams[2]/members[1]/lead/id").PathSegments()
+	want := []core.PathSegment{core.KeySegment("teams"), core.IndexSegment(2), core.KeySegment("members"), core.IndexSegment(1), core.KeySegment("lead"), core.KeySegment("id")}
+	if !ok || !reflect.DeepEqual(segs, want) {
+		t.Errorf("PathSegments() = %v, %v, want %v", segs, ok, want)
+	}
+	if segs, ok := root.PathSegments(); !ok || len(segs) != 0 {
+		t.Errorf("PathSegments() of the root = %v, %v, want none", segs, ok)
+	}
+	if _, ok := root.Query("/teams[*]").PathSegments(); ok {
+		t.Error("a match set should have no place in the document")
+	}
+	if _, ok := root.Query("/missing").PathSegments(); ok {
+		t.Error("an invalid node should have no place in the document")
+	}
+	// Matches of a recursive scan over unparsed text have their place too.
+	fresh, _ := Parse([]byte(teamsDoc))
+	if got := fresh.QueryFirst("//lead").Path(); got != "/teams[2]/members[1]/lead" {
+		t.Errorf("Path() of a scanned match = %q", got)
+	}
+
+	arr, _ := Parse([]byte(`[[1],[2,3]]`))
+	if got := collectSegments(arr.Index(1)); len(got) != 2 || got[1].path != "[1][1]" {
+		t.Errorf("paths in a root array = %v", got)
+	}
+}
+
+func TestForEachSegmentsStopsAndCopies(t *testing.T) {
+	root, _ := Parse([]byte(teamsDoc))
+	calls := 0
+	root.Query("//id").ForEachPath(func(string, core.Node) bool {
+		calls++
+		return calls < 2
+	})
+	if calls != 2 {
+		t.Errorf("ForEachPath made %d calls after fn returned false, want 2", calls)
+	}
+
+	// Segments handed out for a container are not those its descendants
+	// are located from.
+	root.Query("//*").ForEachSegments(func(segs []core.PathSegment, _ core.Node) bool {
+		if len(segs) > 0 {
+			if segs[0].Key == "changed" {
+				t.Errorf("segments %v carry a change made in an earlier visit", segs)
+			}
+			segs[0].Key = "changed"
+		}
+		return true
+	})
+}
@@ -0,0 +1,150 @@
+package engine
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+
+	"github.com/474420502/xjson/internal/core"
+)
+
+// pickField is one level of a Pick projection. A field without children
+// keeps the whole value; otherwise only the listed nested fields are kept.
+type pickField struct {
+	key      string
+	children []*pickField
+	whole    bool
+}
+
+// buildPickTree turns dotted field names such as "author.name" into a tree
+// that keeps the order in which fields were first listed. Picking a field
+// as a whole wins over picking some of its nested fields.
+func buildPickTree(fields []string) ([]*pickField, error) {
+	var root []*pickField
+	for _, field := range fields {
+		parts := strings.Split(field, ".")
+		level := &root
+		for i, part := range parts {
+			if part == "" {
+				return nil, fmt.Errorf("invalid pick field %q", field)
+			}
+			var f *pickField
+			for _, existing := range *level {
+				if existing.key == part {
+					f = existing
+					break
+				}
+			}
+			if f == nil {
+				f = &pickField{key: part}
+				*level = append(*level, f)
+			}
+			if f.whole {
+				break
+			}
+			if i == len(parts)-1 {
+				f.whole = true
+				f.children = nil
+				break
+			}
+			level = &f.children
+		}
+	}
+	return root, nil
+}
+
+// Pick returns a copy of an object that keeps only the listed fields, in the
+// order given. Nested fields are written as "author.name" and keep their
+// enclosing objects; missing fields are omitted. On an array or match set
+// every object element is picked and other elements are dropped. The copy is
+// built from the source bytes of the selected values, so unparsed objects
+// are scanned rather than fully materialized.
+func (n *baseNode) Pick(fields ...string) core.Node {
+	if n.err != nil {
+		return n.selfOrMe()
+	}
+	tree, err := buildPickTree(fields)
+	if err != nil {
+		return newInvalidNode(err)
+	}
+
+	self := n.selfOrMe()
+	switch self.Type() {
+	case core.Object:
+		var buf bytes.Buffer
+		writePickedObject(&buf, self, tree)
+		return NewObjectNode(nil, buf.Bytes(), n.funcs)
+	case core.Array:
+		a, ok := self.(*arrayNode)
+		if !ok {
+			break
+		}
+		var elems []core.Node
+		it := a.rawIter()
+		for it.Next() {
+			elems = append(elems, it.ParseValue())
+		}
+		if it.Err() != nil {
+			a.lazyParse()
+			elems = a.value
+		}
+		if a.matchSet {
+			results := make([]core.Node, 0, len(elems))
+			for _, elem := range elems {
+				if elem.IsValid() && elem.Type() == core.Object {
+					var buf bytes.Buffer
+					writePickedObject(&buf, elem, tree)
+					results = append(results, NewObjectNode(nil, buf.Bytes(), n.funcs))
+				}
+			}
+			return newMatchSet(self, results, n.funcs)
+		}
+		var buf bytes.Buffer
+		buf.WriteByte('[')
+		count := 0
+		for _, elem := range elems {
+			if elem.IsValid() && elem.Type() == core.Object {
+				if count > 0 {
+					buf.WriteByte(',')
+				}
+				writePickedObject(&buf, elem, tree)
+				count++
+			}
+		}
+		buf.WriteByte(']')
+		return NewArrayNode(nil, buf.Bytes(), n.funcs)
+	}
+	return newInvalidNode(fmt.Errorf("cannot pick fields from node type %s", self.Type()))
+}
+
+// writePickedObject writes the fields of obj selected by tree as a JSON
+// object and reports how many fields were written. Nested selections that
+// match nothing are left out entirely.
+func writePickedObject(buf *bytes.Buffer, obj core.Node, tree []*pickField) int {
+	buf.WriteByte('{')
+	count := 0
+	for _, f := range tree {
+		child := obj.Get(f.key)
+		if !child.IsValid() {
+			continue
+		}
+		if !f.whole && child.Type() != core.Object {
+			continue
+		}
+		mark := buf.Len()
+		if count > 0 {
+			buf.WriteByte(',')
+		}
+		writeJSONString(buf, f.key)
+		buf.WriteByte(':')
+		if f.whole {
+			writeJSONValue(buf, child)
+		} else if writePickedObject(buf, child, f.children) == 0 {
+			buf.Truncate(mark)
+			continue
+		}
+		count++
+	}
+	buf.WriteByte('}')
+	return count
+}
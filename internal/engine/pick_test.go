@@ -0,0 +1,103 @@
+package engine
+
+import (
+	"testing"
+
+	"github.com/474420502/xjson/internal/core"
+)
+
+const pickStore = `{"store":{"book":[
+	{"title":"A","price":8.5,"isbn":"1","author":{"name":"Ann","born":1970}},
+	{"title":"B \"two\"","isbn":"2","author":{"born":1980}},
+	{"title":"C","price":12,"author":"anonymous"},
+	"not an object"
+],"bicycle":{"color":"red","price":19.95}}}`
+
+func TestPickObjectFields(t *testing.T) {
+	root, err := Parse([]byte(pickStore))
+	if err != nil {
+		t.Fatalf("Parse failed: %v", err)
+	}
+
+	testCases := []struct {
+		path   string
+		fields []string
+		want   string
+	}{
+		{"/store/bicycle", []string{"price", "color"}, `{"price":19.95,"color":"red"}`},
+		{"/store/bicycle", []string{"color", "missing"}, `{"color":"red"}`},
+		{"/store/book[0]", []string{"title", "author.name"}, `{"title":"A","author":{"name":"Ann"}}`},
+		{"/store/book[0]", []string{"author.name", "author"}, `{"author":{"name":"Ann","born":1970}}`},
+		{"/store/book[1]", []string{"title", "author.name"}, `{"title":"B \"two\""}`},
+		{"/store/book[2]", []string{"author.name"}, `{}`},
+	}
+	for _, tc := range testCases {
+		picked := root.Query(tc.path).Pick(tc.fields...)
+		got, err := picked.Bytes()
+		if err != nil {
+			t.Fatalf("Pick(%v) on %s failed: %v", tc.fields, tc.path, err)
+		}
+		if string(got) != tc.want {
+			t.Fatalf("Pick(%v) on %s = %s, want %s", tc.fields, tc.path, got, tc.want)
+		}
+	}
+}
+
+func TestPickArraysAndMatchSets(t *testing.T) {
+	root, err := Parse([]byte(pickStore))
+	if err != nil {
+		t.Fatalf("Parse failed: %v", err)
+	}
+
+	want := `[{"title":"A","price":8.5},{"title":"B \"two\""},{"title":"C","price":12}]`
+	if got, err := root.Query("/store/book").Pick("title", "price").Bytes(); err != nil || string(got) != want {
+		t.Fatalf("array Pick = %s, %v; want %s", got, err, want)
+	}
+	if got, err := root.Query("/store/book[*]{title, price}").Bytes(); err != nil || string(got) != want {
+		t.Fatalf("query pick = %s, %v; want %s", got, err, want)
+	}
+	if got := root.Query("/store/book[?(@.price > 10)]{title}").String(); got != `{"title":"C"}` {
+		t.Fatalf("filter pick = %s", got)
+	}
+	if got := root.Query("/store/book[*]{title,author.name}/author/name").String(); got != "Ann" {
+		t.Fatalf("query after pick = %s", got)
+	}
+	if got := root.Query("/store/book[?(@.price > 100)]").Pick("title"); !got.IsValid() || got.Len() != 0 {
+		t.Fatalf("expected an empty match set, got %s (%v)", got.String(), got.Error())
+	}
+
+	if got := root.Query("/store/bicycle/color").Pick("x"); got.IsValid() {
+		t.Fatal("expected Pick on a string to fail")
+	}
+	if got := root.Query("/store/bicycle").Pick("a..b"); got.IsValid() {
+		t.Fatal("expected an empty field segment to fail")
+	}
+	for _, path := range []string{"/store/book{title", "/store/book{}", "/store/book{a,,b}", "/store/book{a/b}"} {
+		if got := root.Query(path); got.IsValid() {
+			t.Fatalf("expected %q to fail", path)
+		}
+	}
+}
+
+func TestPickKeepsSourceUnparsed(t *testing.T) {
+	root, err := Parse([]byte(`{"items":[{"id":1,"blob":{"deep":[1,2,3]},"name":"x"},{"id":2,"blob":{},"name":"y"}]}`))
+	if err != nil {
+		t.Fatalf("Parse failed: %v", err)
+	}
+	items := root.Get("items").(*arrayNode)
+	picked := items.Pick("id", "name")
+	if got := picked.String(); got != `[{"id":1,"name":"x"},{"id":2,"name":"y"}]` {
+		t.Fatalf("unexpected pick result %s", got)
+	}
+	if items.parsed.Load() {
+		t.Fatal("expected Pick to scan the source array without parsing it")
+	}
+
+	picked.Index(0).Set("id", 9)
+	if got := root.Query("/items[0]/id").Int(); got != 1 {
+		t.Fatalf("expected the picked copy to be independent, source id = %d", got)
+	}
+	if picked.Type() != core.Array || picked.Parent() != nil {
+		t.Fatalf("expected a standalone array, got %s", picked.Type())
+	}
+}
@@ -0,0 +1,279 @@
+package engine
+
+import (
+	"sync"
+	"sync/atomic"
+
+	"github.com/474420502/xjson/internal/core"
+)
+
+const (
+	minPoolBlock = 16
+	maxPoolBlock = 4096
+)
+
+// Node kinds a nodeArena allocates blocks for.
+const (
+	arenaObject = iota
+	arenaArray
+	arenaString
+	arenaNumber
+	arenaBool
+	arenaNull
+	arenaKey // object key order slices, counted in keys
+	arenaKinds
+)
+
+// NodePool lets documents parsed with ParseOptions.Pool allocate their nodes
+// in blocks instead of one at a time. The pool remembers how many nodes of
+// each kind released documents used and sizes the first blocks of the next
+// document accordingly, so a steady stream of similar documents needs a
+// handful of allocations per document rather than one per value.
+//
+// Node memory is never handed to another document: a node kept past Release
+// reports ErrReleased instead of silently showing someone else's data. A
+// NodePool is safe for concurrent use.
+type NodePool struct {
+	hints [arenaKinds]atomic.Int64
+}
+
+// NewNodePool returns an empty NodePool.
+func NewNodePool() *NodePool {
+	return &NodePool{}
+}
+
+// nodeArena hands out the nodes of one pooled document.
+type nodeArena struct {
+	pool     *NodePool
+	mu       sync.Mutex
+	released bool
+	counts   [arenaKinds]int
+	objects  []objectNode
+	arrays   []arrayNode
+	strs     []stringNode
+	nums     []numberNode
+	bools    []boolNode
+	nulls    []nullNode
+	keys     []string
+	// nodes lists every node handed out so Release can mark them.
+	nodes []*baseNode
+}
+
+func (p *NodePool) newArena() *nodeArena {
+	return &nodeArena{pool: p}
+}
+
+// blockSize returns the length of the next block of kind: the previous
+// document's count for the first block, then twice what is in use so far.
+func (a *nodeArena) blockSize(kind int) int {
+	size := int(a.pool.hints[kind].Load())
+	if used := a.counts[kind]; used > 0 {
+		size = 2 * used
+	}
+	return min(max(size, minPoolBlock), maxPoolBlock)
+}
+
+// track records a new node; it must be called with a.mu held.
+func (a *nodeArena) track(kind int, n *baseNode) {
+	a.counts[kind]++
+	n.arena = a
+	a.nodes = append(a.nodes, n)
+}
+
+func (a *nodeArena) object() *objectNode {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if len(a.objects) == 0 {
+		a.objects = make([]objectNode, a.blockSize(arenaObject))
+	}
+	n := &a.objects[0]
+	a.objects = a.objects[1:]
+	a.track(arenaObject, &n.baseNode)
+	return n
+}
+
+func (a *nodeArena) array() *arrayNode {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if len(a.arrays) == 0 {
+		a.arrays = make([]arrayNode, a.blockSize(arenaArray))
+	}
+	n := &a.arrays[0]
+	a.arrays = a.arrays[1:]
+	a.track(arenaArray, &n.baseNode)
+	return n
+}
+
+func (a *nodeArena) str() *stringNode {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if len(a.strs) == 0 {
+		a.strs = make([]stringNode, a.blockSize(arenaString))
+	}
+	n := &a.strs[0]
+	a.strs = a.strs[1:]
+	a.track(arenaString, &n.baseNode)
+	return n
+}
+
+func (a *nodeArena) number() *numberNode {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if len(a.nums) == 0 {
+		a.nums = make([]numberNode, a.blockSize(arenaNumber))
+	}
+	n := &a.nums[0]
+	a.nums = a.nums[1:]
+	a.track(arenaNumber, &n.baseNode)
+	return n
+}
+
+func (a *nodeArena) boolean() *boolNode {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if len(a.bools) == 0 {
+		a.bools = make([]boolNode, a.blockSize(arenaBool))
+	}
+	n := &a.bools[0]
+	a.bools = a.bools[1:]
+	a.track(arenaBool, &n.baseNode)
+	return n
+}
+
+func (a *nodeArena) null() *nullNode {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if len(a.nulls) == 0 {
+		a.nulls = make([]nullNode, a.blockSize(arenaNull))
+	}
+	n := &a.nulls[0]
+	a.nulls = a.nulls[1:]
+	a.track(arenaNull, &n.baseNode)
+	return n
+}
+
+// keyOrder returns an empty slice with room for n object keys.
+func (a *nodeArena) keyOrder(n int) []string {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if len(a.keys) < n {
+		a.keys = make([]string, max(n, a.blockSize(arenaKey)))
+	}
+	s := a.keys[:0:n]
+	a.keys = a.keys[n:]
+	a.counts[arenaKey] += n
+	return s
+}
+
+// release marks every node of the document with ErrReleased, passes the
+// node counts on to the pool and drops the arena's references. It is a
+// no-op after the first call.
+func (a *nodeArena) release() {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if a.released {
+		return
+	}
+	a.released = true
+	for _, n := range a.nodes {
+		n.err = core.ErrReleased
+	}
+	for kind, count := range a.counts {
+		a.pool.hints[kind].Store(int64(count))
+	}
+	a.nodes = nil
+	a.objects, a.arrays, a.strs, a.nums, a.bools, a.nulls = nil, nil, nil, nil, nil, nil
+	a.keys = nil
+}
+
+// Release ends the life of a document parsed with a NodePool: the node and
+// every other node of its document report ErrReleased from then on, and the
+// pool uses the document's size for the next one. It must not run
+// concurrently with other calls on the document. Release does nothing for
+// documents parsed without a pool.
+func (n *baseNode) Release() {
+	if n.arena != nil {
+		n.arena.release()
+	}
+}
+
+// The parser allocates through these helpers so that pooled documents place
+// their nodes in the arena's blocks.
+
+func (p *parser) newObjectNode(parent core.Node, raw []byte) *objectNode {
+	if p.arena == nil {
+		return NewObjectNode(parent, raw, p.funcs).(*objectNode)
+	}
+	return initObjectNode(p.arena.object(), parent, raw, p.funcs)
+}
+
+// parsedMember is an object member a pooled parse has read but not yet
+// stored.
+type parsedMember struct {
+	key   string
+	value core.Node
+}
+
+// finishMembers stores the members read since base into node. Building the
+// map and key order once the count is known spares a pooled parse growing
+// them key by key; later duplicates overwrite the value but keep the first
+// position, as in the unpooled parse.
+func (p *parser) finishMembers(node *objectNode, base int) {
+	members := p.members[base:]
+	if len(members) > 0 {
+		node.value = make(map[string]core.Node, len(members))
+		node.keyOrder = p.arena.keyOrder(len(members))
+		for _, m := range members {
+			if _, dup := node.value[m.key]; !dup {
+				node.keyOrder = append(node.keyOrder, m.key)
+				node.value[m.key] = m.value
+			} else if p.duplicateKeys != FirstWins {
+				node.value[m.key] = m.value
+			}
+		}
+	}
+	clear(members)
+	p.members = p.members[:base]
+}
+
+func (p *parser) newArrayNode(parent core.Node) *arrayNode {
+	if p.arena == nil {
+		return NewArrayNode(parent, nil, p.funcs).(*arrayNode)
+	}
+	return initArrayNode(p.arena.array(), parent, nil, p.funcs)
+}
+
+func (p *parser) newRawStringNode(parent core.Node, raw []byte) *stringNode {
+	if p.arena == nil {
+		return NewRawStringNode(parent, raw, 1, len(raw)-1, false, p.funcs).(*stringNode)
+	}
+	return initRawStringNode(p.arena.str(), parent, raw, 1, len(raw)-1, false, p.funcs)
+}
+
+func (p *parser) newDecodedStringNode(parent core.Node, decoded []byte) *stringNode {
+	if p.arena == nil {
+		return NewDecodedStringNode(parent, decoded, p.funcs).(*stringNode)
+	}
+	return initDecodedStringNode(p.arena.str(), parent, decoded, p.funcs)
+}
+
+func (p *parser) newNumberNode(parent core.Node, raw []byte) *numberNode {
+	if p.arena == nil {
+		return NewNumberNode(parent, raw, p.funcs).(*numberNode)
+	}
+	return initNumberNode(p.arena.number(), parent, raw, p.funcs)
+}
+
+func (p *parser) newBoolNode(parent core.Node, val bool) *boolNode {
+	if p.arena == nil {
+		return NewBoolNode(parent, val, p.funcs).(*boolNode)
+	}
+	return initBoolNode(p.arena.boolean(), parent, val, p.funcs)
+}
+
+func (p *parser) newNullNode(parent core.Node) *nullNode {
+	if p.arena == nil {
+		return NewNullNode(parent, p.funcs).(*nullNode)
+	}
+	return initNullNode(p.arena.null(), parent, p.funcs)
+}
@@ -0,0 +1,173 @@
+package engine
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/474420502/xjson/internal/core"
+)
+
+const poolDoc = `{"id":7,"name":"pool","tags":["a","b\"c"],"ok":true,"none":null,
+	"items":[{"sku":"x1","qty":2,"price":1.5},{"sku":"x2","qty":0,"price":20}],"meta":{"deep":{"v":[1,[2,3]]}}}`
+
+// countNodes visits every value below n, parsing the whole tree.
+func countNodes(n core.Node) int {
+	count := 1
+	if n.Type() != core.Object && n.Type() != core.Array {
+		return count
+	}
+	n.ForEach(func(_ interface{}, v core.Node) {
+		count += countNodes(v)
+	})
+	return count
+}
+
+func TestPooledDocumentMatchesUnpooled(t *testing.T) {
+	pool := NewNodePool()
+	paths := []string{"/id", "/tags[1]", "/items[1]/price", "/items/sku", "/meta/deep/v[1][0]", "//qty", "/none", "/missing"}
+	for round := 0; round < 3; round++ {
+		plain, err := Parse([]byte(poolDoc))
+		if err != nil {
+			t.Fatalf("Parse failed: %v", err)
+		}
+		pooled, err := ParseWithOptions([]byte(poolDoc), ParseOptions{Pool: pool})
+		if err != nil {
+			t.Fatalf("pooled parse failed: %v", err)
+		}
+		for _, path := range paths {
+			want, got := plain.Query(path), pooled.Query(path)
+			if want.IsValid() != got.IsValid() || want.String() != got.String() {
+				t.Fatalf("round %d: pooled %s = %v, want %v", round, path, got, want)
+			}
+		}
+		if got, want := countNodes(pooled), countNodes(plain); got != want {
+			t.Fatalf("round %d: pooled tree has %d nodes, want %d", round, got, want)
+		}
+		pooled.Get("items").Index(0).Set("qty", 5)
+		plain.Get("items").Index(0).Set("qty", 5)
+		if pooled.String() != plain.String() {
+			t.Fatalf("round %d: pooled = %s, want %s", round, pooled.String(), plain.String())
+		}
+		pooled.Release()
+	}
+}
+
+func TestReleasedDocumentFailsSafely(t *testing.T) {
+	root, err := ParseWithOptions([]byte(poolDoc), ParseOptions{Pool: NewNodePool()})
+	if err != nil {
+		t.Fatalf("pooled parse failed: %v", err)
+	}
+	items := root.Get("items")
+	sku := root.Query("/items[0]/sku")
+	if sku.String() != "x1" {
+		t.Fatalf("sku = %q, want x1", sku.String())
+	}
+	root.Release()
+	root.Release()
+
+	for name, got := range map[string]core.Node{
+		"root.Query":  root.Query("/id"),
+		"root.Get":    root.Get("name"),
+		"items.Index": items.Index(1),
+		"items.Query": items.Query("[0]/qty"),
+	} {
+		if got.IsValid() || !errors.Is(got.Error(), core.ErrReleased) {
+			t.Fatalf("%s after Release = %v (err %v), want ErrReleased", name, got, got.Error())
+		}
+	}
+	if _, err := sku.TryString(); !errors.Is(err, core.ErrReleased) {
+		t.Fatalf("TryString after Release = %v, want ErrReleased", err)
+	}
+	if _, err := root.Bytes(); !errors.Is(err, core.ErrReleased) {
+		t.Fatalf("Bytes after Release = %v, want ErrReleased", err)
+	}
+	if root.Has("/id") || root.IsValid() {
+		t.Fatal("expected a released root to be invalid")
+	}
+}
+
+func TestReleaseWithoutPoolIsNoop(t *testing.T) {
+	root, _ := Parse([]byte(poolDoc))
+	root.Release()
+	if got := root.Query("/id").Int(); got != 7 {
+		t.Fatalf("Query after Release without pool = %d, want 7", got)
+	}
+}
+
+func TestNodePoolSizesBlocksFromReleasedDocuments(t *testing.T) {
+	pool := NewNodePool()
+	root, _ := ParseWithOptions([]byte(poolDoc), ParseOptions{Pool: pool})
+	countNodes(root)
+	root.Release()
+	if got := pool.hints[arenaNumber].Load(); got != 8 {
+		t.Fatalf("number hint = %d, want 8", got)
+	}
+
+	big := []byte(fmt.Sprintf("[%s1]", strings.Repeat("1,", 999)))
+	root, _ = ParseWithOptions(big, ParseOptions{Pool: pool})
+	countNodes(root)
+	root.Release()
+	arena := pool.newArena()
+	if got := arena.blockSize(arenaNumber); got != 1000 {
+		t.Fatalf("first number block = %d, want 1000", got)
+	}
+}
+
+func TestNodePoolReducesAllocations(t *testing.T) {
+	data := []byte(poolDoc)
+	plain := testing.AllocsPerRun(50, func() {
+		root, _ := ParseWithOptions(data, ParseOptions{})
+		countNodes(root)
+	})
+	pool := NewNodePool()
+	pooled := testing.AllocsPerRun(50, func() {
+		root, _ := ParseWithOptions(data, ParseOptions{Pool: pool})
+		countNodes(root)
+		root.Release()
+	})
+	if pooled >= plain {
+		t.Fatalf("pooled parse made %.0f allocations, unpooled %.0f", pooled, plain)
+	}
+}
+
+func TestNodePoolConcurrentDocuments(t *testing.T) {
+	pool := NewNodePool()
+	var wg sync.WaitGroup
+	for g := 0; g < 8; g++ {
+		wg.Add(1)
+		go func(g int) {
+			defer wg.Done()
+			for i := 0; i < 200; i++ {
+				root, err := ParseWithOptions([]byte(poolDoc), ParseOptions{Pool: pool})
+				if err != nil {
+					t.Errorf("parse failed: %v", err)
+					return
+				}
+				// Lazy parsing of one document from several goroutines also
+				// allocates from its arena concurrently.
+				var inner sync.WaitGroup
+				for _, path := range []string{"/items[1]/sku", "/meta/deep/v[1][1]", "/tags[0]"} {
+					inner.Add(1)
+					go func(path string) {
+						defer inner.Done()
+						if !root.Query(path).IsValid() {
+							t.Errorf("goroutine %d: %s not found", g, path)
+						}
+					}(path)
+				}
+				inner.Wait()
+				if root.Query("/id").Int() != 7 {
+					t.Errorf("goroutine %d: wrong id", g)
+				}
+				root.Release()
+				if !errors.Is(root.Query("/id").Error(), core.ErrReleased) {
+					t.Errorf("goroutine %d: released document still answers", g)
+				}
+			}
+		}(g)
+	}
+	wg.Wait()
+}
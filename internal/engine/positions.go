@@ -0,0 +1,211 @@
+package engine
+
+import (
+	"bytes"
+	"errors"
+	"unicode/utf8"
+	"unsafe"
+
+	"github.com/474420502/xjson/internal/core"
+)
+
+// ParseOptions tunes how a document is parsed.
+type ParseOptions struct {
+	// TrackPositions makes Node.Position report where values start in the
+	// source. Positions are computed on demand from the source bytes.
+	TrackPositions bool
+	// Pool allocates the document's nodes in blocks from a NodePool. Call
+	// Release on the root once the document is no longer needed.
+	Pool *NodePool
+	// ValidateUTF8 rejects documents whose strings contain malformed
+	// escapes, unpaired surrogate escapes or invalid UTF-8 bytes with a
+	// positioned *core.SyntaxError. The whole source is checked up front,
+	// so values parsed lazily later cannot fail on their encoding.
+	ValidateUTF8 bool
+	// DuplicateKeys decides which member counts when an object repeats a
+	// key: the last one by default, like encoding/json, or the first one.
+	// ErrorOnDuplicate rejects such documents with a *core.SyntaxError
+	// naming the key and its offset. Lazy lookups, queries and full parses
+	// all follow the same policy.
+	DuplicateKeys DuplicateKeyPolicy
+	// Dialect selects the accepted syntax, standard JSON by default. A
+	// JSON5 document is validated and rewritten as standard JSON before it
+	// is parsed, so lazy lookups and queries behave as on any other
+	// document, serialization emits standard JSON, and positions and raw
+	// values refer to the rewritten text.
+	Dialect Dialect
+	// AllowTrailingCommas accepts a comma after the last element of an
+	// array or member of an object, and AllowTrailingData text after the
+	// top-level value, which RFC 8259 rejects as MustParse and Scan do.
+	// Values parsed lazily later follow the same rules.
+	AllowTrailingCommas bool
+	AllowTrailingData   bool
+	// AllowNonFinite accepts the JSON5 literals Infinity, -Infinity and NaN,
+	// which are rejected by default. They are captured as numbers whose
+	// Float and TryFloat are ±Inf and NaN, unlike a number too large for a
+	// float64 such as 1e999, which TryFloat rejects. JSON has no text for
+	// them: Bytes, WriteTo and CanonicalBytes fail with an error wrapping
+	// core.ErrNumberOverflow while the encoding holds one, and String
+	// returns "".
+	AllowNonFinite bool
+	// StrictConversionErrors makes Int, Float, IntRound, IntFloor and the
+	// Lenient variants record why a value could not be converted for
+	// LastError: a *core.PathError wrapping the *core.TypeError of a value
+	// that is not a number, or of a number that is not an int64. They
+	// return the same values either way; by default they fail without a
+	// trace.
+	StrictConversionErrors bool
+	// MaxRecursionDepth bounds how deep recursive queries, such as //id,
+	// //* and Leaves, descend below the node they start from, its children
+	// being at depth 1. A query that meets a value deeper than that fails
+	// with an error wrapping core.ErrMaxDepthExceeded instead of returning
+	// the matches above it. Zero means no limit.
+	MaxRecursionDepth int
+	// Preload lists paths of key and index steps, as for SetByPath, whose
+	// values are parsed while parsing the document, so the first queries of
+	// them find them ready. The objects leading to them are scanned up to
+	// the members needed; everything else stays lazy. Paths that find
+	// nothing are skipped unless RequirePreload is set, which makes them
+	// fail the parse with a *core.PathError wrapping core.ErrNotFound.
+	Preload        []string
+	RequirePreload bool
+}
+
+// ParseWithOptions parses data lazily like Parse, applying opts.
+func ParseWithOptions(data []byte, opts ParseOptions) (core.Node, error) {
+	if opts.Dialect == JSON5 {
+		standard, err := transcodeJSON5(data, opts.AllowNonFinite)
+		if err != nil {
+			return nil, err
+		}
+		data = standard
+	}
+	if opts.ValidateUTF8 {
+		if err := validateStrings(data); err != nil {
+			return nil, err
+		}
+	}
+	if opts.DuplicateKeys == ErrorOnDuplicate {
+		if err := checkDuplicateKeys(data); err != nil {
+			return nil, err
+		}
+	}
+	var arena *nodeArena
+	if opts.Pool != nil {
+		arena = opts.Pool.newArena()
+	}
+	lenient := leniency{
+		trailingCommas: opts.AllowTrailingCommas,
+		trailingData:   opts.AllowTrailingData,
+		nonFinite:      opts.Dialect == JSON5 && opts.AllowNonFinite,
+	}
+	node, err := parseLazy(data, &map[string]core.UnaryPathFunc{}, arena, lenient)
+	if err != nil {
+		return nil, err
+	}
+	if bn := nodeBase(node); bn != nil {
+		bn.trackPositions = opts.TrackPositions
+		bn.duplicateKeys = opts.DuplicateKeys
+		bn.strictConversions = opts.StrictConversionErrors
+		bn.maxRecursionDepth = opts.MaxRecursionDepth
+	}
+	if len(opts.Preload) > 0 {
+		if err := preload(node, opts.Preload, opts.RequirePreload); err != nil {
+			return nil, err
+		}
+	}
+	return node, nil
+}
+
+// nodeBase returns the embedded baseNode of an engine node.
+func nodeBase(node core.Node) *baseNode {
+	switch n := node.(type) {
+	case *objectNode:
+		return &n.baseNode
+	case *arrayNode:
+		return &n.baseNode
+	case *stringNode:
+		return &n.baseNode
+	case *numberNode:
+		return &n.baseNode
+	case *boolNode:
+		return &n.baseNode
+	case *nullNode:
+		return &n.baseNode
+	case *invalidNode:
+		return &n.baseNode
+	}
+	return nil
+}
+
+// rootBase walks up to the node without a parent.
+func rootBase(n *baseNode) *baseNode {
+	for n.parent != nil {
+		parent := nodeBase(n.parent)
+		if parent == nil || parent == n {
+			break
+		}
+		n = parent
+	}
+	return n
+}
+
+// sourceOffset returns the byte offset of data within source when data is a
+// sub-slice of it.
+func sourceOffset(source, data []byte) (int, bool) {
+	if len(source) == 0 || len(data) == 0 {
+		return 0, false
+	}
+	base := uintptr(unsafe.Pointer(unsafe.SliceData(source)))
+	ptr := uintptr(unsafe.Pointer(unsafe.SliceData(data)))
+	if ptr < base || ptr >= base+uintptr(len(source)) {
+		return 0, false
+	}
+	return int(ptr - base), true
+}
+
+// positionAt converts a byte offset of data into a Position.
+func positionAt(data []byte, offset int) core.Position {
+	if offset > len(data) {
+		offset = len(data)
+	}
+	prefix := data[:offset]
+	line := 1 + bytes.Count(prefix, []byte{'\n'})
+	lineStart := bytes.LastIndexByte(prefix, '\n') + 1
+	return core.Position{Line: line, Column: utf8.RuneCount(prefix[lineStart:]) + 1, Offset: offset}
+}
+
+func newSyntaxError(data []byte, offset int, msg string) *core.SyntaxError {
+	return &core.SyntaxError{Msg: msg, Position: positionAt(data, offset)}
+}
+
+// relocateSyntaxError rewrites the position of a syntax error found while
+// parsing data, a sub-slice of n's document, so that it is relative to the
+// whole document.
+func relocateSyntaxError(n *baseNode, data []byte, err error) error {
+	var syntaxErr *core.SyntaxError
+	if !errors.As(err, &syntaxErr) {
+		return err
+	}
+	source := rootBase(n).raw
+	base, ok := sourceOffset(source, data)
+	if !ok || base == 0 {
+		return err
+	}
+	return newSyntaxError(source, base+syntaxErr.Offset, syntaxErr.Msg)
+}
+
+func (n *baseNode) Position() (core.Position, bool) {
+	if n.err != nil || len(n.raw) == 0 {
+		return core.Position{}, false
+	}
+	root := rootBase(n)
+	if !root.trackPositions {
+		return core.Position{}, false
+	}
+	offset, ok := sourceOffset(root.raw, n.raw)
+	if !ok {
+		return core.Position{}, false
+	}
+	return positionAt(root.raw, offset), true
+}
@@ -0,0 +1,104 @@
+package engine
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/474420502/xjson/internal/core"
+)
+
+func TestSyntaxErrorReportsPosition(t *testing.T) {
+	data := []byte("{\n  \"a\": 1,\n  \"b\": tru\n}")
+	_, err := MustParse(data)
+	var syntaxErr *core.SyntaxError
+	if !errors.As(err, &syntaxErr) {
+		t.Fatalf("expected *core.SyntaxError, got %T: %v", err, err)
+	}
+	want := core.Position{Line: 3, Column: 8, Offset: 19}
+	if syntaxErr.Position != want {
+		t.Fatalf("expected position %+v, got %+v (%v)", want, syntaxErr.Position, err)
+	}
+}
+
+func TestLazySyntaxErrorIsRelocated(t *testing.T) {
+	data := []byte("{\"ok\": 1,\n \"bad\": {\"x\": [1, 2 3]}}")
+	root, err := Parse(data)
+	if err != nil {
+		t.Fatalf("Parse failed: %v", err)
+	}
+	bad := root.Get("bad")
+	_ = bad.Get("x").Len()
+
+	var syntaxErr *core.SyntaxError
+	for _, node := range []core.Node{bad.Get("x"), bad} {
+		if err := node.Error(); errors.As(err, &syntaxErr) {
+			break
+		}
+	}
+	if syntaxErr == nil {
+		t.Fatalf("expected a syntax error from the nested array, got %v / %v", bad.Error(), bad.Get("x").Error())
+	}
+	want := core.Position{Line: 2, Column: 21, Offset: 30}
+	if syntaxErr.Position != want {
+		t.Fatalf("expected position %+v, got %+v", want, syntaxErr.Position)
+	}
+}
+
+func TestNodePositionTracksSource(t *testing.T) {
+	data := []byte("{\"名前\": \"é\",\n\t\"list\": [10, {\"deep\": \"x\\ny\"}]}")
+	root, err := ParseWithOptions(data, ParseOptions{TrackPositions: true})
+	if err != nil {
+		t.Fatalf("ParseWithOptions failed: %v", err)
+	}
+
+	testCases := []struct {
+		path string
+		want core.Position
+	}{
+		{"/名前", core.Position{Line: 1, Column: 8, Offset: 11}},
+		{"/list", core.Position{Line: 2, Column: 10, Offset: 26}},
+		{"/list[1]", core.Position{Line: 2, Column: 15, Offset: 31}},
+		{"/list[1]/deep", core.Position{Line: 2, Column: 24, Offset: 40}},
+	}
+	for _, tc := range testCases {
+		pos, ok := root.Query(tc.path).Position()
+		if !ok {
+			t.Fatalf("expected a position for %q", tc.path)
+		}
+		if pos != tc.want {
+			t.Fatalf("position of %q = %+v, want %+v", tc.path, pos, tc.want)
+		}
+	}
+	if pos, ok := root.Position(); !ok || pos != (core.Position{Line: 1, Column: 1}) {
+		t.Fatalf("expected root at 1:1, got %+v (%v)", pos, ok)
+	}
+}
+
+func TestNodePositionUnavailable(t *testing.T) {
+	data := []byte(`{"a":{"b":1},"c":[1]}`)
+	plain, err := Parse(data)
+	if err != nil {
+		t.Fatalf("Parse failed: %v", err)
+	}
+	if _, ok := plain.Query("/a/b").Position(); ok {
+		t.Fatal("expected no position without TrackPositions")
+	}
+
+	root, err := ParseWithOptions(data, ParseOptions{TrackPositions: true})
+	if err != nil {
+		t.Fatalf("ParseWithOptions failed: %v", err)
+	}
+	root.Get("a").Set("b", 2)
+	if _, ok := root.Query("/a/b").Position(); ok {
+		t.Fatal("expected no position for a written value")
+	}
+	if _, ok := root.Get("missing").Position(); ok {
+		t.Fatal("expected no position for a missing value")
+	}
+	if _, ok := NewStringNode(nil, "x", nil).Position(); ok {
+		t.Fatal("expected no position for a constructed value")
+	}
+	if _, ok := root.Query("/c[0]").Position(); !ok {
+		t.Fatal("expected untouched siblings to keep their position")
+	}
+}
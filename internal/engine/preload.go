@@ -0,0 +1,67 @@
+package engine
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+
+	"github.com/474420502/xjson/internal/core"
+)
+
+// followPath returns the value at path below node, a path of key and index
+// steps as for SetByPath. A step that finds nothing fails with a
+// *core.PathError wrapping core.ErrNotFound, and a container that cannot be
+// read with one wrapping its error.
+func followPath(node core.Node, op, path string) (core.Node, error) {
+	tokens, err := ParseQuery(path)
+	if err != nil {
+		return nil, &core.PathError{Op: op, Path: path, Err: err}
+	}
+	for _, token := range tokens {
+		parent := node
+		switch token.Op {
+		case OpKey:
+			node = node.Get(token.Value.(string))
+		case OpIndex:
+			node = stepIndex(node, token.Value.(int))
+		default:
+			return nil, &core.PathError{Op: op, Path: path, Err: fmt.Errorf("operation %v not supported", token.Op)}
+		}
+		if node.IsValid() {
+			continue
+		}
+		if err := parent.Error(); err != nil {
+			return nil, &core.PathError{Op: op, Path: path, Err: err}
+		}
+		if token.Op == OpKey {
+			return nil, &core.PathError{Op: op, Path: path, Err: fmt.Errorf("%w: key %q", core.ErrNotFound, token.Value)}
+		}
+		if parent.Type() == core.Object {
+			return nil, &core.PathError{Op: op, Path: path, Err: fmt.Errorf("%w: key %q", core.ErrNotFound, strconv.Itoa(token.Value.(int)))}
+		}
+		return nil, &core.PathError{Op: op, Path: path, Err: fmt.Errorf("%w: index %d", core.ErrNotFound, token.Value)}
+	}
+	return node, nil
+}
+
+// preload parses the values at paths below root ahead of the first query,
+// leaving everything else lazy. Objects on the way are scanned only up to
+// the member a path needs, and keep the members they pass over indexed for
+// the next path. A path that finds nothing is skipped, or with require
+// fails with a *core.PathError wrapping core.ErrNotFound.
+func preload(root core.Node, paths []string, require bool) error {
+	for _, path := range paths {
+		node, err := followPath(root, "Preload", path)
+		if errors.Is(err, core.ErrNotFound) && !require {
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		forceParseTree(node)
+		if s, ok := node.(*stringNode); ok {
+			s.RawString()
+		}
+	}
+	return nil
+}
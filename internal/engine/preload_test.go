@@ -0,0 +1,68 @@
+package engine
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/474420502/xjson/internal/core"
+)
+
+func TestPreload(t *testing.T) {
+	data := []byte(`{"id":7,"user":{"name":"ab","tags":["x"],"bio":{"long":[1,2]}},"items":[{"sku":"s1"},{"sku":"s2"}],"rest":{"big":[3]}}`)
+	root, err := ParseWithOptions(data, ParseOptions{Preload: []string{"/id", "/user/name", "/user/tags", "/items[1]", "/missing/key"}})
+	if err != nil {
+		t.Fatalf("ParseWithOptions failed: %v", err)
+	}
+	obj := root.(*objectNode)
+	if obj.parsed.Load() {
+		t.Error("the root was parsed in full")
+	}
+	user := obj.value["user"].(*objectNode)
+	if name, ok := user.value["name"].(*stringNode); !ok || !name.decoded {
+		t.Errorf("/user/name was not decoded: %#v", user.value["name"])
+	}
+	if tags, ok := user.value["tags"].(*arrayNode); !ok || !tags.parsed.Load() {
+		t.Error("/user/tags was not parsed")
+	}
+	if _, ok := user.value["bio"]; ok {
+		t.Error("/user/bio was built without being listed")
+	}
+	if _, ok := obj.value["rest"]; ok {
+		t.Error("/rest was built without being listed")
+	}
+	if item, ok := obj.value["items"].(*arrayNode).value[1].(*objectNode); !ok || !item.parsed.Load() {
+		t.Error("/items[1] was not parsed")
+	}
+
+	lazy, _ := Parse(data)
+	for _, path := range []string{"/id", "/user/name", "/user/tags[0]", "/items[1]/sku", "/user/bio/long[1]", "/rest", "/missing"} {
+		if got, want := describeResult(root.Query(path)), describeResult(lazy.Query(path)); got != want {
+			t.Errorf("Query(%q) = %s, Parse gives %s", path, got, want)
+		}
+	}
+	if got, want := root.String(), string(data); got != want {
+		t.Errorf("String() = %s, want the source", got)
+	}
+}
+
+func TestPreloadErrors(t *testing.T) {
+	data := []byte(`{"a":{"b":1},"c":[]}`)
+	_, err := ParseWithOptions(data, ParseOptions{Preload: []string{"/a/b", "/a/x"}, RequirePreload: true})
+	var pathErr *core.PathError
+	if !errors.Is(err, core.ErrNotFound) || !errors.As(err, &pathErr) || pathErr.Path != "/a/x" {
+		t.Errorf("a missing required path = %v, want a *PathError for /a/x wrapping ErrNotFound", err)
+	}
+	if _, err := ParseWithOptions(data, ParseOptions{Preload: []string{"/c[0]"}, RequirePreload: true}); !errors.Is(err, core.ErrNotFound) {
+		t.Errorf("a missing required index = %v, want ErrNotFound", err)
+	}
+	if _, err := ParseWithOptions(data, ParseOptions{Preload: []string{"/c[*]"}}); err == nil {
+		t.Error("a wildcard path should fail")
+	}
+	if _, err := ParseWithOptions(data, ParseOptions{Preload: []string{"/a["}}); err == nil {
+		t.Error("a malformed path should fail")
+	}
+	var syntaxErr *core.SyntaxError
+	if _, err := ParseWithOptions([]byte(`{"a":{"b":}}`), ParseOptions{Preload: []string{"/a/b"}}); !errors.As(err, &syntaxErr) {
+		t.Errorf("preloading through malformed text = %v, want a *SyntaxError", err)
+	}
+}
@@ -3,10 +3,12 @@ package engine
 import (
 	"bytes"
 	"fmt"
+	"strconv"
 	"strings"
 	"unsafe"
 
 	"github.com/474420502/xjson/internal/core"
+	internalquery "github.com/474420502/xjson/internal/query"
 )
 
 // newRawBoolNode builds a bool node using provided raw slice and value without extra parsing
@@ -28,21 +30,161 @@ func newRawNullNode(parent core.Node, raw []byte, funcs *map[string]core.UnaryPa
 }
 
 func recursiveSearch(node core.Node, key string) core.Node {
-	// Try optimized raw-byte recursive scan when possible to avoid parsing full subtrees.
-	results := make([]core.Node, 0)
+	return collectRecursive(node, recursiveMatch{key: key}, nil, -1)
+}
+
+// descendants implements `//*` and `..*`: every value below node, or only
+// its scalars when leavesOnly is set.
+func descendants(node core.Node, leavesOnly bool) core.Node {
+	return collectRecursive(node, recursiveMatch{all: true, leavesOnly: leavesOnly}, nil, -1)
+}
 
-	// helper to append result
-	appendResult := func(n core.Node) {
-		if n != nil && n.IsValid() {
+// collectRecursive returns the values walkRecursive reports as a match set.
+// A limit of 0 or more ends the walk once that many are found.
+func collectRecursive(node core.Node, m recursiveMatch, cc *cancelCheck, limit int) core.Node {
+	results := make([]core.Node, 0)
+	if limit != 0 {
+		if err := walkRecursive(node, m, cc, func(n core.Node) bool {
 			results = append(results, n)
+			return limit < 0 || len(results) < limit
+		}); err != nil {
+			return newInvalidNode(err)
+		}
+	}
+	if err := cc.Err(); err != nil {
+		return newInvalidNode(err)
+	}
+	return newMatchSet(node, results, node.GetFuncs())
+}
+
+// recursiveMatch selects the values a recursive walk reports. A key match
+// reports object members with that name; an all match reports every object
+// member and array element, optionally only the scalar ones.
+type recursiveMatch struct {
+	key        string
+	all        bool
+	leavesOnly bool
+}
+
+// member reports whether the object member key, whose value starts with
+// first, is selected.
+func (m recursiveMatch) member(key string, first byte) bool {
+	if !m.all {
+		return key == m.key
+	}
+	return m.element(first)
+}
+
+// element reports whether an array element starting with first is selected.
+func (m recursiveMatch) element(first byte) bool {
+	return m.all && !(m.leavesOnly && (first == '{' || first == '['))
+}
+
+// nodeFirstByte returns the byte a node's JSON encoding starts with, which
+// is all recursiveMatch needs to tell containers from scalars.
+func nodeFirstByte(n core.Node) byte {
+	switch n.Type() {
+	case core.Object:
+		return '{'
+	case core.Array:
+		return '['
+	}
+	return 0
+}
+
+// walkRecursive calls visit for every valid value below node selected by m,
+// in document order: a value is reported before the values nested inside
+// it. The walk stops as soon as visit returns false. Meeting a value deeper
+// than the MaxRecursionDepth of the document stops it with an error
+// wrapping core.ErrMaxDepthExceeded.
+func walkRecursive(node core.Node, m recursiveMatch, cc *cancelCheck, visit func(core.Node) bool) error {
+	// Try optimized raw-byte recursive scan when possible to avoid parsing full subtrees.
+	policy := LastWins
+	var lenient leniency
+	if bn := nodeBase(node); bn != nil {
+		policy = duplicateKeyPolicy(bn)
+		lenient = documentLeniency(bn)
+	}
+
+	// scanOrigin returns the root of the scanned document, which the
+	// temporary parents of raw matches keep so that absolute queries on the
+	// matches still start there.
+	var origin core.Node
+	scanOrigin := func() core.Node {
+		if origin == nil {
+			origin = documentRoot(node)
+		}
+		return origin
+	}
+
+	// report passes a result to visit and reports whether the walk goes on.
+	report := func(n core.Node) bool {
+		return n == nil || !n.IsValid() || visit(n)
+	}
+
+	// tooDeep reports whether a value at depth, counted from the children
+	// of node at 1, is below the limit of the document, recording the
+	// error that stops the walk.
+	maxDepth := 0
+	if bn := nodeBase(scanOrigin()); bn != nil {
+		maxDepth = bn.maxRecursionDepth
+	}
+	var depthErr error
+	tooDeep := func(depth int) bool {
+		if maxDepth <= 0 || depth <= maxDepth {
+			return false
 		}
+		depthErr = fmt.Errorf("%w: a value at depth %d, limit %d", core.ErrMaxDepthExceeded, depth, maxDepth)
+		return true
 	}
 
-	// recursive byte-scan for raw nodes
-	var recursiveScanBytes func(data []byte, funcs *map[string]core.UnaryPathFunc)
-	recursiveScanBytes = func(data []byte, funcs *map[string]core.UnaryPathFunc) {
+	// valueEnd returns the end of the value at data[pos], a child of a value
+	// at depth. Under a limit the first container found to nest past it is
+	// scanned in a way that records the ends of the containers leading
+	// down there, so the scans going down through them find their ends at
+	// once instead of scanning the rest of the value again at every level.
+	var ends knownEnds
+	deepFound := false
+	valueEnd := func(data []byte, pos, depth int) int {
+		if maxDepth > 0 && !deepFound && pos < len(data) && (data[pos] == '{' || data[pos] == '[') {
+			if ends == nil {
+				ends = make(knownEnds)
+			}
+			end := ends.deepContainerEnd(data, pos, maxDepth-depth)
+			deepFound = len(ends) > 0
+			return end
+		}
+		return ends.valueEnd(data, pos)
+	}
+
+	// parseMatch makes the node of a value the scan matched. The scan has
+	// found the end of the value already, so a container becomes a lazy
+	// node over it without being scanned again.
+	parseMatch := func(segment []byte, funcs *map[string]core.UnaryPathFunc, parent core.Node) core.Node {
+		switch segment[0] {
+		case '{':
+			node := NewObjectNode(parent, segment, funcs).(*objectNode)
+			node.start, node.end = 0, len(segment)
+			return node
+		case '[':
+			return NewArrayNode(parent, segment, funcs)
+		}
+		p := newParser(segment, funcs)
+		p.lenient = lenient
+		return p.doParse(parent)
+	}
+
+	// recursiveScanBytes scans raw bytes for matches in a value at depth.
+	// It returns false once the walk is to stop, which each enclosing scan
+	// passes on at once; malformed input only ends the scan of its own
+	// container.
+	var recursiveScanBytes func(data []byte, funcs *map[string]core.UnaryPathFunc, depth int) bool
+	recursiveScanBytes = func(data []byte, funcs *map[string]core.UnaryPathFunc, depth int) bool {
 		if len(data) == 0 {
-			return
+			return true
+		}
+		if cc.stop() {
+			return false
 		}
 		// skip whitespace
 		i := 0
@@ -50,15 +192,22 @@ func recursiveSearch(node core.Node, key string) core.Node {
 			i++
 		}
 		if i >= len(data) {
-			return
+			return true
+		}
+		// data holds one value: the raw text of the start node, or the
+		// segment rawValueEnd cut for a member or element. A container thus
+		// ends at its last non-space byte, which saves scanning it twice.
+		end := len(data) - 1
+		for end > i && (data[end] == ' ' || data[end] == '\n' || data[end] == '\r' || data[end] == '\t') {
+			end--
 		}
 		switch data[i] {
 		case '{':
 			// scan object fields
 			pos := i
-			objEnd := findMatchingBrace(data, pos)
-			if objEnd == -1 {
-				return
+			objEnd := end
+			if data[objEnd] != '}' {
+				return true
 			}
 			// lazily allocate a temporary parent node only when we need it.
 			// We keep the raw parent slice so the parser can set correct
@@ -67,6 +216,9 @@ func recursiveSearch(node core.Node, key string) core.Node {
 			// parent linkage when required by callers/tests.
 			parentRaw := data[pos : objEnd+1]
 			var parentNode core.Node = nil
+			// Members hidden by a repeated key are skipped, as a full
+			// parse would drop them.
+			shadowed := shadowedMembers(data, pos, policy, ends)
 			pos++ // skip '{'
 			skipWS := func() {
 				for pos < len(data) {
@@ -79,64 +231,66 @@ func recursiveSearch(node core.Node, key string) core.Node {
 				}
 			}
 			for pos < len(data) {
+				if cc.stop() {
+					return false
+				}
 				skipWS()
 				if pos >= len(data) || data[pos] == '}' {
 					break
 				}
+				if tooDeep(depth + 1) {
+					return false
+				}
 				if data[pos] != '"' {
 					// malformed, abort
-					return
+					return true
 				}
 				keyEnd := findMatchingQuote(data, pos)
 				if keyEnd == -1 {
-					return
+					return true
 				}
 				keyRaw := data[pos+1 : keyEnd]
 				keyUnesc, err := unescape(keyRaw)
 				if err != nil {
-					return
+					return true
 				}
 				keyStr := string(keyUnesc)
 				pos = keyEnd + 1
 				skipWS()
 				if pos >= len(data) || data[pos] != ':' {
-					return
+					return true
 				}
 				pos++
 				skipWS()
 				if pos >= len(data) {
-					return
-				}
-				var valEnd int
-				switch data[pos] {
-				case '{':
-					valEnd = findMatchingBrace(data, pos)
-				case '[':
-					valEnd = findMatchingBracket(data, pos)
-				case '"':
-					valEnd = findMatchingQuote(data, pos)
-				default:
-					valEnd = findValueEnd(data, pos)
+					return true
 				}
-				if valEnd == -1 {
-					return
+				valEnd := valueEnd(data, pos, depth)
+				if valEnd == -1 || valEnd < pos {
+					return true
 				}
+				hidden := shadowed[pos]
 				// if key matches, parse value and append
-				if key == "" || key == keyStr {
+				if !hidden && m.member(keyStr, data[pos]) {
 					segment := data[pos : valEnd+1]
 					// allocate parentNode lazily so Parent() can be set on child
 					if parentNode == nil {
 						parentNode = NewObjectNode(nil, parentRaw, funcs)
+						parentNode.(*objectNode).duplicateKeys = policy
+						parentNode.(*objectNode).leniency = lenient
+						parentNode.(*objectNode).origin = scanOrigin()
 					}
-					p := newParser(segment, funcs)
 					// parse with parentNode so that Parent() works for the child
-					child := p.doParse(parentNode)
-					appendResult(child)
+					if !report(parseMatch(segment, funcs, parentNode)) {
+						return false
+					}
 				}
 				// recurse into value if it's a composite
 				first := getFirstNonWhitespaceChar(data[pos : valEnd+1])
-				if first == '{' || first == '[' {
-					recursiveScanBytes(data[pos:valEnd+1], funcs)
+				if !hidden && (first == '{' || first == '[') {
+					if !recursiveScanBytes(data[pos:valEnd+1], funcs, depth+1) {
+						return false
+					}
 				}
 				pos = valEnd + 1
 				skipWS()
@@ -148,11 +302,17 @@ func recursiveSearch(node core.Node, key string) core.Node {
 					break
 				}
 				// malformed -> abort
-				return
+				return true
 			}
 		case '[':
 			// scan array elements
 			pos := i
+			arrEnd := end
+			if data[arrEnd] != ']' {
+				return true
+			}
+			arrayRaw := data[pos : arrEnd+1]
+			var parentNode core.Node
 			pos++ // skip '['
 			skipWS := func() {
 				for pos < len(data) {
@@ -165,28 +325,37 @@ func recursiveSearch(node core.Node, key string) core.Node {
 				}
 			}
 			for pos < len(data) {
+				if cc.stop() {
+					return false
+				}
 				skipWS()
 				if pos >= len(data) || data[pos] == ']' {
 					break
 				}
-				var elemEnd int
-				switch data[pos] {
-				case '{':
-					elemEnd = findMatchingBrace(data, pos)
-				case '[':
-					elemEnd = findMatchingBracket(data, pos)
-				case '"':
-					elemEnd = findMatchingQuote(data, pos)
-				default:
-					elemEnd = findValueEnd(data, pos)
+				if tooDeep(depth + 1) {
+					return false
 				}
-				if elemEnd == -1 {
-					return
+				elemEnd := valueEnd(data, pos, depth)
+				if elemEnd == -1 || elemEnd < pos {
+					return true
+				}
+				if m.element(data[pos]) {
+					if parentNode == nil {
+						parentNode = NewArrayNode(nil, arrayRaw, funcs)
+						parentNode.(*arrayNode).duplicateKeys = policy
+						parentNode.(*arrayNode).leniency = lenient
+						parentNode.(*arrayNode).origin = scanOrigin()
+					}
+					if !report(parseMatch(data[pos:elemEnd+1], funcs, parentNode)) {
+						return false
+					}
 				}
 				// recurse into element
 				first := getFirstNonWhitespaceChar(data[pos : elemEnd+1])
 				if first == '{' || first == '[' {
-					recursiveScanBytes(data[pos:elemEnd+1], funcs)
+					if !recursiveScanBytes(data[pos:elemEnd+1], funcs, depth+1) {
+						return false
+					}
 				}
 				pos = elemEnd + 1
 				skipWS()
@@ -197,58 +366,100 @@ func recursiveSearch(node core.Node, key string) core.Node {
 				if pos < len(data) && data[pos] == ']' {
 					break
 				}
-				return
+				return true
 			}
 		default:
-			return
+			return true
 		}
+		return true
 	}
 
 	// If start node can be scanned as raw, prefer that.
 	if on, ok := node.(*objectNode); ok && !on.parsed.Load() && !on.isDirty && len(on.raw) > 0 {
-		recursiveScanBytes(on.raw, on.GetFuncs())
-		arr := NewArrayNode(nil, nil, node.GetFuncs())
-		arr.(*arrayNode).value = results
-		return arr
+		recursiveScanBytes(on.raw, on.GetFuncs(), 0)
+		return depthErr
 	}
 	if an, ok := node.(*arrayNode); ok && !an.parsed.Load() && !an.isDirty && len(an.raw) > 0 {
-		recursiveScanBytes(an.raw, an.GetFuncs())
-		arr := NewArrayNode(nil, nil, node.GetFuncs())
-		arr.(*arrayNode).value = results
-		return arr
+		recursiveScanBytes(an.raw, an.GetFuncs(), 0)
+		return depthErr
 	}
 
-	// fallback to original behavior for parsed/dirty nodes
-	var walk func(core.Node)
-	walk = func(n core.Node) {
+	// fallback to original behavior for parsed/dirty nodes; walk returns
+	// false once the walk is to stop, like recursiveScanBytes. The matches
+	// of a match set stand where it does, so their children are at the
+	// depth of its elements.
+	var walk func(n core.Node, depth int) bool
+	walk = func(n core.Node, depth int) bool {
 		if !n.IsValid() {
-			return
+			return true
+		}
+		if cc.stop() {
+			return false
 		}
 		switch n.Type() {
 		case core.Object:
-			if key != "" {
-				c := n.Get(key)
-				if c != nil && c.IsValid() {
-					results = append(results, c)
+			// Visit members in document order, matching the raw scan above:
+			// a member is reported before any matches nested inside it.
+			o, ok := n.(*objectNode)
+			if !ok {
+				return true
+			}
+			for _, k := range o.documentKeys() {
+				v := o.value[k]
+				if tooDeep(depth + 1) {
+					return false
+				}
+				if m.member(k, nodeFirstByte(v)) && !report(v) {
+					return false
+				}
+				if !walk(v, depth+1) {
+					return false
 				}
 			}
-			n.ForEach(func(_ interface{}, v core.Node) {
-				walk(v)
-			})
 		case core.Array:
-			n.ForEach(func(_ interface{}, v core.Node) {
-				walk(v)
-			})
+			childDepth := depth + 1
+			if _, isMatchSet := matchList(n); isMatchSet {
+				childDepth = depth
+			}
+			for _, v := range n.UnsafeArray() {
+				if tooDeep(childDepth) {
+					return false
+				}
+				if m.element(nodeFirstByte(v)) && !report(v) {
+					return false
+				}
+				if !walk(v, childDepth) {
+					return false
+				}
+			}
 		}
+		return true
 	}
-	walk(node)
-	arr := NewArrayNode(nil, nil, node.GetFuncs())
-	arr.(*arrayNode).value = results
-	return arr
+	walk(node, 0)
+	return depthErr
 }
 
 // newInvalidNode creates a new invalid node with the given error
 func applySimpleQuery(start core.Node, path string) core.Node {
+	return applyQuery(start, path, nil)
+}
+
+// queryStart returns the node path is evaluated from when it is queried on
+// node. A path starting with a single '/' is absolute and runs from the
+// root of node's document; any other one, such as "a", "./a", "../a" or the
+// recursive "//a", runs from node itself.
+func queryStart(node core.Node, path string) core.Node {
+	if len(path) == 0 || path[0] != '/' || len(path) > 1 && path[1] == '/' {
+		return node
+	}
+	return documentRoot(node)
+}
+
+// applyQuery runs path from start. A non-nil cc can stop the run early; the
+// partial result of a stopped run is never cached, and a panic becomes the
+// error of the result.
+func applyQuery(start core.Node, path string, cc *cancelCheck) (result core.Node) {
+	defer recoverPanic("Query", path, &result)
 	// Try to get cached result first so repeated identical queries can bypass
 	// both path scanning and per-segment object lookups.
 	if enableQueryCache {
@@ -285,10 +496,13 @@ func applySimpleQuery(start core.Node, path string) core.Node {
 	if err != nil {
 		return newInvalidNode(err)
 	}
-	cur := executeQueryTokens(start, tokens)
+	cur := runQueryTokens(start, tokens, cc, -1)
+	if err := cc.Err(); err != nil {
+		return newInvalidNode(err)
+	}
 
 	// Cache the result (optional)
-	if enableQueryCache {
+	if enableQueryCache && queryTokensCacheable(tokens) {
 		if bn, ok := start.(interface{ setCachedQueryResult(string, core.Node) }); ok {
 			bn.setCachedQueryResult(path, cur)
 		}
@@ -297,49 +511,216 @@ func applySimpleQuery(start core.Node, path string) core.Node {
 	return cur
 }
 
+// queryTokensCacheable reports whether the result of tokens may be stored in
+// the query cache. Function calls depend on the mutable function registry and
+// on user code, so their results are always recomputed.
+func queryTokensCacheable(tokens []queryToken) bool {
+	for _, t := range tokens {
+		if t.Op == OpFunc {
+			return false
+		}
+	}
+	return true
+}
+
+// projection holds the matches of a run of key and wildcard steps. While
+// the next step is another one of them the matches are not wrapped in a
+// match set: each step reads the previous matches from one scratch buffer
+// and writes its own into the other, so a run allocates two buffers and
+// one or two match sets however long it is. The result of the run has the
+// matches of the step before it as its parent, as a step by step run would;
+// earlier steps are left out of the parent chain.
+type projection struct {
+	active  bool
+	source  core.Node
+	matches []core.Node
+	prev    []core.Node
+	bufs    [2][]core.Node
+	next    int
+}
+
+// buffer returns the empty scratch buffer for the matches of a step over
+// cur. A new buffer has room for every element of its input.
+func (p *projection) buffer(cur core.Node) []core.Node {
+	if buf := p.bufs[p.next]; buf != nil {
+		return buf[:0]
+	}
+	size := len(p.matches)
+	if a, ok := cur.(*arrayNode); ok && !p.active {
+		size = a.Len()
+	}
+	return make([]core.Node, 0, size)
+}
+
+// step records results, written into the buffer from buffer, as the
+// matches of a step over cur and returns the node the query continues
+// from.
+func (p *projection) step(cur core.Node, results []core.Node, rest []queryToken) core.Node {
+	if !p.active {
+		p.active = true
+		p.source = cur
+	}
+	p.prev = p.matches
+	p.matches = results
+	p.bufs[p.next] = results
+	p.next ^= 1
+	return p.keep(rest)
+}
+
+// size returns how many nodes the query is at: the matches of the run, or
+// those of cur when no run is going on.
+func (p *projection) size(cur core.Node) int {
+	if p.active {
+		return len(p.matches)
+	}
+	return cur.MatchCount()
+}
+
+// keep ends the run unless the next step continues it. While the run goes
+// on the query stays at the node the run started from.
+func (p *projection) keep(rest []queryToken) core.Node {
+	if len(rest) > 0 && (rest[0].Op == OpKey || rest[0].Op == OpWildcard) {
+		return p.source
+	}
+	parent := p.source
+	if p.prev != nil {
+		parent = newMatchSet(p.source, p.prev, p.source.GetFuncs())
+	}
+	set := newMatchSet(parent, p.matches, p.source.GetFuncs())
+	*p = projection{}
+	return set
+}
+
+// wildcardMatches returns the matches a wildcard step over cur steps into:
+// those of the projection going on, or those of a match set left by a
+// recursive or filter step. It reports false when cur is one value.
+func wildcardMatches(cur core.Node, proj *projection) ([]core.Node, bool) {
+	if proj.active {
+		return proj.matches, true
+	}
+	if a, ok := cur.(*arrayNode); ok && a.matchSet {
+		return a.value, true
+	}
+	return nil, false
+}
+
+// appendChildren appends the member values of an object or the elements of
+// an array to results, in document order and without parsing node in full
+// when its source can be iterated. Other values have no children. With a
+// limit of 0 or more results stops growing at that length.
+func appendChildren(results []core.Node, node core.Node, limit int, cc *cancelCheck) []core.Node {
+	mark := len(results)
+	if o, ok := node.(*objectNode); ok {
+		// attempt raw-mode iteration to avoid full parse
+		it := o.iterValue()
+		for (limit < 0 || len(results) < limit) && !cc.stop() && it.Next() {
+			if child := it.ParseValue(); child.IsValid() {
+				results = append(results, child)
+			}
+		}
+		if err := it.Err(); err != nil {
+			// fallback to full parse if iterator failed
+			results = results[:mark]
+			for _, k := range o.documentKeys() {
+				results = append(results, o.value[k])
+			}
+		}
+	} else if a, ok := node.(*arrayNode); ok {
+		it := a.iterValue()
+		for (limit < 0 || len(results) < limit) && !cc.stop() && it.Next() {
+			if child := it.ParseValue(); child.IsValid() {
+				results = append(results, child)
+			}
+		}
+		if err := it.Err(); err != nil {
+			a.lazyParse()
+			results = append(results[:mark], a.value...)
+		}
+	}
+	return results
+}
+
 func executeQueryTokens(start core.Node, tokens []queryToken) core.Node {
+	return runQueryTokens(start, tokens, nil, -1)
+}
+
+// runQueryTokens is executeQueryTokens with a cancellation check that the
+// steps visiting many values poll as they go. A maxMatches of 0 or more lets
+// a last recursive, wildcard or filter step stop once it has that many
+// matches; the result may still hold more, see QueryN.
+func runQueryTokens(start core.Node, tokens []queryToken, cc *cancelCheck, maxMatches int) core.Node {
+	return traceQueryTokens(start, tokens, cc, maxMatches, nil)
+}
+
+// traceQueryTokens is runQueryTokens recording in a non-nil trace how many
+// nodes each step starts from and ends with, see QueryDebug.
+func traceQueryTokens(start core.Node, tokens []queryToken, cc *cancelCheck, maxMatches int, trace *Plan) core.Node {
 	cur := start
-	for _, t := range tokens {
+	var proj projection
+	for i, t := range tokens {
+		// stepLimit bounds the matches of the last step.
+		stepLimit := -1
+		if i == len(tokens)-1 {
+			stepLimit = maxMatches
+		}
 
 		if !cur.IsValid() {
 			return cur
 		}
+		if cc.stop() {
+			return newInvalidNode(cc.Err())
+		}
+		if trace != nil {
+			trace.enter(i, proj.size(cur))
+		}
 
 		switch t.Op {
 		case OpKey:
 			key := t.Value.(string)
-			if a, ok := cur.(*arrayNode); ok {
-				// Try to use iterator to avoid fully parsing the array
-				it := a.Iter()
-				results := make([]core.Node, 0)
-				for it.Next() {
-					// prefer ParseValue() which works for parsed and raw modes
-					if elem := it.ParseValue(); elem.IsValid() {
-						if elem.Type() == core.Object {
-							res := elem.Get(key)
-							if res.IsValid() {
-								results = append(results, res)
-							}
+			if a, ok := cur.(*arrayNode); ok || proj.active {
+				results := proj.buffer(cur)
+				searched := 0
+				project := func(elem core.Node) {
+					searched++
+					if elem.IsValid() && elem.Type() == core.Object {
+						if res := elem.Get(key); res.IsValid() {
+							results = append(results, res)
 						}
 					}
 				}
-				if len(results) == 0 {
+				if proj.active {
+					for _, elem := range proj.matches {
+						if cc.stop() {
+							break
+						}
+						project(elem)
+					}
+				} else {
+					// Try to use iterator to avoid fully parsing the array
+					it := a.rawIter()
+					for !cc.stop() && it.Next() {
+						// prefer ParseValue() which works for parsed and raw modes
+						project(it.ParseValue())
+					}
+				}
+				// Nothing to look in is an empty match, not a missing key.
+				if len(results) == 0 && searched > 0 {
 					return newInvalidNode(fmt.Errorf("key '%s' not found in any array element", key))
 				}
-				newArr := NewArrayNode(a, nil, a.GetFuncs())
-				newArr.(*arrayNode).value = results
-				newArr.(*arrayNode).isDirty = true
-				cur = newArr
+				cur = proj.step(cur, results, tokens[i+1:])
 			} else if o, ok := cur.(*objectNode); ok {
 				cur = o.Get(key)
 			} else {
-				return newInvalidNode(fmt.Errorf("not an object for key access '%s' on node type %v", key, cur.Type()))
+				return newInvalidNode(fmt.Errorf("not an object for key access '%s' on node type %v: %w", key, cur.Type(), core.ErrTypeAssertion))
 			}
 		case OpIndex:
 			if a, ok := cur.(*arrayNode); ok {
 				cur = a.Index(t.Value.(int))
+			} else if o, ok := cur.(*objectNode); ok {
+				// A numeric segment such as /0 names a member of an object.
+				cur = o.Get(strconv.Itoa(t.Value.(int)))
 			} else {
-				return newInvalidNode(fmt.Errorf("not an array for index access: %v", cur.Raw()))
+				return newInvalidNode(fmt.Errorf("not an array for index access on node type %v: %w", cur.Type(), core.ErrTypeAssertion))
 			}
 		case OpSlice:
 			if a, ok := cur.(*arrayNode); ok {
@@ -372,52 +753,53 @@ func executeQueryTokens(start core.Node, tokens []queryToken) core.Node {
 					start = end
 				}
 
-				newArr := NewArrayNode(a, nil, a.GetFuncs())
-				newArr.(*arrayNode).value = a.value[start:end]
-				newArr.(*arrayNode).isDirty = true
-				cur = newArr
+				cur = a.window(start, end)
 			} else {
-				return newInvalidNode(fmt.Errorf("not an array for slice access"))
+				return newInvalidNode(fmt.Errorf("not an array for slice access on node type %v: %w", cur.Type(), core.ErrTypeAssertion))
 			}
 		case OpWildcard:
-			results := make([]core.Node, 0)
-			if o, ok := cur.(*objectNode); ok {
-				// attempt raw-mode iteration to avoid full parse
-				it := o.Iter()
-				for it.Next() {
-					if child := it.ParseValue(); child.IsValid() {
-						results = append(results, child)
-					}
-				}
-				if err := it.Err(); err != nil {
-					// fallback to full parse if iterator failed
-					o.lazyParse()
-					for _, v := range o.value {
-						results = append(results, v)
-					}
-				}
-			} else if a, ok := cur.(*arrayNode); ok {
-				it := a.Iter()
-				for it.Next() {
-					if child := it.ParseValue(); child.IsValid() {
-						results = append(results, child)
+			var results []core.Node
+			if stepLimit >= 0 && !proj.active {
+				// Sizing the buffer by the input would count every element.
+				results = make([]core.Node, 0, stepLimit)
+			} else {
+				results = proj.buffer(cur)
+			}
+			if matches, ok := wildcardMatches(cur, &proj); ok {
+				// A wildcard over matches steps into each of them.
+				for _, match := range matches {
+					if stepLimit >= 0 && len(results) >= stepLimit || cc.stop() {
+						break
 					}
+					results = appendChildren(results, match, stepLimit, cc)
 				}
-				if err := it.Err(); err != nil {
-					a.lazyParse()
-					results = a.value
-				}
+			} else {
+				results = appendChildren(results, cur, stepLimit, cc)
 			}
-			newArr := NewArrayNode(cur, nil, cur.GetFuncs())
-			newArr.(*arrayNode).value = results
-			newArr.(*arrayNode).isDirty = true
-			cur = newArr
+			cur = proj.step(cur, results, tokens[i+1:])
 		case OpFunc:
-			name := t.Value.(string)
-			cur = cur.CallFunc(name)
+			call := t.Value.(internalquery.FuncCall)
+			args := make([]core.Arg, len(call.Args))
+			for i, v := range call.Args {
+				args[i], _ = core.NewArg(v)
+			}
+			cur = cur.CallFunc(call.Name, args...)
 		case OpRecursive:
 			key := t.Value.(string)
-			cur = recursiveSearch(cur, key)
+			cur = collectRecursive(cur, recursiveMatch{key: key}, cc, stepLimit)
+		case OpAll:
+			cur = collectRecursive(cur, recursiveMatch{all: true}, cc, stepLimit)
+		case OpFilter:
+			// A following bounded slice only needs the first End matches.
+			limit := stepLimit
+			if i+1 < len(tokens) && tokens[i+1].Op == OpSlice {
+				if s := tokens[i+1].Value.(slice); s.Start >= 0 && s.End >= 0 {
+					limit = s.End
+				}
+			}
+			cur = applyFilter(cur, t.Value.(internalquery.Expression), limit, cc)
+		case OpPick:
+			cur = cur.Pick(t.Value.([]string)...)
 		case OpParent:
 			if p := cur.Parent(); p != nil && p != cur {
 				cur = p
@@ -431,6 +813,12 @@ func executeQueryTokens(start core.Node, tokens []queryToken) core.Node {
 		if cur == nil {
 			return newInvalidNode(fmt.Errorf("nil during query"))
 		}
+		if err := cc.Err(); err != nil {
+			return newInvalidNode(err)
+		}
+		if trace != nil {
+			trace.leave(i, proj.size(cur), cur.Error())
+		}
 	}
 	return cur
 }
@@ -452,12 +840,24 @@ func directArrayChild(a *arrayNode, idx int) core.Node {
 	if idx >= 0 && idx < len(a.value) {
 		return a.value[idx]
 	}
-	return newInvalidNode(fmt.Errorf("index out of bounds: %d", idx))
+	return newInvalidNode(fmt.Errorf("%w: %d", core.ErrIndexOutOfBounds, idx))
 }
 
 func fastConstructObjectChild(o *objectNode, segment []byte) core.Node {
 	var child core.Node
-	if len(segment) >= 2 && segment[0] == '"' && segment[len(segment)-1] == '"' {
+	if o.arena != nil {
+		// Pooled documents allocate every node through the arena.
+		p := newParser(segment, o.funcs)
+		p.arena = o.arena
+		p.lenient = documentLeniency(&o.baseNode)
+		child = p.doParse(o)
+	} else if len(segment) > 0 && segment[0] != '{' && segment[0] != '[' && !wellFormedScalar(segment) {
+		// The parser reports what is wrong with it, or reads a literal the
+		// document allows.
+		p := newParser(segment, o.funcs)
+		p.lenient = documentLeniency(&o.baseNode)
+		child = p.doParse(o)
+	} else if len(segment) >= 2 && segment[0] == '"' && segment[len(segment)-1] == '"' {
 		needsUnescape := bytes.IndexByte(segment[1:len(segment)-1], '\\') != -1
 		child = NewRawStringNode(o, segment, 1, len(segment)-1, needsUnescape, o.funcs)
 	} else if len(segment) > 0 && (segment[0] == '{' || segment[0] == '[') {
@@ -481,7 +881,7 @@ func fastConstructObjectChild(o *objectNode, segment []byte) core.Node {
 			}
 		} else {
 			p := newParser(segment, o.funcs)
-			child = p.doParse(o)
+			child = p.parseValue(o)
 		}
 	}
 	if child == nil || !child.IsValid() {
@@ -540,24 +940,34 @@ func fastScanObjectChildLocked(o *objectNode, key string) (core.Node, bool, bool
 	if child, ok := o.value[key]; ok {
 		return child, true, true
 	}
-	if span, ok := o.rawIndex[key]; ok {
-		child := fastConstructObjectChild(o, o.raw[span.start:span.end])
-		if child == nil {
-			return nil, false, false
-		}
-		if o.value == nil {
-			o.value = make(map[string]core.Node, 4)
-		}
-		o.value[key] = child
-		return child, true, true
+	found, ok := scanObjectKeyLocked(o, key)
+	if !found || !ok {
+		return nil, false, ok
+	}
+	return indexedObjectChildLocked(o, key)
+}
+
+// scanObjectKeyLocked indexes the raw members of o up to the one holding
+// key, or to the end, and reports whether key is a member. The second result
+// is false when the raw text cannot be scanned. Nothing is allocated once the
+// members are indexed.
+func scanObjectKeyLocked(o *objectNode, key string) (bool, bool) {
+	if _, ok := o.value[key]; ok {
+		return true, true
+	}
+	// Under LastWins a later member may repeat the key, so a match only
+	// counts once the whole object has been indexed.
+	lastWins := duplicateKeyPolicy(&o.baseNode) == LastWins
+	if _, ok := o.rawIndex[key]; ok && (o.rawDone || !lastWins) {
+		return true, true
 	}
 	if o.rawDone {
-		return nil, false, true
+		return false, true
 	}
 
 	raw, pos, ok := initObjectRawScanLocked(o)
 	if !ok {
-		return nil, false, false
+		return false, false
 	}
 
 	skipWS := func() {
@@ -574,51 +984,41 @@ func fastScanObjectChildLocked(o *objectNode, key string) (core.Node, bool, bool
 	for pos < len(raw) {
 		skipWS()
 		if pos >= len(raw) || raw[pos] == '}' {
-			o.rawScanPos = pos
-			o.rawDone = true
-			return nil, false, true
+			break
 		}
 		if raw[pos] != '"' {
-			return nil, false, false
+			return false, false
 		}
 		keyEnd := findMatchingQuote(raw, pos)
 		if keyEnd == -1 {
-			return nil, false, false
+			return false, false
 		}
 		keyRaw := raw[pos+1 : keyEnd]
 		match, keyStr, err := matchObjectKey(key, keyRaw)
 		if err != nil {
-			return nil, false, false
+			return false, false
 		}
 		pos = keyEnd + 1
 		skipWS()
 		if pos >= len(raw) || raw[pos] != ':' {
-			return nil, false, false
+			return false, false
 		}
 		pos++
 		skipWS()
 		if pos >= len(raw) {
-			return nil, false, false
+			return false, false
 		}
 
-		var valEnd int
-		switch raw[pos] {
-		case '{':
-			valEnd = findMatchingBrace(raw, pos)
-		case '[':
-			valEnd = findMatchingBracket(raw, pos)
-		case '"':
-			valEnd = findMatchingQuote(raw, pos)
-		default:
-			valEnd = findValueEnd(raw, pos)
-		}
+		valEnd := rawValueEnd(raw, pos)
 		if valEnd == -1 {
-			return nil, false, false
+			return false, false
 		}
 		if o.rawIndex == nil {
 			o.rawIndex = make(map[string]rawValueSpan, 4)
 		}
-		o.rawIndex[keyStr] = rawValueSpan{start: pos, end: valEnd + 1}
+		if _, seen := o.rawIndex[keyStr]; !seen || lastWins {
+			o.rawIndex[keyStr] = rawValueSpan{start: pos, end: valEnd + 1}
+		}
 
 		nextPos := valEnd + 1
 		for nextPos < len(raw) {
@@ -634,25 +1034,32 @@ func fastScanObjectChildLocked(o *objectNode, key string) (core.Node, bool, bool
 		}
 		o.rawScanPos = nextPos
 
-		if match {
-			child := fastConstructObjectChild(o, raw[pos:valEnd+1])
-			if child == nil {
-				return nil, false, false
-			}
-			if o.value == nil {
-				o.value = make(map[string]core.Node, 4)
-			}
-			o.value[key] = child
-			return child, true, true
+		if match && !lastWins {
+			return true, true
 		}
 
 		pos = nextPos
-		continue
 	}
 
 	o.rawDone = true
 	o.rawScanPos = pos
-	return nil, false, true
+	_, found := o.rawIndex[key]
+	return found, true
+}
+
+// indexedObjectChildLocked builds the child for a key found by the raw scan
+// and keeps it in the object's values.
+func indexedObjectChildLocked(o *objectNode, key string) (core.Node, bool, bool) {
+	span := o.rawIndex[key]
+	child := fastConstructObjectChild(o, o.raw[span.start:span.end])
+	if child == nil {
+		return nil, false, false
+	}
+	if o.value == nil {
+		o.value = make(map[string]core.Node, 4)
+	}
+	o.value[key] = child
+	return child, true, true
 }
 
 // tryFastSlashQuery attempts a zero-allocation fast path for very simple
@@ -661,7 +1068,7 @@ func fastScanObjectChildLocked(o *objectNode, key string) (core.Node, bool, bool
 func tryFastSlashQuery(start core.Node, path string) core.Node {
 	// DEBUG LOGGING - remove after diagnosis
 	// fmt.Printf("tryFastSlashQuery path=%q startType=%v\n", path, start.Type())
-	if path == "" || strings.ContainsAny(path, "[]*@.") || strings.Contains(path, "//") || strings.HasPrefix(path, "../") {
+	if path == "" || strings.ContainsAny(path, "[]*@.{") || strings.Contains(path, "//") || strings.HasPrefix(path, "../") {
 		return nil
 	}
 
@@ -690,6 +1097,9 @@ func tryFastSlashQuery(start core.Node, path string) core.Node {
 			// skip empty segments (shouldn't happen after trimming, but be defensive)
 			continue
 		}
+		if _, ok := internalquery.StructureFunc(part); ok || isBlank(part) {
+			return nil
+		}
 		// Only handle object nodes in raw/unparsed state or already parsed
 		if o, ok := cur.(*objectNode); ok && !o.isDirty {
 
@@ -707,179 +1117,26 @@ func tryFastSlashQuery(start core.Node, path string) core.Node {
 				}
 				continue
 			}
-			// raw scan for key
-			raw := o.raw
-			// acquire lock similar to lazyParsePath to safely inspect/modify value
+			// raw scan for key, under the lock like lazyParsePath
 			o.mu.Lock()
-			// re-check parsed and existing map under lock
 			if o.parsed.Load() {
 				o.mu.Unlock()
 				cur = o.Get(part)
-				continue
-			}
-			if o.value != nil {
-				if child, ok := o.value[part]; ok {
-					o.mu.Unlock()
-					cur = child
-					// advance to next part
-					if q >= len(path) {
-						return cur
-					}
-					partIndex++
-					p = q + 1
-					for p < len(path) && path[p] == '/' {
-						p++
-					}
-					continue
-				}
-			}
-			if len(raw) == 0 {
-				return nil
-			}
-			// find key in raw using similar logic to lazyParsePath
-			pos := 0
-			for pos < len(raw) && raw[pos] != '{' {
-				pos++
-			}
-			if pos >= len(raw) {
-				return nil
-			}
-			pos++
-			found := false
-			for pos < len(raw) {
-				// skip ws
-				for pos < len(raw) && (raw[pos] == ' ' || raw[pos] == '\n' || raw[pos] == '\r' || raw[pos] == '\t') {
-					pos++
-				}
-				if pos >= len(raw) || raw[pos] == '}' {
-					break
-				}
-				if raw[pos] != '"' {
-					return nil
-				}
-				keyEnd := findMatchingQuote(raw, pos)
-				if keyEnd == -1 {
-					return nil
-				}
-				keyRaw := raw[pos+1 : keyEnd]
-				// compare quickly without unescaping
-				if bytes.IndexByte(keyRaw, '\\') == -1 && compareStringBytes(part, keyRaw) {
-					// found — parse value segment and set cur
-					pos = keyEnd + 1
-					// skip ws and colon
-					for pos < len(raw) && (raw[pos] == ' ' || raw[pos] == '\n' || raw[pos] == '\r' || raw[pos] == '\t') {
-						pos++
-					}
-					if pos >= len(raw) || raw[pos] != ':' {
-						return nil
-					}
-					pos++
-					for pos < len(raw) && (raw[pos] == ' ' || raw[pos] == '\n' || raw[pos] == '\r' || raw[pos] == '\t') {
-						pos++
-					}
-					if pos >= len(raw) {
-						return nil
-					}
-					var valEnd int
-					switch raw[pos] {
-					case '{':
-						valEnd = findMatchingBrace(raw, pos)
-					case '[':
-						valEnd = findMatchingBracket(raw, pos)
-					case '"':
-						valEnd = findMatchingQuote(raw, pos)
-					default:
-						valEnd = findValueEnd(raw, pos)
-					}
-					if valEnd == -1 {
-						return nil
-					}
-					segment := raw[pos : valEnd+1]
-					var child core.Node
-					if len(segment) >= 2 && segment[0] == '"' && segment[len(segment)-1] == '"' {
-						needsUnescape := bytes.IndexByte(segment[1:len(segment)-1], '\\') != -1
-						child = NewRawStringNode(o, segment, 1, len(segment)-1, needsUnescape, o.funcs)
-					} else {
-						p := newParser(segment, o.funcs)
-						child = p.doParse(o)
-					}
-					if child == nil || !child.IsValid() {
-						o.mu.Unlock()
-						return nil
-					}
-					// ensure parent pointer is correct
-					if bn, ok := child.(*baseNode); ok {
-						bn.parent = o
-					} else if inode, ok := child.(interface{ setParent(core.Node) }); ok {
-						inode.setParent(o)
-					}
-					if o.value == nil {
-						o.value = make(map[string]core.Node, 4)
-					}
-					// store into parent so subsequent operations and String() see it
-					o.value[part] = child
-					o.mu.Unlock()
-					if q >= len(path) {
-						return child
-					}
-					cur = child
-					found = true
-					break
-				}
-				// skip to after value
-				pos = keyEnd + 1
-				// skip ws and colon
-				for pos < len(raw) && (raw[pos] == ' ' || raw[pos] == '\n' || raw[pos] == '\r' || raw[pos] == '\t') {
-					pos++
-				}
-				if pos >= len(raw) || raw[pos] != ':' {
-					return nil
-				}
-				pos++
-				for pos < len(raw) && (raw[pos] == ' ' || raw[pos] == '\n' || raw[pos] == '\r' || raw[pos] == '\t') {
-					pos++
-				}
-				if pos >= len(raw) {
-					return nil
-				}
-				var valEnd2 int
-				switch raw[pos] {
-				case '{':
-					valEnd2 = findMatchingBrace(raw, pos)
-				case '[':
-					valEnd2 = findMatchingBracket(raw, pos)
-				case '"':
-					valEnd2 = findMatchingQuote(raw, pos)
-				default:
-					valEnd2 = findValueEnd(raw, pos)
-				}
-				if valEnd2 == -1 {
-					o.mu.Unlock()
+			} else {
+				child, found, ok := fastScanObjectChildLocked(o, part)
+				o.mu.Unlock()
+				if !ok {
 					return nil
 				}
-				pos = valEnd2 + 1
-				// skip comma or end
-				for pos < len(raw) && (raw[pos] == ' ' || raw[pos] == '\n' || raw[pos] == '\r' || raw[pos] == '\t') {
-					pos++
+				if !found {
+					return sharedInvalidNode()
 				}
-				if pos < len(raw) && raw[pos] == ',' {
-					pos++
-					continue
-				}
-				if pos < len(raw) && raw[pos] == '}' {
-					break
-				}
-				o.mu.Unlock()
-				return nil
+				cur = child
 			}
-			if !found {
-				o.mu.Unlock()
-				return sharedInvalidNode()
-			}
-			partIndex++
 			if q >= len(path) {
-				break
+				return cur
 			}
+			partIndex++
 			p = q + 1
 			// skip consecutive slashes
 			for p < len(path) && path[p] == '/' {
@@ -897,7 +1154,7 @@ func tryFastSlashQuery(start core.Node, path string) core.Node {
 // building intermediate nodes. It supports segments like a/b/c and [idx]
 // after a key, e.g., a/b[0]/c. It returns nil if the path isn't eligible.
 func tryRawDirectPath(start core.Node, path string) core.Node {
-	if path == "" || strings.ContainsAny(path, "*@.") || strings.Contains(path, "//") || strings.HasPrefix(path, "../") {
+	if path == "" || strings.ContainsAny(path, "*@.{") || strings.Contains(path, "//") || strings.HasPrefix(path, "../") {
 		return nil
 	}
 	// root must be object or array with raw data and not parsed/dirty
@@ -986,17 +1243,7 @@ func tryRawDirectPath(start core.Node, path string) core.Node {
 			if pos >= len(raw) {
 				return nil, false
 			}
-			var valEnd int
-			switch raw[pos] {
-			case '{':
-				valEnd = findMatchingBrace(raw, pos)
-			case '[':
-				valEnd = findMatchingBracket(raw, pos)
-			case '"':
-				valEnd = findMatchingQuote(raw, pos)
-			default:
-				valEnd = findValueEnd(raw, pos)
-			}
+			valEnd := rawValueEnd(raw, pos)
 			if valEnd == -1 {
 				return nil, false
 			}
@@ -1051,17 +1298,7 @@ func tryRawDirectPath(start core.Node, path string) core.Node {
 				break
 			}
 			elemStart := pos
-			var elemEnd int
-			switch raw[pos] {
-			case '{':
-				elemEnd = findMatchingBrace(raw, pos)
-			case '[':
-				elemEnd = findMatchingBracket(raw, pos)
-			case '"':
-				elemEnd = findMatchingQuote(raw, pos)
-			default:
-				elemEnd = findValueEnd(raw, pos)
-			}
+			elemEnd := rawValueEnd(raw, pos)
 			if elemEnd == -1 {
 				return nil, false
 			}
@@ -1200,6 +1437,15 @@ func tryRawDirectPath(start core.Node, path string) core.Node {
 		if len(curRaw) == 0 {
 			return sharedInvalidNode()
 		}
+		if bn := nodeBase(start); bn != nil && bn.arena != nil {
+			p := newParser(curRaw, start.GetFuncs())
+			p.arena = bn.arena
+			p.lenient = documentLeniency(bn)
+			return p.doParse(start)
+		}
+		if curRaw[0] != '{' && curRaw[0] != '[' && !wellFormedScalar(curRaw) {
+			return newParser(curRaw, start.GetFuncs()).doParse(start)
+		}
 		switch curRaw[0] {
 		case '{':
 			return NewObjectNode(start, curRaw, start.GetFuncs())
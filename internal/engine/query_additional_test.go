@@ -63,6 +63,12 @@ func TestQueryPlanAndCompiledQueryCaches(t *testing.T) {
 		}
 	}
 
+	// The caches take no entries once full, as the tests before this one
+	// may have left them; fresh ones keep the path cached.
+	oldCompiled, oldPlans := compiledQueryCache.m, fastQueryPlanCache.m
+	compiledQueryCache.m = make(map[string][]queryToken)
+	fastQueryPlanCache.m = make(map[string]*fastQueryPlan)
+	defer func() { compiledQueryCache.m, fastQueryPlanCache.m = oldCompiled, oldPlans }()
 	if _, ok := getFastQueryPlan("/a/b[1]"); !ok {
 		t.Fatal("expected getFastQueryPlan cache fill")
 	}
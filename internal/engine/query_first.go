@@ -0,0 +1,65 @@
+package engine
+
+import (
+	"fmt"
+
+	"github.com/474420502/xjson/internal/core"
+)
+
+// QueryN is Query for at most limit matches: the first limit, in document
+// order. When the last step of path is a recursive descent, //*, a wildcard
+// or a filter, the walk stops at the limit-th match instead of collecting
+// every match first. A path that selects a single value returns it like
+// Query does; a limit of 0 yields an empty match set. Results are not
+// cached.
+func (n *baseNode) QueryN(path string, limit int) (result core.Node) {
+	if n.err != nil {
+		return newInvalidNode(n.err)
+	}
+	if limit < 0 {
+		return newInvalidNode(fmt.Errorf("negative limit: %d", limit))
+	}
+	defer recoverPanic("Query", path, &result)
+	tokens, err := ParseQuery(path)
+	if err != nil {
+		return newInvalidNode(err)
+	}
+	return limitMatches(runQueryTokens(queryStart(n.selfOrMe(), path), tokens, nil, limit), limit)
+}
+
+// QueryFirst returns the first match of path in document order, itself
+// rather than in a match set, and stops searching once it is found. When
+// path matches nothing the result is invalid and its error wraps
+// core.ErrNoMatches; a missing path keeps the error Query gives it.
+func (n *baseNode) QueryFirst(path string) core.Node {
+	result := n.QueryN(path, 1)
+	if !result.IsValid() {
+		return result
+	}
+	if arr, ok := result.(*arrayNode); ok && (arr.matchSet || arr.selection) {
+		if len(arr.value) == 0 {
+			return n.scoped(newInvalidNode(&core.PathError{Path: path, Op: "QueryFirst", Err: core.ErrNoMatches}))
+		}
+		return arr.value[0]
+	}
+	return result
+}
+
+// limitMatches cuts the match set or slice result to its first limit
+// matches. Any other valid result is a single match.
+func limitMatches(result core.Node, limit int) core.Node {
+	if !result.IsValid() {
+		return result
+	}
+	arr, ok := result.(*arrayNode)
+	if !ok || !(arr.matchSet || arr.selection) {
+		if limit == 0 {
+			return newMatchSet(result.Parent(), nil, result.GetFuncs())
+		}
+		return result
+	}
+	if len(arr.value) <= limit {
+		return result
+	}
+	return newMatchSet(arr.parent, arr.value[:limit:limit], arr.funcs)
+}
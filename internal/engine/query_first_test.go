@@ -0,0 +1,126 @@
+package engine
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/474420502/xjson/internal/core"
+)
+
+const queryFirstDoc = `{"store":{"book":[{"title":"a","price":8,"tags":["x"]},{"title":"b","price":12,"meta":{"title":"inner"}},{"title":"c","price":5}],` +
+	`"bicycle":{"color":"red","price":19}},"title":"top","list":[[1,2],[3,[4,5]]],"empty":{}}`
+
+var queryFirstPaths = []string{
+	"//title", "//price", "//*", "..*", "//tags[0]", "/store/book[*]", "/store/book[*]/title", "/store/*",
+	"/store/book[?(@.price > 6)]", "/store/book[?(@.price > 100)]", "/store/book[1:3]", "/list[*][*]",
+	"//missing", "/title", "/store/book", "/store/book[2]/title", "/nope/deeper", "/empty/*", "//book/title",
+	"/store/book/title", "//meta/title",
+}
+
+func TestQueryFirstAndQueryNMatchQuery(t *testing.T) {
+	forms := map[string]func() core.Node{
+		"lazy": func() core.Node { n, _ := Parse([]byte(queryFirstDoc)); return n },
+		"full": func() core.Node { n, _ := MustParse([]byte(queryFirstDoc)); return n },
+		"modified": func() core.Node {
+			n, _ := Parse([]byte(queryFirstDoc))
+			n.Query("/store/book[0]").Set("price", 9)
+			return n
+		},
+	}
+	for form, build := range forms {
+		for _, path := range queryFirstPaths {
+			full := build().Query(path)
+			all := Matches(full)
+
+			first := build().QueryFirst(path)
+			switch {
+			case !full.IsValid():
+				if first.IsValid() {
+					t.Errorf("%s %s: QueryFirst = %s for an invalid query", form, path, first)
+				}
+			case len(all) == 0:
+				if first.IsValid() || !errors.Is(first.Error(), core.ErrNoMatches) {
+					t.Errorf("%s %s: QueryFirst = %v (%v), want ErrNoMatches", form, path, first, first.Error())
+				}
+			case first.Canonical() != all[0].Canonical():
+				t.Errorf("%s %s: QueryFirst = %s, want %s", form, path, first.Canonical(), all[0].Canonical())
+			}
+
+			for limit := 0; limit <= 4; limit++ {
+				got := build().QueryN(path, limit)
+				if !full.IsValid() {
+					if got.IsValid() {
+						t.Errorf("%s %s: QueryN(%d) is valid for an invalid query", form, path, limit)
+					}
+					continue
+				}
+				want := all
+				if len(want) > limit {
+					want = want[:limit]
+				}
+				if describeMatches(Matches(got)) != describeMatches(want) {
+					t.Errorf("%s %s: QueryN(%d) = %s, want %s", form, path, limit, describeMatches(Matches(got)), describeMatches(want))
+				}
+			}
+		}
+	}
+}
+
+func TestQueryNKeepsSingleValues(t *testing.T) {
+	root, _ := Parse([]byte(queryFirstDoc))
+	if got := root.QueryN("/store/book", 1); got.Type() != core.Array || got.Len() != 3 {
+		t.Errorf("QueryN on an array value = %s, want the array itself", got)
+	}
+	if got := root.QueryFirst("/store/book"); got.Len() != 3 {
+		t.Errorf("QueryFirst on an array value = %s, want the array itself", got)
+	}
+	if got := root.QueryN("/title", 0); !got.IsValid() || got.Len() != 0 {
+		t.Errorf("QueryN(0) = %s, want an empty match set", got)
+	}
+	if got := root.QueryN("//title", -1); got.IsValid() {
+		t.Error("a negative limit should be an error")
+	}
+	if got := root.QueryFirst("/store/book[0]/title").Parent(); got == nil || got.Get("price").Int() != 8 {
+		t.Error("QueryFirst should keep the parent of the match")
+	}
+}
+
+// TestQueryFirstStopsEarly checks that QueryFirst and QueryN do not visit
+// the values after their matches: their allocations do not grow with the
+// document.
+func TestQueryFirstStopsEarly(t *testing.T) {
+	item := `{"id":1,"customer":{"address":{"zip":"12345"}},"items":[{"sku":"a"},{"sku":"b"}]}`
+	queries := map[string]func(core.Node) core.Node{
+		"recursive": func(n core.Node) core.Node { return n.QueryFirst("//zip") },
+		"all":       func(n core.Node) core.Node { return n.QueryN("/orders[0]//*", 2) },
+		"wildcard":  func(n core.Node) core.Node { return n.QueryFirst("/orders[*]") },
+		"filter":    func(n core.Node) core.Node { return n.QueryN("/orders[?(@.id == 1)]", 2) },
+	}
+	for name, query := range queries {
+		allocs := map[int]float64{}
+		for _, n := range []int{10, 1000} {
+			root, err := Parse([]byte(`{"orders":[` + strings.Repeat(item+",", n-1) + item + `]}`))
+			if err != nil {
+				t.Fatalf("Parse failed: %v", err)
+			}
+			allocs[n] = testing.AllocsPerRun(20, func() {
+				if !query(root).IsValid() {
+					t.Fatalf("%s: no match", name)
+				}
+			})
+		}
+		if allocs[1000] > allocs[10] {
+			t.Errorf("%s: %v allocations on 1000 orders and %v on 10", name, allocs[1000], allocs[10])
+		}
+	}
+}
+
+func describeMatches(matches []core.Node) string {
+	parts := make([]string, len(matches))
+	for i, m := range matches {
+		parts[i] = m.Canonical()
+	}
+	return fmt.Sprint(parts)
+}
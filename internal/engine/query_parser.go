@@ -20,6 +20,9 @@ const (
 	OpWildcard  = internalquery.OpWildcard
 	OpRecursive = internalquery.OpRecursiveKey
 	OpParent    = internalquery.OpParent
+	OpFilter    = internalquery.OpFilter
+	OpPick      = internalquery.OpPick
+	OpAll       = internalquery.OpAll
 )
 
 type queryToken struct {
@@ -135,13 +138,15 @@ func (cq *CompiledQuery) Path() string {
 	return cq.path
 }
 
-func (cq *CompiledQuery) Query(start core.Node) core.Node {
+func (cq *CompiledQuery) Query(start core.Node) (result core.Node) {
 	if cq == nil {
 		return newInvalidNode(fmt.Errorf("nil compiled query"))
 	}
 	if start == nil {
 		return newInvalidNode(fmt.Errorf("nil start node"))
 	}
+	defer recoverPanic("Query", cq.path, &result)
+	start = queryStart(start, cq.path)
 
 	if enableQueryCache && cq.path != "" {
 		if bn, ok := start.(interface {
@@ -153,7 +158,6 @@ func (cq *CompiledQuery) Query(start core.Node) core.Node {
 		}
 	}
 
-	var result core.Node
 	if cq.fastPlan != nil {
 		result = executeFastQueryPlan(start, cq.fastPlan)
 	} else if cq.specialized != nil {
@@ -163,8 +167,17 @@ func (cq *CompiledQuery) Query(start core.Node) core.Node {
 	} else {
 		result = executeQueryTokens(start, cq.tokens)
 	}
+	if result == nil {
+		// The fast plans give up on dirty objects and on steps that do not
+		// fit the node type; the general evaluator handles both.
+		tokens, err := ParseQuery(cq.path)
+		if err != nil {
+			return newInvalidNode(err)
+		}
+		result = executeQueryTokens(start, tokens)
+	}
 
-	if enableQueryCache && cq.path != "" {
+	if enableQueryCache && cq.path != "" && queryTokensCacheable(cq.tokens) {
 		if bn, ok := start.(interface{ setCachedQueryResult(string, core.Node) }); ok {
 			bn.setCachedQueryResult(cq.path, result)
 		}
@@ -366,7 +379,7 @@ func getFastQueryPlan(path string) (*fastQueryPlan, bool) {
 }
 
 func compileFastQueryPlan(path string) (*fastQueryPlan, bool) {
-	if path == "" || path == "/" || path == "//" {
+	if path == "" || path == "/" {
 		return &fastQueryPlan{}, true
 	}
 	if len(path) >= 2 && path[0] == '.' && path[1] == '.' {
@@ -390,13 +403,16 @@ func compileFastQueryPlan(path string) (*fastQueryPlan, bool) {
 		kStart := i
 		for i < len(path) && path[i] != '/' && path[i] != '[' {
 			switch path[i] {
-			case '*', '@', '.':
+			case '*', '@', '.', '{':
 				return nil, false
 			}
 			i++
 		}
 		if kStart < i {
 			seg.key = path[kStart:i]
+			if _, ok := internalquery.StructureFunc(seg.key); ok || isBlank(seg.key) {
+				return nil, false
+			}
 		}
 
 		for i < len(path) && path[i] == '[' {
@@ -448,3 +464,9 @@ func compileFastQueryPlan(path string) (*fastQueryPlan, bool) {
 
 	return &fastQueryPlan{segments: segments}, true
 }
+
+// isBlank reports whether a path segment is only space, which the
+// tokenizer skips rather than reading as a key.
+func isBlank(segment string) bool {
+	return strings.TrimLeft(segment, " \t\n\r") == ""
+}
@@ -476,3 +476,169 @@ func TestPathFunctions(t *testing.T) {
 		}
 	})
 }
+
+func TestChainedProjections(t *testing.T) {
+	root, err := Parse([]byte(`{"data":[
+		{"user":{"profile":{"id":1}}},
+		{"user":{"profile":{"id":2},"tags":["x"]}},
+		{"other":true},
+		{"user":{"name":"no profile"}},
+		{"user":{"profile":{"id":3}}}
+	],"groups":{"a":{"user":{"id":"ga"}},"b":{"user":{"id":"gb"}}}}`))
+	if err != nil {
+		t.Fatalf("Parse failed: %v", err)
+	}
+	testCases := []struct {
+		path string
+		want []string
+	}{
+		{"/data/user/profile/id", []string{"1", "2", "3"}},
+		{"/data/*/user/profile/id", []string{"1", "2", "3"}},
+		{"/data/user/*/id", []string{"1", "2", "3"}},
+		{"/data/*/user/*/id", []string{"1", "2", "3"}},
+		{"/data/user/tags/*", []string{"x"}},
+		{"/groups/*/user/id", []string{"ga", "gb"}},
+		{"/data/user/profile/id[1:]", []string{"2", "3"}},
+		{"/data/user/profile[0]/id", []string{"1"}},
+	}
+	for _, tc := range testCases {
+		if got := root.Query(tc.path).Strings(); !reflect.DeepEqual(got, tc.want) {
+			t.Errorf("Query(%s) = %v, want %v", tc.path, got, tc.want)
+		}
+	}
+
+	ids := root.Query("/data/user/profile/id")
+	if ids.Len() != 3 {
+		t.Fatalf("Len = %d, want 3", ids.Len())
+	}
+	// The result keeps the matches of the step before it as its parent.
+	if got := ids.Parent().Len(); got != 3 || ids.Parent().Index(0).Get("id").Int() != 1 {
+		t.Errorf("Parent() = %s, want the profiles", ids.Parent().String())
+	}
+	if got := root.Query("/data/user/profile/id/../id").Strings(); !reflect.DeepEqual(got, []string{"1", "2", "3"}) {
+		t.Errorf("parent step after a projection = %v", got)
+	}
+	if res := root.Query("/data/user/missing/id"); res.IsValid() {
+		t.Errorf("projection through a missing key = %s, want invalid", res.String())
+	}
+
+	// Writes through a projection reach the document.
+	root.Query("/data/user/profile").Set("seen", true)
+	if got := root.Query("/data[4]/user/profile/seen").Bool(); !got {
+		t.Errorf("write through a projection was lost: %s", root.String())
+	}
+}
+
+func TestChainedProjectionAllocations(t *testing.T) {
+	var b strings.Builder
+	b.WriteString(`{"data":[`)
+	for i := 0; i < 10000; i++ {
+		if i > 0 {
+			b.WriteByte(',')
+		}
+		b.WriteString(`{"user":{"profile":{"id":1}}}`)
+	}
+	b.WriteString(`]}`)
+	root, err := Parse([]byte(b.String()))
+	if err != nil {
+		t.Fatalf("Parse failed: %v", err)
+	}
+	if got := root.Query("/data/user/profile/id").Len(); got != 10000 {
+		t.Fatalf("projection matched %d values, want 10000", got)
+	}
+	// The compiled-query cache takes no entries once full, and the tests
+	// before this one may have filled it; a fresh one keeps the path cached.
+	oldCompiled := compiledQueryCache.m
+	compiledQueryCache.m = make(map[string][]queryToken)
+	defer func() { compiledQueryCache.m = oldCompiled }()
+	// Every step used to grow its own result slice and wrap it in a match
+	// set, about 60 allocations here; a run now needs two buffers and two
+	// match sets whatever the size of the array.
+	allocs := testing.AllocsPerRun(20, func() {
+		ResetQueryCache(root)
+		root.Query("/data/user/profile/id")
+	})
+	if allocs > 10 {
+		t.Errorf("chained projection allocated %.0f times per query, want at most 10", allocs)
+	}
+
+	// Wildcards over the matches keep to the same buffers.
+	b.Reset()
+	b.WriteString(`{"data":[`)
+	for i := 0; i < 1000; i++ {
+		if i > 0 {
+			b.WriteByte(',')
+		}
+		b.WriteString(`{"items":[{"id":1},{"id":2},{"id":3}]}`)
+	}
+	b.WriteString(`]}`)
+	if root, err = Parse([]byte(b.String())); err != nil {
+		t.Fatalf("Parse failed: %v", err)
+	}
+	if got := root.Query("/data/*/items/*/id").Len(); got != 3000 {
+		t.Fatalf("wildcard projection matched %d values, want 3000", got)
+	}
+	allocs = testing.AllocsPerRun(20, func() {
+		ResetQueryCache(root)
+		root.Query("/data/*/items/*/id")
+	})
+	if allocs > 30 {
+		t.Errorf("wildcard projection allocated %.0f times per query, want at most 30", allocs)
+	}
+}
+
+func TestWildcardProjections(t *testing.T) {
+	root, err := Parse([]byte(`{"data":[
+		{"items":[{"id":1},{"id":2}]},
+		{"items":[]},
+		{"other":true},
+		{"items":{"x":{"id":3},"y":{"name":"no id"}}},
+		{"items":[{"id":4},"scalar",[{"id":"nested"}]]}
+	]}`))
+	if err != nil {
+		t.Fatalf("Parse failed: %v", err)
+	}
+	testCases := []struct {
+		path string
+		want []string
+	}{
+		{"/data/*/items/*/id", []string{"1", "2", "3", "4"}},
+		{"/data[*]/items[*]/id", []string{"1", "2", "3", "4"}},
+		{"/data/*/items/*/*/id", []string{"nested"}},
+		{"/data/items/*/id", []string{"1", "2", "3", "4"}},
+		{"//items/*/id", []string{"1", "2", "3", "4"}},
+		{"/data[?(@.items)]/items/*/id", []string{"1", "2", "3", "4"}},
+		{"/data/*/items/*/id[1:3]", []string{"2", "3"}},
+	}
+	for _, tc := range testCases {
+		if got := root.Query(tc.path).Strings(); !reflect.DeepEqual(got, tc.want) {
+			t.Errorf("Query(%s) = %v, want %v", tc.path, got, tc.want)
+		}
+	}
+
+	var paths []string
+	root.Query("/data/*/items/*/id").ForEachPath(func(path string, _ core.Node) bool {
+		paths = append(paths, path)
+		return true
+	})
+	if want := []string{"/data[0]/items[0]/id", "/data[0]/items[1]/id", "/data[3]/items/x/id", "/data[4]/items[0]/id"}; !reflect.DeepEqual(paths, want) {
+		t.Errorf("paths = %v, want %v", paths, want)
+	}
+	if got := root.Query("/data/*/items/*/id").First().Int(); got != 1 {
+		t.Errorf("First = %d, want 1", got)
+	}
+	if res := root.Query("/data/*/items/*/missing"); res.IsValid() {
+		t.Errorf("projection through a missing key = %s, want invalid", res.String())
+	}
+
+	// Writes through the projection reach the document, all or nothing.
+	if res := root.Query("/data/*/items/*").Set("seen", true); res.IsValid() || root.Query("/data[0]/items[0]/seen").Exists() {
+		t.Errorf("Set over a scalar match = %v, want it rejected", res.Error())
+	}
+	if res := root.Query("/data/*/items/*/id").SetValue(0); !res.IsValid() {
+		t.Fatalf("SetValue failed: %v", res.Error())
+	}
+	if got := root.Query("/data/*/items/*/id").Strings(); !reflect.DeepEqual(got, []string{"0", "0", "0", "0"}) {
+		t.Errorf("ids after SetValue = %v: %s", got, root.String())
+	}
+}
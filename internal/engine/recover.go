@@ -0,0 +1,22 @@
+package engine
+
+import (
+	"runtime/debug"
+
+	"github.com/474420502/xjson/internal/core"
+)
+
+// recoverPanic is deferred by the entry points that run a query or a
+// registered function. It turns a panic into an invalid *result whose error
+// is a *core.PathError wrapping a *core.PanicError, so a bad query or a
+// faulty function fails like any other query instead of crashing the
+// goroutine.
+func recoverPanic(op, path string, result *core.Node) {
+	if r := recover(); r != nil {
+		*result = newInvalidNode(&core.PathError{
+			Path: path,
+			Op:   op,
+			Err:  &core.PanicError{Value: r, Stack: debug.Stack()},
+		})
+	}
+}
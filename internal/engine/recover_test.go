@@ -0,0 +1,130 @@
+package engine
+
+import (
+	"errors"
+	"math/rand"
+	"strings"
+	"testing"
+
+	"github.com/474420502/xjson/internal/core"
+)
+
+const recoverDoc = `{"items":[{"id":1,"tags":["a"]},{"id":2}],"n":3,"s":"x"}`
+
+func assertPanicResult(t *testing.T, what string, result core.Node, op, value string) {
+	t.Helper()
+	if result.IsValid() {
+		t.Fatalf("%s: result is valid, want the recovered panic", what)
+	}
+	var pathErr *core.PathError
+	var panicErr *core.PanicError
+	if !errors.As(result.Error(), &pathErr) || !errors.As(result.Error(), &panicErr) {
+		t.Fatalf("%s: error %v, want a *PathError wrapping a *PanicError", what, result.Error())
+	}
+	if pathErr.Op != op || panicErr.Value != value || len(panicErr.Stack) == 0 {
+		t.Errorf("%s: Op %q, panic %v, %d stack bytes", what, pathErr.Op, panicErr.Value, len(panicErr.Stack))
+	}
+}
+
+func TestPanickingFunctionsDoNotEscape(t *testing.T) {
+	root, err := Parse([]byte(recoverDoc))
+	if err != nil {
+		t.Fatalf("Parse failed: %v", err)
+	}
+	root.RegisterFunc("boom", func(core.Node) core.Node { panic("boom") })
+	root.RegisterFuncArgs("boomArgs", func(core.Node, ...core.Arg) core.Node { panic("boom") })
+
+	assertPanicResult(t, "Query", root.Query("/items[@boom]"), "CallFunc", "boom")
+	assertPanicResult(t, "CallFunc", root.CallFunc("boom"), "CallFunc", "boom")
+	assertPanicResult(t, "CallFunc with args", root.CallFunc("boomArgs", core.Arg{}), "CallFunc", "boom")
+	assertPanicResult(t, "QueryParams", root.QueryParams("/items[?(@.id == ?)][@boom]", 1), "CallFunc", "boom")
+	assertPanicResult(t, "Apply", root.Apply(core.UnaryPathFunc(func(core.Node) core.Node { panic("boom") })), "Apply", "boom")
+	assertPanicResult(t, "Apply predicate", root.Get("items").Apply(core.PredicateFunc(func(core.Node) bool { panic("boom") })), "Apply", "boom")
+
+	cq, err := CompileQuery("/items[@boom]")
+	if err != nil {
+		t.Fatalf("CompileQuery failed: %v", err)
+	}
+	assertPanicResult(t, "CompiledQuery", cq.Query(root), "CallFunc", "boom")
+
+	// A panic with an error value unwraps to it.
+	sentinel := errors.New("sentinel")
+	root.RegisterFunc("boomErr", func(core.Node) core.Node { panic(sentinel) })
+	if err := root.Query("/items[@boomErr]").Error(); !errors.Is(err, sentinel) {
+		t.Errorf("error %v should wrap the panic value", err)
+	}
+
+	// The document is still usable and a failing query is not cached.
+	calls := 0
+	root.RegisterFunc("flaky", func(n core.Node) core.Node {
+		if calls++; calls == 1 {
+			panic("first call")
+		}
+		return n
+	})
+	if root.Query("/items[@flaky]").IsValid() || root.Query("/items[@flaky]").Len() != 2 {
+		t.Errorf("a recovered query should be evaluated again, calls = %d", calls)
+	}
+	if root.Query("/items[1]/id").Int() != 2 {
+		t.Error("document should stay usable after a recovered panic")
+	}
+}
+
+func TestQueryPanicsAreRecovered(t *testing.T) {
+	root, err := Parse([]byte(recoverDoc))
+	if err != nil {
+		t.Fatalf("Parse failed: %v", err)
+	}
+	// A panic below the function layer, such as one in a predicate run by
+	// a filter, is recovered by the query itself.
+	root.RegisterFunc("filterBoom", func(n core.Node) core.Node {
+		return n.Filter(func(core.Node) bool { panic("deep") })
+	})
+	result := root.Query("/items[@filterBoom]")
+	assertPanicResult(t, "nested panic", result, "CallFunc", "deep")
+	if !strings.Contains(result.Error().Error(), "CallFunc filterBoom: panic: deep") {
+		t.Errorf("error = %q", result.Error())
+	}
+}
+
+// garbageQuery returns a random string over the characters of the query
+// syntax, weighted toward the ones that open nested constructs.
+func garbageQuery(r *rand.Rand) string {
+	const alphabet = `/[]()?@.*:-!=<>&|'"\ 0123456789abcitemsnid,$`
+	var b strings.Builder
+	for n := r.Intn(24); n >= 0; n-- {
+		b.WriteByte(alphabet[r.Intn(len(alphabet))])
+	}
+	return b.String()
+}
+
+func queryNoPanic(t *testing.T, root core.Node, path string) {
+	t.Helper()
+	defer func() {
+		if r := recover(); r != nil {
+			t.Fatalf("query %q panicked: %v", path, r)
+		}
+	}()
+	root.Query(path)
+	root.QueryParams(path, 1, "a")
+	if cq, err := CompileQuery(path); err == nil {
+		cq.Query(root)
+	}
+}
+
+func TestGarbageQueriesDoNotPanic(t *testing.T) {
+	lazy, err := Parse([]byte(recoverDoc))
+	if err != nil {
+		t.Fatalf("Parse failed: %v", err)
+	}
+	full, err := MustParse([]byte(recoverDoc))
+	if err != nil {
+		t.Fatalf("MustParse failed: %v", err)
+	}
+	r := rand.New(rand.NewSource(1))
+	for i := 0; i < 5000; i++ {
+		path := garbageQuery(r)
+		queryNoPanic(t, lazy, path)
+		queryNoPanic(t, full, path)
+	}
+}
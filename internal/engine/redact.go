@@ -0,0 +1,251 @@
+package engine
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"strconv"
+
+	"github.com/474420502/xjson/internal/core"
+	internalquery "github.com/474420502/xjson/internal/query"
+)
+
+// BytesWith encodes the node like Bytes and applies opts on the way. The
+// encoding is parsed again into a private copy that is walked instead of
+// the node, so the document is neither parsed further nor modified.
+// The result is compact; subtrees that no pattern can reach are copied
+// from the encoding when there is no Transform.
+func (n *baseNode) BytesWith(opts core.SerializeOptions) ([]byte, error) {
+	if n.err != nil {
+		return nil, n.err
+	}
+	w := redactWriter{transform: opts.Transform, placeholder: []byte(opts.Placeholder)}
+	if len(w.placeholder) == 0 {
+		w.placeholder = []byte(core.DefaultRedactPlaceholder)
+	} else if !json.Valid(w.placeholder) {
+		return nil, &core.PathError{Op: "BytesWith", Err: fmt.Errorf("placeholder %q is not valid JSON: %w", opts.Placeholder, core.ErrInvalidParam)}
+	}
+	for _, pattern := range opts.Redact {
+		tokens, err := parseRedactPattern(pattern)
+		if err != nil {
+			return nil, &core.PathError{Path: pattern, Op: "BytesWith", Err: err}
+		}
+		w.patterns = append(w.patterns, tokens)
+	}
+
+	data, err := n.selfOrMe().Bytes()
+	if err != nil {
+		return nil, err
+	}
+	if len(w.patterns) == 0 && w.transform == nil {
+		return data, nil
+	}
+	doc, err := parseLazy(data, n.funcs, nil, documentLeniency(n))
+	if err != nil {
+		return nil, err
+	}
+	var buf bytes.Buffer
+	if err := w.write(&buf, doc, nil); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// parseRedactPattern parses a query path and checks that it only uses the
+// steps a redaction pattern supports.
+func parseRedactPattern(pattern string) ([]internalquery.QueryToken, error) {
+	tokens, err := internalquery.NewParser(pattern).Parse()
+	if err != nil {
+		return nil, err
+	}
+	for _, token := range tokens {
+		switch token.Type {
+		case OpKey, OpIndex, OpSlice, OpWildcard, OpRecursive, OpAll:
+		default:
+			return nil, fmt.Errorf("redaction patterns only support keys, indices, slices and wildcards")
+		}
+	}
+	return tokens, nil
+}
+
+// redactSegment is one step from the serialized node to a value: a key of
+// an object, or an index into an array of length len.
+type redactSegment struct {
+	key     string
+	index   int
+	len     int
+	inArray bool
+}
+
+// redactWriter writes a value with the redactions and replacements of a
+// SerializeOptions.
+type redactWriter struct {
+	patterns    [][]internalquery.QueryToken
+	placeholder []byte
+	transform   func(path string, node core.Node) (interface{}, bool)
+}
+
+// matches reports whether a pattern selects the value at segs, or, with
+// prefix set, whether one may select a value below it.
+func (w *redactWriter) matches(segs []redactSegment, prefix bool) bool {
+	for _, tokens := range w.patterns {
+		if matchRedactPattern(tokens, segs, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+func matchRedactPattern(tokens []internalquery.QueryToken, segs []redactSegment, prefix bool) bool {
+	if len(tokens) == 0 {
+		return len(segs) == 0
+	}
+	t := tokens[0]
+	switch t.Type {
+	case OpRecursive, OpAll:
+		if prefix {
+			return true
+		}
+		for i, seg := range segs {
+			if t.Type == OpRecursive && (seg.inArray || seg.key != t.Value.(string)) {
+				continue
+			}
+			if matchRedactPattern(tokens[1:], segs[i+1:], prefix) {
+				return true
+			}
+		}
+		return false
+	}
+	if len(segs) == 0 {
+		return prefix
+	}
+	seg := segs[0]
+	switch t.Type {
+	case OpKey:
+		if seg.inArray || seg.key != t.Value.(string) {
+			return false
+		}
+	case OpIndex:
+		index := t.Value.(int)
+		if !seg.inArray {
+			// A numeric step names a member of an object.
+			if seg.key != strconv.Itoa(index) {
+				return false
+			}
+			break
+		}
+		if index < 0 {
+			index += seg.len
+		}
+		if seg.index != index {
+			return false
+		}
+	case OpSlice:
+		bounds := t.Value.([2]int)
+		start, end := bounds[0], bounds[1]
+		if start < 0 {
+			start += seg.len
+		}
+		if end == -1 {
+			end = seg.len
+		} else if end < 0 {
+			end += seg.len
+		}
+		if !seg.inArray || seg.index < start || seg.index >= end {
+			return false
+		}
+	}
+	return matchRedactPattern(tokens[1:], segs[1:], prefix)
+}
+
+// write writes node, found at segs, to buf.
+func (w *redactWriter) write(buf *bytes.Buffer, node core.Node, segs []redactSegment) error {
+	if w.matches(segs, false) {
+		buf.Write(w.placeholder)
+		return nil
+	}
+	if w.transform != nil {
+		path := redactPath(segs)
+		replacement, redact := w.transform(path, node)
+		if redact {
+			buf.Write(w.placeholder)
+			return nil
+		}
+		if replacement != nil {
+			if err := writeReplacement(buf, replacement); err != nil {
+				return &core.PathError{Path: path, Op: "BytesWith", Err: err}
+			}
+			return nil
+		}
+	}
+	if t := node.Type(); (t == core.Object || t == core.Array) && w.transform == nil && !w.matches(segs, true) {
+		return json.Compact(buf, []byte(node.String()))
+	}
+
+	switch node.Type() {
+	case core.Object:
+		buf.WriteByte('{')
+		it := node.Iter()
+		for it.Next() {
+			if it.Index() > 0 {
+				buf.WriteByte(',')
+			}
+			writeJSONString(buf, it.Key())
+			buf.WriteByte(':')
+			if err := w.write(buf, it.Value(), append(segs, redactSegment{key: it.Key()})); err != nil {
+				return err
+			}
+		}
+		buf.WriteByte('}')
+		return it.Err()
+	case core.Array:
+		var elems []core.Node
+		it := node.Iter()
+		for it.Next() {
+			elems = append(elems, it.Value())
+		}
+		if err := it.Err(); err != nil {
+			return err
+		}
+		buf.WriteByte('[')
+		for i, elem := range elems {
+			if i > 0 {
+				buf.WriteByte(',')
+			}
+			if err := w.write(buf, elem, append(segs, redactSegment{index: i, len: len(elems), inArray: true})); err != nil {
+				return err
+			}
+		}
+		buf.WriteByte(']')
+		return nil
+	}
+	writeJSONValue(buf, node)
+	return nil
+}
+
+// writeReplacement writes a value returned by a Transform.
+func writeReplacement(buf *bytes.Buffer, replacement interface{}) error {
+	node, ok := replacement.(core.Node)
+	if !ok {
+		node = NewNodeFromInterface(nil, replacement, nil)
+	}
+	data, err := node.Bytes()
+	if err != nil {
+		return err
+	}
+	buf.Write(data)
+	return nil
+}
+
+// redactPath formats segs in the form Node.Path uses.
+func redactPath(segs []redactSegment) string {
+	var b bytes.Buffer
+	for _, seg := range segs {
+		if seg.inArray {
+			b.WriteString("[" + strconv.Itoa(seg.index) + "]")
+		} else {
+			b.WriteString("/" + formatPathKey(seg.key))
+		}
+	}
+	return b.String()
+}
@@ -0,0 +1,158 @@
+package engine
+
+import (
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/474420502/xjson/internal/core"
+)
+
+const redactDoc = `{
+	"users": [
+		{"name": "ann", "password": "p1", "ssn": "111", "tokens": ["a", "b"]},
+		{"name": "bob", "password": "p2", "ssn": "222", "profile": {"password": "p3"}}
+	],
+	"db": {"password": "root", "port": 5432},
+	"tags": [1, 2, 3, 4]
+}`
+
+func TestBytesWithRedact(t *testing.T) {
+	cases := []struct {
+		patterns []string
+		want     string
+	}{
+		{[]string{"//password"}, `{"users":[{"name":"ann","password":"[REDACTED]","ssn":"111","tokens":["a","b"]},{"name":"bob","password":"[REDACTED]","ssn":"222","profile":{"password":"[REDACTED]"}}],"db":{"password":"[REDACTED]","port":5432},"tags":[1,2,3,4]}`},
+		{[]string{"/users[*]/ssn", "/users/*/tokens"}, `{"users":[{"name":"ann","password":"p1","ssn":"[REDACTED]","tokens":"[REDACTED]"},{"name":"bob","password":"p2","ssn":"[REDACTED]","profile":{"password":"p3"}}],"db":{"password":"root","port":5432},"tags":[1,2,3,4]}`},
+		{[]string{"/users[-1]//password", "/tags[1:3]", "/db"}, `{"users":[{"name":"ann","password":"p1","ssn":"111","tokens":["a","b"]},{"name":"bob","password":"[REDACTED]","ssn":"222","profile":{"password":"[REDACTED]"}}],"db":"[REDACTED]","tags":[1,"[REDACTED]","[REDACTED]",4]}`},
+		{[]string{"/users[0]/tokens[0]", "/tags[-1]"}, `{"users":[{"name":"ann","password":"p1","ssn":"111","tokens":["[REDACTED]","b"]},{"name":"bob","password":"p2","ssn":"222","profile":{"password":"p3"}}],"db":{"password":"root","port":5432},"tags":[1,2,3,"[REDACTED]"]}`},
+		{[]string{"/users//*"}, `{"users":["[REDACTED]","[REDACTED]"],"db":{"password":"root","port":5432},"tags":[1,2,3,4]}`},
+		{[]string{"/missing", "//nothing"}, `{"users":[{"name":"ann","password":"p1","ssn":"111","tokens":["a","b"]},{"name":"bob","password":"p2","ssn":"222","profile":{"password":"p3"}}],"db":{"password":"root","port":5432},"tags":[1,2,3,4]}`},
+	}
+	for _, tc := range cases {
+		root, err := ParseWithOptions([]byte(redactDoc), ParseOptions{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		got, err := root.BytesWith(core.SerializeOptions{Redact: tc.patterns})
+		if err != nil {
+			t.Errorf("BytesWith(%q) error: %v", tc.patterns, err)
+			continue
+		}
+		if string(got) != tc.want {
+			t.Errorf("BytesWith(%q) =\n%s, want\n%s", tc.patterns, got, tc.want)
+		}
+	}
+}
+
+func TestBytesWithLeavesDocumentUntouched(t *testing.T) {
+	root, err := ParseWithOptions([]byte(redactDoc), ParseOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	obj := root.(*objectNode)
+
+	plain, err := root.Bytes()
+	if err != nil {
+		t.Fatal(err)
+	}
+	redacted, err := root.BytesWith(core.SerializeOptions{Redact: []string{"//password", "/users[*]/ssn"}, Placeholder: "null"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(string(redacted), "p1") || strings.Contains(string(redacted), "111") || !strings.Contains(string(redacted), `"ssn":null`) {
+		t.Errorf("redacted output = %s", redacted)
+	}
+	if obj.parsed.Load() || len(obj.value) != 0 || len(obj.rawIndex) != 0 {
+		t.Error("BytesWith parsed the document")
+	}
+	if again, _ := root.Bytes(); string(again) != string(plain) || string(plain) != redactDoc {
+		t.Errorf("Bytes after BytesWith = %s, want the source", again)
+	}
+
+	// A parsed and edited document is redacted from its current state and
+	// keeps it.
+	root.Query("/users[0]").Set("password", "new")
+	before := root.String()
+	redacted, err = root.BytesWith(core.SerializeOptions{Redact: []string{"//password"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(string(redacted), "new") || root.String() != before || root.Query("/users[0]/password").String() != "new" {
+		t.Errorf("edited document: BytesWith = %s, String = %s", redacted, root.String())
+	}
+
+	// A subtree is redacted relative to itself.
+	sub, err := root.Get("db").BytesWith(core.SerializeOptions{Redact: []string{"/password"}})
+	if err != nil || string(sub) != `{"password":"[REDACTED]","port":5432}` {
+		t.Errorf("subtree BytesWith = %s, %v", sub, err)
+	}
+}
+
+func TestBytesWithTransform(t *testing.T) {
+	root, err := ParseWithOptions([]byte(redactDoc), ParseOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var paths []string
+	got, err := root.Get("users").BytesWith(core.SerializeOptions{
+		Redact: []string{"[*]/tokens"},
+		Transform: func(path string, node core.Node) (interface{}, bool) {
+			paths = append(paths, path)
+			switch {
+			case strings.HasSuffix(path, "/ssn"):
+				return "***-" + node.String()[2:], false
+			case strings.HasSuffix(path, "/profile"):
+				return map[string]interface{}{"hidden": true}, false
+			case node.Type() == core.String && node.String() == "p2":
+				return nil, true
+			}
+			return nil, false
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := `[{"name":"ann","password":"p1","ssn":"***-1","tokens":"[REDACTED]"},{"name":"bob","password":"[REDACTED]","ssn":"***-2","profile":{"hidden":true}}]`
+	if string(got) != want {
+		t.Errorf("BytesWith =\n%s, want\n%s", got, want)
+	}
+	wantPaths := []string{"", "[0]", "[0]/name", "[0]/password", "[0]/ssn", "[1]", "[1]/name", "[1]/password", "[1]/ssn", "[1]/profile"}
+	if !reflect.DeepEqual(paths, wantPaths) {
+		t.Errorf("Transform paths = %q, want %q", paths, wantPaths)
+	}
+
+	_, err = root.BytesWith(core.SerializeOptions{Transform: func(path string, node core.Node) (interface{}, bool) {
+		if path == "/db/port" {
+			return struct{}{}, false
+		}
+		return nil, false
+	}})
+	var pathErr *core.PathError
+	if !errors.As(err, &pathErr) || pathErr.Path != "/db/port" {
+		t.Errorf("unsupported replacement error = %v", err)
+	}
+}
+
+func TestBytesWithErrors(t *testing.T) {
+	root, err := ParseWithOptions([]byte(redactDoc), ParseOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, pattern := range []string{"/users[?(@.name == 'ann')]", "/users[@f]", "/db/..", "/users{name}", "/a/["} {
+		var pathErr *core.PathError
+		if _, err := root.BytesWith(core.SerializeOptions{Redact: []string{pattern}}); !errors.As(err, &pathErr) || pathErr.Path != pattern {
+			t.Errorf("pattern %q: error = %v, want a *core.PathError for it", pattern, err)
+		}
+	}
+	if _, err := root.BytesWith(core.SerializeOptions{Redact: []string{"//password"}, Placeholder: "[REDACTED]"}); !errors.Is(err, core.ErrInvalidParam) {
+		t.Errorf("invalid placeholder error = %v, want ErrInvalidParam", err)
+	}
+	if _, err := root.Get("missing").BytesWith(core.SerializeOptions{}); err == nil {
+		t.Error("invalid node serialized without an error")
+	}
+	if _, err := root.Query("//nothing").BytesWith(core.SerializeOptions{Redact: []string{"//x"}}); !errors.Is(err, core.ErrNoMatches) {
+		t.Errorf("empty match set error = %v, want ErrNoMatches", err)
+	}
+}
@@ -0,0 +1,268 @@
+package engine
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/474420502/xjson/internal/core"
+)
+
+// Offsets given to NodeAt and Refresh are byte offsets in the source text of
+// a document, counted like Position().Offset: from the start of the text the
+// root was parsed from.
+
+// NodeAt returns the deepest value of the document under root whose source
+// text contains offset. Containers on the way are parsed one level at a
+// time; the values beside them stay unparsed.
+func NodeAt(root core.Node, offset int) (core.Node, error) {
+	rb, err := refreshRoot(root, "NodeAt")
+	if err != nil {
+		return nil, err
+	}
+	if offset < 0 || offset >= len(rb.raw) {
+		return nil, &core.PathError{Op: "NodeAt", Err: fmt.Errorf("%w: offset %d in a source of %d bytes", core.ErrIndexOutOfBounds, offset, len(rb.raw))}
+	}
+	cur := rb.self
+	for {
+		openContainer(cur)
+		if err := cur.Error(); err != nil {
+			return nil, err
+		}
+		var next core.Node
+		eachChild(cur, func(child core.Node) {
+			if s, ok := sourceOffset(rb.raw, nodeBase(child).raw); ok && s <= offset && offset < s+len(nodeBase(child).raw) {
+				next = child
+			}
+		})
+		if next == nil {
+			return cur, nil
+		}
+		cur = next
+	}
+}
+
+// Refresh replaces the bytes start to end of the source text of the document
+// under root with replacement, as an editor changing the text would, and
+// reparses only the deepest value whose text encloses the change without
+// reaching its first or last byte, so that it stays one value. The values
+// before it keep their nodes, those after it too with their offsets shifted,
+// and nodes that were not parsed yet stay unparsed. An edit that cuts through
+// the text of a value without covering it whole fails with an error wrapping
+// core.ErrSpanningEdit, and new text that is not valid with a
+// *core.SyntaxError located in the new source text; a failed refresh leaves
+// the document as it was. Refresh returns the root of the document, which is
+// a new node when the root value itself was reparsed; the replaced nodes
+// become stale.
+func Refresh(root core.Node, start, end int, replacement []byte) (core.Node, error) {
+	rb, err := refreshRoot(root, "Refresh")
+	if err != nil {
+		return nil, err
+	}
+	src := rb.raw
+	if start < 0 || end < start || end > len(src) {
+		return nil, &core.PathError{Op: "Refresh", Err: fmt.Errorf("%w: edit %d to %d in a source of %d bytes", core.ErrIndexOutOfBounds, start, end, len(src))}
+	}
+	if modified := findModified(rb.self); modified != nil {
+		return nil, &core.PathError{Op: "Refresh", Path: modified.Path(), Err: errors.New("the value was written to, so the document no longer follows its source text")}
+	}
+
+	// Find the deepest value holding the edit, checking that the edit does
+	// not cut through any value beside the path to it.
+	target := rb.self
+	for {
+		openContainer(target)
+		if err := target.Error(); err != nil {
+			return nil, err
+		}
+		var next core.Node
+		var crossed core.Node
+		crossedAt := 0
+		eachChild(target, func(child core.Node) {
+			s, _ := sourceOffset(src, nodeBase(child).raw)
+			e := s + len(nodeBase(child).raw)
+			switch {
+			case s < start && end < e:
+				next = child
+			case s <= start && end <= e, start <= s && e <= end, end <= s, e <= start:
+				// edited at its ends or whole, reparsed with target, or
+				// beside the edit
+			case crossed == nil || s < crossedAt:
+				// the first value cut through in the text is reported
+				crossed, crossedAt = child, s
+			}
+		})
+		if crossed != nil {
+			return nil, &core.PathError{Op: "Refresh", Path: crossed.Path(), Err: fmt.Errorf("%w: bytes %d to %d cut through the value", core.ErrSpanningEdit, start, end)}
+		}
+		if next == nil {
+			break
+		}
+		target = next
+	}
+
+	// The new text of the document and of the target.
+	delta := len(replacement) - (end - start)
+	buf := make([]byte, 0, len(src)+delta)
+	buf = append(append(append(buf, src[:start]...), replacement...), src[end:]...)
+	tb := nodeBase(target)
+	ts, _ := sourceOffset(src, tb.raw)
+	text := buf[ts : ts+len(tb.raw)+delta]
+	isRoot := target == rb.self
+
+	lenient := rb.leniency
+	if !isRoot {
+		lenient.trailingData = false
+	}
+	if err := validateValue(text, lenient, rb.duplicateKeys); err != nil {
+		var syntaxErr *core.SyntaxError
+		if errors.As(err, &syntaxErr) {
+			return nil, newSyntaxError(buf, ts+syntaxErr.Offset, syntaxErr.Msg)
+		}
+		return nil, newSyntaxError(buf, ts, err.Error())
+	}
+
+	if isRoot {
+		fresh, err := parseLazy(buf, rb.funcs, nil, rb.leniency)
+		if err != nil {
+			return nil, err
+		}
+		fb := nodeBase(fresh)
+		fb.trackPositions = rb.trackPositions
+		fb.duplicateKeys = rb.duplicateKeys
+		fb.strictConversions = rb.strictConversions
+		fb.mustBehavior.Store(rb.mustBehavior.Load())
+		fb.maxRecursionDepth = rb.maxRecursionDepth
+		fb.owner = rb.owner
+		detach(rb.self)
+		return fresh, nil
+	}
+
+	p := newParser(text, tb.funcs)
+	p.lenient = lenient
+	fresh := p.parseValueShallow(tb.parent)
+	if err := fresh.Error(); err != nil {
+		return nil, err
+	}
+	switch parent := tb.parent.(type) {
+	case *objectNode:
+		if key, ok := findObjectChildKey(parent, target); ok {
+			parent.value[key] = fresh
+		}
+		if parent.hasSingle && parent.singleChild == target {
+			parent.singleChild = fresh
+		}
+	case *arrayNode:
+		for i, child := range parent.value {
+			if child == target {
+				parent.value[i] = fresh
+			}
+		}
+	}
+	detach(target)
+
+	// Move every other node onto the new text.
+	var move func(node core.Node)
+	move = func(node core.Node) {
+		if node == fresh {
+			return
+		}
+		bn := nodeBase(node)
+		bn.clearQueryCache()
+		if s, ok := sourceOffset(src, bn.raw); ok {
+			e := s + len(bn.raw)
+			switch {
+			case e <= start:
+				bn.raw = buf[s:e]
+			case s >= end:
+				bn.raw = buf[s+delta : e+delta]
+			default:
+				// an ancestor of the target
+				bn.raw = buf[s : e+delta]
+				if bn.end != 0 {
+					bn.end += delta
+				}
+				if obj, ok := node.(*objectNode); ok {
+					obj.rawIndex, obj.rawScanPos, obj.rawDone = nil, 0, false
+				}
+			}
+		}
+		eachChild(node, move)
+	}
+	move(rb.self)
+	return rb.self, nil
+}
+
+// refreshRoot returns the base of root, which must be a valid document root.
+func refreshRoot(root core.Node, op string) (*baseNode, error) {
+	rb := nodeBase(root)
+	if rb == nil {
+		return nil, &core.PathError{Op: op, Err: errors.New("not a node of a parsed document")}
+	}
+	if rb.err != nil {
+		return nil, rb.err
+	}
+	if rb.parent != nil {
+		return nil, &core.PathError{Op: op, Path: root.Path(), Err: errors.New("not the root of its document")}
+	}
+	if arr, ok := root.(*arrayNode); ok && (arr.matchSet || arr.selection) || len(rb.raw) == 0 {
+		return nil, &core.PathError{Op: op, Err: errors.New("the node has no source text")}
+	}
+	return rb, nil
+}
+
+// openContainer makes the members of an object, or the elements of an
+// array, into nodes without parsing their own contents.
+func openContainer(node core.Node) {
+	switch typed := node.(type) {
+	case *objectNode:
+		typed.parseRaw(true)
+	case *arrayNode:
+		typed.lazyParse()
+	}
+}
+
+// eachChild calls fn with the children of node that are nodes already,
+// parsing nothing.
+func eachChild(node core.Node, fn func(child core.Node)) {
+	switch typed := node.(type) {
+	case *objectNode:
+		for _, child := range typed.value {
+			fn(child)
+		}
+	case *arrayNode:
+		for _, child := range typed.value {
+			fn(child)
+		}
+	}
+}
+
+// findModified returns a container under node that was written to, or nil.
+func findModified(node core.Node) core.Node {
+	if isDirtyContainer(node) {
+		return node
+	}
+	var found core.Node
+	eachChild(node, func(child core.Node) {
+		if found == nil {
+			found = findModified(child)
+		}
+	})
+	return found
+}
+
+// validateValue checks that text holds one value, following the leniency
+// and duplicate key policy of its document.
+func validateValue(text []byte, lenient leniency, duplicates DuplicateKeyPolicy) error {
+	var err error
+	if lenient == (leniency{}) {
+		err = ValidateBytes(text)
+	} else {
+		p := newParser(text, nil)
+		p.lenient = lenient
+		_, err = p.ParseFull()
+	}
+	if err == nil && duplicates == ErrorOnDuplicate {
+		err = checkDuplicateKeys(text)
+	}
+	return err
+}
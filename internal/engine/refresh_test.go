@@ -0,0 +1,192 @@
+package engine
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+
+	"github.com/474420502/xjson/internal/core"
+)
+
+const refreshDoc = `{
+  "name": "app",
+  "deps": [ {"id": 1, "tags": ["a", "b"]}, {"id": 2} ],
+  "meta": {"v": 10, "on": true}
+}`
+
+func TestNodeAt(t *testing.T) {
+	root, err := ParseWithOptions([]byte(refreshDoc), ParseOptions{TrackPositions: true})
+	if err != nil {
+		t.Fatalf("Parse failed: %v", err)
+	}
+	at := func(s string) int { return bytes.Index([]byte(refreshDoc), []byte(s)) }
+	if node, err := NodeAt(root, at(`"b"`)); err != nil || node.String() != "b" {
+		t.Fatalf("NodeAt = %v, %v", node, err)
+	}
+	if root.(*objectNode).value["meta"].(*objectNode).parsed.Load() {
+		t.Error("NodeAt parsed the members of an object beside the path")
+	}
+
+	cases := []struct {
+		offset int
+		path   string
+	}{
+		{0, ""},
+		{at(`"app"`), "/name"},
+		{at(`"app"`) + 4, "/name"},
+		{at(`"app"`) + 5, ""},
+		{at(`"name"`), ""},
+		{at(`[ {`), "/deps"},
+		{at(`"b"`), "/deps[0]/tags[1]"},
+		{at(`2}`), "/deps[1]/id"},
+		{at(`10`) + 1, "/meta/v"},
+		{at(`true`), "/meta/on"},
+		{len(refreshDoc) - 1, ""},
+	}
+	for _, tc := range cases {
+		node, err := NodeAt(root, tc.offset)
+		if err != nil {
+			t.Fatalf("NodeAt(%d) failed: %v", tc.offset, err)
+		}
+		if node.Path() != tc.path {
+			t.Errorf("NodeAt(%d) = %s, want %s", tc.offset, node.Path(), tc.path)
+		}
+	}
+	for _, offset := range []int{-1, len(refreshDoc)} {
+		if _, err := NodeAt(root, offset); !errors.Is(err, core.ErrIndexOutOfBounds) {
+			t.Errorf("NodeAt(%d) = %v, want ErrIndexOutOfBounds", offset, err)
+		}
+	}
+	if _, err := NodeAt(root.Query("/meta"), 0); err == nil {
+		t.Error("NodeAt accepted a node that is not a root")
+	}
+}
+
+func TestRefresh(t *testing.T) {
+	src := []byte(refreshDoc)
+	root, err := ParseWithOptions(src, ParseOptions{TrackPositions: true})
+	if err != nil {
+		t.Fatalf("Parse failed: %v", err)
+	}
+	name := root.Query("/name")
+	tags := root.Query("/deps[0]/tags")
+	meta := root.Query("/meta")
+
+	// Typing after the last element of tags reparses the array.
+	start := bytes.Index(src, []byte(`"b"`)) + 3
+	got, err := Refresh(root, start, start, []byte(`, {"c": 3}`))
+	if err != nil {
+		t.Fatalf("Refresh failed: %v", err)
+	}
+	if got != root {
+		t.Fatal("Refresh replaced the root for an edit inside it")
+	}
+	first := root.Query("/deps[0]/tags[0]")
+	// Typing inside a string reparses only the string.
+	if _, err := Refresh(root, start-2, start-1, []byte(`bee`)); err != nil {
+		t.Fatalf("Refresh failed: %v", err)
+	}
+	if root.Query("/deps[0]/tags[0]") != first || root.Query("/deps[0]/tags[1]").String() != "bee" {
+		t.Error("Refresh of a string reparsed more than the string")
+	}
+	want := bytes.Replace(src, []byte(`"b"`), []byte(`"bee", {"c": 3}`), 1)
+	if raw := root.Raw(); raw != string(want) {
+		t.Fatalf("Raw = %s", raw)
+	}
+
+	if root.Query("/name") != name || root.Query("/meta") != meta {
+		t.Error("Refresh replaced nodes outside the edited value")
+	}
+	if meta.(*objectNode).parsed.Load() {
+		t.Error("Refresh parsed the members of an untouched object")
+	}
+	if !errors.Is(tags.Error(), core.ErrStaleResult) {
+		t.Errorf("the replaced array is not stale: %v", tags.Error())
+	}
+	if got := root.Query("/deps[0]/tags[2]/c").Int(); got != 3 {
+		t.Errorf("/deps[0]/tags[2]/c = %d, want 3", got)
+	}
+	if got := root.Query("/meta/v").Int(); got != 10 {
+		t.Errorf("/meta/v = %d, want 10", got)
+	}
+
+	// Positions after the edit follow the new text.
+	pos, ok := root.Query("/meta/v").Position()
+	if wantOff := bytes.Index(want, []byte(`10`)); !ok || pos.Offset != wantOff || pos.Line != 4 {
+		t.Errorf("Position of /meta/v = %+v, %v, want offset %d on line 4", pos, ok, wantOff)
+	}
+	pos, _ = root.Query("/deps[0]/tags[2]").Position()
+	if wantOff := bytes.Index(want, []byte(`{"c"`)); pos.Offset != wantOff {
+		t.Errorf("Position of the new element = %+v, want offset %d", pos, wantOff)
+	}
+	if node, err := NodeAt(root, bytes.Index(want, []byte(`true`))); err != nil || node.Path() != "/meta/on" {
+		t.Errorf("NodeAt after Refresh = %v, %v", node, err)
+	}
+
+	out, err := root.Bytes()
+	if err != nil || !bytes.Equal(out, want) {
+		t.Errorf("Bytes = %s, %v", out, err)
+	}
+}
+
+func TestRefreshRejectsEdits(t *testing.T) {
+	src := []byte(refreshDoc)
+	root, err := Parse(src)
+	if err != nil {
+		t.Fatalf("Parse failed: %v", err)
+	}
+	name := root.Query("/name")
+
+	// From inside "app" to inside the deps array.
+	start := bytes.Index(src, []byte(`app`))
+	end := bytes.Index(src, []byte(`{"id": 2`))
+	_, err = Refresh(root, start, end, []byte(`x`))
+	var pathErr *core.PathError
+	if !errors.Is(err, core.ErrSpanningEdit) || !errors.As(err, &pathErr) || pathErr.Path != "/name" {
+		t.Errorf("spanning Refresh = %v, want ErrSpanningEdit at /name", err)
+	}
+
+	// Invalid new text is reported where it is in the edited source.
+	start = bytes.Index(src, []byte(`10`))
+	_, err = Refresh(root, start, start+2, []byte(`1 0`))
+	var syntaxErr *core.SyntaxError
+	if !errors.As(err, &syntaxErr) || syntaxErr.Line != 4 || syntaxErr.Offset != start+2 {
+		t.Errorf("invalid Refresh = %v, want a syntax error on line 4 at offset %d", err, start+2)
+	}
+
+	if _, err := Refresh(root, 5, 3, nil); !errors.Is(err, core.ErrIndexOutOfBounds) {
+		t.Errorf("reversed Refresh = %v, want ErrIndexOutOfBounds", err)
+	}
+	if root.Raw() != refreshDoc || root.Query("/name") != name || name.Error() != nil {
+		t.Error("a failed Refresh changed the document")
+	}
+
+	root.Query("/meta").Set("v", 11)
+	if _, err := Refresh(root, 1, 1, []byte(" ")); err == nil {
+		t.Error("Refresh accepted a document that was written to")
+	}
+}
+
+func TestRefreshRoot(t *testing.T) {
+	root, err := Parse([]byte(`{"a": 1}`))
+	if err != nil {
+		t.Fatalf("Parse failed: %v", err)
+	}
+	a := root.Query("/a")
+	// Covering the key reparses the root object itself.
+	got, err := Refresh(root, 1, 4, []byte(`"b"`))
+	if err != nil {
+		t.Fatalf("Refresh failed: %v", err)
+	}
+	if got == root || got.Query("/b").Int() != 1 || got.Query("/a").IsValid() {
+		t.Errorf("Refresh = %s", got.Raw())
+	}
+	if !errors.Is(a.Error(), core.ErrStaleResult) || !errors.Is(root.Error(), core.ErrStaleResult) {
+		t.Error("the replaced root left live handles")
+	}
+
+	scalar, _ := Parse([]byte(`12`))
+	if got, err := Refresh(scalar, 1, 2, []byte(`34`)); err != nil || got.Int() != 134 {
+		t.Errorf("Refresh of a scalar root = %v, %v", got, err)
+	}
+}
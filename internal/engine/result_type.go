@@ -0,0 +1,20 @@
+package engine
+
+import "github.com/474420502/xjson/internal/core"
+
+// ResultType returns the Type of the node, or core.MultiMatch for a
+// wildcard, recursive, filter or slice result.
+func (n *baseNode) ResultType() core.NodeType {
+	self := n.selfOrMe()
+	if _, ok := matchList(self); ok {
+		return core.MultiMatch
+	}
+	return self.Type()
+}
+
+func (n *baseNode) IsString() bool { return n.ResultType() == core.String }
+func (n *baseNode) IsNumber() bool { return n.ResultType() == core.Number }
+func (n *baseNode) IsBool() bool   { return n.ResultType() == core.Bool }
+func (n *baseNode) IsNull() bool   { return n.ResultType() == core.Null }
+func (n *baseNode) IsObject() bool { return n.ResultType() == core.Object }
+func (n *baseNode) IsArray() bool  { return n.ResultType() == core.Array }
@@ -0,0 +1,67 @@
+package engine
+
+import (
+	"testing"
+
+	"github.com/474420502/xjson/internal/core"
+)
+
+func TestResultType(t *testing.T) {
+	root, err := Parse([]byte(`{"s":"x","n":1.5,"b":true,"z":null,"o":{"k":"v"},"a":[1,2,3],"e":[]}`))
+	if err != nil {
+		t.Fatalf("Parse failed: %v", err)
+	}
+	tests := []struct {
+		name string
+		node core.Node
+		want core.NodeType
+	}{
+		{"root", root, core.Object},
+		{"string", root.Query("/s"), core.String},
+		{"number", root.Query("/n"), core.Number},
+		{"bool", root.Query("/b"), core.Bool},
+		{"null", root.Query("/z"), core.Null},
+		{"object", root.Query("/o"), core.Object},
+		{"array", root.Query("/a"), core.Array},
+		{"empty array", root.Query("/e"), core.Array},
+		{"nested key", root.Get("o").Get("k"), core.String},
+		{"index", root.Query("/a[0]"), core.Number},
+		{"missing key", root.Query("/missing"), core.Invalid},
+		{"index out of bounds", root.Query("/a[9]"), core.Invalid},
+		{"key of a string", root.Query("/s/k"), core.Invalid},
+		{"wildcard", root.Query("/a[*]"), core.MultiMatch},
+		{"wildcard of one", root.Query("/o/*"), core.MultiMatch},
+		{"filter", root.Query("/a[?(@ > 1)]"), core.MultiMatch},
+		{"empty filter", root.Query("/a[?(@ > 9)]"), core.MultiMatch},
+		{"recursive", root.Query("//k"), core.MultiMatch},
+		{"slice", root.Query("/a[0:2]"), core.MultiMatch},
+		{"first match", root.QueryFirst("/a[*]"), core.Number},
+		{"first of nothing", root.QueryFirst("/a[?(@ > 9)]"), core.Invalid},
+		{"invalid path", root.Query("/a[?(@ >"), core.Invalid},
+		{"constructed", NewNodeFromInterface(nil, []interface{}{1}, nil), core.Array},
+	}
+	for _, tt := range tests {
+		if got := tt.node.ResultType(); got != tt.want {
+			t.Errorf("%s: ResultType() = %v, want %v", tt.name, got, tt.want)
+		}
+		is := map[core.NodeType]bool{
+			core.String: tt.node.IsString(),
+			core.Number: tt.node.IsNumber(),
+			core.Bool:   tt.node.IsBool(),
+			core.Null:   tt.node.IsNull(),
+			core.Object: tt.node.IsObject(),
+			core.Array:  tt.node.IsArray(),
+		}
+		for typ, ok := range is {
+			if ok != (typ == tt.want) {
+				t.Errorf("%s: the predicate for %v = %v", tt.name, typ, ok)
+			}
+		}
+	}
+	if got := core.MultiMatch.String(); got != "multimatch" {
+		t.Errorf("MultiMatch.String() = %q", got)
+	}
+	if got := root.Query("/a[*]").Type(); got != core.Array {
+		t.Errorf("Type() of a match set = %v, want array as before", got)
+	}
+}
@@ -0,0 +1,96 @@
+package engine
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/474420502/xjson/internal/core"
+)
+
+var scalarRoots = []struct {
+	src  string
+	typ  core.NodeType
+	want string
+}{
+	{`"str"`, core.String, `"str"`},
+	{`"a\"b\\cé"`, core.String, `"a\"b\\cé"`},
+	{`123.50`, core.Number, `123.50`},
+	{` 1e3 `, core.Number, `1e3`},
+	{`-0`, core.Number, `-0`},
+	{`true`, core.Bool, `true`},
+	{`null`, core.Null, `null`},
+}
+
+func TestScalarRootParses(t *testing.T) {
+	for name, parse := range testParsers {
+		for _, tc := range scalarRoots {
+			root, err := parse([]byte(tc.src))
+			if err != nil {
+				t.Fatalf("%s parse %q failed: %v", name, tc.src, err)
+			}
+			if root.Type() != tc.typ {
+				t.Fatalf("%s parse %q type = %v, want %v", name, tc.src, root.Type(), tc.typ)
+			}
+			b, err := root.Bytes()
+			if err != nil || string(b) != tc.want {
+				t.Fatalf("%s Bytes of %q = %q, %v; want %q", name, tc.src, b, err, tc.want)
+			}
+			if tc.typ == core.Number && (root.String() != tc.want || root.Raw() != tc.want) {
+				t.Fatalf("%s number %q String/Raw = %q/%q, want %q", name, tc.src, root.String(), root.Raw(), tc.want)
+			}
+		}
+	}
+}
+
+func TestScalarRootQuery(t *testing.T) {
+	for _, tc := range scalarRoots {
+		root, _ := Parse([]byte(tc.src))
+		for _, path := range []string{"", "/"} {
+			if got := root.Query(path); got != root {
+				t.Fatalf("Query(%q) on %s = %v, want the root itself", path, tc.src, got)
+			}
+		}
+		if !root.Has("") {
+			t.Fatalf("Has(\"\") on %s = false", tc.src)
+		}
+		for _, path := range []string{"/a", "/a/b", "['a']", "[0]", "[-1]", "[0:1]"} {
+			got := root.Query(path)
+			if got.IsValid() || !errors.Is(got.Error(), core.ErrTypeAssertion) {
+				t.Fatalf("Query(%q) on %s = %v (err %v), want ErrTypeAssertion", path, tc.src, got, got.Error())
+			}
+			if root.Has(path) {
+				t.Fatalf("Has(%q) on %s = true", path, tc.src)
+			}
+		}
+		for name, got := range map[string]core.Node{"Get": root.Get("a"), "Index": root.Index(0)} {
+			if got.IsValid() || !errors.Is(got.Error(), core.ErrTypeAssertion) {
+				t.Fatalf("%s on %s = %v (err %v), want ErrTypeAssertion", name, tc.src, got, got.Error())
+			}
+		}
+	}
+}
+
+func TestScalarRootCompiledQuery(t *testing.T) {
+	root, _ := Parse([]byte(`42`))
+	for _, path := range []string{"/a", "/a[0]", "[0]"} {
+		cq, err := CompileQuery(path)
+		if err != nil {
+			t.Fatalf("CompileQuery(%q) failed: %v", path, err)
+		}
+		if got := cq.Query(root); got.IsValid() || !errors.Is(got.Error(), core.ErrTypeAssertion) {
+			t.Fatalf("compiled %q on a number = %v (err %v), want ErrTypeAssertion", path, got, got.Error())
+		}
+	}
+}
+
+func TestCompiledQueryFallsBackOnDirtyObjects(t *testing.T) {
+	root, _ := Parse([]byte(`{"a":{"b":1}}`))
+	root.Set("c", 2)
+	cq, err := CompileQuery("/a/b")
+	if err != nil {
+		t.Fatalf("CompileQuery failed: %v", err)
+	}
+	if got := cq.Query(root); got == nil || got.Int() != 1 {
+		t.Fatalf("compiled query on a modified document = %v, want 1", got)
+	}
+}
@@ -0,0 +1,346 @@
+package engine
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+)
+
+// ScanAction tells Scan how to go on after a Visitor callback.
+type ScanAction int
+
+const (
+	// ScanContinue goes on with the next token.
+	ScanContinue ScanAction = iota
+	// ScanSkip, returned by OnObjectStart or OnArrayStart, jumps over the
+	// container without calling its End callback; returned by OnKey it
+	// jumps over the value of the key. Elsewhere it acts as ScanContinue.
+	ScanSkip
+	// ScanStop ends the scan; Scan returns nil.
+	ScanStop
+)
+
+// Visitor receives the tokens of a document from Scan. depth is 0 for the
+// root value and one more for the keys and values of each container than
+// for the container itself; the End callback of a container has the depth
+// of its Start. Keys and strings are passed unescaped, in memory that is
+// only valid until the callback returns. Numbers are passed as written.
+type Visitor interface {
+	OnObjectStart(depth int) ScanAction
+	OnObjectEnd(depth int) ScanAction
+	OnArrayStart(depth int) ScanAction
+	OnArrayEnd(depth int) ScanAction
+	OnKey(depth int, key []byte) ScanAction
+	OnString(depth int, value []byte) ScanAction
+	OnNumber(depth int, value []byte) ScanAction
+	OnBool(depth int, value bool) ScanAction
+	OnNull(depth int) ScanAction
+}
+
+// NopVisitor implements every Visitor callback by returning ScanContinue.
+// Embed it to implement only the callbacks of interest.
+type NopVisitor struct{}
+
+func (NopVisitor) OnObjectStart(int) ScanAction    { return ScanContinue }
+func (NopVisitor) OnObjectEnd(int) ScanAction      { return ScanContinue }
+func (NopVisitor) OnArrayStart(int) ScanAction     { return ScanContinue }
+func (NopVisitor) OnArrayEnd(int) ScanAction       { return ScanContinue }
+func (NopVisitor) OnKey(int, []byte) ScanAction    { return ScanContinue }
+func (NopVisitor) OnString(int, []byte) ScanAction { return ScanContinue }
+func (NopVisitor) OnNumber(int, []byte) ScanAction { return ScanContinue }
+func (NopVisitor) OnBool(int, bool) ScanAction     { return ScanContinue }
+func (NopVisitor) OnNull(int) ScanAction           { return ScanContinue }
+
+// Scan reads the JSON document in data and reports its tokens to v in
+// document order without building nodes. It accepts and rejects documents
+// like MustParse does, with the same *core.SyntaxError at the same
+// position, except that a skipped value is only checked for balanced
+// brackets and quotes.
+func Scan(data []byte, v Visitor) error {
+	s := scanner{data: data, v: v}
+	return s.run()
+}
+
+// errScanStop unwinds a scan that a callback stopped.
+var errScanStop = errors.New("scan stopped")
+
+// scanner holds the state of one Scan. While the Start callback of a
+// container or the callback of a scalar runs, start is the offset of the
+// value; pos is past the value during the callback of a scalar and the End
+// callback of a container.
+type scanner struct {
+	data  []byte
+	pos   int
+	start int
+	v     Visitor
+	buf   []byte // reused for unescaped keys and strings
+	check bool   // only check escapes, for ValidateBytes; strings are passed raw
+}
+
+func (s *scanner) run() error {
+	s.skipWhitespace()
+	if s.pos >= len(s.data) {
+		return fmt.Errorf("empty json")
+	}
+	if err := s.value(0); err != nil {
+		if err == errScanStop {
+			return nil
+		}
+		return err
+	}
+	s.skipWhitespace()
+	if s.pos < len(s.data) {
+		return s.syntaxError("invalid character '%c' after top-level value", s.data[s.pos])
+	}
+	return nil
+}
+
+func (s *scanner) syntaxError(format string, args ...interface{}) error {
+	return newSyntaxError(s.data, s.pos, fmt.Sprintf(format, args...))
+}
+
+// act turns the action of a callback into the error that unwinds the scan.
+func act(a ScanAction) error {
+	if a == ScanStop {
+		return errScanStop
+	}
+	return nil
+}
+
+// value scans the value at s.pos, which is not whitespace.
+func (s *scanner) value(depth int) error {
+	s.start = s.pos
+	switch c := s.data[s.pos]; c {
+	case '{':
+		return s.object(depth)
+	case '[':
+		return s.array(depth)
+	case '"':
+		str, err := s.string()
+		if err != nil {
+			return err
+		}
+		return act(s.v.OnString(depth, str))
+	case 't', 'f':
+		if bytes.HasPrefix(s.data[s.pos:], []byte("true")) {
+			if err := s.literal("true"); err != nil {
+				return err
+			}
+			return act(s.v.OnBool(depth, true))
+		}
+		if bytes.HasPrefix(s.data[s.pos:], []byte("false")) {
+			if err := s.literal("false"); err != nil {
+				return err
+			}
+			return act(s.v.OnBool(depth, false))
+		}
+		return s.syntaxError("invalid boolean")
+	case 'n':
+		if bytes.HasPrefix(s.data[s.pos:], []byte("null")) {
+			if err := s.literal("null"); err != nil {
+				return err
+			}
+			return act(s.v.OnNull(depth))
+		}
+		return s.syntaxError("invalid null")
+	case '-', '0', '1', '2', '3', '4', '5', '6', '7', '8', '9':
+		end, ok := numberEnd(s.data, s.pos)
+		s.pos = end
+		if end >= len(s.data) && !ok {
+			return s.syntaxError("unexpected end of number")
+		}
+		if !ok || !endsValue(s.data, end) {
+			return s.syntaxError("invalid character '%c' in numeric literal", s.data[end])
+		}
+		return act(s.v.OnNumber(depth, s.data[s.start:s.pos]))
+	default:
+		return s.syntaxError("invalid character '%c' looking for beginning of value", c)
+	}
+}
+
+// literal moves past the literal lit at s.pos, checking that it ends there.
+func (s *scanner) literal(lit string) error {
+	s.pos += len(lit)
+	if !endsValue(s.data, s.pos) {
+		return s.syntaxError("invalid character '%c' in literal %s", s.data[s.pos], lit)
+	}
+	return nil
+}
+
+// nextValue scans the value after optional whitespace, or skips it.
+func (s *scanner) nextValue(depth int, skip bool) error {
+	s.skipWhitespace()
+	if s.pos >= len(s.data) {
+		return s.syntaxError("unexpected end of json")
+	}
+	if skip {
+		return s.skipValue()
+	}
+	return s.value(depth)
+}
+
+// skipValue jumps over the value at s.pos with the segment scanner Parse
+// uses for lazy nodes.
+func (s *scanner) skipValue() error {
+	end := 0
+	switch s.data[s.pos] {
+	case '{':
+		if end = findContainerEnd(s.data, s.pos); end < 0 {
+			return s.syntaxError("unterminated object")
+		}
+	case '[':
+		if end = findContainerEnd(s.data, s.pos); end < 0 {
+			return s.syntaxError("unterminated array")
+		}
+	case '"':
+		if end = findMatchingQuote(s.data, s.pos); end < 0 {
+			s.pos++
+			return s.syntaxError("unterminated string")
+		}
+	default:
+		end = findValueEnd(s.data, s.pos)
+	}
+	s.pos = end + 1
+	return nil
+}
+
+func (s *scanner) object(depth int) error {
+	switch s.v.OnObjectStart(depth) {
+	case ScanStop:
+		return errScanStop
+	case ScanSkip:
+		return s.skipValue()
+	}
+	s.pos++ // skip '{'
+	s.skipWhitespace()
+	for s.pos < len(s.data) {
+		if s.data[s.pos] == '}' {
+			s.pos++
+			return act(s.v.OnObjectEnd(depth))
+		}
+		if s.data[s.pos] != '"' {
+			return s.syntaxError("object key must be a string")
+		}
+		key, err := s.string()
+		if err != nil {
+			return err
+		}
+		a := s.v.OnKey(depth+1, key)
+		if a == ScanStop {
+			return errScanStop
+		}
+
+		s.skipWhitespace()
+		if s.pos >= len(s.data) || s.data[s.pos] != ':' {
+			return s.syntaxError("missing ':' after object key")
+		}
+		s.pos++ // skip ':'
+		if err := s.nextValue(depth+1, a == ScanSkip); err != nil {
+			return err
+		}
+
+		s.skipWhitespace()
+		if s.pos >= len(s.data) {
+			break
+		}
+		if s.data[s.pos] == '}' {
+			s.pos++
+			return act(s.v.OnObjectEnd(depth))
+		}
+		if s.data[s.pos] != ',' {
+			return s.syntaxError("missing ',' after object value")
+		}
+		s.pos++ // skip ','
+		s.skipWhitespace()
+		if s.pos < len(s.data) && s.data[s.pos] == '}' {
+			return s.syntaxError("trailing comma in object")
+		}
+	}
+	return s.syntaxError("unterminated object")
+}
+
+func (s *scanner) array(depth int) error {
+	switch s.v.OnArrayStart(depth) {
+	case ScanStop:
+		return errScanStop
+	case ScanSkip:
+		return s.skipValue()
+	}
+	s.pos++ // skip '['
+	s.skipWhitespace()
+	for s.pos < len(s.data) {
+		if s.data[s.pos] == ']' {
+			s.pos++
+			return act(s.v.OnArrayEnd(depth))
+		}
+		if err := s.nextValue(depth+1, false); err != nil {
+			return err
+		}
+
+		s.skipWhitespace()
+		if s.pos >= len(s.data) {
+			return s.syntaxError("unterminated array")
+		}
+		if s.data[s.pos] == ']' {
+			s.pos++
+			return act(s.v.OnArrayEnd(depth))
+		}
+		if s.data[s.pos] != ',' {
+			return s.syntaxError("missing ',' after array value")
+		}
+		s.pos++ // skip ','
+		s.skipWhitespace()
+		if s.pos < len(s.data) && s.data[s.pos] == ']' {
+			return s.syntaxError("trailing comma in array")
+		}
+	}
+	return s.syntaxError("unterminated array")
+}
+
+// string reads the string at s.pos and returns its unescaped body, which
+// may live in s.buf.
+func (s *scanner) string() ([]byte, error) {
+	start := s.pos
+	s.pos++ // skip '"'
+	end := findMatchingQuote(s.data, start)
+	if end < 0 {
+		return nil, s.syntaxError("unterminated string")
+	}
+	escaped := false
+	for i := start + 1; i < end; i++ {
+		if s.data[i] == '\\' {
+			escaped = true
+			i++ // an escaped byte is reported as a bad escape, like MustParse does
+			continue
+		}
+		if s.data[i] < 0x20 {
+			s.pos = i
+			return nil, s.syntaxError("invalid control character %q in string literal", s.data[i])
+		}
+	}
+	s.pos = end + 1
+	body := s.data[start+1 : end]
+	if !escaped {
+		return body, nil
+	}
+	if s.check {
+		if err := checkEscapes(body); err != nil {
+			return nil, newSyntaxError(s.data, start, err.Error())
+		}
+		return body, nil
+	}
+	out, err := appendUnescaped(s.buf[:0], body)
+	if err != nil {
+		return nil, newSyntaxError(s.data, start, err.Error())
+	}
+	s.buf = out
+	return out, nil
+}
+
+func (s *scanner) skipWhitespace() {
+	data, pos := s.data, s.pos
+	for pos < len(data) && (data[pos] == ' ' || data[pos] == '\n' || data[pos] == '\r' || data[pos] == '\t') {
+		pos++
+	}
+	s.pos = pos
+}
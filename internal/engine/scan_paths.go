@@ -0,0 +1,292 @@
+package engine
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// ScanPaths scans data with Scan and calls fn with each value found at one
+// of paths, in document order, passing the path as given and the JSON text
+// of the value, which is a slice of data. Paths are keys separated by dots,
+// each followed by any number of [N] indices or [*] for every element:
+// "a.b", "items[*].id", "[0].name". A key of * matches every key, and \
+// escapes the next character of a key. A key that is a number, as in
+// "items.0.id", names a member of an object and an element of an array. Values that no path leads to or
+// into are skipped without being looked at more closely than balanced
+// brackets and quotes require.
+func ScanPaths(data []byte, paths []string, fn func(path string, raw []byte)) error {
+	m := pathMatcherPool.Get().(*pathMatcher)
+	defer m.release()
+	for _, path := range paths {
+		if err := m.compile(path); err != nil {
+			return err
+		}
+	}
+	m.paths = paths
+	m.fn = fn
+	m.s = scanner{data: data, v: m, buf: m.s.buf[:0]}
+	return m.s.run()
+}
+
+// pathMatcherPool keeps the buffers of finished ScanPaths calls, so that a
+// steady stream of documents scans without allocating.
+var pathMatcherPool = sync.Pool{New: func() interface{} { return new(pathMatcher) }}
+
+type scanStepKind uint8
+
+const (
+	scanKey scanStepKind = iota
+	scanAnyKey
+	scanIndex
+	scanAnyIndex
+)
+
+// scanStep is one key or index of a ScanPaths path. The index of a key
+// step is the number the key spells, or -1.
+type scanStep struct {
+	kind  scanStepKind
+	key   string
+	index int
+}
+
+// scanFrame is an open container of the document. The key of the value
+// it is at is keys[keyStart:keyEnd] of its pathMatcher for an object, the
+// index is index for an array. exact is set when a path leads to the
+// container itself, whose text starts at start.
+type scanFrame struct {
+	object           bool
+	exact            bool
+	start            int
+	keyStart, keyEnd int
+	index            int
+}
+
+// pathMatcher is the Visitor of ScanPaths.
+type pathMatcher struct {
+	s      scanner
+	fn     func(path string, raw []byte)
+	paths  []string
+	steps  []scanStep
+	ends   []int // the steps of paths[i] end at ends[i]
+	frames []scanFrame
+	keys   []byte
+}
+
+func (m *pathMatcher) release() {
+	clear(m.steps)
+	*m = pathMatcher{
+		s:      scanner{buf: m.s.buf[:0]},
+		steps:  m.steps[:0],
+		ends:   m.ends[:0],
+		frames: m.frames[:0],
+		keys:   m.keys[:0],
+	}
+	pathMatcherPool.Put(m)
+}
+
+// compile appends the steps of path.
+func (m *pathMatcher) compile(path string) error {
+	if path == "" {
+		return fmt.Errorf("invalid scan path %q: empty path", path)
+	}
+	for i := 0; ; {
+		if path[i] != '[' || i > 0 {
+			key, next, err := scanPathKey(path, i)
+			if err != nil {
+				return fmt.Errorf("invalid scan path %q: %w", path, err)
+			}
+			step := scanStep{kind: scanKey, key: key, index: -1}
+			if path[i:next] == "*" {
+				step.kind = scanAnyKey
+			} else if key[0] != '0' || len(key) == 1 {
+				if n, err := strconv.Atoi(key); err == nil && key[0] != '+' && key[0] != '-' {
+					step.index = n
+				}
+			}
+			m.steps = append(m.steps, step)
+			i = next
+		}
+		for i < len(path) && path[i] == '[' {
+			end := strings.IndexByte(path[i:], ']')
+			if end < 0 {
+				return fmt.Errorf("invalid scan path %q: unterminated index", path)
+			}
+			step := scanStep{kind: scanAnyIndex}
+			if index := path[i+1 : i+end]; index != "*" {
+				n, err := strconv.Atoi(index)
+				if err != nil || n < 0 {
+					return fmt.Errorf("invalid scan path %q: invalid index %q", path, index)
+				}
+				step = scanStep{kind: scanIndex, index: n}
+			}
+			m.steps = append(m.steps, step)
+			i += end + 1
+		}
+		if i == len(path) {
+			m.ends = append(m.ends, len(m.steps))
+			return nil
+		}
+		if path[i] != '.' {
+			return fmt.Errorf("invalid scan path %q: unexpected %q after index", path, path[i])
+		}
+		if i++; i == len(path) {
+			return fmt.Errorf("invalid scan path %q: path ends with a dot", path)
+		}
+	}
+}
+
+// scanPathKey reads the key starting at path[i] and returns it with the
+// index of the '.' or '[' that ends it, or len(path).
+func scanPathKey(path string, i int) (string, int, error) {
+	j := i
+	for ; j < len(path) && path[j] != '.' && path[j] != '['; j++ {
+		if path[j] == '\\' {
+			j++
+		}
+	}
+	if j > len(path) {
+		return "", 0, fmt.Errorf("path ends with an escape")
+	}
+	if j == i {
+		return "", 0, fmt.Errorf("empty key at offset %d", i)
+	}
+	key := path[i:j]
+	if strings.IndexByte(key, '\\') >= 0 {
+		var b strings.Builder
+		for k := 0; k < len(key); k++ {
+			if key[k] == '\\' {
+				k++
+			}
+			b.WriteByte(key[k])
+		}
+		key = b.String()
+	}
+	return key, j, nil
+}
+
+// lookup reports whether a path leads to the value the open containers are
+// at, and whether one leads below it.
+func (m *pathMatcher) lookup() (exact, deeper bool) {
+	depth := len(m.frames)
+	start := 0
+	for _, end := range m.ends {
+		steps := m.steps[start:end]
+		start = end
+		if len(steps) < depth || !m.leadsHere(steps) {
+			continue
+		}
+		if len(steps) == depth {
+			exact = true
+		} else {
+			deeper = true
+		}
+	}
+	return exact, deeper
+}
+
+// leadsHere reports whether the first steps of a path match the keys and
+// indices the open containers are at.
+func (m *pathMatcher) leadsHere(steps []scanStep) bool {
+	for d, f := range m.frames {
+		switch step := steps[d]; step.kind {
+		case scanKey:
+			if !f.object {
+				if step.index < 0 || f.index != step.index {
+					return false
+				}
+			} else if string(m.keys[f.keyStart:f.keyEnd]) != step.key {
+				return false
+			}
+		case scanAnyKey:
+			if !f.object {
+				return false
+			}
+		case scanIndex:
+			if f.object || f.index != step.index {
+				return false
+			}
+		case scanAnyIndex:
+			if f.object {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// emit calls fn for each path that leads to the value the open containers
+// are at.
+func (m *pathMatcher) emit(raw []byte) {
+	depth := len(m.frames)
+	start := 0
+	for i, end := range m.ends {
+		steps := m.steps[start:end]
+		start = end
+		if len(steps) == depth && m.leadsHere(steps) {
+			m.fn(m.paths[i], raw)
+		}
+	}
+}
+
+// enter moves an array to the element that starts.
+func (m *pathMatcher) enter() {
+	if n := len(m.frames); n > 0 && !m.frames[n-1].object {
+		m.frames[n-1].index++
+	}
+}
+
+func (m *pathMatcher) open(object bool) ScanAction {
+	m.enter()
+	exact, deeper := m.lookup()
+	if !exact && !deeper {
+		return ScanSkip
+	}
+	m.frames = append(m.frames, scanFrame{
+		object:   object,
+		exact:    exact,
+		start:    m.s.start,
+		keyStart: len(m.keys),
+		keyEnd:   len(m.keys),
+		index:    -1,
+	})
+	return ScanContinue
+}
+
+func (m *pathMatcher) close() ScanAction {
+	f := m.frames[len(m.frames)-1]
+	m.frames = m.frames[:len(m.frames)-1]
+	m.keys = m.keys[:f.keyStart]
+	if f.exact {
+		m.emit(m.s.data[f.start:m.s.pos])
+	}
+	return ScanContinue
+}
+
+func (m *pathMatcher) scalar() ScanAction {
+	m.enter()
+	m.emit(m.s.data[m.s.start:m.s.pos])
+	return ScanContinue
+}
+
+func (m *pathMatcher) OnObjectStart(int) ScanAction { return m.open(true) }
+func (m *pathMatcher) OnObjectEnd(int) ScanAction   { return m.close() }
+func (m *pathMatcher) OnArrayStart(int) ScanAction  { return m.open(false) }
+func (m *pathMatcher) OnArrayEnd(int) ScanAction    { return m.close() }
+
+// OnKey skips the value of a key no path leads to or into.
+func (m *pathMatcher) OnKey(_ int, key []byte) ScanAction {
+	top := &m.frames[len(m.frames)-1]
+	m.keys = append(m.keys[:top.keyStart], key...)
+	top.keyEnd = len(m.keys)
+	if exact, deeper := m.lookup(); !exact && !deeper {
+		return ScanSkip
+	}
+	return ScanContinue
+}
+
+func (m *pathMatcher) OnString(int, []byte) ScanAction { return m.scalar() }
+func (m *pathMatcher) OnNumber(int, []byte) ScanAction { return m.scalar() }
+func (m *pathMatcher) OnBool(int, bool) ScanAction     { return m.scalar() }
+func (m *pathMatcher) OnNull(int) ScanAction           { return m.scalar() }
@@ -0,0 +1,111 @@
+package engine
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestScanPaths(t *testing.T) {
+	doc := []byte(`{
+		"a": {"b": "x\"y", "c": 1},
+		"items": [{"id": 1, "tags": ["p"]}, {"name": "no id"}, {"id": [2, 3]}],
+		"a.b": true,
+		"m": [[1, 2], [3, 4]],
+		"skip": {"id": 9, "deep": [{"id": 10}]}
+	}`)
+	cases := []struct {
+		paths []string
+		want  []string
+	}{
+		{[]string{"a.b"}, []string{`a.b="x\"y"`}},
+		{[]string{"items[*].id"}, []string{`items[*].id=1`, `items[*].id=[2, 3]`}},
+		{[]string{"items[2].id[1]"}, []string{`items[2].id[1]=3`}},
+		{[]string{"a", "a.c"}, []string{`a.c=1`, `a={"b": "x\"y", "c": 1}`}},
+		{[]string{"a\\.b"}, []string{`a\.b=true`}},
+		{[]string{"*.id"}, []string{`*.id=9`}},
+		{[]string{"m[*][0]", "m[1]"}, []string{`m[*][0]=1`, `m[*][0]=3`, `m[1]=[3, 4]`}},
+		{[]string{"items[*].tags", "a.c"}, []string{`a.c=1`, `items[*].tags=["p"]`}},
+		{[]string{"missing", "a.b.c", "items[7]"}, nil},
+	}
+	for _, tc := range cases {
+		var got []string
+		err := ScanPaths(doc, tc.paths, func(path string, raw []byte) {
+			got = append(got, path+"="+string(raw))
+		})
+		if err != nil {
+			t.Errorf("ScanPaths(%q) failed: %v", tc.paths, err)
+			continue
+		}
+		if !reflect.DeepEqual(got, tc.want) {
+			t.Errorf("ScanPaths(%q) = %q, want %q", tc.paths, got, tc.want)
+		}
+	}
+
+	var got []string
+	if err := ScanPaths([]byte(`[{"id":"a"},{"id":"b"}]`), []string{"[*].id", "[1]"}, func(path string, raw []byte) {
+		got = append(got, path+"="+string(raw))
+	}); err != nil || !reflect.DeepEqual(got, []string{`[*].id="a"`, `[*].id="b"`, `[1]={"id":"b"}`}) {
+		t.Errorf("root array paths = %q, %v", got, err)
+	}
+}
+
+func TestScanPathsErrors(t *testing.T) {
+	for _, path := range []string{"", "a.", "a..b", "a[", "a[x]", "a[-1]", "a[0]b", "a\\"} {
+		err := ScanPaths([]byte(`{}`), []string{"ok", path}, func(string, []byte) {})
+		if err == nil || !strings.Contains(err.Error(), "invalid scan path") {
+			t.Errorf("path %q: error %v, want an invalid scan path error", path, err)
+		}
+	}
+
+	err := ScanPaths([]byte(`{"a": [1 2]}`), []string{"a"}, func(string, []byte) {})
+	if err == nil || !strings.Contains(err.Error(), "missing ','") {
+		t.Errorf("malformed document: error %v", err)
+	}
+}
+
+func TestScanPathsAllocations(t *testing.T) {
+	item := `{"id": 1, "name": "ann", "blob": {"x": [1, 2, 3]}},`
+	paths := []string{"items[*].id", "items[*].name"}
+	allocs := func(items int) float64 {
+		doc := []byte(`{"items": [` + strings.Repeat(item, items) + `{}]}`)
+		return testing.AllocsPerRun(50, func() {
+			_ = ScanPaths(doc, paths, func(string, []byte) {})
+		})
+	}
+	small, large := allocs(2), allocs(500)
+	if large > small+1 {
+		t.Errorf("ScanPaths made %.1f allocations for 500 items, %.1f for 2", large, small)
+	}
+}
+
+func BenchmarkScanPaths(b *testing.B) {
+	item := `{"id":1,"name":"item","tags":["a","b","c"],"price":9.5,"ok":true,"meta":{"x":null}},`
+	paths := []string{"items[*].id", "items[*].price", "count"}
+	for _, n := range []int{10, 1000} {
+		doc := []byte(`{"count":` + fmt.Sprint(n) + `,"items":[` + strings.Repeat(item, n) + `{}]}`)
+		b.Run(fmt.Sprintf("items=%d", n), func(b *testing.B) {
+			b.SetBytes(int64(len(doc)))
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				if err := ScanPaths(doc, paths, func(string, []byte) {}); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+		b.Run(fmt.Sprintf("parse/items=%d", n), func(b *testing.B) {
+			b.SetBytes(int64(len(doc)))
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				root, err := Parse(doc)
+				if err != nil {
+					b.Fatal(err)
+				}
+				root.Query("/items[*]/id").Array()
+				root.Query("/items[*]/price").Array()
+				root.Get("count").Int()
+			}
+		})
+	}
+}
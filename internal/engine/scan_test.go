@@ -0,0 +1,154 @@
+package engine
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// traceVisitor records the callbacks it receives, and returns the action
+// of actions for the entry it records, if any.
+type traceVisitor struct {
+	events  []string
+	actions map[string]ScanAction
+}
+
+func (v *traceVisitor) record(event string) ScanAction {
+	v.events = append(v.events, event)
+	return v.actions[event]
+}
+
+func (v *traceVisitor) OnObjectStart(d int) ScanAction { return v.record(fmt.Sprintf("%d{", d)) }
+func (v *traceVisitor) OnObjectEnd(d int) ScanAction   { return v.record(fmt.Sprintf("%d}", d)) }
+func (v *traceVisitor) OnArrayStart(d int) ScanAction  { return v.record(fmt.Sprintf("%d[", d)) }
+func (v *traceVisitor) OnArrayEnd(d int) ScanAction    { return v.record(fmt.Sprintf("%d]", d)) }
+func (v *traceVisitor) OnKey(d int, key []byte) ScanAction {
+	return v.record(fmt.Sprintf("%dk:%s", d, key))
+}
+func (v *traceVisitor) OnString(d int, s []byte) ScanAction {
+	return v.record(fmt.Sprintf("%ds:%s", d, s))
+}
+func (v *traceVisitor) OnNumber(d int, n []byte) ScanAction {
+	return v.record(fmt.Sprintf("%dn:%s", d, n))
+}
+func (v *traceVisitor) OnBool(d int, b bool) ScanAction { return v.record(fmt.Sprintf("%db:%v", d, b)) }
+func (v *traceVisitor) OnNull(d int) ScanAction         { return v.record(fmt.Sprintf("%dnull", d)) }
+
+func TestScan(t *testing.T) {
+	doc := `{"a": [1, "x\ty", {"b": true}], "cé": null, "d": {}, "e": -2.5e3}`
+	v := &traceVisitor{}
+	if err := Scan([]byte(doc), v); err != nil {
+		t.Fatalf("Scan failed: %v", err)
+	}
+	want := []string{
+		"0{",
+		"1k:a", "1[", "2n:1", "2s:x\ty", "2{", "3k:b", "3b:true", "2}", "1]",
+		"1k:cé", "1null",
+		"1k:d", "1{", "1}",
+		"1k:e", "1n:-2.5e3",
+		"0}",
+	}
+	if !reflect.DeepEqual(v.events, want) {
+		t.Errorf("events = %q\nwant %q", v.events, want)
+	}
+
+	for doc, want := range map[string][]string{
+		`"s"`:   {"0s:s"},
+		` 12 `:  {"0n:12"},
+		`false`: {"0b:false"},
+		`[]`:    {"0[", "0]"},
+	} {
+		v := &traceVisitor{}
+		if err := Scan([]byte(doc), v); err != nil || !reflect.DeepEqual(v.events, want) {
+			t.Errorf("Scan(%s) = %q, %v, want %q", doc, v.events, err, want)
+		}
+	}
+}
+
+func TestScanSkipAndStop(t *testing.T) {
+	doc := []byte(`{"skip": {"x": [1, {"y": "}"}]}, "keep": [1, [2, 3], 4], "k2": "v", "last": 1}`)
+
+	v := &traceVisitor{actions: map[string]ScanAction{"1k:skip": ScanSkip, "2[": ScanSkip}}
+	if err := Scan(doc, v); err != nil {
+		t.Fatalf("Scan failed: %v", err)
+	}
+	want := []string{"0{", "1k:skip", "1k:keep", "1[", "2n:1", "2[", "2n:4", "1]", "1k:k2", "1s:v", "1k:last", "1n:1", "0}"}
+	if !reflect.DeepEqual(v.events, want) {
+		t.Errorf("skip events = %q\nwant %q", v.events, want)
+	}
+
+	v = &traceVisitor{actions: map[string]ScanAction{"1s:v": ScanStop}}
+	if err := Scan(doc, v); err != nil {
+		t.Fatalf("stopped Scan returned %v", err)
+	}
+	if got := v.events[len(v.events)-1]; got != "1s:v" {
+		t.Errorf("last event after ScanStop = %q", got)
+	}
+
+	// ScanSkip on a scalar is ScanContinue.
+	v = &traceVisitor{actions: map[string]ScanAction{"2n:1": ScanSkip}}
+	if err := Scan([]byte(`[1,2]`), v); err != nil || len(v.events) != 4 {
+		t.Errorf("events = %q, %v", v.events, err)
+	}
+}
+
+func TestScanRejectsLikeMustParse(t *testing.T) {
+	docs := []string{
+		`[1 2]`,
+		`[1,,2]`,
+		`{"a" 1}`,
+		`{"a":1 "b":2}`,
+		`{"a":1`,
+		`[1, 2`,
+		`[`,
+		`{"a":`,
+		`"abc`,
+		`"a\qb"`,
+		`["\u12"]`,
+		`tru`,
+		`[nul]`,
+		`{"a": x}`,
+		` `,
+		`[1,]`,
+		`{"a":1,}`,
+		`{} trailing`,
+		`[01]`,
+		`[1.]`,
+		`-`,
+		`[truex]`,
+		"[\"a\tb\"]",
+	}
+	for _, doc := range docs {
+		_, parseErr := MustParse([]byte(doc))
+		scanErr := Scan([]byte(doc), NopVisitor{})
+		if parseErr == nil || scanErr == nil {
+			t.Errorf("%s: MustParse error %v, Scan error %v, want both to fail", doc, parseErr, scanErr)
+			continue
+		}
+		if parseErr.Error() != scanErr.Error() {
+			t.Errorf("%s: Scan error %q, MustParse error %q", doc, scanErr, parseErr)
+		}
+	}
+
+	// The leniencies are only open to lazily parsed documents.
+	lenient := ParseOptions{AllowTrailingCommas: true, AllowTrailingData: true}
+	for _, doc := range []string{`[1,]`, `{"a":1,}`, `{} trailing`} {
+		root, err := ParseWithOptions([]byte(doc), lenient)
+		if err != nil {
+			t.Fatalf("ParseWithOptions(%s): %v", doc, err)
+		}
+		if root.Len(); root.Error() != nil {
+			t.Errorf("reading %s: %v", doc, root.Error())
+		}
+	}
+
+	// A skipped value is only checked for balanced brackets.
+	v := &traceVisitor{actions: map[string]ScanAction{"1k:a": ScanSkip}}
+	if err := Scan([]byte(`{"a": [1 2 x], "b": 1}`), v); err != nil {
+		t.Errorf("skipped malformed value: %v", err)
+	}
+	if err := Scan([]byte(`{"a": [1, 2}`), v); err == nil || !strings.Contains(err.Error(), "unterminated array") {
+		t.Errorf("skipped unbalanced value: %v", err)
+	}
+}
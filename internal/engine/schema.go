@@ -0,0 +1,112 @@
+package engine
+
+import (
+	"strings"
+
+	"github.com/474420502/xjson/internal/core"
+)
+
+// Schema describes the JSON text of the node, see jsonText.
+func (n *baseNode) Schema(depth int) core.Schema {
+	return n.SchemaWith(depth, core.SchemaOptions{})
+}
+
+// SchemaWith is Schema sampling opts.SampleSize elements of each array.
+func (n *baseNode) SchemaWith(depth int, opts core.SchemaOptions) core.Schema {
+	if n.err != nil {
+		return core.Schema{}
+	}
+	s := schemaScan{sample: opts.SampleSize, firstWins: duplicateKeyPolicy(n) == FirstWins}
+	if s.sample <= 0 {
+		s.sample = core.DefaultSchemaSample
+	}
+	data := n.jsonText()
+	schema, _ := s.value(data, skipSpace(data, 0), depth)
+	return schema
+}
+
+// schemaScan describes raw JSON values for Schema. Members and elements are
+// found with rawValueEnd, so nothing below the requested depth or past the
+// sampled elements is decoded.
+type schemaScan struct {
+	sample    int
+	firstWins bool
+}
+
+// value describes the value starting at data[pos] down to depth levels and
+// returns the offset just past it, or -1 for malformed input.
+func (s schemaScan) value(data []byte, pos, depth int) (core.Schema, int) {
+	if pos >= len(data) {
+		return core.Schema{}, -1
+	}
+	end := rawValueEnd(data, pos)
+	if end < pos {
+		return core.Schema{}, -1
+	}
+	schema := core.Schema{Type: rawValueType(data[pos])}
+	if depth == 0 {
+		return schema, end + 1
+	}
+	switch schema.Type {
+	case core.Object:
+		var index map[string]int
+		scanRawMembers(data, pos, nil, func(key string, _, valStart, _ int) bool {
+			child, _ := s.value(data, valStart, depth-1)
+			if i, dup := index[key]; dup {
+				if !s.firstWins {
+					child.Key = schema.Children[i].Key
+					schema.Children[i] = child
+				}
+				return true
+			}
+			if index == nil {
+				index = make(map[string]int)
+			}
+			child.Key = strings.Clone(key)
+			index[child.Key] = len(schema.Children)
+			schema.Children = append(schema.Children, child)
+			return true
+		})
+	case core.Array:
+		pos = skipSpace(data, pos+1)
+		for i := 0; i < s.sample && pos < len(data) && data[pos] != ']'; i++ {
+			child, next := s.value(data, pos, depth-1)
+			if next < 0 {
+				break
+			}
+			child.Index = i
+			schema.Children = append(schema.Children, child)
+			if pos = skipSpace(data, next); pos < len(data) && data[pos] == ',' {
+				pos = skipSpace(data, pos+1)
+			}
+		}
+		for i, child := range schema.Children {
+			if i == 0 {
+				schema.ElementType = child.Type
+			} else if child.Type != schema.ElementType {
+				schema.ElementType, schema.Mixed = core.Invalid, true
+				break
+			}
+		}
+	}
+	return schema, end + 1
+}
+
+// rawValueType returns the type of the JSON value starting with c.
+func rawValueType(c byte) core.NodeType {
+	switch c {
+	case '{':
+		return core.Object
+	case '[':
+		return core.Array
+	case '"':
+		return core.String
+	case 't', 'f':
+		return core.Bool
+	case 'n':
+		return core.Null
+	case '-', '0', '1', '2', '3', '4', '5', '6', '7', '8', '9', 'I', 'N':
+		return core.Number
+	}
+	return core.Invalid
+}
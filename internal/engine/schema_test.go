@@ -0,0 +1,155 @@
+package engine
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/474420502/xjson/internal/core"
+)
+
+var schemaCases = []string{
+	`{"name":"app","port":8080,"debug":false,"tags":["a","b"],"db":{"host":"x","pool":{"min":1,"max":null}},"mixed":[1,"a",null],"empty":[],"none":{}}`,
+	`[{"id":1,"tags":[]},{"id":2,"tags":["x"]},{"id":3,"tags":[[1],[2]]}]`,
+	"  {\n  \"a\\u0041\" : [ 1 , 2.5e3 , -0 ] ,\n  \"\\\"q\\\"\" : true }  ",
+	`{"dup":1,"x":[],"dup":"s"}`,
+	`[[[[[["deep"]]]]]]`,
+	`[1,2,3,4,5,6,7,8,9,10,11,12,13,14,15,16,17,18,19,20,"s"]`,
+	`"just a string"`,
+	`-12.5`,
+	`null`,
+}
+
+// referenceSchema describes node through the node API, reading every value
+// on the way, for comparison with the raw scan of Schema.
+func referenceSchema(node core.Node, depth, sample int) core.Schema {
+	schema := core.Schema{Type: node.Type()}
+	if depth == 0 {
+		return schema
+	}
+	switch typed := node.(type) {
+	case *objectNode:
+		for _, key := range typed.documentKeys() {
+			child := referenceSchema(typed.value[key], depth-1, sample)
+			child.Key = key
+			schema.Children = append(schema.Children, child)
+		}
+	case *arrayNode:
+		for i := 0; i < typed.Len() && i < sample; i++ {
+			child := referenceSchema(typed.Index(i), depth-1, sample)
+			child.Index = i
+			schema.Children = append(schema.Children, child)
+			switch {
+			case i == 0:
+				schema.ElementType = child.Type
+			case child.Type != schema.ElementType && !schema.Mixed:
+				schema.ElementType, schema.Mixed = core.Invalid, true
+			}
+		}
+	}
+	return schema
+}
+
+func TestSchemaMatchesMaterializedDocument(t *testing.T) {
+	cases := map[string][]byte{}
+	for name, data := range loadSuite(t) {
+		if _, err := MustParse(data); err == nil {
+			cases[name] = data
+		}
+	}
+	for i, doc := range schemaCases {
+		cases[string(rune('a'+i))] = []byte(doc)
+	}
+
+	for name, data := range cases {
+		full, err := MustParse(data)
+		if err != nil {
+			t.Fatalf("%s: MustParse failed: %v", name, err)
+		}
+		for _, depth := range []int{0, 1, 2, 3, -1} {
+			for _, sample := range []int{1, 2, core.DefaultSchemaSample} {
+				lazy, err := Parse(data)
+				if err != nil {
+					t.Fatalf("%s: Parse failed: %v", name, err)
+				}
+				want := referenceSchema(full, depth, sample)
+				got := lazy.SchemaWith(depth, core.SchemaOptions{SampleSize: sample})
+				if !reflect.DeepEqual(got, want) {
+					t.Errorf("%s depth %d sample %d: lazy Schema = %+v, want %+v", name, depth, sample, got, want)
+				}
+				if got := full.SchemaWith(depth, core.SchemaOptions{SampleSize: sample}); !reflect.DeepEqual(got, want) {
+					t.Errorf("%s depth %d sample %d: materialized Schema = %+v, want %+v", name, depth, sample, got, want)
+				}
+			}
+		}
+	}
+}
+
+func TestSchemaDoesNotParse(t *testing.T) {
+	root, err := Parse([]byte(schemaCases[0]))
+	if err != nil {
+		t.Fatalf("Parse failed: %v", err)
+	}
+	schema := root.Schema(-1)
+	if len(schema.Children) != 8 || schema.Children[5].Key != "mixed" || !schema.Children[5].Mixed {
+		t.Fatalf("Schema = %+v", schema)
+	}
+	if tags := schema.Children[3]; tags.ElementType != core.String || tags.Mixed {
+		t.Errorf("tags = %+v, want string elements", tags)
+	}
+	if root.(*objectNode).parsed.Load() {
+		t.Error("Schema parsed the document")
+	}
+	if got := root.Schema(0); !reflect.DeepEqual(got, core.Schema{Type: core.Object}) {
+		t.Errorf("Schema(0) = %+v", got)
+	}
+}
+
+func TestSchemaOfEditedDocument(t *testing.T) {
+	root, err := Parse([]byte(schemaCases[0]))
+	if err != nil {
+		t.Fatalf("Parse failed: %v", err)
+	}
+	root.Query("/db/pool").Set("max", 10)
+	root.Query("/tags").Append(1)
+	root.Set("added", []interface{}{true})
+
+	edited, err := MustParse([]byte(root.String()))
+	if err != nil {
+		t.Fatalf("MustParse failed: %v", err)
+	}
+	if got, want := root.Schema(-1), edited.Schema(-1); !reflect.DeepEqual(got, want) {
+		t.Errorf("Schema = %+v, want %+v", got, want)
+	}
+	if tags := root.Query("/tags").Schema(1); !tags.Mixed || len(tags.Children) != 3 {
+		t.Errorf("/tags = %+v, want three mixed elements", tags)
+	}
+}
+
+func TestSchemaDuplicateKeys(t *testing.T) {
+	data := []byte(schemaCases[3])
+	for _, policy := range []DuplicateKeyPolicy{LastWins, FirstWins} {
+		root, err := ParseWithOptions(data, ParseOptions{DuplicateKeys: policy})
+		if err != nil {
+			t.Fatalf("Parse failed: %v", err)
+		}
+		schema := root.Schema(1)
+		want := core.String
+		if policy == FirstWins {
+			want = core.Number
+		}
+		if len(schema.Children) != 2 || schema.Children[0].Key != "dup" || schema.Children[0].Type != want {
+			t.Errorf("policy %d: Schema = %+v", policy, schema)
+		}
+	}
+}
+
+func TestSchemaInvalid(t *testing.T) {
+	root, _ := Parse([]byte(`{"a":1}`))
+	if got := root.Query("/missing").Schema(-1); got.Type != core.Invalid || got.Children != nil {
+		t.Errorf("Schema of a missing value = %+v", got)
+	}
+	matches := root.Query("//a")
+	if got := matches.Schema(1); got.Type != core.Number {
+		t.Errorf("Schema of a single match = %+v", got)
+	}
+}
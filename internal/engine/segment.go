@@ -0,0 +1,151 @@
+package engine
+
+// The functions below cut a JSON value out of raw bytes without decoding
+// it. Lazy nodes, the raw key index, recursive queries, iterators and Scan
+// all find the end of a value with rawValueEnd, so they agree with each
+// other and with the full parser on where each value stops, whatever the
+// strings inside it hold.
+
+// rawValueEnd returns the index of the last byte of the value at data[pos],
+// or -1 when the value is cut short or its brackets do not pair up. For a
+// scalar the result is pos-1 when nothing at pos can start a value.
+func rawValueEnd(data []byte, pos int) int {
+	if pos >= len(data) {
+		return -1
+	}
+	switch data[pos] {
+	case '{', '[':
+		return findContainerEnd(data, pos)
+	case '"':
+		return findMatchingQuote(data, pos)
+	default:
+		return findValueEnd(data, pos)
+	}
+}
+
+// findContainerEnd returns the index of the bracket closing the object or
+// array at data[start], or -1. Objects and arrays are tracked together, so
+// the end of `{"a":[}]}` is not taken for the end of the object, and
+// brackets inside strings are skipped.
+func findContainerEnd(data []byte, start int) int {
+	if start >= len(data) || (data[start] != '{' && data[start] != '[') {
+		return -1
+	}
+	var small [32]byte
+	open := append(small[:0], data[start])
+	for i := start + 1; i < len(data); i++ {
+		switch c := data[i]; c {
+		case '{', '[':
+			open = append(open, c)
+		case '}', ']':
+			// '}' and ']' come two bytes after '{' and '['.
+			if open[len(open)-1] != c-2 {
+				return -1
+			}
+			if open = open[:len(open)-1]; len(open) == 0 {
+				return i
+			}
+		case '"':
+			end := findMatchingQuote(data, i)
+			if end == -1 {
+				return -1
+			}
+			i = end
+		}
+	}
+	return -1
+}
+
+// knownEnds holds the ends of containers found by deepContainerEnd, keyed
+// by the address of their opening bracket, so that scans of sub-slices of
+// the same source share them.
+type knownEnds map[*byte]int
+
+// valueEnd is rawValueEnd, taking the end of a container from e when it is
+// known.
+func (e knownEnds) valueEnd(data []byte, pos int) int {
+	if pos < len(data) && len(e) > 0 {
+		if size, ok := e[&data[pos]]; ok {
+			return pos + size
+		}
+	}
+	return rawValueEnd(data, pos)
+}
+
+// deepContainerEnd returns the end of the container at data[start], like
+// findContainerEnd. When containers nest more than limit levels deep in it,
+// counting it as the first, the ends of all containers open where that
+// first happens are added to e: a walk going no deeper than limit goes down
+// through them only, and would otherwise scan the rest of the value again
+// at each of them.
+func (e knownEnds) deepContainerEnd(data []byte, start, limit int) int {
+	if start >= len(data) || (data[start] != '{' && data[start] != '[') {
+		return -1
+	}
+	var small [32]byte
+	var smallStarts [32]int
+	open := append(small[:0], data[start])
+	starts := append(smallStarts[:0], start)
+	deep := false
+	for i := start + 1; i < len(data); i++ {
+		switch c := data[i]; c {
+		case '{', '[':
+			open = append(open, c)
+			if !deep {
+				starts = append(starts, i)
+				deep = len(open) > limit
+			}
+		case '}', ']':
+			if open[len(open)-1] != c-2 {
+				return -1
+			}
+			if len(starts) == len(open) {
+				from := starts[len(starts)-1]
+				if deep {
+					e[&data[from]] = i - from
+				}
+				starts = starts[:len(starts)-1]
+			}
+			if open = open[:len(open)-1]; len(open) == 0 {
+				return i
+			}
+		case '"':
+			end := findMatchingQuote(data, i)
+			if end == -1 {
+				return -1
+			}
+			i = end
+		}
+	}
+	return -1
+}
+
+// findMatchingQuote returns the index of the quote closing the string at
+// data[start], or -1.
+func findMatchingQuote(data []byte, start int) int {
+	if start >= len(data) || data[start] != '"' {
+		return -1
+	}
+	for i := start + 1; i < len(data); i++ {
+		switch data[i] {
+		case '\\':
+			i++ // skip the escaped byte, which may itself be a backslash
+		case '"':
+			return i
+		}
+	}
+	return -1
+}
+
+// findValueEnd returns the index of the last byte of the number, true,
+// false or null at data[start]: the byte before the next whitespace or
+// delimiter.
+func findValueEnd(data []byte, start int) int {
+	for i := start; i < len(data); i++ {
+		switch data[i] {
+		case ' ', '\t', '\n', '\r', ',', '}', ']':
+			return i - 1
+		}
+	}
+	return len(data) - 1
+}
@@ -0,0 +1,386 @@
+package engine
+
+import (
+	"encoding/json"
+	"fmt"
+	"go/ast"
+	goparser "go/parser"
+	"go/token"
+	"path/filepath"
+	"strconv"
+	"testing"
+
+	"github.com/474420502/xjson/internal/core"
+)
+
+// adversarialDocs hold strings with the bytes the raw scanners key on:
+// quotes, backslashes, braces and brackets, as text and as \u escapes.
+var adversarialDocs = map[string]string{
+	"escapes": `{"a\"b":{"x}":"]","y":["{","}","[","]"]},"c\\":"\\","d":"\\\"}","q":"\"","bs":"\\\\",` +
+		`"e":{"f":[{"g":"}]}"},[],{}]},"u":"\u007d\u005d\u0022\\","k\u0065y":1,"k\"}":{"\\":"{"},` +
+		`"emptyobj":"{}","emptyarr":"[]","tail":true}`,
+	"nesting": `{"l":[{"l":[{"l":[{"l":"}]}]"}]}]}],"m":[[[{"a":[{"b":"]]}}"}]}]],{"c":[[],{},"[{"]}],` +
+		`"n":{"o":{"p":{"q":[1,[2,[3,{"r":"]"}]]]}}},"z":0}`,
+	"array":   `["}",{"a":"]"},[["\"]"]],"\\",{"\\\"":{"{":"["}},[],{},"",[{}],[[]],{"":{"":""}},-1.5e3,null,false]`,
+	"spaced":  "{ \"a\" : [ \"}\" , { \"b\\\"\" :\t\"]\" } ,\n[ ] ] ,\r\n \"c\" : { \"d\" : \"{\\\\\" } , \"e\" : \"\\\\\" ,\"f\" : 12 }",
+	"strings": `{"s1":"}}}]]]","s2":"\\\"\\\"","s3":"\\\\\"","s4":"\\u0022","s5":"\u005c\u0022{","s6":"a\/b","s7":"\ud83d\ude00}","s8":"tab\tand\nline"}`,
+}
+
+// segmentQueries run against every adversarial document on top of the
+// paths of all its values.
+var segmentQueries = []string{
+	"/*", "[*]", "//*", "..*", "//l", "//a", "//b", "//l[0]", "//*[0]", "//\\", "/e/f[*]/g",
+	"/e/f[?(@.g == '}]}')]", "//x}", "//['x}']", "//r", "/m[0][0][0]/a[0]/b", "//['\\\\']", "//['{']",
+	"/n/o/p/q[1][1][1]/r", "/l[0]/l[0]/l[0]/l", "/a/b\"", "/missing", "/c/d", "//*[?(@ == ']')]",
+}
+
+func TestSegmentScannerCorpus(t *testing.T) {
+	for name, doc := range adversarialDocs {
+		t.Run(name, func(t *testing.T) {
+			var decoded interface{}
+			if err := json.Unmarshal([]byte(doc), &decoded); err != nil {
+				t.Fatalf("corpus document is not JSON: %v", err)
+			}
+			full, err := MustParse([]byte(doc))
+			if err != nil {
+				t.Fatalf("MustParse failed: %v", err)
+			}
+			built := NewNodeFromInterface(nil, decoded, nil)
+			if got, want := full.Canonical(), built.Canonical(); got != want {
+				t.Fatalf("full parse = %s, want %s", got, want)
+			}
+
+			var paths []string
+			walkAllPaths(full, func(n core.Node) { paths = append(paths, n.Path()) })
+			shared, err := Parse([]byte(doc))
+			if err != nil {
+				t.Fatalf("Parse failed: %v", err)
+			}
+			for _, path := range paths {
+				want := built.Query(path).Canonical()
+				if want == "" {
+					t.Fatalf("reference has no value at %s", path)
+				}
+				fresh, _ := Parse([]byte(doc))
+				for form, root := range map[string]core.Node{"fresh": fresh, "shared": shared, "full": full} {
+					if got := root.Query(path).Canonical(); got != want {
+						t.Errorf("%s Query(%q) = %s, want %s", form, path, got, want)
+					}
+				}
+			}
+
+			for _, path := range segmentQueries {
+				want := describeResult(full.Query(path))
+				fresh, _ := Parse([]byte(doc))
+				if got := describeResult(fresh.Query(path)); got != want {
+					t.Errorf("lazy Query(%q) = %s, full parse gives %s", path, got, want)
+				}
+				if got := describeResult(shared.Query(path)); got != want {
+					t.Errorf("shared lazy Query(%q) = %s, full parse gives %s", path, got, want)
+				}
+			}
+		})
+	}
+}
+
+// TestSegmentScannerSuiteQueries runs every query the tests of this
+// package spell out against the adversarial documents, lazily and fully
+// parsed.
+func TestSegmentScannerSuiteQueries(t *testing.T) {
+	queries := suiteQueries(t)
+	if len(queries) < 100 {
+		t.Fatalf("found only %d queries in the test files", len(queries))
+	}
+	for name, doc := range adversarialDocs {
+		full, err := MustParse([]byte(doc))
+		if err != nil {
+			t.Fatalf("%s: MustParse failed: %v", name, err)
+		}
+		shared, _ := Parse([]byte(doc))
+		for _, path := range queries {
+			want := describeResult(full.Query(path))
+			fresh, _ := Parse([]byte(doc))
+			if got := describeResult(fresh.Query(path)); got != want {
+				t.Errorf("%s: lazy Query(%q) = %s, full parse gives %s", name, path, got, want)
+			}
+			if got := describeResult(shared.Query(path)); got != want {
+				t.Errorf("%s: shared lazy Query(%q) = %s, full parse gives %s", name, path, got, want)
+			}
+		}
+	}
+}
+
+// suiteQueries returns the string literals passed to Query in the test
+// files of this package.
+func suiteQueries(t *testing.T) []string {
+	files, err := filepath.Glob("*_test.go")
+	if err != nil {
+		t.Fatal(err)
+	}
+	seen := map[string]bool{}
+	var queries []string
+	fset := token.NewFileSet()
+	for _, file := range files {
+		f, err := goparser.ParseFile(fset, file, nil, 0)
+		if err != nil {
+			t.Fatalf("%s: %v", file, err)
+		}
+		ast.Inspect(f, func(n ast.Node) bool {
+			call, ok := n.(*ast.CallExpr)
+			if !ok || len(call.Args) != 1 {
+				return true
+			}
+			if sel, ok := call.Fun.(*ast.SelectorExpr); !ok || sel.Sel.Name != "Query" {
+				return true
+			}
+			lit, ok := call.Args[0].(*ast.BasicLit)
+			if !ok || lit.Kind != token.STRING {
+				return true
+			}
+			if q, err := strconv.Unquote(lit.Value); err == nil && !seen[q] {
+				seen[q] = true
+				queries = append(queries, q)
+			}
+			return true
+		})
+	}
+	return queries
+}
+
+// TestSegmentScannerAccessPatterns compares the ways of reading a lazy
+// document that scan its raw bytes with the values of a full parse.
+func TestSegmentScannerAccessPatterns(t *testing.T) {
+	for name, doc := range adversarialDocs {
+		t.Run(name, func(t *testing.T) {
+			full, err := MustParse([]byte(doc))
+			if err != nil {
+				t.Fatalf("MustParse failed: %v", err)
+			}
+			lazy, _ := Parse([]byte(doc))
+			if got, want := navigate(lazy), navigate(full); got != want {
+				t.Errorf("Get/Index walk = %s\nwant %s", got, want)
+			}
+			lazy, _ = Parse([]byte(doc))
+			if got, want := iterate(lazy), iterate(full); got != want {
+				t.Errorf("Iter walk = %s\nwant %s", got, want)
+			}
+			lazy, _ = Parse([]byte(doc))
+			if got, want := lazy.Canonical(), full.Canonical(); got != want {
+				t.Errorf("Canonical() = %s, want %s", got, want)
+			}
+			// Skipped containers are jumped over by the segment scanner.
+			v := &topLevelVisitor{}
+			if err := Scan([]byte(doc), v); err != nil {
+				t.Errorf("Scan failed: %v", err)
+			}
+			var want []string
+			for i, elem := range full.Array() {
+				want = append(want, fmt.Sprint(i)+"="+scanText(elem))
+			}
+			if obj, ok := full.(*objectNode); ok {
+				for _, key := range obj.documentKeys() {
+					want = append(want, key+"="+scanText(full.Get(key)))
+				}
+			}
+			if fmt.Sprint(v.tokens) != fmt.Sprint(want) {
+				t.Errorf("Scan saw %q\nwant %q", v.tokens, want)
+			}
+		})
+	}
+}
+
+func TestRawValueEnd(t *testing.T) {
+	cases := []struct {
+		data string
+		pos  int
+		want int
+	}{
+		{`{}`, 0, 1},
+		{`[]`, 0, 1},
+		{`{"a":"}"}`, 0, 8},
+		{`["]"]`, 0, 4},
+		{`{"a\\":"}"}`, 0, 10},
+		{`["\\"]`, 0, 5},
+		{`["\\\"]"]`, 0, 8},
+		{`{"a":[{"b":["}"]}]}`, 0, 18},
+		{`[{"a":"\u005d"}]`, 0, 15},
+		{`x [1,[2]] y`, 2, 8},
+		{`"a\"b",`, 0, 5},
+		{`12.5e3}`, 0, 5},
+		{`true ,`, 0, 3},
+		{`null`, 0, 3},
+		{`,`, 0, -1},
+		// Cut short or mismatched.
+		{`{"a":[}]}`, 0, -1},
+		{`[{]}`, 0, -1},
+		{`{"a":"}`, 0, -1},
+		{`["\"]`, 0, -1},
+		{`[[]`, 0, -1},
+		{``, 0, -1},
+	}
+	for _, tc := range cases {
+		if got := rawValueEnd([]byte(tc.data), tc.pos); got != tc.want {
+			t.Errorf("rawValueEnd(%s, %d) = %d, want %d", tc.data, tc.pos, got, tc.want)
+		}
+	}
+}
+
+// TestDeepContainerEnd checks that deepContainerEnd finds the ends
+// rawValueEnd does, and records those of the containers open where the
+// nesting first passes the limit.
+func TestDeepContainerEnd(t *testing.T) {
+	data := []byte(`{"a":[{"b":["}"]}],"c":[1]}`)
+	cases := []struct {
+		limit int
+		want  map[int]int
+	}{
+		{2, map[int]int{0: 26, 5: 17, 6: 16}},
+		{3, map[int]int{0: 26, 5: 17, 6: 16, 11: 15}},
+		{4, map[int]int{}},
+	}
+	for _, tc := range cases {
+		ends := knownEnds{}
+		if got := ends.deepContainerEnd(data, 0, tc.limit); got != 26 {
+			t.Errorf("limit %d: end = %d, want 26", tc.limit, got)
+		}
+		got := map[int]int{}
+		for start := range data {
+			if size, ok := ends[&data[start]]; ok {
+				got[start] = start + size
+			}
+		}
+		if fmt.Sprint(got) != fmt.Sprint(tc.want) {
+			t.Errorf("limit %d: recorded %v, want %v", tc.limit, got, tc.want)
+		}
+		for start := range data {
+			if end := ends.valueEnd(data, start); data[start] == '{' && end != rawValueEnd(data, start) {
+				t.Errorf("limit %d: valueEnd(%d) = %d, want %d", tc.limit, start, end, rawValueEnd(data, start))
+			}
+		}
+	}
+	for _, doc := range []string{`{"a":[}]}`, `[{]}`, `[[]`, `["]"]`} {
+		if got, want := (knownEnds{}).deepContainerEnd([]byte(doc), 0, 1), rawValueEnd([]byte(doc), 0); got != want {
+			t.Errorf("deepContainerEnd(%s) = %d, want %d", doc, got, want)
+		}
+	}
+}
+
+// TestSegmentScannerRejectsMismatchedNesting checks that a lazy document
+// whose brackets do not pair up fails once it is read, as MustParse does,
+// instead of yielding a value cut at the wrong bracket.
+func TestSegmentScannerRejectsMismatchedNesting(t *testing.T) {
+	docs := []string{`{"a":[}]}`, `[{]}`, `{"a":{"b":[1,2}]}`, `[[{"a":"]"]}]`, `{"a":"}`, `["\"]`, `{"x":{"a":[}]},"y":1}`}
+	for _, doc := range docs {
+		if _, err := MustParse([]byte(doc)); err == nil {
+			t.Fatalf("%s: MustParse should fail", doc)
+		}
+		lazy, err := Parse([]byte(doc))
+		if err != nil {
+			continue
+		}
+		if b, err := lazy.CanonicalBytes(); err == nil {
+			t.Errorf("%s: lazy document encoded as %s, want an error", doc, b)
+		}
+	}
+}
+
+// walkAllPaths calls fn with every value below node, in document order.
+func walkAllPaths(node core.Node, fn func(core.Node)) {
+	switch node.Type() {
+	case core.Object:
+		for _, key := range node.Keys() {
+			child := node.Get(key)
+			fn(child)
+			walkAllPaths(child, fn)
+		}
+	case core.Array:
+		for _, child := range node.Array() {
+			fn(child)
+			walkAllPaths(child, fn)
+		}
+	}
+}
+
+// topLevelVisitor records the members or elements of the root, skipping
+// every nested container.
+type topLevelVisitor struct {
+	NopVisitor
+	tokens []string
+	key    string
+	index  int
+}
+
+func (v *topLevelVisitor) OnObjectStart(depth int) ScanAction { return v.container(depth, "{") }
+func (v *topLevelVisitor) OnArrayStart(depth int) ScanAction  { return v.container(depth, "[") }
+func (v *topLevelVisitor) OnKey(depth int, key []byte) ScanAction {
+	v.key = string(key)
+	return ScanContinue
+}
+func (v *topLevelVisitor) OnString(depth int, s []byte) ScanAction { return v.add(string(s)) }
+func (v *topLevelVisitor) OnNumber(depth int, n []byte) ScanAction { return v.add(string(n)) }
+func (v *topLevelVisitor) OnBool(depth int, b bool) ScanAction     { return v.add(fmt.Sprint(b)) }
+func (v *topLevelVisitor) OnNull(depth int) ScanAction             { return v.add("null") }
+
+func (v *topLevelVisitor) container(depth int, kind string) ScanAction {
+	if depth == 0 {
+		return ScanContinue
+	}
+	v.add(kind)
+	return ScanSkip
+}
+
+func (v *topLevelVisitor) add(text string) ScanAction {
+	label := v.key
+	if label == "" {
+		label = fmt.Sprint(v.index)
+		v.index++
+	}
+	v.tokens = append(v.tokens, label+"="+text)
+	return ScanContinue
+}
+
+// scanText is what topLevelVisitor records for a value.
+func scanText(n core.Node) string {
+	switch n.Type() {
+	case core.Object:
+		return "{"
+	case core.Array:
+		return "["
+	case core.String:
+		s, _ := n.RawString()
+		return s
+	}
+	return n.Raw()
+}
+
+// describeResult lists the values a query matched. Paths are left out, as
+// the matches of a recursive raw scan are cut loose from the document.
+func describeResult(n core.Node) string {
+	if !n.IsValid() {
+		return "invalid"
+	}
+	var out []string
+	for _, m := range Matches(n) {
+		out = append(out, m.Canonical())
+	}
+	return fmt.Sprint(out)
+}
+
+func navigate(node core.Node) string {
+	out := ""
+	walkAllPaths(node, func(n core.Node) { out += n.Path() + "=" + n.Canonical() + ";" })
+	return out
+}
+
+func iterate(node core.Node) string {
+	out := ""
+	it := node.Iter()
+	for it.Next() {
+		v := it.Value()
+		out += fmt.Sprint(it.Key(), it.Index()) + "=" + v.Canonical() + ";"
+		if v.Type() == core.Object || v.Type() == core.Array {
+			out += "(" + iterate(v) + ")"
+		}
+	}
+	return out
+}
@@ -0,0 +1,155 @@
+package engine
+
+import (
+	"math"
+	"strconv"
+	"unicode/utf8"
+
+	"github.com/474420502/xjson/internal/core"
+)
+
+const hexDigits = "0123456789abcdef"
+
+// writeJSONValue appends the JSON encoding of child to buf. String nodes that
+// still hold their quoted source bytes are copied verbatim; other strings are
+// quoted. Objects and arrays splice their source, and every other node type
+// already renders itself as JSON via String().
+func writeJSONValue(buf jsonWriter, child core.Node) {
+	if stopped(buf) {
+		return
+	}
+	s, ok := child.(*stringNode)
+	if !ok {
+		switch c := child.(type) {
+		case *objectNode:
+			if c.err == nil {
+				c.writeJSON(buf)
+				return
+			}
+		case *arrayNode:
+			c.checkMatches()
+			if c.err == nil && !c.matchSet {
+				c.writeJSON(buf)
+				return
+			}
+		}
+		buf.WriteString(child.String())
+		return
+	}
+	if !s.decoded || s.needsUnescape {
+		if s.start >= 1 && s.end < len(s.raw) && s.raw[s.start-1] == '"' && s.raw[s.end] == '"' {
+			buf.Write(s.raw[s.start-1 : s.end+1])
+			return
+		}
+	}
+	value, _ := s.RawString()
+	writeJSONString(buf, value)
+}
+
+// writeJSONString appends s as a quoted JSON string.
+func writeJSONString(buf jsonWriter, s string) {
+	buf.WriteByte('"')
+	start := 0
+	for i := 0; i < len(s); {
+		c := s[i]
+		if c >= 0x20 && c != '"' && c != '\\' && c < utf8.RuneSelf {
+			i++
+			continue
+		}
+		if c >= utf8.RuneSelf {
+			r, size := utf8.DecodeRuneInString(s[i:])
+			if r == utf8.RuneError && size == 1 {
+				buf.WriteString(s[start:i])
+				buf.WriteString(`�`)
+				i += size
+				start = i
+				continue
+			}
+			i += size
+			continue
+		}
+		buf.WriteString(s[start:i])
+		switch c {
+		case '"', '\\':
+			buf.WriteByte('\\')
+			buf.WriteByte(c)
+		case '\n':
+			buf.WriteString(`\n`)
+		case '\r':
+			buf.WriteString(`\r`)
+		case '\t':
+			buf.WriteString(`\t`)
+		default:
+			buf.WriteString(`\u00`)
+			buf.WriteByte(hexDigits[c>>4])
+			buf.WriteByte(hexDigits[c&0xf])
+		}
+		i++
+		start = i
+	}
+	buf.WriteString(s[start:])
+	buf.WriteByte('"')
+}
+
+// appendJSONFloat formats f like encoding/json: plain decimal notation for
+// ordinary magnitudes and a compact exponent for very large or small ones.
+// Integral values therefore never carry a decimal point.
+func appendJSONFloat(dst []byte, f float64, bits int) []byte {
+	abs := math.Abs(f)
+	format := byte('f')
+	if abs != 0 {
+		if bits == 64 && (abs < 1e-6 || abs >= 1e21) || bits == 32 && (float32(abs) < 1e-6 || float32(abs) >= 1e21) {
+			format = 'e'
+		}
+	}
+	dst = strconv.AppendFloat(dst, f, format, -1, bits)
+	if format == 'e' {
+		// clean up e-09 to e-9
+		n := len(dst)
+		if n >= 4 && dst[n-4] == 'e' && dst[n-3] == '-' && dst[n-2] == '0' {
+			dst[n-2] = dst[n-1]
+			dst = dst[:n-1]
+		}
+	}
+	return dst
+}
+
+// isJSONNumber reports whether s follows the RFC 8259 number grammar.
+func isJSONNumber(s string) bool {
+	i := 0
+	if i < len(s) && s[i] == '-' {
+		i++
+	}
+	switch {
+	case i < len(s) && s[i] == '0':
+		i++
+	case i < len(s) && s[i] >= '1' && s[i] <= '9':
+		for i < len(s) && s[i] >= '0' && s[i] <= '9' {
+			i++
+		}
+	default:
+		return false
+	}
+	if i < len(s) && s[i] == '.' {
+		i++
+		if i >= len(s) || s[i] < '0' || s[i] > '9' {
+			return false
+		}
+		for i < len(s) && s[i] >= '0' && s[i] <= '9' {
+			i++
+		}
+	}
+	if i < len(s) && (s[i] == 'e' || s[i] == 'E') {
+		i++
+		if i < len(s) && (s[i] == '+' || s[i] == '-') {
+			i++
+		}
+		if i >= len(s) || s[i] < '0' || s[i] > '9' {
+			return false
+		}
+		for i < len(s) && s[i] >= '0' && s[i] <= '9' {
+			i++
+		}
+	}
+	return i == len(s)
+}
@@ -0,0 +1,180 @@
+package engine
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/474420502/xjson/internal/core"
+)
+
+func TestBytesOnMatchSets(t *testing.T) {
+	data := []byte(`{"users":[{"name":"ann","age":30,"tags":["a"]},{"name":"bob","age":25},{"name":"c\"d","age":41}],"ids":[7],"mixed":[{"a":[1]},2,"x",null,true]}`)
+
+	testCases := []struct {
+		name string
+		path string
+		want string
+	}{
+		{name: "single filter match", path: `/users[?(@.age > 40)]/name`, want: `"c\"d"`},
+		{name: "single object match", path: `/users[?(@.age == 25)]`, want: `{"name":"bob","age":25}`},
+		{name: "many matches", path: `/users[?(@.age < 40)]/name`, want: `["ann","bob"]`},
+		{name: "recursive matches", path: `//age`, want: `[30,25,41]`},
+		{name: "mixed objects and scalars", path: `/mixed[*]`, want: `[{"a":[1]},2,"x",null,true]`},
+		{name: "plain string value", path: `/users[0]/name`, want: `"ann"`},
+		{name: "one element array value", path: `/ids`, want: `[7]`},
+		{name: "document", path: `/users[1]`, want: `{"name":"bob","age":25}`},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			for _, parse := range []func([]byte) (core.Node, error){Parse, MustParse} {
+				root, err := parse(data)
+				if err != nil {
+					t.Fatalf("parse failed: %v", err)
+				}
+				got, err := root.Query(tc.path).Bytes()
+				if err != nil {
+					t.Fatalf("Bytes(%q) failed: %v", tc.path, err)
+				}
+				if string(got) != tc.want {
+					t.Fatalf("Bytes(%q) = %s, want %s", tc.path, got, tc.want)
+				}
+			}
+		})
+	}
+}
+
+func TestBytesAndStringOnEmptyOrSingleMatchSets(t *testing.T) {
+	root, err := Parse([]byte(`{"users":[{"name":"ann","age":30},{"name":"bob","age":25}]}`))
+	if err != nil {
+		t.Fatalf("Parse failed: %v", err)
+	}
+
+	empty := root.Query(`/users[?(@.age > 90)]`)
+	if !empty.IsValid() {
+		t.Fatalf("expected a valid empty match set, got %v", empty.Error())
+	}
+	if got, err := empty.Bytes(); !errors.Is(err, core.ErrNoMatches) || got != nil {
+		t.Fatalf("expected ErrNoMatches, got %q, %v", got, err)
+	}
+	if got := empty.String(); got != "" {
+		t.Fatalf("expected empty String for no matches, got %q", got)
+	}
+
+	if got := root.Query(`/users[?(@.age > 26)]/name`).String(); got != "ann" {
+		t.Fatalf("expected a single match to render as its value, got %q", got)
+	}
+	if got := root.Query(`/users[*]/name`).String(); got != `["ann","bob"]` {
+		t.Fatalf("unexpected String for several matches: %s", got)
+	}
+
+	if _, err := root.Query(`/missing`).Bytes(); err == nil || errors.Is(err, core.ErrNoMatches) {
+		t.Fatalf("expected the lookup error for an invalid node, got %v", err)
+	}
+}
+
+const pristineDoc = `{"a":{"b":[1,2,{"c":"x"}],"deep":{"x":"y"}},"list":[1, 2],"s":"v"}`
+
+func TestBytesReturnsSourceUntilModified(t *testing.T) {
+	root, err := Parse([]byte(pristineDoc))
+	if err != nil {
+		t.Fatalf("Parse failed: %v", err)
+	}
+	// Reads alone keep the fast path.
+	_ = root.Query("/a/b[2]/c").String()
+	_ = root.Get("list").Index(1).Int()
+	_ = root.Query("//c").Strings()
+	got, err := root.Bytes()
+	if err != nil || string(got) != pristineDoc {
+		t.Fatalf("expected the source bytes, got %s (%v)", got, err)
+	}
+	if root.String() != pristineDoc {
+		t.Fatalf("expected String to return the source, got %s", root.String())
+	}
+
+	fresh, _ := Parse([]byte(pristineDoc))
+	if _, err := fresh.Bytes(); err != nil {
+		t.Fatalf("Bytes failed: %v", err)
+	}
+	if fresh.(*objectNode).parsed.Load() {
+		t.Fatal("expected Bytes on an untouched document not to parse it")
+	}
+}
+
+func TestBytesReflectsMutations(t *testing.T) {
+	mutations := map[string]func(core.Node){
+		"object set":        func(r core.Node) { r.Get("a").Set("new", 1) },
+		"scalar set value":  func(r core.Node) { r.Query("/a/deep/x").SetValue("z") },
+		"array element set": func(r core.Node) { r.Query("/a/b").Set("0", 9) },
+		"nested array set":  func(r core.Node) { r.Query("/a/b[2]").Set("c", "w") },
+		"append":            func(r core.Node) { r.Get("list").Append(3) },
+		"insert":            func(r core.Node) { r.Get("list").InsertAt(0, 0) },
+		"delete":            func(r core.Node) { r.Get("a").Delete("deep") },
+		"delete by path":    func(r core.Node) { r.DeleteByPath("/a/b[0]") },
+		"set by path":       func(r core.Node) { r.SetByPath("/a/deep/x", true) },
+		"root set":          func(r core.Node) { r.Set("s", nil) },
+		"iterator child": func(r core.Node) {
+			it := r.Get("a").(*objectNode).rawIter()
+			for it.Next() {
+				if string(it.KeyRaw()) == "deep" {
+					it.ParseValue().Set("x", 2)
+				}
+			}
+		},
+	}
+	for name, mutate := range mutations {
+		lazy, err := Parse([]byte(pristineDoc))
+		if err != nil {
+			t.Fatalf("Parse failed: %v", err)
+		}
+		eager, err := MustParse([]byte(pristineDoc))
+		if err != nil {
+			t.Fatalf("MustParse failed: %v", err)
+		}
+		mutate(lazy)
+		mutate(eager)
+		got, err := lazy.Bytes()
+		if err != nil {
+			t.Fatalf("%s: Bytes failed: %v", name, err)
+		}
+		if string(got) == pristineDoc {
+			t.Fatalf("%s: Bytes still returns the source", name)
+		}
+		reparsed, err := MustParse(got)
+		if err != nil {
+			t.Fatalf("%s: Bytes produced invalid JSON %s: %v", name, got, err)
+		}
+		if diffs := Diff(eager, reparsed); len(diffs) != 0 {
+			t.Fatalf("%s: Bytes = %s, differs from the eager result: %v", name, got, diffs)
+		}
+		if lazy.String() != string(got) {
+			t.Fatalf("%s: String %s and Bytes %s disagree", name, lazy.String(), got)
+		}
+	}
+}
+
+func TestBytesDoesNotAliasSource(t *testing.T) {
+	data := []byte(pristineDoc)
+	root, err := Parse(data)
+	if err != nil {
+		t.Fatalf("Parse failed: %v", err)
+	}
+	got, err := root.Bytes()
+	if err != nil {
+		t.Fatalf("Bytes failed: %v", err)
+	}
+	for i := range got {
+		got[i] = 'X'
+	}
+	if string(data) != pristineDoc || root.String() != pristineDoc {
+		t.Fatal("modifying the result of Bytes changed the document")
+	}
+	sub, err := root.Get("list").Bytes()
+	if err != nil || string(sub) != `[1, 2]` {
+		t.Fatalf("unexpected array bytes %s (%v)", sub, err)
+	}
+	sub[0] = '{'
+	if root.Get("list").String() != `[1, 2]` {
+		t.Fatal("modifying the result of Bytes changed the array")
+	}
+}
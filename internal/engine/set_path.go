@@ -0,0 +1,201 @@
+package engine
+
+import (
+	"fmt"
+	"strconv"
+
+	"github.com/474420502/xjson/internal/core"
+)
+
+// writeMode says what a write by path does about a missing parent and about
+// the value already at the path.
+type writeMode int
+
+const (
+	writeCreate   writeMode = iota // create missing parents, overwrite the leaf
+	writeStrict                    // fail on a missing parent, overwrite the leaf
+	writeIfAbsent                  // create missing parents, keep an existing leaf
+	writeReplace                   // fail on a missing parent or leaf
+)
+
+// SetStrict is SetByPath returning only the error: it fails with a
+// *core.PathError wrapping core.ErrNotFound when a step before the last
+// finds nothing.
+func (n *baseNode) SetStrict(path string, value interface{}) error {
+	if n.err != nil {
+		return n.err
+	}
+	result, _ := n.setPath("SetStrict", path, value, writeStrict, false)
+	return result.Error()
+}
+
+// SetIfAbsent is SetByPath for a value that is not there yet. It creates
+// missing parents like SetByPathWith, and writes and reports true only if the
+// last step finds nothing. A null value is there and is kept.
+func (n *baseNode) SetIfAbsent(path string, value interface{}) (bool, error) {
+	if n.err != nil {
+		return false, n.err
+	}
+	result, wrote := n.setPath("SetIfAbsent", path, value, writeIfAbsent, false)
+	return wrote, result.Error()
+}
+
+// Replace overwrites the value at path, null included, and fails with a
+// *core.PathError wrapping core.ErrNotFound when there is none, creating
+// nothing.
+func (n *baseNode) Replace(path string, value interface{}) error {
+	if n.err != nil {
+		return n.err
+	}
+	result, _ := n.setPath("Replace", path, value, writeReplace, false)
+	return result.Error()
+}
+
+// SetByPathWith is SetByPath creating missing parents as objects, with the
+// conflict policy of opts. By default a
+// key step on a value that is not an object, or an index step on one that is
+// not an array, fails with a *core.PathError wrapping core.ErrPathConflict;
+// with opts.OverwriteConflicts the value in the way of a key step is
+// replaced by an empty object.
+func (n *baseNode) SetByPathWith(path string, value interface{}, opts core.SetOptions) core.Node {
+	result, _ := n.setPath("SetByPath", path, value, writeCreate, opts.OverwriteConflicts)
+	return result
+}
+
+// setPath follows the key and index steps of path and writes value at the
+// last one as mode says, reporting whether it wrote. A numeric step names a
+// member of an object and an element of anything else. A step on a value of
+// the wrong type is a conflict, which overwrite resolves for key steps. It
+// returns what the write returned or an invalid node with the error.
+func (n *baseNode) setPath(op, path string, value interface{}, mode writeMode, overwrite bool) (core.Node, bool) {
+	if n.err != nil {
+		return n.selfOrMe(), false
+	}
+
+	// Parse the path into tokens
+	tokens, err := ParseQuery(path)
+	if err != nil {
+		return newInvalidNode(fmt.Errorf("invalid path: %v", err)), false
+	}
+	if len(tokens) == 0 {
+		return newInvalidNode(fmt.Errorf("empty path")), false
+	}
+	for _, token := range tokens {
+		if token.Op != OpKey && token.Op != OpIndex {
+			return newInvalidNode(fmt.Errorf("operation %v not supported in %s", token.Op, op)), false
+		}
+	}
+	notFound := func(seg core.PathSegment) (core.Node, bool) {
+		return newInvalidNode(&core.PathError{Op: op, Path: path, Err: fmt.Errorf("%w: %s", core.ErrNotFound, describeSegment(seg))}), false
+	}
+	createParents := mode == writeCreate || mode == writeIfAbsent
+
+	current := n.selfOrMe()
+	// taken holds the steps followed so far, to name the value a
+	// conflicting step meets.
+	var taken []core.PathSegment
+	// holder readies current for a step, returning the step as current
+	// takes it: a numeric step on an object is the key of a member. A match
+	// set passes the step on to its matches.
+	holder := func(token queryToken) (core.PathSegment, error) {
+		_, isMatchSet := matchList(current)
+		t := current.Type()
+		if token.Op == OpIndex {
+			index := token.Value.(int)
+			switch {
+			case t == core.Object && !isMatchSet:
+				return core.KeySegment(strconv.Itoa(index)), nil
+			case t == core.Array:
+				return core.IndexSegment(index), nil
+			}
+			return core.PathSegment{}, pathConflict(op, path, taken, t, core.IndexSegment(index), core.Array)
+		}
+		seg := core.KeySegment(token.Value.(string))
+		if t == core.Object || isMatchSet {
+			return seg, nil
+		}
+		if overwrite {
+			if replaced := current.SetValue(map[string]interface{}{}); replaced.IsValid() {
+				current = replaced
+				return seg, nil
+			}
+		}
+		return core.PathSegment{}, pathConflict(op, path, taken, t, seg, core.Object)
+	}
+
+	// Navigate to the parent of the target node
+	for _, token := range tokens[:len(tokens)-1] {
+		seg, err := holder(token)
+		if err != nil {
+			return newInvalidNode(err), false
+		}
+		taken = append(taken, seg)
+		if seg.IsIndex {
+			next := current.Index(seg.Index)
+			if next.IsValid() {
+				current = next
+				continue
+			}
+			if !createParents {
+				return notFound(seg)
+			}
+			return newInvalidNode(fmt.Errorf("index %d out of bounds", seg.Index)), false
+		}
+		next := current.Get(seg.Key)
+		if next.IsValid() {
+			current = next
+			continue
+		}
+		if !createParents {
+			return notFound(seg)
+		}
+		// Try to create intermediate object node
+		if res := current.Set(seg.Key, map[string]interface{}{}); !res.IsValid() {
+			return res, false
+		}
+		current = current.Get(seg.Key)
+	}
+
+	// Set the value at the final token.
+	seg, err := holder(tokens[len(tokens)-1])
+	if err != nil {
+		return newInvalidNode(err), false
+	}
+	key := seg.Key
+	exists := func() bool { return current.Get(key).IsValid() }
+	if seg.IsIndex {
+		key = strconv.Itoa(seg.Index)
+		exists = func() bool { return current.Index(seg.Index).IsValid() }
+	}
+	switch mode {
+	case writeIfAbsent:
+		if exists() {
+			return current, false
+		}
+	case writeReplace:
+		if !exists() {
+			return notFound(seg)
+		}
+	}
+	result := current.Set(key, value)
+	return result, result.IsValid()
+}
+
+// pathConflict is the error of a step seg, which needs a value of type want,
+// meeting one of type got after the steps taken.
+func pathConflict(op, path string, taken []core.PathSegment, got core.NodeType, seg core.PathSegment, want core.NodeType) error {
+	where := formatSegments(taken)
+	if where == "" {
+		where = "root"
+	}
+	return &core.PathError{Op: op, Path: path, Err: fmt.Errorf("%w: %s is %s, %s needs %s",
+		core.ErrPathConflict, where, got, describeSegment(seg), want)}
+}
+
+// describeSegment names a path step the way the errors of setPath do.
+func describeSegment(seg core.PathSegment) string {
+	if seg.IsIndex {
+		return fmt.Sprintf("index %d", seg.Index)
+	}
+	return fmt.Sprintf("key %q", seg.Key)
+}
@@ -0,0 +1,188 @@
+package engine
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/474420502/xjson/internal/core"
+)
+
+const setPathDoc = `{"user":{"name":"ann","nick":null},"tags":["a","b"],"byId":{"0":"zero"}}`
+
+func TestSetStrict(t *testing.T) {
+	for name, parse := range testParsers {
+		root, err := parse([]byte(setPathDoc))
+		if err != nil {
+			t.Fatalf("%s: parse failed: %v", name, err)
+		}
+		if err := root.SetStrict("/user/name", "bob"); err != nil {
+			t.Errorf("%s: SetStrict of an existing key failed: %v", name, err)
+		}
+		if err := root.SetStrict("/user/age", 7); err != nil {
+			t.Errorf("%s: SetStrict of a new key under an existing parent failed: %v", name, err)
+		}
+		if err := root.SetStrict("/tags/1", "B"); err != nil {
+			t.Errorf("%s: SetStrict of an element failed: %v", name, err)
+		}
+		err = root.SetStrict("/prefs/theme", "dark")
+		var pathErr *core.PathError
+		if !errors.Is(err, core.ErrNotFound) || !errors.As(err, &pathErr) || pathErr.Op != "SetStrict" || pathErr.Path != "/prefs/theme" {
+			t.Errorf("%s: SetStrict under a missing parent = %v, want a *PathError wrapping ErrNotFound", name, err)
+		}
+		if err := root.SetStrict("/tags/5/x", 1); !errors.Is(err, core.ErrNotFound) {
+			t.Errorf("%s: SetStrict under a missing element = %v, want ErrNotFound", name, err)
+		}
+		if err := root.SetStrict("/tags/5", 1); !errors.Is(err, core.ErrIndexOutOfBounds) {
+			t.Errorf("%s: SetStrict past the end = %v, want ErrIndexOutOfBounds", name, err)
+		}
+		want := `{"user":{"name":"bob","nick":null,"age":7},"tags":["a","B"],"byId":{"0":"zero"}}`
+		if got := root.String(); got != want {
+			t.Errorf("%s: after SetStrict = %s, want %s", name, got, want)
+		}
+	}
+}
+
+func TestSetIfAbsent(t *testing.T) {
+	for name, parse := range testParsers {
+		root, err := parse([]byte(setPathDoc))
+		if err != nil {
+			t.Fatalf("%s: parse failed: %v", name, err)
+		}
+		cases := []struct {
+			path  string
+			wrote bool
+		}{
+			{"/user/name", false},
+			{"/user/nick", false},
+			{"/user/age", true},
+			{"/prefs/theme", true},
+			{"/tags/0", false},
+			{"/tags/-1", false},
+			{"/byId/0", false},
+			{"/byId/1", true},
+		}
+		for _, tc := range cases {
+			wrote, err := root.SetIfAbsent(tc.path, "new")
+			if err != nil || wrote != tc.wrote {
+				t.Errorf("%s: SetIfAbsent(%s) = %v, %v, want %v", name, tc.path, wrote, err, tc.wrote)
+			}
+		}
+		if wrote, err := root.SetIfAbsent("/tags/2", "c"); wrote || !errors.Is(err, core.ErrIndexOutOfBounds) {
+			t.Errorf("%s: SetIfAbsent past the end = %v, %v, want ErrIndexOutOfBounds", name, wrote, err)
+		}
+		want := `{"user":{"name":"ann","nick":null,"age":"new"},"tags":["a","b"],"byId":{"0":"zero","1":"new"},"prefs":{"theme":"new"}}`
+		if got := root.String(); got != want {
+			t.Errorf("%s: after SetIfAbsent = %s, want %s", name, got, want)
+		}
+	}
+}
+
+func TestReplace(t *testing.T) {
+	for name, parse := range testParsers {
+		root, err := parse([]byte(setPathDoc))
+		if err != nil {
+			t.Fatalf("%s: parse failed: %v", name, err)
+		}
+		for _, path := range []string{"/user/name", "/user/nick", "/tags/-1", "/tags[0]", "/byId/0"} {
+			if err := root.Replace(path, "new"); err != nil {
+				t.Errorf("%s: Replace(%s) failed: %v", name, path, err)
+			}
+		}
+		for _, path := range []string{"/user/age", "/prefs/theme", "/tags/2", "/tags/9/x", "/byId/1"} {
+			err := root.Replace(path, "new")
+			var pathErr *core.PathError
+			if !errors.Is(err, core.ErrNotFound) || !errors.As(err, &pathErr) || pathErr.Op != "Replace" {
+				t.Errorf("%s: Replace(%s) = %v, want a *PathError wrapping ErrNotFound", name, path, err)
+			}
+		}
+		want := `{"user":{"name":"new","nick":"new"},"tags":["new","new"],"byId":{"0":"new"}}`
+		if got := root.String(); got != want {
+			t.Errorf("%s: after Replace = %s, want %s", name, got, want)
+		}
+	}
+}
+
+func TestSetPathModesOnInvalidNodes(t *testing.T) {
+	root, _ := Parse([]byte(`{"a":1}`))
+	missing := root.Get("missing")
+	if err := missing.SetStrict("/x", 1); err == nil || !errors.Is(err, missing.Error()) {
+		t.Errorf("SetStrict on an invalid node = %v, want its error", err)
+	}
+	if wrote, err := missing.SetIfAbsent("/x", 1); wrote || err == nil {
+		t.Errorf("SetIfAbsent on an invalid node = %v, %v, want an error", wrote, err)
+	}
+	if err := missing.Replace("/x", 1); err == nil {
+		t.Error("Replace on an invalid node should fail")
+	}
+	for _, path := range []string{"", "/a[", "/a[*]"} {
+		if err := root.Replace(path, 1); err == nil {
+			t.Errorf("Replace(%q) should fail", path)
+		}
+		if _, err := root.SetIfAbsent(path, 1); err == nil {
+			t.Errorf("SetIfAbsent(%q) should fail", path)
+		}
+	}
+	if err := root.SetStrict("/a/b", 1); err == nil {
+		t.Error("SetStrict below a number should fail")
+	}
+}
+
+func TestSetPathConflicts(t *testing.T) {
+	const doc = `{"user":{"name":"ann","nick":null,"tags":["a"]},"n":1}`
+	conflicts := []struct {
+		path, msg string
+	}{
+		{"/user/name/first", `/user/name is string, key "first" needs object`},
+		{"/user/nick/first", `/user/nick is null, key "first" needs object`},
+		{"/user/tags/first", `/user/tags is array, key "first" needs object`},
+		{"/user/tags/first/x", `/user/tags is array, key "first" needs object`},
+		{"/n/0", `/n is number, index 0 needs array`},
+		{"/user/name[0]/x", `/user/name is string, index 0 needs array`},
+	}
+	for name, parse := range testParsers {
+		root, err := parse([]byte(doc))
+		if err != nil {
+			t.Fatalf("%s: parse failed: %v", name, err)
+		}
+		for _, tc := range conflicts {
+			res := root.SetByPath(tc.path, "v")
+			var pathErr *core.PathError
+			if err := res.Error(); !errors.Is(err, core.ErrPathConflict) || !errors.As(err, &pathErr) ||
+				pathErr.Op != "SetByPath" || !strings.Contains(err.Error(), tc.msg) {
+				t.Errorf("%s: SetByPath(%s) = %v, want a conflict: %s", name, tc.path, err, tc.msg)
+			}
+			if err := root.SetStrict(tc.path, "v"); !errors.Is(err, core.ErrPathConflict) {
+				t.Errorf("%s: SetStrict(%s) = %v, want ErrPathConflict", name, tc.path, err)
+			}
+			if _, err := root.SetIfAbsent(tc.path, "v"); !errors.Is(err, core.ErrPathConflict) {
+				t.Errorf("%s: SetIfAbsent(%s) = %v, want ErrPathConflict", name, tc.path, err)
+			}
+		}
+		if got := root.String(); got != doc || len(root.DirtyPaths()) != 0 {
+			t.Errorf("%s: conflicts changed the document: %s", name, got)
+		}
+
+		overwrite := core.SetOptions{OverwriteConflicts: true}
+		for _, path := range []string{"/user/name/first", "/user/nick/first", "/user/tags/x/y"} {
+			if res := root.SetByPathWith(path, "v", overwrite); !res.IsValid() {
+				t.Errorf("%s: SetByPathWith(%s) failed: %v", name, path, res.Error())
+			}
+		}
+		if err := root.SetByPathWith("/n/0", "v", overwrite).Error(); !errors.Is(err, core.ErrPathConflict) {
+			t.Errorf("%s: overwriting for an index step = %v, want ErrPathConflict", name, err)
+		}
+		want := `{"user":{"name":{"first":"v"},"nick":{"first":"v"},"tags":{"x":{"y":"v"}}},"n":1}`
+		if got := root.String(); got != want {
+			t.Errorf("%s: after overwriting = %s, want %s", name, got, want)
+		}
+		if got := root.Query("/user/tags/x/y").String(); got != "v" {
+			t.Errorf("%s: /user/tags/x/y = %q, want v", name, got)
+		}
+
+		scalar, _ := parse([]byte(`"s"`))
+		if err := scalar.SetByPathWith("/a", 1, overwrite).Error(); !errors.Is(err, core.ErrPathConflict) || !strings.Contains(err.Error(), "root is string") {
+			t.Errorf("%s: overwriting the root = %v, want a conflict at the root", name, err)
+		}
+	}
+}
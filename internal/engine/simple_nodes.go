@@ -1,7 +1,11 @@
 package engine
 
 import (
+	"bytes"
+	"encoding/json"
+	"errors"
 	"fmt"
+	"math"
 	"strconv"
 	"strings"
 	"time"
@@ -39,7 +43,8 @@ func (n *stringNode) String() string {
 func (n *stringNode) MustString() string {
 	s := n.String()
 	if s == "" && n.err != nil {
-		panic(n.err)
+		n.mustFail(mustError(n, "MustString", n.err))
+		return ""
 	}
 	return s
 }
@@ -96,6 +101,23 @@ func (n *stringNode) RawString() (string, bool) {
 	n.decoded = true
 	return n.value, true
 }
+
+// RawEscaped returns the string as it is written in the source, escape
+// sequences included but without the quotes. Strings that were not parsed
+// from source are escaped the way String() output would be serialized.
+func (n *stringNode) RawEscaped() (string, bool) {
+	if n.err != nil {
+		return "", false
+	}
+	if n.start >= 1 && n.end < len(n.raw) && n.raw[n.start-1] == '"' && n.raw[n.end] == '"' {
+		return string(n.raw[n.start:n.end]), true
+	}
+	var buf bytes.Buffer
+	writeJSONString(&buf, n.value)
+	quoted := buf.String()
+	return quoted[1 : len(quoted)-1], true
+}
+
 func (n *stringNode) Contains(v string) bool {
 	s, _ := n.RawString()
 	return s == v
@@ -130,11 +152,13 @@ func (n *stringNode) Time() time.Time {
 func (n *stringNode) MustTime() time.Time {
 	s, ok := n.RawString()
 	if !ok {
-		panic("failed to get raw string for time parsing")
+		n.mustFail(mustError(n, "MustTime", core.ErrTypeAssertion))
+		return time.Time{}
 	}
 	t, err := time.Parse(time.RFC3339Nano, s)
 	if err != nil {
-		panic(err)
+		n.mustFail(mustError(n, "MustTime", err))
+		return time.Time{}
 	}
 	return t
 }
@@ -147,32 +171,50 @@ type numberNode struct {
 
 func (n *numberNode) Type() core.NodeType { return core.Number }
 
+// Float returns the value of the number. One too large for a float64, such
+// as 1e309, saturates to an infinity of its sign, and one too small, such
+// as 1e-400, underflows to zero; TryFloat reports the overflow.
 func (n *numberNode) Float() float64 {
-	f, _ := strconv.ParseFloat(n.Raw(), 64)
+	f, err := strconv.ParseFloat(n.Raw(), 64)
+	if err != nil && !errors.Is(err, strconv.ErrRange) {
+		n.conversionFailed("Float", "float", err)
+	}
 	return f
 }
 
+// MustFloat is Float: a number is always a float64, saturated if need be.
 func (n *numberNode) MustFloat() float64 {
 	f, err := strconv.ParseFloat(n.Raw(), 64)
-	if err != nil {
-		panic(err)
+	if err != nil && !errors.Is(err, strconv.ErrRange) {
+		n.mustFail(mustError(n, "MustFloat", err))
+		return 0
 	}
 	return f
 }
 
+// Int returns the value of a number that is an integer in the int64 range,
+// see IntExact, and 0 for any other: 42.7 is not truncated to 42.
 func (n *numberNode) Int() int64 {
-	i, _ := strconv.ParseInt(n.Raw(), 10, 64)
+	i, err := intOf(n.Raw(), intExact)
+	if err != nil {
+		n.conversionFailed("Int", "int", err)
+	}
 	return i
 }
 
 func (n *numberNode) MustInt() int64 {
-	i, err := strconv.ParseInt(n.Raw(), 10, 64)
+	i, err := intOf(n.Raw(), intExact)
 	if err != nil {
-		panic(err)
+		n.mustFail(mustError(n, "MustInt", err))
+		return 0
 	}
 	return i
 }
 
+// Interface returns an int64 for an integer in its range and a float64
+// otherwise, or for a number too large for a float64 a json.Number of its
+// text, which encoding/json and Set write back unchanged where ±Inf would
+// fail. The non-finite numbers of JSON5 are ±Inf and NaN.
 func (n *numberNode) Interface() interface{} {
 	raw := n.Raw()
 	if !strings.Contains(raw, ".") {
@@ -180,7 +222,10 @@ func (n *numberNode) Interface() interface{} {
 			return i
 		}
 	}
-	f, _ := strconv.ParseFloat(raw, 64)
+	f, err := strconv.ParseFloat(raw, 64)
+	if math.IsInf(f, 0) && errors.Is(err, strconv.ErrRange) {
+		return json.Number(raw)
+	}
 	return f
 }
 
@@ -222,7 +267,12 @@ func (n *numberNode) setUint64(v uint64) {
 }
 
 func (n *numberNode) setFloat64(v float64) {
-	buf := strconv.AppendFloat(n.inlineBuf[:0], v, 'f', -1, 64)
+	n.setFloat(v, 64)
+}
+
+// setFloat stores v formatted for the given float bit size.
+func (n *numberNode) setFloat(v float64, bits int) {
+	buf := appendJSONFloat(n.inlineBuf[:0], v, bits)
 	n.raw = buf
 	n.start = 0
 	n.end = len(buf)
@@ -332,11 +382,26 @@ func tryMutateScalarNode(existing core.Node, value interface{}) bool {
 			node.setUint64(v)
 			return true
 		case float32:
-			node.setFloat64(float64(v))
+			if math.IsNaN(float64(v)) || math.IsInf(float64(v), 0) {
+				return false
+			}
+			node.setFloat(float64(v), 32)
 			return true
 		case float64:
+			if math.IsNaN(v) || math.IsInf(v, 0) {
+				return false
+			}
 			node.setFloat64(v)
 			return true
+		case json.Number:
+			if !isJSONNumber(string(v)) {
+				return false
+			}
+			node.raw = []byte(v)
+			node.start = 0
+			node.end = len(node.raw)
+			node.err = nil
+			return true
 		}
 	case *boolNode:
 		if v, ok := value.(bool); ok {
@@ -0,0 +1,73 @@
+package engine
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/474420502/xjson/internal/core"
+)
+
+// SortBy returns the elements of an array or match set as a new match set
+// sorted by the value at path, see sortByPath. The array keeps its order.
+func (n *baseNode) SortBy(path string, desc bool) core.Node {
+	if n.err != nil {
+		return n.selfOrMe()
+	}
+	self := n.selfOrMe()
+	if self.Type() != core.Array {
+		return newInvalidNode(fmt.Errorf("sort not supported on type %s: %w", self.Type(), core.ErrTypeAssertion))
+	}
+	return newMatchSet(self, sortByPath(self.Array(), path, desc), n.funcs)
+}
+
+// sortByPath returns a stably sorted copy of elems, ordered by the value at
+// path of each element, or by the element itself for an empty path. The
+// first element with a number or string there decides how values compare:
+// numbers numerically, strings lexicographically. Elements without such a
+// value, or with one of the other type, follow in their original order.
+func sortByPath(elems []core.Node, path string, desc bool) []core.Node {
+	type keyed struct {
+		node core.Node
+		num  float64
+		str  string
+	}
+	var sorted []keyed
+	var rest []core.Node
+	kind := core.Invalid
+	for _, elem := range elems {
+		value := elem
+		if path != "" {
+			value = applySimpleQuery(elem, path)
+		}
+		t := value.Type()
+		if kind == core.Invalid && (t == core.Number || t == core.String) {
+			kind = t
+		}
+		if t != kind || !value.IsValid() {
+			rest = append(rest, elem)
+			continue
+		}
+		k := keyed{node: elem}
+		if t == core.Number {
+			k.num = value.Float()
+		} else {
+			k.str, _ = value.RawString()
+		}
+		sorted = append(sorted, k)
+	}
+	sort.SliceStable(sorted, func(i, j int) bool {
+		a, b := sorted[i], sorted[j]
+		if desc {
+			a, b = b, a
+		}
+		if kind == core.Number {
+			return a.num < b.num
+		}
+		return a.str < b.str
+	})
+	out := make([]core.Node, 0, len(elems))
+	for _, k := range sorted {
+		out = append(out, k.node)
+	}
+	return append(out, rest...)
+}
@@ -0,0 +1,118 @@
+package engine
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+
+	"github.com/474420502/xjson/internal/core"
+)
+
+const sortByDoc = `{"books":[` +
+	`{"t":"A","price":12,"author":{"name":"kim"}},` +
+	`{"t":"B","price":8.5,"author":{"name":"ann"}},` +
+	`{"t":"C","author":{"name":"bob"}},` +
+	`{"t":"D","price":12,"author":{}},` +
+	`{"t":"E","price":"9","author":{"name":"Zed"}},` +
+	`{"t":"F","price":-1,"author":{"name":"ann"}}]}`
+
+func sortedTitles(t *testing.T, n core.Node) []string {
+	t.Helper()
+	if !n.IsValid() {
+		t.Fatalf("unexpected invalid node: %v", n.Error())
+	}
+	var titles []string
+	for _, elem := range n.Array() {
+		titles = append(titles, elem.Get("t").String())
+	}
+	return titles
+}
+
+func TestSortBy(t *testing.T) {
+	root, err := Parse([]byte(sortByDoc))
+	if err != nil {
+		t.Fatalf("Parse failed: %v", err)
+	}
+	books := root.Get("books")
+
+	cases := []struct {
+		path string
+		desc bool
+		want []string
+	}{
+		// Numbers; C has no price and E a string, they keep their order.
+		{"price", false, []string{"F", "B", "A", "D", "C", "E"}},
+		{"/price", true, []string{"A", "D", "B", "F", "C", "E"}},
+		// Strings, byte-wise; D has no name.
+		{"author/name", false, []string{"E", "B", "F", "C", "A", "D"}},
+		{"/author/name", true, []string{"A", "C", "B", "F", "E", "D"}},
+		{"t", true, []string{"F", "E", "D", "C", "B", "A"}},
+		{"missing", false, []string{"A", "B", "C", "D", "E", "F"}},
+	}
+	for _, tc := range cases {
+		if got := sortedTitles(t, books.SortBy(tc.path, tc.desc)); !reflect.DeepEqual(got, tc.want) {
+			t.Errorf("SortBy(%q, %v) = %q, want %q", tc.path, tc.desc, got, tc.want)
+		}
+	}
+
+	// The document keeps its order, also after writes through the result.
+	sorted := books.SortBy("price", false)
+	sorted.Index(0).Set("seen", true)
+	if got := sortedTitles(t, root.Query("/books")); !reflect.DeepEqual(got, []string{"A", "B", "C", "D", "E", "F"}) {
+		t.Errorf("document order changed: %q", got)
+	}
+	if !root.Query("/books[5]/seen").Bool() {
+		t.Error("expected the write through the sorted result to reach the document")
+	}
+}
+
+func TestSortByPathMixedTypes(t *testing.T) {
+	root, err := Parse([]byte(`[{"k":"b"},{"k":2},{"x":1},{"k":"a"},{"k":true},{"k":"c"}]`))
+	if err != nil {
+		t.Fatalf("Parse failed: %v", err)
+	}
+	sorted := sortByPath(root.Array(), "k", false)
+	var got []string
+	for _, elem := range sorted {
+		got = append(got, elem.String())
+	}
+	want := []string{`{"k":"a"}`, `{"k":"b"}`, `{"k":"c"}`, `{"k":2}`, `{"x":1}`, `{"k":true}`}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("sortByPath = %q, want %q", got, want)
+	}
+}
+
+func TestSortByTopN(t *testing.T) {
+	root, err := Parse([]byte(sortByDoc))
+	if err != nil {
+		t.Fatalf("Parse failed: %v", err)
+	}
+	books := root.Get("books")
+	if got := sortedTitles(t, books.SortBy("price", true).Limit(3)); !reflect.DeepEqual(got, []string{"A", "D", "B"}) {
+		t.Errorf("top 3 = %q", got)
+	}
+	if got := books.SortBy("price", false).Query("[0:2]/t").Strings(); !reflect.DeepEqual(got, []string{"F", "B"}) {
+		t.Errorf("cheapest 2 = %q", got)
+	}
+	if got := root.Query("/books[*]/price").SortBy("", false).Strings(); !reflect.DeepEqual(got, []string{"-1", "8.5", "12", "12", "9"}) {
+		t.Errorf("sorted prices = %q", got)
+	}
+}
+
+func TestSortByOnOtherNodes(t *testing.T) {
+	root, err := Parse([]byte(sortByDoc))
+	if err != nil {
+		t.Fatalf("Parse failed: %v", err)
+	}
+	if got := root.SortBy("price", false); got.IsValid() || !errors.Is(got.Error(), core.ErrTypeAssertion) {
+		t.Errorf("SortBy on an object = %v", got.Error())
+	}
+	missing := root.Get("missing")
+	if got := missing.SortBy("price", false); got.IsValid() || got.Error() != missing.Error() {
+		t.Errorf("SortBy on an invalid node = %v", got.Error())
+	}
+	empty, _ := Parse([]byte(`[]`))
+	if got := empty.SortBy("x", true); !got.IsValid() || got.Len() != 0 {
+		t.Errorf("SortBy on an empty array = %v", got)
+	}
+}
@@ -0,0 +1,312 @@
+package engine
+
+import (
+	"bytes"
+	"io"
+
+	"github.com/474420502/xjson/internal/core"
+)
+
+// Serialization of a modified container splices its source bytes: the text
+// around members and elements, their keys and every value that was not
+// written to are copied as they are, and only replaced values are encoded
+// anew. A value whose node still points into the source is skipped by its
+// length, so only the source of replaced and removed values is scanned.
+// Each container reads its source before writing any of it, so that the
+// output can go straight to a stream.
+
+// jsonWriter is where a value is encoded: a bytes.Buffer for Bytes, or a
+// streamWriter for WriteTo.
+type jsonWriter interface {
+	io.Writer
+	io.ByteWriter
+	io.StringWriter
+}
+
+// newSpliceBuffer returns a buffer for re-encoding a container from source,
+// with room for the source and for edits that make it grow a little.
+func newSpliceBuffer(source []byte) *bytes.Buffer {
+	buf := new(bytes.Buffer)
+	buf.Grow(len(source) + len(source)/8)
+	return buf
+}
+
+// writeJSON appends the encoding of the object to buf.
+func (n *objectNode) writeJSON(buf jsonWriter) {
+	if n.isPristine() {
+		buf.Write(n.RawBytes())
+		return
+	}
+	n.lazyParse()
+	if n.err != nil {
+		return
+	}
+	if len(n.raw) > 0 && n.writeSpliced(buf) {
+		return
+	}
+	buf.WriteByte('{')
+	for i, k := range n.documentKeys() {
+		if i > 0 {
+			buf.WriteByte(',')
+		}
+		writeJSONString(buf, k)
+		buf.WriteByte(':')
+		writeJSONValue(buf, n.value[k])
+	}
+	buf.WriteByte('}')
+}
+
+// writeSpliced encodes the object over its source. Members keep their place
+// and the text around them; a repeated key is written where it first
+// appears, with the value that counts. Keys added since come last, separated
+// like the last source members. It reports false, having written nothing,
+// when the source cannot be read as an object.
+func (n *objectNode) writeSpliced(buf jsonWriter) bool {
+	src := n.RawBytes()
+	pos := skipSpace(src, 0)
+	if pos >= len(src) || src[pos] != '{' {
+		return false
+	}
+	open := pos + 1
+	pos = skipSpace(src, open)
+	first := pos
+
+	type splicedMember struct {
+		sep, head, raw []byte
+		same           bool
+		child          core.Node
+	}
+	var members []splicedMember
+	sep, colon := []byte{','}, []byte{':'}
+	placed := make(map[string]bool, len(n.value))
+	prevEnd := -1
+	for pos < len(src) && src[pos] != '}' {
+		keyStart := pos
+		keyEnd := findMatchingQuote(src, keyStart)
+		if keyEnd < 0 {
+			return false
+		}
+		valueStart := skipSpace(src, keyEnd+1)
+		if valueStart >= len(src) || src[valueStart] != ':' {
+			return false
+		}
+		valueStart = skipSpace(src, valueStart+1)
+
+		key := src[keyStart+1 : keyEnd]
+		if bytes.IndexByte(key, '\\') >= 0 {
+			unescaped, err := unescape(key)
+			if err != nil {
+				return false
+			}
+			key = unescaped
+		}
+		child, ok := n.value[string(key)]
+		valueEnd, same := sourceSpan(src, valueStart, child)
+		if !same {
+			if valueEnd = rawValueEnd(src, valueStart) + 1; valueEnd <= valueStart {
+				return false
+			}
+		}
+		if prevEnd >= 0 {
+			sep = src[prevEnd:keyStart]
+		}
+		colon = src[keyEnd+1 : valueStart]
+
+		if ok && !placed[string(key)] {
+			placed[string(key)] = true
+			members = append(members, splicedMember{sep, src[keyStart:valueStart], src[valueStart:valueEnd], same, child})
+		}
+		prevEnd = valueEnd
+		pos = skipSpace(src, valueEnd)
+		if pos < len(src) && src[pos] == ',' {
+			pos = skipSpace(src, pos+1)
+		}
+	}
+	if pos >= len(src) {
+		return false
+	}
+
+	if len(n.value) == 0 && prevEnd >= 0 {
+		// Every member was deleted: keep the space before the brace only.
+		first = open
+	}
+	buf.Write(src[:first])
+	for i, m := range members {
+		if i > 0 {
+			buf.Write(m.sep)
+		}
+		buf.Write(m.head)
+		writeSplicedValue(buf, m.raw, m.same, m.child)
+	}
+	if written := len(members); written < len(n.value) {
+		for _, k := range n.documentKeys() {
+			if placed[k] {
+				continue
+			}
+			placed[k] = true
+			if written > 0 {
+				buf.Write(sep)
+			}
+			written++
+			writeJSONString(buf, k)
+			buf.Write(colon)
+			writeJSONValue(buf, n.value[k])
+		}
+	}
+	if prevEnd < 0 {
+		prevEnd = pos
+	}
+	buf.Write(src[prevEnd:skipSpace(src, pos+1)])
+	return true
+}
+
+// writeJSON appends the encoding of the array to buf.
+func (n *arrayNode) writeJSON(buf jsonWriter) {
+	if n.isPristine() {
+		buf.Write(n.RawBytes())
+		return
+	}
+	n.lazyParse()
+	if n.err != nil {
+		return
+	}
+	if len(n.raw) > 0 && !n.matchSet && !n.selection && n.writeSpliced(buf) {
+		return
+	}
+	buf.WriteByte('[')
+	for i, v := range n.value {
+		if i > 0 {
+			buf.WriteByte(',')
+		}
+		writeJSONValue(buf, v)
+	}
+	buf.WriteByte(']')
+}
+
+// writeSpliced encodes the array over its source. Elements still found in
+// the source keep their separators; an element that is not takes the place
+// of the source elements up to the next one that is, and elements past the
+// last of them are separated like the last source elements. It reports
+// false, having written nothing, when the source cannot be read as an
+// array.
+func (n *arrayNode) writeSpliced(buf jsonWriter) bool {
+	src := n.RawBytes()
+	pos := skipSpace(src, 0)
+	if pos >= len(src) || src[pos] != '[' {
+		return false
+	}
+	open := pos + 1
+	pos = skipSpace(src, open)
+	first := pos
+
+	// raw is the source of an element that still holds it, nil for one
+	// that is encoded anew.
+	type splicedElement struct {
+		sep, raw []byte
+		child    core.Node
+	}
+	elems := make([]splicedElement, 0, len(n.value))
+	sep := []byte{','}
+	next := 0
+	prevEnd := -1
+	for pos < len(src) && src[pos] != ']' {
+		if prevEnd >= 0 {
+			sep = src[prevEnd:pos]
+		}
+		// Elements that are not source elements from here on were added
+		// or set in place of the ones before the next that is.
+		for next < len(n.value) {
+			if off, ok := sourceOffsetOf(src, n.value[next]); ok && off >= pos {
+				break
+			}
+			elems = append(elems, splicedElement{sep, nil, n.value[next]})
+			next++
+		}
+		end := -1
+		same := false
+		if next < len(n.value) {
+			end, same = sourceSpan(src, pos, n.value[next])
+		}
+		if same {
+			elems = append(elems, splicedElement{sep, src[pos:end], n.value[next]})
+			next++
+		} else if end = rawValueEnd(src, pos) + 1; end <= pos {
+			return false
+		}
+		prevEnd = end
+		pos = skipSpace(src, end)
+		if pos < len(src) && src[pos] == ',' {
+			pos = skipSpace(src, pos+1)
+		}
+	}
+	if pos >= len(src) {
+		return false
+	}
+	for ; next < len(n.value); next++ {
+		elems = append(elems, splicedElement{sep, nil, n.value[next]})
+	}
+
+	if len(elems) == 0 && prevEnd >= 0 {
+		first = open
+	}
+	buf.Write(src[:first])
+	for i, e := range elems {
+		if i > 0 {
+			buf.Write(e.sep)
+		}
+		writeSplicedValue(buf, e.raw, e.raw != nil, e.child)
+	}
+	if prevEnd < 0 {
+		prevEnd = pos
+	}
+	buf.Write(src[prevEnd:skipSpace(src, pos+1)])
+	return true
+}
+
+// writeSplicedValue appends a member or element value. raw is its source
+// when same reports that child still holds it; only a modified container
+// among those needs encoding.
+func writeSplicedValue(buf jsonWriter, raw []byte, same bool, child core.Node) {
+	if same && !isDirtyContainer(child) {
+		buf.Write(raw)
+		return
+	}
+	writeJSONValue(buf, child)
+}
+
+// sourceSpan reports whether child holds the value that starts at pos in
+// src, and where that value ends.
+func sourceSpan(src []byte, pos int, child core.Node) (int, bool) {
+	bn := nodeBase(child)
+	if bn == nil {
+		return -1, false
+	}
+	off, ok := sourceOffset(src, bn.raw)
+	if !ok || off != pos || off+len(bn.raw) > len(src) {
+		return -1, false
+	}
+	return off + len(bn.raw), true
+}
+
+// sourceOffsetOf returns where child's source starts in src.
+func sourceOffsetOf(src []byte, child core.Node) (int, bool) {
+	bn := nodeBase(child)
+	if bn == nil {
+		return 0, false
+	}
+	return sourceOffset(src, bn.raw)
+}
+
+// skipSpace returns the first position at or after pos in data that is not
+// JSON whitespace.
+func skipSpace(data []byte, pos int) int {
+	for pos < len(data) {
+		switch data[pos] {
+		case ' ', '\t', '\n', '\r':
+			pos++
+		default:
+			return pos
+		}
+	}
+	return pos
+}
@@ -0,0 +1,200 @@
+package engine
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/474420502/xjson/internal/core"
+)
+
+// largeDoc returns an indented document of about size bytes whose "user"
+// member sits between a long "items" array and a few trailing members. The
+// values spell numbers and strings in ways a re-encoding would change.
+func largeDoc(size int) []byte {
+	var b strings.Builder
+	b.WriteString("{\n  \"version\": 1.0,\n  \"items\": [\n")
+	for i := 0; b.Len() < size; i++ {
+		if i > 0 {
+			b.WriteString(",\n")
+		}
+		fmt.Fprintf(&b, `    {"id": %d, "label": "caf\u00e9 \/ %d", "price": %d.50, "ratio": 1e2, "tags": ["a", "b"], "z": null, "a": true}`, i, i, i)
+	}
+	b.WriteString("\n  ],\n  \"user\": {\n    \"name\": \"ann\",\n    \"email\": \"ann\\u0040example.com\"\n  },\n  \"zone\": \"UTC\"\n}")
+	return []byte(b.String())
+}
+
+func TestBytesAfterSetKeepsUntouchedSource(t *testing.T) {
+	doc := largeDoc(5 << 20)
+	want := bytes.Replace(doc, []byte(`"name": "ann"`), []byte(`"name": "bob"`), 1)
+	for name, parse := range testParsers {
+		t.Run(name, func(t *testing.T) {
+			root, err := parse(doc)
+			if err != nil {
+				t.Fatalf("parse failed: %v", err)
+			}
+			if res := root.SetByPath("/user/name", "bob"); !res.IsValid() {
+				t.Fatalf("SetByPath failed: %v", res.Error())
+			}
+			got, err := root.Bytes()
+			if err != nil {
+				t.Fatalf("Bytes failed: %v", err)
+			}
+			if !bytes.Equal(got, want) {
+				i := 0
+				for i < len(got) && i < len(want) && got[i] == want[i] {
+					i++
+				}
+				t.Fatalf("output differs from the source at byte %d of %d: got %.60q, want %.60q", i, len(want), got[i:], want[i:])
+			}
+			if root.String() != string(want) {
+				t.Fatalf("String() differs from Bytes()")
+			}
+		})
+	}
+}
+
+const spliceDoc = `{
+  "b": 1,
+  "a": [1, 2.0, "\u00e9"],
+  "c": {"x": "\/", "y": 1e0}
+}`
+
+func TestBytesAfterEditSplicesSource(t *testing.T) {
+	testCases := []struct {
+		name string
+		edit func(root core.Node) core.Node
+		want string
+	}{
+		{"set scalar", func(root core.Node) core.Node { return root.Set("b", 2) },
+			"{\n  \"b\": 2,\n  \"a\": [1, 2.0, \"\\u00e9\"],\n  \"c\": {\"x\": \"\\/\", \"y\": 1e0}\n}"},
+		{"replace container", func(root core.Node) core.Node { return root.Set("c", []interface{}{true}) },
+			"{\n  \"b\": 1,\n  \"a\": [1, 2.0, \"\\u00e9\"],\n  \"c\": [true]\n}"},
+		{"nested set", func(root core.Node) core.Node { return root.Get("c").Set("y", "new") },
+			"{\n  \"b\": 1,\n  \"a\": [1, 2.0, \"\\u00e9\"],\n  \"c\": {\"x\": \"\\/\", \"y\": \"new\"}\n}"},
+		{"add key", func(root core.Node) core.Node { return root.Set("d", nil) },
+			"{\n  \"b\": 1,\n  \"a\": [1, 2.0, \"\\u00e9\"],\n  \"c\": {\"x\": \"\\/\", \"y\": 1e0},\n  \"d\": null\n}"},
+		{"delete first key", func(root core.Node) core.Node { return root.Delete("b") },
+			"{\n  \"a\": [1, 2.0, \"\\u00e9\"],\n  \"c\": {\"x\": \"\\/\", \"y\": 1e0}\n}"},
+		{"delete middle key", func(root core.Node) core.Node { return root.Delete("a") },
+			"{\n  \"b\": 1,\n  \"c\": {\"x\": \"\\/\", \"y\": 1e0}\n}"},
+		{"delete last key", func(root core.Node) core.Node { return root.Delete("c") },
+			"{\n  \"b\": 1,\n  \"a\": [1, 2.0, \"\\u00e9\"]\n}"},
+		{"append", func(root core.Node) core.Node { return root.Get("a").Append(3) },
+			"{\n  \"b\": 1,\n  \"a\": [1, 2.0, \"\\u00e9\", 3],\n  \"c\": {\"x\": \"\\/\", \"y\": 1e0}\n}"},
+		{"set index", func(root core.Node) core.Node { return root.Get("a").SetIndex(1, "two") },
+			"{\n  \"b\": 1,\n  \"a\": [1, \"two\", \"\\u00e9\"],\n  \"c\": {\"x\": \"\\/\", \"y\": 1e0}\n}"},
+		{"insert first", func(root core.Node) core.Node { return root.Get("a").InsertAt(0, 0) },
+			"{\n  \"b\": 1,\n  \"a\": [0,1, 2.0, \"\\u00e9\"],\n  \"c\": {\"x\": \"\\/\", \"y\": 1e0}\n}"},
+		{"delete first element", func(root core.Node) core.Node { return root.Get("a").Delete("0") },
+			"{\n  \"b\": 1,\n  \"a\": [2.0, \"\\u00e9\"],\n  \"c\": {\"x\": \"\\/\", \"y\": 1e0}\n}"},
+		{"delete last element", func(root core.Node) core.Node { return root.Get("a").Delete("2") },
+			"{\n  \"b\": 1,\n  \"a\": [1, 2.0],\n  \"c\": {\"x\": \"\\/\", \"y\": 1e0}\n}"},
+	}
+	for _, tc := range testCases {
+		for name, parse := range testParsers {
+			t.Run(tc.name+"/"+name, func(t *testing.T) {
+				root, err := parse([]byte(spliceDoc))
+				if err != nil {
+					t.Fatalf("parse failed: %v", err)
+				}
+				if res := tc.edit(root); !res.IsValid() {
+					t.Fatalf("edit failed: %v", res.Error())
+				}
+				got, err := root.Bytes()
+				if err != nil {
+					t.Fatalf("Bytes failed: %v", err)
+				}
+				if string(got) != tc.want {
+					t.Fatalf("got\n%s\nwant\n%s", got, tc.want)
+				}
+				reparsed, err := MustParse(got)
+				if err != nil {
+					t.Fatalf("output does not parse: %v", err)
+				}
+				if !Equal(reparsed, root) {
+					t.Fatalf("output reads back as %s", reparsed.Canonical())
+				}
+			})
+		}
+	}
+}
+
+func TestBytesAfterEditKeepsSurroundingSpace(t *testing.T) {
+	root, err := Parse([]byte("{ \"a\": 1 , \"b\": [ ] }\n"))
+	if err != nil {
+		t.Fatalf("Parse failed: %v", err)
+	}
+	root.Get("b").Append(1)
+	if got, want := root.String(), "{ \"a\": 1 , \"b\": [ 1] }\n"; got != want {
+		t.Fatalf("got %q, want %q", got, want)
+	}
+	root.Delete("a")
+	root.Delete("b")
+	if got, want := root.String(), "{ }\n"; got != want {
+		t.Fatalf("got %q, want %q", got, want)
+	}
+}
+
+func TestBytesAfterEditWritesRepeatedKeysOnce(t *testing.T) {
+	testCases := []struct {
+		policy DuplicateKeyPolicy
+		want   string
+	}{
+		{LastWins, `{"a":3, "b":5}`},
+		{FirstWins, `{"a":1, "b":5}`},
+	}
+	for _, tc := range testCases {
+		root, err := ParseWithOptions([]byte(`{"a":1, "b":2, "a":3}`), ParseOptions{DuplicateKeys: tc.policy})
+		if err != nil {
+			t.Fatalf("Parse failed: %v", err)
+		}
+		root.Set("b", 5)
+		if got := root.String(); got != tc.want {
+			t.Fatalf("policy %v: got %s, want %s", tc.policy, got, tc.want)
+		}
+	}
+}
+
+// BenchmarkBytesAfterEdit serializes a 5MB document after replacing a value
+// with items of growing size. Beyond copying the source, which every case
+// pays, ns/op follows the size of the new value; "rewrite" replaces the whole
+// items array and shows what re-encoding the document costs.
+func BenchmarkBytesAfterEdit(b *testing.B) {
+	doc := largeDoc(5 << 20)
+	var source struct {
+		Items []interface{} `json:"items"`
+	}
+	if err := json.Unmarshal(doc, &source); err != nil {
+		b.Fatal(err)
+	}
+	edits := []struct {
+		name  string
+		path  string
+		value interface{}
+	}{
+		{"items=1", "/user/name", source.Items[:1]},
+		{"items=100", "/user/name", source.Items[:100]},
+		{"items=5000", "/user/name", source.Items[:5000]},
+		{"rewrite", "/items", source.Items},
+	}
+	for _, edit := range edits {
+		root, err := Parse(doc)
+		if err != nil {
+			b.Fatal(err)
+		}
+		if res := root.SetByPath(edit.path, edit.value); !res.IsValid() {
+			b.Fatal(res.Error())
+		}
+		b.Run(edit.name, func(b *testing.B) {
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				if _, err := root.Bytes(); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
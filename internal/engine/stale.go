@@ -0,0 +1,65 @@
+package engine
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/474420502/xjson/internal/core"
+)
+
+// detach marks node, which a write is about to replace or remove, and the nodes
+// below it that were handed out with an error wrapping core.ErrStaleResult,
+// so that handles held from before the write fail instead of silently
+// showing values that are no longer in the document. Scalars updated in
+// place are not detached.
+func detach(node core.Node) {
+	bn := nodeBase(node)
+	if bn == nil || bn.err != nil {
+		return
+	}
+	err := fmt.Errorf("%s was replaced or removed: %w", node.Path(), core.ErrStaleResult)
+	markStale(node, err)
+}
+
+func markStale(node core.Node, err error) {
+	switch typed := node.(type) {
+	case *objectNode:
+		for _, child := range typed.value {
+			markStale(child, err)
+		}
+	case *arrayNode:
+		for _, child := range typed.value {
+			if child != nil {
+				markStale(child, err)
+			}
+		}
+	}
+	if bn := nodeBase(node); bn != nil && bn.err == nil {
+		bn.err = err
+	}
+}
+
+// checkMatches gives a match set the error of a match that a write has
+// replaced or removed since the query ran, so that the set fails as a whole
+// instead of rendering without it.
+func (n *arrayNode) checkMatches() {
+	if !(n.matchSet || n.selection) || n.err != nil {
+		return
+	}
+	for _, match := range n.value {
+		if bn := nodeBase(match); bn != nil && errors.Is(bn.err, core.ErrStaleResult) {
+			n.err = bn.err
+			return
+		}
+	}
+}
+
+func (n *arrayNode) IsValid() bool {
+	n.checkMatches()
+	return n.err == nil
+}
+
+func (n *arrayNode) Error() error {
+	n.checkMatches()
+	return n.baseNode.Error()
+}
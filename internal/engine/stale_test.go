@@ -0,0 +1,144 @@
+package engine
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/474420502/xjson/internal/core"
+)
+
+const staleDoc = `{"posts":[{"t":1},{"t":2},{"t":3}],"user":{"age":1,"tags":["a"]}}`
+
+func assertStale(t *testing.T, what string, n core.Node) {
+	t.Helper()
+	if n.IsValid() || n.Exists() || !errors.Is(n.Error(), core.ErrStaleResult) {
+		t.Errorf("%s: IsValid() = %v, Error() = %v, want ErrStaleResult", what, n.IsValid(), n.Error())
+	}
+	if s := n.String(); s != "" {
+		t.Errorf("%s: String() = %q, want no text", what, s)
+	}
+}
+
+func TestHandlesStayLiveAcrossMaterialization(t *testing.T) {
+	forEachParser(t, staleDoc, func(t *testing.T, root core.Node) {
+		posts := root.Get("posts")
+		second := root.Query("/posts[1]")
+		age := root.Query("/user/age")
+
+		// Writes elsewhere materialize the root and the posts array.
+		root.SetByPath("/user/age", 25)
+		posts.Append(map[string]interface{}{"t": 4})
+		second.Set("t", 20)
+
+		if got := root.Query("/posts").Len(); got != 4 || posts.Len() != 4 {
+			t.Errorf("posts Len: document %d, held %d, want 4", got, posts.Len())
+		}
+		if age.Int() != 25 {
+			t.Errorf("held age = %d, want 25: scalars are updated in place", age.Int())
+		}
+		want := `{"posts":[{"t":1},{"t":20},{"t":3},{"t":4}],"user":{"age":25,"tags":["a"]}}`
+		if got := root.String(); got != want {
+			t.Errorf("document = %s, want %s", got, want)
+		}
+		if got := second.Path(); got != "/posts[1]" {
+			t.Errorf("held element path = %q", got)
+		}
+	})
+}
+
+func TestQueryOrderDoesNotChangeResults(t *testing.T) {
+	forEachParser(t, staleDoc, func(t *testing.T, root core.Node) {
+		before := root.Query("/posts[*]/t").Len()
+		root.SetByPath("/user/age", 25)
+		after := root.Query("/posts[*]/t").Len()
+
+		other, err := Parse([]byte(staleDoc))
+		if err != nil {
+			t.Fatalf("Parse failed: %v", err)
+		}
+		other.SetByPath("/user/age", 25)
+		if first := other.Query("/posts[*]/t").Len(); before != 3 || after != 3 || first != 3 {
+			t.Errorf("counts before/after Set = %d/%d, Set first = %d, want 3", before, after, first)
+		}
+		if root.String() != other.String() {
+			t.Errorf("documents differ: %s vs %s", root.String(), other.String())
+		}
+	})
+}
+
+func TestReplacedAndRemovedHandlesAreStale(t *testing.T) {
+	forEachParser(t, staleDoc, func(t *testing.T, root core.Node) {
+		user := root.Get("user")
+		tags := root.Query("/user/tags")
+		tag := root.Query("/user/tags[0]")
+		first := root.Query("/posts[0]")
+		third := root.Query("/posts[2]")
+
+		root.Set("user", map[string]interface{}{"age": 25})
+		assertStale(t, "replaced object", user)
+		assertStale(t, "child of replaced object", tags)
+		assertStale(t, "grandchild of replaced object", tag)
+		if err := user.Error(); err.Error() != "/user was replaced or removed: stale result" {
+			t.Errorf("error = %q", err)
+		}
+
+		// Writes through a stale handle do not reach the document.
+		if r := user.Set("age", 3); r.IsValid() {
+			t.Error("Set on a stale handle should return an invalid node")
+		}
+		user.Get("tags").Append("b")
+		if got := root.Get("user").String(); got != `{"age":25}` {
+			t.Errorf("document user = %s after writes through a stale handle", got)
+		}
+
+		root.Get("posts").Delete("0")
+		assertStale(t, "deleted element", first)
+		if third.Get("t").Int() != 3 || third.Path() != "/posts[1]" {
+			t.Errorf("later element: t = %d, path %q, want it live at /posts[1]", third.Get("t").Int(), third.Path())
+		}
+
+		// Replacing a scalar with another type replaces the node.
+		age := root.Query("/user/age")
+		root.SetByPath("/user/age", "old")
+		assertStale(t, "scalar replaced by a string", age)
+	})
+}
+
+func TestSetValueAndSetIndexDetachTheOldNode(t *testing.T) {
+	forEachParser(t, staleDoc, func(t *testing.T, root core.Node) {
+		tags := root.Query("/user/tags")
+		replacement := tags.SetValue([]interface{}{"x", "y"})
+		assertStale(t, "SetValue receiver", tags)
+		if replacement.Len() != 2 || root.Query("/user/tags[1]").String() != "y" {
+			t.Errorf("replacement = %s", replacement.String())
+		}
+
+		second := root.Query("/posts[1]")
+		root.Get("posts").SetIndex(1, "gone")
+		assertStale(t, "SetIndex target", second)
+	})
+}
+
+func TestMatchSetsAreSnapshots(t *testing.T) {
+	forEachParser(t, staleDoc, func(t *testing.T, root core.Node) {
+		ts := root.Query("/posts[*]/t")
+		root.Get("posts").Append(map[string]interface{}{"t": 4})
+		root.Query("/posts[0]").Set("t", 10)
+		// A new element does not join the snapshot; an updated one shows.
+		if ts.Len() != 3 || !ts.IsValid() || ts.Index(0).Int() != 10 {
+			t.Errorf("match set after Append = %s (Len %d)", ts.String(), ts.Len())
+		}
+
+		root.Get("posts").Delete("1")
+		assertStale(t, "match set with a removed match", ts)
+		if _, err := ts.Bytes(); !errors.Is(err, core.ErrStaleResult) {
+			t.Errorf("Bytes() error = %v, want ErrStaleResult", err)
+		}
+		if ts.HasMatches() {
+			t.Error("a stale match set should report no matches")
+		}
+		if got := root.Query("/posts[*]/t").String(); got != "[10,3,4]" {
+			t.Errorf("fresh query = %s", got)
+		}
+	})
+}
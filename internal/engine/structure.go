@@ -0,0 +1,106 @@
+package engine
+
+import (
+	"bytes"
+	"fmt"
+	"strconv"
+
+	"github.com/474420502/xjson/internal/core"
+)
+
+// builtinKeys implements keys() and [@keys]: a new array of the keys of an
+// object in document order, or of the indices of an array as strings.
+func builtinKeys(node core.Node, args ...core.Arg) core.Node {
+	var buf bytes.Buffer
+	buf.WriteByte('[')
+	err := eachMember("keys", node, args, func(key string, _ core.Node) {
+		if buf.Len() > 1 {
+			buf.WriteByte(',')
+		}
+		writeJSONString(&buf, key)
+	})
+	if err != nil {
+		return newInvalidNode(err)
+	}
+	buf.WriteByte(']')
+	return NewArrayNode(nil, buf.Bytes(), node.GetFuncs())
+}
+
+// builtinValues implements values() and [@values]: a match set of the
+// member values of an object in document order, or of the elements of an
+// array. The values are the document's own nodes.
+func builtinValues(node core.Node, args ...core.Arg) core.Node {
+	var values []core.Node
+	err := eachMember("values", node, args, func(_ string, value core.Node) {
+		values = append(values, value)
+	})
+	if err != nil {
+		return newInvalidNode(err)
+	}
+	if values == nil {
+		values = []core.Node{}
+	}
+	return newMatchSet(node, values, node.GetFuncs())
+}
+
+// builtinEntries implements entries() and [@entries]: a new array of
+// {"key": ..., "value": ...} objects, one per member of an object in
+// document order or per element of an array, keyed by its index as a
+// string. The values are copies.
+func builtinEntries(node core.Node, args ...core.Arg) core.Node {
+	var buf bytes.Buffer
+	buf.WriteByte('[')
+	err := eachMember("entries", node, args, func(key string, value core.Node) {
+		if buf.Len() > 1 {
+			buf.WriteByte(',')
+		}
+		buf.WriteString(`{"key":`)
+		writeJSONString(&buf, key)
+		buf.WriteString(`,"value":`)
+		writeJSONValue(&buf, value)
+		buf.WriteByte('}')
+	})
+	if err != nil {
+		return newInvalidNode(err)
+	}
+	buf.WriteByte(']')
+	return NewArrayNode(nil, buf.Bytes(), node.GetFuncs())
+}
+
+// eachMember calls fn with the key and value of every member of an object,
+// or with the index and value of every element of an array, for the
+// built-in function name. On a match set or slice it visits the members of
+// each match in turn, so //config/keys() lists the keys of every config.
+func eachMember(name string, node core.Node, args []core.Arg, fn func(key string, value core.Node)) error {
+	if len(args) > 0 {
+		return fmt.Errorf("function '%s' takes no arguments, got %d", name, len(args))
+	}
+	if arr, ok := node.(*arrayNode); ok && (arr.matchSet || arr.selection) {
+		for _, match := range arr.value {
+			if err := members(name, match, fn); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	return members(name, node, fn)
+}
+
+func members(name string, node core.Node, fn func(key string, value core.Node)) error {
+	if err := node.Error(); err != nil {
+		return err
+	}
+	switch n := node.(type) {
+	case *objectNode:
+		for _, key := range n.documentKeys() {
+			fn(key, n.value[key])
+		}
+	case *arrayNode:
+		for i, elem := range n.UnsafeArray() {
+			fn(strconv.Itoa(i), elem)
+		}
+	default:
+		return fmt.Errorf("function '%s' needs an object or array, got %s", name, node.Type())
+	}
+	return nil
+}
@@ -0,0 +1,108 @@
+package engine
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/474420502/xjson/internal/core"
+)
+
+const structureDoc = `{
+	"config": {"features": {"sso":true,"beta":{"on":false},"limit":5}},
+	"auth": {"oauth2": {"google": {"id":"g"}, "github": {"id":"h"}}},
+	"tenants": [{"name": "a", "oauth2": {"okta": {"id":"o"}}}, {"name": "b"}],
+	"items": [{"id":1,"tag":"x"},{"id":2},{"id":3,"tag":"y"}]
+}`
+
+func TestStructureFunctions(t *testing.T) {
+	cases := []struct {
+		path string
+		want string
+	}{
+		{"/config/features/keys()", `["sso","beta","limit"]`},
+		{"/config/features[@keys]", `["sso","beta","limit"]`},
+		{"/config/features/values()", `[true,{"on":false},5]`},
+		{"/config/features/entries()", `[{"key":"sso","value":true},{"key":"beta","value":{"on":false}},{"key":"limit","value":5}]`},
+		{"/items/keys()", `["0","1","2"]`},
+		{"/items/values()", `[{"id":1,"tag":"x"},{"id":2},{"id":3,"tag":"y"}]`},
+		{"/config/features/keys()[1]", `beta`},
+		{"/config/features/values()/on", `false`},
+		{"/config/keys()", `["features"]`},
+		// After recursive descent, a filter, a wildcard and a slice the
+		// members of every match are listed in document order.
+		{"//oauth2/keys()", `["google","github","okta"]`},
+		{"//oauth2/values()/id", `["g","h","o"]`},
+		{"/items[?(@.id > 1)]/keys()", `["id","id","tag"]`},
+		{"/items[?(@.tag)]/entries()", `[{"key":"id","value":1},{"key":"tag","value":"x"},{"key":"id","value":3},{"key":"tag","value":"y"}]`},
+		{"/tenants[*]/keys()", `["name","oauth2","name"]`},
+		{"/items[1:]/keys()", `["id","id","tag"]`},
+		{"/items[?(@.id > 9)]/keys()", `[]`},
+	}
+	forEachParser(t, structureDoc, func(t *testing.T, root core.Node) {
+		for _, tc := range cases {
+			if got := root.Query(tc.path).String(); got != tc.want {
+				t.Errorf("%s = %s, want %s", tc.path, got, tc.want)
+			}
+		}
+	})
+}
+
+func TestStructureFunctionErrors(t *testing.T) {
+	root, err := Parse([]byte(structureDoc))
+	if err != nil {
+		t.Fatalf("Parse failed: %v", err)
+	}
+	for path, want := range map[string]string{
+		"/config/features/limit/keys()": "function 'keys' needs an object or array, got number",
+		"/items[*]/tag/values()":        "function 'values' needs an object or array, got string",
+		"/config/features[@entries(1)]": "function 'entries' takes no arguments, got 1",
+		"/config/missing/keys()":        "",
+	} {
+		r := root.Query(path)
+		if r.IsValid() {
+			t.Errorf("%s: expected an invalid result, got %s", path, r.String())
+			continue
+		}
+		if want != "" && !strings.Contains(r.Error().Error(), want) {
+			t.Errorf("%s: error %q, want %q", path, r.Error(), want)
+		}
+	}
+}
+
+func TestStructureFunctionResults(t *testing.T) {
+	root, err := Parse([]byte(structureDoc))
+	if err != nil {
+		t.Fatalf("Parse failed: %v", err)
+	}
+
+	// values() returns the document's nodes, so writes through it show.
+	root.Query("/config/features/values()").Index(1).Set("on", true)
+	if got := root.Query("/config/features/beta/on").Bool(); !got {
+		t.Error("a write through values() should reach the document")
+	}
+
+	// keys() and entries() are new arrays.
+	keys := root.Query("/config/features/keys()")
+	keys.Append("extra")
+	if got := root.Query("/config/features").Len(); got != 3 {
+		t.Errorf("features Len = %d after appending to keys()", got)
+	}
+	if got := keys.Strings(); len(got) != 4 || got[3] != "extra" {
+		t.Errorf("keys = %q", got)
+	}
+
+	// A registered function of the same name takes precedence.
+	root.RegisterFunc("keys", func(n core.Node) core.Node { return NewStringNode(nil, "mine", nil) })
+	if got := root.Query("/config/features/keys()").String(); got != "mine" {
+		t.Errorf("registered keys = %s", got)
+	}
+
+	// A key written like a call is still reachable with brackets.
+	odd, err := Parse([]byte(`{"keys()": 1}`))
+	if err != nil {
+		t.Fatalf("Parse failed: %v", err)
+	}
+	if got := odd.Query(`/['keys()']`).Int(); got != 1 {
+		t.Errorf("quoted key = %d", got)
+	}
+}
@@ -0,0 +1,82 @@
+package engine
+
+import (
+	"math"
+	"sort"
+
+	"github.com/474420502/xjson/internal/core"
+)
+
+// NumericSummary summarizes the numbers among the elements of an array or
+// match set, or the node itself when it is neither. Values that are not
+// numbers, or do not fit a float64, are counted in SkippedCount. The
+// percentiles come from one sort of a copy of the values.
+func (n *baseNode) NumericSummary() core.NumericSummary {
+	var s core.NumericSummary
+	if n.err != nil {
+		return s
+	}
+	self := n.selfOrMe()
+	values := []core.Node{self}
+	if self.Type() == core.Array {
+		values = self.UnsafeArray()
+	}
+
+	nums := make([]float64, 0, len(values))
+	for _, v := range values {
+		f, ok := 0.0, false
+		if v.Type() == core.Number {
+			f, ok = v.RawFloat()
+		}
+		if !ok {
+			s.SkippedCount++
+			continue
+		}
+		nums = append(nums, f)
+	}
+	if len(nums) == 0 {
+		return s
+	}
+	sort.Float64s(nums)
+	s.Count = len(nums)
+	s.Min, s.Max = nums[0], nums[len(nums)-1]
+
+	// The deviation, and the mean when the sum overflows, are taken of the
+	// values divided by the largest magnitude, so that they stay finite near
+	// the float64 limits.
+	scale := math.Max(math.Abs(s.Min), math.Abs(s.Max))
+	if scale == 0 {
+		scale = 1
+	}
+	mean := 0.0
+	for _, f := range nums {
+		s.Sum += f
+		mean += f / scale
+	}
+	mean /= float64(len(nums))
+	if s.Mean = s.Sum / float64(len(nums)); math.IsInf(s.Sum, 0) {
+		s.Mean = mean * scale
+	}
+	variance := 0.0
+	for _, f := range nums {
+		d := f/scale - mean
+		variance += d * d
+	}
+	s.StdDev = math.Sqrt(variance/float64(len(nums))) * scale
+
+	s.P50 = nearestRank(nums, 50)
+	s.P90 = nearestRank(nums, 90)
+	s.P95 = nearestRank(nums, 95)
+	s.P99 = nearestRank(nums, 99)
+	return s
+}
+
+// nearestRank returns the p-th percentile of the sorted values: the value
+// at rank ceil(p/100 * len(sorted)), counting from 1.
+func nearestRank(sorted []float64, p int) float64 {
+	rank := (p*len(sorted) + 99) / 100
+	if rank < 1 {
+		rank = 1
+	}
+	return sorted[rank-1]
+}
@@ -0,0 +1,114 @@
+package engine
+
+import (
+	"fmt"
+	"math"
+	"strings"
+	"testing"
+
+	"github.com/474420502/xjson/internal/core"
+)
+
+func TestNumericSummaryStatistics(t *testing.T) {
+	nums := make([]string, 100)
+	for i := range nums {
+		nums[i] = fmt.Sprint(100 - i)
+	}
+	root, err := Parse([]byte("[" + strings.Join(nums, ",") + "]"))
+	if err != nil {
+		t.Fatalf("Parse failed: %v", err)
+	}
+	got := root.NumericSummary()
+	want := core.NumericSummary{Count: 100, Sum: 5050, Mean: 50.5, Min: 1, Max: 100,
+		StdDev: math.Sqrt(833.25), P50: 50, P90: 90, P95: 95, P99: 99}
+	if math.Abs(got.StdDev-want.StdDev) > 1e-9 {
+		t.Errorf("StdDev = %v, want %v", got.StdDev, want.StdDev)
+	}
+	got.StdDev = want.StdDev
+	if got != want {
+		t.Errorf("NumericSummary() = %+v, want %+v", got, want)
+	}
+
+	// Nearest rank on a short list: P50 of 4 values is the second.
+	root, _ = Parse([]byte(`[4, "x", 1, null, 3.5, true, {"a":1}, [2], 1e400, 2]`))
+	got = root.NumericSummary()
+	want = core.NumericSummary{Count: 4, SkippedCount: 6, Sum: 10.5, Mean: 2.625, Min: 1, Max: 4,
+		StdDev: math.Sqrt(1.421875), P50: 2, P90: 4, P95: 4, P99: 4}
+	if math.Abs(got.StdDev-want.StdDev) > 1e-9 {
+		t.Errorf("StdDev = %v, want %v", got.StdDev, want.StdDev)
+	}
+	got.StdDev = want.StdDev
+	if got != want {
+		t.Errorf("NumericSummary() = %+v, want %+v", got, want)
+	}
+}
+
+func TestNumericSummaryEdgeCases(t *testing.T) {
+	for _, doc := range []string{`[7]`, `7`, `[-0.5]`} {
+		root, _ := MustParse([]byte(doc))
+		got := root.NumericSummary()
+		v := root.Query("[0]").Float()
+		if doc == "7" {
+			v = 7
+		}
+		want := core.NumericSummary{Count: 1, Sum: v, Mean: v, Min: v, Max: v, P50: v, P90: v, P95: v, P99: v}
+		if got != want {
+			t.Errorf("%s: NumericSummary() = %+v, want %+v", doc, got, want)
+		}
+	}
+
+	for _, doc := range []string{`[]`, `["a", null]`, `{"a":1}`} {
+		root, _ := Parse([]byte(doc))
+		if got := root.NumericSummary(); got.Count != 0 || got.Sum != 0 || got.P50 != 0 || got.Min != 0 {
+			t.Errorf("%s: NumericSummary() = %+v, want zero values", doc, got)
+		}
+	}
+	if got := newInvalidNode(core.ErrNotFound).NumericSummary(); got != (core.NumericSummary{}) {
+		t.Errorf("an invalid node summarizes to %+v", got)
+	}
+
+	// Values at the float64 limits keep a finite mean and deviation.
+	root, _ := Parse([]byte(`[1.7976931348623157e308, -1.7976931348623157e308, 1.7976931348623157e308, 5e-324]`))
+	got := root.NumericSummary()
+	if got.Count != 4 || got.Max != math.MaxFloat64 || got.Min != -math.MaxFloat64 || got.P50 != 5e-324 || got.P99 != math.MaxFloat64 {
+		t.Errorf("NumericSummary() = %+v", got)
+	}
+	if got.Sum != math.MaxFloat64 || got.Mean != math.MaxFloat64/4 {
+		t.Errorf("Sum = %v, Mean = %v, want MaxFloat64 and a quarter of it", got.Sum, got.Mean)
+	}
+	if sd := got.StdDev / math.MaxFloat64; math.IsInf(got.StdDev, 0) || math.Abs(sd-math.Sqrt(0.6875)) > 1e-12 {
+		t.Errorf("StdDev = %v, want %v times MaxFloat64", got.StdDev, math.Sqrt(0.6875))
+	}
+	root, _ = Parse([]byte(`[1.7976931348623157e308, 1.7976931348623157e308]`))
+	if got := root.NumericSummary(); !math.IsInf(got.Sum, 1) || got.Mean != math.MaxFloat64 || got.StdDev != 0 {
+		t.Errorf("NumericSummary() = %+v, want an infinite Sum only", got)
+	}
+}
+
+func TestNumericSummaryOfQueries(t *testing.T) {
+	const doc = `{"orders":[
+		{"id":1,"latency":120,"items":[{"qty":1,"price":10},{"qty":3,"price":2.5}]},
+		{"id":2,"latency":80,"items":[{"qty":2,"price":4},{"qty":1,"price":"n/a"}]},
+		{"id":3,"latency":300,"items":[]}
+	]}`
+	forEachParser(t, doc, func(t *testing.T, root core.Node) {
+		if got := root.Query("//price").NumericSummary(); got.Count != 3 || got.SkippedCount != 1 || got.Sum != 16.5 || got.Max != 10 || got.P50 != 4 {
+			t.Errorf("//price = %+v", got)
+		}
+		if got := root.Query("//*[?(@.qty > 1)]/price").NumericSummary(); got.Count != 2 || got.Min != 2.5 || got.Max != 4 || got.Mean != 3.25 {
+			t.Errorf("filtered prices = %+v", got)
+		}
+		if got := root.Query("/orders[*]/latency").NumericSummary(); got.Count != 3 || got.P50 != 120 || got.P99 != 300 || got.Mean != 500.0/3 {
+			t.Errorf("latencies = %+v", got)
+		}
+		if got := root.Query("/orders[?(@.latency >= 100)]/latency").NumericSummary(); got.Count != 2 || got.Sum != 420 || got.P50 != 120 {
+			t.Errorf("filtered latencies = %+v", got)
+		}
+		if got := root.Query("/orders[?(@.latency > 1000)]/latency").NumericSummary(); got != (core.NumericSummary{}) {
+			t.Errorf("an empty match set summarizes to %+v", got)
+		}
+		if got := root.Query("/orders[0]/latency").NumericSummary(); got.Count != 1 || got.Sum != 120 {
+			t.Errorf("a single number summarizes to %+v", got)
+		}
+	})
+}
@@ -0,0 +1,138 @@
+package engine
+
+import (
+	"errors"
+	"strings"
+
+	"github.com/474420502/xjson/internal/core"
+)
+
+// Hints for a path that matched nothing and looks written for the other
+// path syntax: Query takes slash paths and GetCompat gjson dot paths.
+const (
+	dotSyntaxHint   = "path looks like dot syntax; Query takes slash paths such as /a/b/0, GetCompat takes dot paths"
+	slashSyntaxHint = "path looks like slash syntax; GetCompat takes dot paths such as a.b.0, Query takes slash paths"
+)
+
+// hintError is the error of a result that matched nothing, with a hint on
+// the likely cause. It reads as the error it wraps followed by the hint.
+type hintError struct {
+	err  error
+	hint string
+}
+
+func (e *hintError) Error() string { return e.err.Error() + " (hint: " + e.hint + ")" }
+
+func (e *hintError) Unwrap() error { return e.err }
+
+// Hint returns the hint carried by the error of the node, or "". Query and
+// GetCompat give one when a path matching nothing looks written for the
+// other's path syntax; a result that matched never has one.
+func (n *baseNode) Hint() string {
+	var hinted *hintError
+	if errors.As(n.err, &hinted) {
+		return hinted.hint
+	}
+	return ""
+}
+
+// withHint returns an invalid result carrying hint in its error.
+func withHint(result core.Node, hint string) core.Node {
+	return newInvalidNode(&hintError{err: result.Error(), hint: hint})
+}
+
+// looksLikeDotPath reports whether a Query path is probably a dot path: it
+// has no slash, and a dot between two key characters outside brackets and
+// quotes, as in store.book.0.
+func looksLikeDotPath(path string) bool {
+	if strings.IndexByte(path, '/') >= 0 || strings.IndexByte(path, '.') < 0 {
+		return false
+	}
+	depth := 0
+	var quote byte
+	for i := 0; i < len(path); i++ {
+		switch c := path[i]; {
+		case quote != 0:
+			if c == '\\' {
+				i++
+			} else if c == quote {
+				quote = 0
+			}
+		case c == '\'' || c == '"':
+			quote = c
+		case c == '[':
+			depth++
+		case c == ']':
+			depth--
+		case c == '.' && depth == 0 && i > 0 && i < len(path)-1:
+			if isDotKeyChar(path[i-1]) && isDotKeyChar(path[i+1]) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func isDotKeyChar(c byte) bool {
+	return c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' || c == '_' || c == '-' || c == '#' || c >= 0x80
+}
+
+// looksLikeSlashPath reports whether a GetCompat path is probably a slash
+// path: it has a slash that is not escaped and not inside a #(...) query.
+func looksLikeSlashPath(path string) bool {
+	depth := 0
+	for i := 0; i < len(path); i++ {
+		switch path[i] {
+		case '\\':
+			i++
+		case '(':
+			depth++
+		case ')':
+			depth--
+		case '/':
+			if depth == 0 {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// compatSlashAlias rewrites a slash path such as /store/book/0/title or
+// store/book[0]/title as the gjson path store.book.0.title. It reports
+// false unless every step is a plain key, optionally followed by [n]
+// indices, so that the rewrite cannot mean anything else.
+func compatSlashAlias(path string) (string, bool) {
+	trimmed := strings.TrimPrefix(path, "/")
+	if trimmed == "" || !strings.Contains(path, "/") {
+		return "", false
+	}
+	var b strings.Builder
+	for i, seg := range strings.Split(trimmed, "/") {
+		key := seg
+		var indices []string
+		if open := strings.IndexByte(seg, '['); open >= 0 {
+			key = seg[:open]
+			for rest := seg[open:]; rest != ""; {
+				end := strings.IndexByte(rest, ']')
+				if rest[0] != '[' || end < 2 || !isDigits(rest[1:end]) {
+					return "", false
+				}
+				indices = append(indices, rest[1:end])
+				rest = rest[end+1:]
+			}
+		}
+		if key == "" || strings.ContainsAny(key, `.#|@*?\()[]{}!%"'=<>~ `) {
+			return "", false
+		}
+		if i > 0 {
+			b.WriteByte('.')
+		}
+		b.WriteString(key)
+		for _, index := range indices {
+			b.WriteByte('.')
+			b.WriteString(index)
+		}
+	}
+	return b.String(), true
+}
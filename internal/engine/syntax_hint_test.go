@@ -0,0 +1,102 @@
+package engine
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/474420502/xjson/internal/core"
+)
+
+const hintDoc = `{"store":{"book":[{"title":"T","a.b":1}]},"x.y":2,"a/b":3,"links":[{"url":"http://x/y","n":4}]}`
+
+func TestQueryHintsDotSyntax(t *testing.T) {
+	root, err := Parse([]byte(hintDoc))
+	if err != nil {
+		t.Fatalf("Parse failed: %v", err)
+	}
+	for _, path := range []string{"store.book.0.title", "x.y", "store.missing", "a.b[0]"} {
+		result := root.Query(path)
+		if result.IsValid() || result.Hint() != dotSyntaxHint {
+			t.Errorf("Query(%q): valid=%v hint=%q", path, result.IsValid(), result.Hint())
+		}
+		if !strings.Contains(result.Error().Error(), "hint: path looks like dot syntax") {
+			t.Errorf("Query(%q) error %q has no hint", path, result.Error())
+		}
+	}
+
+	// Matching paths, and paths with a slash or with dots only inside
+	// quotes, brackets or filters, get no hint.
+	for _, path := range []string{
+		"/store/book/0/title", "store", "['x.y']", "/store/book[0]/['a.b']",
+		"/missing", "/x.y", "['no.such']", "/store/book[?(@.n == 9)]", "..", "/store/book[0]/a.b",
+	} {
+		if hint := root.Query(path).Hint(); hint != "" {
+			t.Errorf("Query(%q) hint = %q", path, hint)
+		}
+	}
+
+	runMustModes(t, func(t *testing.T, mode MustBehavior) {
+		pathErr := mustFailure(t, mode, root, func() interface{} { return root.MustQuery("store.book") })
+		if !strings.Contains(pathErr.Error(), "dot syntax") {
+			t.Errorf("MustQuery error = %v", pathErr)
+		}
+	})
+}
+
+func TestGetCompatSlashPaths(t *testing.T) {
+	root, err := Parse([]byte(hintDoc))
+	if err != nil {
+		t.Fatalf("Parse failed: %v", err)
+	}
+	// Slash paths are read as their dot form when nothing else matches.
+	for path, want := range map[string]string{
+		"/store/book/0/title":          "T",
+		"store/book/0/title":           "T",
+		"/store/book[0]/title":         "T",
+		"/links/0/n":                   "4",
+		"a/b":                          "3",
+		`links.#(url=="http://x/y").n`: "4",
+	} {
+		result := GetCompat(root, path)
+		if !result.IsValid() || result.Raw() != want || result.Hint() != "" {
+			t.Errorf("GetCompat(%q) = %q, %v, hint %q", path, result.Raw(), result.Error(), result.Hint())
+		}
+	}
+
+	for _, path := range []string{"/store/book/9/title", "/x.y", "/store/book/0/a.b", "/store/book[-1]/title", "/a/b"} {
+		result := GetCompat(root, path)
+		if result.IsValid() || result.Hint() != slashSyntaxHint {
+			t.Errorf("GetCompat(%q): valid=%v hint=%q", path, result.IsValid(), result.Hint())
+		}
+		var pathErr *core.PathError
+		if !errors.As(result.Error(), &pathErr) || pathErr.Op != "GetCompat" {
+			t.Errorf("GetCompat(%q) error = %v", path, result.Error())
+		}
+	}
+
+	for _, path := range []string{"store.missing", `links.#(url=="http://z").n`, `a\/c`} {
+		if result := GetCompat(root, path); result.IsValid() || result.Hint() != "" {
+			t.Errorf("GetCompat(%q): valid=%v hint=%q", path, result.IsValid(), result.Hint())
+		}
+	}
+}
+
+func TestCompatSlashAlias(t *testing.T) {
+	cases := map[string]string{
+		"/a/b/0":         "a.b.0",
+		"a/b":            "a.b",
+		"/a[0][1]/b":     "a.0.1.b",
+		"/ключ/значение": "ключ.значение",
+	}
+	for path, want := range cases {
+		if got, ok := compatSlashAlias(path); !ok || got != want {
+			t.Errorf("compatSlashAlias(%q) = %q, %v, want %q", path, got, ok, want)
+		}
+	}
+	for _, path := range []string{"/", "a", "/a//b", "/a.b/c", "/a/*", "/a[x]", "/a[]", "/a[-1]", "/#/b", "/a b/c"} {
+		if got, ok := compatSlashAlias(path); ok {
+			t.Errorf("compatSlashAlias(%q) = %q, want no alias", path, got)
+		}
+	}
+}
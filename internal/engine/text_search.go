@@ -0,0 +1,75 @@
+package engine
+
+import (
+	"regexp"
+	"strings"
+
+	"github.com/474420502/xjson/internal/core"
+)
+
+// searchedStrings returns the strings the text search helpers look at: a
+// string value, the string elements of an array, and on a match set those
+// of every match. Other values are skipped.
+func searchedStrings(node core.Node) []string {
+	var out []string
+	for _, m := range Matches(node) {
+		switch m.Type() {
+		case core.String:
+			s, _ := m.RawString()
+			out = append(out, s)
+		case core.Array:
+			for _, elem := range m.UnsafeArray() {
+				if elem.Type() == core.String {
+					s, _ := elem.RawString()
+					out = append(out, s)
+				}
+			}
+		}
+	}
+	return out
+}
+
+// ContainsAny reports whether one of the searched strings, the string value
+// or the string elements of an array, contains one of substrs. On a match set
+// it looks at every match. Anything else, or no substrs, gives false.
+func (n *baseNode) ContainsAny(substrs ...string) bool {
+	for _, s := range searchedStrings(n.selfOrMe()) {
+		for _, sub := range substrs {
+			if strings.Contains(s, sub) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// MatchRegexp reports whether pattern matches the string value, one of the
+// string elements of an array or, on a match set, of any match. It fails
+// only for a pattern that does not compile; anything else gives false.
+func (n *baseNode) MatchRegexp(pattern string) (bool, error) {
+	re, err := regexp.Compile(pattern)
+	if err != nil {
+		return false, err
+	}
+	for _, s := range searchedStrings(n.selfOrMe()) {
+		if re.MatchString(s) {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// FindAllMatches returns the substrings pattern matches in the strings
+// MatchRegexp looks at, in document order, or nil. It fails only for a
+// pattern that does not compile.
+func (n *baseNode) FindAllMatches(pattern string) ([]string, error) {
+	re, err := regexp.Compile(pattern)
+	if err != nil {
+		return nil, err
+	}
+	var out []string
+	for _, s := range searchedStrings(n.selfOrMe()) {
+		out = append(out, re.FindAllString(s, -1)...)
+	}
+	return out, nil
+}
@@ -0,0 +1,109 @@
+package engine
+
+import (
+	"reflect"
+	"testing"
+)
+
+const logDoc = `{
+	"level":"error",
+	"msg":"dial tcp 10.0.0.7:5432: connection refused",
+	"tags":["db","retry é",42,null,"timeout"],
+	"code":503,
+	"none":null,
+	"ctx":{"host":"db-1"},
+	"events":[{"msg":"GET /a 200"},{"msg":"GET /b 500"},{"msg":"POST /c 502"},{"code":1}]
+}`
+
+func TestContainsAny(t *testing.T) {
+	root, err := Parse([]byte(logDoc))
+	if err != nil {
+		t.Fatalf("Parse failed: %v", err)
+	}
+	cases := []struct {
+		path    string
+		substrs []string
+		want    bool
+	}{
+		{"/msg", []string{"refused"}, true},
+		{"/msg", []string{"timeout", "refused"}, true},
+		{"/msg", []string{"timeout"}, false},
+		{"/msg", nil, false},
+		{"/tags", []string{"out"}, true},
+		{"/tags", []string{"é"}, true},
+		{"/tags", []string{"42"}, false},
+		{"/code", []string{"503"}, false},
+		{"/none", []string{"null"}, false},
+		{"/ctx", []string{"db"}, false},
+		{"/missing", []string{""}, false},
+		{"/events[*]/msg", []string{" 500"}, true},
+		{"/events[*]/msg", []string{"DELETE"}, false},
+		{"/events[?(@.code)]/msg", []string{""}, false},
+	}
+	for _, tc := range cases {
+		if got := root.Query(tc.path).ContainsAny(tc.substrs...); got != tc.want {
+			t.Errorf("Query(%s).ContainsAny(%q) = %v, want %v", tc.path, tc.substrs, got, tc.want)
+		}
+	}
+}
+
+func TestMatchRegexp(t *testing.T) {
+	root, err := MustParse([]byte(logDoc))
+	if err != nil {
+		t.Fatalf("MustParse failed: %v", err)
+	}
+	cases := []struct {
+		path, pattern string
+		want          bool
+	}{
+		{"/msg", `\d+\.\d+\.\d+\.\d+`, true},
+		{"/msg", `^connection`, false},
+		{"/tags", `^time`, true},
+		{"/tags", `^42$`, false},
+		{"/level", `(?i)ERROR`, true},
+		{"/code", `5`, false},
+		{"/none", `.*`, false},
+		{"/missing", `.*`, false},
+		{"/events[*]/msg", ` 5\d\d$`, true},
+		{"/events[*]/msg", `^PUT`, false},
+	}
+	for _, tc := range cases {
+		got, err := root.Query(tc.path).MatchRegexp(tc.pattern)
+		if err != nil || got != tc.want {
+			t.Errorf("Query(%s).MatchRegexp(%q) = %v, %v, want %v", tc.path, tc.pattern, got, err, tc.want)
+		}
+	}
+	for _, path := range []string{"/msg", "/code", "/missing"} {
+		if got, err := root.Query(path).MatchRegexp(`(unclosed`); got || err == nil {
+			t.Errorf("Query(%s).MatchRegexp of an invalid pattern = %v, %v, want an error", path, got, err)
+		}
+	}
+}
+
+func TestFindAllMatches(t *testing.T) {
+	root, err := Parse([]byte(logDoc))
+	if err != nil {
+		t.Fatalf("Parse failed: %v", err)
+	}
+	cases := []struct {
+		path, pattern string
+		want          []string
+	}{
+		{"/msg", `\d+`, []string{"10", "0", "0", "7", "5432"}},
+		{"/tags", `[a-z]+`, []string{"db", "retry", "timeout"}},
+		{"/events[*]/msg", `\d{3}`, []string{"200", "500", "502"}},
+		{"/events[*]/msg", `^PUT`, nil},
+		{"/code", `\d`, nil},
+		{"/none", `.*`, nil},
+		{"/missing", `.*`, nil},
+	}
+	for _, tc := range cases {
+		got, err := root.Query(tc.path).FindAllMatches(tc.pattern)
+		if err != nil || !reflect.DeepEqual(got, tc.want) {
+			t.Errorf("Query(%s).FindAllMatches(%q) = %q, %v, want %q", tc.path, tc.pattern, got, err, tc.want)
+		}
+	}
+	if got, err := root.Query("/msg").FindAllMatches(`[`); got != nil || err == nil {
+		t.Errorf("FindAllMatches of an invalid pattern = %q, %v, want an error", got, err)
+	}
+}
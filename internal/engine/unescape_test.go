@@ -0,0 +1,145 @@
+package engine
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/474420502/xjson/internal/core"
+)
+
+const escapedDoc = `{"k\u00e9y":"v\u00e9\ud83d\ude00","arr":["A\n","\ud83c\udf89"],` +
+	`"lone":"\ud800x","low":"\udc00","o":{"x\"":"\"q\"","\ud83d\udc4d":"thumb"}}`
+
+func TestStringsUnescapeOnEveryParsePath(t *testing.T) {
+	forEachParser(t, escapedDoc, func(t *testing.T, root core.Node) {
+		cases := []struct {
+			node core.Node
+			want string
+		}{
+			{root.Get("kéy"), "vé😀"},
+			{root.Query("/kéy"), "vé😀"},
+			{root.Get("arr").Index(0), "A\n"},
+			{root.Query("/arr[1]"), "🎉"},
+			{root.Get("lone"), "\uFFFDx"},
+			{root.Get("low"), "\uFFFD"},
+			{root.Get("o").Get(`x"`), `"q"`},
+			{root.Query("/o/👍"), "thumb"},
+		}
+		for i, tc := range cases {
+			if !tc.node.IsValid() {
+				t.Fatalf("case %d: invalid node: %v", i, tc.node.Error())
+			}
+			if got := tc.node.String(); got != tc.want {
+				t.Errorf("case %d: String() = %q, want %q", i, got, tc.want)
+			}
+			if got, ok := tc.node.RawString(); !ok || got != tc.want {
+				t.Errorf("case %d: RawString() = %q, %v, want %q", i, got, ok, tc.want)
+			}
+		}
+
+		want := []string{`x"`, "👍"}
+		keys := root.Get("o").Keys()
+		if len(keys) != len(want) || keys[0] != want[0] || keys[1] != want[1] {
+			t.Errorf("Keys() = %q, want %q", keys, want)
+		}
+		found := false
+		root.ForEach(func(k interface{}, v core.Node) {
+			if k == "kéy" && v.String() == "vé😀" {
+				found = true
+			}
+		})
+		if !found {
+			t.Errorf("ForEach did not report the unescaped key %q", "kéy")
+		}
+	})
+}
+
+func TestRawEscaped(t *testing.T) {
+	forEachParser(t, escapedDoc, func(t *testing.T, root core.Node) {
+		cases := []struct {
+			path string
+			want string
+		}{
+			{"/kéy", `v\u00e9\ud83d\ude00`},
+			{"/lone", `\ud800x`},
+			{"/arr[0]", `A\n`},
+			{"/o/👍", `thumb`},
+		}
+		for _, tc := range cases {
+			got, ok := root.Query(tc.path).RawEscaped()
+			if !ok || got != tc.want {
+				t.Errorf("%s: RawEscaped() = %q, %v, want %q", tc.path, got, ok, tc.want)
+			}
+		}
+	})
+
+	if _, ok := NewNumberNode(nil, []byte("1"), nil).RawEscaped(); ok {
+		t.Error("RawEscaped on a number should report false")
+	}
+	built := NewStringNode(nil, "tab\there \"é\"", nil)
+	if got, ok := built.RawEscaped(); !ok || got != `tab\there \"é\"` {
+		t.Errorf("RawEscaped on a built string = %q, %v", got, ok)
+	}
+}
+
+func TestUnescapedStringsDoNotAlias(t *testing.T) {
+	root, err := MustParse([]byte(`["\u0041\n","\u0042\n","\u0043\n"]`))
+	if err != nil {
+		t.Fatalf("parse failed: %v", err)
+	}
+	for i, want := range []string{"A\n", "B\n", "C\n"} {
+		if got := root.Index(i).String(); got != want {
+			t.Errorf("index %d: got %q, want %q", i, got, want)
+		}
+	}
+}
+
+func TestValidateUTF8(t *testing.T) {
+	valid := []string{
+		`{"a":"\ud83d\ude00","b\u00e9":"é"}`,
+		`["plain","\u0000","\\u12"]`,
+	}
+	for _, doc := range valid {
+		root, err := ParseWithOptions([]byte(doc), ParseOptions{ValidateUTF8: true})
+		if err != nil {
+			t.Errorf("%s: unexpected error %v", doc, err)
+			continue
+		}
+		if !root.IsValid() {
+			t.Errorf("%s: invalid root %v", doc, root.Error())
+		}
+	}
+
+	invalid := []struct {
+		doc    string
+		line   int
+		column int
+	}{
+		{`{"a":"\ud800x"}`, 1, 7},
+		{`{"a":"\udc00"}`, 1, 7},
+		{`{"a":"\ud83d\u0041"}`, 1, 7},
+		{`{"k\ud800":1}`, 1, 4},
+		{"{\n  \"a\": [\"ok\", \"\\q\"]\n}", 2, 16},
+		{`["\u12G4"]`, 1, 3},
+		{"[\"ab\xffcd\"]", 1, 5},
+		{"{\"k\xc3\":1}", 1, 4},
+	}
+	for _, tc := range invalid {
+		_, err := ParseWithOptions([]byte(tc.doc), ParseOptions{ValidateUTF8: true})
+		var syntaxErr *core.SyntaxError
+		if !errors.As(err, &syntaxErr) {
+			t.Errorf("%q: expected *core.SyntaxError, got %v", tc.doc, err)
+			continue
+		}
+		if syntaxErr.Position.Line != tc.line || syntaxErr.Position.Column != tc.column {
+			t.Errorf("%q: position = %d:%d, want %d:%d", tc.doc,
+				syntaxErr.Position.Line, syntaxErr.Position.Column, tc.line, tc.column)
+		}
+	}
+
+	// Without the option documents with unpaired surrogates still parse.
+	root, err := ParseWithOptions([]byte(`{"a":"\ud800x"}`), ParseOptions{})
+	if err != nil || root.Get("a").String() != "\uFFFDx" {
+		t.Errorf("unvalidated parse: %v, %q", err, root.Get("a").String())
+	}
+}
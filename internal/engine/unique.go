@@ -0,0 +1,37 @@
+package engine
+
+import (
+	"bytes"
+
+	"github.com/474420502/xjson/internal/core"
+)
+
+// Unique returns the elements of an array or match set as a new match set
+// without the ones equal to an earlier element, under the rules of Equal.
+// Each element is hashed by its canonical form, see CanonicalBytes, so the
+// cost grows linearly with the number and size of the elements. Any other
+// node is returned as it is.
+func (n *baseNode) Unique() core.Node {
+	self := n.selfOrMe()
+	if n.err != nil || self.Type() != core.Array {
+		return self
+	}
+	elems := self.UnsafeArray()
+	seen := make(map[string]struct{}, len(elems))
+	out := make([]core.Node, 0, len(elems))
+	var buf bytes.Buffer
+	for _, elem := range elems {
+		buf.Reset()
+		if err := writeCanonical(&buf, elem); err != nil {
+			// A malformed value cannot be compared; keep it.
+			out = append(out, elem)
+			continue
+		}
+		if _, dup := seen[string(buf.Bytes())]; dup {
+			continue
+		}
+		seen[buf.String()] = struct{}{}
+		out = append(out, elem)
+	}
+	return newMatchSet(self, out, n.funcs)
+}
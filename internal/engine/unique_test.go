@@ -0,0 +1,72 @@
+package engine
+
+import (
+	"testing"
+
+	"github.com/474420502/xjson/internal/core"
+)
+
+func TestUnique(t *testing.T) {
+	root, err := Parse([]byte(`[1, 1.0, "1", true, null, null, 1e0, ` +
+		`{"a":1,"b":2}, {"b":2,"a":1.0}, {"a":1}, [1,2], [1,2], [2,1], "1", false]`))
+	if err != nil {
+		t.Fatalf("Parse failed: %v", err)
+	}
+	got := root.Unique()
+	if !got.IsValid() || got.Type() != core.Array {
+		t.Fatalf("Unique() = %v (%v), want an array", got.Type(), got.Error())
+	}
+	want := `[1,"1",true,null,{"a":1,"b":2},{"a":1},[1,2],[2,1],false]`
+	if s := got.String(); s != want {
+		t.Errorf("Unique() = %s, want %s", s, want)
+	}
+	if root.Len() != 15 {
+		t.Errorf("Unique changed the document: Len() = %d", root.Len())
+	}
+}
+
+func TestUniqueMatchSet(t *testing.T) {
+	root, err := Parse([]byte(`{"items":[` +
+		`{"category":"fruit"},{"category":"veg"},{"category":"fruit"},` +
+		`{"category":"nut"},{"category":"veg"}]}`))
+	if err != nil {
+		t.Fatalf("Parse failed: %v", err)
+	}
+	var cats []string
+	for _, c := range root.Query("//category").Unique().Array() {
+		cats = append(cats, c.String())
+	}
+	if want := []string{"fruit", "veg", "nut"}; len(cats) != len(want) ||
+		cats[0] != want[0] || cats[1] != want[1] || cats[2] != want[2] {
+		t.Errorf("//category Unique() = %v, want %v", cats, want)
+	}
+
+	distinct := root.Query("//category[@distinct]")
+	if distinct.Len() != 3 || distinct.Index(2).String() != "nut" {
+		t.Errorf("//category[@distinct] = %s, want 3 categories", distinct.String())
+	}
+	if n := root.Query("/items[@distinct(1)]"); n.IsValid() {
+		t.Error("[@distinct(1)] should be an invalid node")
+	}
+
+	empty := root.Query("//missing").Unique()
+	if !empty.IsValid() || empty.Len() != 0 {
+		t.Errorf("Unique() of an empty match set = %v (%v), want empty", empty.String(), empty.Error())
+	}
+}
+
+func TestUniqueOnOtherNodes(t *testing.T) {
+	root, err := Parse([]byte(`{"n":5}`))
+	if err != nil {
+		t.Fatalf("Parse failed: %v", err)
+	}
+	if n := root.Get("n").Unique(); n.Int() != 5 {
+		t.Errorf("Unique() of a number = %s, want itself", n.String())
+	}
+	if n := root.Unique(); n.Type() != core.Object {
+		t.Errorf("Unique() of an object = %v, want the object", n.Type())
+	}
+	if n := root.Get("missing").Unique(); n.IsValid() {
+		t.Error("Unique() of an invalid node should stay invalid")
+	}
+}
@@ -0,0 +1,40 @@
+package engine
+
+import "fmt"
+
+// ValidateBytes reports whether data is one JSON document that MustParse
+// accepts, returning the *core.SyntaxError MustParse would otherwise; empty
+// input fails with one at its end. It scans data once without building
+// nodes or allocating, except for the error.
+func ValidateBytes(data []byte) error {
+	s := scanner{data: data, v: NopVisitor{}, check: true}
+	if s.skipWhitespace(); s.pos >= len(data) {
+		return s.syntaxError("empty json")
+	}
+	return s.run()
+}
+
+// checkEscapes checks the escape sequences of the string contents b like
+// appendUnescaped does, without decoding them.
+func checkEscapes(b []byte) error {
+	for i := 0; i < len(b); i++ {
+		if b[i] != '\\' {
+			continue
+		}
+		if i == len(b)-1 {
+			return &escapeError{off: i, msg: "invalid escape at end of string"}
+		}
+		i++
+		switch b[i] {
+		case '"', '\\', '/', 'b', 'f', 'n', 'r', 't':
+		case 'u':
+			if _, ok := parseHex4(b, i+1); !ok {
+				return &escapeError{off: i - 1, msg: "invalid unicode escape"}
+			}
+			i += 4
+		default:
+			return &escapeError{off: i - 1, msg: fmt.Sprintf("invalid escape character: %c", b[i])}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,88 @@
+package engine
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+
+	"github.com/474420502/xjson/internal/core"
+)
+
+// validCases are documents beside the JSONTestSuite that sit on the edges
+// of what the scanner and the parsers check.
+var validCases = []string{
+	`{"a":[1,2,{"b":null}],"c":"é\n\/","d":-0.5e+3}`,
+	` [ true , false ] `,
+	`"😀"`,
+	`"\ud83d"`,
+	`"\uZZZZ"`,
+	`"\u12"`,
+	`"\x"`,
+	`"ab\"`,
+	`{"a":1,}`,
+	`[1,]`,
+	`{"a" 1}`,
+	`{"a":1 "b":2}`,
+	`[1 2]`,
+	`01`,
+	`1.`,
+	`-`,
+	`1e`,
+	`tru`,
+	`nulls`,
+	`[1] [2]`,
+	"\"a\tb\"",
+	"{\"a\":\n  [1,\n   2,,3]}",
+	``,
+	"  \n ",
+}
+
+func TestValidateBytesAgreesWithParsing(t *testing.T) {
+	cases := loadSuite(t)
+	for i, doc := range validCases {
+		cases[string(rune('a'+i))+"_"+doc] = []byte(doc)
+	}
+	for name, data := range cases {
+		err := ValidateBytes(data)
+		_, want := MustParse(data)
+		if (err == nil) != (want == nil) {
+			t.Errorf("%s: ValidateBytes = %v, MustParse = %v", name, err, want)
+			continue
+		}
+		results := suiteResults(data)
+		delete(results, "ValidateBytes")
+		for how, res := range results {
+			if (err == nil) != (res == nil) {
+				t.Errorf("%s: ValidateBytes = %v, %s = %v", name, err, how, res)
+			}
+		}
+
+		var got, wantErr *core.SyntaxError
+		if errors.As(want, &wantErr) {
+			if !errors.As(err, &got) || !reflect.DeepEqual(got, wantErr) {
+				t.Errorf("%s: ValidateBytes = %v, want %v", name, err, want)
+			}
+		}
+	}
+}
+
+func TestValidateBytesPositions(t *testing.T) {
+	err := ValidateBytes([]byte("{\n  \"a\": [1,\n    \"b\\q\"]\n}"))
+	var syntaxErr *core.SyntaxError
+	if !errors.As(err, &syntaxErr) || syntaxErr.Line != 3 || syntaxErr.Column != 5 || syntaxErr.Offset != 17 {
+		t.Fatalf("ValidateBytes = %v, want an error at line 3, column 5", err)
+	}
+	if err := ValidateBytes([]byte(" \n")); !errors.As(err, &syntaxErr) || syntaxErr.Offset != 2 || syntaxErr.Msg != "empty json" {
+		t.Errorf("ValidateBytes of blank input = %v", err)
+	}
+}
+
+func TestValidateBytesDoesNotAllocate(t *testing.T) {
+	data := []byte(`{"user":{"name":"a\"né","tags":["x","y\\z"],"n":[1.5e3,-2,true,null]},"deep":[[[[{}]]]]}`)
+	if err := ValidateBytes(data); err != nil {
+		t.Fatalf("ValidateBytes failed: %v", err)
+	}
+	if allocs := testing.AllocsPerRun(100, func() { _ = ValidateBytes(data) }); allocs != 0 {
+		t.Errorf("ValidateBytes allocated %.0f times, want 0", allocs)
+	}
+}
@@ -0,0 +1,87 @@
+package engine
+
+import (
+	"unicode/utf16"
+	"unicode/utf8"
+)
+
+// validateStrings checks every string literal of data for ParseOptions
+// ValidateUTF8: escape sequences must be well formed, \u escapes of
+// surrogates must form a high/low pair and the remaining bytes must be
+// valid UTF-8. Structural errors are left to the parser, including an
+// unterminated string.
+func validateStrings(data []byte) error {
+	for i := 0; i < len(data); i++ {
+		if data[i] != '"' {
+			continue
+		}
+		end, err := validateString(data, i+1)
+		if err != nil {
+			return err
+		}
+		if end < 0 {
+			return nil
+		}
+		i = end
+	}
+	return nil
+}
+
+// validateString validates the string contents starting at pos and returns
+// the index of the closing quote, or -1 when the string is unterminated.
+func validateString(data []byte, pos int) (int, error) {
+	for i := pos; i < len(data); {
+		c := data[i]
+		switch {
+		case c == '"':
+			return i, nil
+		case c == '\\':
+			n, err := validateEscape(data, i)
+			if err != nil {
+				return 0, err
+			}
+			i += n
+		case c < utf8.RuneSelf:
+			i++
+		default:
+			r, size := utf8.DecodeRune(data[i:])
+			if r == utf8.RuneError && size == 1 {
+				return 0, newSyntaxError(data, i, "invalid UTF-8 byte in string")
+			}
+			i += size
+		}
+	}
+	return -1, nil
+}
+
+// validateEscape validates the escape sequence at data[i] and returns its
+// length.
+func validateEscape(data []byte, i int) (int, error) {
+	if i+1 >= len(data) {
+		return 0, newSyntaxError(data, i, "invalid escape at end of string")
+	}
+	switch data[i+1] {
+	case '"', '\\', '/', 'b', 'f', 'n', 'r', 't':
+		return 2, nil
+	case 'u':
+	default:
+		return 0, newSyntaxError(data, i, "invalid escape character: "+string(rune(data[i+1])))
+	}
+
+	r, ok := parseHex4(data, i+2)
+	if !ok {
+		return 0, newSyntaxError(data, i, "invalid unicode escape")
+	}
+	if !utf16.IsSurrogate(r) {
+		return 6, nil
+	}
+	if r >= 0xDC00 {
+		return 0, newSyntaxError(data, i, "unpaired low surrogate in unicode escape")
+	}
+	if i+7 < len(data) && data[i+6] == '\\' && data[i+7] == 'u' {
+		if lo, ok := parseHex4(data, i+8); ok && lo >= 0xDC00 && lo <= 0xDFFF {
+			return 12, nil
+		}
+	}
+	return 0, newSyntaxError(data, i, "unpaired high surrogate in unicode escape")
+}
@@ -0,0 +1,150 @@
+package engine
+
+import (
+	"github.com/474420502/xjson/internal/core"
+)
+
+// MatchCount returns the number of matches of a wildcard, recursive, filter
+// or slice result. Any other valid node is one match and an invalid node
+// none.
+func (n *baseNode) MatchCount() int {
+	self := n.selfOrMe()
+	if !self.IsValid() {
+		return 0
+	}
+	if matches, ok := matchList(self); ok {
+		return len(matches)
+	}
+	return 1
+}
+
+// Value returns the Go value of a single match, as Interface does. Several
+// matches come back as a []interface{} of their values; no match fails with
+// ErrNoMatches.
+func (n *baseNode) Value() (interface{}, error) {
+	self := n.selfOrMe()
+	if !self.IsValid() {
+		return nil, self.Error()
+	}
+	matches, ok := matchList(self)
+	if !ok {
+		return self.Interface(), nil
+	}
+	switch len(matches) {
+	case 0:
+		return nil, &core.PathError{Op: "Value", Err: core.ErrNoMatches}
+	case 1:
+		return matches[0].Interface(), nil
+	}
+	return matchValues(matches), nil
+}
+
+// Values returns the Go value of every match, in match order.
+func (n *baseNode) Values() []interface{} {
+	self := n.selfOrMe()
+	if !self.IsValid() {
+		return []interface{}{}
+	}
+	if matches, ok := matchList(self); ok {
+		return matchValues(matches)
+	}
+	return []interface{}{self.Interface()}
+}
+
+// matchValues converts each match with Interface.
+func matchValues(matches []core.Node) []interface{} {
+	values := make([]interface{}, len(matches))
+	for i, m := range matches {
+		values[i] = m.Interface()
+	}
+	return values
+}
+
+// MapInterface returns an object, or the only match that is one, as a
+// map[string]interface{} whose values convert as by Value, recursively. It
+// fails with the error of the node or of a value below it that does not
+// parse, with ErrNoMatches for an empty result, and with a *core.TypeError
+// for anything that is not an object, several matches included.
+func (n *baseNode) MapInterface() (map[string]interface{}, error) {
+	self := n.selfOrMe()
+	if !self.IsValid() {
+		return nil, self.Error()
+	}
+	if matches, ok := matchList(self); ok {
+		switch len(matches) {
+		case 0:
+			return nil, &core.PathError{Op: "MapInterface", Err: core.ErrNoMatches}
+		case 1:
+			return matches[0].MapInterface()
+		}
+	}
+	if self.Type() != core.Object {
+		return nil, typeError(self, "object", nil)
+	}
+	v, err := plainValue(self)
+	if err != nil {
+		return nil, err
+	}
+	return v.(map[string]interface{}), nil
+}
+
+// SliceInterface returns the elements of an array as a []interface{} whose
+// values convert as by Value, recursively. A match set gives one entry per
+// match, even when it has only one. It fails like MapInterface, with a
+// *core.TypeError for anything that is not an array or match set.
+func (n *baseNode) SliceInterface() ([]interface{}, error) {
+	self := n.selfOrMe()
+	if !self.IsValid() {
+		return nil, self.Error()
+	}
+	if matches, ok := matchList(self); ok && len(matches) == 0 {
+		return nil, &core.PathError{Op: "SliceInterface", Err: core.ErrNoMatches}
+	}
+	if self.Type() != core.Array {
+		return nil, typeError(self, "array", nil)
+	}
+	v, err := plainValue(self)
+	if err != nil {
+		return nil, err
+	}
+	return v.([]interface{}), nil
+}
+
+// plainValue converts node as Interface does, but fails with the error of
+// the first container that does not parse instead of leaving it out.
+func plainValue(node core.Node) (interface{}, error) {
+	switch node.Type() {
+	case core.Object:
+		members := node.UnsafeMap()
+		if err := node.Error(); err != nil {
+			return nil, err
+		}
+		m := make(map[string]interface{}, len(members))
+		for k, member := range members {
+			v, err := plainValue(member)
+			if err != nil {
+				return nil, err
+			}
+			m[k] = v
+		}
+		return m, nil
+	case core.Array:
+		elems := node.UnsafeArray()
+		if err := node.Error(); err != nil {
+			return nil, err
+		}
+		s := make([]interface{}, len(elems))
+		for i, elem := range elems {
+			v, err := plainValue(elem)
+			if err != nil {
+				return nil, err
+			}
+			s[i] = v
+		}
+		return s, nil
+	}
+	if err := node.Error(); err != nil {
+		return nil, err
+	}
+	return node.Interface(), nil
+}
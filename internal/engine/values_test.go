@@ -0,0 +1,180 @@
+package engine
+
+import (
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+	"text/template"
+
+	"github.com/474420502/xjson/internal/core"
+)
+
+func TestValueAndValues(t *testing.T) {
+	// errMissing stands for the error of a path that does not resolve,
+	// which has no sentinel of its own.
+	errMissing := errors.New("missing")
+	root, err := Parse([]byte(`{
+		"s": "text", "t": true, "f": false, "n": null,
+		"i": 42, "neg": -7, "big": 9223372036854775807, "huge": 9223372036854775808,
+		"fl": 1.5, "whole": 2.0, "exp": 1e2,
+		"o": {"k": 1}, "a": [1, "x", null], "empty": [],
+		"items": [{"v": 1}, {"v": null}, {"w": {"v": "deep"}}]
+	}`))
+	if err != nil {
+		t.Fatalf("Parse failed: %v", err)
+	}
+	testCases := []struct {
+		name   string
+		path   string
+		value  interface{}
+		err    error
+		values []interface{}
+	}{
+		{"string", "/s", "text", nil, []interface{}{"text"}},
+		{"true", "/t", true, nil, []interface{}{true}},
+		{"false", "/f", false, nil, []interface{}{false}},
+		{"null", "/n", nil, nil, []interface{}{nil}},
+		{"integer", "/i", int64(42), nil, []interface{}{int64(42)}},
+		{"negative integer", "/neg", int64(-7), nil, []interface{}{int64(-7)}},
+		{"max int64", "/big", int64(9223372036854775807), nil, []interface{}{int64(9223372036854775807)}},
+		{"beyond int64", "/huge", float64(9223372036854775808), nil, []interface{}{float64(9223372036854775808)}},
+		{"fraction", "/fl", 1.5, nil, []interface{}{1.5}},
+		{"whole fraction", "/whole", 2.0, nil, []interface{}{2.0}},
+		{"exponent", "/exp", 100.0, nil, []interface{}{100.0}},
+		{"object", "/o", map[string]interface{}{"k": int64(1)}, nil,
+			[]interface{}{map[string]interface{}{"k": int64(1)}}},
+		{"array", "/a", []interface{}{int64(1), "x", nil}, nil,
+			[]interface{}{[]interface{}{int64(1), "x", nil}}},
+		{"empty array", "/empty", []interface{}{}, nil, []interface{}{[]interface{}{}}},
+		{"single match", "/items[?(@.v == 1)]/v", int64(1), nil, []interface{}{int64(1)}},
+		{"recursive matches", "//v", []interface{}{int64(1), nil, "deep"}, nil,
+			[]interface{}{int64(1), nil, "deep"}},
+		{"wildcard matches", "/a[*]", []interface{}{int64(1), "x", nil}, nil,
+			[]interface{}{int64(1), "x", nil}},
+		{"no match", "/items[?(@.v == 5)]", nil, core.ErrNoMatches, []interface{}{}},
+		{"missing path", "/missing", nil, errMissing, []interface{}{}},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			result := root.Query(tc.path)
+			value, err := result.Value()
+			if tc.err == errMissing {
+				if err == nil || value != nil {
+					t.Errorf("Value() = %#v, %v, want an error", value, err)
+				}
+			} else if tc.err != nil {
+				if !errors.Is(err, tc.err) || value != nil {
+					t.Errorf("Value() = %#v, %v, want an error wrapping %v", value, err, tc.err)
+				}
+			} else if err != nil || !reflect.DeepEqual(value, tc.value) {
+				t.Errorf("Value() = %#v, %v, want %#v", value, err, tc.value)
+			}
+			values := result.Values()
+			if values == nil || !reflect.DeepEqual(values, tc.values) {
+				t.Errorf("Values() = %#v, want %#v", values, tc.values)
+			}
+			if got := result.MatchCount(); got != len(values) {
+				t.Errorf("MatchCount() = %d, want len(Values()) = %d", got, len(values))
+			}
+		})
+	}
+}
+
+func TestMapAndSliceInterface(t *testing.T) {
+	doc := []byte(`{
+		"user": {"name": "Ann", "age": 41, "score": 9.5, "tags": ["a", "b"], "addr": {"city": "Oslo", "zip": null}},
+		"items": [{"id": 1, "qty": 2.0}, {"id": 2, "qty": 1e1}],
+		"s": "x", "empty": []
+	}`)
+	for name, parse := range testParsers {
+		root, err := parse(doc)
+		if err != nil {
+			t.Fatalf("%s: parse failed: %v", name, err)
+		}
+		m, err := root.Query("/user").MapInterface()
+		want := map[string]interface{}{
+			"name": "Ann", "age": int64(41), "score": 9.5, "tags": []interface{}{"a", "b"},
+			"addr": map[string]interface{}{"city": "Oslo", "zip": nil},
+		}
+		if err != nil || !reflect.DeepEqual(m, want) {
+			t.Errorf("%s: MapInterface() = %#v, %v, want %#v", name, m, err, want)
+		}
+		if m, err := root.Query("/items[?(@.id == 2)]").MapInterface(); err != nil || m["qty"] != 10.0 {
+			t.Errorf("%s: MapInterface() of a single match = %#v, %v", name, m, err)
+		}
+
+		s, err := root.Query("/items").SliceInterface()
+		wantItems := []interface{}{
+			map[string]interface{}{"id": int64(1), "qty": 2.0},
+			map[string]interface{}{"id": int64(2), "qty": 10.0},
+		}
+		if err != nil || !reflect.DeepEqual(s, wantItems) {
+			t.Errorf("%s: SliceInterface() = %#v, %v, want %#v", name, s, err, wantItems)
+		}
+		if s, err := root.Query("//tags").SliceInterface(); err != nil || !reflect.DeepEqual(s, []interface{}{[]interface{}{"a", "b"}}) {
+			t.Errorf("%s: SliceInterface() of one match = %#v, %v, want one entry", name, s, err)
+		}
+		if s, err := root.Query("/items[*]/id").SliceInterface(); err != nil || !reflect.DeepEqual(s, []interface{}{int64(1), int64(2)}) {
+			t.Errorf("%s: SliceInterface() of matches = %#v, %v", name, s, err)
+		}
+		if s, err := root.Query("/empty").SliceInterface(); err != nil || s == nil || len(s) != 0 {
+			t.Errorf("%s: SliceInterface() of [] = %#v, %v, want an empty slice", name, s, err)
+		}
+
+		failing := []struct {
+			call func() error
+			want error
+		}{
+			{func() error { _, err := root.Query("/s").MapInterface(); return err }, core.ErrTypeAssertion},
+			{func() error { _, err := root.Query("/items").MapInterface(); return err }, core.ErrTypeAssertion},
+			{func() error { _, err := root.Query("/items[*]").MapInterface(); return err }, core.ErrTypeAssertion},
+			{func() error { _, err := root.Query("/user").SliceInterface(); return err }, core.ErrTypeAssertion},
+			{func() error { _, err := root.Query("/items[?(@.id > 5)]").MapInterface(); return err }, core.ErrNoMatches},
+			{func() error { _, err := root.Query("/items[?(@.id > 5)]").SliceInterface(); return err }, core.ErrNoMatches},
+		}
+		for i, tc := range failing {
+			if err := tc.call(); !errors.Is(err, tc.want) {
+				t.Errorf("%s: case %d: error = %v, want %v", name, i, err, tc.want)
+			}
+		}
+		missing := root.Query("/nope")
+		if _, err := missing.MapInterface(); err == nil || !errors.Is(err, missing.Error()) || errors.Is(err, core.ErrTypeAssertion) {
+			t.Errorf("%s: MapInterface() of a missing path = %v, want its error", name, err)
+		}
+		if _, err := missing.SliceInterface(); err == nil || errors.Is(err, core.ErrTypeAssertion) {
+			t.Errorf("%s: SliceInterface() of a missing path = %v, want its error", name, err)
+		}
+	}
+}
+
+func TestMapInterfaceReportsMalformedValues(t *testing.T) {
+	root, err := Parse([]byte(`{"a":{"b":[1,{"c":}]},"z":1}`))
+	if err != nil {
+		t.Fatalf("Parse failed: %v", err)
+	}
+	if m, err := root.Query("/a").MapInterface(); err == nil {
+		t.Errorf("MapInterface() of a malformed value = %#v, want an error", m)
+	}
+}
+
+func TestMapInterfaceExecutesTemplates(t *testing.T) {
+	root, err := Parse([]byte(`{"order":{"id":1042,"customer":{"name":"Ann"},"total":12.5,
+		"lines":[{"sku":"A-1","qty":2},{"sku":"B-7","qty":1}],"note":null}}`))
+	if err != nil {
+		t.Fatalf("Parse failed: %v", err)
+	}
+	data, err := root.Query("/order").MapInterface()
+	if err != nil {
+		t.Fatalf("MapInterface() failed: %v", err)
+	}
+	tmpl := template.Must(template.New("order").Parse(
+		`Order {{.id}} for {{.customer.name}}: {{range .lines}}{{.qty}}x{{.sku}} {{end}}total {{.total}}{{with .note}} ({{.}}){{end}}`))
+	var out strings.Builder
+	if err := tmpl.Execute(&out, data); err != nil {
+		t.Fatalf("Execute failed: %v", err)
+	}
+	if want := "Order 1042 for Ann: 2xA-1 1xB-7 total 12.5"; out.String() != want {
+		t.Errorf("rendered %q, want %q", out.String(), want)
+	}
+}
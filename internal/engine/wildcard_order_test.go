@@ -0,0 +1,85 @@
+package engine
+
+import (
+	"reflect"
+	"testing"
+)
+
+const orderedStore = `{"store":{
+	"zebra":{"price":5},
+	"apple":{"price":1},
+	"mango":{"price":3},
+	"kiwi":{"price":4},
+	"banana":{"price":2}
+}}`
+
+func TestWildcardOnObjectIsStable(t *testing.T) {
+	for name, parse := range testParsers {
+		var first []string
+		for i := 0; i < 100; i++ {
+			root, err := parse([]byte(orderedStore))
+			if err != nil {
+				t.Fatalf("%s parse failed: %v", name, err)
+			}
+			got := root.Query("/store/*/price").Strings()
+			if first == nil {
+				first = got
+				continue
+			}
+			if !reflect.DeepEqual(got, first) {
+				t.Fatalf("%s run %d: order changed from %v to %v", name, i, first, got)
+			}
+		}
+	}
+}
+
+func TestWildcardFollowsDocumentOrder(t *testing.T) {
+	want := []string{"5", "1", "3", "4", "2"}
+
+	lazy, err := Parse([]byte(orderedStore))
+	if err != nil {
+		t.Fatalf("Parse failed: %v", err)
+	}
+	if got := lazy.Query("/store/*/price").Strings(); !reflect.DeepEqual(got, want) {
+		t.Fatalf("lazy wildcard = %v, want %v", got, want)
+	}
+
+	eager, err := MustParse([]byte(orderedStore))
+	if err != nil {
+		t.Fatalf("MustParse failed: %v", err)
+	}
+	if got := eager.Query("/store/*/price").Strings(); !reflect.DeepEqual(got, want) {
+		t.Fatalf("eager wildcard = %v, want %v", got, want)
+	}
+
+	// Writes keep existing keys in place and append new ones.
+	store := eager.Get("store")
+	store.Get("mango").Set("price", 30)
+	store.Set("cherry", map[string]interface{}{"price": 6})
+	store.Delete("kiwi")
+	want = []string{"5", "1", "30", "2", "6"}
+	if got := eager.Query("/store/*/price").Strings(); !reflect.DeepEqual(got, want) {
+		t.Fatalf("wildcard after writes = %v, want %v", got, want)
+	}
+}
+
+func TestRecursiveSearchFollowsDocumentOrder(t *testing.T) {
+	doc := []byte(`{"b":{"id":1,"x":{"id":2}},"id":3,"a":[{"id":4},{"c":{"id":5}}]}`)
+	want := []string{"1", "2", "3", "4", "5"}
+
+	lazy, err := Parse(doc)
+	if err != nil {
+		t.Fatalf("Parse failed: %v", err)
+	}
+	if got := lazy.Query("//id").Strings(); !reflect.DeepEqual(got, want) {
+		t.Fatalf("raw recursive search = %v, want %v", got, want)
+	}
+
+	eager, err := MustParse(doc)
+	if err != nil {
+		t.Fatalf("MustParse failed: %v", err)
+	}
+	if got := eager.Query("//id").Strings(); !reflect.DeepEqual(got, want) {
+		t.Fatalf("parsed recursive search = %v, want %v", got, want)
+	}
+}
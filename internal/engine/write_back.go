@@ -0,0 +1,278 @@
+package engine
+
+import (
+	"fmt"
+	"strconv"
+	"unsafe"
+
+	"github.com/474420502/xjson/internal/core"
+)
+
+// Writes on a match set go through to every match in the document, and so do
+// writes on a selection, the result of a slice step, Limit or Offset, whose
+// elements are those of the document. They are all-or-nothing: every match
+// is checked first, and if the value cannot be converted or one match cannot
+// take the write, an invalid node is returned and no match is changed.
+
+// setMatches implements Set on a match set.
+func (n *arrayNode) setMatches(key string, value interface{}) core.Node {
+	matches, err := n.attachedMatches("set")
+	if err == nil {
+		err = checkMatchWrite(matches, "set", key, value, true, n.funcs)
+	}
+	if err != nil {
+		return newInvalidNode(err)
+	}
+	for _, match := range matches {
+		match.Set(key, value)
+	}
+	return n
+}
+
+// setIndexMatches implements SetIndex on a match set. Every match must be
+// an array holding index.
+func (n *arrayNode) setIndexMatches(index int, value interface{}) core.Node {
+	matches, err := n.attachedMatches("set")
+	for i := 0; err == nil && i < len(matches); i++ {
+		if t := matches[i].Type(); t != core.Array && matches[i].IsValid() {
+			err = fmt.Errorf("set on match %d: %w: set index not supported on type %s", i, core.ErrTypeAssertion, t)
+		}
+	}
+	if err == nil {
+		err = checkMatchWrite(matches, "set", strconv.Itoa(index), value, true, n.funcs)
+	}
+	if err != nil {
+		return newInvalidNode(err)
+	}
+	for _, match := range matches {
+		match.SetIndex(index, value)
+	}
+	return n
+}
+
+// deleteMatches implements Delete on a match set.
+func (n *arrayNode) deleteMatches(key string) core.Node {
+	matches, err := n.attachedMatches("delete")
+	if err == nil {
+		err = checkMatchWrite(matches, "delete", key, nil, false, n.funcs)
+	}
+	if err != nil {
+		return newInvalidNode(err)
+	}
+	for _, match := range matches {
+		match.Delete(key)
+	}
+	return n
+}
+
+// SetValue replaces the value in the document. On a match set every match
+// is replaced and the result is a match set of the replacements.
+func (n *arrayNode) SetValue(v interface{}) core.Node {
+	if !(n.matchSet || n.selection) || n.err != nil {
+		return n.baseNode.SetValue(v)
+	}
+	if probe := NewNodeFromInterface(nil, v, n.funcs); !probe.IsValid() {
+		return probe
+	}
+	matches, err := n.attachedMatches("setValue")
+	if err != nil {
+		return newInvalidNode(err)
+	}
+	if len(matches) > 1 && holdsNode(v) {
+		return newInvalidNode(fmt.Errorf("setValue on %d matches: a node value has one place in the document", len(matches)))
+	}
+	for i, match := range matches {
+		if match.Parent() == nil {
+			return newInvalidNode(fmt.Errorf("setValue on match %d: not supported on root node type %s", i, match.Type()))
+		}
+	}
+	replaced := make([]core.Node, len(matches))
+	for i, match := range matches {
+		replaced[i] = match.SetValue(v)
+		if !replaced[i].IsValid() {
+			return newInvalidNode(fmt.Errorf("setValue on match %d: %w", i, replaced[i].Error()))
+		}
+	}
+	return newMatchSet(n.parent, replaced, n.funcs)
+}
+
+// checkMatchWrite reports the first match that cannot take the write op on
+// key. When withValue is set, value must also convert to a node.
+func checkMatchWrite(matches []core.Node, op, key string, value interface{}, withValue bool, funcs *map[string]core.UnaryPathFunc) error {
+	if withValue {
+		if len(matches) > 1 && holdsNode(value) {
+			return fmt.Errorf("%s on %d matches: a node value has one place in the document", op, len(matches))
+		}
+		if probe := NewNodeFromInterface(nil, value, funcs); !probe.IsValid() {
+			return probe.Error()
+		}
+	}
+	for i, match := range matches {
+		if err := match.Error(); err != nil {
+			return fmt.Errorf("%s on match %d: %w", op, i, err)
+		}
+		switch match.Type() {
+		case core.Object:
+			if op == "delete" && !match.Get(key).IsValid() {
+				return fmt.Errorf("%s on match %d: key not found: %s", op, i, key)
+			}
+		case core.Array:
+			idx, err := strconv.Atoi(key)
+			if err != nil {
+				return fmt.Errorf("%s on match %d: invalid index for array %s: %s", op, i, op, key)
+			}
+			if size := match.Len(); idx < -size || idx >= size {
+				return fmt.Errorf("%s on match %d: %w for %s: %d", op, i, core.ErrIndexOutOfBounds, op, idx)
+			}
+		default:
+			return fmt.Errorf("%s on match %d: %w: %s not supported on type %s", op, i, core.ErrTypeAssertion, op, match.Type())
+		}
+	}
+	return nil
+}
+
+// attachedMatches returns the matches of the set as nodes of the document.
+// A recursive step over an unparsed container reports values parsed from
+// the source bytes on their own; those are swapped for the node at the same
+// bytes in the document, parsing the containers on the way.
+func (n *arrayNode) attachedMatches(op string) ([]core.Node, error) {
+	root := topNode(n)
+	matches := make([]core.Node, len(n.value))
+	for i, match := range n.value {
+		attached, ok := attachMatch(root, match)
+		if !ok {
+			return nil, fmt.Errorf("%s on match %d: value is not part of the document", op, i)
+		}
+		matches[i] = attached
+	}
+	return matches, nil
+}
+
+// documentMatches is attachedMatches for the callbacks of ForEach, Filter
+// and Map, which must see the nodes of the document so that their writes
+// land there. A match that is not part of the document, such as one of a
+// set joined from several documents, is passed as it is. The values of the
+// set are returned unchanged when every match is already attached.
+func (n *arrayNode) documentMatches() []core.Node {
+	root := topNode(n)
+	var matches []core.Node
+	for i, match := range n.value {
+		attached, ok := attachMatch(root, match)
+		if !ok || attached == match {
+			if matches != nil {
+				matches[i] = match
+			}
+			continue
+		}
+		if matches == nil {
+			matches = make([]core.Node, len(n.value))
+			copy(matches, n.value[:i])
+		}
+		matches[i] = attached
+	}
+	if matches == nil {
+		return n.value
+	}
+	return matches
+}
+
+// attachMatch returns the node of the document under root at the bytes of
+// match, which is match itself unless a recursive step parsed it on its own.
+func attachMatch(root, match core.Node) (core.Node, bool) {
+	if topNode(match) == root {
+		return match, true
+	}
+	return findBySource(root, match)
+}
+
+// topNode follows Parent links up to the node that has none. A node that
+// failed to parse is its own Parent and stops the walk too.
+func topNode(node core.Node) core.Node {
+	for {
+		parent := node.Parent()
+		if parent == nil || parent == node {
+			return node
+		}
+		node = parent
+	}
+}
+
+// documentRoot returns the root of the document node belongs to, found by
+// following Parent links to the top. A match of a recursive scan hangs off a
+// temporary copy of its container, which leads to the document through its
+// origin. A node built on its own is the root of its own document.
+func documentRoot(node core.Node) core.Node {
+	top := topNode(node)
+	if bn := nodeBase(top); bn != nil && bn.origin != nil {
+		return bn.origin
+	}
+	return top
+}
+
+// findBySource descends from root to the node whose source bytes are exactly
+// the source bytes of target.
+func findBySource(root, target core.Node) (core.Node, bool) {
+	want := sourceBytes(target)
+	if len(want) == 0 {
+		return nil, false
+	}
+	lo := uintptr(unsafe.Pointer(&want[0]))
+	hi := lo + uintptr(len(want))
+
+	cur := root
+	for {
+		raw := sourceBytes(cur)
+		if len(raw) == 0 {
+			return nil, false
+		}
+		start := uintptr(unsafe.Pointer(&raw[0]))
+		if start == lo && len(raw) == len(want) && cur.Type() == target.Type() {
+			return cur, true
+		}
+		next := childContaining(cur, lo, hi)
+		if next == nil {
+			return nil, false
+		}
+		cur = next
+	}
+}
+
+// childContaining returns the child of node whose source bytes contain the
+// address range [lo, hi).
+func childContaining(node core.Node, lo, hi uintptr) core.Node {
+	var children []core.Node
+	switch c := node.(type) {
+	case *objectNode:
+		c.lazyParse()
+		children = make([]core.Node, 0, len(c.value))
+		for _, child := range c.value {
+			children = append(children, child)
+		}
+	case *arrayNode:
+		c.lazyParse()
+		children = c.value
+	default:
+		return nil
+	}
+	for _, child := range children {
+		raw := sourceBytes(child)
+		if len(raw) == 0 {
+			continue
+		}
+		start := uintptr(unsafe.Pointer(&raw[0]))
+		if start <= lo && hi <= start+uintptr(len(raw)) {
+			return child
+		}
+	}
+	return nil
+}
+
+// sourceBytes returns the source bytes a node was parsed from, quotes
+// included for strings, or nil for a value built in memory.
+func sourceBytes(node core.Node) []byte {
+	bn := nodeBase(node)
+	if bn == nil {
+		return nil
+	}
+	return bn.raw
+}
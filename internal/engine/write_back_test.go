@@ -0,0 +1,347 @@
+package engine
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/474420502/xjson/internal/core"
+)
+
+const storeDoc = `{"store":{"book":[
+	{"title":"A","available":true,"meta":{"isbn":"1"}},
+	{"title":"B","available":false,"meta":{"isbn":"2"}},
+	{"title":"C","available":true,"meta":{"isbn":"3"}}
+]}}`
+
+func TestMatchSetSetWritesEveryMatch(t *testing.T) {
+	forEachParser(t, storeDoc, func(t *testing.T, root core.Node) {
+		res := root.Query("/store/book[?(@.available == true)]").Set("discounted", true)
+		if !res.IsValid() {
+			t.Fatalf("Set failed: %v", res.Error())
+		}
+		got := root.Query("/store/book[?(@.discounted == true)]/title").Strings()
+		if len(got) != 2 || got[0] != "A" || got[1] != "C" {
+			t.Fatalf("fresh query = %v, want [A C]", got)
+		}
+
+		reparsed, err := Parse([]byte(root.String()))
+		if err != nil {
+			t.Fatalf("reparse failed: %v", err)
+		}
+		if !reparsed.Query("/store/book[0]/discounted").Bool() || reparsed.Has("/store/book[1]/discounted") {
+			t.Fatalf("unexpected serialization: %s", root.String())
+		}
+	})
+}
+
+func TestMatchSetWritesThroughRecursiveMatches(t *testing.T) {
+	forEachParser(t, storeDoc, func(t *testing.T, root core.Node) {
+		if res := root.Query("//meta").Set("checked", true); !res.IsValid() {
+			t.Fatalf("Set failed: %v", res.Error())
+		}
+		if n := root.Query("/store/book/*/meta/checked").Len(); n != 3 {
+			t.Fatalf("expected 3 checked metas, got %d in %s", n, root.String())
+		}
+
+		if res := root.Query("//isbn").SetValue("x"); !res.IsValid() || res.Len() != 3 {
+			t.Fatalf("SetValue failed: %v", res.Error())
+		}
+		got := root.Query("/store/book/*/meta/isbn").Strings()
+		if len(got) != 3 || got[0] != "x" || got[2] != "x" {
+			t.Fatalf("isbn after SetValue = %v", got)
+		}
+	})
+}
+
+func TestMatchSetDelete(t *testing.T) {
+	root, err := Parse([]byte(storeDoc))
+	if err != nil {
+		t.Fatalf("parse failed: %v", err)
+	}
+	if res := root.Query("/store/book/*").Delete("meta"); !res.IsValid() {
+		t.Fatalf("Delete failed: %v", res.Error())
+	}
+	if root.Has("//meta") {
+		t.Fatalf("meta still present: %s", root.String())
+	}
+
+	// A match without the key refuses the whole delete.
+	root, _ = Parse([]byte(`{"a":[{"k":1},{"j":2}]}`))
+	res := root.Query("/a/*").Delete("k")
+	if res.IsValid() {
+		t.Fatal("expected an error when one match lacks the key")
+	}
+	if !root.Has("/a[0]/k") {
+		t.Fatalf("partial delete applied: %s", root.String())
+	}
+}
+
+func TestMatchSetWritesAreAllOrNothing(t *testing.T) {
+	root, err := Parse([]byte(storeDoc))
+	if err != nil {
+		t.Fatalf("parse failed: %v", err)
+	}
+	before := root.String()
+
+	res := root.Query("/store/book/*/title").Set("x", 1)
+	if res.IsValid() || !errors.Is(res.Error(), core.ErrTypeAssertion) {
+		t.Fatalf("expected ErrTypeAssertion, got %v", res.Error())
+	}
+	if res := root.Query("/store/book/*").Set("bad", make(chan int)); res.IsValid() {
+		t.Fatal("expected an unsupported value to be rejected")
+	}
+	if res := root.Query("/store/book/*").SetValue(func() {}); res.IsValid() {
+		t.Fatal("expected SetValue with an unsupported value to be rejected")
+	}
+	if root.String() != before {
+		t.Fatalf("document changed by rejected writes: %s", root.String())
+	}
+
+	// Empty match sets accept writes and change nothing.
+	if res := root.Query("/store/book[?(@.title == 'Z')]").Set("x", 1); !res.IsValid() {
+		t.Fatalf("write on empty match set failed: %v", res.Error())
+	}
+}
+
+func TestMatchSetSetIndex(t *testing.T) {
+	forEachParser(t, `{"a":{"tags":["x","y"]},"b":{"tags":["z"]},"c":{"tags":{"0":"o"}}}`, func(t *testing.T, root core.Node) {
+		if res := root.Query("//tags").SetIndex(-1, "last"); !errors.Is(res.Error(), core.ErrTypeAssertion) {
+			t.Fatalf("SetIndex with an object match: got %v, want ErrTypeAssertion", res.Error())
+		}
+		if res := root.Query("*/tags").Limit(2).SetIndex(1, "v"); !errors.Is(res.Error(), core.ErrIndexOutOfBounds) {
+			t.Fatalf("SetIndex past a short match: got %v, want ErrIndexOutOfBounds", res.Error())
+		}
+		if got := root.String(); got != `{"a":{"tags":["x","y"]},"b":{"tags":["z"]},"c":{"tags":{"0":"o"}}}` {
+			t.Fatalf("failed writes changed the document: %s", got)
+		}
+		if res := root.Query("*/tags").Limit(2).SetIndex(-1, "last"); !res.IsValid() {
+			t.Fatalf("SetIndex failed: %v", res.Error())
+		}
+		if got := root.Query("/a/tags").String() + root.Query("/b/tags").String(); got != `["x","last"]["last"]` {
+			t.Fatalf("unexpected arrays after SetIndex: %s", got)
+		}
+	})
+}
+
+func TestCallbacksWriteThroughToTheDocument(t *testing.T) {
+	queries := map[string]int{
+		"/store/book":                         3, // the array itself
+		"/store/book[?(@.available == true)]": 2,
+		"/store/book/*":                       3,
+		"//meta":                              3,
+		"/store/book[*]/meta":                 3,
+		"/store//*[?(@.title)]":               3,
+	}
+	callbacks := map[string]func(res core.Node, write func(v core.Node)){
+		"ForEach": func(res core.Node, write func(v core.Node)) {
+			res.ForEach(func(_ interface{}, v core.Node) { write(v) })
+		},
+		"Filter": func(res core.Node, write func(v core.Node)) {
+			res.Filter(func(v core.Node) bool { write(v); return true })
+		},
+		"Map": func(res core.Node, write func(v core.Node)) {
+			res.Map(func(v core.Node) interface{} { write(v); return nil })
+		},
+	}
+	for name, parse := range testParsers {
+		for path, want := range queries {
+			for cbName, each := range callbacks {
+				root, err := parse([]byte(storeDoc))
+				if err != nil {
+					t.Fatalf("parse failed: %v", err)
+				}
+				n := 0
+				each(root.Query(path), func(v core.Node) {
+					n++
+					if res := v.Set("seen", n); !res.IsValid() {
+						t.Errorf("%s %s %s: Set failed: %v", name, path, cbName, res.Error())
+					}
+					if v.Get("isbn").IsValid() {
+						v.Get("isbn").SetValue("x")
+					} else {
+						v.Get("meta").Get("isbn").SetValue("x")
+					}
+				})
+				if n != want {
+					t.Fatalf("%s %s %s: the callback ran %d times, want %d", name, path, cbName, n, want)
+				}
+
+				if got := root.Query("//seen").MatchCount(); got != want {
+					t.Errorf("%s %s %s: a fresh query finds %d writes, want %d: %s", name, path, cbName, got, want, root.String())
+				}
+				reparsed, err := Parse([]byte(root.String()))
+				if err != nil {
+					t.Fatalf("%s %s %s: reparse failed: %v", name, path, cbName, err)
+				}
+				if got := reparsed.Query("//seen").MatchCount(); got != want {
+					t.Errorf("%s %s %s: the output holds %d writes, want %d: %s", name, path, cbName, got, want, root.String())
+				}
+				if got := reparsed.Query("//isbn[?(@ == 'x')]").MatchCount(); got != want {
+					t.Errorf("%s %s %s: the output holds %d replaced values, want %d: %s", name, path, cbName, got, want, root.String())
+				}
+			}
+		}
+	}
+}
+
+func TestElementCallbacksWriteThroughToTheDocument(t *testing.T) {
+	root, err := Parse([]byte(`{"a":{"list":[{"v":1},{"v":2}]},"b":{"list":[{"v":3}]}}`))
+	if err != nil {
+		t.Fatalf("Parse failed: %v", err)
+	}
+	root.Query("//list").FilterElements(func(i int, v core.Node) bool {
+		v.Set("i", i)
+		return true
+	})
+	if got := root.String(); got != `{"a":{"list":[{"v":1,"i":0},{"v":2,"i":1}]},"b":{"list":[{"v":3,"i":0}]}}` {
+		t.Errorf("after FilterElements the document is %s", got)
+	}
+
+	// Matches from other documents are passed as they are.
+	other, _ := Parse([]byte(`[{"v":4}]`))
+	joined := newMatchSet(nil, []core.Node{root.Query("/b/list[0]"), other.Index(0)}, nil)
+	joined.ForEach(func(_ interface{}, v core.Node) { v.Set("j", true) })
+	if root.Query("/b/list[0]/j").Bool() != true || other.Query("[0]/j").Bool() != true {
+		t.Errorf("a joined set wrote %s and %s", root.String(), other.String())
+	}
+}
+
+// SetValue through a child reached before its parent was parsed in full
+// keeps the members the parse had not reached, as after MustParse.
+func TestSetValueKeepsUnparsedSiblings(t *testing.T) {
+	testCases := []struct {
+		name string
+		doc  string
+		edit func(root core.Node) core.Node
+		want string
+	}{
+		{"Get first key", `{"a":1,"b":2,"c":{"d":3}}`,
+			func(root core.Node) core.Node { return root.Get("a").SetValue(5) },
+			`{"a":5,"b":2,"c":{"d":3}}`},
+		{"Get last key", `{"a":1,"b":2,"c":{"d":3}}`,
+			func(root core.Node) core.Node { return root.Get("c").Get("d").SetValue("x") },
+			`{"a":1,"b":2,"c":{"d":"x"}}`},
+		{"Index", `[1,2,3]`,
+			func(root core.Node) core.Node { return root.Index(1).SetValue("q") },
+			`[1,"q",3]`},
+		{"Index first", `[[1,2],3]`,
+			func(root core.Node) core.Node { return root.Index(0).Index(0).SetValue(nil) },
+			`[[null,2],3]`},
+		{"Query key", `{"a":1,"z":2,"c":{"d":3}}`,
+			func(root core.Node) core.Node { return root.Query("/z").SetValue(false) },
+			`{"a":1,"z":false,"c":{"d":3}}`},
+		{"Query index", `{"p":[1,2,3],"q":4}`,
+			func(root core.Node) core.Node { return root.Query("/p[0]").SetValue(0) },
+			`{"p":[0,2,3],"q":4}`},
+	}
+	for _, tc := range testCases {
+		for name, parse := range testParsers {
+			root, err := parse([]byte(tc.doc))
+			if err != nil {
+				t.Fatalf("%s/%s: parse failed: %v", tc.name, name, err)
+			}
+			if res := tc.edit(root); !res.IsValid() {
+				t.Fatalf("%s/%s: SetValue failed: %v", tc.name, name, res.Error())
+			}
+			if got := root.String(); got != tc.want {
+				t.Errorf("%s/%s: got %s, want %s", tc.name, name, got, tc.want)
+			}
+		}
+	}
+}
+
+func TestSelectionWritesThroughToTheDocument(t *testing.T) {
+	const doc = `{"a":[{"x":1},{"x":2},{"x":3},{"x":4}]}`
+	selections := []struct {
+		name     string
+		get      func(root core.Node) core.Node
+		selected [4]bool
+	}{
+		{"slice", func(root core.Node) core.Node { return root.Query("/a[1:3]") }, [4]bool{false, true, true, false}},
+		{"Limit", func(root core.Node) core.Node { return root.Get("a").Limit(2) }, [4]bool{true, true, false, false}},
+		{"Offset", func(root core.Node) core.Node { return root.Get("a").Offset(2) }, [4]bool{false, false, true, true}},
+	}
+	writes := []struct {
+		name  string
+		write func(sel core.Node) core.Node
+		// elem is what a selected element becomes; "" for a write that
+		// fails and changes nothing.
+		elem string
+	}{
+		{"Set", func(sel core.Node) core.Node { return sel.Set("k", 1) }, `{"x":%d,"k":1}`},
+		{"Delete", func(sel core.Node) core.Node { return sel.Delete("x") }, `{}`},
+		{"SetValue", func(sel core.Node) core.Node { return sel.SetValue(0) }, `0`},
+		{"Delete index", func(sel core.Node) core.Node { return sel.Delete("0") }, ``},
+		{"SetIndex", func(sel core.Node) core.Node { return sel.SetIndex(0, 7) }, ``},
+	}
+	for _, sel := range selections {
+		for _, w := range writes {
+			for name, parse := range testParsers {
+				root, err := parse([]byte(doc))
+				if err != nil {
+					t.Fatalf("parse failed: %v", err)
+				}
+				res := w.write(sel.get(root))
+				want := doc
+				if w.elem != "" {
+					if !res.IsValid() {
+						t.Fatalf("%s/%s/%s: write failed: %v", sel.name, w.name, name, res.Error())
+					}
+					elems := make([]string, 4)
+					for i := range elems {
+						elems[i] = fmt.Sprintf(`{"x":%d}`, i+1)
+						if sel.selected[i] {
+							elems[i] = strings.Replace(w.elem, "%d", strconv.Itoa(i+1), 1)
+						}
+					}
+					want = `{"a":[` + strings.Join(elems, ",") + `]}`
+				} else if res.IsValid() {
+					t.Errorf("%s/%s/%s: write on objects should fail", sel.name, w.name, name)
+				}
+				if got := root.String(); got != want {
+					t.Errorf("%s/%s/%s: document = %s, want %s", sel.name, w.name, name, got, want)
+				}
+				for i := 0; i < 4; i++ {
+					if err := root.Get("a").Index(i).Error(); err != nil {
+						t.Errorf("%s/%s/%s: /a[%d] = %v", sel.name, w.name, name, i, err)
+					}
+				}
+			}
+		}
+	}
+
+	for name, parse := range testParsers {
+		root, err := parse([]byte(doc))
+		if err != nil {
+			t.Fatalf("parse failed: %v", err)
+		}
+		sel := root.Query("/a[1:3]")
+		if res := root.Get("a").Delete("1"); !res.IsValid() {
+			t.Fatalf("%s: Delete failed: %v", name, res.Error())
+		}
+		if !errors.Is(sel.Error(), core.ErrStaleResult) {
+			t.Errorf("%s: selection after one of its elements was removed = %v, want ErrStaleResult", name, sel.Error())
+		}
+
+		root, _ = parse([]byte(doc))
+		if n, err := root.DeleteAll("/a[1:3]"); n != 2 || err != nil {
+			t.Errorf("%s: DeleteAll = %d, %v, want 2", name, n, err)
+		}
+		if got := root.String(); got != `{"a":[{"x":1},{"x":4}]}` {
+			t.Errorf("%s: after DeleteAll = %s", name, got)
+		}
+
+		// Like a match set, a selection takes appended values itself.
+		root, _ = parse([]byte(doc))
+		sel = root.Get("a").Limit(2)
+		if res := sel.Append(9); !res.IsValid() || res.String() != `[{"x":1},{"x":2},9]` {
+			t.Errorf("%s: Append on a selection = %s, %v", name, res.String(), res.Error())
+		}
+		if got := root.String(); got != doc {
+			t.Errorf("%s: Append on a selection changed the document: %s", name, got)
+		}
+	}
+}
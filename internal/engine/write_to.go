@@ -0,0 +1,145 @@
+package engine
+
+import (
+	"io"
+
+	"github.com/474420502/xjson/internal/core"
+)
+
+// streamChunkSize is how much encoded text a streamWriter gathers before
+// writing it out. Source text at least this long is written as it is.
+const streamChunkSize = 32 << 10
+
+// streamWriter is the jsonWriter of WriteTo. Small pieces, such as
+// separators and re-encoded values, are gathered into chunks, while long
+// runs of source text go to w without being copied. The first error of w
+// is kept and every later write is dropped.
+type streamWriter struct {
+	w   io.Writer
+	buf []byte
+	n   int64
+	err error
+}
+
+func (s *streamWriter) Write(p []byte) (int, error) {
+	if !s.room(len(p)) {
+		if s.err == nil {
+			n, err := s.w.Write(p)
+			s.wrote(n, len(p), err)
+		}
+		return len(p), s.err
+	}
+	s.buf = append(s.buf, p...)
+	return len(p), nil
+}
+
+func (s *streamWriter) WriteByte(c byte) error {
+	if !s.room(1) {
+		return s.err
+	}
+	s.buf = append(s.buf, c)
+	return nil
+}
+
+func (s *streamWriter) WriteString(str string) (int, error) {
+	if !s.room(len(str)) {
+		if s.err == nil {
+			n, err := io.WriteString(s.w, str)
+			s.wrote(n, len(str), err)
+		}
+		return len(str), s.err
+	}
+	s.buf = append(s.buf, str...)
+	return len(str), nil
+}
+
+// room makes space in the chunk for size more bytes, writing the chunk out
+// first when they do not fit. It reports false when w has failed or size
+// is too large for a chunk, which is then written on its own.
+func (s *streamWriter) room(size int) bool {
+	if s.err != nil {
+		return false
+	}
+	if len(s.buf)+size > streamChunkSize {
+		if s.flush() != nil || size >= streamChunkSize {
+			return false
+		}
+	}
+	if s.buf == nil {
+		s.buf = make([]byte, 0, streamChunkSize)
+	}
+	return true
+}
+
+// flush writes out the gathered chunk.
+func (s *streamWriter) flush() error {
+	if s.err == nil && len(s.buf) > 0 {
+		n, err := s.w.Write(s.buf)
+		s.wrote(n, len(s.buf), err)
+		s.buf = s.buf[:0]
+	}
+	return s.err
+}
+
+// wrote counts the n bytes w accepted of want and keeps its error; a
+// short write without one is io.ErrShortWrite.
+func (s *streamWriter) wrote(n, want int, err error) {
+	s.n += int64(n)
+	if err == nil && n < want {
+		err = io.ErrShortWrite
+	}
+	s.err = err
+}
+
+// stopped reports whether buf is a stream whose writer has failed, so that
+// the rest of a value need not be encoded.
+func stopped(buf jsonWriter) bool {
+	s, ok := buf.(*streamWriter)
+	return ok && s.err != nil
+}
+
+// WriteTo writes the encoding of the node to w, the text Bytes returns,
+// and reports how many bytes w accepted. Unmodified subtrees go to w from
+// their source without being copied, and only modified parts are encoded,
+// a chunk at a time, so the whole text is never held in memory. The first
+// error of w stops the encoding and is returned; the text written up to it
+// is then incomplete.
+func (n *baseNode) WriteTo(w io.Writer) (int64, error) {
+	if n.err != nil {
+		return 0, n.err
+	}
+	self := n.selfOrMe()
+	if arr, ok := self.(*arrayNode); ok {
+		arr.checkMatches()
+		if arr.err == nil && arr.matchSet {
+			switch len(arr.value) {
+			case 0:
+				return 0, core.ErrNoMatches
+			case 1:
+				return arr.value[0].WriteTo(w)
+			}
+		}
+	}
+	if err := self.Error(); err != nil {
+		return 0, err
+	}
+	if documentLeniency(n).nonFinite {
+		// Refuse a non-finite number before anything is written.
+		if _, err := self.Bytes(); err != nil {
+			return 0, err
+		}
+	}
+	s := &streamWriter{w: w}
+	switch typed := self.(type) {
+	case *objectNode:
+		typed.writeJSON(s)
+	case *arrayNode:
+		typed.writeJSON(s)
+	default:
+		writeJSONValue(s, self)
+	}
+	if err := self.Error(); err != nil {
+		return s.n, err
+	}
+	return s.n, s.flush()
+}
@@ -0,0 +1,240 @@
+package engine
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"testing"
+
+	"github.com/474420502/xjson/internal/core"
+)
+
+func TestWriteToMatchesBytes(t *testing.T) {
+	testCases := []struct {
+		name  string
+		edit  func(root core.Node) core.Node
+		query string
+	}{
+		{name: "unmodified"},
+		{name: "set scalar", edit: func(root core.Node) core.Node { return root.Set("b", 2) }},
+		{name: "nested set", edit: func(root core.Node) core.Node { return root.Get("c").Set("y", "new\n") }},
+		{name: "add key", edit: func(root core.Node) core.Node {
+			return root.Set("d", map[string]interface{}{"k": []interface{}{1.5, nil}})
+		}},
+		{name: "delete every key", edit: func(root core.Node) core.Node {
+			root.Delete("a")
+			root.Delete("b")
+			return root.Delete("c")
+		}},
+		{name: "append", edit: func(root core.Node) core.Node { return root.Get("a").Append(3) }},
+		{name: "insert first", edit: func(root core.Node) core.Node { return root.Get("a").InsertAt(0, "x") }},
+		{name: "delete element", edit: func(root core.Node) core.Node { return root.Get("a").Delete("1") }},
+		{name: "array", query: "/a"},
+		{name: "string", query: "/c/x"},
+		{name: "number", query: "/c/y"},
+		{name: "slice", query: "/a[0:2]"},
+		{name: "matches", query: "/a[*]"},
+		{name: "single match", query: "/a[?(@ == 1)]"},
+		{name: "edited matches", edit: func(root core.Node) core.Node { return root.Get("c").Set("x", "é") }, query: "//x"},
+	}
+	for _, tc := range testCases {
+		for name, parse := range testParsers {
+			t.Run(tc.name+"/"+name, func(t *testing.T) {
+				root, err := parse([]byte(spliceDoc))
+				if err != nil {
+					t.Fatalf("parse failed: %v", err)
+				}
+				if tc.edit != nil {
+					if res := tc.edit(root); !res.IsValid() {
+						t.Fatalf("edit failed: %v", res.Error())
+					}
+				}
+				node := root
+				if tc.query != "" {
+					node = root.Query(tc.query)
+				}
+				want, err := node.Bytes()
+				if err != nil {
+					t.Fatalf("Bytes failed: %v", err)
+				}
+				var buf bytes.Buffer
+				n, err := node.WriteTo(&buf)
+				if err != nil || n != int64(len(want)) || buf.String() != string(want) {
+					t.Fatalf("WriteTo = %d, %v, %q, want %d bytes %q", n, err, buf.String(), len(want), want)
+				}
+			})
+		}
+	}
+}
+
+func TestWriteToErrors(t *testing.T) {
+	root, err := Parse([]byte(spliceDoc))
+	if err != nil {
+		t.Fatalf("Parse failed: %v", err)
+	}
+	var buf bytes.Buffer
+	if n, err := root.Query("/a[?(@ == 9)]").WriteTo(&buf); !errors.Is(err, core.ErrNoMatches) || n != 0 {
+		t.Errorf("no match = %d, %v, want ErrNoMatches", n, err)
+	}
+	missing := root.Query("/missing")
+	if _, err := missing.WriteTo(&buf); err == nil || err.Error() != missing.Error().Error() {
+		t.Errorf("missing value = %v, want %v", err, missing.Error())
+	}
+	if buf.Len() != 0 {
+		t.Errorf("failed WriteTo wrote %q", buf.String())
+	}
+}
+
+// failingWriter accepts limit bytes and then fails every write.
+type failingWriter struct {
+	limit   int
+	written bytes.Buffer
+	failed  int
+}
+
+var errWriterFull = errors.New("writer full")
+
+func (w *failingWriter) Write(p []byte) (int, error) {
+	if room := w.limit - w.written.Len(); len(p) > room {
+		w.written.Write(p[:room])
+		w.failed++
+		return room, errWriterFull
+	}
+	return w.written.Write(p)
+}
+
+func TestWriteToStopsAtWriterError(t *testing.T) {
+	doc := largeDoc(300 << 10)
+	edits := map[string]func(root core.Node) core.Node{
+		"unmodified": func(root core.Node) core.Node { return root },
+		"edited": func(root core.Node) core.Node {
+			root.Get("items").Index(3).Set("label", string(bytes.Repeat([]byte("long "), 10<<10)))
+			return root.Get("user").Set("name", "bob")
+		},
+	}
+	for name, edit := range edits {
+		root, err := Parse(doc)
+		if err != nil {
+			t.Fatalf("Parse failed: %v", err)
+		}
+		if res := edit(root); !res.IsValid() {
+			t.Fatalf("%s: edit failed: %v", name, res.Error())
+		}
+		want, err := root.Bytes()
+		if err != nil {
+			t.Fatalf("%s: Bytes failed: %v", name, err)
+		}
+		for _, limit := range []int{0, 1, 100, streamChunkSize - 1, streamChunkSize + 1, len(want) / 2, len(want) - 1} {
+			w := &failingWriter{limit: limit}
+			n, err := root.WriteTo(w)
+			if !errors.Is(err, errWriterFull) || n != int64(limit) {
+				t.Errorf("%s, limit %d: WriteTo = %d, %v, want %d, %v", name, limit, n, err, limit, errWriterFull)
+			}
+			if w.failed != 1 {
+				t.Errorf("%s, limit %d: writer called %d times after failing", name, limit, w.failed-1)
+			}
+			if !bytes.Equal(w.written.Bytes(), want[:limit]) {
+				t.Errorf("%s, limit %d: written text is not a prefix of Bytes", name, limit)
+			}
+		}
+		w := &failingWriter{limit: len(want)}
+		if n, err := root.WriteTo(w); err != nil || n != int64(len(want)) || !bytes.Equal(w.written.Bytes(), want) {
+			t.Errorf("%s: WriteTo with room for all = %d, %v", name, n, err)
+		}
+	}
+}
+
+// shortWriter accepts half of every write without an error.
+type shortWriter struct{}
+
+func (shortWriter) Write(p []byte) (int, error) { return len(p) / 2, nil }
+
+func TestWriteToShortWrite(t *testing.T) {
+	root, err := Parse([]byte(spliceDoc))
+	if err != nil {
+		t.Fatalf("Parse failed: %v", err)
+	}
+	root.Set("b", 2)
+	if n, err := root.WriteTo(shortWriter{}); !errors.Is(err, io.ErrShortWrite) || n != int64(len(root.String())/2) {
+		t.Errorf("WriteTo = %d, %v, want io.ErrShortWrite", n, err)
+	}
+}
+
+// countingWriter records the size of every write.
+type countingWriter struct{ sizes []int }
+
+func (w *countingWriter) Write(p []byte) (int, error) {
+	w.sizes = append(w.sizes, len(p))
+	return len(p), nil
+}
+
+func TestWriteToStreamsSource(t *testing.T) {
+	doc := largeDoc(1 << 20)
+	root, err := Parse(doc)
+	if err != nil {
+		t.Fatalf("Parse failed: %v", err)
+	}
+	// An unmodified document is its source, written in one piece.
+	w := &countingWriter{}
+	if _, err := root.WriteTo(w); err != nil || len(w.sizes) != 1 || w.sizes[0] != len(doc) {
+		t.Errorf("unmodified WriteTo made writes of %v, want one of %d", w.sizes, len(doc))
+	}
+
+	// After an edit the untouched items array still goes out in one piece,
+	// and nothing else exceeds a chunk.
+	root.Get("user").Set("name", "bob")
+	items := root.Get("items").Raw()
+	w = &countingWriter{}
+	if _, err := root.WriteTo(w); err != nil {
+		t.Fatalf("WriteTo failed: %v", err)
+	}
+	whole := 0
+	for _, size := range w.sizes {
+		if size == len(items) {
+			whole++
+		} else if size > streamChunkSize {
+			t.Errorf("write of %d bytes, more than a chunk", size)
+		}
+	}
+	if whole != 1 {
+		t.Errorf("writes %v, want the %d bytes of items in one", w.sizes, len(items))
+	}
+}
+
+// BenchmarkWriteTo serializes a 5MB document to io.Discard, unmodified and
+// after an edit, with Bytes and Write and with WriteTo. B/op shows that
+// WriteTo never holds the output, while Bytes copies all of it.
+func BenchmarkWriteTo(b *testing.B) {
+	doc := largeDoc(5 << 20)
+	for _, edited := range []bool{false, true} {
+		root, err := Parse(doc)
+		if err != nil {
+			b.Fatal(err)
+		}
+		name := "unmodified"
+		if edited {
+			name = "edited"
+			if res := root.SetByPath("/user/name", "bob"); !res.IsValid() {
+				b.Fatal(res.Error())
+			}
+		}
+		b.Run(name+"/Bytes", func(b *testing.B) {
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				data, err := root.Bytes()
+				if err != nil {
+					b.Fatal(err)
+				}
+				io.Discard.Write(data)
+			}
+		})
+		b.Run(name+"/WriteTo", func(b *testing.B) {
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				if _, err := root.WriteTo(io.Discard); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
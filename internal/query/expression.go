@@ -0,0 +1,607 @@
+package query
+
+import (
+	"fmt"
+	"strconv"
+	"time"
+)
+
+// Expression is a node of a parsed filter expression such as
+// `@.price < 10 && @.tags[0] == 'go'`.
+type Expression interface {
+	isExpression()
+}
+
+// ExpressionLiteral is a constant operand. Value holds a float64, string,
+// bool or nil (JSON null).
+type ExpressionLiteral struct {
+	Value interface{}
+}
+
+// ExpressionPath references a value relative to the element currently being
+// filtered (@), or to the root of its document ($) when Root is set.
+// Segments only contain OpKey and OpIndex tokens; an empty segment list
+// refers to the element or the root itself.
+type ExpressionPath struct {
+	Segments []QueryToken
+	Root     bool
+}
+
+// ExpressionUnary applies a prefix operator ("!" or "-") to its operand.
+type ExpressionUnary struct {
+	Op      string
+	Operand Expression
+}
+
+// ExpressionBinary combines two operands with a logical ("&&", "||"),
+// comparison ("==", "!=", "<", "<=", ">", ">=") or arithmetic
+// ("+", "-", "*", "/", "%") operator.
+type ExpressionBinary struct {
+	Op    string
+	Left  Expression
+	Right Expression
+}
+
+// ExpressionCall is a call to one of the built-in filter functions such as
+// is_string(@.price), position() or time(@.ts).
+type ExpressionCall struct {
+	Name string
+	Args []Expression
+}
+
+func (ExpressionLiteral) isExpression() {}
+func (ExpressionPath) isExpression()    {}
+func (ExpressionUnary) isExpression()   {}
+func (ExpressionBinary) isExpression()  {}
+func (ExpressionCall) isExpression()    {}
+
+// typeTestFunctions are the filter functions that test the type of the value
+// at a path. is_missing holds exactly when the path resolves to nothing.
+var typeTestFunctions = map[string]bool{
+	"is_string":  true,
+	"is_number":  true,
+	"is_bool":    true,
+	"is_null":    true,
+	"is_array":   true,
+	"is_object":  true,
+	"is_missing": true,
+}
+
+// positionFunctions take no arguments and evaluate to the zero-based index
+// of the element being filtered; index() is an alias of position().
+var positionFunctions = map[string]bool{
+	"position": true,
+	"index":    true,
+}
+
+// timeFunctions convert their argument, a path or a string literal, to an
+// instant that compares with other instants; datetime() is an alias of
+// time().
+var timeFunctions = map[string]bool{
+	"time":     true,
+	"datetime": true,
+}
+
+// setFunctions test the elements of the array at a path, their first
+// argument, against the literals that follow it: contains_all holds when
+// every literal is an element, contains_any when one is.
+var setFunctions = map[string]bool{
+	"contains_all": true,
+	"contains_any": true,
+}
+
+// filterTimeLayouts are the spellings time() accepts: RFC 3339 with optional
+// fractional seconds, and a bare date standing for midnight UTC.
+var filterTimeLayouts = []string{time.RFC3339Nano, "2006-01-02"}
+
+// ParseFilterTime parses s as the argument of time(). It reports false when
+// s is in none of the accepted layouts.
+func ParseFilterTime(s string) (time.Time, bool) {
+	for _, layout := range filterTimeLayouts {
+		if t, err := time.Parse(layout, s); err == nil {
+			return t, true
+		}
+	}
+	return time.Time{}, false
+}
+
+// parseFilterExpression parses a `[?(...)]` bracket starting at the '?' and
+// returns the expression together with the position after the closing ']'.
+func parseFilterExpression(input string, start int) (Expression, int, error) {
+	i := start + 1
+	if i >= len(input) || input[i] != '(' {
+		return nil, 0, fmt.Errorf("expected '(' after '?' at position %d", start)
+	}
+	p := &exprParser{input: input, pos: i + 1}
+	expr, err := p.parseOr()
+	if err != nil {
+		return nil, 0, err
+	}
+	p.skipSpaces()
+	if p.pos >= len(input) || input[p.pos] != ')' {
+		return nil, 0, fmt.Errorf("expected ')' to close filter at position %d", p.pos)
+	}
+	p.pos++
+	p.skipSpaces()
+	if p.pos >= len(input) || input[p.pos] != ']' {
+		return nil, 0, fmt.Errorf("expected ']' after filter expression")
+	}
+	return expr, p.pos + 1, nil
+}
+
+// predicateOps are the comparisons of an attribute predicate, longest
+// first; "=" is the XPath spelling of "==".
+var predicateOps = []string{"==", "!=", "<=", ">=", "<", ">", "="}
+
+// parseAttributePredicate parses the XPath shorthand of a filter starting
+// after the '[': `[key='value']`, `[@key='value']` or `['a key'='value']`,
+// with any comparison of filters and a string, number, bool or null literal.
+// It returns the expression `@.key op literal`, which filters like the
+// bracket `[?(...)]` it stands for, and the position after the ']'. It
+// reports false, having read nothing, when the bracket is not a predicate:
+// no comparison follows the key.
+func parseAttributePredicate(input string, start int) (Expression, int, bool, error) {
+	p := &exprParser{input: input, pos: start}
+	p.skipSpaces()
+	if p.pos < len(input) && input[p.pos] == '@' {
+		p.pos++
+	}
+	var key string
+	if p.pos < len(input) && (input[p.pos] == '\'' || input[p.pos] == '"') {
+		quoted, next, err := parseQuotedKey(input, p.pos)
+		if err != nil {
+			return nil, 0, false, nil
+		}
+		key, p.pos = quoted, next
+	} else {
+		from := p.pos
+		if p.pos < len(input) && isIdentStart(input[p.pos]) {
+			for p.pos < len(input) && (isIdentStart(input[p.pos]) || input[p.pos] == '-' || input[p.pos] >= '0' && input[p.pos] <= '9') {
+				p.pos++
+			}
+		}
+		key = input[from:p.pos]
+		if key == "" {
+			return nil, 0, false, nil
+		}
+	}
+	op := ""
+	for _, candidate := range predicateOps {
+		if p.consume(candidate) {
+			op = candidate
+			break
+		}
+	}
+	if op == "" {
+		return nil, 0, false, nil
+	}
+	if op == "=" {
+		op = "=="
+	}
+	value, err := p.parseUnary()
+	if err != nil {
+		return nil, 0, true, err
+	}
+	lit, ok := value.(ExpressionLiteral)
+	if !ok {
+		return nil, 0, true, fmt.Errorf("predicate on %q must compare with a string, number, bool or null literal", key)
+	}
+	p.skipSpaces()
+	if p.pos >= len(input) || input[p.pos] != ']' {
+		return nil, 0, true, fmt.Errorf("expected ']' after predicate on %q at position %d", key, p.pos)
+	}
+	path := ExpressionPath{Segments: []QueryToken{{Type: OpKey, Value: key}}}
+	return ExpressionBinary{Op: op, Left: path, Right: lit}, p.pos + 1, true, nil
+}
+
+type exprParser struct {
+	input string
+	pos   int
+}
+
+func (p *exprParser) skipSpaces() {
+	for p.pos < len(p.input) {
+		switch p.input[p.pos] {
+		case ' ', '\t', '\n', '\r':
+			p.pos++
+		default:
+			return
+		}
+	}
+}
+
+// consume advances past op when it is the next token.
+func (p *exprParser) consume(op string) bool {
+	p.skipSpaces()
+	if len(p.input)-p.pos >= len(op) && p.input[p.pos:p.pos+len(op)] == op {
+		p.pos += len(op)
+		return true
+	}
+	return false
+}
+
+func (p *exprParser) parseOr() (Expression, error) {
+	left, err := p.parseAnd()
+	if err != nil {
+		return nil, err
+	}
+	for p.consume("||") {
+		right, err := p.parseAnd()
+		if err != nil {
+			return nil, err
+		}
+		left = ExpressionBinary{Op: "||", Left: left, Right: right}
+	}
+	return left, nil
+}
+
+func (p *exprParser) parseAnd() (Expression, error) {
+	left, err := p.parseComparison()
+	if err != nil {
+		return nil, err
+	}
+	for p.consume("&&") {
+		right, err := p.parseComparison()
+		if err != nil {
+			return nil, err
+		}
+		left = ExpressionBinary{Op: "&&", Left: left, Right: right}
+	}
+	return left, nil
+}
+
+func (p *exprParser) parseComparison() (Expression, error) {
+	left, err := p.parseAdditive()
+	if err != nil {
+		return nil, err
+	}
+	for _, op := range []string{"==", "!=", "<=", ">=", "<", ">"} {
+		if p.consume(op) {
+			right, err := p.parseAdditive()
+			if err != nil {
+				return nil, err
+			}
+			return ExpressionBinary{Op: op, Left: left, Right: right}, nil
+		}
+	}
+	return left, nil
+}
+
+func (p *exprParser) parseAdditive() (Expression, error) {
+	left, err := p.parseMultiplicative()
+	if err != nil {
+		return nil, err
+	}
+	for {
+		var op string
+		switch {
+		case p.consume("+"):
+			op = "+"
+		case p.consume("-"):
+			op = "-"
+		default:
+			return left, nil
+		}
+		right, err := p.parseMultiplicative()
+		if err != nil {
+			return nil, err
+		}
+		left = ExpressionBinary{Op: op, Left: left, Right: right}
+	}
+}
+
+func (p *exprParser) parseMultiplicative() (Expression, error) {
+	left, err := p.parseUnary()
+	if err != nil {
+		return nil, err
+	}
+	for {
+		var op string
+		switch {
+		case p.consume("*"):
+			op = "*"
+		case p.consume("/"):
+			op = "/"
+		case p.consume("%"):
+			op = "%"
+		default:
+			return left, nil
+		}
+		right, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		left = ExpressionBinary{Op: op, Left: left, Right: right}
+	}
+}
+
+func (p *exprParser) parseUnary() (Expression, error) {
+	p.skipSpaces()
+	if p.pos < len(p.input) && p.input[p.pos] == '!' {
+		p.pos++
+		operand, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		return ExpressionUnary{Op: "!", Operand: operand}, nil
+	}
+	if p.pos < len(p.input) && p.input[p.pos] == '-' {
+		p.pos++
+		operand, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		if lit, ok := operand.(ExpressionLiteral); ok {
+			if f, ok := lit.Value.(float64); ok {
+				return ExpressionLiteral{Value: -f}, nil
+			}
+		}
+		return ExpressionUnary{Op: "-", Operand: operand}, nil
+	}
+	return p.parsePrimary()
+}
+
+func (p *exprParser) parsePrimary() (Expression, error) {
+	p.skipSpaces()
+	if p.pos >= len(p.input) {
+		return nil, fmt.Errorf("unexpected end of filter expression")
+	}
+	c := p.input[p.pos]
+	switch {
+	case c == '(':
+		p.pos++
+		expr, err := p.parseOr()
+		if err != nil {
+			return nil, err
+		}
+		if !p.consume(")") {
+			return nil, fmt.Errorf("expected ')' at position %d", p.pos)
+		}
+		return expr, nil
+	case c == '@':
+		p.pos++
+		return p.parsePathSegments()
+	case c == '$':
+		p.pos++
+		path, err := p.parsePathSegments()
+		if err != nil {
+			return nil, err
+		}
+		rooted := path.(ExpressionPath)
+		rooted.Root = true
+		return rooted, nil
+	case c == '\'' || c == '"':
+		value, next, err := parseQuotedKey(p.input, p.pos)
+		if err != nil {
+			return nil, err
+		}
+		p.pos = next
+		return ExpressionLiteral{Value: value}, nil
+	case c >= '0' && c <= '9' || c == '.':
+		return p.parseNumber()
+	case isIdentStart(c):
+		name := p.readIdentifier()
+		switch name {
+		case "true":
+			return ExpressionLiteral{Value: true}, nil
+		case "false":
+			return ExpressionLiteral{Value: false}, nil
+		case "null":
+			return ExpressionLiteral{Value: nil}, nil
+		}
+		if p.pos < len(p.input) && p.input[p.pos] == '(' {
+			return p.parseCall(name)
+		}
+		return nil, fmt.Errorf("unknown identifier %q in filter expression", name)
+	}
+	return nil, fmt.Errorf("unexpected character '%c' in filter expression at position %d", c, p.pos)
+}
+
+// parseCall reads the parenthesized arguments of a filter function call; the
+// function name has already been read.
+func (p *exprParser) parseCall(name string) (Expression, error) {
+	if !typeTestFunctions[name] && !positionFunctions[name] && !timeFunctions[name] && !setFunctions[name] {
+		return nil, fmt.Errorf("unknown function %q in filter expression", name)
+	}
+	p.pos++ // skip '('
+	call := ExpressionCall{Name: name}
+	if !p.consume(")") {
+		for {
+			arg, err := p.parseOr()
+			if err != nil {
+				return nil, err
+			}
+			call.Args = append(call.Args, arg)
+			if p.consume(")") {
+				break
+			}
+			if !p.consume(",") {
+				return nil, fmt.Errorf("expected ',' or ')' in call to %s at position %d", name, p.pos)
+			}
+		}
+	}
+	if positionFunctions[name] {
+		if len(call.Args) != 0 {
+			return nil, fmt.Errorf("%s takes no arguments, got %d", name, len(call.Args))
+		}
+		return call, nil
+	}
+	if setFunctions[name] {
+		return parseSetCall(call)
+	}
+	if len(call.Args) != 1 {
+		return nil, fmt.Errorf("%s takes 1 argument, got %d", name, len(call.Args))
+	}
+	if timeFunctions[name] {
+		if lit, ok := call.Args[0].(ExpressionLiteral); ok {
+			s, isString := lit.Value.(string)
+			if !isString {
+				return nil, fmt.Errorf("%s expects a path or a string argument", name)
+			}
+			if _, ok := ParseFilterTime(s); !ok {
+				return nil, fmt.Errorf("%s: %q is not an RFC 3339 time or a date", name, s)
+			}
+			return call, nil
+		}
+	}
+	if _, ok := call.Args[0].(ExpressionPath); !ok {
+		if timeFunctions[name] {
+			return nil, fmt.Errorf("%s expects a path or a string argument", name)
+		}
+		return nil, fmt.Errorf("%s expects an @ path or $ path argument", name)
+	}
+	return call, nil
+}
+
+// parseSetCall checks the arguments of contains_all or contains_any: a path
+// followed by literals, with a negated number taken as a negative literal.
+func parseSetCall(call ExpressionCall) (Expression, error) {
+	if len(call.Args) == 0 {
+		return nil, fmt.Errorf("%s takes a path and literals, got no arguments", call.Name)
+	}
+	if _, ok := call.Args[0].(ExpressionPath); !ok {
+		return nil, fmt.Errorf("%s expects an @ path or $ path first argument", call.Name)
+	}
+	for i, arg := range call.Args[1:] {
+		if neg, ok := arg.(ExpressionUnary); ok && neg.Op == "-" {
+			if lit, ok := neg.Operand.(ExpressionLiteral); ok {
+				if f, ok := lit.Value.(float64); ok {
+					call.Args[i+1] = ExpressionLiteral{Value: -f}
+					continue
+				}
+			}
+		}
+		if _, ok := arg.(ExpressionLiteral); !ok {
+			return nil, fmt.Errorf("argument %d of %s must be a string, number, bool or null literal", i+2, call.Name)
+		}
+	}
+	return call, nil
+}
+
+// parseFuncCall reads the `name` or `name(arg, ...)` of a function bracket
+// starting at input[start], after the '@', and returns the call with the
+// position after the closing ']'. Arguments are literals, as in filters.
+func parseFuncCall(input string, start int) (FuncCall, int, error) {
+	p := &exprParser{input: input, pos: start}
+	call := FuncCall{Name: p.readIdentifier()}
+	if call.Name == "" || p.pos < len(input) && input[p.pos] != '(' && input[p.pos] != ']' {
+		name, _, _ := parseIdentifierSegment(input, start)
+		return FuncCall{}, 0, fmt.Errorf("invalid function name %q", name)
+	}
+	if p.pos < len(input) && input[p.pos] == '(' {
+		p.pos++
+		for !p.consume(")") {
+			if len(call.Args) > 0 && !p.consume(",") {
+				return FuncCall{}, 0, fmt.Errorf("expected ',' or ')' in call to %s at position %d", call.Name, p.pos)
+			}
+			arg, err := p.parseUnary()
+			if err != nil {
+				return FuncCall{}, 0, err
+			}
+			lit, ok := arg.(ExpressionLiteral)
+			if !ok || lit.Value == nil {
+				return FuncCall{}, 0, fmt.Errorf("argument %d of %s must be a string, number or bool literal", len(call.Args)+1, call.Name)
+			}
+			call.Args = append(call.Args, lit.Value)
+		}
+	}
+	if p.pos >= len(input) || input[p.pos] != ']' {
+		return FuncCall{}, 0, fmt.Errorf("expected ']' after function call")
+	}
+	return call, p.pos + 1, nil
+}
+
+// parsePathSegments reads the `.key`, `['key']` and `[index]` segments that
+// follow an '@' or '$'.
+func (p *exprParser) parsePathSegments() (Expression, error) {
+	path := ExpressionPath{}
+	for p.pos < len(p.input) {
+		switch p.input[p.pos] {
+		case '.':
+			p.pos++
+			if p.pos < len(p.input) && (p.input[p.pos] == '\'' || p.input[p.pos] == '"') {
+				key, next, err := parseQuotedKey(p.input, p.pos)
+				if err != nil {
+					return nil, err
+				}
+				p.pos = next
+				path.Segments = append(path.Segments, QueryToken{Type: OpKey, Value: key})
+				continue
+			}
+			name := p.readIdentifier()
+			if name == "" {
+				return nil, fmt.Errorf("expected key after '.' at position %d", p.pos)
+			}
+			path.Segments = append(path.Segments, QueryToken{Type: OpKey, Value: name})
+		case '[':
+			p.pos++
+			if p.pos < len(p.input) && (p.input[p.pos] == '\'' || p.input[p.pos] == '"') {
+				key, next, err := parseQuotedKey(p.input, p.pos)
+				if err != nil {
+					return nil, err
+				}
+				p.pos = next
+				if p.pos >= len(p.input) || p.input[p.pos] != ']' {
+					return nil, fmt.Errorf("expected ']' after quoted key")
+				}
+				p.pos++
+				path.Segments = append(path.Segments, QueryToken{Type: OpKey, Value: key})
+				continue
+			}
+			end := p.pos
+			for end < len(p.input) && p.input[end] != ']' {
+				end++
+			}
+			if end >= len(p.input) {
+				return nil, fmt.Errorf("unterminated index in filter path")
+			}
+			idx, ok := tryParseInt(p.input[p.pos:end])
+			if !ok {
+				return nil, fmt.Errorf("invalid index %q in filter path", p.input[p.pos:end])
+			}
+			p.pos = end + 1
+			path.Segments = append(path.Segments, QueryToken{Type: OpIndex, Value: idx})
+		default:
+			return path, nil
+		}
+	}
+	return path, nil
+}
+
+func (p *exprParser) parseNumber() (Expression, error) {
+	start := p.pos
+	for p.pos < len(p.input) {
+		c := p.input[p.pos]
+		if (c >= '0' && c <= '9') || c == '.' || c == 'e' || c == 'E' {
+			p.pos++
+			continue
+		}
+		if (c == '+' || c == '-') && p.pos > start && (p.input[p.pos-1] == 'e' || p.input[p.pos-1] == 'E') {
+			p.pos++
+			continue
+		}
+		break
+	}
+	f, err := strconv.ParseFloat(p.input[start:p.pos], 64)
+	if err != nil {
+		return nil, fmt.Errorf("invalid number %q in filter expression", p.input[start:p.pos])
+	}
+	return ExpressionLiteral{Value: f}, nil
+}
+
+func (p *exprParser) readIdentifier() string {
+	start := p.pos
+	for p.pos < len(p.input) {
+		c := p.input[p.pos]
+		if isIdentStart(c) || (p.pos > start && c >= '0' && c <= '9') {
+			p.pos++
+			continue
+		}
+		break
+	}
+	return p.input[start:p.pos]
+}
+
+func isIdentStart(c byte) bool {
+	return (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z') || c == '_'
+}
@@ -0,0 +1,204 @@
+package query
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+var opNames = [...]string{
+	OpKey:          "key",
+	OpIndex:        "index",
+	OpSlice:        "slice",
+	OpFunc:         "func",
+	OpWildcard:     "wildcard",
+	OpRecursiveKey: "recursive",
+	OpParent:       "parent",
+	OpAll:          "all",
+	OpFilter:       "filter",
+	OpPick:         "pick",
+}
+
+// String returns the name of the operation, such as "key" or "filter".
+func (op Op) String() string {
+	if op >= 0 && int(op) < len(opNames) {
+		return opNames[op]
+	}
+	return "Op(" + strconv.Itoa(int(op)) + ")"
+}
+
+// FormatToken writes t back as a path step such as "/name", "[2]", "[1:3]"
+// or "[?(@.price > 10)]". The steps of a path parse back to its tokens,
+// though not always to its text: "/*" comes back as "[*]".
+func FormatToken(t QueryToken) string {
+	switch t.Type {
+	case OpKey:
+		key, _ := t.Value.(string)
+		if plainKey(key) {
+			return "/" + key
+		}
+		return "[" + quote(key) + "]"
+	case OpIndex:
+		return fmt.Sprintf("[%v]", t.Value)
+	case OpSlice:
+		bounds, _ := t.Value.([2]int)
+		end := ""
+		if bounds[1] != -1 {
+			end = strconv.Itoa(bounds[1])
+		}
+		return "[" + strconv.Itoa(bounds[0]) + ":" + end + "]"
+	case OpFunc:
+		call, _ := t.Value.(FuncCall)
+		if len(call.Args) == 0 {
+			return "[@" + call.Name + "]"
+		}
+		args := make([]string, len(call.Args))
+		for i, arg := range call.Args {
+			args[i] = formatLiteral(arg)
+		}
+		return "[@" + call.Name + "(" + strings.Join(args, ", ") + ")]"
+	case OpWildcard:
+		return "[*]"
+	case OpRecursiveKey:
+		return fmt.Sprintf("//%v", t.Value)
+	case OpParent:
+		return "/.."
+	case OpAll:
+		return "//*"
+	case OpFilter:
+		expr, _ := t.Value.(Expression)
+		return "[?(" + FormatExpression(expr) + ")]"
+	case OpPick:
+		fields, _ := t.Value.([]string)
+		return "{" + strings.Join(fields, ", ") + "}"
+	}
+	return t.Type.String()
+}
+
+// plainKey reports whether key can be written as a path segment of its own
+// and read back as the same key.
+func plainKey(key string) bool {
+	if key == "" || isSpace(key[0]) || isSpace(key[len(key)-1]) || strings.ContainsAny(key, "/[]{}.@*()") {
+		return false
+	}
+	token, err := segmentToken(key)
+	return err == nil && token.Type == OpKey
+}
+
+// FormatExpression writes a filter expression back as text, with
+// parentheses only where the precedence of its operators needs them.
+func FormatExpression(e Expression) string {
+	switch e := e.(type) {
+	case ExpressionLiteral:
+		return formatLiteral(e.Value)
+	case ExpressionPath:
+		var b strings.Builder
+		if e.Root {
+			b.WriteByte('$')
+		} else {
+			b.WriteByte('@')
+		}
+		for _, seg := range e.Segments {
+			switch key, isKey := seg.Value.(string); {
+			case isKey && identifier(key):
+				b.WriteString("." + key)
+			case isKey:
+				b.WriteString("[" + quote(key) + "]")
+			default:
+				fmt.Fprintf(&b, "[%v]", seg.Value)
+			}
+		}
+		return b.String()
+	case ExpressionUnary:
+		operand := FormatExpression(e.Operand)
+		if _, ok := e.Operand.(ExpressionBinary); ok {
+			operand = "(" + operand + ")"
+		}
+		return e.Op + operand
+	case ExpressionBinary:
+		left, right := FormatExpression(e.Left), FormatExpression(e.Right)
+		if l, ok := e.Left.(ExpressionBinary); ok && precedence(l.Op) < precedence(e.Op) {
+			left = "(" + left + ")"
+		}
+		if r, ok := e.Right.(ExpressionBinary); ok && precedence(r.Op) <= precedence(e.Op) {
+			right = "(" + right + ")"
+		}
+		return left + " " + e.Op + " " + right
+	case ExpressionCall:
+		args := make([]string, len(e.Args))
+		for i, arg := range e.Args {
+			args[i] = FormatExpression(arg)
+		}
+		return e.Name + "(" + strings.Join(args, ", ") + ")"
+	}
+	return fmt.Sprint(e)
+}
+
+// precedence ranks the binary operators from the loosest, "||", up.
+func precedence(op string) int {
+	switch op {
+	case "||":
+		return 1
+	case "&&":
+		return 2
+	case "==", "!=", "<", "<=", ">", ">=":
+		return 3
+	case "+", "-":
+		return 4
+	}
+	return 5
+}
+
+// identifier reports whether key can follow a '.' in a filter path.
+func identifier(key string) bool {
+	if key == "" || !isIdentStart(key[0]) {
+		return false
+	}
+	for i := 1; i < len(key); i++ {
+		if c := key[i]; !isIdentStart(c) && (c < '0' || c > '9') {
+			return false
+		}
+	}
+	return true
+}
+
+// formatLiteral writes a literal of a filter or call: a quoted string, a
+// number, a bool or null.
+func formatLiteral(v interface{}) string {
+	switch v := v.(type) {
+	case nil:
+		return "null"
+	case string:
+		return quote(v)
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	}
+	return fmt.Sprint(v)
+}
+
+// quote writes s in single quotes as parseQuotedKey reads it.
+func quote(s string) string {
+	var b strings.Builder
+	b.WriteByte('\'')
+	for i := 0; i < len(s); i++ {
+		switch c := s[i]; c {
+		case '\'', '\\':
+			b.WriteByte('\\')
+			b.WriteByte(c)
+		case '\n':
+			b.WriteString(`\n`)
+		case '\r':
+			b.WriteString(`\r`)
+		case '\t':
+			b.WriteString(`\t`)
+		case '\b':
+			b.WriteString(`\b`)
+		case '\f':
+			b.WriteString(`\f`)
+		default:
+			b.WriteByte(c)
+		}
+	}
+	b.WriteByte('\'')
+	return b.String()
+}
@@ -0,0 +1,67 @@
+package query
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestFormatTokenRoundTrips(t *testing.T) {
+	paths := []string{
+		`/store/book[0]/title`, `/a[1:3]`, `/a[-2:]`, `/a[:2]`, `/a/*/b`, `//price`, `..*`, `/a//*`,
+		`/a/..`, `/a{title, price}`, `/a[@topk('price', 3)]`, `/a[@reverse]`, `/a/keys()`,
+		`/a['x.y']['0']`, `/ sp/0/-1`, `['it\'s']`, `/café`,
+		`/items[?(@.price > 10 && @.tags[0] == 'go')]`,
+		`/items[?((@.a || @.b) && !(@.c < 2))]`,
+		`/items[?(@.a - (@.b - 1) >= -5 * (2 + 3) % 4)]`,
+		`/items[?(@['a b'].c == $.limits['max'][0])]`,
+		`/items[?(is_missing(@.x) || position() == 0 || time(@.ts) > time('2024-01-01'))]`,
+		`/items[?(@.s == 'line\nbreak\\' && @.n != null && @.b == true && @.f < 0.000001)]`,
+	}
+	for _, path := range paths {
+		tokens, err := NewParser(path).Parse()
+		if err != nil {
+			t.Fatalf("Parse(%q) failed: %v", path, err)
+		}
+		var b strings.Builder
+		for _, token := range tokens {
+			b.WriteString(FormatToken(token))
+		}
+		again, err := NewParser(b.String()).Parse()
+		if err != nil {
+			t.Fatalf("%q formats as %q, which fails to parse: %v", path, b.String(), err)
+		}
+		if !reflect.DeepEqual(again, tokens) {
+			t.Errorf("%q formats as %q, which parses to %#v, want %#v", path, b.String(), again, tokens)
+		}
+	}
+}
+
+func TestFormatToken(t *testing.T) {
+	cases := map[string]string{
+		`/a`:                         `/a`,
+		`/a/*`:                       `/a[*]`,
+		`/a[1:]`:                     `/a[1:]`,
+		`/a[?(@.v>5&&(@.w<1||@.x))]`: `/a[?(@.v > 5 && (@.w < 1 || @.x))]`,
+		`/a[?(@['k y'] == "q'x")]`:   `/a[?(@['k y'] == 'q\'x')]`,
+		`/a[@topk("price",3)]`:       `/a[@topk('price', 3)]`,
+		`//name`:                     `//name`,
+		`/a/b{x,y}`:                  `/a/b{x, y}`,
+	}
+	for path, want := range cases {
+		tokens, err := NewParser(path).Parse()
+		if err != nil {
+			t.Fatalf("Parse(%q) failed: %v", path, err)
+		}
+		var b strings.Builder
+		for _, token := range tokens {
+			b.WriteString(FormatToken(token))
+		}
+		if b.String() != want {
+			t.Errorf("FormatToken of %q = %q, want %q", path, b.String(), want)
+		}
+	}
+	if got := OpFilter.String(); got != "filter" {
+		t.Errorf("OpFilter.String() = %q", got)
+	}
+}
@@ -3,6 +3,9 @@ package query
 import (
 	"fmt"
 	"strconv"
+	"strings"
+	"unicode/utf16"
+	"unicode/utf8"
 )
 
 // Parser holds the state of the query parser.
@@ -27,10 +30,34 @@ func (p *Parser) Parse() ([]QueryToken, error) {
 	for i := 0; i < len(p.input); {
 		switch p.input[i] {
 		case ' ', '\t', '\n', '\r':
-			i++
+			// Space before a key belongs to it; any other space only
+			// separates tokens.
+			next := i
+			for next < len(p.input) && isSpace(p.input[next]) {
+				next++
+			}
+			if next == len(p.input) || strings.IndexByte("/[]{.*", p.input[next]) >= 0 {
+				i = next
+				continue
+			}
+			segment, end, err := parseIdentifierSegment(p.input, i)
+			if err != nil {
+				return nil, err
+			}
+			token, err := segmentToken(segment)
+			if err != nil {
+				return nil, err
+			}
+			tokens = append(tokens, token)
+			i = end
 		case '/':
 			if i+1 < len(p.input) && p.input[i+1] == '/' {
 				i += 2
+				if i < len(p.input) && p.input[i] == '*' {
+					tokens = append(tokens, QueryToken{Type: OpAll})
+					i++
+					continue
+				}
 				name, next, err := parseIdentifierSegment(p.input, i)
 				if err != nil {
 					return nil, err
@@ -44,10 +71,21 @@ func (p *Parser) Parse() ([]QueryToken, error) {
 			}
 			i++
 		case '.':
-			if i+1 >= len(p.input) || p.input[i+1] != '.' {
+			if i+1 == len(p.input) || p.input[i+1] == '/' {
+				// "." is the current node, as in the relative form "./a".
+				i++
+				continue
+			}
+			if p.input[i+1] != '.' {
 				return nil, fmt.Errorf("unexpected '.' at position %d", i)
 			}
 			next := i + 2
+			if next < len(p.input) && p.input[next] == '*' {
+				// "..*" is recursive descent over every value, not a parent step.
+				tokens = append(tokens, QueryToken{Type: OpAll})
+				i = next + 1
+				continue
+			}
 			if next < len(p.input) {
 				switch p.input[next] {
 				case '/', '[', ' ', '\t', '\n', '\r':
@@ -67,6 +105,13 @@ func (p *Parser) Parse() ([]QueryToken, error) {
 		case '*':
 			tokens = append(tokens, QueryToken{Type: OpWildcard})
 			i++
+		case '{':
+			fields, next, err := parsePickList(p.input, i)
+			if err != nil {
+				return nil, err
+			}
+			tokens = append(tokens, QueryToken{Type: OpPick, Value: fields})
+			i = next
 		default:
 			segment, next, err := parseIdentifierSegment(p.input, i)
 			if err != nil {
@@ -75,38 +120,63 @@ func (p *Parser) Parse() ([]QueryToken, error) {
 			if segment == "" {
 				return nil, fmt.Errorf("unexpected token at position %d", i)
 			}
-			if idx, ok := tryParseInt(segment); ok {
-				tokens = append(tokens, QueryToken{Type: OpIndex, Value: idx})
-			} else if isIdentifier(segment) {
-				tokens = append(tokens, QueryToken{Type: OpKey, Value: segment})
-			} else {
-				return nil, fmt.Errorf("invalid path segment %q", segment)
+			token, err := segmentToken(segment)
+			if err != nil {
+				return nil, err
 			}
+			tokens = append(tokens, token)
 			i = next
 		}
 	}
 	return tokens, nil
 }
 
+// segmentToken classifies a path segment: a call such as keys(), an index
+// written as a plain integer, or else a key, which may hold any character
+// but '@', '*' and parentheses.
+func segmentToken(segment string) (QueryToken, error) {
+	if name, ok := StructureFunc(segment); ok {
+		return QueryToken{Type: OpFunc, Value: FuncCall{Name: name}}, nil
+	}
+	if idx, ok := tryParseInt(segment); ok && strconv.Itoa(idx) == segment {
+		return QueryToken{Type: OpIndex, Value: idx}, nil
+	}
+	if strings.ContainsAny(segment, "@*()") {
+		return QueryToken{}, fmt.Errorf("invalid path segment %q", segment)
+	}
+	return QueryToken{Type: OpKey, Value: segment}, nil
+}
+
+func isSpace(c byte) bool {
+	return c == ' ' || c == '\t' || c == '\n' || c == '\r'
+}
+
 func parseBracketExpression(input string, start int) (QueryToken, int, error) {
 	i := start + 1
 	if i >= len(input) {
 		return QueryToken{}, 0, fmt.Errorf("unterminated bracket expression")
 	}
 
+	if expr, next, ok, err := parseAttributePredicate(input, i); ok || err != nil {
+		if err != nil {
+			return QueryToken{}, 0, err
+		}
+		return QueryToken{Type: OpFilter, Value: expr}, next, nil
+	}
+
 	switch input[i] {
 	case '@':
-		name, next, err := parseIdentifierSegment(input, i+1)
+		call, next, err := parseFuncCall(input, i+1)
 		if err != nil {
 			return QueryToken{}, 0, err
 		}
-		if !isIdentifier(name) {
-			return QueryToken{}, 0, fmt.Errorf("invalid function name %q", name)
-		}
-		if next >= len(input) || input[next] != ']' {
-			return QueryToken{}, 0, fmt.Errorf("expected ']' after function call")
+		return QueryToken{Type: OpFunc, Value: call}, next, nil
+	case '?':
+		expr, next, err := parseFilterExpression(input, i)
+		if err != nil {
+			return QueryToken{}, 0, err
 		}
-		return QueryToken{Type: OpFunc, Value: name}, next + 1, nil
+		return QueryToken{Type: OpFilter, Value: expr}, next, nil
 	case '*':
 		if i+1 >= len(input) || input[i+1] != ']' {
 			return QueryToken{}, 0, fmt.Errorf("expected ']' after wildcard")
@@ -164,11 +234,22 @@ func parseBracketExpression(input string, start int) (QueryToken, int, error) {
 	}
 }
 
+// structureFuncs are the functions a path can call as a segment of their
+// own, such as /config/keys(), as well as with [@keys].
+var structureFuncs = map[string]bool{"keys": true, "values": true, "entries": true}
+
+// StructureFunc reports whether the path segment is a call such as keys()
+// and returns the name of the function.
+func StructureFunc(segment string) (string, bool) {
+	name, ok := strings.CutSuffix(segment, "()")
+	return name, ok && structureFuncs[name]
+}
+
 func parseIdentifierSegment(input string, start int) (string, int, error) {
 	i := start
 	for i < len(input) {
 		switch input[i] {
-		case '/', '[', ']', '.', ' ', '\t', '\n', '\r':
+		case '/', '[', ']', '.', '{':
 			return input[start:i], i, nil
 		default:
 			i++
@@ -177,28 +258,106 @@ func parseIdentifierSegment(input string, start int) (string, int, error) {
 	return input[start:i], i, nil
 }
 
+// parsePickList reads a projection such as `{title, author.name}` starting at
+// input[start] and returns the listed fields.
+func parsePickList(input string, start int) ([]string, int, error) {
+	end := strings.IndexByte(input[start:], '}')
+	if end < 0 {
+		return nil, 0, fmt.Errorf("unterminated field list at position %d", start)
+	}
+	end += start
+	var fields []string
+	for _, field := range strings.Split(input[start+1:end], ",") {
+		field = strings.TrimSpace(field)
+		if field == "" || strings.ContainsAny(field, "{[]/ \t\n\r") {
+			return nil, 0, fmt.Errorf("invalid field %q in field list", field)
+		}
+		fields = append(fields, field)
+	}
+	return fields, end + 1, nil
+}
+
+// parseQuotedKey reads a single- or double-quoted string starting at
+// input[start] and returns its unescaped value. Both quote styles accept the
+// JSON escapes plus \' so either quote can appear inside the other.
 func parseQuotedKey(input string, start int) (string, int, error) {
 	quote := input[start]
 	i := start + 1
 	buf := make([]byte, 0, 16)
 	for i < len(input) {
-		if input[i] == '\\' {
-			if i+1 >= len(input) {
-				return "", 0, fmt.Errorf("unterminated escape in quoted key")
-			}
-			buf = append(buf, input[i+1])
-			i += 2
+		c := input[i]
+		if c == quote {
+			return string(buf), i + 1, nil
+		}
+		if c != '\\' {
+			buf = append(buf, c)
+			i++
 			continue
 		}
-		if input[i] == quote {
-			return string(buf), i + 1, nil
+		if i+1 >= len(input) {
+			return "", 0, fmt.Errorf("unterminated escape in quoted key")
+		}
+		switch esc := input[i+1]; esc {
+		case '\'', '"', '\\', '/':
+			buf = append(buf, esc)
+		case 'b':
+			buf = append(buf, '\b')
+		case 'f':
+			buf = append(buf, '\f')
+		case 'n':
+			buf = append(buf, '\n')
+		case 'r':
+			buf = append(buf, '\r')
+		case 't':
+			buf = append(buf, '\t')
+		case 'u':
+			r, next, err := parseUnicodeEscape(input, i)
+			if err != nil {
+				return "", 0, err
+			}
+			buf = utf8.AppendRune(buf, r)
+			i = next
+			continue
+		default:
+			return "", 0, fmt.Errorf("invalid escape '\\%c' in quoted key", esc)
 		}
-		buf = append(buf, input[i])
-		i++
+		i += 2
 	}
 	return "", 0, fmt.Errorf("unterminated quoted key")
 }
 
+// parseUnicodeEscape decodes the \uXXXX escape at input[start], combining a
+// following low surrogate escape into a single rune.
+func parseUnicodeEscape(input string, start int) (rune, int, error) {
+	r, ok := parseHex4(input, start+2)
+	if !ok {
+		return 0, 0, fmt.Errorf("invalid unicode escape in quoted key")
+	}
+	next := start + 6
+	if utf16.IsSurrogate(r) {
+		if next+1 < len(input) && input[next] == '\\' && input[next+1] == 'u' {
+			if low, ok := parseHex4(input, next+2); ok {
+				if pair := utf16.DecodeRune(r, low); pair != utf8.RuneError {
+					return pair, next + 6, nil
+				}
+			}
+		}
+		return utf8.RuneError, next, nil
+	}
+	return r, next, nil
+}
+
+func parseHex4(input string, start int) (rune, bool) {
+	if start+4 > len(input) {
+		return 0, false
+	}
+	v, err := strconv.ParseUint(input[start:start+4], 16, 32)
+	if err != nil {
+		return 0, false
+	}
+	return rune(v), true
+}
+
 func tryParseInt(s string) (int, bool) {
 	if s == "" {
 		return 0, false
@@ -214,20 +373,3 @@ func tryParseInt(s string) (int, bool) {
 	v, err := strconv.Atoi(s)
 	return v, err == nil
 }
-
-func isIdentifier(s string) bool {
-	if s == "" {
-		return false
-	}
-	for i := 0; i < len(s); i++ {
-		c := s[i]
-		if (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z') || c == '_' {
-			continue
-		}
-		if i > 0 && c >= '0' && c <= '9' {
-			continue
-		}
-		return false
-	}
-	return true
-}
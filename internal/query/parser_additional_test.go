@@ -54,7 +54,61 @@ func TestParserHelperFunctions(t *testing.T) {
 		t.Fatal("expected invalid int parse to fail")
 	}
 
-	if !isIdentifier("abc_1") || isIdentifier("1abc") || isIdentifier("a-b") {
-		t.Fatal("unexpected identifier classification")
+	for segment, want := range map[string]Op{"abc_1": OpKey, "a-b": OpKey, "web server": OpKey, "01": OpKey, "-0": OpKey, "12": OpIndex, "-3": OpIndex} {
+		if token, err := segmentToken(segment); err != nil || token.Type != want {
+			t.Fatalf("segmentToken(%q) = %v, %v, want type %v", segment, token, err, want)
+		}
+	}
+	if _, err := segmentToken("a@b"); err == nil {
+		t.Fatal("expected a segment with '@' to be rejected")
+	}
+}
+func TestParseQuotedKeyUnescapes(t *testing.T) {
+	testCases := []struct {
+		input string
+		want  string
+	}{
+		{`'it\'s'`, "it's"},
+		{`"say \"hi\""`, `say "hi"`},
+		{`'a\\b'`, `a\b`},
+		{`"line\nbreak\ttab"`, "line\nbreak\ttab"},
+		{`'caf\u00e9'`, "café"},
+		{`"\ud83d\ude00"`, "😀"},
+		{`'mixed "quotes"'`, `mixed "quotes"`},
+		{`"a\/b"`, "a/b"},
+	}
+	for _, tc := range testCases {
+		key, next, err := parseQuotedKey(tc.input, 0)
+		if err != nil {
+			t.Fatalf("parseQuotedKey(%s) failed: %v", tc.input, err)
+		}
+		if key != tc.want || next != len(tc.input) {
+			t.Fatalf("parseQuotedKey(%s) = %q, %d; want %q, %d", tc.input, key, next, tc.want, len(tc.input))
+		}
 	}
-}
\ No newline at end of file
+
+	for _, input := range []string{`'\x'`, `'\u12'`, `'\uzzzz'`} {
+		if _, _, err := parseQuotedKey(input, 0); err == nil {
+			t.Fatalf("expected error for %s", input)
+		}
+	}
+}
+
+func TestParsePickList(t *testing.T) {
+	tokens, err := NewParser("/store/book[*]{title, author.name}").Parse()
+	if err != nil {
+		t.Fatalf("Parse failed: %v", err)
+	}
+	if len(tokens) != 4 || tokens[1].Value != "book" || tokens[3].Type != OpPick {
+		t.Fatalf("unexpected tokens: %#v", tokens)
+	}
+	if fields := tokens[3].Value.([]string); len(fields) != 2 || fields[0] != "title" || fields[1] != "author.name" {
+		t.Fatalf("unexpected fields: %#v", fields)
+	}
+
+	for _, path := range []string{"/a{b", "/a{}", "/a{b,,c}", "/a{b c}"} {
+		if _, err := NewParser(path).Parse(); err == nil {
+			t.Fatalf("expected error for %q", path)
+		}
+	}
+}
@@ -1,6 +1,7 @@
 package query
 
 import (
+	"reflect"
 	"strings"
 	"testing"
 )
@@ -69,6 +70,15 @@ func TestParserSupportsDocumentedSyntax(t *testing.T) {
 				}
 			},
 		},
+		{
+			name: "recursive wildcard",
+			path: `/a//*/..*`,
+			check: func(t *testing.T, tokens []QueryToken) {
+				if len(tokens) != 3 || tokens[0].Type != OpKey || tokens[1].Type != OpAll || tokens[2].Type != OpAll {
+					t.Fatalf("unexpected tokens: %#v", tokens)
+				}
+			},
+		},
 		{
 			name: "empty quoted key",
 			path: `/['']/name`,
@@ -93,6 +103,40 @@ func TestParserSupportsDocumentedSyntax(t *testing.T) {
 				}
 			},
 		},
+		{
+			name: "filter comparing two paths",
+			path: `/orders[?(@.shipped_qty < @.ordered_qty)]/id`,
+			check: func(t *testing.T, tokens []QueryToken) {
+				if len(tokens) != 3 || tokens[1].Type != OpFilter {
+					t.Fatalf("unexpected tokens: %#v", tokens)
+				}
+				expr, ok := tokens[1].Value.(ExpressionBinary)
+				if !ok || expr.Op != "<" {
+					t.Fatalf("unexpected filter expression: %#v", tokens[1].Value)
+				}
+				left, lok := expr.Left.(ExpressionPath)
+				right, rok := expr.Right.(ExpressionPath)
+				if !lok || !rok || left.Segments[0].Value != "shipped_qty" || right.Segments[0].Value != "ordered_qty" {
+					t.Fatalf("expected path operands, got %#v", expr)
+				}
+			},
+		},
+		{
+			name: "filter precedence",
+			path: `/a[?(@.x - @.y > 0 || !@.z && @.w == 'q')]`,
+			check: func(t *testing.T, tokens []QueryToken) {
+				expr, ok := tokens[1].Value.(ExpressionBinary)
+				if !ok || expr.Op != "||" {
+					t.Fatalf("expected || at the top, got %#v", tokens[1].Value)
+				}
+				if cmp, ok := expr.Left.(ExpressionBinary); !ok || cmp.Op != ">" {
+					t.Fatalf("expected comparison on the left, got %#v", expr.Left)
+				}
+				if and, ok := expr.Right.(ExpressionBinary); !ok || and.Op != "&&" {
+					t.Fatalf("expected && on the right, got %#v", expr.Right)
+				}
+			},
+		},
 		{
 			name: "repeated parent navigation",
 			path: `/books[0]/../../meta`,
@@ -105,6 +149,27 @@ func TestParserSupportsDocumentedSyntax(t *testing.T) {
 				}
 			},
 		},
+		{
+			name: "explicit relative path",
+			path: `./books/./../meta`,
+			check: func(t *testing.T, tokens []QueryToken) {
+				if len(tokens) != 3 {
+					t.Fatalf("expected 3 tokens, got %#v", tokens)
+				}
+				if tokens[0].Type != OpKey || tokens[0].Value != "books" || tokens[1].Type != OpParent || tokens[2].Value != "meta" {
+					t.Fatalf("unexpected tokens: %#v", tokens)
+				}
+			},
+		},
+		{
+			name: "current node",
+			path: `.`,
+			check: func(t *testing.T, tokens []QueryToken) {
+				if len(tokens) != 0 {
+					t.Fatalf("expected no tokens, got %#v", tokens)
+				}
+			},
+		},
 	}
 
 	for _, tc := range testCases {
@@ -125,11 +190,36 @@ func TestParserRejectsInvalidSyntax(t *testing.T) {
 		errContain string
 	}{
 		{path: `/a/..b`, errContain: "invalid parent navigation"},
+		{path: `/a/.b`, errContain: "unexpected '.'"},
 		{path: `/a/b[a]`, errContain: "invalid index"},
 		{path: `['key`, errContain: "unterminated quoted key"},
 		{path: `/a@func`, errContain: "invalid path segment"},
 		{path: `//`, errContain: "expected key after '//'"},
 		{path: `/[@1bad]`, errContain: "invalid function name"},
+		{path: `/a[?(@.x > 1]`, errContain: "expected ')'"},
+		{path: `/a[?(@.x > nope)]`, errContain: "unknown identifier"},
+		{path: `/a[?(is_text(@.x))]`, errContain: "unknown function"},
+		{path: `/a[?(is_string())]`, errContain: "takes 1 argument"},
+		{path: `/a[?(is_string(@.x, @.y))]`, errContain: "takes 1 argument"},
+		{path: `/a[?(is_string('x'))]`, errContain: "expects an @ path"},
+		{path: `/a[?(is_string(@.x)]`, errContain: "expected ')'"},
+		{path: `/a[?(position(@.x) > 1)]`, errContain: "takes no arguments"},
+		{path: `/a[?(index(1))]`, errContain: "takes no arguments"},
+		{path: `/a[?(position < 1)]`, errContain: "unknown identifier"},
+		{path: `/a[?(time('soon') > time(@.ts))]`, errContain: "is not an RFC 3339 time"},
+		{path: `/a[?(time(1) > time(@.ts))]`, errContain: "expects a path or a string"},
+		{path: `/a[?(datetime(@.a < 1))]`, errContain: "expects a path or a string"},
+		{path: `/a[?(time() > 1)]`, errContain: "takes 1 argument"},
+		{path: `/a[?(contains_all())]`, errContain: "got no arguments"},
+		{path: `/a[?(contains_any('x', @.tags))]`, errContain: "expects an @ path"},
+		{path: `/a[?(contains_any(@.tags, @.x))]`, errContain: "argument 2 of contains_any must be"},
+		{path: `/a[?(contains_all(@.tags, 1, -@.x))]`, errContain: "argument 3 of contains_all must be"},
+		{path: `/a[@below(20]`, errContain: "expected ',' or ')'"},
+		{path: `/a[@below(20,)]`, errContain: "unexpected character"},
+		{path: `/a[@below(@.x)]`, errContain: "must be a string, number or bool literal"},
+		{path: `/a[@below(null)]`, errContain: "must be a string, number or bool literal"},
+		{path: `/a[@below(20) ]`, errContain: "expected ']'"},
+		{path: `/a[@be-low]`, errContain: "invalid function name"},
 	}
 
 	for _, tc := range testCases {
@@ -143,4 +233,124 @@ func TestParserRejectsInvalidSyntax(t *testing.T) {
 			}
 		})
 	}
-}
\ No newline at end of file
+}
+
+func TestParserFunctionArguments(t *testing.T) {
+	testCases := map[string]FuncCall{
+		`/a[@cheap]`:                     {Name: "cheap"},
+		`/a[@cheap()]`:                   {Name: "cheap"},
+		`/a[@below(20)]`:                 {Name: "below", Args: []interface{}{20.0}},
+		`/a[@topk('price', 3)]`:          {Name: "topk", Args: []interface{}{"price", 3.0}},
+		`/a[@f( "x\"y" , -1.5e1,true )]`: {Name: "f", Args: []interface{}{`x"y`, -15.0, true}},
+	}
+	for path, want := range testCases {
+		tokens, err := NewParser(path).Parse()
+		if err != nil {
+			t.Fatalf("%s: %v", path, err)
+		}
+		if len(tokens) != 2 || tokens[1].Type != OpFunc || !reflect.DeepEqual(tokens[1].Value, want) {
+			t.Errorf("%s: unexpected tokens %#v", path, tokens)
+		}
+	}
+}
+
+func TestParserAttributePredicates(t *testing.T) {
+	testCases := map[string]string{
+		`/books[title='Moby Dick']`:   `/books[?(@.title == 'Moby Dick')]`,
+		`/books[@category="fiction"]`: `/books[?(@.category == "fiction")]`,
+		`/books[ price <= 12 ]`:       `/books[?(@.price <= 12)]`,
+		`/books[stock!=-1]`:           `/books[?(@.stock != -1)]`,
+		`/books['a key'==null][0]`:    `/books[?(@['a key'] == null)][0]`,
+		`/books[in-print=true]`:       `/books[?(@['in-print'] == true)]`,
+	}
+	for path, filter := range testCases {
+		got, err := NewParser(path).Parse()
+		if err != nil {
+			t.Fatalf("%s: %v", path, err)
+		}
+		want, err := NewParser(filter).Parse()
+		if err != nil {
+			t.Fatalf("%s: %v", filter, err)
+		}
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("%s = %#v, want the tokens of %s: %#v", path, got, filter, want)
+		}
+	}
+
+	// Without a comparison a bracket keeps its meaning.
+	for path, op := range map[string]Op{`/a[@cheap]`: OpFunc, `/a['key']`: OpKey, `/a[2]`: OpIndex} {
+		tokens, err := NewParser(path).Parse()
+		if err != nil || len(tokens) != 2 || tokens[1].Type != op {
+			t.Errorf("%s: tokens %#v, %v, want a %s step", path, tokens, err, op)
+		}
+	}
+	for _, path := range []string{`/a[b=]`, `/a[b=c]`, `/a[b='x'`, `/a[b<@.c]`} {
+		if _, err := NewParser(path).Parse(); err == nil {
+			t.Errorf("%s: expected a parse error", path)
+		}
+	}
+}
+
+func TestParserStructureFunctions(t *testing.T) {
+	tokens, err := NewParser(`//oauth2/keys()/values()[0]/entries()`).Parse()
+	if err != nil {
+		t.Fatalf("Parse failed: %v", err)
+	}
+	want := []QueryToken{
+		{Type: OpRecursiveKey, Value: "oauth2"},
+		{Type: OpFunc, Value: FuncCall{Name: "keys"}},
+		{Type: OpFunc, Value: FuncCall{Name: "values"}},
+		{Type: OpIndex, Value: 0},
+		{Type: OpFunc, Value: FuncCall{Name: "entries"}},
+	}
+	if !reflect.DeepEqual(tokens, want) {
+		t.Fatalf("tokens = %#v, want %#v", tokens, want)
+	}
+
+	// Only the structure functions have the segment form.
+	for _, path := range []string{`/a/cheap()`, `/a/keys(1)`} {
+		if _, err := NewParser(path).Parse(); err == nil {
+			t.Errorf("%s: expected a parse error", path)
+		}
+	}
+}
+
+func TestParserRootPathsInFilters(t *testing.T) {
+	tokens, err := NewParser(`/items[?(@.price < $.limits['max'][0] && !is_missing($))]`).Parse()
+	if err != nil {
+		t.Fatalf("Parse failed: %v", err)
+	}
+	if len(tokens) != 2 || tokens[1].Type != OpFilter {
+		t.Fatalf("unexpected tokens: %#v", tokens)
+	}
+	and := tokens[1].Value.(ExpressionBinary)
+	less := and.Left.(ExpressionBinary)
+	if left := less.Left.(ExpressionPath); left.Root {
+		t.Fatalf("@ path parsed as rooted: %#v", left)
+	}
+	want := ExpressionPath{Root: true, Segments: []QueryToken{
+		{Type: OpKey, Value: "limits"}, {Type: OpKey, Value: "max"}, {Type: OpIndex, Value: 0},
+	}}
+	if !reflect.DeepEqual(less.Right, want) {
+		t.Fatalf("$ path = %#v, want %#v", less.Right, want)
+	}
+	call := and.Right.(ExpressionUnary).Operand.(ExpressionCall)
+	if arg := call.Args[0].(ExpressionPath); !arg.Root || len(arg.Segments) != 0 {
+		t.Fatalf("is_missing($) argument = %#v", arg)
+	}
+}
+
+func TestParserPositionInFilters(t *testing.T) {
+	tokens, err := NewParser(`/logs[?(index() % 100 == 0 && position( ) < 3)]`).Parse()
+	if err != nil {
+		t.Fatalf("Parse failed: %v", err)
+	}
+	and := tokens[1].Value.(ExpressionBinary)
+	mod := and.Left.(ExpressionBinary).Left.(ExpressionBinary)
+	if call := mod.Left.(ExpressionCall); call.Name != "index" || len(call.Args) != 0 {
+		t.Fatalf("index() parsed as %#v", call)
+	}
+	if call := and.Right.(ExpressionBinary).Left.(ExpressionCall); call.Name != "position" || len(call.Args) != 0 {
+		t.Fatalf("position( ) parsed as %#v", call)
+	}
+}
@@ -12,6 +12,8 @@ const (
 	OpRecursiveKey
 	OpParent
 	OpAll
+	OpFilter
+	OpPick
 )
 
 // QueryToken represents a single token in a parsed query.
@@ -19,3 +21,11 @@ type QueryToken struct {
 	Type  Op
 	Value interface{}
 }
+
+// FuncCall is the value of an OpFunc token: the function name and the
+// literal arguments of a call such as [@topk('price', 3)], each a float64,
+// string or bool. Args is empty for [@name] and [@name()].
+type FuncCall struct {
+	Name string
+	Args []interface{}
+}
@@ -3,6 +3,7 @@ package xjson
 import (
 	"bytes"
 	"encoding/json"
+	"fmt"
 	"testing"
 
 	"github.com/474420502/xjson/internal/engine"
@@ -25,6 +26,8 @@ var benchmarkJSON = jsoniter.ConfigCompatibleWithStandardLibrary
 var benchmarkQuerySink any
 var benchmarkBytesSink []byte
 var benchmarkStringSink string
+var benchmarkIntSink int
+var benchmarkBoolSink bool
 
 func benchmarkAgeInt(i int) int {
 	if i&1 == 0 {
@@ -441,6 +444,284 @@ func BenchmarkXJSONQuery_LazyParse_EachQuery(b *testing.B) {
 
 }
 
+// BenchmarkXJSONLen_RawArray 衡量未解析数组的 Len 性能（只扫描元素边界，不物化节点）
+func BenchmarkXJSONLen_RawArray(b *testing.B) {
+	var buf bytes.Buffer
+	buf.WriteString(`{"logs":[`)
+	for i := 0; i < 10000; i++ {
+		if i > 0 {
+			buf.WriteByte(',')
+		}
+		buf.WriteString(`{"id":1,"level":"info","msg":"request served, 200","tags":["a","b"]}`)
+	}
+	buf.WriteString(`]}`)
+	doc, err := Parse(buf.Bytes())
+	if err != nil {
+		b.Fatal(err)
+	}
+	logs := doc.Get("logs")
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		benchmarkIntSink = logs.Len()
+	}
+}
+
+// projectionDoc 构造 10000 个元素的数组，每个元素嵌套两层对象
+func projectionDoc(b *testing.B) Node {
+	var buf bytes.Buffer
+	buf.WriteString(`{"data":[`)
+	for i := 0; i < 10000; i++ {
+		if i > 0 {
+			buf.WriteByte(',')
+		}
+		fmt.Fprintf(&buf, `{"user":{"profile":{"id":%d,"name":"n"},"active":true},"tags":["a"]}`, i)
+	}
+	buf.WriteString(`]}`)
+	doc, err := Parse(buf.Bytes())
+	if err != nil {
+		b.Fatal(err)
+	}
+	return doc
+}
+
+// BenchmarkXJSONQuery_Projection 衡量数组上连续三步键投影的开销（每次清空查询缓存）
+func BenchmarkXJSONQuery_Projection(b *testing.B) {
+	doc := projectionDoc(b)
+	inner := doc.(nodeWrapper).Node
+	if got := doc.Query("/data/user/profile/id").Len(); got != 10000 {
+		b.Fatalf("projection matched %d values, want 10000", got)
+	}
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		engine.ResetQueryCache(inner)
+		benchmarkIntSink = doc.Query("/data/user/profile/id").Len()
+	}
+}
+
+// wildcardProjectionDoc 构造 1000 个条目、每个条目 10 个 item 的文档，共 10k 个 id
+func wildcardProjectionDoc(b *testing.B) Node {
+	var buf bytes.Buffer
+	buf.WriteString(`{"data":[`)
+	for i := 0; i < 1000; i++ {
+		if i > 0 {
+			buf.WriteByte(',')
+		}
+		buf.WriteString(`{"items":[`)
+		for j := 0; j < 10; j++ {
+			if j > 0 {
+				buf.WriteByte(',')
+			}
+			fmt.Fprintf(&buf, `{"id":%d,"qty":1}`, i*10+j)
+		}
+		buf.WriteString(`]}`)
+	}
+	buf.WriteString(`]}`)
+	doc, err := Parse(buf.Bytes())
+	if err != nil {
+		b.Fatal(err)
+	}
+	return doc
+}
+
+// BenchmarkXJSONQuery_WildcardProjection 衡量 /data/*/items/*/id 这种通配符与键交替投影的开销（每次清空查询缓存）
+func BenchmarkXJSONQuery_WildcardProjection(b *testing.B) {
+	doc := wildcardProjectionDoc(b)
+	inner := doc.(nodeWrapper).Node
+	if got := doc.Query("/data/*/items/*/id").Len(); got != 10000 {
+		b.Fatalf("projection matched %d values, want 10000", got)
+	}
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		engine.ResetQueryCache(inner)
+		benchmarkIntSink = doc.Query("/data/*/items/*/id").Len()
+	}
+}
+
+// recursiveExistsDoc 构造一个较大的文档，目标键在首个元素中即可命中
+func recursiveExistsDoc(b *testing.B) Node {
+	var buf bytes.Buffer
+	buf.WriteString(`{"orders":[`)
+	for i := 0; i < 5000; i++ {
+		if i > 0 {
+			buf.WriteByte(',')
+		}
+		buf.WriteString(`{"id":1,"customer":{"name":"n","address":{"zip":"12345"}},"items":[{"sku":"a"},{"sku":"b"}]}`)
+	}
+	buf.WriteString(`]}`)
+	doc, err := Parse(buf.Bytes())
+	if err != nil {
+		b.Fatal(err)
+	}
+	return doc
+}
+
+// BenchmarkXJSONHas_Recursive 衡量 Has 在递归搜索中命中首个结果即停止的性能
+func BenchmarkXJSONHas_Recursive(b *testing.B) {
+	doc := recursiveExistsDoc(b)
+	inner := doc.(nodeWrapper).Node
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		engine.ResetQueryCache(inner)
+		benchmarkBoolSink = doc.Has("//zip")
+	}
+}
+
+// BenchmarkXJSONQueryExists_Recursive 作为对照：收集全部递归结果后再判断是否存在
+func BenchmarkXJSONQueryExists_Recursive(b *testing.B) {
+	doc := recursiveExistsDoc(b)
+	inner := doc.(nodeWrapper).Node
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		engine.ResetQueryCache(inner)
+		result := doc.Query("//zip")
+		benchmarkBoolSink = result.IsValid() && result.Len() > 0
+	}
+}
+
+// BenchmarkXJSONQueryFirst_Recursive 衡量 QueryFirst 在递归搜索中取得首个结果即停止的性能
+func BenchmarkXJSONQueryFirst_Recursive(b *testing.B) {
+	doc := recursiveExistsDoc(b)
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		benchmarkIntSink = len(doc.QueryFirst("//zip").String())
+	}
+}
+
+// BenchmarkXJSONQueryFirstViaQuery_Recursive 作为对照：收集全部递归结果后再取第一个
+func BenchmarkXJSONQueryFirstViaQuery_Recursive(b *testing.B) {
+	doc := recursiveExistsDoc(b)
+	inner := doc.(nodeWrapper).Node
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		engine.ResetQueryCache(inner)
+		benchmarkIntSink = len(doc.Query("//zip").Index(0).String())
+	}
+}
+
+// BenchmarkXJSONBytes_Unmodified 衡量只读代理场景：解析后未修改的文档直接返回原始字节
+func BenchmarkXJSONBytes_Unmodified(b *testing.B) {
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		doc, err := Parse(largeJSONData)
+		if err != nil {
+			b.Fatal(err)
+		}
+		benchmarkBytesSink, _ = doc.Bytes()
+	}
+}
+
+// BenchmarkXJSONBytes_Modified 作为对照：修改后需要重新序列化整棵树
+func BenchmarkXJSONBytes_Modified(b *testing.B) {
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		doc, err := Parse(largeJSONData)
+		if err != nil {
+			b.Fatal(err)
+		}
+		doc.Set("touched", true)
+		benchmarkBytesSink, _ = doc.Bytes()
+	}
+}
+
+// walkBenchmarkNodes parses every value of a lazy document.
+func walkBenchmarkNodes(n Node) int {
+	count := 1
+	if n.Type() == Object || n.Type() == Array {
+		n.ForEach(func(_ interface{}, v Node) {
+			count += walkBenchmarkNodes(v)
+		})
+	}
+	return count
+}
+
+func BenchmarkXJSONParseWalk(b *testing.B) {
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		doc, _ := ParseWithOptions(largeJSONData, ParseOptions{})
+		benchmarkIntSink = walkBenchmarkNodes(doc)
+	}
+}
+
+func BenchmarkXJSONParseWalk_Pooled(b *testing.B) {
+	pool := NewNodePool()
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		doc, _ := ParseWithOptions(largeJSONData, ParseOptions{Pool: pool})
+		benchmarkIntSink = walkBenchmarkNodes(doc)
+		doc.Release()
+	}
+}
+
+// hotPaths are the fields the ParseWithPaths benchmarks read from every
+// document.
+var hotPaths = []string{
+	xjsonQueryPath,
+	"/level1/level2/level3/level4/level5/level6/level7/level8/level9/level10/data",
+	"/level1/level2/level3/level4/level5/level6/level7/level8/level9/level10/users[0]/id",
+	xjsonSetPath + "/age",
+}
+
+func readHotPaths(doc Node) {
+	for _, path := range hotPaths {
+		benchmarkStringSink = doc.Query(path).Raw()
+	}
+}
+
+// Parse time with the hot fields preloaded, against BenchmarkXJSONParseLazy.
+func BenchmarkXJSONParseWithPaths(b *testing.B) {
+	for i := 0; i < b.N; i++ {
+		benchmarkQuerySink, _ = ParseWithPaths(largeJSONData, hotPaths...)
+	}
+}
+
+func BenchmarkXJSONParseLazy(b *testing.B) {
+	for i := 0; i < b.N; i++ {
+		benchmarkQuerySink, _ = Parse(largeJSONData)
+	}
+}
+
+// Reading the hot fields of a fresh document, preloaded or not.
+func BenchmarkXJSONReadHotPaths_Preloaded(b *testing.B) {
+	for i := 0; i < b.N; i++ {
+		b.StopTimer()
+		doc, _ := ParseWithPaths(largeJSONData, hotPaths...)
+		b.StartTimer()
+		readHotPaths(doc)
+	}
+}
+
+func BenchmarkXJSONReadHotPaths_Cold(b *testing.B) {
+	for i := 0; i < b.N; i++ {
+		b.StopTimer()
+		doc, _ := Parse(largeJSONData)
+		b.StartTimer()
+		readHotPaths(doc)
+	}
+}
+
+// Checking the payload without building anything, against
+// BenchmarkStandardJSONValid.
+func BenchmarkXJSONValid(b *testing.B) {
+	b.SetBytes(int64(len(largeJSONData)))
+	for i := 0; i < b.N; i++ {
+		benchmarkBoolSink = Valid(largeJSONData)
+	}
+}
+
 func BenchmarkJsonIterParse(b *testing.B) {
 	for i := 0; i < b.N; i++ {
 		var data map[string]interface{}
@@ -461,6 +742,13 @@ func BenchmarkStandardJSONParse(b *testing.B) {
 	}
 }
 
+func BenchmarkStandardJSONValid(b *testing.B) {
+	b.SetBytes(int64(len(largeJSONData)))
+	for i := 0; i < b.N; i++ {
+		benchmarkBoolSink = json.Valid(largeJSONData)
+	}
+}
+
 // BenchmarkGJSONQuery 衡量 gjson 的 JSON 查询性能
 func BenchmarkGJSONQuery(b *testing.B) {
 	for i := 0; i < b.N; i++ {
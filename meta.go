@@ -0,0 +1,81 @@
+package xjson
+
+import "github.com/474420502/xjson/internal/engine"
+
+// NewDocument returns a Document holding root, attached to it so that
+// DocumentOf finds the document from any node of root.
+func NewDocument(root Node) *Document {
+	d := &Document{Root: root}
+	d.attach()
+	return d
+}
+
+// attach records d on its root for DocumentOf. A Document is found through
+// the pointer it was attached by: a copy of the struct shares its metadata
+// but is not what DocumentOf returns.
+func (d *Document) attach() {
+	if d.Root != nil {
+		engine.SetOwner(unwrapNode(d.Root), d)
+	}
+}
+
+// SetMeta stores value under key in the metadata of the document, such as a
+// tenant or request ID for the code that later receives only a result, and
+// attaches d to Root like NewDocument. Metadata is not part of the JSON: it
+// is not serialized, stored by Value or compared by Equal.
+func (d *Document) SetMeta(key string, value interface{}) {
+	if d.meta == nil {
+		d.meta = make(map[string]interface{})
+	}
+	d.meta[key] = value
+	d.attach()
+}
+
+// Meta returns the metadata value stored under key, and whether there is
+// one.
+func (d *Document) Meta(key string) (interface{}, bool) {
+	value, ok := d.meta[key]
+	return value, ok
+}
+
+// Clone returns a new document holding a copy of Root, parsed from its JSON
+// text, with the same settings and a copy of the metadata. The metadata
+// values themselves are shared. The clone is attached to its root.
+func (d *Document) Clone() (*Document, error) {
+	clone := *d
+	clone.meta = nil
+	if len(d.meta) > 0 {
+		clone.meta = make(map[string]interface{}, len(d.meta))
+		for k, v := range d.meta {
+			clone.meta[k] = v
+		}
+	}
+	if d.Root != nil {
+		raw, err := d.Root.Bytes()
+		if err != nil {
+			return nil, err
+		}
+		if clone.Root, err = Parse(append([]byte(nil), raw...)); err != nil {
+			return nil, err
+		}
+	}
+	clone.attach()
+	return &clone, nil
+}
+
+// DocumentOf returns the Document that node belongs to: the one attached,
+// by NewDocument, Scan, SetMeta or Clone, to node or the nearest of its
+// ancestors, as long as that node is still the document's Root. It returns
+// nil for a node of no attached document, an invalid node, and the combined
+// result of a MultiDoc query, which spans several documents.
+func DocumentOf(node Node) *Document {
+	if node == nil {
+		return nil
+	}
+	owner, at := engine.Owner(unwrapNode(node))
+	d, ok := owner.(*Document)
+	if !ok || d.Root == nil || unwrapNode(d.Root) != at {
+		return nil
+	}
+	return d
+}
@@ -0,0 +1,106 @@
+package xjson
+
+import "testing"
+
+func TestDocumentMeta(t *testing.T) {
+	root, err := Parse(`{"user":{"name":"ann","tags":["a","b"]},"items":[{"name":"x"}]}`)
+	if err != nil {
+		t.Fatalf("Parse failed: %v", err)
+	}
+	doc := &Document{Root: root}
+	if DocumentOf(root) != nil {
+		t.Error("a root of no attached document should have no document")
+	}
+	doc.SetMeta("tenant", "acme")
+	if v, ok := doc.Meta("tenant"); !ok || v != "acme" {
+		t.Errorf("Meta(tenant) = %v, %v, want acme", v, ok)
+	}
+	if _, ok := doc.Meta("missing"); ok {
+		t.Error("Meta of an unset key should report false")
+	}
+
+	for _, path := range []string{"/user/name", "/user/tags[1]", "/user/tags[*]", "//name", "/items[0]"} {
+		res := root.Query(path)
+		if got := DocumentOf(res); got != doc {
+			t.Errorf("DocumentOf(%s) = %p, want %p", path, got, doc)
+		}
+	}
+	res := root.Query("//name")
+	if got := DocumentOf(res.Index(1)); got != doc {
+		t.Errorf("DocumentOf of a recursive match = %p, want %p", got, doc)
+	}
+
+	// Metadata is not part of the JSON.
+	other, _ := Parse(`{"user":{"name":"ann","tags":["a","b"]},"items":[{"name":"x"}]}`)
+	if !Equal(root, other) || root.String() != other.String() {
+		t.Error("metadata changed the document")
+	}
+	if v, err := doc.Value(); err != nil || string(v.([]byte)) != other.String() {
+		t.Errorf("Value() = %s, %v", v, err)
+	}
+}
+
+func TestDocumentOfUnattached(t *testing.T) {
+	root, _ := Parse(`{"a":[1,2]}`)
+	doc := NewDocument(root)
+	if DocumentOf(root.Query("/a[0]")) != doc {
+		t.Error("NewDocument should attach the document")
+	}
+	if DocumentOf(nil) != nil || DocumentOf(root.Query("/missing")) != nil {
+		t.Error("nil and invalid nodes should have no document")
+	}
+	if DocumentOf(NewObject()) != nil {
+		t.Error("a detached node should have no document")
+	}
+
+	md := NewMultiDoc(root, root)
+	if got := DocumentOf(md.Query("/a[0]")); got != nil {
+		t.Errorf("DocumentOf of a MultiDoc result = %p, want nil", got)
+	}
+
+	// Nodes of a root the document no longer holds are not its own.
+	old := root.Query("/a")
+	doc.Root, _ = Parse(`[]`)
+	if DocumentOf(old) != nil {
+		t.Error("a node of a replaced root should have no document")
+	}
+
+	var scanned Document
+	if err := scanned.Scan(`{"b":true}`); err != nil {
+		t.Fatalf("Scan failed: %v", err)
+	}
+	if DocumentOf(scanned.Root.Get("b")) != &scanned {
+		t.Error("Scan should attach the document")
+	}
+}
+
+func TestDocumentClone(t *testing.T) {
+	root, _ := Parse(`{"a": [1, 2]}`)
+	doc := NewDocument(root)
+	doc.CreateArrays = true
+	doc.SetMeta("request", 42)
+
+	clone, err := doc.Clone()
+	if err != nil {
+		t.Fatalf("Clone failed: %v", err)
+	}
+	if v, ok := clone.Meta("request"); !ok || v != 42 || !clone.CreateArrays {
+		t.Errorf("clone Meta(request) = %v, %v, CreateArrays %v", v, ok, clone.CreateArrays)
+	}
+	if DocumentOf(clone.Root.Query("/a[0]")) != clone || DocumentOf(root) != doc {
+		t.Error("the clone should be attached to its own root")
+	}
+	clone.SetMeta("request", 43)
+	clone.Root.SetByPath("/a[0]", 10)
+	if v, _ := doc.Meta("request"); v != 42 || root.String() != `{"a": [1, 2]}` {
+		t.Errorf("writing the clone changed the original: %v, %s", v, root.String())
+	}
+
+	empty, err := (&Document{}).Clone()
+	if err != nil || empty.Root != nil {
+		t.Errorf("Clone without a root = %v, %v", empty, err)
+	}
+	if _, err := (&Document{Root: root.Query("/missing")}).Clone(); err == nil {
+		t.Error("Clone of an invalid root should fail")
+	}
+}
@@ -0,0 +1,126 @@
+package xjson
+
+import (
+	"fmt"
+	"strconv"
+
+	"github.com/474420502/xjson/internal/engine"
+)
+
+// MultiDoc runs the same query against a list of labeled documents.
+type MultiDoc struct {
+	labels []string
+	docs   []Node
+}
+
+// NewMultiDoc returns a MultiDoc of docs, labeled by their index: "0", "1",
+// and so on.
+func NewMultiDoc(docs ...Node) *MultiDoc {
+	md := &MultiDoc{}
+	for i, doc := range docs {
+		md.Add(strconv.Itoa(i), doc)
+	}
+	return md
+}
+
+// Add appends doc under label and returns md.
+func (md *MultiDoc) Add(label string, doc Node) *MultiDoc {
+	md.labels = append(md.labels, label)
+	md.docs = append(md.docs, doc)
+	return md
+}
+
+// Len returns the number of documents.
+func (md *MultiDoc) Len() int {
+	return len(md.docs)
+}
+
+// ForEach calls fn with each document and its label, in the order they were
+// added, until fn returns false.
+func (md *MultiDoc) ForEach(fn func(label string, doc Node) bool) {
+	for i, doc := range md.docs {
+		if !fn(md.labels[i], doc) {
+			return
+		}
+	}
+}
+
+// Query evaluates path against every document and combines the matches, in
+// document order, into one match set. A document whose query fails adds no
+// matches and is reported by Errors of the result; the other documents are
+// still queried.
+func (md *MultiDoc) Query(path string) *MultiResult {
+	var (
+		matches []Node
+		labels  []string
+		errs    []*SourceError
+		funcs   *map[string]UnaryPathFunc
+	)
+	for i, doc := range md.docs {
+		label := md.labels[i]
+		if doc == nil {
+			errs = append(errs, &SourceError{Label: label, Err: fmt.Errorf("nil document")})
+			continue
+		}
+		if funcs == nil {
+			funcs = doc.GetFuncs()
+		}
+		result := doc.Query(path)
+		if !result.IsValid() {
+			errs = append(errs, &SourceError{Label: label, Err: fmt.Errorf("query %q: %w", path, result.Error())})
+			continue
+		}
+		for _, match := range engine.Matches(result) {
+			matches = append(matches, match)
+			labels = append(labels, label)
+		}
+	}
+	return &MultiResult{Node: engine.JoinMatches(matches, funcs), labels: labels, errs: errs}
+}
+
+// MultiResult is the combined match set of a MultiDoc query. Every Node
+// method works on the set as a whole; Label and EachMatch tell which
+// document each match came from.
+type MultiResult struct {
+	Node
+	labels []string
+	errs   []*SourceError
+}
+
+// Label returns the label of the document match i came from, or "" when i
+// is out of range.
+func (r *MultiResult) Label(i int) string {
+	if i < 0 || i >= len(r.labels) {
+		return ""
+	}
+	return r.labels[i]
+}
+
+// EachMatch calls fn with each match and the label of its document, in
+// order, until fn returns false.
+func (r *MultiResult) EachMatch(fn func(label string, match Node) bool) {
+	for i, label := range r.labels {
+		if !fn(label, r.Node.Index(i)) {
+			return
+		}
+	}
+}
+
+// Errors returns the documents whose query failed, in document order.
+func (r *MultiResult) Errors() []*SourceError {
+	return r.errs
+}
+
+// SourceError is the error of one document of a MultiDoc query.
+type SourceError struct {
+	Label string
+	Err   error
+}
+
+func (e *SourceError) Error() string {
+	return fmt.Sprintf("%s: %v", e.Label, e.Err)
+}
+
+func (e *SourceError) Unwrap() error {
+	return e.Err
+}
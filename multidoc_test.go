@@ -0,0 +1,82 @@
+package xjson
+
+import (
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestMultiDocQuery(t *testing.T) {
+	eu, _ := Parse(`{"stats":{"requests":3},"hosts":[{"name":"a"},{"name":"b"}]}`)
+	us, _ := MustParse(`{"stats":{}}`)
+	ap, _ := Parse(`{"stats":{"requests":4.5},"hosts":[{"name":"c"}]}`)
+	md := NewMultiDoc().Add("eu", eu).Add("us", us).Add("ap", ap)
+
+	res := md.Query("/stats/requests")
+	total := 0.0
+	res.ForEach(func(_ interface{}, v Node) { total += v.Float() })
+	if total != 7.5 || res.Len() != 2 {
+		t.Errorf("total = %v over %d matches, want 7.5 over 2", total, res.Len())
+	}
+	errs := res.Errors()
+	if len(errs) != 1 || errs[0].Label != "us" || !strings.Contains(errs[0].Error(), `us: query "/stats/requests"`) {
+		t.Fatalf("Errors() = %v", errs)
+	}
+	if errors.Unwrap(errs[0]) != errs[0].Err {
+		t.Error("SourceError should unwrap to the document's error")
+	}
+
+	hosts := md.Query("/hosts[*]/name")
+	var got []string
+	hosts.EachMatch(func(label string, match Node) bool {
+		got = append(got, label+"="+match.String())
+		return true
+	})
+	if want := []string{"eu=a", "eu=b", "ap=c"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("EachMatch = %q, want %q", got, want)
+	}
+	if hosts.Label(2) != "ap" || hosts.Label(3) != "" || hosts.Label(-1) != "" {
+		t.Errorf("Label = %q, %q, %q", hosts.Label(2), hosts.Label(3), hosts.Label(-1))
+	}
+	if names := hosts.Strings(); !reflect.DeepEqual(names, []string{"a", "b", "c"}) {
+		t.Errorf("Strings() = %q", names)
+	}
+
+	none := md.Query("/missing")
+	if none.HasMatches() || len(none.Errors()) != 3 || !none.IsValid() {
+		t.Errorf("query missing everywhere: HasMatches %v, %d errors", none.HasMatches(), len(none.Errors()))
+	}
+}
+
+func TestMultiDocLabels(t *testing.T) {
+	a, _ := Parse(`{"v":1}`)
+	b, _ := Parse(`{"v":2}`)
+	md := NewMultiDoc(a, nil, b)
+	if md.Len() != 3 {
+		t.Fatalf("Len() = %d", md.Len())
+	}
+
+	var labels []string
+	md.ForEach(func(label string, doc Node) bool {
+		labels = append(labels, label)
+		return label != "1"
+	})
+	if !reflect.DeepEqual(labels, []string{"0", "1"}) {
+		t.Errorf("ForEach labels = %q, want it to stop after \"1\"", labels)
+	}
+
+	res := md.Query("/v")
+	if res.String() != "[1,2]" || res.Label(1) != "2" {
+		t.Errorf("result = %s, Label(1) = %q", res.String(), res.Label(1))
+	}
+	if errs := res.Errors(); len(errs) != 1 || errs[0].Label != "1" {
+		t.Errorf("a nil document should be reported, got %v", errs)
+	}
+
+	stopped := 0
+	res.EachMatch(func(string, Node) bool { stopped++; return false })
+	if stopped != 1 {
+		t.Errorf("EachMatch ran %d times after returning false", stopped)
+	}
+}
@@ -0,0 +1,24 @@
+package xjson
+
+import "testing"
+
+// testParsers are the ways a test parses a document: lazily, and fully.
+var testParsers = map[string]func(interface{}) (Node, error){
+	"lazy":  Parse,
+	"eager": MustParse,
+}
+
+// forEachParser runs fn in a subtest for each of testParsers on doc parsed
+// by it.
+func forEachParser(t *testing.T, doc string, fn func(t *testing.T, root Node)) {
+	t.Helper()
+	for name, parse := range testParsers {
+		t.Run(name, func(t *testing.T) {
+			root, err := parse(doc)
+			if err != nil {
+				t.Fatalf("parse failed: %v", err)
+			}
+			fn(t, root)
+		})
+	}
+}
@@ -0,0 +1,60 @@
+package xjson
+
+import (
+	"github.com/474420502/xjson/internal/core"
+	"github.com/474420502/xjson/internal/engine"
+)
+
+// PathBuilder is an alias for the engine PathBuilder returned by Path.
+type PathBuilder = engine.PathBuilder
+
+// PathSpec is an alias for the core PathSpec accepted by Node.QueryPath.
+type PathSpec = core.PathSpec
+
+// FilterCond is an alias for the engine FilterCond accepted by
+// PathBuilder.Where.
+type FilterCond = engine.FilterCond
+
+// FilterField is an alias for the engine FilterField returned by Field.
+type FilterField = engine.FilterField
+
+// PathSegment is an alias for the core PathSegment, one key or index of
+// the place of a value; see Node.PathSegments and Node.ForEachSegments.
+type PathSegment = core.PathSegment
+
+// KeySegment returns the PathSegment of an object member.
+func KeySegment(key string) PathSegment { return core.KeySegment(key) }
+
+// IndexSegment returns the PathSegment of an array element.
+func IndexSegment(i int) PathSegment { return core.IndexSegment(i) }
+
+// Path starts a query path built in code, which escapes every key it is
+// given:
+//
+//	p := xjson.Path().Key("store").Key("book").Index(2).Key("title")
+//	doc.QueryPath(p) // same as doc.Query("/store/book[2]/title")
+func Path() PathBuilder {
+	return engine.NewPath()
+}
+
+// ParsePath parses a query path into a PathBuilder so that it can be
+// extended, for example with a key from user input.
+func ParsePath(path string) (PathBuilder, error) {
+	return engine.ParsePath(path)
+}
+
+// Field refers to a value of the array element being filtered for a
+// PathBuilder.Where condition, reached through string keys and int indices:
+//
+//	xjson.Path().Key("books").Where(xjson.Field("price").Lt(10))
+func Field(steps ...interface{}) FilterField {
+	return engine.Field(steps...)
+}
+
+// RootField is like Field but starts at the root of the document, so that
+// elements can be compared with document-level values:
+//
+//	xjson.Field("price").Lt(xjson.RootField("limits", "price"))
+func RootField(steps ...interface{}) FilterField {
+	return engine.RootField(steps...)
+}
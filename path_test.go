@@ -0,0 +1,39 @@
+package xjson
+
+import "testing"
+
+func TestPathBuilder(t *testing.T) {
+	root, err := Parse(`{"store":{"book":[{"title":"A","price":8},{"title":"B","price":12}]},"user.profile":{"a\"b":1}}`)
+	if err != nil {
+		t.Fatalf("Parse failed: %v", err)
+	}
+	p := Path().Key("store").Key("book").Index(1).Key("title")
+	if got := root.QueryPath(p).String(); got != "B" {
+		t.Errorf("QueryPath = %q, want B", got)
+	}
+	if got := root.Query(p.SlashString()).String(); got != "B" {
+		t.Errorf("Query(%s) = %q, want B", p.SlashString(), got)
+	}
+
+	user, err := ParsePath(`/['user.profile']`)
+	if err != nil {
+		t.Fatalf("ParsePath failed: %v", err)
+	}
+	key := user.Key(`a"b`)
+	if got, want := key.String(), `/['user.profile']/['a"b']`; got != want {
+		t.Errorf("String() = %s, want %s", got, want)
+	}
+	if got := root.QueryPath(key).Int(); got != 1 {
+		t.Errorf("QueryPath(%s) = %d, want 1", key, got)
+	}
+
+	cheap := Path().Key("store").Key("book").Where(Field("price").Lt(10)).Key("title")
+	if got := root.QueryPath(cheap).Strings(); len(got) != 1 || got[0] != "A" {
+		t.Errorf("QueryPath(%s) = %v, want [A]", cheap, got)
+	}
+
+	limited := Path().Key("store").Key("book").Where(Field("price").Gt(RootField("store", "book", 0, "price"))).Key("title")
+	if got := root.QueryPath(limited).Strings(); len(got) != 1 || got[0] != "B" {
+		t.Errorf("QueryPath(%s) = %v, want [B]", limited, got)
+	}
+}
@@ -0,0 +1,37 @@
+package xjson
+
+import "github.com/474420502/xjson/internal/engine"
+
+// Visitor is an alias for the engine Visitor that Scan reports tokens to.
+type Visitor = engine.Visitor
+
+// NopVisitor implements every Visitor callback by returning ScanContinue;
+// embed it to implement only some of them.
+type NopVisitor = engine.NopVisitor
+
+// ScanAction is an alias for the engine ScanAction returned by Visitor
+// callbacks.
+type ScanAction = engine.ScanAction
+
+const (
+	ScanContinue = engine.ScanContinue
+	ScanSkip     = engine.ScanSkip
+	ScanStop     = engine.ScanStop
+)
+
+// Scan reports the tokens of the JSON document in data to v without
+// building nodes. Callbacks can skip containers and the values of keys, or
+// stop the scan. Malformed JSON fails with the same *SyntaxError as
+// MustParse, except inside skipped values, which are only checked for
+// balanced brackets and quotes.
+func Scan(data []byte, v Visitor) error {
+	return engine.Scan(data, v)
+}
+
+// ScanPaths calls fn with the JSON text of each value at one of paths, such
+// as "a.b" or "items[*].id", and the path that found it. Values no path
+// leads into are skipped, and a steady stream of documents is scanned
+// without allocating.
+func ScanPaths(data []byte, paths []string, fn func(path string, raw []byte)) error {
+	return engine.ScanPaths(data, paths, fn)
+}
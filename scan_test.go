@@ -0,0 +1,67 @@
+package xjson
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+)
+
+// keyCounter counts the keys of the top-level object.
+type keyCounter struct {
+	NopVisitor
+	keys int
+}
+
+func (c *keyCounter) OnKey(depth int, key []byte) ScanAction {
+	if depth == 1 {
+		c.keys++
+	}
+	return ScanSkip
+}
+
+func TestScan(t *testing.T) {
+	c := &keyCounter{}
+	if err := Scan([]byte(`{"a": {"x": 1}, "b": [1, 2], "c": "s"}`), c); err != nil || c.keys != 3 {
+		t.Fatalf("keys = %d, %v, want 3", c.keys, err)
+	}
+	if err := Scan([]byte(`{"a" 1}`), c); err == nil {
+		t.Fatal("expected a syntax error")
+	}
+}
+
+func TestScanPaths(t *testing.T) {
+	doc := []byte(`{"user": {"id": 7, "name": "ann"}, "items": [{"id": 1}, {"id": 2}], "blob": {"id": 0}}`)
+	got := map[string][]string{}
+	err := ScanPaths(doc, []string{"user.id", "items[*].id"}, func(path string, raw []byte) {
+		got[path] = append(got[path], string(raw))
+	})
+	if err != nil {
+		t.Fatalf("ScanPaths failed: %v", err)
+	}
+	want := map[string][]string{"user.id": {"7"}, "items[*].id": {"1", "2"}}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("ScanPaths = %v, want %v", got, want)
+	}
+}
+
+func TestValid(t *testing.T) {
+	for _, doc := range []string{`{"a":[1,"x",null]}`, ` 1.5 `, `"é"`} {
+		if !Valid([]byte(doc)) || !ValidString(doc) || ValidateBytes([]byte(doc)) != nil {
+			t.Errorf("%s should be valid", doc)
+		}
+	}
+	for _, doc := range []string{``, `{"a":1,}`, `[1] [2]`, `{'a':1}`, `"\x"`} {
+		if Valid([]byte(doc)) || ValidString(doc) {
+			t.Errorf("%s should not be valid", doc)
+		}
+		_, want := MustParse(doc)
+		if _, err := Parse(doc); err == nil && want == nil {
+			t.Errorf("%s: Parse and MustParse accept it", doc)
+		}
+	}
+	err := ValidateBytes([]byte("[1,\n 2,\n x]"))
+	var syntaxErr *SyntaxError
+	if !errors.As(err, &syntaxErr) || syntaxErr.Line != 3 || syntaxErr.Column != 2 || syntaxErr.Offset != 9 {
+		t.Fatalf("ValidateBytes = %v, want an error at line 3, column 2", err)
+	}
+}
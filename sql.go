@@ -0,0 +1,164 @@
+package xjson
+
+import (
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/474420502/xjson/internal/engine"
+)
+
+// Document holds a root Node for database/sql: scan a JSON column into a
+// *Document and pass a Document as a query argument.
+//
+//	var doc xjson.Document
+//	err := db.QueryRow(`SELECT data FROM orders WHERE id = $1`, id).Scan(&doc)
+//	doc.Root.SetByPath("/status", "shipped")
+//	_, err = db.Exec(`UPDATE orders SET data = $1 WHERE id = $2`, doc, id)
+type Document struct {
+	Root Node
+	// CreateArrays makes Append and Prepend create a missing array, and the
+	// objects leading to it, instead of failing with ErrNotFound.
+	CreateArrays bool
+	// OverwriteConflicts makes Set replace a value in the way of a key step
+	// with an empty object instead of failing with ErrPathConflict.
+	OverwriteConflicts bool
+
+	// meta holds the values of SetMeta.
+	meta map[string]interface{}
+}
+
+var (
+	_ sql.Scanner   = (*Document)(nil)
+	_ driver.Valuer = Document{}
+	_ io.WriterTo   = (*Document)(nil)
+)
+
+// Scan implements sql.Scanner. It parses a []byte or string column lazily,
+// after checking that the whole document is valid JSON, and fails with the
+// *SyntaxError of MustParse otherwise. The driver's bytes are copied, so the
+// document stays valid after the next row. SQL NULL gives a root that is
+// JSON null. The document is attached to the new root, see DocumentOf.
+func (d *Document) Scan(src interface{}) error {
+	var raw []byte
+	switch v := src.(type) {
+	case nil:
+		raw = []byte("null")
+	case []byte:
+		raw = append([]byte(nil), v...)
+	case string:
+		raw = []byte(v)
+	default:
+		return fmt.Errorf("xjson: cannot scan %T into Document", src)
+	}
+	if err := Scan(raw, NopVisitor{}); err != nil {
+		return err
+	}
+	root, err := Parse(raw)
+	if err != nil {
+		return err
+	}
+	d.Root = root
+	d.attach()
+	return nil
+}
+
+// Value implements driver.Valuer with the JSON text of Root, which for a
+// document that was not written to is the text it was parsed from. A
+// Document without a Root is SQL NULL; a root that is JSON null is the text
+// null.
+func (d Document) Value() (driver.Value, error) {
+	if d.Root == nil {
+		return nil, nil
+	}
+	return d.Root.Bytes()
+}
+
+// WriteTo implements io.WriterTo with the JSON text of Root, the text
+// Value returns, streamed to w without building it in memory first. See
+// Node.WriteTo.
+func (d *Document) WriteTo(w io.Writer) (int64, error) {
+	if d.Root == nil {
+		return 0, &PathError{Op: "WriteTo", Err: errors.New("document has no root")}
+	}
+	return d.Root.WriteTo(w)
+}
+
+// Set writes value at path in Root like SetByPathWith, creating missing
+// objects on the way. A step meeting a value of the wrong type fails with a
+// *PathError wrapping ErrPathConflict unless OverwriteConflicts is set; see
+// SetOptions.
+func (d *Document) Set(path string, value interface{}) error {
+	if d.Root == nil {
+		return &PathError{Op: "Set", Path: path, Err: errors.New("document has no root")}
+	}
+	return d.Root.SetByPathWith(path, value, SetOptions{OverwriteConflicts: d.OverwriteConflicts}).Error()
+}
+
+// Append appends values to the array at path in Root, a path of key and
+// index steps as for SetByPath. The values are converted like those of
+// AppendAll, and an array that has not been read is not parsed: appending
+// to a long array copies its text once instead of building a node for each
+// element. A missing array fails with a *PathError wrapping ErrNotFound,
+// unless CreateArrays is set, and a value that is not an array with one
+// wrapping ErrTypeAssertion.
+func (d *Document) Append(path string, values ...interface{}) error {
+	return d.extend("Append", path, values, false)
+}
+
+// Prepend is Append inserting the values, in order, before the first
+// element.
+func (d *Document) Prepend(path string, values ...interface{}) error {
+	return d.extend("Prepend", path, values, true)
+}
+
+func (d *Document) extend(op, path string, values []interface{}, prepend bool) error {
+	if d.Root == nil {
+		return &PathError{Op: op, Path: path, Err: errors.New("document has no root")}
+	}
+	return engine.ExtendArray(unwrapNode(d.Root), op, path, values, prepend, d.CreateArrays)
+}
+
+// NodeAt returns the deepest value of Root whose source text contains the
+// byte offset, such as the one under an editor's cursor. Offsets count from
+// the start of the text Root was parsed from, like Position().Offset. Only
+// the containers on the way are parsed, one level each.
+func (d *Document) NodeAt(offset int) (Node, error) {
+	if d.Root == nil {
+		return nil, &PathError{Op: "NodeAt", Err: errors.New("document has no root")}
+	}
+	node, err := engine.NodeAt(unwrapNode(d.Root), offset)
+	if err != nil {
+		return nil, err
+	}
+	return nodeWrapper{node}, nil
+}
+
+// Refresh applies a text edit to the document: the bytes start to end of
+// the source text of Root are replaced with replacement, and only the
+// deepest value containing them is parsed again. Nodes of the values before
+// the edit are kept as they are, those after it with their positions
+// shifted, and values not yet read stay unparsed. An edit that cuts through
+// a value without covering it whole fails with an error wrapping
+// ErrSpanningEdit, and invalid new text with a *SyntaxError located in the
+// edited text; either way the document is unchanged. Refresh only follows
+// the source text, so it fails on a document written to through Set and the
+// other writes. Handles held on the reparsed value become stale; when that
+// value is the root itself, Root is replaced.
+func (d *Document) Refresh(start, end int, replacement []byte) error {
+	if d.Root == nil {
+		return &PathError{Op: "Refresh", Err: errors.New("document has no root")}
+	}
+	old := unwrapNode(d.Root)
+	root, err := engine.Refresh(old, start, end, replacement)
+	if err != nil {
+		return err
+	}
+	if root != old {
+		d.Root = nodeWrapper{root}
+		d.attach()
+	}
+	return nil
+}
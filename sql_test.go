@@ -0,0 +1,312 @@
+package xjson
+
+import (
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"io"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// memDriver is a database/sql driver over one column of values: any Exec
+// appends its single argument, any Query returns the column, and any other
+// statement text is ignored.
+type memDriver struct {
+	mu   sync.Mutex
+	rows []driver.Value
+}
+
+func (d *memDriver) Open(string) (driver.Conn, error) { return memConn{d}, nil }
+
+type memConn struct{ d *memDriver }
+
+func (c memConn) Prepare(string) (driver.Stmt, error) { return memStmt(c), nil }
+func (c memConn) Close() error                        { return nil }
+func (c memConn) Begin() (driver.Tx, error)           { return nil, errors.New("no transactions") }
+
+type memStmt struct{ d *memDriver }
+
+func (s memStmt) Close() error  { return nil }
+func (s memStmt) NumInput() int { return -1 }
+
+func (s memStmt) Exec(args []driver.Value) (driver.Result, error) {
+	if len(args) != 1 {
+		return nil, errors.New("want one argument")
+	}
+	s.d.mu.Lock()
+	defer s.d.mu.Unlock()
+	s.d.rows = append(s.d.rows, args[0])
+	return driver.RowsAffected(1), nil
+}
+
+func (s memStmt) Query([]driver.Value) (driver.Rows, error) {
+	s.d.mu.Lock()
+	defer s.d.mu.Unlock()
+	return &memRows{rows: append([]driver.Value(nil), s.d.rows...)}, nil
+}
+
+type memRows struct{ rows []driver.Value }
+
+func (r *memRows) Columns() []string { return []string{"data"} }
+func (r *memRows) Close() error      { return nil }
+
+func (r *memRows) Next(dest []driver.Value) error {
+	if len(r.rows) == 0 {
+		return io.EOF
+	}
+	// Hand out a buffer the driver reuses, like real drivers do.
+	if b, ok := r.rows[0].([]byte); ok {
+		dest[0] = append(make([]byte, 0, len(b)), b...)
+	} else {
+		dest[0] = r.rows[0]
+	}
+	r.rows = r.rows[1:]
+	return nil
+}
+
+var memDB = &memDriver{}
+
+func init() { sql.Register("xjsonmem", memDB) }
+
+func TestDocumentSQLRoundTrip(t *testing.T) {
+	db, err := sql.Open("xjsonmem", "")
+	if err != nil {
+		t.Fatalf("Open failed: %v", err)
+	}
+	defer db.Close()
+	memDB.rows = nil
+
+	root, err := Parse(`{"id": 7, "status": "new"}`)
+	if err != nil {
+		t.Fatalf("Parse failed: %v", err)
+	}
+	if _, err := db.Exec("INSERT", Document{Root: root}); err != nil {
+		t.Fatalf("Exec of an unmodified document failed: %v", err)
+	}
+	root.Set("status", "shipped")
+	if _, err := db.Exec("INSERT", &Document{Root: root}); err != nil {
+		t.Fatalf("Exec of a modified document failed: %v", err)
+	}
+	if _, err := db.Exec("INSERT", Document{}); err != nil {
+		t.Fatalf("Exec of an empty document failed: %v", err)
+	}
+	if _, err := db.Exec("INSERT", `[1, "two"]`); err != nil {
+		t.Fatalf("Exec of a string failed: %v", err)
+	}
+
+	rows, err := db.Query("SELECT")
+	if err != nil {
+		t.Fatalf("Query failed: %v", err)
+	}
+	defer rows.Close()
+	var docs []Document
+	for rows.Next() {
+		var doc Document
+		if err := rows.Scan(&doc); err != nil {
+			t.Fatalf("Scan failed: %v", err)
+		}
+		docs = append(docs, doc)
+	}
+	if err := rows.Err(); err != nil {
+		t.Fatalf("rows failed: %v", err)
+	}
+
+	want := []string{`{"id": 7, "status": "new"}`, `{"id": 7, "status": "shipped"}`, `null`, `[1, "two"]`}
+	if len(docs) != len(want) {
+		t.Fatalf("scanned %d documents, want %d", len(docs), len(want))
+	}
+	for i, doc := range docs {
+		if !doc.Root.IsValid() || doc.Root.String() != want[i] {
+			t.Errorf("document %d = %s (valid %v), want %s", i, doc.Root.String(), doc.Root.IsValid(), want[i])
+		}
+	}
+	if docs[1].Root.Query("/status").String() != "shipped" || docs[2].Root.Type() != Null {
+		t.Error("scanned documents should be queryable")
+	}
+}
+
+func TestDocumentScan(t *testing.T) {
+	var doc Document
+	if err := doc.Scan(nil); err != nil || doc.Root.Type() != Null || !doc.Root.IsValid() {
+		t.Errorf("Scan(nil) = %v, root %v, want a valid null root", err, doc.Root)
+	}
+
+	buf := []byte(`{"a":[1,2]}`)
+	if err := doc.Scan(buf); err != nil {
+		t.Fatalf("Scan of bytes failed: %v", err)
+	}
+	copy(buf, `{"b":[3,4]}`)
+	if got := doc.Root.Query("/a[1]").Int(); got != 2 {
+		t.Errorf("/a[1] after the driver reused its buffer = %d, want 2", got)
+	}
+
+	for _, src := range []interface{}{`{"a":}`, []byte(`[1,2`), `{"a":[1,}`} {
+		doc := Document{Root: NewObject()}
+		var syntaxErr *SyntaxError
+		if err := doc.Scan(src); !errors.As(err, &syntaxErr) {
+			t.Errorf("Scan(%q) = %v, want a *SyntaxError", src, err)
+		}
+		if doc.Root.Type() != Object {
+			t.Errorf("a failed Scan(%q) should leave the document alone", src)
+		}
+	}
+	if err := doc.Scan(""); err == nil {
+		t.Error("Scan of an empty string should fail")
+	}
+	if err := doc.Scan(42); err == nil {
+		t.Error("Scan of an int should fail")
+	}
+}
+
+func TestDocumentValue(t *testing.T) {
+	root, _ := Parse(` {"a": 1} `)
+	v, err := Document{Root: root}.Value()
+	if b, ok := v.([]byte); err != nil || !ok || string(b) != ` {"a": 1} ` {
+		t.Errorf("Value() = %#v, %v, want the source text", v, err)
+	}
+	if v, err := (Document{}).Value(); v != nil || err != nil {
+		t.Errorf("Value() without a root = %#v, %v, want NULL", v, err)
+	}
+	missing := root.Query("/missing")
+	if _, err := (Document{Root: missing}).Value(); err == nil {
+		t.Error("Value() of an invalid root should fail")
+	}
+}
+
+func TestDocumentAppend(t *testing.T) {
+	root, err := Parse(`{"user": {"posts": []}, "name": "ann"}`)
+	if err != nil {
+		t.Fatalf("Parse failed: %v", err)
+	}
+	doc := Document{Root: root}
+	if err := doc.Append("/user/posts", 1, 2); err != nil {
+		t.Fatalf("Append failed: %v", err)
+	}
+	if err := doc.Prepend("/user/posts", 0); err != nil {
+		t.Fatalf("Prepend failed: %v", err)
+	}
+	if got := doc.Root.Query("/user/posts").String(); got != "[0,1,2]" {
+		t.Errorf("/user/posts = %s, want [0,1,2]", got)
+	}
+
+	if err := doc.Append("/user/drafts", 1); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Append to a missing array = %v, want ErrNotFound", err)
+	}
+	if err := doc.Append("/name", 1); !errors.Is(err, ErrTypeAssertion) {
+		t.Errorf("Append to a string = %v, want ErrTypeAssertion", err)
+	}
+	doc.CreateArrays = true
+	if err := doc.Append("/user/drafts", "d"); err != nil {
+		t.Errorf("Append creating the array failed: %v", err)
+	}
+	if got := doc.Root.Query("/user/drafts").String(); got != `["d"]` {
+		t.Errorf("/user/drafts = %s, want [\"d\"]", got)
+	}
+
+	var pathErr *PathError
+	if err := (&Document{}).Append("/a", 1); !errors.As(err, &pathErr) {
+		t.Errorf("Append without a root = %v, want a *PathError", err)
+	}
+}
+
+func TestDocumentSetConflicts(t *testing.T) {
+	const src = `{"user":{"name":"ann","tags":["a"]}}`
+	forEachParser(t, src, func(t *testing.T, root Node) {
+		doc := Document{Root: root}
+		if err := doc.Set("/user/age", 7); err != nil {
+			t.Errorf("Set failed: %v", err)
+		}
+		for _, path := range []string{"/user/name/first", "/user/tags/first", "/user/name[0]"} {
+			var pathErr *PathError
+			err := doc.Set(path, "x")
+			if !errors.Is(err, ErrPathConflict) || !errors.As(err, &pathErr) || pathErr.Path != path {
+				t.Errorf("Set(%s) = %v, want a *PathError wrapping ErrPathConflict", path, err)
+			}
+			// The node write follows the same policy.
+			if err := root.SetByPath(path, "x").Error(); !errors.Is(err, ErrPathConflict) {
+				t.Errorf("SetByPath(%s) = %v, want ErrPathConflict", path, err)
+			}
+		}
+
+		doc.OverwriteConflicts = true
+		if err := doc.Set("/user/name/first", "ann"); err != nil {
+			t.Errorf("Set overwriting a string failed: %v", err)
+		}
+		if err := root.SetByPathWith("/user/tags/first", "a", SetOptions{OverwriteConflicts: true}).Error(); err != nil {
+			t.Errorf("SetByPathWith overwriting an array failed: %v", err)
+		}
+		if err := doc.Set("/user/age[0]", 1); !errors.Is(err, ErrPathConflict) {
+			t.Errorf("Set with an index on a number = %v, want ErrPathConflict", err)
+		}
+		want := `{"user":{"name":{"first":"ann"},"tags":{"first":"a"},"age":7}}`
+		if got := doc.Root.String(); got != want {
+			t.Errorf("document = %s, want %s", got, want)
+		}
+	})
+	if err := (&Document{}).Set("/a", 1); err == nil {
+		t.Error("Set without a root should fail")
+	}
+}
+
+func TestDocumentRefresh(t *testing.T) {
+	src := []byte(`{"title": "draft", "items": [1, 2]}`)
+	root, err := ParseWithOptions(src, ParseOptions{TrackPositions: true})
+	if err != nil {
+		t.Fatalf("Parse failed: %v", err)
+	}
+	doc := NewDocument(root)
+
+	// The cursor sits on the 2.
+	node, err := doc.NodeAt(32)
+	if err != nil || node.Path() != "/items[1]" {
+		t.Fatalf("NodeAt = %v, %v", node, err)
+	}
+	if err := doc.Refresh(32, 33, []byte(`20, 30`)); err != nil {
+		t.Fatalf("Refresh failed: %v", err)
+	}
+	if got := doc.Root.Query("/items").Len(); got != 3 {
+		t.Errorf("items has %d elements, want 3", got)
+	}
+	if pos, _ := doc.Root.Query("/items[2]").Position(); pos.Offset != 36 {
+		t.Errorf("Position of /items[2] = %+v, want offset 36", pos)
+	}
+
+	if err := doc.Refresh(12, 31, []byte(`1`)); !errors.Is(err, ErrSpanningEdit) {
+		t.Errorf("spanning Refresh = %v, want ErrSpanningEdit", err)
+	}
+
+	// Replacing the whole text replaces Root, which stays attached.
+	if err := doc.Refresh(0, len(doc.Root.Raw()), []byte(`[true]`)); err != nil {
+		t.Fatalf("Refresh failed: %v", err)
+	}
+	if !doc.Root.Query("[0]").Bool() || DocumentOf(doc.Root) != doc {
+		t.Errorf("Root = %s", doc.Root.Raw())
+	}
+}
+
+func TestDocumentWriteTo(t *testing.T) {
+	root, err := Parse([]byte(`{"id": 7, "tags": ["a"]}`))
+	if err != nil {
+		t.Fatalf("Parse failed: %v", err)
+	}
+	doc := NewDocument(root)
+	if err := doc.Append("/tags", "b"); err != nil {
+		t.Fatalf("Append failed: %v", err)
+	}
+	var buf strings.Builder
+	n, err := doc.WriteTo(&buf)
+	value, _ := doc.Value()
+	if err != nil || n != int64(buf.Len()) || buf.String() != string(value.([]byte)) {
+		t.Errorf("WriteTo = %d, %v, %q, want %q", n, err, buf.String(), value)
+	}
+	if buf.String() != `{"id": 7, "tags": ["a","b"]}` {
+		t.Errorf("WriteTo wrote %s", buf.String())
+	}
+
+	var empty Document
+	if _, err := empty.WriteTo(&buf); err == nil {
+		t.Error("WriteTo of a document without a root succeeded")
+	}
+}
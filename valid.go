@@ -0,0 +1,25 @@
+package xjson
+
+import (
+	"unsafe"
+
+	"github.com/474420502/xjson/internal/engine"
+)
+
+// Valid reports whether data is one JSON document that Parse and MustParse
+// accept, like encoding/json.Valid but with the rules of this package. No
+// nodes are built and nothing is allocated.
+func Valid(data []byte) bool {
+	return engine.ValidateBytes(data) == nil
+}
+
+// ValidString is Valid for a string, without copying it.
+func ValidString(s string) bool {
+	return Valid(unsafe.Slice(unsafe.StringData(s), len(s)))
+}
+
+// ValidateBytes is Valid returning why data is not valid: the *SyntaxError
+// MustParse would return, with the line, column and offset of the error.
+func ValidateBytes(data []byte) error {
+	return engine.ValidateBytes(data)
+}
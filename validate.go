@@ -0,0 +1,170 @@
+package xjson
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/474420502/xjson/internal/engine"
+)
+
+// Rule lists the checks Validate applies to every value matched by a path.
+// Zero-valued fields are not checked. Paths may contain wildcards such as
+// "/items[*]/id"; each matched element is checked on its own.
+type Rule struct {
+	// Type requires the value to be of this type. Invalid accepts any type.
+	Type NodeType
+	// NonEmpty rejects empty strings, arrays and objects.
+	NonEmpty bool
+	// Min and Max bound numeric values (inclusive).
+	Min *float64
+	Max *float64
+	// Pattern must match string values.
+	Pattern *regexp.Regexp
+	// Optional skips the remaining checks when the value is missing.
+	Optional bool
+}
+
+// Bound returns a pointer to v for use as Rule.Min or Rule.Max.
+func Bound(v float64) *float64 {
+	return &v
+}
+
+// ValidationError describes a single failed check.
+type ValidationError struct {
+	Path   string
+	Rule   string
+	Actual string
+}
+
+func (e *ValidationError) Error() string {
+	return fmt.Sprintf("%s: %s check failed, got %s", e.Path, e.Rule, e.Actual)
+}
+
+// ValidationErrors collects every failure reported by Require or Validate.
+type ValidationErrors []*ValidationError
+
+func (errs ValidationErrors) Error() string {
+	parts := make([]string, len(errs))
+	for i, err := range errs {
+		parts[i] = err.Error()
+	}
+	return strings.Join(parts, "; ")
+}
+
+// Unwrap exposes the individual failures to errors.Is and errors.As.
+func (errs ValidationErrors) Unwrap() []error {
+	out := make([]error, len(errs))
+	for i, err := range errs {
+		out[i] = err
+	}
+	return out
+}
+
+// Require reports every path that does not exist under root. The returned
+// error is a ValidationErrors value, or nil when all paths exist.
+func Require(root Node, paths ...string) error {
+	var errs ValidationErrors
+	for _, path := range paths {
+		matches, err := engine.ExpandPath(root, path)
+		if err != nil {
+			errs = append(errs, &ValidationError{Path: path, Rule: "path", Actual: err.Error()})
+			continue
+		}
+		for _, m := range matches {
+			if !m.Node.IsValid() {
+				errs = append(errs, &ValidationError{Path: m.Path, Rule: "required", Actual: "missing"})
+			}
+		}
+	}
+	if len(errs) == 0 {
+		return nil
+	}
+	return errs
+}
+
+// Validate checks the values under root against rules, keyed by path. Paths
+// are visited in sorted order so the reported failures are stable. The
+// returned error is a ValidationErrors value, or nil when every check passes.
+func Validate(root Node, rules map[string]Rule) error {
+	paths := make([]string, 0, len(rules))
+	for path := range rules {
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+
+	var errs ValidationErrors
+	for _, path := range paths {
+		rule := rules[path]
+		matches, err := engine.ExpandPath(root, path)
+		if err != nil {
+			errs = append(errs, &ValidationError{Path: path, Rule: "path", Actual: err.Error()})
+			continue
+		}
+		for _, m := range matches {
+			errs = rule.check(errs, m.Path, m.Node)
+		}
+	}
+	if len(errs) == 0 {
+		return nil
+	}
+	return errs
+}
+
+func (r Rule) check(errs ValidationErrors, path string, node Node) ValidationErrors {
+	fail := func(rule, actual string) {
+		errs = append(errs, &ValidationError{Path: path, Rule: rule, Actual: actual})
+	}
+
+	if !node.IsValid() {
+		if !r.Optional {
+			fail("required", "missing")
+		}
+		return errs
+	}
+	if r.Type != Invalid && node.Type() != r.Type {
+		fail("type "+r.Type.String(), node.Type().String())
+		return errs
+	}
+	if r.NonEmpty && isEmptyValue(node) {
+		fail("non-empty", "empty "+node.Type().String())
+	}
+	if r.Min != nil || r.Max != nil {
+		value, ok := node.RawFloat()
+		switch {
+		case node.Type() != Number || !ok:
+			fail("range", node.Type().String())
+		case r.Min != nil && value < *r.Min:
+			fail("min "+formatBound(*r.Min), node.String())
+		case r.Max != nil && value > *r.Max:
+			fail("max "+formatBound(*r.Max), node.String())
+		}
+	}
+	if r.Pattern != nil {
+		value, ok := node.RawString()
+		switch {
+		case node.Type() != String || !ok:
+			fail("pattern", node.Type().String())
+		case !r.Pattern.MatchString(value):
+			fail("pattern "+r.Pattern.String(), strconv.Quote(value))
+		}
+	}
+	return errs
+}
+
+func isEmptyValue(node Node) bool {
+	switch node.Type() {
+	case String:
+		value, _ := node.RawString()
+		return value == ""
+	case Array, Object:
+		return node.Len() == 0
+	}
+	return false
+}
+
+func formatBound(v float64) string {
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
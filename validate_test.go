@@ -0,0 +1,98 @@
+package xjson
+
+import (
+	"errors"
+	"regexp"
+	"strings"
+	"testing"
+)
+
+const validateDoc = `{
+	"name": "widget",
+	"tags": [],
+	"price": 120,
+	"sku": "AB-12",
+	"items": [{"id": 1, "qty": 2}, {"qty": 0}, {"id": "3", "qty": 5}]
+}`
+
+func TestRequireListsEveryMissingPath(t *testing.T) {
+	root, err := Parse(validateDoc)
+	if err != nil {
+		t.Fatalf("Parse failed: %v", err)
+	}
+
+	if err := Require(root, "/name", "/items[*]/qty"); err != nil {
+		t.Fatalf("expected all paths to exist, got %v", err)
+	}
+
+	err = Require(root, "/name", "/owner", "/items[*]/id", "/items[0:1]")
+	var errs ValidationErrors
+	if !errors.As(err, &errs) {
+		t.Fatalf("expected ValidationErrors, got %T %v", err, err)
+	}
+	var got []string
+	for _, e := range errs {
+		got = append(got, e.Path+" "+e.Rule)
+	}
+	want := []string{"/owner required", "/items[1]/id required", "/items[0:1] path"}
+	if strings.Join(got, ",") != strings.Join(want, ",") {
+		t.Fatalf("unexpected failures: %v", got)
+	}
+	if len(err.(interface{ Unwrap() []error }).Unwrap()) != 3 {
+		t.Fatalf("expected Unwrap to expose every failure")
+	}
+}
+
+func TestValidateRules(t *testing.T) {
+	root, err := Parse(validateDoc)
+	if err != nil {
+		t.Fatalf("Parse failed: %v", err)
+	}
+
+	err = Validate(root, map[string]Rule{
+		"/name":         {Type: String, NonEmpty: true},
+		"/tags":         {Type: Array, NonEmpty: true},
+		"/price":        {Type: Number, Min: Bound(1), Max: Bound(100)},
+		"/sku":          {Pattern: regexp.MustCompile(`^[A-Z]{2}-\d{3}$`)},
+		"/items[*]/id":  {Type: Number},
+		"/items[*]/qty": {Min: Bound(1)},
+		"/discount":     {Type: Number, Optional: true},
+		"/owner":        {Type: String},
+	})
+	var errs ValidationErrors
+	if !errors.As(err, &errs) {
+		t.Fatalf("expected ValidationErrors, got %T %v", err, err)
+	}
+
+	want := []string{
+		"/items[1]/id: required check failed, got missing",
+		"/items[2]/id: type number check failed, got string",
+		"/items[1]/qty: min 1 check failed, got 0",
+		"/owner: required check failed, got missing",
+		"/price: max 100 check failed, got 120",
+		`/sku: pattern ^[A-Z]{2}-\d{3}$ check failed, got "AB-12"`,
+		"/tags: non-empty check failed, got empty array",
+	}
+	if len(errs) != len(want) {
+		t.Fatalf("unexpected failures: %v", err)
+	}
+	for i := range want {
+		if errs[i].Error() != want[i] {
+			t.Fatalf("failure %d = %q, want %q", i, errs[i].Error(), want[i])
+		}
+	}
+
+	var single *ValidationError
+	if !errors.As(err, &single) || single.Path != "/items[1]/id" {
+		t.Fatalf("expected errors.As to reach the first failure, got %v", single)
+	}
+
+	if err := Validate(root, map[string]Rule{"/name": {Min: Bound(0)}, "/price": {Pattern: regexp.MustCompile(`.`)}}); err == nil ||
+		!strings.Contains(err.Error(), "/name: range check failed, got string") ||
+		!strings.Contains(err.Error(), "/price: pattern check failed, got number") {
+		t.Fatalf("expected range and pattern checks to reject other types, got %v", err)
+	}
+	if err := Validate(root, map[string]Rule{"/name": {Type: String}, "/items[*]/qty": {Type: Number, Max: Bound(5)}}); err != nil {
+		t.Fatalf("expected passing rules to return nil, got %v", err)
+	}
+}
@@ -18,6 +18,9 @@ const (
 	Number  = core.Number
 	Bool    = core.Bool
 	Null    = core.Null
+	// MultiMatch is the ResultType of a wildcard, recursive, filter or slice
+	// result.
+	MultiMatch = core.MultiMatch
 )
 
 // PathFunc is an alias for the core PathFunc.
@@ -26,6 +29,13 @@ type PathFunc = core.PathFunc
 // UnaryPathFunc is an alias for the core UnaryPathFunc.
 type UnaryPathFunc = core.UnaryPathFunc
 
+// ArgsPathFunc is an alias for the core ArgsPathFunc taken by
+// Node.RegisterFuncArgs.
+type ArgsPathFunc = core.ArgsPathFunc
+
+// Arg is an alias for the core Arg, a literal argument of a path function.
+type Arg = core.Arg
+
 // PredicateFunc is an alias for the core PredicateFunc.
 type PredicateFunc = core.PredicateFunc
 
@@ -35,11 +45,198 @@ type TransformFunc = core.TransformFunc
 // Node is an alias for the core Node.
 type Node = core.Node
 
+// Position is an alias for the core Position.
+type Position = core.Position
+
+// SyntaxError is an alias for the core SyntaxError.
+type SyntaxError = core.SyntaxError
+
+// PathError is an alias for the core PathError, the panic value of MustQuery
+// and the Must* conversions.
+type PathError = core.PathError
+
+// MustBehavior is an alias for the engine MustBehavior, see SetMustBehavior.
+type MustBehavior = engine.MustBehavior
+
+const (
+	MustPanics      = engine.MustPanics
+	MustReturnsZero = engine.MustReturnsZero
+)
+
+// SetMustBehavior sets what MustQuery and the Must* conversions of the
+// nodes of every document without a behavior of its own do when they fail,
+// and returns the previous behavior. Under MustReturnsZero they return the
+// zero value, or an invalid node for MustQuery, and the *PathError they
+// would panic with is kept as the LastError of the node. The default is
+// MustPanics. It is safe to call while documents are in use.
+func SetMustBehavior(b MustBehavior) MustBehavior {
+	return engine.SetMustBehavior(b)
+}
+
+// SetDocumentMustBehavior sets the MustBehavior of the document doc belongs
+// to, in place of the one set by SetMustBehavior, and returns the previous
+// behavior of the document. Its nodes, the nodes derived from them, the
+// invalid nodes their Get, Index and Query lookups return and Detach copies
+// all follow it.
+func SetDocumentMustBehavior(doc Node, b MustBehavior) MustBehavior {
+	return engine.SetDocumentMustBehavior(unwrapNode(doc), b)
+}
+
+// MustBehaviorOf returns the MustBehavior node follows: that of its
+// document, or the one set by SetMustBehavior.
+func MustBehaviorOf(node Node) MustBehavior {
+	return engine.MustBehaviorOf(unwrapNode(node))
+}
+
+// TypeError is an alias for the core TypeError returned by the Try* accessors.
+type TypeError = core.TypeError
+
+// PanicError is an alias for the core PanicError that a query, CallFunc or
+// Apply returns in place of a panic.
+type PanicError = core.PanicError
+
+// Groups is an alias for the core Groups returned by Node.GroupBy.
+type Groups = core.Groups
+
+// ErrTypeAssertion is wrapped by Must* panics when the node has another type.
+// A *TypeError also matches it.
+var ErrTypeAssertion = core.ErrTypeAssertion
+
+// ParseOptions is an alias for the engine ParseOptions.
+type ParseOptions = engine.ParseOptions
+
+// DuplicateKeyPolicy is an alias for the engine DuplicateKeyPolicy, see
+// ParseOptions.DuplicateKeys.
+type DuplicateKeyPolicy = engine.DuplicateKeyPolicy
+
+const (
+	LastWins         = engine.LastWins
+	FirstWins        = engine.FirstWins
+	ErrorOnDuplicate = engine.ErrorOnDuplicate
+)
+
+// Dialect is an alias for the engine Dialect, see ParseOptions.Dialect.
+type Dialect = engine.Dialect
+
+const (
+	StandardJSON = engine.StandardJSON
+	JSON5        = engine.JSON5
+)
+
+// ErrNoMatches is returned by Node.Bytes when a multi-match query matched nothing.
+var ErrNoMatches = core.ErrNoMatches
+
+// ErrNotInteger is wrapped by the *TypeError of IntExact or TryInt on a
+// number with a fractional part.
+var ErrNotInteger = core.ErrNotInteger
+
+// ErrNumberOverflow is wrapped by the *TypeError of TryFloat on a number
+// too large for a float64, by the error of a write of an infinite float, and
+// by the error of serializing a JSON5 Infinity or NaN.
+var ErrNumberOverflow = core.ErrNumberOverflow
+
+// ErrNotFound is wrapped by the errors of SetByPath, SetStrict, Replace and
+// Document.Append for a path step that finds nothing.
+var ErrNotFound = core.ErrNotFound
+
+// ErrPathConflict is wrapped by the errors of writes by path, SetByPath and
+// Document.Set among them, whose step meets a value of the wrong type.
+var ErrPathConflict = core.ErrPathConflict
+
+// ErrIndexOutOfBounds is wrapped by errors for array indices outside the array.
+var ErrIndexOutOfBounds = core.ErrIndexOutOfBounds
+
+// ErrInvalidParam is wrapped by errors for query parameters that cannot be bound.
+var ErrInvalidParam = core.ErrInvalidParam
+
+// ErrReleased is the error of the nodes of a pooled document after Release.
+var ErrReleased = core.ErrReleased
+
+// ErrStaleResult is wrapped by the error of a node that a write replaced or
+// removed, and of the nodes below it.
+var ErrStaleResult = core.ErrStaleResult
+
+// ErrMaxDepthExceeded is wrapped by the error of a recursive query that
+// would descend below ParseOptions.MaxRecursionDepth.
+var ErrMaxDepthExceeded = core.ErrMaxDepthExceeded
+
+// ErrCycleDetected is wrapped by the error of a write whose node value is
+// the target of the write or one of its ancestors.
+var ErrCycleDetected = core.ErrCycleDetected
+
+// ErrSpanningEdit is wrapped by the error of a Document.Refresh whose edit
+// does not lie within one value.
+var ErrSpanningEdit = core.ErrSpanningEdit
+
+// DocMetrics is an alias for the core DocMetrics returned by Node.Metrics.
+type DocMetrics = core.DocMetrics
+
+// NumericSummary is an alias for the core NumericSummary returned by
+// Node.NumericSummary.
+type NumericSummary = core.NumericSummary
+
+// Schema is an alias for the core Schema returned by Node.Schema.
+type Schema = core.Schema
+
+// SchemaOptions is an alias for the core SchemaOptions taken by
+// Node.SchemaWith.
+type SchemaOptions = core.SchemaOptions
+
+// DefaultSchemaSample is the number of elements of an array that
+// Node.Schema describes.
+const DefaultSchemaSample = core.DefaultSchemaSample
+
+// FormOptions is an alias for the core FormOptions taken by
+// Node.ToURLValues.
+type FormOptions = core.FormOptions
+
+// FormNesting is an alias for the core FormNesting, see
+// FormOptions.Nesting.
+type FormNesting = core.FormNesting
+
+const (
+	DottedKeys    = core.DottedKeys
+	BracketKeys   = core.BracketKeys
+	ErrorOnNested = core.ErrorOnNested
+)
+
+// SetOptions is an alias for the core SetOptions taken by
+// Node.SetByPathWith.
+type SetOptions = core.SetOptions
+
+// SerializeOptions is an alias for the core SerializeOptions taken by
+// Node.BytesWith.
+type SerializeOptions = core.SerializeOptions
+
+// DefaultRedactPlaceholder is the JSON text written for a redacted value
+// when SerializeOptions.Placeholder is empty.
+const DefaultRedactPlaceholder = core.DefaultRedactPlaceholder
+
+// Iterator is an alias for the core Iterator returned by Node.Iter.
+type Iterator = core.Iterator
+
+// ErrModifiedDuringIteration is the Err of an Iterator whose array or object
+// was written to during the iteration.
+var ErrModifiedDuringIteration = core.ErrModifiedDuringIteration
+
+// NodePool is an alias for the engine NodePool, see ParseOptions.Pool.
+type NodePool = engine.NodePool
+
+// NewNodePool returns a pool for ParseOptions.Pool. One pool can serve many
+// documents, concurrently too.
+func NewNodePool() *NodePool {
+	return engine.NewNodePool()
+}
+
 // nodeWrapper wraps a core.Node to provide additional methods.
 type nodeWrapper struct {
 	core.Node
 }
 
+// Unwrap returns the engine node, which a write given the node as a value
+// attaches to its document.
+func (nw nodeWrapper) Unwrap() core.Node { return nw.Node }
+
 type PreparedQuery struct {
 	compiled *engine.CompiledQuery
 }
@@ -48,6 +245,10 @@ func (nw nodeWrapper) SetByPath(path string, value interface{}) Node {
 	return nodeWrapper{nw.Node.SetByPath(path, value)}
 }
 
+func (nw nodeWrapper) SetByPathWith(path string, value interface{}, opts SetOptions) Node {
+	return nodeWrapper{nw.Node.SetByPathWith(path, value, opts)}
+}
+
 func CompileQuery(path string) (*PreparedQuery, error) {
 	compiled, err := engine.CompileQuery(path)
 	if err != nil {
@@ -81,8 +282,33 @@ func (pq *PreparedQuery) Query(node Node) Node {
 	return pq.compiled.Query(node)
 }
 
+// NewObject returns the root of a new document holding an empty object, to
+// be built up with Set and the other writes.
+func NewObject() Node {
+	return nodeWrapper{engine.NewObject()}
+}
+
+// NewArray returns the root of a new document holding an empty array, to be
+// built up with Append and the other writes.
+func NewArray() Node {
+	return nodeWrapper{engine.NewArray()}
+}
+
+// FromValue returns the root of a new document holding v, which may be any
+// value Set accepts: maps with string keys, slices of interface{}, strings,
+// numbers, bools, json.Number, nil and nodes of documents of their own,
+// nested to any depth.
+func FromValue(v interface{}) (Node, error) {
+	node, err := engine.FromValue(v)
+	if err != nil {
+		return nil, err
+	}
+	return nodeWrapper{node}, nil
+}
+
 // Parse parses a raw JSON string or bytes and returns the root Node.
 // This function creates a lazy-parsed tree where nodes are parsed on demand.
+// Each value is checked against RFC 8259 when it is first read.
 func Parse(data interface{}) (Node, error) {
 	var raw []byte
 	switch v := data.(type) {
@@ -105,9 +331,44 @@ func Parse(data interface{}) (Node, error) {
 	return nodeWrapper{node}, nil
 }
 
+// ParseWithOptions parses a raw JSON string or bytes lazily like Parse,
+// applying opts. Set TrackPositions to make Node.Position report where
+// values start in the source, Pool to allocate nodes from a NodePool,
+// ValidateUTF8 to reject strings with bad escapes or invalid UTF-8 and
+// Dialect to accept JSON5.
+func ParseWithOptions(data interface{}, opts ParseOptions) (Node, error) {
+	var raw []byte
+	switch v := data.(type) {
+	case string:
+		raw = []byte(v)
+	case []byte:
+		raw = v
+	default:
+		return nil, fmt.Errorf("unsupported data type: %T", data)
+	}
+
+	if len(raw) == 0 {
+		return nil, fmt.Errorf("empty data")
+	}
+
+	node, err := engine.ParseWithOptions(raw, opts)
+	if err != nil {
+		return nil, err
+	}
+	return nodeWrapper{node}, nil
+}
+
+// ParseWithPaths parses data lazily like Parse, and parses the values at
+// paths right away so that the first queries of them find them ready. Paths
+// that find nothing are skipped; see ParseOptions.Preload and RequirePreload.
+func ParseWithPaths(data interface{}, paths ...string) (Node, error) {
+	return ParseWithOptions(data, ParseOptions{Preload: paths})
+}
+
 // MustParse parses a raw JSON string or bytes and returns the root Node.
 // This is the main entry point for using the XJSON library.
-// This function will parse the entire JSON tree eagerly.
+// This function will parse the entire JSON tree eagerly, and rejects any
+// document RFC 8259 does not allow.
 func MustParse(data interface{}) (Node, error) {
 	var raw []byte
 	switch v := data.(type) {
@@ -1,6 +1,14 @@
 package xjson
 
-import "testing"
+import (
+	"context"
+	"errors"
+	"math"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
 
 func TestParseAndMustParseWrappers(t *testing.T) {
 	root, err := Parse(`{"a":1}`)
@@ -78,3 +86,1019 @@ func TestPreparedQueryWrapper(t *testing.T) {
 		t.Fatalf("unexpected MustCompileQuery result: %q", got)
 	}
 }
+
+func TestRegisteredFuncsThroughQueryChains(t *testing.T) {
+	root, err := Parse(`{"store":{"book":[{"title":"A","price":8},{"title":"B","price":30},{"title":"C","price":12}]}}`)
+	if err != nil {
+		t.Fatalf("Parse failed: %v", err)
+	}
+
+	missing := root.Query("/store/book[@cheap]/title")
+	if missing.IsValid() || missing.Error() == nil || !strings.Contains(missing.Error().Error(), "cheap") {
+		t.Fatalf("expected unknown function error naming 'cheap', got valid=%v err=%v", missing.IsValid(), missing.Error())
+	}
+
+	root.RegisterFunc("cheap", func(n Node) Node {
+		return n.Filter(func(child Node) bool {
+			price, ok := child.Get("price").RawFloat()
+			return ok && price < 20
+		})
+	})
+	root.RegisterFunc("doubled", func(n Node) Node {
+		return n.Map(func(child Node) interface{} {
+			return child.Get("price").Float() * 2
+		})
+	})
+
+	if got := root.Query("/store/book[@cheap]/title").Strings(); strings.Join(got, ",") != "A,C" {
+		t.Fatalf("unexpected filter-style function result: %v", got)
+	}
+	if got := root.Query("/store/book[@cheap][@doubled]").Strings(); strings.Join(got, ",") != "16,24" {
+		t.Fatalf("unexpected chained map-style function result: %v", got)
+	}
+	if got := root.Query("/store").Query("book[@doubled][1]").Int(); got != 60 {
+		t.Fatalf("unexpected map-style function on sub-query: %d", got)
+	}
+
+	root.RemoveFunc("cheap")
+	if got := root.Query("/store/book[@cheap]/title"); got.IsValid() {
+		t.Fatalf("expected removed function to stop resolving, got %v", got.Strings())
+	}
+}
+
+func TestRegisteredFuncsWithArguments(t *testing.T) {
+	root, err := Parse(`{"store":{"book":[{"title":"A","price":8},{"title":"B","price":30},{"title":"C","price":12}]}}`)
+	if err != nil {
+		t.Fatalf("Parse failed: %v", err)
+	}
+	root.RegisterFuncArgs("below", func(n Node, args ...Arg) Node {
+		return n.Filter(func(child Node) bool {
+			return child.Get("price").Float() < args[0].Float()
+		})
+	})
+
+	if got := root.Query("/store/book[@below(20)]/title").Strings(); strings.Join(got, ",") != "A,C" {
+		t.Fatalf("unexpected [@below(20)] result: %v", got)
+	}
+	if got := root.Query("/store/book[@topk('price', 2)]/title").Strings(); strings.Join(got, ",") != "B,C" {
+		t.Fatalf("unexpected [@topk('price', 2)] result: %v", got)
+	}
+	if got := root.QueryPath(Path().Key("store").Key("book").Func("sortBy", "price").Key("title")).Strings(); strings.Join(got, ",") != "A,C,B" {
+		t.Fatalf("unexpected sortBy result: %v", got)
+	}
+	if got := root.Query("/store/book[@topk('price')]"); got.IsValid() || !strings.Contains(got.Error().Error(), "takes 2 arguments") {
+		t.Fatalf("expected an arity error, got %v", got.Error())
+	}
+}
+
+func TestSortByTopN(t *testing.T) {
+	root, err := Parse(`{"book":[{"t":"A","price":12},{"t":"B","price":8},{"t":"C"},{"t":"D","price":30},{"t":"E","price":8}]}`)
+	if err != nil {
+		t.Fatalf("Parse failed: %v", err)
+	}
+	if got := root.Query("/book").SortBy("price", false).Limit(3).Map(func(n Node) interface{} { return n.Get("t").String() }).Strings(); strings.Join(got, ",") != "B,E,A" {
+		t.Fatalf("cheapest 3 = %v", got)
+	}
+	if got := root.Query("/book[*]/t").Strings(); strings.Join(got, ",") != "A,B,C,D,E" {
+		t.Fatalf("document order changed: %v", got)
+	}
+}
+
+func TestBytesReportsNoMatches(t *testing.T) {
+	root, err := Parse(`{"a":[{"v":1},{"v":2}]}`)
+	if err != nil {
+		t.Fatalf("Parse failed: %v", err)
+	}
+	if _, err := root.Query("/a[?(@.v > 5)]").Bytes(); !errors.Is(err, ErrNoMatches) {
+		t.Fatalf("expected ErrNoMatches, got %v", err)
+	}
+	if got, err := root.Query("/a[*]/v").Bytes(); err != nil || string(got) != "[1,2]" {
+		t.Fatalf("unexpected Bytes result: %s, %v", got, err)
+	}
+}
+
+func TestParseErrorsAndPositions(t *testing.T) {
+	_, err := MustParse("{\"a\": [1,\n 2,, 3]}")
+	var syntaxErr *SyntaxError
+	if !errors.As(err, &syntaxErr) {
+		t.Fatalf("expected *SyntaxError, got %T: %v", err, err)
+	}
+	if syntaxErr.Line != 2 || syntaxErr.Column != 4 {
+		t.Fatalf("unexpected error position: %v", err)
+	}
+
+	root, err := ParseWithOptions("{\n  \"user\": {\"name\": \"x\"}\n}", ParseOptions{TrackPositions: true})
+	if err != nil {
+		t.Fatalf("ParseWithOptions failed: %v", err)
+	}
+	pos, ok := root.Query("/user/name").Position()
+	if !ok || pos != (Position{Line: 2, Column: 20, Offset: 21}) {
+		t.Fatalf("unexpected node position: %+v (%v)", pos, ok)
+	}
+}
+
+func TestParseWithNodePool(t *testing.T) {
+	pool := NewNodePool()
+	for i := 0; i < 3; i++ {
+		root, err := ParseWithOptions(`{"user":{"name":"x","tags":["a"]}}`, ParseOptions{Pool: pool})
+		if err != nil {
+			t.Fatalf("ParseWithOptions failed: %v", err)
+		}
+		name := root.Query("/user/name")
+		if name.String() != "x" {
+			t.Fatalf("unexpected name: %q", name.String())
+		}
+		root.Release()
+		if _, err := name.TryString(); !errors.Is(err, ErrReleased) {
+			t.Fatalf("expected ErrReleased after Release, got %v", err)
+		}
+		if err := root.Query("/user").Error(); !errors.Is(err, ErrReleased) {
+			t.Fatalf("expected ErrReleased from the released root, got %v", err)
+		}
+	}
+}
+
+func TestParseWithValidateUTF8(t *testing.T) {
+	root, err := ParseWithOptions(`{"n\u00e4me":"\ud83d\ude00"}`, ParseOptions{ValidateUTF8: true})
+	if err != nil {
+		t.Fatalf("ParseWithOptions failed: %v", err)
+	}
+	name := root.Get("näme")
+	if name.String() != "😀" {
+		t.Fatalf("unexpected value: %q", name.String())
+	}
+	if escaped, ok := name.RawEscaped(); !ok || escaped != `\ud83d\ude00` {
+		t.Fatalf("unexpected RawEscaped: %q, %v", escaped, ok)
+	}
+
+	_, err = ParseWithOptions(`{"a":"\ud83d"}`, ParseOptions{ValidateUTF8: true})
+	var syntaxErr *SyntaxError
+	if !errors.As(err, &syntaxErr) || syntaxErr.Position.Column != 7 {
+		t.Fatalf("expected positioned *SyntaxError, got %v", err)
+	}
+}
+
+func TestResultWriteBack(t *testing.T) {
+	root, err := Parse(`{"store":{"book":[{"title":"A","available":true},{"title":"B","available":false},{"title":"C","available":true}]}}`)
+	if err != nil {
+		t.Fatalf("Parse failed: %v", err)
+	}
+	if res := root.Query("/store/book[?(@.available == true)]").Set("discounted", true); !res.IsValid() {
+		t.Fatalf("Set failed: %v", res.Error())
+	}
+	titles := root.Query("/store/book[?(@.discounted == true)]/title").Strings()
+	if len(titles) != 2 || titles[0] != "A" || titles[1] != "C" {
+		t.Fatalf("unexpected discounted titles: %v", titles)
+	}
+	data, err := root.Bytes()
+	if err != nil {
+		t.Fatalf("Bytes failed: %v", err)
+	}
+	want := `{"store":{"book":[{"title":"A","available":true,"discounted":true},{"title":"B","available":false},{"title":"C","available":true,"discounted":true}]}}`
+	if string(data) != want {
+		t.Fatalf("unexpected serialization:\n got %s\nwant %s", data, want)
+	}
+}
+
+func TestQueryContextDeadline(t *testing.T) {
+	depth := 40000
+	root, err := Parse(strings.Repeat(`[`, depth) + strings.Repeat(`]`, depth))
+	if err != nil {
+		t.Fatalf("Parse failed: %v", err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+
+	begin := time.Now()
+	res := root.QueryContext(ctx, "//*")
+	if !errors.Is(res.Error(), context.DeadlineExceeded) {
+		t.Fatalf("expected DeadlineExceeded, got %v", res.Error())
+	}
+	if elapsed := time.Since(begin); elapsed > 500*time.Millisecond {
+		t.Fatalf("query took %v after a 10ms deadline", elapsed)
+	}
+
+	small, _ := Parse(`{"a":[{"b":1},{"b":2}]}`)
+	if got := small.QueryContext(context.Background(), "//b").Len(); got != 2 {
+		t.Fatalf("expected 2 matches, got %d", got)
+	}
+}
+
+func TestGroupBy(t *testing.T) {
+	root, err := Parse(`{"book":[{"cat":"a","price":10},{"cat":"b","price":4},{"cat":"a","price":20},{"price":1}]}`)
+	if err != nil {
+		t.Fatalf("Parse failed: %v", err)
+	}
+	var groups Groups
+	groups, err = root.Query("/book").GroupBy("cat")
+	if err != nil {
+		t.Fatalf("GroupBy failed: %v", err)
+	}
+	if counts := groups.Count(); len(counts) != 2 || counts["a"] != 2 || counts["b"] != 1 {
+		t.Fatalf("unexpected counts: %v", counts)
+	}
+	if avg := groups.Avg("price"); avg["a"] != 15 || avg["b"] != 4 {
+		t.Fatalf("unexpected averages: %v", avg)
+	}
+}
+
+func TestDeleteAll(t *testing.T) {
+	root, err := Parse(`{"book":[{"t":"a","ok":true},{"t":"b","ok":false},{"t":"c","ok":false}],"users":[{"n":1,"password":"x"},{"n":2,"password":"y"}]}`)
+	if err != nil {
+		t.Fatalf("Parse failed: %v", err)
+	}
+	if n, err := root.DeleteAll("/book[?(@.ok == false)]"); err != nil || n != 2 {
+		t.Fatalf("DeleteAll filter = %d, %v", n, err)
+	}
+	if n, err := root.DeleteAll("/users[*]/password"); err != nil || n != 2 {
+		t.Fatalf("DeleteAll wildcard = %d, %v", n, err)
+	}
+	if n, err := root.DeleteAll("/book[?(@.ok == false)]"); err != nil || n != 0 {
+		t.Fatalf("DeleteAll without matches = %d, %v", n, err)
+	}
+	data, err := root.Bytes()
+	if err != nil {
+		t.Fatalf("Bytes failed: %v", err)
+	}
+	if want := `{"book":[{"t":"a","ok":true}],"users":[{"n":1},{"n":2}]}`; string(data) != want {
+		t.Fatalf("unexpected serialization:\n got %s\nwant %s", data, want)
+	}
+}
+
+func TestMustQueryPanicContext(t *testing.T) {
+	root, err := Parse(`{"server":{"port":"8080"}}`)
+	if err != nil {
+		t.Fatalf("Parse failed: %v", err)
+	}
+
+	defer func() {
+		err, _ := recover().(error)
+		var pathErr *PathError
+		if !errors.As(err, &pathErr) || !errors.Is(err, ErrTypeAssertion) {
+			t.Fatalf("expected *PathError wrapping ErrTypeAssertion, got %v", err)
+		}
+		if !strings.Contains(err.Error(), "/server/port") || !strings.Contains(err.Error(), "MustInt") {
+			t.Fatalf("expected path and conversion in panic message, got %q", err.Error())
+		}
+	}()
+	root.MustQuery("/server/port").MustInt()
+}
+
+func TestMustReturnsZero(t *testing.T) {
+	root, err := Parse(`{"server":{"port":"8080"}}`)
+	if err != nil {
+		t.Fatalf("Parse failed: %v", err)
+	}
+	if prev := SetMustBehavior(MustReturnsZero); prev != MustPanics {
+		t.Fatalf("expected MustPanics by default, got %d", prev)
+	}
+	defer SetMustBehavior(MustPanics)
+
+	port := root.MustQuery("/server/port")
+	if got := port.MustInt(); got != 0 {
+		t.Fatalf("expected 0, got %d", got)
+	}
+	var pathErr *PathError
+	if err := port.LastError(); !errors.As(err, &pathErr) || pathErr.Op != "MustInt" || !errors.Is(err, ErrTypeAssertion) {
+		t.Fatalf("expected a MustInt *PathError, got %v", err)
+	}
+	if got := port.MustString(); got != "8080" {
+		t.Fatalf("expected 8080, got %q", got)
+	}
+
+	missing := root.MustQuery("/server/host")
+	if missing.IsValid() || missing.MustString() != "" {
+		t.Fatal("expected an invalid node with zero values")
+	}
+	if err := root.LastError(); !errors.As(err, &pathErr) || pathErr.Path != "/server/host" {
+		t.Fatalf("expected the MustQuery error on the root, got %v", err)
+	}
+	if err := missing.LastError(); !errors.As(err, &pathErr) || pathErr.Op != "MustString" {
+		t.Fatalf("expected a MustString *PathError, got %v", err)
+	}
+}
+
+func TestDocumentMustBehavior(t *testing.T) {
+	quiet, _ := Parse(`{"server":{"port":"8080"}}`)
+	loud, _ := Parse(`{"server":{"port":"8080"}}`)
+	if prev := SetDocumentMustBehavior(quiet, MustReturnsZero); prev != MustPanics {
+		t.Fatalf("expected the default MustPanics, got %d", prev)
+	}
+	if got := quiet.Get("server").Get("host").MustString(); got != "" {
+		t.Fatalf("expected a zero value, got %q", got)
+	}
+	if got := MustBehaviorOf(quiet.Query("/server/port")); got != MustReturnsZero {
+		t.Fatalf("expected the document behavior, got %d", got)
+	}
+	defer func() {
+		if recover() == nil {
+			t.Fatal("expected the other document to keep panicking")
+		}
+	}()
+	loud.Get("server").Get("host").MustString()
+}
+
+func TestParseDuplicateKeys(t *testing.T) {
+	doc := `{"a":1,"b":{"k":"first","k":"second"},"a":2}`
+	for policy, want := range map[DuplicateKeyPolicy]string{LastWins: "second", FirstWins: "first"} {
+		root, err := ParseWithOptions(doc, ParseOptions{DuplicateKeys: policy})
+		if err != nil {
+			t.Fatalf("ParseWithOptions failed: %v", err)
+		}
+		if got := root.Query("/b/k").String(); got != want {
+			t.Errorf("policy %d: /b/k = %q, want %q", policy, got, want)
+		}
+		if got := root.Query("//k").String(); got != want {
+			t.Errorf("policy %d: //k = %q, want %q", policy, got, want)
+		}
+	}
+
+	_, err := ParseWithOptions(doc, ParseOptions{DuplicateKeys: ErrorOnDuplicate})
+	var syntaxErr *SyntaxError
+	if !errors.As(err, &syntaxErr) || syntaxErr.Offset != 24 || !strings.Contains(syntaxErr.Msg, `"k"`) {
+		t.Fatalf("expected a duplicate key *SyntaxError at offset 24, got %v", err)
+	}
+}
+
+func TestParseJSON5(t *testing.T) {
+	doc := `{
+	// listeners
+	web: {port: 0x1F90, hosts: ['a', 'b',]},
+	limit: Infinity,
+}`
+	if _, err := ParseWithOptions(doc, ParseOptions{Dialect: JSON5}); err == nil {
+		t.Fatal("expected Infinity to be rejected without AllowNonFinite")
+	}
+	root, err := ParseWithOptions(doc, ParseOptions{Dialect: JSON5, AllowNonFinite: true})
+	if err != nil {
+		t.Fatalf("ParseWithOptions failed: %v", err)
+	}
+	if got := root.Query("/web/port").Int(); got != 8080 {
+		t.Errorf("/web/port = %d, want 8080", got)
+	}
+	if got, err := root.Get("limit").TryFloat(); err != nil || !math.IsInf(got, 1) {
+		t.Errorf("limit = %v, %v, want +Inf", got, err)
+	}
+	if _, err := root.Bytes(); !errors.Is(err, ErrNumberOverflow) {
+		t.Errorf("Bytes() error = %v, want ErrNumberOverflow", err)
+	}
+	root.Set("limit", 100)
+	if got, want := root.String(), `{"web":{"port":8080,"hosts":["a","b"]},"limit":100}`; got != want {
+		t.Errorf("String() = %s, want %s", got, want)
+	}
+}
+
+func TestNodeMetrics(t *testing.T) {
+	root, err := Parse(`{"items":[{"id":1},{"id":2,"tags":["a","b","c"]}],"name":"x"}`)
+	if err != nil {
+		t.Fatalf("Parse failed: %v", err)
+	}
+	want := DocMetrics{Nodes: 11, MaxDepth: 5, Objects: 3, Arrays: 2, Strings: 4, Numbers: 2,
+		TotalStringBytes: 4, LargestArrayLen: 3, LargestArrayPath: "/items[1]/tags"}
+	if got := root.Metrics(); got != want {
+		t.Errorf("Metrics() = %+v, want %+v", got, want)
+	}
+	root.Get("items").Index(0).Set("id", 1)
+	if got := root.Metrics(); got != want {
+		t.Errorf("Metrics() after an edit = %+v, want %+v", got, want)
+	}
+}
+
+func TestNodeBytesWith(t *testing.T) {
+	doc := `{"user": {"name": "ann", "password": "secret"}, "items": [{"token": "t1"}, {"token": "t2"}]}`
+	root, err := Parse(doc)
+	if err != nil {
+		t.Fatalf("Parse failed: %v", err)
+	}
+	plain, _ := root.Bytes()
+	out, err := root.BytesWith(SerializeOptions{Redact: []string{"//password", "/items[*]/token"}})
+	if err != nil {
+		t.Fatalf("BytesWith failed: %v", err)
+	}
+	if want := `{"user":{"name":"ann","password":"[REDACTED]"},"items":[{"token":"[REDACTED]"},{"token":"[REDACTED]"}]}`; string(out) != want {
+		t.Errorf("BytesWith = %s, want %s", out, want)
+	}
+	if again, _ := root.Bytes(); string(again) != string(plain) || string(plain) != doc {
+		t.Errorf("Bytes after BytesWith = %s, want %s", again, doc)
+	}
+	if got := root.Query("/user/password").String(); got != "secret" {
+		t.Errorf("password = %q, want secret", got)
+	}
+}
+
+func TestNodeFindValue(t *testing.T) {
+	root, err := Parse(`{"orders":[{"id":"ORD-12345","qty":2},{"id":"ORD-7","refs":["ORD-12345"],"qty":2.0}]}`)
+	if err != nil {
+		t.Fatalf("Parse failed: %v", err)
+	}
+	paths := root.FindValue("ORD-12345")
+	if want := []string{"/orders[0]/id", "/orders[1]/refs[0]"}; !reflect.DeepEqual(paths, want) {
+		t.Fatalf("FindValue = %v, want %v", paths, want)
+	}
+	if got := root.FindValueN(2, 1); !reflect.DeepEqual(got, []string{"/orders[0]/qty"}) {
+		t.Errorf("FindValueN = %v", got)
+	}
+	if got := root.FindStringContains("ORD-"); len(got) != 3 {
+		t.Errorf("FindStringContains = %v", got)
+	}
+	for _, path := range paths {
+		root.SetByPath(path, "ORD-54321")
+	}
+	if got := root.FindValue("ORD-12345"); got == nil || len(got) != 0 {
+		t.Errorf("FindValue after SetByPath = %#v, want empty", got)
+	}
+}
+
+func TestNodeIter(t *testing.T) {
+	root, err := Parse(`{"items":[1,2,3],"meta":{"a":1}}`)
+	if err != nil {
+		t.Fatalf("Parse failed: %v", err)
+	}
+	sum := int64(0)
+	it := root.Get("items").Iter()
+	for it.Next() {
+		sum += it.Value().Int()
+	}
+	if sum != 6 || it.Err() != nil {
+		t.Fatalf("sum = %d, err = %v", sum, it.Err())
+	}
+
+	it = root.Iter()
+	if !it.Next() || it.Key() != "items" {
+		t.Fatalf("first member = %q", it.Key())
+	}
+	root.Set("extra", true)
+	if it.Next() || !errors.Is(it.Err(), ErrModifiedDuringIteration) {
+		t.Fatalf("expected ErrModifiedDuringIteration, got %v", it.Err())
+	}
+}
+
+// TestNodeViewsShareOneTree checks that the root returned by Parse and the
+// nodes reached from it are views of one document: functions, writes and
+// serialization are seen the same way through each of them.
+func TestNodeViewsShareOneTree(t *testing.T) {
+	root, err := Parse(`{"store":{"book":[{"title":"A","price":8},{"title":"B","price":12}]}}`)
+	if err != nil {
+		t.Fatalf("Parse failed: %v", err)
+	}
+	store := root.Get("store")
+	root.RegisterFunc("cheap", func(n Node) Node {
+		return n.Filter(func(book Node) bool { return book.Get("price").Float() < 10 })
+	})
+	if got := store.Query("book[@cheap]/title").Strings(); len(got) != 1 || got[0] != "A" {
+		t.Errorf("func registered on the root, queried from a subtree = %v, want [A]", got)
+	}
+
+	store.Query("book[1]").Set("price", 9)
+	if got := root.Query("/store/book[@cheap]/title").Strings(); len(got) != 2 {
+		t.Errorf("after Set through a subtree, cheap titles = %v, want [A B]", got)
+	}
+	if got := root.Query("/store/book[1]/price").Int(); got != 9 {
+		t.Errorf("price read through the root = %d, want 9", got)
+	}
+
+	if got, want := store.String(), root.Get("store").String(); got != want {
+		t.Errorf("subtree String() = %s, root view = %s", got, want)
+	}
+	if got, want := root.String(), `{"store":{"book":[{"title":"A","price":8},{"title":"B","price":9}]}}`; got != want {
+		t.Errorf("String() = %s, want %s", got, want)
+	}
+}
+
+func TestUnique(t *testing.T) {
+	doc, err := Parse(`{"orders":[{"tag":"new","n":1},{"tag":"old","n":1.0},{"tag":"new","n":2}]}`)
+	if err != nil {
+		t.Fatalf("Parse failed: %v", err)
+	}
+	if tags := doc.Query("//tag").Unique(); tags.String() != `["new","old"]` {
+		t.Errorf("//tag Unique() = %s", tags.String())
+	}
+	if ns := doc.Query("//n[@distinct]"); ns.String() != `[1,2]` {
+		t.Errorf("//n[@distinct] = %s", ns.String())
+	}
+}
+
+func TestExistsAndHasMatches(t *testing.T) {
+	doc, err := Parse(`{"products":[{"name":"pen","price":2}]}`)
+	if err != nil {
+		t.Fatalf("Parse failed: %v", err)
+	}
+	empty := doc.Query("/products[?(@.price > 99999)]")
+	if !empty.Exists() || empty.HasMatches() || empty.Error() != nil {
+		t.Errorf("empty filter: Exists() = %v, HasMatches() = %v, Error() = %v", empty.Exists(), empty.HasMatches(), empty.Error())
+	}
+	typo := doc.Query("/prodcts[?(@.price > 1)]")
+	if typo.Exists() || typo.HasMatches() || typo.Error() == nil {
+		t.Errorf("typo: Exists() = %v, HasMatches() = %v, Error() = %v", typo.Exists(), typo.HasMatches(), typo.Error())
+	}
+}
+
+func TestStaleResults(t *testing.T) {
+	doc, err := Parse(`{"posts":[{"t":1},{"t":2}],"user":{"age":1}}`)
+	if err != nil {
+		t.Fatalf("Parse failed: %v", err)
+	}
+	posts := doc.Get("posts")
+	user := doc.Get("user")
+	ts := doc.Query("/posts[*]/t")
+
+	doc.SetByPath("/user/age", 25)
+	posts.Append(map[string]interface{}{"t": 3})
+	if doc.Query("/posts").Len() != 3 || user.Get("age").Int() != 25 {
+		t.Fatalf("held handles diverged: %s", doc.String())
+	}
+
+	doc.Set("user", map[string]interface{}{"age": 30})
+	if !errors.Is(user.Error(), ErrStaleResult) || user.Get("age").Int() != 0 {
+		t.Fatalf("replaced handle: %v", user.Error())
+	}
+	doc.Get("posts").Delete("0")
+	if !errors.Is(ts.Error(), ErrStaleResult) {
+		t.Fatalf("match set with a removed match: %v", ts.Error())
+	}
+}
+
+func TestStrictConversionErrors(t *testing.T) {
+	root, err := ParseWithOptions(`{"item":{"price":"12.5","qty":"-3"}}`, ParseOptions{StrictConversionErrors: true})
+	if err != nil {
+		t.Fatalf("ParseWithOptions failed: %v", err)
+	}
+	price := root.Query("/item/price")
+	if price.Float() != 0 {
+		t.Fatal("Float of a string should stay 0")
+	}
+	var typeErr *TypeError
+	if err := price.LastError(); !errors.As(err, &typeErr) || err.Error() != "Float /item/price: cannot convert string at /item/price to float" {
+		t.Fatalf("LastError() = %v", err)
+	}
+	if price.FloatLenient() != 12.5 || root.Query("/item/qty").IntLenient() != -3 {
+		t.Fatalf("lenient conversions = %v, %d", price.FloatLenient(), root.Query("/item/qty").IntLenient())
+	}
+}
+
+func TestIntDoesNotTruncate(t *testing.T) {
+	root, err := Parse(`{"cents":[1999,42.7,-42.7,1e3,1e20,9007199254740993]}`)
+	if err != nil {
+		t.Fatalf("Parse failed: %v", err)
+	}
+	var got [][4]int64
+	for _, n := range root.Query("/cents").Array() {
+		exact, _ := n.IntExact()
+		got = append(got, [4]int64{n.Int(), exact, n.IntRound(), n.IntFloor()})
+	}
+	want := [][4]int64{
+		{1999, 1999, 1999, 1999},
+		{0, 0, 43, 42},
+		{0, 0, -43, -43},
+		{1000, 1000, 1000, 1000},
+		{0, 0, 0, 0},
+		{9007199254740993, 9007199254740993, 9007199254740993, 9007199254740993},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("Int, IntExact, IntRound, IntFloor = %v, want %v", got, want)
+	}
+	if _, err := root.Query("/cents[1]").IntExact(); !errors.Is(err, ErrNotInteger) {
+		t.Fatalf("IntExact of 42.7 = %v, want ErrNotInteger", err)
+	}
+}
+
+func TestPanickingFunctionBecomesError(t *testing.T) {
+	root, err := Parse(`{"items":[1,2]}`)
+	if err != nil {
+		t.Fatalf("Parse failed: %v", err)
+	}
+	root.RegisterFunc("risky", func(Node) Node { panic("bad input") })
+
+	r := root.Query("/items[@risky]")
+	var p *PanicError
+	if r.IsValid() || !errors.As(r.Error(), &p) || p.Value != "bad input" {
+		t.Fatalf("Query error = %v, want a PanicError", r.Error())
+	}
+	if r := MustCompileQuery("/items[@risky]").Query(root); r.IsValid() {
+		t.Error("a prepared query should recover the panic too")
+	}
+	if root.Query("/items[1]").Int() != 2 {
+		t.Error("document should stay usable")
+	}
+}
+
+func TestStructureFunctionsInQueries(t *testing.T) {
+	root, err := Parse(`{"auth":{"oauth2":{"google":{},"github":{}}},"teams":[{"oauth2":{"okta":{}}},{"id":2}]}`)
+	if err != nil {
+		t.Fatalf("Parse failed: %v", err)
+	}
+	if got := root.Query("//oauth2/keys()").Strings(); !reflect.DeepEqual(got, []string{"google", "github", "okta"}) {
+		t.Errorf("//oauth2/keys() = %q", got)
+	}
+	if got := root.Query("/teams[?(@.id)]/entries()").String(); got != `[{"key":"id","value":2}]` {
+		t.Errorf("entries after a filter = %s", got)
+	}
+	if got := root.Query("/teams/keys()").String(); got != `["0","1"]` {
+		t.Errorf("keys of an array = %s", got)
+	}
+	if root.Query("/teams[1]/id/values()").IsValid() {
+		t.Error("values() of a scalar should be an error")
+	}
+}
+
+func TestCanonicalBytesMatchForEqualDocuments(t *testing.T) {
+	a, err := Parse(`{"b": "x", "a": [1.0, 1e2], "c": {"z": null, "y": -0.0}}`)
+	if err != nil {
+		t.Fatalf("Parse failed: %v", err)
+	}
+	b, err := MustParse(`{"c":{"y":0,"z":null},"a":[1,100],"b":"x"}`)
+	if err != nil {
+		t.Fatalf("MustParse failed: %v", err)
+	}
+	b.Set("b", "x")
+	if !Equal(a, b) {
+		t.Fatal("documents should be equal")
+	}
+	ca, errA := a.CanonicalBytes()
+	cb, errB := b.CanonicalBytes()
+	if errA != nil || errB != nil || string(ca) != string(cb) || string(ca) != `{"a":[1,100],"b":"x","c":{"y":0,"z":null}}` {
+		t.Errorf("canonical forms = %s (%v), %s (%v)", ca, errA, cb, errB)
+	}
+}
+
+func TestDirtyPathsAfterBatch(t *testing.T) {
+	root, err := Parse(`{"user":{"name":"ann","tags":["a"],"legacy":1},"n":1}`)
+	if err != nil {
+		t.Fatalf("Parse failed: %v", err)
+	}
+	err = Batch(root, func(tx *Tx) error {
+		if err := tx.Set("/user/name", "bob"); err != nil {
+			return err
+		}
+		if err := tx.Append("/user/tags", "b"); err != nil {
+			return err
+		}
+		return tx.Delete("/user/legacy")
+	})
+	if err != nil {
+		t.Fatalf("Batch failed: %v", err)
+	}
+	want := []string{"/user/name", "/user/tags[1]", "/user/legacy"}
+	if got := root.DirtyPaths(); !reflect.DeepEqual(got, want) {
+		t.Errorf("DirtyPaths() = %q, want %q", got, want)
+	}
+	if got := root.Get("n").DirtyPaths(); len(got) != 0 {
+		t.Errorf("untouched subtree has dirty paths %q", got)
+	}
+	root.ResetDirty()
+	if got := root.DirtyPaths(); len(got) != 0 {
+		t.Errorf("DirtyPaths() after ResetDirty = %q", got)
+	}
+}
+
+func TestTruthyFeatureFlags(t *testing.T) {
+	root, err := Parse(`{"flags":{"beta":"true","dark":1,"legacy":"0","new_ui":true,"trial":""}}`)
+	if err != nil {
+		t.Fatalf("Parse failed: %v", err)
+	}
+	want := map[string]bool{"beta": true, "dark": true, "legacy": false, "new_ui": true, "trial": false, "missing": false}
+	for flag, on := range want {
+		if got := root.Query("/flags/" + flag).Truthy(); got != on {
+			t.Errorf("flag %s: Truthy() = %v, want %v", flag, got, on)
+		}
+	}
+	if root.Query("/flags/beta").Bool() {
+		t.Error("Bool should stay strict for the string \"true\"")
+	}
+}
+
+func TestQueryFirstAndQueryN(t *testing.T) {
+	root, err := Parse(`{"services":[{"config":{"name":"auth","port":1}},{"nested":{"config":{"name":"billing","port":2}}},{"config":{"name":"billing","port":3}}],"events":[1,2,3,4]}`)
+	if err != nil {
+		t.Fatalf("Parse failed: %v", err)
+	}
+	if got := root.QueryFirst("//config[?(@.name == 'billing')]").Get("port").Int(); got != 2 {
+		t.Errorf("first billing config has port %d, want 2", got)
+	}
+	if got := root.QueryFirst("//config/port").Int(); got != 1 {
+		t.Errorf("QueryFirst(//config/port) = %d, want 1", got)
+	}
+	if got := root.QueryN("/events[*]", 2).Strings(); !reflect.DeepEqual(got, []string{"1", "2"}) {
+		t.Errorf("QueryN(/events[*], 2) = %v", got)
+	}
+	if got := root.QueryFirst("//nothing"); got.IsValid() || !errors.Is(got.Error(), ErrNoMatches) {
+		t.Errorf("QueryFirst without matches = %v, want ErrNoMatches", got.Error())
+	}
+}
+
+func TestBytesAfterEditKeepsSourceText(t *testing.T) {
+	src := "{\n  \"zone\": \"caf\\u00e9\",\n  \"user\": {\"name\": \"ann\", \"age\": 1.0},\n  \"tags\": [\"a\", \"b\"]\n}"
+	root, err := Parse(src)
+	if err != nil {
+		t.Fatalf("Parse failed: %v", err)
+	}
+	root.SetByPath("/user/name", "bob")
+	root.Get("tags").Append("c")
+	got, err := root.Bytes()
+	if err != nil {
+		t.Fatalf("Bytes failed: %v", err)
+	}
+	want := "{\n  \"zone\": \"caf\\u00e9\",\n  \"user\": {\"name\": \"bob\", \"age\": 1.0},\n  \"tags\": [\"a\", \"b\", \"c\"]\n}"
+	if string(got) != want {
+		t.Errorf("Bytes() =\n%s\nwant\n%s", got, want)
+	}
+}
+
+func TestAbsoluteQueryFromSubtree(t *testing.T) {
+	root, err := Parse(`{"limits":{"max":10},"store":{"book":[{"title":"A","price":8},{"title":"B","price":12}]}}`)
+	if err != nil {
+		t.Fatalf("Parse failed: %v", err)
+	}
+	book := root.Query("/store/book[1]")
+	if got := book.Query("/limits/max").Int(); got != 10 {
+		t.Errorf(`Query("/limits/max") from a book = %d, want 10`, got)
+	}
+	if got := book.Query("./title").String(); got != "B" {
+		t.Errorf(`Query("./title") from a book = %q, want B`, got)
+	}
+	cheap := root.Query("/store/book").Filter(func(b Node) bool {
+		return b.Get("price").Float() < b.Query("/limits/max").Float()
+	})
+	if got := cheap.Query("title").Strings(); !reflect.DeepEqual(got, []string{"A"}) {
+		t.Errorf("books under the limit = %v, want [A]", got)
+	}
+	store := root.Get("store")
+	for _, path := range store.FindValue("B") {
+		if got := store.Query("." + path).String(); got != "B" {
+			t.Errorf("FindValue path %q read from the store = %q, want B", path, got)
+		}
+	}
+}
+
+func TestBuildDocumentWithoutParsing(t *testing.T) {
+	root := NewObject()
+	root.Set("service", "api")
+	root.Set("ports", []interface{}{})
+	root.Get("ports").AppendAll(80, 443)
+	root.SetByPath("/limits", map[string]interface{}{"rps": 100})
+	if got, want := root.String(), `{"service":"api","ports":[80,443],"limits":{"rps":100}}`; got != want {
+		t.Fatalf("String() = %s, want %s", got, want)
+	}
+	if got := root.Query("/ports[-1]").Int(); got != 443 {
+		t.Errorf("last port = %d, want 443", got)
+	}
+
+	list := NewArray()
+	list.Append(map[string]interface{}{"id": 1})
+	if got := list.String(); got != `[{"id":1}]` {
+		t.Errorf("NewArray document = %s", got)
+	}
+
+	doc, err := FromValue([]interface{}{"a", 1.5, true, nil})
+	if err != nil {
+		t.Fatalf("FromValue failed: %v", err)
+	}
+	if got := doc.String(); got != `["a",1.5,true,null]` {
+		t.Errorf("FromValue document = %s", got)
+	}
+	if _, err := FromValue(make(chan int)); err == nil {
+		t.Error("expected FromValue to reject a channel")
+	}
+}
+
+func TestValueTellsNullFromMissing(t *testing.T) {
+	root, err := Parse(`{"id":7,"nick":null,"tags":[{"v":1},{"v":2.5}]}`)
+	if err != nil {
+		t.Fatalf("Parse failed: %v", err)
+	}
+	if v, err := root.Query("/id").Value(); err != nil || v != int64(7) {
+		t.Errorf("Value() of /id = %#v, %v, want int64(7)", v, err)
+	}
+	if v, err := root.Query("/nick").Value(); err != nil || v != nil {
+		t.Errorf("Value() of null = %#v, %v, want nil without an error", v, err)
+	}
+	if _, err := root.Query("/missing").Value(); err == nil {
+		t.Error("Value() of a missing path should fail")
+	}
+	if _, err := root.Query("/tags[?(@.v > 9)]").Value(); !errors.Is(err, ErrNoMatches) {
+		t.Errorf("Value() of an empty result = %v, want ErrNoMatches", err)
+	}
+	values := root.Query("//v").Values()
+	if !reflect.DeepEqual(values, []interface{}{int64(1), 2.5}) {
+		t.Errorf("Values() = %#v", values)
+	}
+	if got := root.Query("/missing").Values(); got == nil || len(got) != 0 {
+		t.Errorf("Values() of a missing path = %#v, want an empty slice", got)
+	}
+}
+
+func TestMapInterfaceTellsTypeFromNoMatch(t *testing.T) {
+	root, err := Parse(`{"user":{"name":"Ann","roles":["admin"],"age":41},"tags":["x","y"]}`)
+	if err != nil {
+		t.Fatalf("Parse failed: %v", err)
+	}
+	m, err := root.Query("/user").MapInterface()
+	want := map[string]interface{}{"name": "Ann", "roles": []interface{}{"admin"}, "age": int64(41)}
+	if err != nil || !reflect.DeepEqual(m, want) {
+		t.Errorf("MapInterface() = %#v, %v, want %#v", m, err, want)
+	}
+	if s, err := root.Query("/tags").SliceInterface(); err != nil || !reflect.DeepEqual(s, []interface{}{"x", "y"}) {
+		t.Errorf("SliceInterface() = %#v, %v", s, err)
+	}
+	if _, err := root.Query("/tags").MapInterface(); !errors.Is(err, ErrTypeAssertion) || errors.Is(err, ErrNoMatches) {
+		t.Errorf("MapInterface() of an array = %v, want a type error", err)
+	}
+	if _, err := root.Query("/tags[?(@ == 'z')]").SliceInterface(); !errors.Is(err, ErrNoMatches) || errors.Is(err, ErrTypeAssertion) {
+		t.Errorf("SliceInterface() of no match = %v, want ErrNoMatches", err)
+	}
+}
+
+func TestGetThroughQueryResults(t *testing.T) {
+	root, err := Parse(`{"store":{"book":[{"title":"A","price":8},{"title":"B","price":15}]}}`)
+	if err != nil {
+		t.Fatalf("Parse failed: %v", err)
+	}
+	cheap := root.Query("//store").Get("book").Query("[?(@.price < 10)]/title")
+	if got := cheap.String(); got != "A" {
+		t.Errorf("Query -> Get -> Query = %q, want A", got)
+	}
+	if got := root.Query("/store/book[*]").Get("title").Strings(); !reflect.DeepEqual(got, []string{"A", "B"}) {
+		t.Errorf("Get on several matches = %v, want [A B]", got)
+	}
+}
+
+func TestSetNodeValueCycleDetected(t *testing.T) {
+	const text = `{"a":{"b":[1]}}`
+	root, err := Parse(text)
+	if err != nil {
+		t.Fatalf("Parse failed: %v", err)
+	}
+	doc := NewDocument(root)
+	if err := doc.Set("/a/b/0", doc.Root); !errors.Is(err, ErrCycleDetected) {
+		t.Errorf("doc.Set(root) = %v, want ErrCycleDetected", err)
+	}
+	if err := doc.Set("/a/loop", root.Get("a")); !errors.Is(err, ErrCycleDetected) {
+		t.Errorf("doc.Set(a) = %v, want ErrCycleDetected", err)
+	}
+	if res := root.Query("/a/b").Append(root); !errors.Is(res.Error(), ErrCycleDetected) {
+		t.Errorf("Append(root) = %v, want ErrCycleDetected", res.Error())
+	}
+	if res := root.Get("a").Set("self", root.Get("a")); !errors.Is(res.Error(), ErrCycleDetected) {
+		t.Errorf("Set(self) = %v, want ErrCycleDetected", res.Error())
+	}
+	if got := root.String(); got != text {
+		t.Fatalf("String() = %s, want %s", got, text)
+	}
+
+	// A node of its own, or a copy made with Detach, is written as it is.
+	if err := doc.Set("/a/copy", root.Get("a").Detach()); err != nil {
+		t.Fatalf("doc.Set(Detach()) failed: %v", err)
+	}
+	if got := root.Query("/a/copy/b[0]").Int(); got != 1 {
+		t.Errorf("query into the copy = %d, want 1", got)
+	}
+}
+
+func TestConditionalWrites(t *testing.T) {
+	root, err := Parse(`{"user":{"name":"ann","locale":null}}`)
+	if err != nil {
+		t.Fatalf("Parse failed: %v", err)
+	}
+	if err := root.SetStrict("/user/prefrences/theme", "dark"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("SetStrict under a misspelled key = %v, want ErrNotFound", err)
+	}
+	if wrote, err := root.SetIfAbsent("/user/locale", "en"); wrote || err != nil {
+		t.Errorf("SetIfAbsent over null = %v, %v, want false", wrote, err)
+	}
+	if wrote, err := root.SetIfAbsent("/user/prefs/theme", "light"); !wrote || err != nil {
+		t.Errorf("SetIfAbsent of a new key = %v, %v, want true", wrote, err)
+	}
+	if err := root.Replace("/user/name", "bob"); err != nil {
+		t.Errorf("Replace of an existing key failed: %v", err)
+	}
+	want := `{"user":{"name":"bob","locale":null,"prefs":{"theme":"light"}}}`
+	if got := root.String(); got != want {
+		t.Errorf("document = %s, want %s", got, want)
+	}
+}
+
+func TestTextSearchOnResults(t *testing.T) {
+	root, err := Parse(`{"events":[{"msg":"GET /a 200"},{"msg":"GET /b 503"}],"code":503}`)
+	if err != nil {
+		t.Fatalf("Parse failed: %v", err)
+	}
+	msgs := root.Query("/events[*]/msg")
+	if !msgs.ContainsAny("503") || root.Query("/code").ContainsAny("503") {
+		t.Error("ContainsAny should look at every matched string and skip numbers")
+	}
+	if ok, err := msgs.MatchRegexp(`5\d\d$`); !ok || err != nil {
+		t.Errorf("MatchRegexp = %v, %v, want true", ok, err)
+	}
+	if got, err := msgs.FindAllMatches(`\d{3}`); err != nil || !reflect.DeepEqual(got, []string{"200", "503"}) {
+		t.Errorf("FindAllMatches = %q, %v", got, err)
+	}
+	if _, err := msgs.MatchRegexp(`(`); err == nil {
+		t.Error("MatchRegexp of an invalid pattern should fail")
+	}
+}
+
+func TestFuncScopes(t *testing.T) {
+	root, err := Parse(`{"a":{"b":1},"c":{"d":2}}`)
+	if err != nil {
+		t.Fatalf("Parse failed: %v", err)
+	}
+	name := func(s string) UnaryPathFunc {
+		return func(Node) Node { n, _ := FromValue(s); return n }
+	}
+	root.RegisterFunc("who", name("root"))
+	sub := root.Query("/a")
+	sub.RegisterFunc("who", name("a"))
+	if got := root.Query("/a/b[@who]").String(); got != "a" {
+		t.Errorf("below the subtree who = %s, want a", got)
+	}
+	if got := root.Query("/c/d[@who]").String(); got != "root" {
+		t.Errorf("outside the subtree who = %s, want root", got)
+	}
+	sub.RemoveFunc("who")
+	if got := root.Query("/a/b[@who]").String(); got != "root" {
+		t.Errorf("after RemoveFunc on the subtree who = %s, want root", got)
+	}
+	if got := root.CallFunc("who").String(); got != "root" {
+		t.Errorf("RemoveFunc on the subtree removed the root's function: %s", got)
+	}
+}
+
+func TestResultType(t *testing.T) {
+	root, err := Parse(`{"price":9.5,"tags":["a","b"]}`)
+	if err != nil {
+		t.Fatalf("Parse failed: %v", err)
+	}
+	if r := root.Query("/price"); r.ResultType() != Number || !r.IsNumber() || r.IsString() {
+		t.Errorf("/price: ResultType() = %v", r.ResultType())
+	}
+	tags := root.Query("/tags[*]")
+	if tags.ResultType() != MultiMatch || tags.IsArray() || tags.Type() != Array {
+		t.Errorf("/tags[*]: ResultType() = %v, Type() = %v", tags.ResultType(), tags.Type())
+	}
+	if r := root.Query("/tags"); !r.IsArray() {
+		t.Errorf("/tags: ResultType() = %v, want array", r.ResultType())
+	}
+	if got := root.Query("/missing").ResultType().String(); got != "invalid" {
+		t.Errorf("ResultType() of a miss = %q, want invalid", got)
+	}
+}
+
+func TestParseWithPaths(t *testing.T) {
+	data := `{"id":7,"user":{"name":"ann","roles":["a"]},"rest":[1,2]}`
+	root, err := ParseWithPaths(data, "/id", "/user/name", "/user/roles", "/nope")
+	if err != nil {
+		t.Fatalf("ParseWithPaths failed: %v", err)
+	}
+	if root.Query("/id").Int() != 7 || root.Query("/user/name").String() != "ann" || root.Query("/user/roles[0]").String() != "a" {
+		t.Errorf("preloaded values read wrong: %s", root.String())
+	}
+	if got := root.Query("/rest[1]").Int(); got != 2 {
+		t.Errorf("/rest[1] = %d, want 2", got)
+	}
+	_, err = ParseWithOptions(data, ParseOptions{Preload: []string{"/nope"}, RequirePreload: true})
+	if !errors.Is(err, ErrNotFound) {
+		t.Errorf("a missing required path = %v, want ErrNotFound", err)
+	}
+}
+
+func TestForEachPath(t *testing.T) {
+	root, err := Parse(`{"teams":[{"members":[{"id":1}]},{"members":[{"id":2},{"id":3}]}]}`)
+	if err != nil {
+		t.Fatalf("Parse failed: %v", err)
+	}
+	var paths []string
+	root.Query("//id").ForEachPath(func(path string, value Node) bool {
+		paths = append(paths, path)
+		return true
+	})
+	want := []string{"/teams[0]/members[0]/id", "/teams[1]/members[0]/id", "/teams[1]/members[1]/id"}
+	if !reflect.DeepEqual(paths, want) {
+		t.Errorf("ForEachPath visited %q, want %q", paths, want)
+	}
+
+	var last []PathSegment
+	root.Query("//id").ForEachSegments(func(segs []PathSegment, value Node) bool {
+		last = segs
+		return true
+	})
+	wantSegs := []PathSegment{KeySegment("teams"), IndexSegment(1), KeySegment("members"), IndexSegment(1), KeySegment("id")}
+	if !reflect.DeepEqual(last, wantSegs) {
+		t.Errorf("last segments = %v, want %v", last, wantSegs)
+	}
+}
+
+func TestNumberOverflow(t *testing.T) {
+	root, err := Parse(`{"n": 1e309}`)
+	if err != nil {
+		t.Fatalf("Parse failed: %v", err)
+	}
+	if _, err := root.Get("n").TryFloat(); !errors.Is(err, ErrNumberOverflow) {
+		t.Errorf("TryFloat of 1e309 = %v, want ErrNumberOverflow", err)
+	}
+	if res := root.Set("inf", math.Inf(1)); res.IsValid() || !errors.Is(res.Error(), ErrNumberOverflow) {
+		t.Errorf("Set of +Inf = %v, want ErrNumberOverflow", res.Error())
+	}
+	if got, err := root.Bytes(); err != nil || string(got) != `{"n": 1e309}` {
+		t.Errorf("Bytes() = %s, %v, want the source text", got, err)
+	}
+}